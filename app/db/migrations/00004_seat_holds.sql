@@ -0,0 +1,27 @@
+-- +goose Up
+
+-- Seat holds: a hold is a booking_items row with status 'held' and an expiry.
+-- Held items live under a per-holder "cart" booking (bookings.status = 'hold')
+-- until checkout turns that cart into a real booking.
+ALTER TABLE booking_items ADD COLUMN IF NOT EXISTS held_until TIMESTAMP;
+ALTER TABLE booking_items ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+-- Legacy 'held' rows without an expiry are treated as already expired.
+UPDATE booking_items SET status = 'expired' WHERE status = 'held' AND held_until IS NULL;
+
+-- A seat can be taken by at most one live item. This index is what makes
+-- parallel hold requests safe: the losing INSERT fails with a unique violation.
+CREATE UNIQUE INDEX IF NOT EXISTS uq_booking_items_live_seat ON booking_items(seat_id) WHERE status IN ('held', 'confirmed');
+
+-- Sweeper lookup for expired holds
+CREATE INDEX IF NOT EXISTS idx_booking_items_held_until ON booking_items(held_until) WHERE status = 'held';
+
+-- One open cart per holder and trip
+CREATE UNIQUE INDEX IF NOT EXISTS uq_bookings_hold_cart ON bookings(user_ref, trip_id) WHERE status = 'hold';
+
+-- +goose Down
+DROP INDEX IF EXISTS uq_bookings_hold_cart;
+DROP INDEX IF EXISTS idx_booking_items_held_until;
+DROP INDEX IF EXISTS uq_booking_items_live_seat;
+ALTER TABLE booking_items DROP COLUMN IF EXISTS created_at;
+ALTER TABLE booking_items DROP COLUMN IF EXISTS held_until;
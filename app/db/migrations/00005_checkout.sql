@@ -0,0 +1,16 @@
+-- +goose Up
+
+-- Contact details captured at checkout (lead passenger / orderer)
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS contact_name VARCHAR(200);
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS contact_email VARCHAR(255);
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS contact_phone VARCHAR(40);
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS checked_out_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_bookings_contact_email ON bookings(contact_email);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_bookings_contact_email;
+ALTER TABLE bookings DROP COLUMN IF EXISTS checked_out_at;
+ALTER TABLE bookings DROP COLUMN IF EXISTS contact_phone;
+ALTER TABLE bookings DROP COLUMN IF EXISTS contact_email;
+ALTER TABLE bookings DROP COLUMN IF EXISTS contact_name;
@@ -0,0 +1,18 @@
+-- +goose Up
+
+-- One passenger per booked seat (booking_items row)
+CREATE TABLE IF NOT EXISTS passengers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    booking_item_id UUID NOT NULL REFERENCES booking_items(id) ON DELETE CASCADE,
+    full_name VARCHAR(200) NOT NULL,
+    id_type VARCHAR(16) NOT NULL CHECK (id_type IN ('nik','passport')),
+    id_number VARCHAR(32) NOT NULL,
+    category VARCHAR(16) NOT NULL DEFAULT 'adult' CHECK (category IN ('adult','infant')),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (booking_item_id)
+);
+CREATE INDEX IF NOT EXISTS idx_passengers_id_number ON passengers(id_type, id_number);
+
+-- +goose Down
+DROP TABLE IF EXISTS passengers;
@@ -0,0 +1,33 @@
+-- +goose Up
+
+-- Payment deadline for checked-out bookings; unpaid ones expire and release seats
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS payment_due_at TIMESTAMP;
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS paid_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_bookings_payment_due ON bookings(payment_due_at) WHERE status = 'pending';
+
+-- One row per charge created at a payment provider (VA number or QRIS code)
+CREATE TABLE IF NOT EXISTS payments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    booking_id UUID NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    provider VARCHAR(32) NOT NULL,
+    external_id VARCHAR(100) NOT NULL,
+    method VARCHAR(16) NOT NULL,
+    bank VARCHAR(16) NOT NULL DEFAULT '',
+    va_number VARCHAR(64) NOT NULL DEFAULT '',
+    qr_string TEXT NOT NULL DEFAULT '',
+    amount DECIMAL(12,2) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    expires_at TIMESTAMP NOT NULL,
+    paid_at TIMESTAMP,
+    last_callback TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, external_id)
+);
+CREATE INDEX IF NOT EXISTS idx_payments_booking ON payments(booking_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS payments;
+DROP INDEX IF EXISTS idx_bookings_payment_due;
+ALTER TABLE bookings DROP COLUMN IF EXISTS paid_at;
+ALTER TABLE bookings DROP COLUMN IF EXISTS payment_due_at;
@@ -0,0 +1,16 @@
+-- +goose Up
+
+-- One row per ticket scanned at a gate. The UNIQUE booking_item_id is what
+-- makes a ticket single-use, even when two gates scan it at the same time.
+CREATE TABLE IF NOT EXISTS boardings (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    booking_item_id UUID NOT NULL UNIQUE REFERENCES booking_items(id) ON DELETE CASCADE,
+    trip_id UUID NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    gate VARCHAR(64) NOT NULL DEFAULT '',
+    boarded_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_boardings_trip ON boardings(trip_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_boardings_trip;
+DROP TABLE IF EXISTS boardings;
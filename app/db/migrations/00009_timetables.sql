@@ -0,0 +1,69 @@
+-- +goose Up
+
+-- Per-train timetable templates. The schedule generator (internal/schedule)
+-- expands service_calendars into trips, coaches and seats from these rows.
+-- consist describes the coaches of every generated trip, e.g.
+--   [{"class":"executive","layout":"2-2","rows":13,"cols":4,"count":2,"accessible_rows":[1]}]
+CREATE TABLE IF NOT EXISTS timetable_templates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    train_id UUID NOT NULL REFERENCES trains(id) ON DELETE CASCADE,
+    route_id UUID NOT NULL REFERENCES routes(id) ON DELETE CASCADE,
+    depart_time TIME NOT NULL,
+    arrive_time TIME NOT NULL,
+    base_price DECIMAL(12,2) NOT NULL,
+    consist JSONB NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    UNIQUE (train_id, route_id, depart_time)
+);
+
+-- Generated trips point at their template; hand-made trips keep NULL.
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS template_id UUID REFERENCES timetable_templates(id) ON DELETE SET NULL;
+
+-- One departure per train, route and time on a day. This is what makes
+-- re-running the generator (or two generators racing) harmless.
+CREATE UNIQUE INDEX IF NOT EXISTS uq_trips_departure ON trips(train_id, route_id, service_date, depart_time);
+
+-- weekday_flags is a bitmask with Monday = 1 up to Sunday = 64 (127 = daily).
+-- exceptions holds holiday changes: {"removed":["2026-03-31"],"added":["2026-03-28"]}.
+INSERT INTO service_calendars (train_id, weekday_flags, start_date, end_date, exceptions)
+SELECT t.id, 127, current_date, current_date + 365, '{"removed":[],"added":[]}'::JSONB
+FROM trains t WHERE t.code IN ('AP', 'TAK')
+AND NOT EXISTS (SELECT 1 FROM service_calendars c WHERE c.train_id = t.id);
+
+-- Argo Wilis runs Friday to Sunday.
+INSERT INTO service_calendars (train_id, weekday_flags, start_date, end_date, exceptions)
+SELECT t.id, 16 + 32 + 64, current_date, current_date + 365, '{"removed":[],"added":[]}'::JSONB
+FROM trains t WHERE t.code = 'ARW'
+AND NOT EXISTS (SELECT 1 FROM service_calendars c WHERE c.train_id = t.id);
+
+INSERT INTO routes (route_code, origin_station_id, dest_station_id, distance_km)
+SELECT 'GMR-YK', s1.id, s2.id, 514.0 FROM stations s1, stations s2 WHERE s1.code = 'GMR' AND s2.code = 'YK'
+ON CONFLICT (route_code) DO NOTHING;
+INSERT INTO routes (route_code, origin_station_id, dest_station_id, distance_km)
+SELECT 'YK-GMR', s1.id, s2.id, 514.0 FROM stations s1, stations s2 WHERE s1.code = 'YK' AND s2.code = 'GMR'
+ON CONFLICT (route_code) DO NOTHING;
+INSERT INTO routes (route_code, origin_station_id, dest_station_id, distance_km)
+SELECT 'BD-SGU', s1.id, s2.id, 699.0 FROM stations s1, stations s2 WHERE s1.code = 'BD' AND s2.code = 'SGU'
+ON CONFLICT (route_code) DO NOTHING;
+
+-- Templates; the first two match the trips seeded in 00003, which the generator leaves as they are.
+INSERT INTO timetable_templates (train_id, route_id, depart_time, arrive_time, base_price, consist)
+SELECT t.id, r.id, v.dep::TIME, v.arr::TIME, v.price, v.consist::JSONB
+FROM (VALUES
+    ('AP',  'GMR-BD', '07:00', '10:00', 150000, '[{"class":"economy","layout":"2-2","rows":15,"cols":4,"count":6}]'),
+    ('AP',  'BD-GMR', '17:00', '20:00', 150000, '[{"class":"economy","layout":"2-2","rows":15,"cols":4,"count":6}]'),
+    ('AP',  'GMR-BD', '13:00', '16:05', 150000, '[{"class":"executive","layout":"2-2","rows":13,"cols":4,"count":2,"accessible_rows":[1]},{"class":"business","layout":"2-2","rows":16,"cols":4,"count":1},{"class":"economy","layout":"3-2","rows":16,"cols":5,"count":3}]'),
+    ('TAK', 'GMR-YK', '09:00', '15:25', 300000, '[{"class":"executive","layout":"2-2","rows":13,"cols":4,"count":4,"accessible_rows":[1]},{"class":"business","layout":"2-2","rows":16,"cols":4,"count":2}]'),
+    ('TAK', 'YK-GMR', '20:45', '03:10', 300000, '[{"class":"executive","layout":"2-2","rows":13,"cols":4,"count":4,"accessible_rows":[1]},{"class":"business","layout":"2-2","rows":16,"cols":4,"count":2}]'),
+    ('ARW', 'BD-SGU', '07:20', '17:15', 350000, '[{"class":"executive","layout":"2-2","rows":13,"cols":4,"count":3,"accessible_rows":[1]},{"class":"business","layout":"2-2","rows":16,"cols":4,"count":2}]')
+) AS v(train, route, dep, arr, price, consist)
+JOIN trains t ON t.code = v.train
+JOIN routes r ON r.route_code = v.route
+ON CONFLICT (train_id, route_id, depart_time) DO NOTHING;
+
+-- +goose Down
+DROP INDEX IF EXISTS uq_trips_departure;
+ALTER TABLE trips DROP COLUMN IF EXISTS template_id;
+DROP TABLE IF EXISTS timetable_templates;
+DELETE FROM routes WHERE route_code IN ('GMR-YK', 'YK-GMR', 'BD-SGU')
+AND NOT EXISTS (SELECT 1 FROM trips WHERE trips.route_id = routes.id);
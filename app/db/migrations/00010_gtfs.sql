@@ -0,0 +1,18 @@
+-- +goose Up
+
+-- GTFS identifiers so feeds can be imported repeatedly and exported again.
+-- service_id names a calendar from calendar.txt; the importer keeps one row
+-- per train that uses it. Calendars without one still apply to every
+-- template of their train.
+ALTER TABLE service_calendars ADD COLUMN IF NOT EXISTS service_id VARCHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_service_calendars_train_service ON service_calendars(train_id, service_id);
+
+-- A template with calendar_id follows only that calendar (a GTFS trip has one service_id).
+ALTER TABLE timetable_templates ADD COLUMN IF NOT EXISTS calendar_id UUID REFERENCES service_calendars(id) ON DELETE SET NULL;
+ALTER TABLE timetable_templates ADD COLUMN IF NOT EXISTS gtfs_trip_id VARCHAR(64);
+
+-- +goose Down
+ALTER TABLE timetable_templates DROP COLUMN IF EXISTS gtfs_trip_id;
+ALTER TABLE timetable_templates DROP COLUMN IF EXISTS calendar_id;
+DROP INDEX IF EXISTS uq_service_calendars_train_service;
+ALTER TABLE service_calendars DROP COLUMN IF EXISTS service_id;
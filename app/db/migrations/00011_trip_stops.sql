@@ -0,0 +1,117 @@
+-- +goose Up
+
+-- Ordered calls of a trip. seq 0 is where the train starts; arrive_time is
+-- NULL there and depart_time is NULL at the last stop. day_offset counts the
+-- midnights between the trip's service_date and the stop's departure (its
+-- arrival at the last stop); distance_km is measured from the first stop.
+CREATE TABLE IF NOT EXISTS trip_stops (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    trip_id UUID NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    seq INT NOT NULL,
+    station_id UUID NOT NULL REFERENCES stations(id) ON DELETE RESTRICT,
+    arrive_time TIME,
+    depart_time TIME,
+    day_offset INT NOT NULL DEFAULT 0,
+    distance_km DECIMAL(7,2) NOT NULL DEFAULT 0,
+    UNIQUE (trip_id, seq)
+);
+CREATE INDEX IF NOT EXISTS idx_trip_stops_station ON trip_stops(station_id, trip_id);
+
+-- The stop pattern of a timetable template, copied onto every trip generated from it.
+CREATE TABLE IF NOT EXISTS template_stops (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    template_id UUID NOT NULL REFERENCES timetable_templates(id) ON DELETE CASCADE,
+    seq INT NOT NULL,
+    station_id UUID NOT NULL REFERENCES stations(id) ON DELETE RESTRICT,
+    arrive_time TIME,
+    depart_time TIME,
+    day_offset INT NOT NULL DEFAULT 0,
+    distance_km DECIMAL(7,2) NOT NULL DEFAULT 0,
+    UNIQUE (template_id, seq)
+);
+
+-- Argo Bromo Anggrek calls at Semarang Tawang on its way to Surabaya, so
+-- GMR→SMT and SMT→SGU are sold from the same seats. Argo Wilis stops at Yogyakarta.
+INSERT INTO trains (code, name, operator, class_support) VALUES ('ABA', 'Argo Bromo Anggrek', 'KAI', 'executive')
+ON CONFLICT (code) DO NOTHING;
+INSERT INTO routes (route_code, origin_station_id, dest_station_id, distance_km)
+SELECT 'GMR-SGU', s1.id, s2.id, 725.0 FROM stations s1, stations s2 WHERE s1.code = 'GMR' AND s2.code = 'SGU'
+ON CONFLICT (route_code) DO NOTHING;
+INSERT INTO service_calendars (train_id, weekday_flags, start_date, end_date, exceptions)
+SELECT t.id, 127, current_date, current_date + 365, '{"removed":[],"added":[]}'::JSONB
+FROM trains t WHERE t.code = 'ABA'
+AND NOT EXISTS (SELECT 1 FROM service_calendars c WHERE c.train_id = t.id);
+INSERT INTO timetable_templates (train_id, route_id, depart_time, arrive_time, base_price, consist)
+SELECT t.id, r.id, '08:00'::TIME, '16:45'::TIME, 550000,
+       '[{"class":"executive","layout":"2-2","rows":13,"cols":4,"count":6,"accessible_rows":[1]}]'::JSONB
+FROM trains t, routes r WHERE t.code = 'ABA' AND r.route_code = 'GMR-SGU'
+ON CONFLICT (train_id, route_id, depart_time) DO NOTHING;
+INSERT INTO template_stops (template_id, seq, station_id, arrive_time, depart_time, day_offset, distance_km)
+SELECT tt.id, v.seq, s.id, v.arr::TIME, v.dep::TIME, 0, v.km
+FROM (VALUES
+    ('ABA', 'GMR-SGU', '08:00', 0, 'GMR', NULL, '08:00', 0.0),
+    ('ABA', 'GMR-SGU', '08:00', 1, 'SMT', '13:20', '13:25', 437.0),
+    ('ABA', 'GMR-SGU', '08:00', 2, 'SGU', '16:45', NULL, 725.0),
+    ('ARW', 'BD-SGU', '07:20', 0, 'BD', NULL, '07:20', 0.0),
+    ('ARW', 'BD-SGU', '07:20', 1, 'YK', '12:58', '13:06', 367.0),
+    ('ARW', 'BD-SGU', '07:20', 2, 'SGU', '17:15', NULL, 699.0)
+) AS v(train, route, dep_at, seq, station, arr, dep, km)
+JOIN trains t ON t.code = v.train
+JOIN routes r ON r.route_code = v.route
+JOIN timetable_templates tt ON tt.train_id = t.id AND tt.route_id = r.id AND tt.depart_time = v.dep_at::TIME
+JOIN stations s ON s.code = v.station
+ON CONFLICT (template_id, seq) DO NOTHING;
+
+-- Existing trips and templates call only at their route's two ends.
+INSERT INTO trip_stops (trip_id, seq, station_id, arrive_time, depart_time, day_offset, distance_km)
+SELECT t.id, 0, r.origin_station_id, NULL, t.depart_time, 0, 0
+FROM trips t JOIN routes r ON r.id = t.route_id
+ON CONFLICT (trip_id, seq) DO NOTHING;
+INSERT INTO trip_stops (trip_id, seq, station_id, arrive_time, depart_time, day_offset, distance_km)
+SELECT t.id, 1, r.dest_station_id, t.arrive_time, NULL, CASE WHEN t.arrive_time < t.depart_time THEN 1 ELSE 0 END, COALESCE(r.distance_km, 0)
+FROM trips t JOIN routes r ON r.id = t.route_id
+ON CONFLICT (trip_id, seq) DO NOTHING;
+INSERT INTO template_stops (template_id, seq, station_id, arrive_time, depart_time, day_offset, distance_km)
+SELECT tt.id, 0, r.origin_station_id, NULL, tt.depart_time, 0, 0
+FROM timetable_templates tt JOIN routes r ON r.id = tt.route_id
+ON CONFLICT (template_id, seq) DO NOTHING;
+INSERT INTO template_stops (template_id, seq, station_id, arrive_time, depart_time, day_offset, distance_km)
+SELECT tt.id, 1, r.dest_station_id, tt.arrive_time, NULL, CASE WHEN tt.arrive_time < tt.depart_time THEN 1 ELSE 0 END, COALESCE(r.distance_km, 0)
+FROM timetable_templates tt JOIN routes r ON r.id = tt.route_id
+ON CONFLICT (template_id, seq) DO NOTHING;
+
+-- Seats are sold per segment: an item takes its seat from stop from_seq up to
+-- (not including) to_seq, so GMR→SMT and SMT→SGU can share one seat. The
+-- defaults describe the two-stop trips that existed before this migration.
+-- A booking rides one leg of its trip; its items carry the same range.
+ALTER TABLE booking_items ADD COLUMN IF NOT EXISTS from_seq INT NOT NULL DEFAULT 0;
+ALTER TABLE booking_items ADD COLUMN IF NOT EXISTS to_seq INT NOT NULL DEFAULT 1;
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS from_seq INT NOT NULL DEFAULT 0;
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS to_seq INT NOT NULL DEFAULT 1;
+
+-- One live item per seat no longer holds. Overlap is checked while the seat
+-- rows are locked FOR UPDATE, which serializes every hold on those seats.
+DROP INDEX IF EXISTS uq_booking_items_live_seat;
+CREATE INDEX IF NOT EXISTS idx_booking_items_live_seat ON booking_items(seat_id, from_seq, to_seq) WHERE status IN ('held', 'confirmed');
+
+-- +goose Down
+-- Remove the Argo Bromo Anggrek seeded above, unless trips were generated for it since.
+DELETE FROM timetable_templates tt USING trains t
+WHERE t.id = tt.train_id AND t.code = 'ABA'
+AND NOT EXISTS (SELECT 1 FROM trips WHERE trips.train_id = t.id);
+DELETE FROM service_calendars c USING trains t
+WHERE t.id = c.train_id AND t.code = 'ABA'
+AND NOT EXISTS (SELECT 1 FROM trips WHERE trips.train_id = t.id);
+DELETE FROM trains WHERE code = 'ABA'
+AND NOT EXISTS (SELECT 1 FROM trips WHERE trips.train_id = trains.id);
+DELETE FROM routes WHERE route_code = 'GMR-SGU'
+AND NOT EXISTS (SELECT 1 FROM trips WHERE trips.route_id = routes.id)
+AND NOT EXISTS (SELECT 1 FROM timetable_templates tt WHERE tt.route_id = routes.id);
+DROP INDEX IF EXISTS idx_booking_items_live_seat;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_booking_items_live_seat ON booking_items(seat_id) WHERE status IN ('held', 'confirmed');
+ALTER TABLE bookings DROP COLUMN IF EXISTS to_seq;
+ALTER TABLE bookings DROP COLUMN IF EXISTS from_seq;
+ALTER TABLE booking_items DROP COLUMN IF EXISTS to_seq;
+ALTER TABLE booking_items DROP COLUMN IF EXISTS from_seq;
+DROP TABLE IF EXISTS template_stops;
+DROP TABLE IF EXISTS trip_stops;
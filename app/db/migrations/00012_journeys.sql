@@ -0,0 +1,30 @@
+-- +goose Up
+
+-- A connecting journey is one booking whose seats are on several trips, for
+-- example Gambir→Bandung on one train and Bandung→Yogyakarta on the next.
+-- bookings.trip_id, from_seq and to_seq then describe the first leg and
+-- booking_legs lists every leg in travel order.
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS journey BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS booking_legs (
+    booking_id UUID NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    leg_no INT NOT NULL,
+    trip_id UUID NOT NULL REFERENCES trips(id) ON DELETE RESTRICT,
+    from_seq INT NOT NULL,
+    to_seq INT NOT NULL,
+    PRIMARY KEY (booking_id, leg_no)
+);
+CREATE INDEX IF NOT EXISTS idx_booking_legs_trip ON booking_legs(trip_id);
+
+-- A holder keeps one cart per trip plus one cart for a journey.
+DROP INDEX IF EXISTS uq_bookings_hold_cart;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_bookings_hold_cart ON bookings(user_ref, trip_id) WHERE status = 'hold' AND NOT journey;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_bookings_journey_cart ON bookings(user_ref) WHERE status = 'hold' AND journey;
+
+-- +goose Down
+DROP INDEX IF EXISTS uq_bookings_journey_cart;
+DROP INDEX IF EXISTS uq_bookings_hold_cart;
+DELETE FROM bookings WHERE journey AND status = 'hold';
+CREATE UNIQUE INDEX IF NOT EXISTS uq_bookings_hold_cart ON bookings(user_ref, trip_id) WHERE status = 'hold';
+DROP TABLE IF EXISTS booking_legs;
+ALTER TABLE bookings DROP COLUMN IF EXISTS journey;
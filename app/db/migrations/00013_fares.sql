@@ -0,0 +1,71 @@
+-- +goose Up
+
+-- Fare rules (internal/booking/fare.go). A seat's fare starts from the leg's
+-- share of trips.base_price, or from the distance tariff when the trip has no
+-- base price, then the class multiplier, the highest peak surcharge covering
+-- the travel date and the passenger discount apply in that order.
+
+-- Percent of the base fare per seat class.
+CREATE TABLE IF NOT EXISTS fare_classes (
+    class VARCHAR(20) PRIMARY KEY,
+    percent INT NOT NULL CHECK (percent > 0)
+);
+INSERT INTO fare_classes (class, percent) VALUES
+    ('economy', 100),
+    ('business', 140),
+    ('executive', 180)
+ON CONFLICT (class) DO NOTHING;
+
+-- Rupiah per kilometre from from_km up to the next band.
+CREATE TABLE IF NOT EXISTS fare_distance_bands (
+    from_km INT PRIMARY KEY CHECK (from_km >= 0),
+    per_km INT NOT NULL CHECK (per_km >= 0)
+);
+INSERT INTO fare_distance_bands (from_km, per_km) VALUES
+    (0, 450),
+    (100, 350),
+    (300, 250)
+ON CONFLICT (from_km) DO NOTHING;
+
+-- Surcharges for travel dates, inclusive. Lebaran covers the Angkutan Lebaran
+-- period around Idul Fitri.
+CREATE TABLE IF NOT EXISTS fare_peaks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL UNIQUE,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    percent INT NOT NULL CHECK (percent > -100),
+    CHECK (end_date >= start_date)
+);
+INSERT INTO fare_peaks (name, start_date, end_date, percent) VALUES
+    ('Lebaran 2026', '2026-03-10', '2026-03-31', 25),
+    ('Christmas and New Year 2026', '2026-12-18', '2027-01-04', 15),
+    ('Lebaran 2027', '2027-02-28', '2027-03-21', 25)
+ON CONFLICT (name) DO NOTHING;
+
+-- Percent off per passenger category.
+CREATE TABLE IF NOT EXISTS fare_discounts (
+    category VARCHAR(16) PRIMARY KEY,
+    percent INT NOT NULL CHECK (percent BETWEEN 0 AND 100)
+);
+INSERT INTO fare_discounts (category, percent) VALUES
+    ('infant', 75),
+    ('senior', 20),
+    ('student', 10)
+ON CONFLICT (category) DO NOTHING;
+
+-- {"total":270000,"lines":[{"kind":"base","label":"Base fare","amount":150000},…]}
+ALTER TABLE booking_items ADD COLUMN IF NOT EXISTS fare_breakdown JSONB;
+
+ALTER TABLE passengers DROP CONSTRAINT IF EXISTS passengers_category_check;
+ALTER TABLE passengers ADD CONSTRAINT passengers_category_check CHECK (category IN ('adult','infant','senior','student'));
+
+-- +goose Down
+ALTER TABLE passengers DROP CONSTRAINT IF EXISTS passengers_category_check;
+UPDATE passengers SET category = 'adult' WHERE category IN ('senior','student');
+ALTER TABLE passengers ADD CONSTRAINT passengers_category_check CHECK (category IN ('adult','infant'));
+ALTER TABLE booking_items DROP COLUMN IF EXISTS fare_breakdown;
+DROP TABLE IF EXISTS fare_discounts;
+DROP TABLE IF EXISTS fare_peaks;
+DROP TABLE IF EXISTS fare_distance_bands;
+DROP TABLE IF EXISTS fare_classes;
@@ -0,0 +1,46 @@
+-- +goose Up
+
+-- Campaign codes entered at checkout (internal/booking/promo.go). kind is
+-- 'percent' (value = percent off, capped by max_discount) or 'fixed' (value =
+-- rupiah off). Empty routes/trains/classes mean any; NULL limits mean none.
+CREATE TABLE IF NOT EXISTS promo_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code VARCHAR(32) NOT NULL UNIQUE,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('percent','fixed')),
+    value DECIMAL(12,2) NOT NULL CHECK (value > 0),
+    max_discount DECIMAL(12,2),
+    min_total DECIMAL(12,2) NOT NULL DEFAULT 0,
+    starts_at TIMESTAMPTZ,
+    ends_at TIMESTAMPTZ,
+    max_uses INT,
+    max_uses_per_user INT,
+    routes TEXT[] NOT NULL DEFAULT '{}',
+    trains TEXT[] NOT NULL DEFAULT '{}',
+    classes TEXT[] NOT NULL DEFAULT '{}',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- One row per booking that used a code. Rows of bookings that expire unpaid
+-- are deleted, so the caps only count live bookings.
+CREATE TABLE IF NOT EXISTS promo_redemptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    promo_id UUID NOT NULL REFERENCES promo_codes(id) ON DELETE RESTRICT,
+    booking_id UUID NOT NULL UNIQUE REFERENCES bookings(id) ON DELETE CASCADE,
+    user_ref VARCHAR(100) NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    discount DECIMAL(12,2) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_promo_redemptions_promo ON promo_redemptions(promo_id, user_ref);
+
+-- total_price is what the customer pays, after discount_total.
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS promo_code VARCHAR(32);
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS discount_total DECIMAL(12,2) NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE bookings DROP COLUMN IF EXISTS discount_total;
+ALTER TABLE bookings DROP COLUMN IF EXISTS promo_code;
+DROP TABLE IF EXISTS promo_redemptions;
+DROP TABLE IF EXISTS promo_codes;
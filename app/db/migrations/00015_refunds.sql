@@ -0,0 +1,58 @@
+-- +goose Up
+
+-- Refund schedule for customer cancellations (internal/booking/cancel.go). A
+-- seat cancelled at least min_hours before its train departs refunds percent
+-- of what was paid for it; the tier with the largest min_hours that still
+-- applies wins. Nothing is refunded once the train has departed.
+CREATE TABLE IF NOT EXISTS refund_tiers (
+    min_hours INT PRIMARY KEY CHECK (min_hours >= 0),
+    percent INT NOT NULL CHECK (percent BETWEEN 0 AND 100)
+);
+INSERT INTO refund_tiers (min_hours, percent) VALUES
+    (168, 75),
+    (24, 50),
+    (0, 25)
+ON CONFLICT (min_hours) DO NOTHING;
+
+-- Money owed back to a customer. Cancellations insert pending rows; the refund
+-- worker (internal/payment/refund.go) hands them to the gateway that took the
+-- payment and retries failures with backoff until max attempts.
+CREATE TABLE IF NOT EXISTS refunds (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    booking_id UUID NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    payment_id UUID REFERENCES payments(id) ON DELETE SET NULL,
+    amount DECIMAL(12,2) NOT NULL CHECK (amount > 0),
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    provider VARCHAR(32) NOT NULL DEFAULT '',
+    external_id VARCHAR(100) NOT NULL DEFAULT '',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    processed_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_refunds_booking ON refunds(booking_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_due ON refunds(next_attempt_at) WHERE status = 'pending';
+
+-- The seats a refund pays back, with the tier that applied to each.
+CREATE TABLE IF NOT EXISTS refund_items (
+    refund_id UUID NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    booking_item_id UUID NOT NULL REFERENCES booking_items(id) ON DELETE CASCADE,
+    percent INT NOT NULL,
+    amount DECIMAL(12,2) NOT NULL,
+    PRIMARY KEY (refund_id, booking_item_id)
+);
+CREATE INDEX IF NOT EXISTS idx_refund_items_item ON refund_items(booking_item_id);
+
+-- Cancelled seats keep their row (status 'cancelled') so the booking still
+-- shows them; a booking with no seats left is 'cancelled' too.
+ALTER TABLE booking_items ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP;
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE bookings DROP COLUMN IF EXISTS cancelled_at;
+ALTER TABLE booking_items DROP COLUMN IF EXISTS cancelled_at;
+DROP TABLE IF EXISTS refund_items;
+DROP TABLE IF EXISTS refunds;
+DROP TABLE IF EXISTS refund_tiers;
@@ -0,0 +1,54 @@
+-- +goose Up
+
+-- Every change to a booking, written in the transaction that made it
+-- (internal/booking/history.go).
+CREATE TABLE IF NOT EXISTS booking_history (
+    id BIGSERIAL PRIMARY KEY,
+    booking_id UUID NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    event VARCHAR(32) NOT NULL,
+    detail JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_booking_history_booking ON booking_history(booking_id, created_at);
+
+-- Moves of a booking to another trip (internal/booking/reschedule.go).
+-- from_seq/to_seq are the leg on the new trip. balance = fare_difference +
+-- change_fee: a positive balance is paid before the change applies (the new
+-- seats are held until due_at), a negative one is refunded.
+CREATE TABLE IF NOT EXISTS booking_changes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    booking_id UUID NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    from_trip_id UUID NOT NULL REFERENCES trips(id) ON DELETE RESTRICT,
+    to_trip_id UUID NOT NULL REFERENCES trips(id) ON DELETE RESTRICT,
+    from_seq INT NOT NULL,
+    to_seq INT NOT NULL,
+    fare_difference DECIMAL(12,2) NOT NULL,
+    change_fee DECIMAL(12,2) NOT NULL DEFAULT 0,
+    balance DECIMAL(12,2) NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    due_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    applied_at TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_booking_changes_pending ON booking_changes(booking_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_booking_changes_due ON booking_changes(due_at) WHERE status = 'pending';
+
+-- Which new seat replaces which old one, and what each cost.
+CREATE TABLE IF NOT EXISTS booking_change_items (
+    change_id UUID NOT NULL REFERENCES booking_changes(id) ON DELETE CASCADE,
+    old_item_id UUID NOT NULL REFERENCES booking_items(id) ON DELETE CASCADE,
+    new_item_id UUID NOT NULL REFERENCES booking_items(id) ON DELETE CASCADE,
+    old_paid DECIMAL(12,2) NOT NULL,
+    new_fare DECIMAL(12,2) NOT NULL,
+    PRIMARY KEY (change_id, old_item_id)
+);
+
+-- A charge for the balance of a trip change rather than for the booking itself.
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS change_id UUID REFERENCES booking_changes(id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE payments DROP COLUMN IF EXISTS change_id;
+DROP TABLE IF EXISTS booking_change_items;
+DROP TABLE IF EXISTS booking_changes;
+DROP TABLE IF EXISTS booking_history;
@@ -0,0 +1,27 @@
+-- +goose Up
+
+-- Customers waiting for seats in a class of a sold-out trip
+-- (internal/booking/waitlist.go). Entries are served oldest first: when
+-- enough seats on their leg come free, the seats are held in the customer's
+-- cart until offer_until and the entry becomes 'offered'. While an entry is
+-- waiting, nobody else can hold seats of that class on an overlapping leg.
+CREATE TABLE IF NOT EXISTS waitlist (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    trip_id UUID NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    from_seq INT NOT NULL,
+    to_seq INT NOT NULL,
+    class VARCHAR(20) NOT NULL,
+    seats INT NOT NULL CHECK (seats > 0),
+    user_ref VARCHAR(200) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting',
+    booking_id UUID REFERENCES bookings(id) ON DELETE SET NULL,
+    offer_until TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_waitlist_active ON waitlist(user_ref, trip_id, class) WHERE status IN ('waiting', 'offered');
+CREATE INDEX IF NOT EXISTS idx_waitlist_queue ON waitlist(trip_id, class, created_at) WHERE status = 'waiting';
+
+-- +goose Down
+DROP TABLE IF EXISTS waitlist;
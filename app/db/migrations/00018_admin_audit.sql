@@ -0,0 +1,19 @@
+-- +goose Up
+
+-- Every change made from the operations console (internal/admin/audit.go),
+-- written in the transaction that made it. actor is the signed-in operator,
+-- entity/entity_id the row that changed, detail the new values or the reason.
+CREATE TABLE IF NOT EXISTS admin_audit (
+    id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR(200) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    entity VARCHAR(32) NOT NULL,
+    entity_id VARCHAR(64) NOT NULL,
+    detail JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_entity ON admin_audit(entity, entity_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_admin_audit_created ON admin_audit(created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS admin_audit;
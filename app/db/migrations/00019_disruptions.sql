@@ -0,0 +1,42 @@
+-- +goose Up
+
+-- Runs of the disruption workflow (internal/booking/disruption.go): one row
+-- each time operations delays or cancels a trip and the affected bookings
+-- are handled. finished_at stays NULL while the run is still going.
+CREATE TABLE IF NOT EXISTS disruptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    trip_id UUID NOT NULL REFERENCES trips(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('delay', 'cancel')),
+    delay_minutes INT NOT NULL DEFAULT 0,
+    reason VARCHAR(500) NOT NULL DEFAULT '',
+    actor VARCHAR(200) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_disruptions_trip ON disruptions(trip_id, created_at);
+
+-- What happened to each booking in a run: moved to new_trip_id, refunded,
+-- cancelled unpaid, only notified, or failed (error). passengers snapshots
+-- who sat where on the disrupted train. While offer_until is in the future
+-- the customer may still take a free change or a full refund instead.
+CREATE TABLE IF NOT EXISTS disruption_bookings (
+    id BIGSERIAL PRIMARY KEY,
+    disruption_id UUID NOT NULL REFERENCES disruptions(id) ON DELETE CASCADE,
+    booking_id UUID NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    outcome VARCHAR(16) NOT NULL,
+    passengers JSONB NOT NULL DEFAULT '[]',
+    new_trip_id UUID REFERENCES trips(id) ON DELETE SET NULL,
+    new_departure TIMESTAMP,
+    refund DECIMAL(12,2) NOT NULL DEFAULT 0,
+    offer_until TIMESTAMP,
+    notified BOOLEAN NOT NULL DEFAULT FALSE,
+    error VARCHAR(500) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_disruption_bookings_run ON disruption_bookings(disruption_id, id);
+CREATE INDEX IF NOT EXISTS idx_disruption_bookings_offer ON disruption_bookings(booking_id) WHERE offer_until IS NOT NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS disruption_bookings;
+DROP TABLE IF EXISTS disruptions;
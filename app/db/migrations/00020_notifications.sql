@@ -0,0 +1,23 @@
+-- +goose Up
+
+-- Emails sent to customers (internal/notify): one row per message, keyed by
+-- its kind and what it is about (ref, e.g. the booking id), so a message is
+-- sent once even when its trigger fires again, such as a replayed payment
+-- callback. A failed message may be claimed and sent again.
+CREATE TABLE IF NOT EXISTS notifications (
+    id BIGSERIAL PRIMARY KEY,
+    booking_id UUID REFERENCES bookings(id) ON DELETE CASCADE,
+    kind VARCHAR(32) NOT NULL,
+    ref VARCHAR(100) NOT NULL DEFAULT '',
+    recipient VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL DEFAULT 'sending' CHECK (status IN ('sending', 'sent', 'failed')),
+    error VARCHAR(500) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_once ON notifications(kind, ref);
+CREATE INDEX IF NOT EXISTS idx_notifications_booking ON notifications(booking_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS notifications;
@@ -0,0 +1,26 @@
+-- +goose Up
+
+-- Transactional outbox (internal/outbox): side effects of a state change,
+-- such as emails and partner webhooks, are written here in the transaction
+-- that made the change and delivered afterwards by the dispatcher, so a
+-- crash between the commit and the delivery loses nothing. A pending message
+-- is due at available_at; a dispatcher claims it by pushing available_at out
+-- by its lease, and a failed delivery pushes it out by the backoff. After
+-- too many attempts it is dead until replayed (gforge outbox replay).
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    topic VARCHAR(100) NOT NULL,
+    ref VARCHAR(100) NOT NULL DEFAULT '',
+    payload JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+    attempts INT NOT NULL DEFAULT 0,
+    last_error VARCHAR(1000) NOT NULL DEFAULT '',
+    available_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_due ON outbox(status, available_at, id);
+CREATE INDEX IF NOT EXISTS idx_outbox_ref ON outbox(ref, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS outbox;
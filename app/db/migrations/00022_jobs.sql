@@ -0,0 +1,42 @@
+-- +goose Up
+
+-- Background jobs (internal/jobs): deferred and scheduled work run by the
+-- servers' workers. A queued job is due at run_at; a worker claims it with
+-- FOR UPDATE SKIP LOCKED, marking it running until locked_until, and a job
+-- whose worker died is claimed again once that lease lapses. Failures are
+-- queued again with backoff until max_attempts, then failed until retried
+-- (gforge jobs retry). unique_key keeps a schedule from piling up runs: only
+-- one queued or running job may hold a key.
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(100) NOT NULL,
+    args JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(16) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'done', 'failed')),
+    unique_key VARCHAR(200) NOT NULL DEFAULT '',
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    run_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    locked_by VARCHAR(100) NOT NULL DEFAULT '',
+    locked_until TIMESTAMP,
+    last_error VARCHAR(1000) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs(kind, status, run_at, id);
+CREATE INDEX IF NOT EXISTS idx_jobs_finished ON jobs(status, finished_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_unique ON jobs(unique_key)
+    WHERE unique_key <> '' AND status IN ('queued', 'running');
+
+-- Leases elect one holder per name among the servers, e.g. the scheduler
+-- that enqueues cron jobs. The holder renews before expires_at; anyone may
+-- take an expired lease.
+CREATE TABLE IF NOT EXISTS job_leases (
+    name VARCHAR(100) PRIMARY KEY,
+    holder VARCHAR(100) NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS job_leases;
+DROP TABLE IF EXISTS jobs;
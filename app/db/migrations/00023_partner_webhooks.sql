@@ -0,0 +1,54 @@
+-- +goose Up
+
+-- Travel-agent partners (internal/partner) call the booking API with an API
+-- key; only its SHA-256 is stored. Bookings a partner makes carry
+-- user_ref 'partner:<id>'.
+CREATE TABLE IF NOT EXISTS partners (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(200) NOT NULL,
+    api_key_hash CHAR(64) UNIQUE NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Webhook subscriptions: events of the partner's bookings listed in events
+-- are POSTed to url, signed with the subscription's secret.
+CREATE TABLE IF NOT EXISTS partner_webhooks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    partner_id UUID NOT NULL REFERENCES partners(id) ON DELETE CASCADE,
+    url VARCHAR(1000) NOT NULL,
+    secret VARCHAR(100) NOT NULL,
+    events TEXT[] NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_partner_webhooks_partner ON partner_webhooks(partner_id) WHERE active;
+
+-- One row per event and subscription, and one more per manual resend
+-- (resent_from). Only the receiver's status code is kept, never its body. A pending delivery is due at next_attempt_at; the sender
+-- claims it by pushing next_attempt_at out by its lease, and a failed
+-- attempt pushes it out by the backoff until it has failed for good.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id UUID NOT NULL REFERENCES partner_webhooks(id) ON DELETE CASCADE,
+    event_id VARCHAR(40) NOT NULL,
+    event VARCHAR(40) NOT NULL,
+    booking_id UUID,
+    payload JSONB NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    response_status INT NOT NULL DEFAULT 0,
+    last_error VARCHAR(1000) NOT NULL DEFAULT '',
+    resent_from BIGINT REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries(webhook_id, event_id) WHERE resent_from IS NULL;
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at, id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+
+-- +goose Down
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS partner_webhooks;
+DROP TABLE IF EXISTS partners;
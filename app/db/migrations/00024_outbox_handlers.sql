@@ -0,0 +1,10 @@
+-- +goose Up
+
+-- Names of the handlers that already succeeded for a message (outbox.Handle),
+-- so a retry runs only the ones that failed: a webhook that could not be
+-- recorded does not send the customer's email again, and an email that could
+-- not be sent does not hold up the webhook.
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS done TEXT[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE outbox DROP COLUMN IF EXISTS done;
@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"gothicforge3/internal/booking"
+)
+
+func init() {
+	RegisterRoute(func(r chi.Router) {
+		r.Get("/api/account/bookings", handleAccountBookingsAPI)
+		r.With(limitGuestLookups(func(w http.ResponseWriter, r *http.Request) {
+			writeAPIError(w, http.StatusTooManyRequests, "rate_limited", "too many booking lookups, try again in a minute")
+		})).Post("/api/bookings/lookup", handleGuestLookupAPI)
+	})
+}
+
+// handleAccountBookingsAPI lists the signed-in user's bookings split into
+// upcoming and past. It needs the gf_jwt cookie; guests get 401.
+func handleAccountBookingsAPI(w http.ResponseWriter, r *http.Request) {
+	ref := accountRef(r)
+	if ref == "" {
+		writeAPIError(w, http.StatusUnauthorized, "unauthorized", "sign in to see your bookings")
+		return
+	}
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	all, err := booking.ListBookings(r.Context(), pool, ref)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	upcoming, past := booking.SplitBookings(all, time.Now())
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "upcoming": orEmpty(upcoming), "past": orEmpty(past)})
+}
+
+// handleGuestLookupAPI finds a booking made without signing in:
+// {"code":"K7QM2XA","email":"…"}. On success this session may manage the
+// booking through the other booking endpoints. Lookups are rate limited per
+// client IP (GUEST_LOOKUP_LIMIT a minute).
+func handleGuestLookupAPI(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Code  string `json:"code"`
+		Email string `json:"email"`
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&in); err != nil {
+			writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+			return
+		}
+	} else {
+		_ = r.ParseForm()
+		in.Code, in.Email = r.Form.Get("code"), r.Form.Get("email")
+	}
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	b, err := booking.FindGuestBooking(r.Context(), pool, in.Code, in.Email)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	if err := grantGuestBooking(r, b.Code); err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "booking": b})
+}
+
+func orEmpty(bs []booking.Booking) []booking.Booking {
+	if bs == nil {
+		return []booking.Booking{}
+	}
+	return bs
+}
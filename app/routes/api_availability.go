@@ -1,9 +1,10 @@
 package routes
 
 import (
-    "encoding/json"
     "net/http"
+
     "github.com/go-chi/chi/v5"
+    "gothicforge3/internal/booking"
 )
 
 func init() {
@@ -13,15 +14,28 @@ func init() {
     })
 }
 
+// handleAvailabilityAPI searches trips: GET /api/availability?from=GMR&to=BD&date=2025-01-31&pax=2&class=economy
 func handleAvailabilityAPI(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type", "application/json; charset=utf-8")
-    
-    // TODO: Implement your API logic here
-    response := map[string]interface{}{
-        "success": true,
-        "message": "Availability API endpoint",
-        "method":  "GET",
+    q, err := booking.ParseSearchQuery(r.URL.Query())
+    if err != nil {
+        writeBookingError(w, err)
+        return
+    }
+    pool, ok := requireDBAPI(r, w)
+    if !ok {
+        return
     }
-    
-    _ = json.NewEncoder(w).Encode(response)
+    trips, err := booking.Search(r.Context(), pool, q)
+    if err != nil {
+        writeBookingError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]any{
+        "success":    true,
+        "from":       q.Origin,
+        "to":         q.Destination,
+        "date":       q.Date.Format("2006-01-02"),
+        "passengers": q.Passengers,
+        "trips":      trips,
+    })
 }
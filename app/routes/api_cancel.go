@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"gothicforge3/internal/booking"
+)
+
+func init() {
+	RegisterRoute(func(r chi.Router) {
+		r.Post("/api/bookings/cancel", handleCancelBookingAPI)
+		RegisterURL("/api/bookings/cancel")
+	})
+}
+
+// handleCancelBookingAPI cancels seats of one of the caller's bookings:
+// {"code":"K7QM2XA","item_ids":["…"],"reason":"…"}; without item_ids every
+// seat is cancelled. The reply lists what each seat refunds under the policy.
+func handleCancelBookingAPI(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Code string `json:"code"`
+		booking.CancelRequest
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&in); err != nil {
+			writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+			return
+		}
+	} else {
+		_ = r.ParseForm()
+		in.Code, in.ItemIDs, in.Reason = r.Form.Get("code"), r.Form["item_id"], r.Form.Get("reason")
+	}
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	b, err := ownBooking(r, pool, in.Code)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	in.BookingID = b.ID
+	c, err := booking.CancelBooking(r.Context(), pool, in.CancelRequest)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "cancellation": c})
+}
@@ -3,7 +3,10 @@ package routes
 import (
     "encoding/json"
     "net/http"
+    "strings"
+
     "github.com/go-chi/chi/v5"
+    "gothicforge3/internal/booking"
 )
 
 func init() {
@@ -13,15 +16,34 @@ func init() {
     })
 }
 
+// handleCheckoutAPI converts the caller's holds on a trip into a booking:
+// {"trip_id":"…","seat_ids":["…"],"contact":{"name":"…","email":"…","phone":"…"}}.
+// Expired holds or seats lost to another buyer return 409 hold_expired.
 func handleCheckoutAPI(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type", "application/json; charset=utf-8")
-    
-    // TODO: Implement your API logic here
-    response := map[string]interface{}{
-        "success": true,
-        "message": "Checkout API endpoint",
-        "method":  "POST",
+    var req booking.CheckoutRequest
+    if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+        if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+            writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+            return
+        }
+    } else {
+        if err := r.ParseForm(); err != nil {
+            writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+            return
+        }
+        req.TripID = strings.TrimSpace(r.Form.Get("trip_id"))
+        req.SeatIDs = r.Form["seat_id"]
+        req.Contact = booking.Contact{Name: r.Form.Get("contact_name"), Email: r.Form.Get("contact_email"), Phone: r.Form.Get("contact_phone")}
+    }
+    req.Holder = holderRef(r)
+    pool, ok := requireDBAPI(r, w)
+    if !ok {
+        return
+    }
+    b, err := booking.Checkout(r.Context(), pool, req)
+    if err != nil {
+        writeBookingError(w, err)
+        return
     }
-    
-    _ = json.NewEncoder(w).Encode(response)
+    writeJSON(w, http.StatusCreated, map[string]any{"success": true, "booking": b})
 }
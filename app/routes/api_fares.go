@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"gothicforge3/internal/booking"
+)
+
+func init() {
+	RegisterRoute(func(r chi.Router) {
+		r.Get("/api/fares", handleFareQuoteAPI)
+		RegisterURL("/api/fares")
+	})
+}
+
+// handleFareQuoteAPI explains the fare of one seat:
+// GET /api/fares?trip_id=…&from=GMR&to=BD&class=executive&category=senior
+func handleFareQuoteAPI(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	fare, err := booking.QuoteFare(r.Context(), pool, q.Get("trip_id"), q.Get("from"), q.Get("to"), q.Get("class"), q.Get("category"))
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "fare": fare})
+}
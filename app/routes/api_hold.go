@@ -3,25 +3,99 @@ package routes
 import (
     "encoding/json"
     "net/http"
+    "strings"
+
     "github.com/go-chi/chi/v5"
+    "gothicforge3/internal/booking"
 )
 
 func init() {
     RegisterRoute(func(r chi.Router) {
         r.Post("/api/hold", handleHoldAPI)
+        r.Get("/api/hold", handleListHoldsAPI)
+        r.Delete("/api/hold", handleReleaseHoldAPI)
         RegisterURL("/api/hold")
     })
 }
 
+// handleHoldAPI holds seats for the caller: {"trip_id":"…","from":"SMT","to":"SGU","seat_ids":["…"]}
+// (JSON or form fields; without from/to the whole trip). A seat someone else
+// already holds or bought on an overlapping leg returns 409 seat_unavailable.
 func handleHoldAPI(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type", "application/json; charset=utf-8")
-    
-    // TODO: Implement your API logic here
-    response := map[string]interface{}{
-        "success": true,
-        "message": "Hold API endpoint",
-        "method":  "POST",
-    }
-    
-    _ = json.NewEncoder(w).Encode(response)
+    req, err := decodeHoldRequest(w, r)
+    if err != nil {
+        writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+        return
+    }
+    req.Holder = holderRef(r)
+    pool, ok := requireDBAPI(r, w)
+    if !ok {
+        return
+    }
+    res, err := booking.PlaceHold(r.Context(), pool, req, booking.HoldTTL())
+    if err != nil {
+        writeBookingError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]any{
+        "success":    true,
+        "booking_id": res.BookingID,
+        "held_until": res.HeldUntil,
+        "seats":      res.Seats,
+    })
+}
+
+// handleListHoldsAPI returns the caller's live holds (?trip_id= to filter).
+func handleListHoldsAPI(w http.ResponseWriter, r *http.Request) {
+    pool, ok := requireDBAPI(r, w)
+    if !ok {
+        return
+    }
+    tripID := strings.TrimSpace(r.URL.Query().Get("trip_id"))
+    if tripID != "" && !booking.ValidUUID(tripID) {
+        writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, "trip_id must be a UUID")
+        return
+    }
+    seats, err := booking.ListHolds(r.Context(), pool, holderRef(r), tripID)
+    if err != nil {
+        writeBookingError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]any{"success": true, "seats": seats})
+}
+
+// handleReleaseHoldAPI releases the caller's holds on a trip (all, or only seat_ids).
+func handleReleaseHoldAPI(w http.ResponseWriter, r *http.Request) {
+    req, err := decodeHoldRequest(w, r)
+    if err != nil {
+        writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+        return
+    }
+    pool, ok := requireDBAPI(r, w)
+    if !ok {
+        return
+    }
+    n, err := booking.ReleaseHold(r.Context(), pool, holderRef(r), req.TripID, req.SeatIDs)
+    if err != nil {
+        writeBookingError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, map[string]any{"success": true, "released": n})
+}
+
+// decodeHoldRequest accepts a JSON body or form/query fields trip_id, from, to and seat_id (repeatable).
+// DELETE requests carry form fields in the query string.
+func decodeHoldRequest(w http.ResponseWriter, r *http.Request) (booking.HoldRequest, error) {
+    var req booking.HoldRequest
+    if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+        err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req)
+        return req, err
+    }
+    if err := r.ParseForm(); err != nil {
+        return req, err
+    }
+    req.TripID = strings.TrimSpace(r.Form.Get("trip_id"))
+    req.From, req.To = r.Form.Get("from"), r.Form.Get("to")
+    req.SeatIDs = append(r.Form["seat_id"], r.Form["seat_ids"]...)
+    return req, nil
 }
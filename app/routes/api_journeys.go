@@ -0,0 +1,110 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"gothicforge3/internal/booking"
+)
+
+func init() {
+	RegisterRoute(func(r chi.Router) {
+		r.Get("/api/journeys", handleJourneysAPI)
+		r.Post("/api/journeys/hold", handleJourneyHoldAPI)
+		r.Get("/api/journeys/hold", handleListJourneyHoldAPI)
+		r.Post("/api/journeys/checkout", handleJourneyCheckoutAPI)
+		RegisterURL("/api/journeys")
+	})
+}
+
+// handleJourneysAPI plans itineraries, changing trains when needed:
+// GET /api/journeys?from=BD&to=YK&date=2025-01-31&pax=2&class=&max_legs=3
+func handleJourneysAPI(w http.ResponseWriter, r *http.Request) {
+	q, err := booking.ParseJourneyQuery(r.URL.Query())
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	journeys, err := booking.FindJourneys(r.Context(), pool, q)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":                true,
+		"from":                   q.Origin,
+		"to":                     q.Destination,
+		"date":                   q.Date.Format("2006-01-02"),
+		"passengers":             q.Passengers,
+		"min_connection_minutes": int(q.MinConnection.Minutes()),
+		"journeys":               journeys,
+	})
+}
+
+// handleJourneyHoldAPI holds seats on every leg of a journey at once:
+// {"pax":2,"legs":[{"trip_id":"…","from":"GMR","to":"BD","class":"economy"},{"trip_id":"…","from":"BD","to":"YK","seat_ids":["…","…"]}]}.
+// If any leg cannot be held, nothing is: a taken seat returns 409 seat_unavailable.
+func handleJourneyHoldAPI(w http.ResponseWriter, r *http.Request) {
+	var req booking.JourneyHoldRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+		return
+	}
+	req.Holder = holderRef(r)
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	res, err := booking.HoldJourney(r.Context(), pool, req, booking.HoldTTL())
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"success":    true,
+		"booking_id": res.BookingID,
+		"held_until": res.HeldUntil,
+		"seats":      res.Seats,
+	})
+}
+
+// handleListJourneyHoldAPI returns the seats the caller holds for a journey, in travel order.
+func handleListJourneyHoldAPI(w http.ResponseWriter, r *http.Request) {
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	seats, err := booking.ListJourneyHold(r.Context(), pool, holderRef(r))
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "seats": seats})
+}
+
+// handleJourneyCheckoutAPI turns the held journey into one booking:
+// {"contact":{…},"passengers":[{"seat_id":"<first-leg seat>",…}]}.
+func handleJourneyCheckoutAPI(w http.ResponseWriter, r *http.Request) {
+	var req booking.JourneyCheckoutRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+		return
+	}
+	req.Holder = holderRef(r)
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	b, err := booking.CheckoutJourney(r.Context(), pool, req)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"success": true, "booking": b})
+}
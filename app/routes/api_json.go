@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/db"
+	"gothicforge3/internal/env"
+)
+
+// writeJSON encodes v as the JSON response body with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeAPIError writes the structured error body shared by all /api endpoints:
+// {"success":false,"error":{"code":"...","message":"..."}}.
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]any{
+		"success": false,
+		"error":   map[string]string{"code": code, "message": message},
+	})
+}
+
+// bookingErrorStatus maps a booking.Error code to an HTTP status.
+func bookingErrorStatus(err error) (int, string) {
+	switch code := booking.ErrorCode(err); code {
+	case booking.CodeInvalid:
+		return http.StatusBadRequest, code
+	case booking.CodeNotFound:
+		return http.StatusNotFound, code
+	case booking.CodeSeatUnavailable, booking.CodeHoldExpired, booking.CodeNotPending, booking.CodeNotCancellable, booking.CodeNotChangeable:
+		return http.StatusConflict, code
+	case "":
+		return http.StatusInternalServerError, "internal_error"
+	default:
+		return http.StatusInternalServerError, code
+	}
+}
+
+// writeBookingError writes err from the booking package as a structured API error.
+// Per-field validation messages, when present, are included as error.fields.
+// Errors without a domain code are logged and reported without their text, so
+// database details never reach the client.
+func writeBookingError(w http.ResponseWriter, err error) {
+	status, code := bookingErrorStatus(err)
+	if booking.ErrorCode(err) == "" {
+		log.Printf("api: %v", err)
+		writeAPIError(w, status, code, "something went wrong")
+		return
+	}
+	fields := booking.FieldErrors(err)
+	if len(fields) == 0 {
+		writeAPIError(w, status, code, err.Error())
+		return
+	}
+	writeJSON(w, status, map[string]any{
+		"success": false,
+		"error":   map[string]any{"code": code, "message": err.Error(), "fields": fields},
+	})
+}
+
+// requireDBAPI is requireDB for JSON endpoints: failures are reported as structured errors.
+func requireDBAPI(req *http.Request, w http.ResponseWriter) (*pgxpool.Pool, bool) {
+	if env.Get("DATABASE_URL", "") == "" {
+		writeAPIError(w, http.StatusServiceUnavailable, "db_unavailable", "database not configured")
+		return nil, false
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
+	defer cancel()
+	if err := db.Connect(ctx); err != nil {
+		log.Printf("api: database: %v", err)
+		writeAPIError(w, http.StatusServiceUnavailable, "db_unavailable", "database unavailable")
+		return nil, false
+	}
+	return db.Pool(), true
+}
@@ -0,0 +1,219 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/partner"
+	"gothicforge3/internal/server"
+)
+
+func init() {
+	// Partners call from their servers with an API key, never from a browser.
+	server.ExemptFromCSRF("/api/partner/")
+	RegisterRoute(func(r chi.Router) {
+		r.Route("/api/partner", func(r chi.Router) {
+			r.Use(requirePartner)
+			// The customer booking API, acting as the partner: holds,
+			// checkouts and bookings belong to partner.Ref(id).
+			r.Post("/hold", handleHoldAPI)
+			r.Get("/hold", handleListHoldsAPI)
+			r.Delete("/hold", handleReleaseHoldAPI)
+			r.Post("/checkout", handleCheckoutAPI)
+			r.Post("/payments", handleStartPaymentAPI)
+			r.Post("/bookings/cancel", handleCancelBookingAPI)
+			r.Get("/bookings", handlePartnerBookingsAPI)
+
+			r.Get("/webhooks", handlePartnerWebhooksAPI)
+			r.Post("/webhooks", handleAddPartnerWebhookAPI)
+			r.Delete("/webhooks/{id}", handleRemovePartnerWebhookAPI)
+			r.Post("/webhooks/{id}/rotate", handleRotatePartnerWebhookAPI)
+			r.Get("/webhooks/deliveries", handlePartnerDeliveriesAPI)
+			r.Get("/webhooks/deliveries/{id}", handlePartnerDeliveryAPI)
+			r.Post("/webhooks/deliveries/{id}/resend", handleResendPartnerDeliveryAPI)
+		})
+	})
+}
+
+type partnerKey struct{}
+
+// requirePartner authenticates "Authorization: Bearer <API key>" and makes
+// the partner the caller of the wrapped handlers (see holderRef).
+func requirePartner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized", "partner API key required")
+			return
+		}
+		pool, ok := requireDBAPI(r, w)
+		if !ok {
+			return
+		}
+		p, err := partner.Authenticate(r.Context(), pool, key)
+		if errors.Is(err, partner.ErrBadKey) {
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+			return
+		}
+		if err != nil {
+			writeBookingError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), partnerKey{}, p)))
+	})
+}
+
+// partnerRef is partner.Ref of the authenticated partner, or "" outside /api/partner.
+func partnerRef(r *http.Request) string {
+	if p, ok := r.Context().Value(partnerKey{}).(partner.Partner); ok {
+		return partner.Ref(p.ID)
+	}
+	return ""
+}
+
+func partnerID(r *http.Request) string {
+	p, _ := r.Context().Value(partnerKey{}).(partner.Partner)
+	return p.ID
+}
+
+// handlePartnerBookingsAPI lists the partner's bookings, newest first.
+func handlePartnerBookingsAPI(w http.ResponseWriter, r *http.Request) {
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	list, err := booking.ListBookings(r.Context(), pool, partnerRef(r))
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "bookings": orEmpty(list)})
+}
+
+func handlePartnerWebhooksAPI(w http.ResponseWriter, r *http.Request) {
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	list, err := partner.Webhooks(r.Context(), pool, partnerID(r))
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "webhooks": list, "events": partner.Events})
+}
+
+// handleAddPartnerWebhookAPI subscribes {"url":"https://…","events":["booking.paid"]}
+// (every event when none). The reply holds the signing secret, shown only once.
+func handleAddPartnerWebhookAPI(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&in); err != nil {
+		writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+		return
+	}
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	hook, err := partner.AddWebhook(r.Context(), pool, partnerID(r), in.URL, in.Events)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"success": true, "webhook": hook})
+}
+
+func handleRemovePartnerWebhookAPI(w http.ResponseWriter, r *http.Request) {
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	if err := partner.RemoveWebhook(r.Context(), pool, partnerID(r), chi.URLParam(r, "id")); err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true})
+}
+
+func handleRotatePartnerWebhookAPI(w http.ResponseWriter, r *http.Request) {
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	secret, err := partner.RotateSecret(r.Context(), pool, partnerID(r), chi.URLParam(r, "id"))
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "secret": secret})
+}
+
+// handlePartnerDeliveriesAPI is the delivery log: ?webhook=…&booking=…&status=pending|delivered|failed&limit=….
+func handlePartnerDeliveriesAPI(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := partner.DeliveryFilter{PartnerID: partnerID(r), WebhookID: q.Get("webhook"), BookingID: q.Get("booking"), Status: q.Get("status")}
+	switch f.Status {
+	case "", partner.StatusPending, partner.StatusDelivered, partner.StatusFailed:
+	default:
+		writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, "status must be pending, delivered or failed")
+		return
+	}
+	f.Limit, _ = strconv.Atoi(q.Get("limit"))
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	list, err := partner.Deliveries(r.Context(), pool, f)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "deliveries": list})
+}
+
+func handlePartnerDeliveryAPI(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, booking.CodeNotFound, "delivery not found")
+		return
+	}
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	d, err := partner.GetDelivery(r.Context(), pool, partnerID(r), id)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "delivery": d})
+}
+
+// handleResendPartnerDeliveryAPI queues a delivery's event again; the reply is the new delivery.
+func handleResendPartnerDeliveryAPI(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, booking.CodeNotFound, "delivery not found")
+		return
+	}
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	d, err := partner.Resend(r.Context(), pool, partnerID(r), id)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"success": true, "delivery": d})
+}
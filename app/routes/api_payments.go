@@ -0,0 +1,145 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/payment"
+	"gothicforge3/internal/server"
+)
+
+func init() {
+	// Gateways call the webhook server-to-server; the signature authenticates it.
+	server.ExemptFromCSRF("/api/payments/webhook")
+	RegisterRoute(func(r chi.Router) {
+		r.Post("/api/payments", handleStartPaymentAPI)
+		r.Post("/api/payments/webhook", handlePaymentWebhook)
+		RegisterURL("/api/payments")
+	})
+}
+
+// handleStartPaymentAPI returns payment instructions for one of the caller's pending bookings:
+// {"code":"K7QM2XA","method":"va","bank":"bca"} or {"code":"…","method":"qris"}.
+// With "change":true it pays the balance of the booking's pending trip change instead.
+func handleStartPaymentAPI(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Code   string `json:"code"`
+		Method string `json:"method"`
+		Bank   string `json:"bank"`
+		Change bool   `json:"change"`
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&in); err != nil {
+			writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+			return
+		}
+	} else {
+		_ = r.ParseForm()
+		in.Code, in.Method, in.Bank = r.Form.Get("code"), r.Form.Get("method"), r.Form.Get("bank")
+		in.Change = r.Form.Get("change") != ""
+	}
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	b, err := ownBooking(r, pool, in.Code)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	if in.Change {
+		c, err := booking.PendingChange(r.Context(), pool, b)
+		if err == nil && c == nil {
+			err = &booking.Error{Code: booking.CodeNotPending, Message: "booking has no trip change waiting for payment"}
+		}
+		if err != nil {
+			writeBookingError(w, err)
+			return
+		}
+		p, err := startChangePayment(r, pool, b, *c, in.Method, in.Bank)
+		if err != nil {
+			writeBookingError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{"success": true, "payment": p, "payment_due_at": c.DueAt})
+		return
+	}
+	p, err := startPayment(r, pool, b, in.Method, in.Bank)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"success": true, "payment": p, "payment_due_at": b.PaymentDueAt})
+}
+
+// handlePaymentWebhook receives gateway callbacks. The provider verifies the
+// signature; the callback then marks the booking paid or expired.
+func handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	prov, err := payment.FromEnv()
+	if err != nil {
+		writeAPIError(w, http.StatusServiceUnavailable, "payment_unavailable", err.Error())
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+		return
+	}
+	ev, err := prov.ParseCallback(r.Header, body)
+	if errors.Is(err, payment.ErrBadSignature) {
+		writeAPIError(w, http.StatusUnauthorized, "invalid_signature", err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+		return
+	}
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	p, err := payment.ApplyEvent(r.Context(), pool, prov.Name(), ev)
+	if err != nil {
+		log.Printf("payments: webhook %s %s: %v", prov.Name(), ev.ExternalID, err)
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "status": p.Status})
+}
+
+// ownBooking loads a booking by code when it belongs to the caller, or when
+// the caller looked it up as a guest with its contact email in this session.
+// Other people's bookings are reported as not found so codes cannot be probed.
+func ownBooking(r *http.Request, db booking.Querier, code string) (booking.Booking, error) {
+	if strings.TrimSpace(code) == "" {
+		return booking.Booking{}, &booking.Error{Code: booking.CodeInvalid, Message: "code is required"}
+	}
+	b, err := booking.GetBookingByCode(r.Context(), db, code)
+	if err == nil && b.UserRef != holderRef(r) && !guestBooking(r, b.Code) {
+		err = &booking.Error{Code: booking.CodeNotFound, Message: "booking not found"}
+	}
+	return b, err
+}
+
+func startPayment(r *http.Request, db booking.Querier, b booking.Booking, method, bank string) (payment.Payment, error) {
+	prov, err := payment.FromEnv()
+	if err != nil {
+		return payment.Payment{}, err
+	}
+	return payment.Start(r.Context(), db, prov, b, method, bank)
+}
+
+func startChangePayment(r *http.Request, db booking.Querier, b booking.Booking, c booking.Change, method, bank string) (payment.Payment, error) {
+	prov, err := payment.FromEnv()
+	if err != nil {
+		return payment.Payment{}, err
+	}
+	return payment.StartChange(r.Context(), db, prov, b, c, method, bank)
+}
@@ -0,0 +1,98 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"gothicforge3/internal/booking"
+)
+
+func init() {
+	RegisterRoute(func(r chi.Router) {
+		r.Get("/api/bookings/reschedule", handleQuoteRescheduleAPI)
+		r.Post("/api/bookings/reschedule", handleRescheduleAPI)
+		r.Get("/api/bookings/history", handleBookingHistoryAPI)
+		RegisterURL("/api/bookings/reschedule")
+	})
+}
+
+// handleQuoteRescheduleAPI prices moving one of the caller's bookings to
+// another departure without changing anything: ?code=K7QM2XA&trip_id=…
+// (&seat_id=… repeated to choose the seats).
+func handleQuoteRescheduleAPI(w http.ResponseWriter, r *http.Request) {
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	b, err := ownBooking(r, pool, q.Get("code"))
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	c, err := booking.QuoteReschedule(r.Context(), pool, booking.RescheduleRequest{BookingID: b.ID, TripID: strings.TrimSpace(q.Get("trip_id")), SeatIDs: q["seat_id"]})
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "change": c})
+}
+
+// handleRescheduleAPI moves one of the caller's paid bookings to another
+// departure on the same route, keeping its code:
+// {"code":"K7QM2XA","trip_id":"…","seat_ids":["…"],"reason":"…"}. When the
+// change has a balance to pay the reply's change is pending; pay it with
+// POST /api/payments {"code":"…","change":true,…} before due_at.
+func handleRescheduleAPI(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Code string `json:"code"`
+		booking.RescheduleRequest
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&in); err != nil {
+			writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+			return
+		}
+	} else {
+		_ = r.ParseForm()
+		in.Code, in.TripID, in.SeatIDs, in.Reason = r.Form.Get("code"), r.Form.Get("trip_id"), r.Form["seat_id"], r.Form.Get("reason")
+	}
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	b, err := ownBooking(r, pool, in.Code)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	in.BookingID = b.ID
+	c, err := booking.Reschedule(r.Context(), pool, in.RescheduleRequest)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "change": c})
+}
+
+// handleBookingHistoryAPI lists every recorded change of one of the caller's bookings: ?code=K7QM2XA.
+func handleBookingHistoryAPI(w http.ResponseWriter, r *http.Request) {
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	b, err := ownBooking(r, pool, r.URL.Query().Get("code"))
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	h, err := booking.History(r.Context(), pool, b.ID)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "history": h})
+}
@@ -0,0 +1,108 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/seatfeed"
+)
+
+// maxStreamTrips caps the trips one search results page may watch.
+const maxStreamTrips = 50
+
+// seatStreamHeartbeat keeps idle streams open through proxies.
+const seatStreamHeartbeat = 25 * time.Second
+
+func init() {
+	booking.OnSeatChange(func(c booking.SeatChange) { seatfeed.Default().Publish(c) })
+	RegisterRoute(func(r chi.Router) {
+		r.Get("/api/trips/{id}/seats/stream", handleTripSeatStream)
+		r.Get("/api/seats/stream", handleSeatsStream)
+	})
+}
+
+// handleTripSeatStream streams one trip's seat changes as Server-Sent Events
+// named "seats": GET /api/trips/{id}/seats/stream
+func handleTripSeatStream(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !booking.ValidUUID(id) {
+		writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, "trip id must be a UUID")
+		return
+	}
+	streamSeats(w, r, []string{id}, func(string) string { return "seats" })
+}
+
+// handleSeatsStream streams the seat changes of several trips, each as events
+// named "seats-<trip id>": GET /api/seats/stream?trip=…&trip=…
+func handleSeatsStream(w http.ResponseWriter, r *http.Request) {
+	var ids []string
+	seen := map[string]bool{}
+	for _, v := range r.URL.Query()["trip"] {
+		for _, id := range strings.Split(v, ",") {
+			id = strings.TrimSpace(id)
+			if id == "" || seen[id] {
+				continue
+			}
+			if !booking.ValidUUID(id) {
+				writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, "trip ids must be UUIDs")
+				return
+			}
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 || len(ids) > maxStreamTrips {
+		writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, fmt.Sprintf("between 1 and %d trips are required", maxStreamTrips))
+		return
+	}
+	streamSeats(w, r, ids, func(trip string) string { return "seats-" + trip })
+}
+
+// streamSeats writes the trips' seat changes to w as they happen, with a
+// comment every seatStreamHeartbeat, until the client goes away.
+func streamSeats(w http.ResponseWriter, r *http.Request, tripIDs []string, event func(trip string) string) {
+	rc := http.NewResponseController(w)
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprint(w, "retry: 5000\n: connected\n\n"); err != nil || rc.Flush() != nil {
+		return
+	}
+
+	changes, cancel := seatfeed.Default().Subscribe(tripIDs...)
+	defer cancel()
+	beat := time.NewTicker(seatStreamHeartbeat)
+	defer beat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case c, ok := <-changes:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(c)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event(c.TripID), data); err != nil {
+				return
+			}
+		case <-beat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
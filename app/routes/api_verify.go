@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/env"
+	"gothicforge3/internal/server"
+	"gothicforge3/internal/ticket"
+)
+
+func init() {
+	// Scanning devices authenticate with GATE_API_TOKEN, not a browser session.
+	server.ExemptFromCSRF("/api/verify")
+	RegisterRoute(func(r chi.Router) {
+		r.Post("/api/verify", handleVerifyTicket)
+	})
+}
+
+// handleVerifyTicket boards a scanned ticket:
+// {"payload":"KT1.…","trip_id":"…","gate":"GMR-3"}.
+// A valid ticket returns 200 with the passenger to check against their ID;
+// everything else is a structured error (see verifyErrorStatus).
+func handleVerifyTicket(w http.ResponseWriter, r *http.Request) {
+	if !gateAuthorized(w, r) {
+		return
+	}
+	var in struct {
+		Payload string `json:"payload"`
+		TripID  string `json:"trip_id"`
+		Gate    string `json:"gate"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8<<10)).Decode(&in); err != nil {
+		writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+		return
+	}
+	pub, err := ticket.PublicKeyFromEnv()
+	if err != nil {
+		log.Printf("verify: %v", err)
+		writeAPIError(w, http.StatusServiceUnavailable, "verify_unavailable", "ticket verification is not configured")
+		return
+	}
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	bd, err := ticket.Board(r.Context(), pool, pub, in.Payload, in.TripID, in.Gate)
+	if err != nil && booking.ErrorCode(err) == "" {
+		writeBookingError(w, err)
+		return
+	}
+	if err != nil {
+		status, code := verifyErrorStatus(err)
+		body := map[string]any{"code": code, "message": err.Error()}
+		if code == ticket.CodeAlreadyBoarded {
+			body["boarded_at"], body["gate"] = bd.BoardedAt, bd.Gate
+		}
+		writeJSON(w, status, map[string]any{"success": false, "error": body})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "boarding": bd})
+}
+
+// verifyErrorStatus extends bookingErrorStatus with the ticket rejection codes.
+func verifyErrorStatus(err error) (int, string) {
+	switch code := booking.ErrorCode(err); code {
+	case ticket.CodeInvalidTicket:
+		return http.StatusUnprocessableEntity, code
+	case ticket.CodeWrongTrip, ticket.CodeTicketVoid, ticket.CodeAlreadyBoarded:
+		return http.StatusConflict, code
+	default:
+		return bookingErrorStatus(err)
+	}
+}
+
+// gateAuthorized checks "Authorization: Bearer $GATE_API_TOKEN". Without a
+// token the endpoint is open in development and disabled in production.
+func gateAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	want := strings.TrimSpace(env.Get("GATE_API_TOKEN", ""))
+	if want == "" {
+		if devMode() {
+			return true
+		}
+		writeAPIError(w, http.StatusServiceUnavailable, "verify_unavailable", "GATE_API_TOKEN is not set")
+		return false
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(want)) != 1 {
+		writeAPIError(w, http.StatusUnauthorized, "unauthorized", "gate token required")
+		return false
+	}
+	return true
+}
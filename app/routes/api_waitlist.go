@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"gothicforge3/internal/booking"
+)
+
+func init() {
+	RegisterRoute(func(r chi.Router) {
+		r.Post("/api/waitlist", handleJoinWaitlistAPI)
+		r.Get("/api/waitlist", handleListWaitlistAPI)
+		r.Delete("/api/waitlist", handleLeaveWaitlistAPI)
+		RegisterURL("/api/waitlist")
+	})
+}
+
+// handleJoinWaitlistAPI queues the caller for a sold-out class:
+// {"trip_id":"…","from":"GMR","to":"BD","class":"executive","pax":2,"email":"…"}.
+// When seats free up they are held for the caller and the email is notified.
+func handleJoinWaitlistAPI(w http.ResponseWriter, r *http.Request) {
+	var req booking.WaitlistRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+			return
+		}
+	} else {
+		_ = r.ParseForm()
+		req.TripID, req.From, req.To = r.Form.Get("trip_id"), r.Form.Get("from"), r.Form.Get("to")
+		req.Class, req.Email = r.Form.Get("class"), r.Form.Get("email")
+		req.Seats, _ = strconv.Atoi(r.Form.Get("pax"))
+	}
+	req.Holder = holderRef(r)
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	e, err := booking.JoinWaitlist(r.Context(), pool, req)
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "entry": e})
+}
+
+// handleListWaitlistAPI returns the caller's waitlist entries with their place in the queue.
+func handleListWaitlistAPI(w http.ResponseWriter, r *http.Request) {
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	entries, err := booking.ListWaitlist(r.Context(), pool, holderRef(r))
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true, "entries": entries})
+}
+
+// handleLeaveWaitlistAPI takes the caller off an entry (?id= or {"id":"…"}),
+// releasing seats already offered to them.
+func handleLeaveWaitlistAPI(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var in struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&in); err != nil {
+			writeAPIError(w, http.StatusBadRequest, booking.CodeInvalid, err.Error())
+			return
+		}
+		id = in.ID
+	}
+	pool, ok := requireDBAPI(r, w)
+	if !ok {
+		return
+	}
+	if err := booking.LeaveWaitlist(r.Context(), pool, holderRef(r), strings.TrimSpace(id)); err != nil {
+		writeBookingError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"success": true})
+}
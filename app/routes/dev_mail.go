@@ -0,0 +1,56 @@
+package routes
+
+import (
+    "net/http"
+    "net/url"
+    "strings"
+
+    "github.com/go-chi/chi/v5"
+    "gothicforge3/app/templates"
+    "gothicforge3/internal/notify"
+)
+
+func init() {
+    RegisterRoute(func(r chi.Router) {
+        // dev-only: every customer email rendered with fixture data, as HTML
+        // (/dev/mail/{name}) or plain text (/dev/mail/{name}.txt). POST sends
+        // one through the configured transport, e.g. to MailHog.
+        r.Get("/dev/mail", func(w http.ResponseWriter, req *http.Request) {
+            if !devMode() { http.NotFound(w, req); return }
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            v := templates.DevMailView{Previews: notify.Previews(notify.BaseURL()), Transport: notify.TransportFromEnv().Name()}
+            if to := req.URL.Query().Get("sent"); to != "" { v.Flash = "Sent to " + to + "." }
+            _ = templates.DevMail(v).Render(req.Context(), w)
+        })
+        r.Get("/dev/mail/{name}", func(w http.ResponseWriter, req *http.Request) {
+            if !devMode() { http.NotFound(w, req); return }
+            name, plain := strings.CutSuffix(chi.URLParam(req, "name"), ".txt")
+            p, ok := mailPreview(name)
+            if !ok { http.NotFound(w, req); return }
+            if plain {
+                w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+                _, _ = w.Write([]byte(p.Message.Text))
+                return
+            }
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            _, _ = w.Write([]byte(p.Message.HTML))
+        })
+        r.Post("/dev/mail/{name}", func(w http.ResponseWriter, req *http.Request) {
+            if !devMode() { http.NotFound(w, req); return }
+            p, ok := mailPreview(chi.URLParam(req, "name"))
+            if !ok { http.NotFound(w, req); return }
+            _ = req.ParseForm()
+            if to := strings.TrimSpace(req.Form.Get("to")); to != "" { p.Message.To = to }
+            if err := notify.TransportFromEnv().Send(req.Context(), p.Message); err != nil { http.Error(w, err.Error(), http.StatusBadGateway); return }
+            http.Redirect(w, req, "/dev/mail?"+url.Values{"sent": {p.Message.To}}.Encode(), http.StatusSeeOther)
+        })
+    })
+}
+
+// mailPreview finds the preview called name.
+func mailPreview(name string) (notify.Preview, bool) {
+    for _, p := range notify.Previews(notify.BaseURL()) {
+        if p.Name == name { return p, true }
+    }
+    return notify.Preview{}, false
+}
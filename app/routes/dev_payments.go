@@ -0,0 +1,48 @@
+package routes
+
+import (
+    "bytes"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+
+    "github.com/go-chi/chi/v5"
+    "gothicforge3/internal/booking"
+    "gothicforge3/internal/env"
+    "gothicforge3/internal/payment"
+)
+
+func init() {
+    RegisterRoute(func(r chi.Router) {
+        // dev-only: act as the payment gateway for a simulator charge. The callback is
+        // signed like a real one and goes through the same webhook handler.
+        r.Post("/dev/pay", func(w http.ResponseWriter, req *http.Request) {
+            if !devMode() { http.NotFound(w, req); return }
+            prov, err := payment.FromEnv()
+            sim, ok := prov.(*payment.Simulator)
+            if err != nil || !ok { http.Error(w, "PAYMENT_PROVIDER is not the simulator", http.StatusConflict); return }
+            _ = req.ParseForm()
+            pool, ok := requireDB(req, w)
+            if !ok { return }
+            p, err := payment.Get(req.Context(), pool, sim.Name(), req.Form.Get("external_id"))
+            if err != nil { http.Error(w, err.Error(), http.StatusNotFound); return }
+            status := req.Form.Get("status")
+            if status != payment.StatusPaid && status != payment.StatusExpired && status != payment.StatusFailed { status = payment.StatusPaid }
+
+            h, body := sim.Callback(p.ExternalID, status, p.Amount)
+            cb := httptest.NewRequest(http.MethodPost, "/api/payments/webhook", bytes.NewReader(body)).WithContext(req.Context())
+            cb.Header = h
+            rec := httptest.NewRecorder()
+            handlePaymentWebhook(rec, cb)
+            if rec.Code != http.StatusOK { http.Error(w, strings.TrimSpace(rec.Body.String()), rec.Code); return }
+
+            b, err := booking.GetBookingByID(req.Context(), pool, p.BookingID)
+            if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+            http.Redirect(w, req, "/booking?"+url.Values{"code": {b.Code}}.Encode(), http.StatusSeeOther)
+        })
+    })
+}
+
+// devMode reports whether dev-only helpers (/dev/*) are enabled, i.e. APP_ENV is not production.
+func devMode() bool { return !strings.EqualFold(env.Get("APP_ENV", "development"), "production") }
@@ -0,0 +1,106 @@
+package routes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/httprate"
+
+	"gothicforge3/internal/auth"
+	"gothicforge3/internal/env"
+	"gothicforge3/internal/server"
+)
+
+// holderRef identifies who owns seat holds and carts for this request:
+// "partner:<id>" for a partner calling /api/partner, "user:<sub>" for a
+// signed-in user (gf_jwt), otherwise "session:<id>" backed by a random id
+// stored in the scs session.
+func holderRef(r *http.Request) string {
+	if ref := partnerRef(r); ref != "" {
+		return ref
+	}
+	if ref := accountRef(r); ref != "" {
+		return ref
+	}
+	sess := server.Sessions()
+	if sess == nil {
+		return ""
+	}
+	id := sess.GetString(r.Context(), "holder")
+	if id == "" {
+		b := make([]byte, 12)
+		_, _ = rand.Read(b)
+		id = hex.EncodeToString(b)
+		sess.Put(r.Context(), "holder", id)
+	}
+	return "session:" + id
+}
+
+// accountRef is "user:<sub>" for a signed-in user (gf_jwt) and "" otherwise.
+func accountRef(r *http.Request) string {
+	if claims, err := auth.ReadAndVerifyCookie(r, "gf_jwt"); err == nil {
+		if sub := strings.TrimSpace(fmt.Sprint(claims["sub"])); sub != "" && sub != "<nil>" {
+			return "user:" + sub
+		}
+	}
+	return ""
+}
+
+// maxGuestBookings caps how many looked-up bookings one session remembers.
+const maxGuestBookings = 10
+
+// guestLookups counts guest booking lookups per client IP. The API and the
+// account page share it, so both draw on one budget.
+var guestLookups = httprate.NewLocalLimitCounter(time.Minute)
+
+// limitGuestLookups allows GUEST_LOOKUP_LIMIT lookups per client IP a minute
+// (default 10) so booking codes and emails cannot be guessed in bulk; onLimit
+// answers the rest.
+func limitGuestLookups(onLimit http.HandlerFunc) func(http.Handler) http.Handler {
+	n := 10
+	if v, err := strconv.Atoi(strings.TrimSpace(env.Get("GUEST_LOOKUP_LIMIT", ""))); err == nil && v > 0 {
+		n = v
+	}
+	return httprate.Limit(n, time.Minute, httprate.WithKeyByIP(), httprate.WithLimitCounter(guestLookups), httprate.WithLimitHandler(onLimit))
+}
+
+// grantGuestBooking lets this session manage a booking it proved to know the
+// code and contact email of (see booking.FindGuestBooking). The session token
+// is renewed first, so a token planted before the lookup does not gain the
+// booking.
+func grantGuestBooking(r *http.Request, code string) error {
+	sess := server.Sessions()
+	if sess == nil {
+		return nil
+	}
+	if err := sess.RenewToken(r.Context()); err != nil {
+		return err
+	}
+	codes := []string{code}
+	for _, c := range strings.Fields(sess.GetString(r.Context(), "guest_bookings")) {
+		if c != code && len(codes) < maxGuestBookings {
+			codes = append(codes, c)
+		}
+	}
+	sess.Put(r.Context(), "guest_bookings", strings.Join(codes, " "))
+	return nil
+}
+
+// guestBooking reports whether this session looked the booking up as a guest.
+func guestBooking(r *http.Request, code string) bool {
+	sess := server.Sessions()
+	if sess == nil || code == "" {
+		return false
+	}
+	for _, c := range strings.Fields(sess.GetString(r.Context(), "guest_bookings")) {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
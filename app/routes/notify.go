@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"gothicforge3/internal/db"
+	"gothicforge3/internal/notify"
+)
+
+// mailer returns the customer email service backed by the shared pool.
+func mailer() *notify.Service {
+	return notify.New(db.Pool())
+}
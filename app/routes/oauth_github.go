@@ -11,6 +11,7 @@ import (
 	"golang.org/x/oauth2"
 	ghoauth "golang.org/x/oauth2/github"
 
+	"gothicforge3/internal/admin"
 	"gothicforge3/internal/auth"
 	"gothicforge3/internal/env"
 )
@@ -70,6 +71,9 @@ func githubSuccess(w http.ResponseWriter, r *http.Request) {
 		"name":     name,
 		"provider": "github",
 	}
+	if admin.GitHubAdmin(login) {
+		claims["role"] = admin.RoleAdmin
+	}
 	tok, exp, err := auth.Issue(7*24*time.Hour, claims)
 	if err != nil {
 		http.Error(w, "token error", http.StatusInternalServerError)
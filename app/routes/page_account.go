@@ -0,0 +1,69 @@
+package routes
+
+import (
+    "net/http"
+    "net/url"
+    "time"
+
+    "github.com/go-chi/chi/v5"
+    "gothicforge3/app/templates"
+    "gothicforge3/internal/booking"
+    "gothicforge3/internal/db"
+)
+
+func init() {
+    RegisterRoute(func(r chi.Router) {
+        // Signed-in users see their bookings (scoped to the JWT subject); everyone gets the guest lookup form.
+        r.Get("/account/bookings", func(w http.ResponseWriter, req *http.Request) {
+            v, status := accountView(req)
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            w.Header().Set("Cache-Control", "private, no-store")
+            w.WriteHeader(status)
+            _ = templates.PageAccountBookings(v).Render(req.Context(), w)
+        })
+
+        // Code plus contact email opens a guest booking for this session.
+        lookupLimit := limitGuestLookups(func(w http.ResponseWriter, req *http.Request) {
+            http.Error(w, "Too many booking lookups, please try again in a minute.", http.StatusTooManyRequests)
+        })
+        r.With(lookupLimit).Post("/account/bookings/lookup", func(w http.ResponseWriter, req *http.Request) {
+            _ = req.ParseForm()
+            code, email := req.Form.Get("code"), req.Form.Get("email")
+            v, status := accountView(req)
+            if v.Error == "" {
+                b, err := booking.FindGuestBooking(req.Context(), db.Pool(), code, email)
+                if err == nil {
+                    err = grantGuestBooking(req, b.Code)
+                }
+                if err == nil {
+                    http.Redirect(w, req, "/booking?"+url.Values{"code": {b.Code}}.Encode(), http.StatusSeeOther)
+                    return
+                }
+                v.Code, v.Email = code, email
+                v.Flash, status = "No booking matches that code and email.", http.StatusNotFound
+                if c := booking.ErrorCode(err); c == booking.CodeInvalid { v.Flash, status = err.Error(), http.StatusBadRequest }
+                if booking.ErrorCode(err) == "" { v.Flash, status = "booking lookup is temporarily unavailable", http.StatusInternalServerError }
+            }
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            w.WriteHeader(status)
+            _ = templates.PageAccountBookings(v).Render(req.Context(), w)
+        })
+        RegisterURL("/account/bookings")
+    })
+}
+
+// accountView loads the signed-in user's bookings; guests get an empty view with the lookup form.
+func accountView(req *http.Request) (templates.AccountView, int) {
+    var v templates.AccountView
+    if !dbConfigured() || db.Connect(req.Context()) != nil {
+        v.Error = "bookings are temporarily unavailable"
+        return v, http.StatusServiceUnavailable
+    }
+    ref := accountRef(req)
+    if ref == "" { return v, http.StatusOK }
+    all, err := booking.ListBookings(req.Context(), db.Pool(), ref)
+    if err != nil { v.Error = "bookings are temporarily unavailable"; return v, http.StatusInternalServerError }
+    v.SignedIn = true
+    v.Upcoming, v.Past = booking.SplitBookings(all, time.Now())
+    return v, http.StatusOK
+}
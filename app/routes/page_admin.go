@@ -0,0 +1,442 @@
+package routes
+
+import (
+    "context"
+    "encoding/csv"
+    "io"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+
+    templ "github.com/a-h/templ"
+    "github.com/go-chi/chi/v5"
+    "gothicforge3/app/templates"
+    "gothicforge3/internal/admin"
+    "gothicforge3/internal/auth"
+    "gothicforge3/internal/booking"
+    "gothicforge3/internal/db"
+)
+
+func init() {
+    RegisterRoute(func(r chi.Router) {
+        r.Group(func(r chi.Router) {
+            r.Use(requireAdmin)
+
+            r.Get("/admin", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                entries, err := admin.AuditLog(req.Context(), db.Pool(), "", "", 20)
+                renderAdmin(w, req, http.StatusOK, templates.AdminHome(entries, adminLoadError(err)))
+            })
+            r.Get("/admin/audit", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                q := req.URL.Query()
+                entries, err := admin.AuditLog(req.Context(), db.Pool(), q.Get("entity"), q.Get("id"), 200)
+                renderAdmin(w, req, http.StatusOK, templates.AdminAudit(q.Get("entity"), q.Get("id"), entries, adminLoadError(err)))
+            })
+
+            // Stations
+            r.Get("/admin/stations", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                q := req.URL.Query().Get("q")
+                list, err := admin.SearchStations(req.Context(), db.Pool(), q)
+                renderAdmin(w, req, http.StatusOK, templates.AdminStations(q, list, adminLoadError(err)))
+            })
+            r.Get("/admin/stations/new", func(w http.ResponseWriter, req *http.Request) {
+                renderAdmin(w, req, http.StatusOK, templates.AdminStationForm(admin.Station{Active: true}, templates.AdminFormView{}))
+            })
+            r.Get("/admin/stations/{id}", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                s, err := admin.GetStation(req.Context(), db.Pool(), chi.URLParam(req, "id"))
+                if err != nil { adminNotFound(w, req, err); return }
+                renderAdmin(w, req, http.StatusOK, templates.AdminStationForm(s, adminForm(req, admin.EntityStation, s.ID)))
+            })
+            saveStation := func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                _ = req.ParseForm()
+                f := req.Form
+                s := admin.Station{ID: chi.URLParam(req, "id"), Code: f.Get("code"), Name: f.Get("name"), City: f.Get("city"), Active: f.Get("active") != ""}
+                errs := map[string]string{}
+                s.Lat = formFloat(f.Get("lat"), "lat", errs)
+                s.Lon = formFloat(f.Get("lon"), "lon", errs)
+                if len(errs) == 0 {
+                    saved, err := admin.SaveStation(req.Context(), db.Pool(), adminActor(req), s)
+                    if err == nil { http.Redirect(w, req, "/admin/stations/"+saved.ID+"?saved=1", http.StatusSeeOther); return }
+                    if !adminFormError(w, req, err, errs) { return }
+                }
+                renderAdmin(w, req, http.StatusBadRequest, templates.AdminStationForm(s, templates.AdminFormView{Errors: errs, Error: "Please correct the highlighted fields."}))
+            }
+            r.Post("/admin/stations", saveStation)
+            r.Post("/admin/stations/{id}", saveStation)
+            r.Get("/admin/stations/{id}/delete", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                s, err := admin.GetStation(req.Context(), db.Pool(), chi.URLParam(req, "id"))
+                if err != nil { adminNotFound(w, req, err); return }
+                renderAdmin(w, req, http.StatusOK, templates.AdminConfirm(stationConfirm(s, "")))
+            })
+            r.Post("/admin/stations/{id}/delete", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                _ = req.ParseForm()
+                id := chi.URLParam(req, "id")
+                err := admin.DeleteStation(req.Context(), db.Pool(), adminActor(req), id, req.Form.Get("confirm"))
+                if err == nil { http.Redirect(w, req, "/admin/stations", http.StatusSeeOther); return }
+                s, gerr := admin.GetStation(req.Context(), db.Pool(), id)
+                if gerr != nil { adminNotFound(w, req, gerr); return }
+                renderAdmin(w, req, adminStatus(err), templates.AdminConfirm(stationConfirm(s, adminMessage(err))))
+            })
+
+            // Trains
+            r.Get("/admin/trains", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                q := req.URL.Query().Get("q")
+                list, err := admin.SearchTrains(req.Context(), db.Pool(), q)
+                renderAdmin(w, req, http.StatusOK, templates.AdminTrains(q, list, adminLoadError(err)))
+            })
+            r.Get("/admin/trains/new", func(w http.ResponseWriter, req *http.Request) {
+                renderAdmin(w, req, http.StatusOK, templates.AdminTrainForm(admin.Train{Operator: "KAI"}, templates.AdminFormView{}))
+            })
+            r.Get("/admin/trains/{id}", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                t, err := admin.GetTrain(req.Context(), db.Pool(), chi.URLParam(req, "id"))
+                if err != nil { adminNotFound(w, req, err); return }
+                renderAdmin(w, req, http.StatusOK, templates.AdminTrainForm(t, adminForm(req, admin.EntityTrain, t.ID)))
+            })
+            saveTrain := func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                _ = req.ParseForm()
+                f := req.Form
+                t := admin.Train{ID: chi.URLParam(req, "id"), Code: f.Get("code"), Name: f.Get("name"), Operator: f.Get("operator"), Classes: f["classes"]}
+                errs := map[string]string{}
+                saved, err := admin.SaveTrain(req.Context(), db.Pool(), adminActor(req), t)
+                if err == nil { http.Redirect(w, req, "/admin/trains/"+saved.ID+"?saved=1", http.StatusSeeOther); return }
+                if !adminFormError(w, req, err, errs) { return }
+                renderAdmin(w, req, http.StatusBadRequest, templates.AdminTrainForm(t, templates.AdminFormView{Errors: errs, Error: "Please correct the highlighted fields."}))
+            }
+            r.Post("/admin/trains", saveTrain)
+            r.Post("/admin/trains/{id}", saveTrain)
+            r.Get("/admin/trains/{id}/delete", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                t, err := admin.GetTrain(req.Context(), db.Pool(), chi.URLParam(req, "id"))
+                if err != nil { adminNotFound(w, req, err); return }
+                renderAdmin(w, req, http.StatusOK, templates.AdminConfirm(trainConfirm(t, "")))
+            })
+            r.Post("/admin/trains/{id}/delete", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                _ = req.ParseForm()
+                id := chi.URLParam(req, "id")
+                err := admin.DeleteTrain(req.Context(), db.Pool(), adminActor(req), id, req.Form.Get("confirm"))
+                if err == nil { http.Redirect(w, req, "/admin/trains", http.StatusSeeOther); return }
+                t, gerr := admin.GetTrain(req.Context(), db.Pool(), id)
+                if gerr != nil { adminNotFound(w, req, gerr); return }
+                renderAdmin(w, req, adminStatus(err), templates.AdminConfirm(trainConfirm(t, adminMessage(err))))
+            })
+
+            // Routes
+            r.Get("/admin/routes", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                q := req.URL.Query().Get("q")
+                list, err := admin.SearchRoutes(req.Context(), db.Pool(), q)
+                renderAdmin(w, req, http.StatusOK, templates.AdminRoutes(q, list, adminLoadError(err)))
+            })
+            r.Get("/admin/routes/new", func(w http.ResponseWriter, req *http.Request) {
+                renderAdmin(w, req, http.StatusOK, templates.AdminRouteForm(admin.Route{}, templates.AdminFormView{}))
+            })
+            r.Get("/admin/routes/{id}", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                rt, err := admin.GetRoute(req.Context(), db.Pool(), chi.URLParam(req, "id"))
+                if err != nil { adminNotFound(w, req, err); return }
+                renderAdmin(w, req, http.StatusOK, templates.AdminRouteForm(rt, adminForm(req, admin.EntityRoute, rt.ID)))
+            })
+            saveRoute := func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                _ = req.ParseForm()
+                f := req.Form
+                rt := admin.Route{ID: chi.URLParam(req, "id"), Code: f.Get("code"), Origin: f.Get("origin"), Destination: f.Get("destination")}
+                errs := map[string]string{}
+                rt.DistanceKM = formFloat(f.Get("distance_km"), "distance_km", errs)
+                if len(errs) == 0 {
+                    saved, err := admin.SaveRoute(req.Context(), db.Pool(), adminActor(req), rt)
+                    if err == nil { http.Redirect(w, req, "/admin/routes/"+saved.ID+"?saved=1", http.StatusSeeOther); return }
+                    if !adminFormError(w, req, err, errs) { return }
+                }
+                renderAdmin(w, req, http.StatusBadRequest, templates.AdminRouteForm(rt, templates.AdminFormView{Errors: errs, Error: "Please correct the highlighted fields."}))
+            }
+            r.Post("/admin/routes", saveRoute)
+            r.Post("/admin/routes/{id}", saveRoute)
+            r.Get("/admin/routes/{id}/delete", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                rt, err := admin.GetRoute(req.Context(), db.Pool(), chi.URLParam(req, "id"))
+                if err != nil { adminNotFound(w, req, err); return }
+                renderAdmin(w, req, http.StatusOK, templates.AdminConfirm(routeConfirm(rt, "")))
+            })
+            r.Post("/admin/routes/{id}/delete", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                _ = req.ParseForm()
+                id := chi.URLParam(req, "id")
+                err := admin.DeleteRoute(req.Context(), db.Pool(), adminActor(req), id, req.Form.Get("confirm"))
+                if err == nil { http.Redirect(w, req, "/admin/routes", http.StatusSeeOther); return }
+                rt, gerr := admin.GetRoute(req.Context(), db.Pool(), id)
+                if gerr != nil { adminNotFound(w, req, gerr); return }
+                renderAdmin(w, req, adminStatus(err), templates.AdminConfirm(routeConfirm(rt, adminMessage(err))))
+            })
+
+            // Trips
+            r.Get("/admin/trips", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                q := req.URL.Query()
+                f := admin.TripFilter{Date: q.Get("date"), Q: q.Get("q"), Status: q.Get("status")}
+                list, err := admin.SearchTrips(req.Context(), db.Pool(), f)
+                status := http.StatusOK
+                if booking.ErrorCode(err) != "" { status = http.StatusBadRequest }
+                renderAdmin(w, req, status, templates.AdminTrips(f, list, adminLoadError(err)))
+            })
+            r.Get("/admin/trips/{id}", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                v, err := adminTripView(req, chi.URLParam(req, "id"))
+                if err != nil { adminNotFound(w, req, err); return }
+                renderAdmin(w, req, http.StatusOK, templates.AdminTrip(v))
+            })
+            r.Post("/admin/trips/{id}/price", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                _ = req.ParseForm()
+                id := chi.URLParam(req, "id")
+                price, perr := strconv.ParseInt(strings.TrimSpace(req.Form.Get("base_price")), 10, 64)
+                err := admin.SetTripPrice(req.Context(), db.Pool(), adminActor(req), id, price)
+                if perr != nil { err = &booking.Error{Code: booking.CodeInvalid, Message: "base price must be a whole number of rupiah", Fields: map[string]string{"base_price": "base price must be a whole number of rupiah"}} }
+                adminTripResult(w, req, id, err)
+            })
+            r.Post("/admin/trips/{id}/status", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                _ = req.ParseForm()
+                f := req.Form
+                id := chi.URLParam(req, "id")
+                delay, _ := strconv.Atoi(strings.TrimSpace(f.Get("delay_minutes")))
+                c := admin.StatusChange{Actor: adminActor(req), TripID: id, Status: f.Get("status"), Reason: f.Get("reason"), Confirm: f.Get("confirm"), DelayMinutes: delay}
+                t, err := admin.SetTripStatus(req.Context(), db.Pool(), c)
+                if err != nil && c.Status == admin.TripCancelled && booking.ErrorCode(err) == booking.CodeInvalid {
+                    t, gerr := admin.GetTrip(req.Context(), db.Pool(), id)
+                    if gerr != nil { adminNotFound(w, req, gerr); return }
+                    renderAdmin(w, req, http.StatusBadRequest, templates.AdminConfirm(tripCancelConfirm(req, t, adminMessage(err))))
+                    return
+                }
+                if err == nil && (t.Status == admin.TripDelayed || t.Status == admin.TripCancelled) {
+                    adminDisrupt(w, req, t, c.Reason, delay, f.Get("rebook") != "")
+                    return
+                }
+                adminTripResult(w, req, id, err)
+            })
+            // Handle the passengers still on a delayed or cancelled trip again, e.g. after a longer delay.
+            r.Post("/admin/trips/{id}/disrupt", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                _ = req.ParseForm()
+                t, err := admin.GetTrip(req.Context(), db.Pool(), chi.URLParam(req, "id"))
+                if err != nil { adminNotFound(w, req, err); return }
+                if t.Status != admin.TripDelayed && t.Status != admin.TripCancelled {
+                    adminTripResult(w, req, t.ID, &booking.Error{Code: booking.CodeInvalid, Message: "only a delayed or cancelled trip has passengers to handle"})
+                    return
+                }
+                delay, _ := strconv.Atoi(strings.TrimSpace(req.Form.Get("delay_minutes")))
+                adminDisrupt(w, req, t, req.Form.Get("reason"), delay, req.Form.Get("rebook") != "")
+            })
+            r.Get("/admin/trips/{id}/cancel", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                t, err := admin.GetTrip(req.Context(), db.Pool(), chi.URLParam(req, "id"))
+                if err != nil { adminNotFound(w, req, err); return }
+                renderAdmin(w, req, http.StatusOK, templates.AdminConfirm(tripCancelConfirm(req, t, "")))
+            })
+
+            // Disruptions
+            r.Get("/admin/disruptions", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                list, err := booking.ListDisruptions(req.Context(), db.Pool(), req.URL.Query().Get("trip"), 100)
+                renderAdmin(w, req, http.StatusOK, templates.AdminDisruptions(list, adminLoadError(err)))
+            })
+            r.Get("/admin/disruptions/{id}", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                d, err := booking.GetDisruption(req.Context(), db.Pool(), chi.URLParam(req, "id"))
+                if err != nil { adminNotFound(w, req, err); return }
+                renderAdmin(w, req, http.StatusOK, templates.AdminDisruption(d))
+            })
+            r.Get("/admin/disruptions/{id}/report.csv", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                d, err := booking.GetDisruption(req.Context(), db.Pool(), chi.URLParam(req, "id"))
+                if err != nil { adminNotFound(w, req, err); return }
+                w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+                w.Header().Set("Content-Disposition", "attachment; filename=\"disruption-"+d.Trip.TrainCode+"-"+d.Trip.ServiceDate+".csv\"")
+                _ = writeDisruptionCSV(w, d)
+            })
+
+            // Bookings
+            r.Get("/admin/bookings", func(w http.ResponseWriter, req *http.Request) {
+                if !adminDB(w, req) { return }
+                q := strings.TrimSpace(req.URL.Query().Get("q"))
+                if q == "" { renderAdmin(w, req, http.StatusOK, templates.AdminBookings("", nil, "")); return }
+                found, err := admin.FindBookings(req.Context(), db.Pool(), q)
+                results := make([]templates.AdminBookingResult, 0, len(found))
+                for _, b := range found {
+                    h, herr := booking.History(req.Context(), db.Pool(), b.ID)
+                    if herr != nil { err = herr; break }
+                    results = append(results, templates.AdminBookingResult{Booking: b, History: h})
+                }
+                renderAdmin(w, req, http.StatusOK, templates.AdminBookings(q, results, adminLoadError(err)))
+            })
+        })
+    })
+}
+
+// requireAdmin lets through only requests signed in (gf_jwt) with the admin role.
+func requireAdmin(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        claims, err := auth.ReadAndVerifyCookie(req, "gf_jwt")
+        if err != nil { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
+        if !admin.IsAdmin(claims) || admin.Actor(claims) == "" { http.Error(w, "forbidden", http.StatusForbidden); return }
+        w.Header().Set("Cache-Control", "no-store")
+        next.ServeHTTP(w, req)
+    })
+}
+
+// adminActor names the signed-in operator for the audit log.
+func adminActor(req *http.Request) string {
+    claims, _ := auth.ReadAndVerifyCookie(req, "gf_jwt")
+    return admin.Actor(claims)
+}
+
+func adminDB(w http.ResponseWriter, req *http.Request) bool {
+    _, ok := requireDB(req, w)
+    return ok
+}
+
+func renderAdmin(w http.ResponseWriter, req *http.Request, status int, c templ.Component) {
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    w.WriteHeader(status)
+    _ = c.Render(req.Context(), w)
+}
+
+// adminForm loads the audit trail of an edited row, with a notice after saving.
+func adminForm(req *http.Request, entity, id string) templates.AdminFormView {
+    var v templates.AdminFormView
+    if req.URL.Query().Get("saved") != "" { v.Flash = "Saved." }
+    entries, err := admin.AuditLog(req.Context(), db.Pool(), entity, id, 50)
+    if err != nil { v.Error = "the change log is temporarily unavailable" }
+    v.Audit = entries
+    return v
+}
+
+// adminFormError copies the field errors of a failed save into errs. Other
+// errors are written out (404 or 500) and it returns false.
+func adminFormError(w http.ResponseWriter, req *http.Request, err error, errs map[string]string) bool {
+    switch booking.ErrorCode(err) {
+    case booking.CodeInvalid:
+        for k, v := range booking.FieldErrors(err) { errs[k] = v }
+        return true
+    case booking.CodeNotFound:
+        http.NotFound(w, req)
+        return false
+    }
+    http.Error(w, "the change could not be saved, please try again", http.StatusInternalServerError)
+    return false
+}
+
+func adminNotFound(w http.ResponseWriter, req *http.Request, err error) {
+    if booking.ErrorCode(err) == booking.CodeNotFound { http.NotFound(w, req); return }
+    http.Error(w, "the console is temporarily unavailable", http.StatusInternalServerError)
+}
+
+func adminStatus(err error) int {
+    if booking.ErrorCode(err) == booking.CodeInvalid { return http.StatusBadRequest }
+    return http.StatusInternalServerError
+}
+
+// adminMessage is what the operator sees for a failed change.
+func adminMessage(err error) string {
+    if booking.ErrorCode(err) != "" { return err.Error() }
+    return "the change could not be saved, please try again"
+}
+
+func adminLoadError(err error) string {
+    if err == nil { return "" }
+    if booking.ErrorCode(err) != "" { return err.Error() }
+    return "the list is temporarily unavailable"
+}
+
+// formFloat parses an optional decimal field; a bad value goes into errs.
+func formFloat(s, field string, errs map[string]string) float64 {
+    s = strings.TrimSpace(s)
+    if s == "" { return 0 }
+    v, err := strconv.ParseFloat(s, 64)
+    if err != nil { errs[field] = "must be a number"; return 0 }
+    return v
+}
+
+func stationConfirm(s admin.Station, errMsg string) templates.AdminConfirmView {
+    return templates.AdminConfirmView{Title: "Delete station", What: "Delete " + s.Name + " (" + s.Code + ")? Stations used by routes or timetables cannot be deleted; deactivate them instead.", Expected: s.Code, Action: "/admin/stations/" + s.ID + "/delete", Back: "/admin/stations/" + s.ID, Error: errMsg}
+}
+
+func trainConfirm(t admin.Train, errMsg string) templates.AdminConfirmView {
+    return templates.AdminConfirmView{Title: "Delete train", What: "Delete " + t.Name + " (" + t.Code + ")? Trains that have run trips cannot be deleted.", Expected: t.Code, Action: "/admin/trains/" + t.ID + "/delete", Back: "/admin/trains/" + t.ID, Error: errMsg}
+}
+
+func routeConfirm(rt admin.Route, errMsg string) templates.AdminConfirmView {
+    return templates.AdminConfirmView{Title: "Delete route", What: "Delete route " + rt.Code + " (" + rt.Origin + " → " + rt.Destination + ")? Routes with trips or timetables cannot be deleted.", Expected: rt.Code, Action: "/admin/routes/" + rt.ID + "/delete", Back: "/admin/routes/" + rt.ID, Error: errMsg}
+}
+
+func tripCancelConfirm(req *http.Request, t admin.Trip, errMsg string) templates.AdminConfirmView {
+    what := "Cancel " + t.TrainName + " (" + t.TrainCode + ") " + t.Origin + " → " + t.Destination + " on " + t.ServiceDate + " " + t.Depart + "? It disappears from search and seats in carts are released."
+    if paid, pending, err := admin.TripBookings(req.Context(), db.Pool(), t.ID); err == nil && paid+pending > 0 {
+        what += " " + strconv.Itoa(paid) + " paid bookings are then rebooked or refunded in full, " + strconv.Itoa(pending) + " unpaid ones are cancelled, and every customer is notified."
+    }
+    return templates.AdminConfirmView{Title: "Cancel trip", What: what, Expected: t.TrainCode, Action: "/admin/trips/" + t.ID + "/status", Back: "/admin/trips/" + t.ID, Reason: true, Rebook: true, Error: errMsg}
+}
+
+func adminTripView(req *http.Request, id string) (templates.AdminTripView, error) {
+    var v templates.AdminTripView
+    t, err := admin.GetTrip(req.Context(), db.Pool(), id)
+    if err != nil { return v, err }
+    v.Trip = t
+    if v.Occupancy, err = admin.TripOccupancy(req.Context(), db.Pool(), id); err != nil { return v, err }
+    if v.Paid, v.Pending, err = admin.TripBookings(req.Context(), db.Pool(), id); err != nil { return v, err }
+    v.Form = adminForm(req, admin.EntityTrip, id)
+    return v, nil
+}
+
+// adminTripResult redirects back to the trip after a change, or shows it
+// again with the error.
+func adminTripResult(w http.ResponseWriter, req *http.Request, id string, err error) {
+    if err == nil { http.Redirect(w, req, "/admin/trips/"+id+"?saved=1", http.StatusSeeOther); return }
+    v, verr := adminTripView(req, id)
+    if verr != nil { adminNotFound(w, req, verr); return }
+    v.Form.Error = adminMessage(err)
+    v.Form.Errors = booking.FieldErrors(err)
+    renderAdmin(w, req, adminStatus(err), templates.AdminTrip(v))
+}
+
+// adminDisrupt handles the bookings on a trip that was just delayed or
+// cancelled and shows the report. The run carries on if the operator leaves
+// the page.
+func adminDisrupt(w http.ResponseWriter, req *http.Request, t admin.Trip, reason string, delay int, rebook bool) {
+    kind := booking.DisruptionDelay
+    if t.Status == admin.TripCancelled { kind = booking.DisruptionCancel }
+    dr := booking.DisruptionRequest{TripID: t.ID, Kind: kind, DelayMinutes: delay, Reason: reason, Actor: adminActor(req), Rebook: rebook}
+    d, err := booking.Disrupt(context.WithoutCancel(req.Context()), db.Pool(), dr, mailer())
+    if err != nil { log.Printf("admin: disruption of trip %s: %v", t.ID, err) }
+    if d.ID == "" { adminTripResult(w, req, t.ID, err); return }
+    http.Redirect(w, req, "/admin/disruptions/"+d.ID, http.StatusSeeOther)
+}
+
+// writeDisruptionCSV writes a disruption report with one row per passenger.
+func writeDisruptionCSV(w io.Writer, d booking.Disruption) error {
+    cw := csv.NewWriter(w)
+    _ = cw.Write([]string{"booking", "contact_name", "contact_email", "contact_phone", "passenger", "class", "coach", "seat", "outcome", "new_train", "new_departure", "refund", "offer_until", "notified", "error"})
+    for _, b := range d.Bookings {
+        newDep, until := "", ""
+        if b.NewDeparture != nil { newDep = b.NewDeparture.Local().Format("2006-01-02 15:04") }
+        if b.OfferUntil != nil { until = b.OfferUntil.Local().Format("2006-01-02 15:04") }
+        pax := b.Passengers
+        if len(pax) == 0 { pax = []booking.DisruptedPassenger{{}} }
+        for _, p := range pax {
+            _ = cw.Write([]string{b.Code, b.Contact.Name, b.Contact.Email, b.Contact.Phone, p.Name, p.Class, strconv.Itoa(p.CoachNo), p.SeatNo, b.Outcome, b.NewTrain, newDep, strconv.FormatInt(b.Refund, 10), until, strconv.FormatBool(b.Notified), b.Error})
+        }
+    }
+    cw.Flush()
+    return cw.Error()
+}
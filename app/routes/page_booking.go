@@ -2,16 +2,107 @@ package routes
 
 import (
     "net/http"
+    "net/url"
+
     "github.com/go-chi/chi/v5"
     "gothicforge3/app/templates"
+    "gothicforge3/internal/booking"
+    "gothicforge3/internal/db"
+    "gothicforge3/internal/payment"
 )
 
 func init() {
     RegisterRoute(func(r chi.Router) {
+        // Booking summary and payment step for the holder who checked it out (?code=K7QM2XA).
         r.Get("/booking", func(w http.ResponseWriter, req *http.Request) {
             w.Header().Set("Content-Type", "text/html; charset=utf-8")
-            _ = templates.PageBooking().Render(req.Context(), w)
+            v, status := bookingView(req, req.URL.Query().Get("code"))
+            w.WriteHeader(status)
+            _ = templates.PageBooking(v).Render(req.Context(), w)
+        })
+
+        // Polled by the payment panel; 204 (no swap) until the status moves off ?wait=.
+        r.Get("/booking/payment", func(w http.ResponseWriter, req *http.Request) {
+            v, _ := bookingView(req, req.URL.Query().Get("code"))
+            if v.Booking != nil && v.Booking.Status == req.URL.Query().Get("wait") {
+                w.WriteHeader(http.StatusNoContent)
+                return
+            }
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            _ = templates.PaymentPanel(v).Render(req.Context(), w)
+        })
+
+        // Choosing QRIS or a VA bank creates (or reuses) a charge and shows how to pay.
+        r.Post("/booking/pay", func(w http.ResponseWriter, req *http.Request) {
+            _ = req.ParseForm()
+            code := req.Form.Get("code")
+            method, bank := req.Form.Get("method"), req.Form.Get("va")
+            if method == "" && bank != "" { method = payment.MethodVA }
+            var flash string
+            if v, _ := bookingView(req, code); v.Booking != nil && req.Form.Get("change") != "" {
+                // The balance of a trip change; its panel is not swapped, so the page reloads.
+                if v.Change != nil {
+                    _, _ = startChangePayment(req, db.Pool(), *v.Booking, *v.Change, method, bank)
+                }
+                http.Redirect(w, req, "/booking?"+url.Values{"code": {code}}.Encode(), http.StatusSeeOther)
+                return
+            } else if v.Booking != nil {
+                if _, err := startPayment(req, db.Pool(), *v.Booking, method, bank); err != nil {
+                    flash = err.Error()
+                    if booking.ErrorCode(err) == "" { flash = "payment is temporarily unavailable, please try again" }
+                }
+            }
+            if req.Header.Get("HX-Request") == "" {
+                http.Redirect(w, req, "/booking?"+url.Values{"code": {code}}.Encode(), http.StatusSeeOther)
+                return
+            }
+            v, _ := bookingView(req, code)
+            if flash != "" { v.Flash = flash }
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            _ = templates.PaymentPanel(v).Render(req.Context(), w)
+        })
+        // Cancelling seats needs the confirm box ticked; the refund follows the policy shown on the page.
+        r.Post("/booking/cancel", func(w http.ResponseWriter, req *http.Request) {
+            _ = req.ParseForm()
+            code := req.Form.Get("code")
+            v, status := bookingView(req, code)
+            if v.Booking != nil {
+                if req.Form.Get("confirm") == "" {
+                    v.Flash, status = "Tick the box to confirm the cancellation.", http.StatusBadRequest
+                } else if _, err := booking.CancelBooking(req.Context(), db.Pool(), booking.CancelRequest{BookingID: v.Booking.ID, ItemIDs: req.Form["item_id"], Reason: req.Form.Get("reason")}); err != nil {
+                    v.Flash, status = err.Error(), http.StatusConflict
+                    if booking.ErrorCode(err) == "" { v.Flash, status = "cancellation is temporarily unavailable, please try again", http.StatusInternalServerError }
+                } else {
+                    http.Redirect(w, req, "/booking?"+url.Values{"code": {code}}.Encode(), http.StatusSeeOther)
+                    return
+                }
+            }
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            w.WriteHeader(status)
+            _ = templates.PageBooking(v).Render(req.Context(), w)
         })
         RegisterURL("/booking")
     })
 }
+
+// bookingView loads the caller's booking and its charges; problems go into v.Error.
+func bookingView(req *http.Request, code string) (templates.BookingView, int) {
+    var v templates.BookingView
+    if code == "" { v.Error = "No booking selected."; return v, http.StatusOK }
+    if !dbConfigured() || db.Connect(req.Context()) != nil {
+        v.Error = "booking lookup is temporarily unavailable"
+        return v, http.StatusServiceUnavailable
+    }
+    b, err := ownBooking(req, db.Pool(), code)
+    if booking.ErrorCode(err) == booking.CodeNotFound { v.Error = "Booking not found."; return v, http.StatusNotFound }
+    if err != nil { v.Error = "booking lookup is temporarily unavailable"; return v, http.StatusInternalServerError }
+    v.Booking = &b
+    v.Payments, _ = payment.ForBooking(req.Context(), db.Pool(), b.ID)
+    v.Refunds, _ = booking.ListRefunds(req.Context(), db.Pool(), b.ID)
+    v.Change, _ = booking.PendingChange(req.Context(), db.Pool(), b)
+    v.Disruption, _ = booking.OpenDisruption(req.Context(), db.Pool(), b.ID)
+    v.History, _ = booking.History(req.Context(), db.Pool(), b.ID)
+    if p, err := booking.LoadRefundPolicy(req.Context(), db.Pool()); err == nil { v.Policy = p }
+    if prov, err := payment.FromEnv(); err == nil && prov.Name() == "simulator" { v.Simulator = devMode() }
+    return v, http.StatusOK
+}
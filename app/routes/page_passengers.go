@@ -2,16 +2,200 @@ package routes
 
 import (
     "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
     "github.com/go-chi/chi/v5"
     "gothicforge3/app/templates"
+    "gothicforge3/internal/booking"
+    "gothicforge3/internal/db"
 )
 
 func init() {
     RegisterRoute(func(r chi.Router) {
         r.Get("/passengers", func(w http.ResponseWriter, req *http.Request) {
             w.Header().Set("Content-Type", "text/html; charset=utf-8")
-            _ = templates.PagePassengers().Render(req.Context(), w)
+            v := passengersView(req, req.URL.Query().Get("trip"), req.URL.Query().Get("journey") != "")
+            _ = templates.PagePassengers(v).Render(req.Context(), w)
+        })
+
+        // Holding a connecting journey from the search results takes seats on
+        // every leg at once, then continues to the passenger step.
+        r.Post("/journey", func(w http.ResponseWriter, req *http.Request) {
+            _ = req.ParseForm()
+            if !dbConfigured() { renderPassengerError(w, req, http.StatusServiceUnavailable, "database not configured"); return }
+            pool, ok := requireDB(req, w)
+            if !ok { return }
+            jr := journeyFromForm(req.Form)
+            jr.Holder = holderRef(req)
+            if _, err := booking.HoldJourney(req.Context(), pool, jr, booking.HoldTTL()); err != nil {
+                status, msg := http.StatusConflict, err.Error()
+                switch booking.ErrorCode(err) {
+                case booking.CodeInvalid, booking.CodeNotFound:
+                    status = http.StatusBadRequest
+                case booking.CodeSeatUnavailable:
+                default:
+                    status, msg = http.StatusInternalServerError, "booking is temporarily unavailable"
+                }
+                renderPassengerError(w, req, status, msg)
+                return
+            }
+            http.Redirect(w, req, "/passengers?journey=1", http.StatusSeeOther)
+        })
+
+        // Submitting the form checks out the held seats with their passengers.
+        // Validation problems re-render the form fragment in place (HTMX) with inline messages.
+        r.Post("/passengers", func(w http.ResponseWriter, req *http.Request) {
+            _ = req.ParseForm()
+            tripID := strings.TrimSpace(req.Form.Get("trip_id"))
+            journey := req.Form.Get("journey") != ""
+            ps := passengersFromForm(req.Form)
+            contact := booking.Contact{Name: req.Form.Get("contact.name"), Email: req.Form.Get("contact.email"), Phone: req.Form.Get("contact.phone")}
+            promo := booking.NormalizePromoCode(req.Form.Get("promo_code"))
+
+            v := passengersView(req, tripID, journey)
+            v.Passengers, v.Contact, v.PromoCode = ps, contact, promo
+            if v.Error == "" {
+                // Report contact and passenger problems together rather than one at a time.
+                errs := map[string]string{}
+                if err := contact.Validate(); err != nil { mergeFields(errs, err) }
+                if err := booking.ValidatePassengers(ps, time.Now()); err != nil { mergeFields(errs, err) }
+                if len(errs) > 0 {
+                    v.Errors = errs
+                    renderPassengerForm(w, req, v)
+                    return
+                }
+                var b booking.Booking
+                var err error
+                if journey {
+                    b, err = booking.CheckoutJourney(req.Context(), db.Pool(), booking.JourneyCheckoutRequest{Holder: holderRef(req), Contact: contact, Passengers: ps, PromoCode: promo})
+                } else {
+                    seatIDs := make([]string, 0, len(ps))
+                    for _, p := range ps { seatIDs = append(seatIDs, p.SeatID) }
+                    b, err = booking.Checkout(req.Context(), db.Pool(), booking.CheckoutRequest{Holder: holderRef(req), TripID: tripID, SeatIDs: seatIDs, Contact: contact, Passengers: ps, PromoCode: promo})
+                }
+                if err == nil {
+                    to := "/booking?" + url.Values{"code": {b.Code}}.Encode()
+                    if req.Header.Get("HX-Request") != "" {
+                        w.Header().Set("HX-Redirect", to)
+                        w.WriteHeader(http.StatusOK)
+                        return
+                    }
+                    http.Redirect(w, req, to, http.StatusSeeOther)
+                    return
+                }
+                switch booking.ErrorCode(err) {
+                case booking.CodeInvalid:
+                    v.Errors = booking.FieldErrors(err)
+                    if len(v.Errors) == 0 { v.Flash = err.Error() }
+                case booking.CodeHoldExpired:
+                    // Show the seats that are still held so the user can go back and re-pick.
+                    v = passengersView(req, tripID, journey)
+                    v.Passengers, v.Contact, v.PromoCode = ps, contact, promo
+                    v.Flash = err.Error()
+                default:
+                    v.Flash = "checkout is temporarily unavailable, please try again"
+                }
+            }
+            renderPassengerForm(w, req, v)
         })
         RegisterURL("/passengers")
     })
 }
+
+// passengersView loads the caller's held seats on a trip, or on the journey
+// they hold, for the passenger form.
+func passengersView(req *http.Request, tripID string, journey bool) templates.PassengersView {
+    if journey { return journeyPassengersView(req) }
+    v := templates.PassengersView{TripID: strings.TrimSpace(tripID)}
+    if !booking.ValidUUID(v.TripID) { v.TripID = ""; v.Error = "Pick your seats first."; return v }
+    if !dbConfigured() { v.Error = "database not configured"; return v }
+    if err := db.Connect(req.Context()); err != nil { v.Error = "booking is temporarily unavailable"; return v }
+    held, err := booking.ListHolds(req.Context(), db.Pool(), holderRef(req), v.TripID)
+    if err != nil { v.Error = "booking is temporarily unavailable"; return v }
+    if len(held) == 0 { v.Error = "Your seat holds have expired."; return v }
+    trip, _, _, err := booking.GetTrip(req.Context(), db.Pool(), v.TripID, held[0].From, held[0].To)
+    if err != nil {
+        if booking.ErrorCode(err) == booking.CodeNotFound { v.TripID = ""; v.Error = "Trip not found." } else { v.Error = "booking is temporarily unavailable" }
+        return v
+    }
+    v.Trip, v.Held, v.HeldUntil = trip, held, held[0].HeldUntil
+    return v
+}
+
+// journeyPassengersView lists one passenger per seat on the journey's first
+// leg; each traveller keeps the same place on the later legs.
+func journeyPassengersView(req *http.Request) templates.PassengersView {
+    v := templates.PassengersView{Journey: true}
+    if !dbConfigured() { v.Error = "database not configured"; return v }
+    if err := db.Connect(req.Context()); err != nil { v.Error = "booking is temporarily unavailable"; return v }
+    held, err := booking.ListJourneyHold(req.Context(), db.Pool(), holderRef(req))
+    if err != nil { v.Error = "booking is temporarily unavailable"; return v }
+    if len(held) == 0 { v.Error = "Your seat holds have expired."; return v }
+    seen := map[string]bool{}
+    for _, h := range held {
+        if h.TripID == held[0].TripID { v.Held = append(v.Held, h) }
+        if seen[h.TripID] { continue }
+        seen[h.TripID] = true
+        trip, _, _, err := booking.GetTrip(req.Context(), db.Pool(), h.TripID, h.From, h.To)
+        if err != nil { v.Error = "booking is temporarily unavailable"; return v }
+        v.Legs = append(v.Legs, trip)
+    }
+    v.Trip, v.HeldUntil = v.Legs[0], held[0].HeldUntil
+    return v
+}
+
+// journeyFromForm reads pax and legs.<i>.<field> inputs in index order.
+func journeyFromForm(f url.Values) booking.JourneyHoldRequest {
+    jr := booking.JourneyHoldRequest{}
+    jr.Pax, _ = strconv.Atoi(f.Get("pax"))
+    for i := 0; i < booking.MaxJourneyLegs(); i++ {
+        prefix := "legs." + strconv.Itoa(i) + "."
+        if _, ok := f[prefix+"trip_id"]; !ok { break }
+        jr.Legs = append(jr.Legs, booking.JourneyLegRequest{TripID: strings.TrimSpace(f.Get(prefix + "trip_id")), From: f.Get(prefix + "from"), To: f.Get(prefix + "to"), Class: f.Get(prefix + "class")})
+    }
+    return jr
+}
+
+// renderPassengerError shows the passenger page with only a problem and a way back to search.
+func renderPassengerError(w http.ResponseWriter, req *http.Request, status int, msg string) {
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    w.WriteHeader(status)
+    _ = templates.PagePassengers(templates.PassengersView{Error: msg}).Render(req.Context(), w)
+}
+
+// passengersFromForm reads passengers.<i>.<field> inputs in index order.
+func passengersFromForm(f url.Values) []booking.Passenger {
+    var ps []booking.Passenger
+    for i := 0; i < booking.MaxPassengers(); i++ {
+        prefix := "passengers." + strconv.Itoa(i) + "."
+        if _, ok := f[prefix+"seat_id"]; !ok { break }
+        ps = append(ps, booking.Passenger{
+            SeatID:   f.Get(prefix + "seat_id"),
+            Name:     f.Get(prefix + "name"),
+            IDType:   f.Get(prefix + "id_type"),
+            IDNumber: f.Get(prefix + "id_number"),
+            Category: f.Get(prefix + "category"),
+        })
+    }
+    return ps
+}
+
+func mergeFields(dst map[string]string, err error) {
+    fields := booking.FieldErrors(err)
+    if len(fields) == 0 { dst["passengers"] = err.Error(); return }
+    for k, v := range fields { dst[k] = v }
+}
+
+// renderPassengerForm answers HTMX with the form fragment and plain posts with the full page.
+func renderPassengerForm(w http.ResponseWriter, req *http.Request, v templates.PassengersView) {
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    if req.Header.Get("HX-Request") != "" {
+        _ = templates.PassengerForm(v).Render(req.Context(), w)
+        return
+    }
+    w.WriteHeader(http.StatusUnprocessableEntity)
+    _ = templates.PagePassengers(v).Render(req.Context(), w)
+}
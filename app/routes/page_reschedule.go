@@ -0,0 +1,79 @@
+package routes
+
+import (
+    "net/http"
+    "net/url"
+    "time"
+
+    "github.com/go-chi/chi/v5"
+    "gothicforge3/app/templates"
+    "gothicforge3/internal/booking"
+    "gothicforge3/internal/db"
+)
+
+func init() {
+    RegisterRoute(func(r chi.Router) {
+        // Other departures on the booking's route for ?date= (default: its travel date), each priced as a change.
+        r.Get("/booking/reschedule", func(w http.ResponseWriter, req *http.Request) {
+            q := req.URL.Query()
+            v, status := rescheduleView(req, q.Get("code"), q.Get("date"))
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            w.WriteHeader(status)
+            _ = templates.PageReschedule(v).Render(req.Context(), w)
+        })
+
+        // Moving to the chosen departure; a balance to pay is then shown on the booking page.
+        r.Post("/booking/reschedule", func(w http.ResponseWriter, req *http.Request) {
+            _ = req.ParseForm()
+            code := req.Form.Get("code")
+            bv, status := bookingView(req, code)
+            if bv.Booking != nil {
+                _, err := booking.Reschedule(req.Context(), db.Pool(), booking.RescheduleRequest{BookingID: bv.Booking.ID, TripID: req.Form.Get("trip_id"), Reason: req.Form.Get("reason")})
+                if err == nil {
+                    http.Redirect(w, req, "/booking?"+url.Values{"code": {code}}.Encode(), http.StatusSeeOther)
+                    return
+                }
+                v, _ := rescheduleView(req, code, req.Form.Get("date"))
+                v.Flash, status = err.Error(), http.StatusConflict
+                if booking.ErrorCode(err) == "" { v.Flash, status = "changing trains is temporarily unavailable, please try again", http.StatusInternalServerError }
+                w.Header().Set("Content-Type", "text/html; charset=utf-8")
+                w.WriteHeader(status)
+                _ = templates.PageReschedule(v).Render(req.Context(), w)
+                return
+            }
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            w.WriteHeader(status)
+            _ = templates.PageReschedule(templates.RescheduleView{Error: bv.Error}).Render(req.Context(), w)
+        })
+    })
+}
+
+// rescheduleView lists the departures the caller's booking could move to on date.
+func rescheduleView(req *http.Request, code, date string) (templates.RescheduleView, int) {
+    bv, status := bookingView(req, code)
+    v := templates.RescheduleView{Booking: bv.Booking, Disruption: bv.Disruption, Error: bv.Error}
+    b := bv.Booking
+    if b == nil { return v, status }
+    d, err := time.ParseInLocation("2006-01-02", date, time.Local)
+    if err != nil { d, _ = time.ParseInLocation("2006-01-02", b.Trip.ServiceDate, time.Local) }
+    v.Date = d.Format("2006-01-02")
+    pax := 0
+    for _, it := range b.Items {
+        if it.Status == booking.ItemConfirmed { pax++ }
+    }
+    trips, err := booking.Search(req.Context(), db.Pool(), booking.SearchQuery{Origin: b.Trip.Origin, Destination: b.Trip.Destination, Date: d, Passengers: max(pax, 1)})
+    if err != nil { v.Error = "search is temporarily unavailable"; return v, http.StatusInternalServerError }
+    for _, t := range trips {
+        if t.TripID == b.TripID { continue }
+        o := templates.RescheduleOption{Trip: t}
+        c, err := booking.QuoteReschedule(req.Context(), db.Pool(), booking.RescheduleRequest{BookingID: b.ID, TripID: t.TripID})
+        if err != nil {
+            o.Error = err.Error()
+            if booking.ErrorCode(err) == "" { o.Error = "not available" }
+        } else {
+            o.Quote = &c
+        }
+        v.Options = append(v.Options, o)
+    }
+    return v, http.StatusOK
+}
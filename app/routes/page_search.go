@@ -2,16 +2,93 @@ package routes
 
 import (
     "net/http"
+    "strings"
+
+    templ "github.com/a-h/templ"
     "github.com/go-chi/chi/v5"
     "gothicforge3/app/templates"
+    "gothicforge3/internal/booking"
+    "gothicforge3/internal/db"
+    "gothicforge3/internal/env"
 )
 
 func init() {
     RegisterRoute(func(r chi.Router) {
         r.Get("/search", func(w http.ResponseWriter, req *http.Request) {
             w.Header().Set("Content-Type", "text/html; charset=utf-8")
-            _ = templates.PageSearch().Render(req.Context(), w)
+            form := searchFormFrom(req)
+            var stations []booking.Station
+            var results templ.Component
+            if dbConfigured() {
+                if pool, ok := requireDB(req, w); ok {
+                    stations, _ = booking.ListStations(req.Context(), pool)
+                } else {
+                    return
+                }
+                // Pre-render results when the page is opened with a query (non-JS fallback, shared links).
+                if form.From != "" && form.To != "" {
+                    results = searchResults(req)
+                }
+            }
+            _ = templates.PageSearch(form, stations, results).Render(req.Context(), w)
+        })
+
+        // HTMX fragment swapped into #search-results
+        r.Get("/search/results", func(w http.ResponseWriter, req *http.Request) {
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            _ = searchResults(req).Render(req.Context(), w)
+        })
+
+        // HTMX fragment: one result card, reloaded when the seat stream reports a change on its trip.
+        r.Get("/search/trip", func(w http.ResponseWriter, req *http.Request) {
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            q, err := booking.ParseSearchQuery(req.URL.Query())
+            tripID := strings.TrimSpace(req.URL.Query().Get("trip"))
+            if err != nil || !booking.ValidUUID(tripID) { w.WriteHeader(http.StatusBadRequest); return }
+            pool, ok := requireDB(req, w)
+            if !ok { return }
+            trips, err := booking.Search(req.Context(), pool, q)
+            if err != nil { w.WriteHeader(http.StatusInternalServerError); return }
+            for _, t := range trips {
+                if t.TripID == tripID { _ = templates.SearchTripCard(q, t).Render(req.Context(), w); return }
+            }
+            w.WriteHeader(http.StatusNotFound)
         })
         RegisterURL("/search")
     })
 }
+
+func searchFormFrom(req *http.Request) templates.SearchForm {
+    q := req.URL.Query()
+    f := templates.SearchForm{
+        From:  strings.ToUpper(strings.TrimSpace(q.Get("from"))),
+        To:    strings.ToUpper(strings.TrimSpace(q.Get("to"))),
+        Date:  strings.TrimSpace(q.Get("date")),
+        Class: strings.ToLower(strings.TrimSpace(q.Get("class"))),
+        Pax:   1,
+    }
+    if sq, err := booking.ParseSearchQuery(q); err == nil { f.Pax = sq.Passengers }
+    return f
+}
+
+// searchResults runs the search for the request query and returns the results fragment.
+// Connecting journeys are listed after the direct trips; a failure to plan
+// them only hides that section. Validation and database errors are rendered
+// inline so the HTMX swap always succeeds.
+func searchResults(req *http.Request) templ.Component {
+    q, err := booking.ParseJourneyQuery(req.URL.Query())
+    if err != nil { return templates.SearchResults(q.SearchQuery, nil, nil, err.Error()) }
+    if !dbConfigured() { return templates.SearchResults(q.SearchQuery, nil, nil, "database not configured") }
+    if err := db.Connect(req.Context()); err != nil { return templates.SearchResults(q.SearchQuery, nil, nil, "search is temporarily unavailable") }
+    trips, err := booking.Search(req.Context(), db.Pool(), q.SearchQuery)
+    if err != nil { return templates.SearchResults(q.SearchQuery, nil, nil, "search is temporarily unavailable") }
+    var connections []booking.Journey
+    if journeys, err := booking.FindJourneys(req.Context(), db.Pool(), q); err == nil {
+        for _, j := range journeys {
+            if len(j.Legs) > 1 { connections = append(connections, j) }
+        }
+    }
+    return templates.SearchResults(q.SearchQuery, trips, connections, "")
+}
+
+func dbConfigured() bool { return strings.TrimSpace(env.Get("DATABASE_URL", "")) != "" }
@@ -2,16 +2,113 @@ package routes
 
 import (
     "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+
     "github.com/go-chi/chi/v5"
     "gothicforge3/app/templates"
+    "gothicforge3/internal/booking"
+    "gothicforge3/internal/db"
 )
 
 func init() {
     RegisterRoute(func(r chi.Router) {
         r.Get("/seatmap", func(w http.ResponseWriter, req *http.Request) {
             w.Header().Set("Content-Type", "text/html; charset=utf-8")
-            _ = templates.PageSeatmap().Render(req.Context(), w)
+            q := req.URL.Query()
+            v, status := seatmapView(req, q.Get("trip"), q.Get("from"), q.Get("to"), q.Get("class"), q.Get("pax"))
+            w.WriteHeader(status)
+            _ = templates.PageSeatmap(v).Render(req.Context(), w)
+        })
+
+        // HTMX fragment swapped over #seatmap (also polled to pick up other buyers' holds)
+        r.Get("/seatmap/grid", func(w http.ResponseWriter, req *http.Request) {
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            q := req.URL.Query()
+            v, _ := seatmapView(req, q.Get("trip"), q.Get("from"), q.Get("to"), q.Get("class"), q.Get("pax"))
+            _ = templates.SeatmapGrid(v).Render(req.Context(), w)
+        })
+
+        // Clicking a seat toggles the caller's hold on it and returns the refreshed grid.
+        r.Post("/seatmap/seat", func(w http.ResponseWriter, req *http.Request) {
+            _ = req.ParseForm()
+            tripID := strings.TrimSpace(req.Form.Get("trip_id"))
+            from, to := req.Form.Get("from"), req.Form.Get("to")
+            class := req.Form.Get("class")
+            pax := req.Form.Get("pax")
+            flash := toggleSeat(req, tripID, from, to, strings.TrimSpace(req.Form.Get("seat_id")), pax)
+            if req.Header.Get("HX-Request") == "" {
+                http.Redirect(w, req, "/seatmap?"+seatmapQuery(tripID, from, to, class, pax), http.StatusSeeOther)
+                return
+            }
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            v, _ := seatmapView(req, tripID, from, to, class, pax)
+            v.Flash = flash
+            _ = templates.SeatmapGrid(v).Render(req.Context(), w)
         })
         RegisterURL("/seatmap")
     })
 }
+
+// seatmapView loads the seat map of a trip's leg (from/to station codes, empty
+// for the whole trip) for the caller. Problems are carried in the view so pages
+// and fragments always render; the status is for full-page responses.
+func seatmapView(req *http.Request, tripID, from, to, class, pax string) (templates.SeatmapView, int) {
+    v := templates.SeatmapView{Class: strings.ToLower(strings.TrimSpace(class)), Pax: 1}
+    v.From, v.To = strings.ToUpper(strings.TrimSpace(from)), strings.ToUpper(strings.TrimSpace(to))
+    if n, err := strconv.Atoi(strings.TrimSpace(pax)); err == nil && n >= 1 && n <= booking.MaxPassengers() { v.Pax = n }
+    if v.Class != "" && !booking.ValidClass(v.Class) { v.Class = "" }
+    tripID = strings.TrimSpace(tripID)
+    v.Map.TripID = tripID
+    if tripID == "" { v.Error = "Pick a trip first."; return v, http.StatusOK }
+    if !booking.ValidUUID(tripID) { v.Error = "Trip not found."; return v, http.StatusNotFound }
+    if !dbConfigured() { v.Error = "database not configured"; return v, http.StatusServiceUnavailable }
+    if err := db.Connect(req.Context()); err != nil { v.Error = "seat map is temporarily unavailable"; return v, http.StatusServiceUnavailable }
+    m, err := booking.LoadSeatMap(req.Context(), db.Pool(), tripID, v.From, v.To, v.Class, holderRef(req))
+    if booking.ErrorCode(err) == booking.CodeNotFound { v.Error = "Trip not found."; return v, http.StatusNotFound }
+    if booking.ErrorCode(err) == booking.CodeInvalid { v.Error = err.Error(); return v, http.StatusBadRequest }
+    if err != nil { v.Error = "seat map is temporarily unavailable"; return v, http.StatusInternalServerError }
+    v.Map = m
+    return v, http.StatusOK
+}
+
+// toggleSeat releases the seat when the caller already holds it, otherwise holds it
+// (up to pax seats). It returns a message for the user when the seat could not be taken.
+func toggleSeat(req *http.Request, tripID, from, to, seatID, pax string) string {
+    if !booking.ValidUUID(tripID) || !booking.ValidUUID(seatID) { return "Pick a seat on the map." }
+    if !dbConfigured() { return "database not configured" }
+    if err := db.Connect(req.Context()); err != nil { return "seat map is temporarily unavailable" }
+    pool, holder := db.Pool(), holderRef(req)
+    held, err := booking.ListHolds(req.Context(), pool, holder, tripID)
+    if err != nil { return "seat map is temporarily unavailable" }
+    for _, h := range held {
+        if h.SeatID == seatID {
+            if _, err := booking.ReleaseHold(req.Context(), pool, holder, tripID, []string{seatID}); err != nil { return "could not release the seat, please try again" }
+            return ""
+        }
+    }
+    limit, err := strconv.Atoi(strings.TrimSpace(pax))
+    if err != nil || limit < 1 || limit > booking.MaxPassengers() { limit = booking.MaxPassengers() }
+    if len(held) >= limit {
+        return "You have already selected " + strconv.Itoa(len(held)) + " seat(s). Tap a selected seat to free it first."
+    }
+    _, err = booking.PlaceHold(req.Context(), pool, booking.HoldRequest{Holder: holder, TripID: tripID, From: from, To: to, SeatIDs: []string{seatID}}, booking.HoldTTL())
+    switch booking.ErrorCode(err) {
+    case "":
+        if err != nil { return "seat map is temporarily unavailable" }
+        return ""
+    case booking.CodeSeatUnavailable:
+        return "Sorry, that seat was just taken. Please pick another one."
+    default:
+        return err.Error()
+    }
+}
+
+func seatmapQuery(tripID, from, to, class, pax string) string {
+    q := url.Values{}
+    for _, kv := range [][2]string{{"trip", tripID}, {"from", from}, {"to", to}, {"class", class}, {"pax", pax}} {
+        if kv[1] != "" { q.Set(kv[0], kv[1]) }
+    }
+    return q.Encode()
+}
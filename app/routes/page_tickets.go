@@ -0,0 +1,66 @@
+package routes
+
+import (
+    "bytes"
+    "log"
+    "net/http"
+
+    "github.com/go-chi/chi/v5"
+    "gothicforge3/app/templates"
+    "gothicforge3/internal/booking"
+    "gothicforge3/internal/db"
+    "gothicforge3/internal/ticket"
+)
+
+func init() {
+    RegisterRoute(func(r chi.Router) {
+        // Boarding passes (signed QR per passenger) for the caller's paid booking.
+        r.Get("/tickets/{code}", func(w http.ResponseWriter, req *http.Request) {
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            b, tickets, status, msg := loadTickets(req, chi.URLParam(req, "code"))
+            if status != http.StatusOK {
+                w.WriteHeader(status)
+                _ = templates.PageTickets(nil, nil, msg).Render(req.Context(), w)
+                return
+            }
+            w.Header().Set("Cache-Control", "private, no-store")
+            _ = templates.PageTickets(&b, tickets, "").Render(req.Context(), w)
+        })
+
+        // Same passes as a PDF, one A6 page per passenger.
+        r.Get("/tickets/{code}/pdf", func(w http.ResponseWriter, req *http.Request) {
+            b, tickets, status, msg := loadTickets(req, chi.URLParam(req, "code"))
+            if status != http.StatusOK { http.Error(w, msg, status); return }
+            var buf bytes.Buffer
+            if err := ticket.WritePDF(&buf, b, tickets); err != nil {
+                log.Printf("tickets: pdf for %s: %v", b.Code, err)
+                http.Error(w, "could not render tickets", http.StatusInternalServerError)
+                return
+            }
+            w.Header().Set("Content-Type", "application/pdf")
+            w.Header().Set("Content-Disposition", `attachment; filename="eticket-`+b.Code+`.pdf"`)
+            w.Header().Set("Cache-Control", "private, no-store")
+            _, _ = w.Write(buf.Bytes())
+        })
+    })
+}
+
+// loadTickets loads the caller's booking by code and issues its signed tickets.
+func loadTickets(req *http.Request, code string) (booking.Booking, []ticket.Ticket, int, string) {
+    if !dbConfigured() || db.Connect(req.Context()) != nil {
+        return booking.Booking{}, nil, http.StatusServiceUnavailable, "tickets are temporarily unavailable"
+    }
+    b, err := ownBooking(req, db.Pool(), code)
+    if booking.ErrorCode(err) == booking.CodeNotFound || booking.ErrorCode(err) == booking.CodeInvalid {
+        return b, nil, http.StatusNotFound, "Booking not found."
+    }
+    if err != nil { return b, nil, http.StatusInternalServerError, "tickets are temporarily unavailable" }
+    priv, err := ticket.PrivateKeyFromEnv()
+    if err != nil {
+        log.Printf("tickets: %v", err)
+        return b, nil, http.StatusServiceUnavailable, "tickets are temporarily unavailable"
+    }
+    tickets, err := ticket.Issue(priv, b)
+    if err != nil { return b, nil, http.StatusInternalServerError, "tickets are temporarily unavailable" }
+    return b, tickets, http.StatusOK, ""
+}
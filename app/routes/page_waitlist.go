@@ -0,0 +1,79 @@
+package routes
+
+import (
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/go-chi/chi/v5"
+    "gothicforge3/app/templates"
+    "gothicforge3/internal/booking"
+    "gothicforge3/internal/db"
+)
+
+func init() {
+    RegisterRoute(func(r chi.Router) {
+        // The caller's waitlist entries; ?trip=&from=&to=&class=&pax= (from a sold-out class) adds the join form.
+        r.Get("/waitlist", func(w http.ResponseWriter, req *http.Request) {
+            q := req.URL.Query()
+            v, status := waitlistView(req)
+            if v.Error == "" && q.Get("trip") != "" {
+                j := &templates.WaitlistJoin{TripID: q.Get("trip"), From: strings.ToUpper(q.Get("from")), To: strings.ToUpper(q.Get("to")), Class: strings.ToLower(q.Get("class")), Pax: 1}
+                if n, err := strconv.Atoi(q.Get("pax")); err == nil && n >= 1 && n <= booking.MaxPassengers() { j.Pax = n }
+                if t, _, _, err := booking.GetTrip(req.Context(), db.Pool(), j.TripID, j.From, j.To); err == nil && booking.ValidClass(j.Class) {
+                    j.Trip, v.Join = t, j
+                } else {
+                    v.Flash = "That train is not open for the waitlist."
+                }
+            }
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            w.WriteHeader(status)
+            _ = templates.PageWaitlist(v).Render(req.Context(), w)
+        })
+
+        r.Post("/waitlist", func(w http.ResponseWriter, req *http.Request) {
+            _ = req.ParseForm()
+            f := req.Form
+            v, status := waitlistView(req)
+            if v.Error == "" {
+                pax, _ := strconv.Atoi(f.Get("pax"))
+                jr := booking.WaitlistRequest{Holder: holderRef(req), TripID: f.Get("trip_id"), From: f.Get("from"), To: f.Get("to"), Class: f.Get("class"), Seats: pax, Email: f.Get("email")}
+                _, err := booking.JoinWaitlist(req.Context(), db.Pool(), jr)
+                if err == nil {
+                    http.Redirect(w, req, "/waitlist", http.StatusSeeOther)
+                    return
+                }
+                v.Flash, status = err.Error(), http.StatusBadRequest
+                if booking.ErrorCode(err) == "" { v.Flash, status = "the waitlist is temporarily unavailable, please try again", http.StatusInternalServerError }
+                if t, _, _, err := booking.GetTrip(req.Context(), db.Pool(), jr.TripID, jr.From, jr.To); err == nil {
+                    v.Join = &templates.WaitlistJoin{TripID: jr.TripID, From: jr.From, To: jr.To, Class: jr.Class, Pax: max(pax, 1), Trip: t}
+                }
+            }
+            w.Header().Set("Content-Type", "text/html; charset=utf-8")
+            w.WriteHeader(status)
+            _ = templates.PageWaitlist(v).Render(req.Context(), w)
+        })
+
+        r.Post("/waitlist/leave", func(w http.ResponseWriter, req *http.Request) {
+            _ = req.ParseForm()
+            if _, status := waitlistView(req); status == http.StatusOK {
+                _ = booking.LeaveWaitlist(req.Context(), db.Pool(), holderRef(req), req.Form.Get("id"))
+            }
+            http.Redirect(w, req, "/waitlist", http.StatusSeeOther)
+        })
+        RegisterURL("/waitlist")
+    })
+}
+
+// waitlistView loads the caller's entries; problems go into v.Error.
+func waitlistView(req *http.Request) (templates.WaitlistView, int) {
+    var v templates.WaitlistView
+    if !dbConfigured() || db.Connect(req.Context()) != nil {
+        v.Error = "the waitlist is temporarily unavailable"
+        return v, http.StatusServiceUnavailable
+    }
+    entries, err := booking.ListWaitlist(req.Context(), db.Pool(), holderRef(req))
+    if err != nil { v.Error = "the waitlist is temporarily unavailable"; return v, http.StatusInternalServerError }
+    v.Entries = entries
+    return v, http.StatusOK
+}
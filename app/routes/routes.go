@@ -40,7 +40,9 @@ func Register(r *chi.Mux) {
         }
         sub := strings.TrimSpace(req.URL.Query().Get("sub"))
         if sub == "" { sub = "dev" }
-        tok, exp, err := auth.Issue(1*time.Hour, map[string]any{"sub": sub, "role": "dev"})
+        role := strings.TrimSpace(req.URL.Query().Get("role")) // e.g. ?role=admin for the /admin console
+        if role == "" { role = "dev" }
+        tok, exp, err := auth.Issue(1*time.Hour, map[string]any{"sub": sub, "role": role})
         if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
         auth.SetJWTCookie(w, "gf_jwt", tok, exp)
         w.Header().Set("Content-Type", "text/plain; charset=utf-8")
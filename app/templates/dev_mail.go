@@ -0,0 +1,39 @@
+package templates
+
+import (
+    "context"
+    "io"
+
+    templ "github.com/a-h/templ"
+    "gothicforge3/internal/notify"
+)
+
+// DevMailView lists the email previews and which transport sends real mail.
+type DevMailView struct {
+    Previews  []notify.Preview
+    Transport string
+    Flash     string
+}
+
+// DevMail is the dev-only index of every email template rendered with fixture data.
+func DevMail(v DevMailView) templ.Component {
+    body := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        _, _ = io.WriteString(w, "<section class=\"mx-auto max-w-6xl p-4\">")
+        _, _ = io.WriteString(w, "<div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow-xl ring-1 ring-white/10\"><div class=\"card-body\">")
+        _, _ = io.WriteString(w, "<h2 class=\"card-title\">Email previews</h2>")
+        _, _ = io.WriteString(w, "<p class=\"text-sm opacity-70\">Every customer email rendered with fixture data. Mail is sent through <code>"+esc(v.Transport)+"</code>; set SMTP_HOST to deliver to a local catcher such as MailHog.</p>")
+        if v.Flash != "" {
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-info\">"+esc(v.Flash)+"</div>")
+        }
+        _, _ = io.WriteString(w, "<div class=\"overflow-x-auto\"><table class=\"table table-sm\"><thead><tr><th>Template</th><th>Subject</th><th></th></tr></thead><tbody>")
+        for _, p := range v.Previews {
+            _, _ = io.WriteString(w, "<tr><td><a class=\"link\" href=\"/dev/mail/"+esc(p.Name)+"\">"+esc(p.Title)+"</a></td><td>"+esc(p.Message.Subject)+"</td>")
+            _, _ = io.WriteString(w, "<td class=\"whitespace-nowrap\"><a class=\"link text-sm\" href=\"/dev/mail/"+esc(p.Name)+".txt\">text</a> ")
+            _, _ = io.WriteString(w, "<form method=\"post\" action=\"/dev/mail/"+esc(p.Name)+"\" class=\"inline-flex gap-1\"><input class=\"input input-bordered input-xs\" type=\"email\" name=\"to\" value=\""+esc(p.Message.To)+"\" required><button class=\"btn btn-xs\">Send</button></form></td></tr>")
+        }
+        _, _ = io.WriteString(w, "</tbody></table></div>")
+        _, _ = io.WriteString(w, "</div></div></section>")
+        return nil
+    })
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: "Email previews", Description: "Customer email templates", Canonical: "/dev/mail"}).Render(templ.WithChildren(ctx, body), w) })
+}
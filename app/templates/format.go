@@ -0,0 +1,41 @@
+package templates
+
+import (
+  "net/url"
+
+  templ "github.com/a-h/templ"
+)
+
+// esc HTML-escapes user or database supplied text before it is written into markup.
+func esc(s string) string { return templ.EscapeString(s) }
+
+// qs builds an escaped query string for hrefs and hx-get attributes.
+func qs(kv ...string) string {
+  v := url.Values{}
+  for i := 0; i+1 < len(kv); i += 2 {
+    if kv[i+1] != "" { v.Set(kv[i], kv[i+1]) }
+  }
+  return esc(v.Encode())
+}
+
+// fmtRupiah formats an amount in rupiah with dot thousands separators, e.g. Rp150.000.
+func fmtRupiah(v int64) string {
+  s := fmtInt(v)
+  neg := false
+  if len(s) > 0 && s[0] == '-' { neg = true; s = s[1:] }
+  out := make([]byte, 0, len(s)+len(s)/3+3)
+  for i := 0; i < len(s); i++ {
+    if i > 0 && (len(s)-i)%3 == 0 { out = append(out, '.') }
+    out = append(out, s[i])
+  }
+  if neg { return "-Rp" + string(out) }
+  return "Rp" + string(out)
+}
+
+// fmtDuration formats minutes as hours and minutes, e.g. 6h 05m or 40m.
+func fmtDuration(minutes int) string {
+  if minutes < 60 { return fmtInt(int64(minutes)) + "m" }
+  m := fmtInt(int64(minutes % 60))
+  if len(m) < 2 { m = "0" + m }
+  return fmtInt(int64(minutes/60)) + "h " + m + "m"
+}
@@ -0,0 +1,93 @@
+package templates
+
+import (
+    "context"
+    "io"
+    "net/url"
+    "strconv"
+    "time"
+
+    templ "github.com/a-h/templ"
+    "gothicforge3/internal/booking"
+)
+
+// AccountView is the "My bookings" page: a signed-in user's bookings, or the
+// guest lookup form. Code and Email refill the form after a failed lookup.
+type AccountView struct {
+    SignedIn bool
+    Upcoming []booking.Booking
+    Past     []booking.Booking
+    Code     string
+    Email    string
+    Flash    string
+    Error    string
+}
+
+// PageAccountBookings lists upcoming and past bookings with their actions.
+func PageAccountBookings(v AccountView) templ.Component {
+    body := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        _, _ = io.WriteString(w, "<section class=\"mx-auto max-w-6xl p-4 grid gap-6\">")
+        if v.Error != "" {
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-warning\">"+esc(v.Error)+"</div></section>")
+            return nil
+        }
+        if v.SignedIn {
+            writeBookingList(w, "Upcoming trips", v.Upcoming, "No upcoming trips. <a class=\"link\" href=\"/search\">Search trains</a>")
+            writeBookingList(w, "Past and closed bookings", v.Past, "Nothing here yet.")
+        }
+        _, _ = io.WriteString(w, "<div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow ring-1 ring-white/10\"><div class=\"card-body\">")
+        _, _ = io.WriteString(w, "<h2 class=\"card-title\">Find a booking</h2>")
+        if !v.SignedIn {
+            _, _ = io.WriteString(w, "<p class=\"opacity-80\">Booked without signing in? Enter the booking code and the email you gave at checkout. <a class=\"link\" href=\"/auth/github/login\">Sign in</a> to see all your bookings.</p>")
+        } else {
+            _, _ = io.WriteString(w, "<p class=\"opacity-80\">Bookings made before you signed in can be opened with their code and contact email.</p>")
+        }
+        if v.Flash != "" {
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-warning\">"+esc(v.Flash)+"</div>")
+        }
+        _, _ = io.WriteString(w, "<form method=\"post\" action=\"/account/bookings/lookup\" class=\"flex flex-wrap gap-2 items-end\">")
+        _, _ = io.WriteString(w, "<label class=\"form-control\"><span class=\"label-text\">Booking code</span><input class=\"input input-bordered input-sm font-mono uppercase\" name=\"code\" maxlength=\"16\" value=\""+esc(v.Code)+"\" required></label>")
+        _, _ = io.WriteString(w, "<label class=\"form-control\"><span class=\"label-text\">Email</span><input class=\"input input-bordered input-sm\" type=\"email\" name=\"email\" value=\""+esc(v.Email)+"\" required></label>")
+        _, _ = io.WriteString(w, "<button class=\"btn btn-sm btn-primary\">Find booking</button></form>")
+        _, _ = io.WriteString(w, "</div></div></section>")
+        return nil
+    })
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: "My bookings", Description: "Your train bookings", Canonical: "/account/bookings"}).Render(templ.WithChildren(ctx, body), w) })
+}
+
+func writeBookingList(w io.Writer, title string, bs []booking.Booking, empty string) {
+    _, _ = io.WriteString(w, "<div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow ring-1 ring-white/10\"><div class=\"card-body\">")
+    _, _ = io.WriteString(w, "<h2 class=\"card-title\">"+esc(title)+"</h2>")
+    if len(bs) == 0 {
+        _, _ = io.WriteString(w, "<p class=\"opacity-80\">"+empty+"</p></div></div>")
+        return
+    }
+    now := time.Now()
+    _, _ = io.WriteString(w, "<div class=\"overflow-x-auto\"><table class=\"table\"><thead><tr><th>Code</th><th>Trip</th><th>Seats</th><th class=\"text-right\">Total</th><th>Status</th><th></th></tr></thead><tbody>")
+    for _, b := range bs {
+        t := b.Trip
+        seats := 0
+        for _, it := range b.Items {
+            if it.Status == booking.ItemConfirmed { seats++ }
+        }
+        trip := esc(t.TrainName) + " (" + esc(t.TrainCode) + ")"
+        if len(b.Legs) > 1 { trip = plural(int64(len(b.Legs)), "train") }
+        trip += " · " + esc(t.OriginName) + " " + esc(t.Depart) + " → " + esc(t.DestinationName) + " · " + esc(t.ServiceDate)
+        code := url.PathEscape(b.Code)
+        _, _ = io.WriteString(w, "<tr data-code=\""+esc(b.Code)+"\" data-status=\""+esc(b.Status)+"\"><td class=\"font-mono\"><a class=\"link\" href=\"/booking?"+qs("code", b.Code)+"\">"+esc(b.Code)+"</a></td><td>"+trip+"</td><td>"+strconv.Itoa(seats)+"</td><td class=\"text-right\">"+fmtRupiah(b.Total)+"</td><td class=\"capitalize\">"+esc(b.Status)+"</td><td class=\"flex flex-wrap gap-1\">")
+        switch b.Status {
+        case booking.StatusPending:
+            _, _ = io.WriteString(w, "<a class=\"btn btn-xs btn-primary\" href=\"/booking?"+qs("code", b.Code)+"\">Pay</a>")
+        case booking.StatusPaid:
+            if seats > 0 {
+                _, _ = io.WriteString(w, "<a class=\"btn btn-xs\" href=\"/tickets/"+code+"\">E-tickets</a><a class=\"btn btn-xs\" href=\"/tickets/"+code+"/pdf\" download>PDF</a>")
+            }
+            if seats > 0 && b.LastDeparture().After(now) {
+                if len(b.Legs) == 0 { _, _ = io.WriteString(w, "<a class=\"btn btn-xs\" href=\"/booking/reschedule?"+qs("code", b.Code)+"\">Change trip</a>") }
+                _, _ = io.WriteString(w, "<a class=\"btn btn-xs btn-ghost\" href=\"/booking?"+qs("code", b.Code)+"#cancel-panel\">Cancel</a>")
+            }
+        }
+        _, _ = io.WriteString(w, "</td></tr>")
+    }
+    _, _ = io.WriteString(w, "</tbody></table></div></div></div>")
+}
@@ -0,0 +1,433 @@
+package templates
+
+import (
+    "context"
+    "encoding/json"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+
+    templ "github.com/a-h/templ"
+    "gothicforge3/internal/admin"
+    "gothicforge3/internal/booking"
+)
+
+// AdminFormView carries what an edit screen shows around its fields: field
+// errors, a notice after saving, and the row's audit trail.
+type AdminFormView struct {
+    Errors map[string]string
+    Flash  string
+    Error  string
+    Audit  []admin.AuditEntry
+}
+
+// AdminConfirmView asks the operator to type Expected before a destructive
+// action is posted to Action.
+type AdminConfirmView struct {
+    Title    string
+    What     string
+    Expected string
+    Action   string
+    Back     string
+    Reason   bool
+    Rebook   bool
+    Error    string
+}
+
+// AdminTripView is one trip with its occupancy and status controls.
+type AdminTripView struct {
+    Trip      admin.Trip
+    Occupancy admin.Occupancy
+    Paid      int
+    Pending   int
+    Form      AdminFormView
+}
+
+// AdminBookingResult is a looked-up booking with its history.
+type AdminBookingResult struct {
+    Booking booking.Booking
+    History []booking.HistoryEntry
+}
+
+// adminPage wraps a console screen in the layout with the console's tabs.
+func adminPage(title, path string, body func(w io.Writer)) templ.Component {
+    inner := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        _, _ = io.WriteString(w, "<section class=\"mx-auto max-w-6xl p-4 grid gap-4\">")
+        _, _ = io.WriteString(w, "<nav class=\"tabs tabs-boxed\">")
+        for _, t := range [][2]string{{"/admin", "Overview"}, {"/admin/stations", "Stations"}, {"/admin/trains", "Trains"}, {"/admin/routes", "Routes"}, {"/admin/trips", "Trips"}, {"/admin/bookings", "Bookings"}, {"/admin/disruptions", "Disruptions"}, {"/admin/audit", "Audit log"}} {
+            cls := "tab"
+            if t[0] == path || (t[0] != "/admin" && strings.HasPrefix(path, t[0]+"/")) { cls += " tab-active" }
+            _, _ = io.WriteString(w, "<a class=\""+cls+"\" href=\""+t[0]+"\">"+t[1]+"</a>")
+        }
+        _, _ = io.WriteString(w, "</nav>")
+        _, _ = io.WriteString(w, "<div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow ring-1 ring-white/10\"><div class=\"card-body\">")
+        _, _ = io.WriteString(w, "<h2 class=\"card-title\">"+esc(title)+"</h2>")
+        body(w)
+        _, _ = io.WriteString(w, "</div></div></section>")
+        return nil
+    })
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: title + " · Admin", Description: "Operations console", Canonical: path}).Render(templ.WithChildren(ctx, inner), w) })
+}
+
+func writeAdminAlerts(w io.Writer, flash, errMsg string) {
+    if flash != "" { _, _ = io.WriteString(w, "<div role=\"status\" class=\"alert alert-success\">"+esc(flash)+"</div>") }
+    if errMsg != "" { _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-warning\">"+esc(errMsg)+"</div>") }
+}
+
+func writeAdminSearch(w io.Writer, action, q, placeholder, newHref string) {
+    _, _ = io.WriteString(w, "<div class=\"flex flex-wrap gap-2 justify-between\"><form method=\"get\" action=\""+action+"\" class=\"flex gap-2\"><input class=\"input input-bordered input-sm\" type=\"search\" name=\"q\" value=\""+esc(q)+"\" placeholder=\""+esc(placeholder)+"\"><button class=\"btn btn-sm\">Search</button></form>")
+    if newHref != "" { _, _ = io.WriteString(w, "<a class=\"btn btn-sm btn-primary\" href=\""+newHref+"\">New</a>") }
+    _, _ = io.WriteString(w, "</div>")
+}
+
+// AdminHome is the console's landing page with the latest changes.
+func AdminHome(entries []admin.AuditEntry, errMsg string) templ.Component {
+    return adminPage("Operations", "/admin", func(w io.Writer) {
+        writeAdminAlerts(w, "", errMsg)
+        _, _ = io.WriteString(w, "<p class=\"opacity-80\">Edit the network, follow trips and look bookings up. Every change is written to the audit log.</p>")
+        _, _ = io.WriteString(w, "<h3 class=\"font-semibold mt-2\">Latest changes</h3>")
+        writeAuditTable(w, entries)
+    })
+}
+
+// AdminAudit lists the audit log, optionally for one entity.
+func AdminAudit(entity, id string, entries []admin.AuditEntry, errMsg string) templ.Component {
+    return adminPage("Audit log", "/admin/audit", func(w io.Writer) {
+        writeAdminAlerts(w, "", errMsg)
+        _, _ = io.WriteString(w, "<form method=\"get\" action=\"/admin/audit\" class=\"flex flex-wrap gap-2 items-end\">")
+        writeSelectField(w, "entity", "Entity", entity, [][2]string{{"", "All"}, {admin.EntityStation, "Stations"}, {admin.EntityTrain, "Trains"}, {admin.EntityRoute, "Routes"}, {admin.EntityTrip, "Trips"}}, nil)
+        if id != "" { _, _ = io.WriteString(w, "<input type=\"hidden\" name=\"id\" value=\""+esc(id)+"\">") }
+        _, _ = io.WriteString(w, "<button class=\"btn btn-sm\">Filter</button></form>")
+        writeAuditTable(w, entries)
+    })
+}
+
+func writeAuditTable(w io.Writer, entries []admin.AuditEntry) {
+    if len(entries) == 0 {
+        _, _ = io.WriteString(w, "<p class=\"opacity-70\">No changes recorded.</p>")
+        return
+    }
+    _, _ = io.WriteString(w, "<div class=\"overflow-x-auto\"><table class=\"table table-sm\"><thead><tr><th>When</th><th>Who</th><th>Action</th><th>What</th><th>Detail</th></tr></thead><tbody>")
+    for _, e := range entries {
+        detail, _ := json.Marshal(e.Detail)
+        _, _ = io.WriteString(w, "<tr data-action=\""+esc(e.Action)+"\"><td><time datetime=\""+e.CreatedAt.UTC().Format(time.RFC3339)+"\">"+e.CreatedAt.Local().Format("2006-01-02 15:04")+"</time></td><td>"+esc(e.Actor)+"</td><td>"+esc(e.Action)+"</td><td><a class=\"link\" href=\""+adminHref(e.Entity, e.EntityID)+"\">"+esc(e.Entity)+"</a></td><td class=\"font-mono text-xs break-all\">"+esc(string(detail))+"</td></tr>")
+    }
+    _, _ = io.WriteString(w, "</tbody></table></div>")
+}
+
+// adminHref is the edit screen of an audited row.
+func adminHref(entity, id string) string {
+    return "/admin/" + esc(entity) + "s/" + esc(id)
+}
+
+// AdminStations lists stations.
+func AdminStations(q string, list []admin.Station, errMsg string) templ.Component {
+    return adminPage("Stations", "/admin/stations", func(w io.Writer) {
+        writeAdminAlerts(w, "", errMsg)
+        writeAdminSearch(w, "/admin/stations", q, "Code, name or city", "/admin/stations/new")
+        _, _ = io.WriteString(w, "<div class=\"overflow-x-auto\"><table class=\"table table-sm\"><thead><tr><th>Code</th><th>Name</th><th>City</th><th>Active</th></tr></thead><tbody>")
+        for _, s := range list {
+            active := "yes"
+            if !s.Active { active = "<span class=\"badge badge-ghost\">inactive</span>" }
+            _, _ = io.WriteString(w, "<tr><td class=\"font-mono\"><a class=\"link\" href=\"/admin/stations/"+esc(s.ID)+"\">"+esc(s.Code)+"</a></td><td>"+esc(s.Name)+"</td><td>"+esc(s.City)+"</td><td>"+active+"</td></tr>")
+        }
+        _, _ = io.WriteString(w, "</tbody></table></div>")
+    })
+}
+
+// AdminStationForm creates or edits a station.
+func AdminStationForm(s admin.Station, v AdminFormView) templ.Component {
+    title, action := "New station", "/admin/stations"
+    if s.ID != "" { title, action = "Station "+s.Code, "/admin/stations/"+s.ID }
+    return adminPage(title, "/admin/stations/", func(w io.Writer) {
+        writeAdminAlerts(w, v.Flash, v.Error)
+        _, _ = io.WriteString(w, "<form method=\"post\" action=\""+esc(action)+"\" class=\"grid gap-3 md:grid-cols-3\">")
+        writeTextField(w, "code", "Code", s.Code, "text", v.Errors)
+        writeTextField(w, "name", "Name", s.Name, "text", v.Errors)
+        writeTextField(w, "city", "City", s.City, "text", v.Errors)
+        writeTextField(w, "lat", "Latitude", strconv.FormatFloat(s.Lat, 'f', -1, 64), "text", v.Errors)
+        writeTextField(w, "lon", "Longitude", strconv.FormatFloat(s.Lon, 'f', -1, 64), "text", v.Errors)
+        _, _ = io.WriteString(w, "<label class=\"label cursor-pointer justify-start gap-2\"><input type=\"checkbox\" class=\"checkbox\" name=\"active\" value=\"1\""+checkedIf(s.Active)+"><span>Active (offered in search)</span></label>")
+        _, _ = io.WriteString(w, "<div class=\"md:col-span-3 flex gap-2\"><button class=\"btn btn-primary btn-sm\">Save</button>")
+        if s.ID != "" { _, _ = io.WriteString(w, "<a class=\"btn btn-sm btn-ghost text-error\" href=\"/admin/stations/"+esc(s.ID)+"/delete\">Delete…</a>") }
+        _, _ = io.WriteString(w, "</div></form>")
+        writeRowAudit(w, v.Audit)
+    })
+}
+
+// AdminTrains lists trains.
+func AdminTrains(q string, list []admin.Train, errMsg string) templ.Component {
+    return adminPage("Trains", "/admin/trains", func(w io.Writer) {
+        writeAdminAlerts(w, "", errMsg)
+        writeAdminSearch(w, "/admin/trains", q, "Code, name or operator", "/admin/trains/new")
+        _, _ = io.WriteString(w, "<div class=\"overflow-x-auto\"><table class=\"table table-sm\"><thead><tr><th>Code</th><th>Name</th><th>Operator</th><th>Classes</th></tr></thead><tbody>")
+        for _, t := range list {
+            _, _ = io.WriteString(w, "<tr><td class=\"font-mono\"><a class=\"link\" href=\"/admin/trains/"+esc(t.ID)+"\">"+esc(t.Code)+"</a></td><td>"+esc(t.Name)+"</td><td>"+esc(t.Operator)+"</td><td class=\"capitalize\">"+esc(strings.Join(t.Classes, ", "))+"</td></tr>")
+        }
+        _, _ = io.WriteString(w, "</tbody></table></div>")
+    })
+}
+
+// AdminTrainForm creates or edits a train.
+func AdminTrainForm(t admin.Train, v AdminFormView) templ.Component {
+    title, action := "New train", "/admin/trains"
+    if t.ID != "" { title, action = "Train "+t.Code, "/admin/trains/"+t.ID }
+    return adminPage(title, "/admin/trains/", func(w io.Writer) {
+        writeAdminAlerts(w, v.Flash, v.Error)
+        _, _ = io.WriteString(w, "<form method=\"post\" action=\""+esc(action)+"\" class=\"grid gap-3 md:grid-cols-3\">")
+        writeTextField(w, "code", "Code", t.Code, "text", v.Errors)
+        writeTextField(w, "name", "Name", t.Name, "text", v.Errors)
+        writeTextField(w, "operator", "Operator", t.Operator, "text", v.Errors)
+        _, _ = io.WriteString(w, "<fieldset class=\"md:col-span-3 flex flex-wrap gap-4\"><legend class=\"label-text\">Classes</legend>")
+        for _, c := range []string{booking.ClassEconomy, booking.ClassBusiness, booking.ClassExecutive} {
+            on := false
+            for _, x := range t.Classes {
+                if x == c { on = true }
+            }
+            _, _ = io.WriteString(w, "<label class=\"label cursor-pointer gap-2\"><input type=\"checkbox\" class=\"checkbox checkbox-sm\" name=\"classes\" value=\""+c+"\""+checkedIf(on)+"><span class=\"capitalize\">"+c+"</span></label>")
+        }
+        writeFieldError(w, v.Errors["classes"])
+        _, _ = io.WriteString(w, "</fieldset>")
+        _, _ = io.WriteString(w, "<div class=\"md:col-span-3 flex gap-2\"><button class=\"btn btn-primary btn-sm\">Save</button>")
+        if t.ID != "" { _, _ = io.WriteString(w, "<a class=\"btn btn-sm btn-ghost text-error\" href=\"/admin/trains/"+esc(t.ID)+"/delete\">Delete…</a>") }
+        _, _ = io.WriteString(w, "</div></form>")
+        writeRowAudit(w, v.Audit)
+    })
+}
+
+// AdminRoutes lists routes.
+func AdminRoutes(q string, list []admin.Route, errMsg string) templ.Component {
+    return adminPage("Routes", "/admin/routes", func(w io.Writer) {
+        writeAdminAlerts(w, "", errMsg)
+        writeAdminSearch(w, "/admin/routes", q, "Route or station code", "/admin/routes/new")
+        _, _ = io.WriteString(w, "<div class=\"overflow-x-auto\"><table class=\"table table-sm\"><thead><tr><th>Code</th><th>From</th><th>To</th><th class=\"text-right\">Distance</th></tr></thead><tbody>")
+        for _, r := range list {
+            _, _ = io.WriteString(w, "<tr><td class=\"font-mono\"><a class=\"link\" href=\"/admin/routes/"+esc(r.ID)+"\">"+esc(r.Code)+"</a></td><td>"+esc(r.Origin)+"</td><td>"+esc(r.Destination)+"</td><td class=\"text-right\">"+strconv.FormatFloat(r.DistanceKM, 'f', -1, 64)+" km</td></tr>")
+        }
+        _, _ = io.WriteString(w, "</tbody></table></div>")
+    })
+}
+
+// AdminRouteForm creates or edits a route.
+func AdminRouteForm(r admin.Route, v AdminFormView) templ.Component {
+    title, action := "New route", "/admin/routes"
+    if r.ID != "" { title, action = "Route "+r.Code, "/admin/routes/"+r.ID }
+    return adminPage(title, "/admin/routes/", func(w io.Writer) {
+        writeAdminAlerts(w, v.Flash, v.Error)
+        _, _ = io.WriteString(w, "<form method=\"post\" action=\""+esc(action)+"\" class=\"grid gap-3 md:grid-cols-4\">")
+        writeTextField(w, "code", "Code", r.Code, "text", v.Errors)
+        writeTextField(w, "origin", "From (station code)", r.Origin, "text", v.Errors)
+        writeTextField(w, "destination", "To (station code)", r.Destination, "text", v.Errors)
+        writeTextField(w, "distance_km", "Distance (km)", strconv.FormatFloat(r.DistanceKM, 'f', -1, 64), "text", v.Errors)
+        _, _ = io.WriteString(w, "<div class=\"md:col-span-4 flex gap-2\"><button class=\"btn btn-primary btn-sm\">Save</button>")
+        if r.ID != "" { _, _ = io.WriteString(w, "<a class=\"btn btn-sm btn-ghost text-error\" href=\"/admin/routes/"+esc(r.ID)+"/delete\">Delete…</a>") }
+        _, _ = io.WriteString(w, "</div></form>")
+        writeRowAudit(w, v.Audit)
+    })
+}
+
+// AdminConfirm asks the operator to type a code before a destructive action.
+func AdminConfirm(v AdminConfirmView) templ.Component {
+    return adminPage(v.Title, v.Back, func(w io.Writer) {
+        writeAdminAlerts(w, "", v.Error)
+        _, _ = io.WriteString(w, "<p>"+esc(v.What)+"</p>")
+        _, _ = io.WriteString(w, "<form method=\"post\" action=\""+esc(v.Action)+"\" class=\"flex flex-col gap-2 max-w-md\">")
+        if v.Reason { _, _ = io.WriteString(w, "<input type=\"hidden\" name=\"status\" value=\""+admin.TripCancelled+"\"><label class=\"form-control\"><span class=\"label-text\">Reason</span><input class=\"input input-bordered input-sm\" name=\"reason\" maxlength=\"500\" required></label>") }
+        if v.Rebook { _, _ = io.WriteString(w, "<label class=\"label cursor-pointer justify-start gap-2\"><input type=\"checkbox\" class=\"checkbox checkbox-sm\" name=\"rebook\" value=\"1\" checked><span>Move paid passengers to the next departure with seats; otherwise refund them in full</span></label>") }
+        _, _ = io.WriteString(w, "<label class=\"form-control\"><span class=\"label-text\">Type <span class=\"font-mono font-semibold\">"+esc(v.Expected)+"</span> to confirm</span><input class=\"input input-bordered input-sm font-mono\" name=\"confirm\" autocomplete=\"off\" required></label>")
+        _, _ = io.WriteString(w, "<div class=\"flex gap-2\"><button class=\"btn btn-error btn-sm\">"+esc(v.Title)+"</button><a class=\"btn btn-ghost btn-sm\" href=\""+esc(v.Back)+"\">Back</a></div></form>")
+    })
+}
+
+func writeRowAudit(w io.Writer, entries []admin.AuditEntry) {
+    if len(entries) == 0 { return }
+    _, _ = io.WriteString(w, "<details class=\"mt-4\"><summary class=\"cursor-pointer opacity-80\">Changes</summary>")
+    writeAuditTable(w, entries)
+    _, _ = io.WriteString(w, "</details>")
+}
+
+func checkedIf(b bool) string {
+    if b { return " checked" }
+    return ""
+}
+
+// AdminTrips lists trips for a day, a train or a route.
+func AdminTrips(f admin.TripFilter, list []admin.Trip, errMsg string) templ.Component {
+    return adminPage("Trips", "/admin/trips", func(w io.Writer) {
+        writeAdminAlerts(w, "", errMsg)
+        _, _ = io.WriteString(w, "<form method=\"get\" action=\"/admin/trips\" class=\"flex flex-wrap gap-2 items-end\">")
+        writeTextField(w, "date", "Date", f.Date, "date", nil)
+        writeTextField(w, "q", "Train, route or station", f.Q, "search", nil)
+        opts := [][2]string{{"", "Any status"}}
+        for _, s := range admin.TripStatuses() {
+            opts = append(opts, [2]string{s, s})
+        }
+        writeSelectField(w, "status", "Status", f.Status, opts, nil)
+        _, _ = io.WriteString(w, "<button class=\"btn btn-sm\">Search</button></form>")
+        if len(list) == 0 {
+            _, _ = io.WriteString(w, "<p class=\"opacity-70\">No trips match.</p>")
+            return
+        }
+        _, _ = io.WriteString(w, "<div class=\"overflow-x-auto\"><table class=\"table table-sm\"><thead><tr><th>Date</th><th>Train</th><th>Route</th><th>Times</th><th class=\"text-right\">Sold</th><th>Status</th></tr></thead><tbody>")
+        for _, t := range list {
+            _, _ = io.WriteString(w, "<tr data-status=\""+esc(t.Status)+"\"><td>"+esc(t.ServiceDate)+"</td><td><a class=\"link\" href=\"/admin/trips/"+esc(t.ID)+"\">"+esc(t.TrainName)+" ("+esc(t.TrainCode)+")</a></td><td>"+esc(t.Origin)+" → "+esc(t.Destination)+"</td><td>"+esc(t.Depart)+"–"+esc(t.Arrive)+"</td><td class=\"text-right\">"+strconv.Itoa(t.Sold)+" / "+strconv.Itoa(t.Seats)+"</td><td>"+tripStatusBadge(t.Status)+"</td></tr>")
+        }
+        _, _ = io.WriteString(w, "</tbody></table></div>")
+    })
+}
+
+func tripStatusBadge(s string) string {
+    cls := "badge-ghost"
+    switch s {
+    case admin.TripDelayed:
+        cls = "badge-warning"
+    case admin.TripCancelled:
+        cls = "badge-error"
+    case admin.TripDeparted, admin.TripArrived:
+        cls = "badge-info"
+    }
+    return "<span class=\"badge " + cls + "\">" + esc(s) + "</span>"
+}
+
+// AdminTrip shows a trip's occupancy and lets the operator change its status and fare.
+func AdminTrip(v AdminTripView) templ.Component {
+    t := v.Trip
+    return adminPage(t.TrainName+" ("+t.TrainCode+") "+t.ServiceDate, "/admin/trips/", func(w io.Writer) {
+        writeAdminAlerts(w, v.Form.Flash, v.Form.Error)
+        _, _ = io.WriteString(w, "<p>"+esc(t.RouteCode)+" · "+esc(t.Origin)+" "+esc(t.Depart)+" → "+esc(t.Destination)+" "+esc(t.Arrive)+" · "+tripStatusBadge(t.Status)+"</p>")
+        o := v.Occupancy
+        _, _ = io.WriteString(w, "<div class=\"stats stats-vertical md:stats-horizontal bg-base-100\">")
+        _, _ = io.WriteString(w, "<div class=\"stat\"><div class=\"stat-title\">Sold</div><div class=\"stat-value\" data-sold>"+strconv.Itoa(o.Sold)+"</div><div class=\"stat-desc\">of "+strconv.Itoa(o.Seats)+" seats · "+strconv.Itoa(o.Percent())+"%</div></div>")
+        _, _ = io.WriteString(w, "<div class=\"stat\"><div class=\"stat-title\">In carts</div><div class=\"stat-value\">"+strconv.Itoa(o.Held)+"</div></div>")
+        _, _ = io.WriteString(w, "<div class=\"stat\"><div class=\"stat-title\">Bookings</div><div class=\"stat-value\">"+strconv.Itoa(v.Paid)+"</div><div class=\"stat-desc\">paid · "+strconv.Itoa(v.Pending)+" awaiting payment</div></div>")
+        _, _ = io.WriteString(w, "</div>")
+        if len(o.Coaches) > 0 {
+            _, _ = io.WriteString(w, "<div class=\"overflow-x-auto\"><table class=\"table table-sm\"><thead><tr><th>Coach</th><th>Class</th><th class=\"text-right\">Seats</th><th class=\"text-right\">Sold</th><th class=\"text-right\">In carts</th><th class=\"text-right\">Free</th></tr></thead><tbody>")
+            for _, c := range o.Coaches {
+                _, _ = io.WriteString(w, "<tr data-coach=\""+strconv.Itoa(c.CoachNo)+"\"><td>"+strconv.Itoa(c.CoachNo)+"</td><td class=\"capitalize\">"+esc(c.Class)+"</td><td class=\"text-right\">"+strconv.Itoa(c.Seats)+"</td><td class=\"text-right\">"+strconv.Itoa(c.Sold)+"</td><td class=\"text-right\">"+strconv.Itoa(c.Held)+"</td><td class=\"text-right\">"+strconv.Itoa(c.Free())+"</td></tr>")
+            }
+            _, _ = io.WriteString(w, "</tbody></table></div>")
+        }
+        _, _ = io.WriteString(w, "<div class=\"grid gap-4 md:grid-cols-2\">")
+        var next [][2]string
+        cancellable := false
+        for _, s := range admin.NextStatuses(t.Status) {
+            if s == admin.TripCancelled { cancellable = true; continue }
+            next = append(next, [2]string{s, s})
+        }
+        if len(next) > 0 {
+            _, _ = io.WriteString(w, "<form method=\"post\" action=\"/admin/trips/"+esc(t.ID)+"/status\" class=\"flex flex-wrap gap-2 items-end\">")
+            writeSelectField(w, "status", "Change status", "", next, v.Form.Errors)
+            writeTextField(w, "delay_minutes", "Delay (minutes, when delayed)", "", "number", v.Form.Errors)
+            writeTextField(w, "reason", "Reason", "", "text", v.Form.Errors)
+            _, _ = io.WriteString(w, "<button class=\"btn btn-sm\">Update</button></form>")
+        }
+        _, _ = io.WriteString(w, "<form method=\"post\" action=\"/admin/trips/"+esc(t.ID)+"/price\" class=\"flex flex-wrap gap-2 items-end\">")
+        writeTextField(w, "base_price", "Base fare (Rp)", strconv.FormatInt(t.BasePrice, 10), "number", v.Form.Errors)
+        _, _ = io.WriteString(w, "<button class=\"btn btn-sm\">Save fare</button></form>")
+        _, _ = io.WriteString(w, "</div>")
+        if cancellable { _, _ = io.WriteString(w, "<div><a class=\"btn btn-sm btn-error\" href=\"/admin/trips/"+esc(t.ID)+"/cancel\">Cancel trip…</a></div>") }
+        if (t.Status == admin.TripDelayed || t.Status == admin.TripCancelled) && v.Paid+v.Pending > 0 {
+            _, _ = io.WriteString(w, "<form method=\"post\" action=\"/admin/trips/"+esc(t.ID)+"/disrupt\" class=\"flex flex-wrap gap-2 items-end\" data-disrupt>")
+            if t.Status == admin.TripDelayed {
+                writeTextField(w, "delay_minutes", "Delay (minutes)", "", "number", v.Form.Errors)
+            } else {
+                _, _ = io.WriteString(w, "<label class=\"label cursor-pointer gap-2\"><input type=\"checkbox\" class=\"checkbox checkbox-sm\" name=\"rebook\" value=\"1\" checked><span>Rebook onto the next departure</span></label>")
+            }
+            writeTextField(w, "reason", "Reason", "", "text", v.Form.Errors)
+            _, _ = io.WriteString(w, "<button class=\"btn btn-sm btn-warning\">Handle remaining passengers</button></form>")
+        }
+        _, _ = io.WriteString(w, "<p><a class=\"link text-sm\" href=\"/admin/disruptions?"+qs("trip", t.ID)+"\">Disruption reports for this trip</a></p>")
+        writeRowAudit(w, v.Form.Audit)
+    })
+}
+
+// AdminBookings looks bookings up by code or passenger ID number.
+func AdminBookings(q string, results []AdminBookingResult, errMsg string) templ.Component {
+    return adminPage("Bookings", "/admin/bookings", func(w io.Writer) {
+        writeAdminAlerts(w, "", errMsg)
+        writeAdminSearch(w, "/admin/bookings", q, "Booking code or passenger ID", "")
+        if q != "" && errMsg == "" && len(results) == 0 { _, _ = io.WriteString(w, "<p class=\"opacity-70\">No booking matches.</p>") }
+        for _, r := range results {
+            b := r.Booking
+            t := b.Trip
+            _, _ = io.WriteString(w, "<article class=\"border border-white/10 rounded-box p-4 grid gap-2\" data-booking=\""+esc(b.Code)+"\">")
+            _, _ = io.WriteString(w, "<div class=\"flex flex-wrap justify-between gap-2\"><h3 class=\"font-mono font-semibold\">"+esc(b.Code)+"</h3><span class=\"badge\">"+esc(b.Status)+"</span></div>")
+            _, _ = io.WriteString(w, "<p>"+esc(t.TrainName)+" ("+esc(t.TrainCode)+") · "+esc(t.OriginName)+" "+esc(t.Depart)+" → "+esc(t.DestinationName)+" · "+esc(t.ServiceDate)+"</p>")
+            _, _ = io.WriteString(w, "<p class=\"text-sm opacity-80\">"+esc(b.Contact.Name)+" · "+esc(b.Contact.Email)+" · "+esc(b.Contact.Phone)+" · "+fmtRupiah(b.Total))
+            if b.Refunded > 0 { _, _ = io.WriteString(w, " · refunded "+fmtRupiah(b.Refunded)) }
+            _, _ = io.WriteString(w, "</p><table class=\"table table-xs\"><tbody>")
+            for _, it := range b.Items {
+                who := ""
+                if p := it.Passenger; p != nil { who = esc(p.Name) + " · " + esc(p.IDType) + " " + esc(p.IDNumber) }
+                _, _ = io.WriteString(w, "<tr><td>"+esc(b.TripOf(it.TripID).TrainCode)+"</td><td>Coach "+strconv.Itoa(it.CoachNo)+" · "+esc(it.SeatNo)+"</td><td>"+who+"</td><td>"+esc(it.Status)+"</td></tr>")
+            }
+            _, _ = io.WriteString(w, "</tbody></table>")
+            writeHistory(w, r.History)
+            _, _ = io.WriteString(w, "</article>")
+        }
+    })
+}
+
+// AdminDisruptions lists the latest disruption runs.
+func AdminDisruptions(list []booking.Disruption, errMsg string) templ.Component {
+    return adminPage("Disruptions", "/admin/disruptions", func(w io.Writer) {
+        writeAdminAlerts(w, "", errMsg)
+        _, _ = io.WriteString(w, "<p class=\"opacity-80\">Each time a trip is delayed or cancelled its bookings are handled and reported here.</p>")
+        if len(list) == 0 {
+            _, _ = io.WriteString(w, "<p class=\"opacity-70\">No disruptions yet.</p>")
+            return
+        }
+        _, _ = io.WriteString(w, "<div class=\"overflow-x-auto\"><table class=\"table table-sm\"><thead><tr><th>When</th><th>Trip</th><th>What</th><th>By</th><th>Reason</th></tr></thead><tbody>")
+        for _, d := range list {
+            _, _ = io.WriteString(w, "<tr data-kind=\""+esc(d.Kind)+"\"><td><a class=\"link\" href=\"/admin/disruptions/"+esc(d.ID)+"\">"+d.CreatedAt.Local().Format("2006-01-02 15:04")+"</a></td><td>"+esc(d.Trip.TrainCode)+" · "+esc(d.Trip.ServiceDate)+" "+esc(d.Trip.Depart)+"</td><td>"+esc(disruptionText(d.Kind, d.DelayMinutes))+"</td><td>"+esc(d.Actor)+"</td><td>"+esc(d.Reason)+"</td></tr>")
+        }
+        _, _ = io.WriteString(w, "</tbody></table></div>")
+    })
+}
+
+// AdminDisruption is the report of one run: where every booking's
+// passengers ended up.
+func AdminDisruption(d booking.Disruption) templ.Component {
+    t := d.Trip
+    return adminPage(t.TrainName+" ("+t.TrainCode+") "+disruptionText(d.Kind, d.DelayMinutes), "/admin/disruptions/", func(w io.Writer) {
+        state := "Finished " + d.CreatedAt.Local().Format("2006-01-02 15:04")
+        if d.FinishedAt == nil { state = "Did not finish; handle the remaining passengers from the trip page" }
+        _, _ = io.WriteString(w, "<p>"+esc(t.OriginName)+" "+esc(t.Depart)+" → "+esc(t.DestinationName)+" "+esc(t.Arrive)+" · "+esc(t.ServiceDate)+" · "+tripStatusBadge(t.Status)+"</p>")
+        _, _ = io.WriteString(w, "<p class=\"text-sm opacity-80\">"+esc(state)+" · by "+esc(d.Actor))
+        if d.Reason != "" { _, _ = io.WriteString(w, " · "+esc(d.Reason)) }
+        _, _ = io.WriteString(w, "</p>")
+        sum := d.Summary()
+        _, _ = io.WriteString(w, "<div class=\"stats stats-vertical md:stats-horizontal bg-base-100\">")
+        for _, o := range [][2]string{{booking.OutcomeMoved, "Moved"}, {booking.OutcomeRefunded, "Refunded"}, {booking.OutcomeCancelled, "Cancelled unpaid"}, {booking.OutcomeNotified, "Notified"}, {booking.OutcomeFailed, "Failed"}} {
+            if sum[o[0]] == 0 && o[0] != booking.OutcomeMoved && o[0] != booking.OutcomeRefunded { continue }
+            _, _ = io.WriteString(w, "<div class=\"stat\" data-outcome=\""+o[0]+"\"><div class=\"stat-title\">"+o[1]+"</div><div class=\"stat-value\">"+strconv.Itoa(sum[o[0]])+"</div><div class=\"stat-desc\">passengers</div></div>")
+        }
+        _, _ = io.WriteString(w, "</div>")
+        _, _ = io.WriteString(w, "<p><a class=\"btn btn-sm\" href=\"/admin/disruptions/"+esc(d.ID)+"/report.csv\" download>Download CSV</a> <a class=\"btn btn-sm btn-ghost\" href=\"/admin/trips/"+esc(d.TripID)+"\">Back to trip</a></p>")
+        if len(d.Bookings) == 0 {
+            _, _ = io.WriteString(w, "<p class=\"opacity-70\">No bookings were on the trip.</p>")
+            return
+        }
+        _, _ = io.WriteString(w, "<div class=\"overflow-x-auto\"><table class=\"table table-sm\"><thead><tr><th>Booking</th><th>Passengers</th><th>Outcome</th><th>New train</th><th class=\"text-right\">Refund</th><th>Notified</th></tr></thead><tbody>")
+        for _, b := range d.Bookings {
+            var pax []string
+            for _, p := range b.Passengers {
+                pax = append(pax, esc(p.Name)+" <span class=\"opacity-70\">"+strconv.Itoa(p.CoachNo)+"·"+esc(p.SeatNo)+"</span>")
+            }
+            outcome := esc(b.Outcome)
+            if b.Error != "" { outcome += "<div class=\"text-xs text-error\">" + esc(b.Error) + "</div>" }
+            if b.OfferUntil != nil { outcome += "<div class=\"text-xs opacity-70\">offer open until " + b.OfferUntil.Local().Format("02 Jan 15:04") + "</div>" }
+            train := "—"
+            if b.NewTripID != "" {
+                train = "<a class=\"link\" href=\"/admin/trips/" + esc(b.NewTripID) + "\">" + esc(b.NewTrain) + "</a>"
+                if b.NewDeparture != nil { train += " " + b.NewDeparture.Local().Format("2006-01-02 15:04") }
+            }
+            notified := "no"
+            if b.Notified { notified = "yes" }
+            _, _ = io.WriteString(w, "<tr data-outcome=\""+esc(b.Outcome)+"\"><td><a class=\"link font-mono\" href=\"/admin/bookings?"+qs("q", b.Code)+"\">"+esc(b.Code)+"</a><div class=\"text-xs opacity-70\">"+esc(b.Contact.Name)+" · "+esc(b.Contact.Email)+"</div></td><td>"+strings.Join(pax, "<br>")+"</td><td>"+outcome+"</td><td>"+train+"</td><td class=\"text-right\">"+fmtRupiah(b.Refund)+"</td><td>"+notified+"</td></tr>")
+        }
+        _, _ = io.WriteString(w, "</tbody></table></div>")
+    })
+}
@@ -3,18 +3,356 @@ package templates
 import (
     "context"
     "io"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
     templ "github.com/a-h/templ"
+    "gothicforge3/internal/booking"
+    "gothicforge3/internal/payment"
 )
 
-func PageBooking() templ.Component {
+// BookingView is one booking shown to its owner with its payment charges (newest first),
+// its refunds, the refund policy that prices a cancellation, a trip change
+// waiting for payment, an open offer after its train was delayed or
+// cancelled and the history of everything that happened to it.
+// Simulator enables the dev-only buttons that fake gateway callbacks.
+type BookingView struct {
+    Booking    *booking.Booking
+    Payments   []payment.Payment
+    Refunds    []booking.Refund
+    Policy     booking.RefundPolicy
+    Change     *booking.Change
+    Disruption *booking.DisruptionOffer
+    History    []booking.HistoryEntry
+    Simulator  bool
+    Flash      string
+    Error      string
+}
+
+// PageBooking shows one booking to its owner; v.Error replaces it when it cannot be shown.
+func PageBooking(v BookingView) templ.Component {
     body := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
         _, _ = io.WriteString(w, "<section class=\"mx-auto max-w-6xl p-4\">")
         _, _ = io.WriteString(w, "<div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow-xl ring-1 ring-white/10\">")
         _, _ = io.WriteString(w, "<div class=\"card-body\">")
-        _, _ = io.WriteString(w, "<h2 class=\"card-title\">Booking</h2>")
-        _, _ = io.WriteString(w, "<p class=\"opacity-80\">Scaffolded page. Edit at app/templates/page_booking.go</p>")
-        _, _ = io.WriteString(w, "</div></div></section>")
+        b := v.Booking
+        if b == nil {
+            _, _ = io.WriteString(w, "<h2 class=\"card-title\">Booking</h2>")
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-warning\">"+esc(v.Error)+"</div>")
+            _, _ = io.WriteString(w, "</div></div></section>")
+            return nil
+        }
+        t := b.Trip
+        _, _ = io.WriteString(w, "<h2 class=\"card-title\">Booking <span class=\"font-mono\">"+esc(b.Code)+"</span></h2>")
+        if len(b.Legs) > 0 {
+            _, _ = io.WriteString(w, "<ol class=\"opacity-80 list-decimal list-inside\">")
+            for _, l := range b.Legs {
+                lt := l.Trip
+                _, _ = io.WriteString(w, "<li data-trip=\""+esc(l.TripID)+"\">"+esc(lt.TrainName)+" ("+esc(lt.TrainCode)+") · "+esc(lt.OriginName)+" "+esc(lt.Depart)+" → "+esc(lt.DestinationName)+" "+esc(lt.Arrive)+" · "+esc(lt.ServiceDate)+"</li>")
+            }
+            _, _ = io.WriteString(w, "</ol>")
+        } else {
+            _, _ = io.WriteString(w, "<p class=\"opacity-80\">"+esc(t.TrainName)+" ("+esc(t.TrainCode)+") · "+esc(t.OriginName)+" "+esc(t.Depart)+" → "+esc(t.DestinationName)+" "+esc(t.Arrive)+" · "+esc(t.ServiceDate)+"</p>")
+        }
+        _, _ = io.WriteString(w, "<div class=\"overflow-x-auto\"><table class=\"table\"><thead><tr><th>Seat</th><th>Class</th><th>Passenger</th><th>ID</th><th class=\"text-right\">Price</th></tr></thead><tbody>")
+        for _, it := range b.Items {
+            // Seats held for a trip change that was dropped never belonged to the booking.
+            if b.Status == booking.StatusPaid && (it.Status == booking.ItemReleased || it.Status == booking.ItemExpired) { continue }
+            name, id := "—", "—"
+            if p := it.Passenger; p != nil {
+                name = esc(p.Name)
+                if p.Category != booking.CategoryAdult { name += " <span class=\"badge badge-sm\">"+esc(p.Category)+"</span>" }
+                id = esc(strings.ToUpper(p.IDType)) + " " + esc(maskID(p.IDNumber))
+            }
+            train := ""
+            if len(b.Legs) > 0 { train = esc(b.TripOf(it.TripID).TrainCode) + " · " }
+            if it.Status == booking.ItemCancelled {
+                name += " <span class=\"badge badge-sm badge-ghost\">cancelled</span>"
+                if it.Refund > 0 { name += " <span class=\"text-xs opacity-70\">refund "+fmtRupiah(it.Refund)+"</span>" }
+            }
+            switch {
+            case it.Status == booking.ItemRescheduled:
+                name += " <span class=\"badge badge-sm badge-ghost\">changed</span>"
+            case it.Status == booking.ItemHeld && b.Status == booking.StatusPaid:
+                name += " <span class=\"badge badge-sm badge-warning\">awaiting payment</span>"
+            }
+            _, _ = io.WriteString(w, "<tr data-status=\""+esc(it.Status)+"\"><td>"+train+"Coach "+strconv.Itoa(it.CoachNo)+" · "+esc(it.SeatNo)+"</td><td class=\"capitalize\">"+esc(it.Class)+"</td><td>"+name+"</td><td class=\"font-mono\">"+id+"</td><td class=\"text-right\">"+fmtRupiah(it.Price)+fareLines(it.Fare)+"</td></tr>")
+        }
+        _, _ = io.WriteString(w, "</tbody><tfoot>")
+        if b.Discount > 0 {
+            _, _ = io.WriteString(w, "<tr data-promo=\""+esc(b.PromoCode)+"\"><td colspan=\"4\">Promo <span class=\"font-mono\">"+esc(b.PromoCode)+"</span></td><td class=\"text-right\">"+fmtRupiah(-b.Discount)+"</td></tr>")
+        }
+        _, _ = io.WriteString(w, "<tr><th colspan=\"4\">Total</th><th class=\"text-right\">"+fmtRupiah(b.Total)+"</th></tr>")
+        if b.Refunded > 0 {
+            _, _ = io.WriteString(w, "<tr data-refunded><td colspan=\"4\">Refund for cancelled seats</td><td class=\"text-right\">"+fmtRupiah(-b.Refunded)+"</td></tr>")
+        }
+        _, _ = io.WriteString(w, "</tfoot></table></div>")
+        _, _ = io.WriteString(w, "<p class=\"opacity-80\">Confirmation goes to "+esc(b.Contact.Email)+".</p>")
+        _, _ = io.WriteString(w, "</div></div>")
+        writeDisruptionPanel(w, v)
+        _, _ = io.WriteString(w, "<div class=\"mt-6\">")
+        if err := PaymentPanel(v).Render(ctx, w); err != nil { return err }
+        _, _ = io.WriteString(w, "</div>")
+        writeChangePanel(w, v)
+        writeCancelPanel(w, v)
+        writeHistory(w, v.History)
+        _, _ = io.WriteString(w, "</section>")
+        return nil
+    })
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: "Booking", Description: "Your booking", Canonical: "/booking"}).Render(templ.WithChildren(ctx, body), w) })
+}
+
+// PaymentPanel is the HTMX-swappable payment step. While the booking is pending it
+// polls /booking/payment, which answers 204 until the webhook changes the status.
+func PaymentPanel(v BookingView) templ.Component {
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        b := v.Booking
+        if b == nil { return nil }
+        _, _ = io.WriteString(w, "<div id=\"payment-panel\" class=\"card bg-base-200/60 border border-white/10 rounded-box shadow ring-1 ring-white/10\" data-status=\""+esc(b.Status)+"\"><div class=\"card-body\">")
+        if v.Flash != "" {
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-warning\">"+esc(v.Flash)+"</div>")
+        }
+        switch b.Status {
+        case booking.StatusPaid:
+            _, _ = io.WriteString(w, "<div role=\"status\" class=\"alert alert-success\"><span>Paid. Have a good trip!</span><span class=\"flex gap-2\"><a class=\"btn btn-sm\" href=\"/tickets/"+url.PathEscape(b.Code)+"\">View e-tickets</a><a class=\"btn btn-sm btn-primary\" href=\"/tickets/"+url.PathEscape(b.Code)+"/pdf\" download>Download PDF</a></span></div>")
+        case booking.StatusExpired:
+            _, _ = io.WriteString(w, "<div role=\"status\" class=\"alert alert-warning\">The payment deadline passed and the seats were released. <a class=\"link\" href=\"/search\">Search again</a></div>")
+        case booking.StatusCancelled:
+            _, _ = io.WriteString(w, "<div role=\"status\" class=\"alert\">This booking was cancelled and its seats were released. <a class=\"link\" href=\"/search\">Search again</a></div>")
+        case booking.StatusPending:
+            writePendingPayment(w, v)
+        default:
+            _, _ = io.WriteString(w, "<p>Status: "+esc(b.Status)+"</p>")
+        }
+        _, _ = io.WriteString(w, "</div></div>")
         return nil
     })
-    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: "Booking", Description: "Booking page", Canonical: "/booking"}).Render(templ.WithChildren(ctx, body), w) })
+}
+
+func writePendingPayment(w io.Writer, v BookingView) {
+    b := v.Booking
+    _, _ = io.WriteString(w, "<h3 class=\"card-title\">Payment</h3>")
+    _, _ = io.WriteString(w, "<span hidden hx-get=\"/booking/payment?"+qs("code", b.Code, "wait", b.Status)+"\" hx-trigger=\"every 5s\" hx-target=\"#payment-panel\" hx-swap=\"outerHTML\"></span>")
+    if b.PaymentDueAt != nil {
+        _, _ = io.WriteString(w, "<p>Pay "+fmtRupiah(b.Total)+" before <time datetime=\""+b.PaymentDueAt.UTC().Format(time.RFC3339)+"\">"+b.PaymentDueAt.Local().Format("15:04")+"</time> or the seats are released.</p>")
+    }
+    var cur *payment.Payment
+    for i := range v.Payments {
+        if v.Payments[i].Status == payment.StatusPending { cur = &v.Payments[i]; break }
+    }
+    if cur != nil {
+        _, _ = io.WriteString(w, "<div class=\"stat bg-base-100 rounded-box\">")
+        if cur.Method == payment.MethodQRIS {
+            _, _ = io.WriteString(w, "<div class=\"stat-title\">QRIS</div><div class=\"stat-desc\">Scan with any bank or e-wallet app</div><code class=\"break-all text-xs\" data-qris>"+esc(cur.QRString)+"</code>")
+        } else {
+            _, _ = io.WriteString(w, "<div class=\"stat-title uppercase\">"+esc(cur.Bank)+" virtual account</div><div class=\"stat-value font-mono text-2xl\" data-va>"+esc(cur.VANumber)+"</div>")
+        }
+        _, _ = io.WriteString(w, "<div class=\"stat-desc\">Amount "+fmtRupiah(cur.Amount)+"</div></div>")
+        if v.Simulator {
+            _, _ = io.WriteString(w, "<form method=\"post\" action=\"/dev/pay\" class=\"flex gap-2\"><input type=\"hidden\" name=\"external_id\" value=\""+esc(cur.ExternalID)+"\">")
+            _, _ = io.WriteString(w, "<button class=\"btn btn-sm btn-success\" name=\"status\" value=\""+payment.StatusPaid+"\">Simulate payment</button><button class=\"btn btn-sm\" name=\"status\" value=\""+payment.StatusExpired+"\">Simulate expiry</button></form>")
+        }
+    }
+    _, _ = io.WriteString(w, "<form method=\"post\" action=\"/booking/pay\" hx-post=\"/booking/pay\" hx-target=\"#payment-panel\" hx-swap=\"outerHTML\" class=\"flex flex-wrap gap-2 items-end\">")
+    _, _ = io.WriteString(w, "<input type=\"hidden\" name=\"code\" value=\""+esc(b.Code)+"\">")
+    _, _ = io.WriteString(w, "<button class=\"btn\" name=\"method\" value=\""+payment.MethodQRIS+"\">QRIS</button>")
+    for _, bank := range payment.Banks {
+        _, _ = io.WriteString(w, "<button class=\"btn\" name=\"va\" value=\""+bank+"\">"+strings.ToUpper(bank)+" VA</button>")
+    }
+    _, _ = io.WriteString(w, "</form>")
+}
+
+// writeChangePanel shows a trip change waiting for its balance with the ways
+// to pay it, or offers to change trains while the booking can still move.
+func writeChangePanel(w io.Writer, v BookingView) {
+    b, c := v.Booking, v.Change
+    if c == nil {
+        if v.Disruption != nil { return }
+        live := 0
+        for _, it := range b.Items {
+            if it.Status == booking.ItemConfirmed { live++ }
+        }
+        if b.Status == booking.StatusPaid && len(b.Legs) == 0 && live > 0 && b.Trip.Departure().After(time.Now()) {
+            _, _ = io.WriteString(w, "<p class=\"mt-4\"><a class=\"btn btn-sm\" href=\"/booking/reschedule?"+qs("code", b.Code)+"\">Change trip</a></p>")
+        }
+        return
+    }
+    t := c.Trip
+    _, _ = io.WriteString(w, "<div id=\"change-panel\" class=\"mt-6 card bg-base-200/60 border border-white/10 rounded-box shadow ring-1 ring-white/10\" data-change=\""+esc(c.ID)+"\"><div class=\"card-body\">")
+    _, _ = io.WriteString(w, "<h3 class=\"card-title\">Trip change</h3>")
+    _, _ = io.WriteString(w, "<p>New train: "+esc(t.TrainName)+" ("+esc(t.TrainCode)+") · "+esc(t.OriginName)+" "+esc(t.Depart)+" → "+esc(t.DestinationName)+" "+esc(t.Arrive)+" · "+esc(t.ServiceDate)+"</p>")
+    _, _ = io.WriteString(w, "<p>Fare difference "+fmtRupiah(c.FareDifference)+" + change fee "+fmtRupiah(c.Fee)+" = <strong>"+fmtRupiah(c.Balance)+"</strong>")
+    if c.DueAt != nil {
+        _, _ = io.WriteString(w, ", due by <time datetime=\""+c.DueAt.UTC().Format(time.RFC3339)+"\">"+c.DueAt.Local().Format("15:04")+"</time>. Until then your current seats stay booked")
+    }
+    _, _ = io.WriteString(w, ".</p>")
+    for _, cur := range v.Payments {
+        if cur.ChangeID != c.ID || cur.Status != payment.StatusPending { continue }
+        _, _ = io.WriteString(w, "<div class=\"stat bg-base-100 rounded-box\">")
+        if cur.Method == payment.MethodQRIS {
+            _, _ = io.WriteString(w, "<div class=\"stat-title\">QRIS</div><code class=\"break-all text-xs\" data-qris>"+esc(cur.QRString)+"</code>")
+        } else {
+            _, _ = io.WriteString(w, "<div class=\"stat-title uppercase\">"+esc(cur.Bank)+" virtual account</div><div class=\"stat-value font-mono text-2xl\" data-va>"+esc(cur.VANumber)+"</div>")
+        }
+        _, _ = io.WriteString(w, "<div class=\"stat-desc\">Amount "+fmtRupiah(cur.Amount)+"</div></div>")
+        if v.Simulator {
+            _, _ = io.WriteString(w, "<form method=\"post\" action=\"/dev/pay\" class=\"flex gap-2\"><input type=\"hidden\" name=\"external_id\" value=\""+esc(cur.ExternalID)+"\">")
+            _, _ = io.WriteString(w, "<button class=\"btn btn-sm btn-success\" name=\"status\" value=\""+payment.StatusPaid+"\">Simulate payment</button></form>")
+        }
+        break
+    }
+    _, _ = io.WriteString(w, "<form method=\"post\" action=\"/booking/pay\" class=\"flex flex-wrap gap-2 items-end\">")
+    _, _ = io.WriteString(w, "<input type=\"hidden\" name=\"code\" value=\""+esc(b.Code)+"\"><input type=\"hidden\" name=\"change\" value=\"1\">")
+    _, _ = io.WriteString(w, "<button class=\"btn\" name=\"method\" value=\""+payment.MethodQRIS+"\">QRIS</button>")
+    for _, bank := range payment.Banks {
+        _, _ = io.WriteString(w, "<button class=\"btn\" name=\"va\" value=\""+bank+"\">"+strings.ToUpper(bank)+" VA</button>")
+    }
+    _, _ = io.WriteString(w, "</form>")
+    _, _ = io.WriteString(w, "<p class=\"text-sm opacity-70\"><a class=\"link\" href=\"/booking/reschedule?"+qs("code", b.Code)+"\">Choose another train instead</a></p>")
+    _, _ = io.WriteString(w, "</div></div>")
+}
+
+// writeHistory lists what happened to the booking, oldest first.
+func writeHistory(w io.Writer, h []booking.HistoryEntry) {
+    if len(h) == 0 { return }
+    _, _ = io.WriteString(w, "<details class=\"mt-6\"><summary class=\"cursor-pointer opacity-80\">History</summary><ol class=\"text-sm mt-2\">")
+    for _, e := range h {
+        _, _ = io.WriteString(w, "<li data-event=\""+esc(e.Event)+"\"><time datetime=\""+e.CreatedAt.UTC().Format(time.RFC3339)+"\">"+e.CreatedAt.Local().Format("2006-01-02 15:04")+"</time> · "+esc(historyText(e.Event))+"</li>")
+    }
+    _, _ = io.WriteString(w, "</ol></details>")
+}
+
+func historyText(event string) string {
+    switch event {
+    case booking.EventCheckedOut:
+        return "Booked"
+    case booking.EventPaid:
+        return "Paid"
+    case booking.EventExpired:
+        return "Expired unpaid"
+    case booking.EventSeatsCancelled:
+        return "Some seats cancelled"
+    case booking.EventCancelled:
+        return "Cancelled"
+    case booking.EventChangeRequested:
+        return "Trip change requested, waiting for payment"
+    case booking.EventRescheduled:
+        return "Moved to another train"
+    case booking.EventChangeExpired:
+        return "Trip change expired unpaid"
+    case booking.EventDisrupted:
+        return "Train delayed or cancelled by the railway"
+    }
+    return event
+}
+
+// disruptionText says what happened to the train, e.g. "delayed 90 minutes".
+func disruptionText(kind string, delay int) string {
+    if kind == booking.DisruptionDelay { return "delayed " + plural(int64(delay), "minute") }
+    return "cancelled"
+}
+
+// writeDisruptionPanel tells the owner their train was delayed or cancelled
+// and, until the offer lapses, lets them change trains for free or cancel
+// with a full refund.
+func writeDisruptionPanel(w io.Writer, v BookingView) {
+    o, b := v.Disruption, v.Booking
+    if o == nil { return }
+    _, _ = io.WriteString(w, "<div id=\"disruption-panel\" role=\"alert\" class=\"mt-6 alert alert-warning flex flex-col items-start gap-2\" data-kind=\""+esc(o.Kind)+"\">")
+    msg := "Your train was " + esc(disruptionText(o.Kind, o.DelayMinutes)) + "."
+    if o.Outcome == booking.OutcomeMoved { msg = "Your train was cancelled, so we moved you to the train above at no extra cost." }
+    if o.Reason != "" { msg += " " + esc(o.Reason) }
+    _, _ = io.WriteString(w, "<p>"+msg+"</p>")
+    _, _ = io.WriteString(w, "<p>Until <time datetime=\""+o.Until.UTC().Format(time.RFC3339)+"\">"+o.Until.Local().Format("2006-01-02 15:04")+"</time> you can change to another departure for free, or cancel for a full refund.</p>")
+    _, _ = io.WriteString(w, "<div class=\"flex gap-2\"><a class=\"btn btn-sm\" href=\"/booking/reschedule?"+qs("code", b.Code)+"\">Change train for free</a><a class=\"btn btn-sm btn-ghost\" href=\"#cancel-panel\">Cancel with full refund</a></div>")
+    _, _ = io.WriteString(w, "</div>")
+}
+
+// writeCancelPanel offers to cancel the seats still booked, quoting each
+// refund under the policy, and lists the refunds already recorded.
+func writeCancelPanel(w io.Writer, v BookingView) {
+    b := v.Booking
+    var live []booking.Item
+    for _, it := range b.Items {
+        if it.Status == booking.ItemConfirmed { live = append(live, it) }
+    }
+    canCancel := len(live) > 0 && (b.Status == booking.StatusPaid || b.Status == booking.StatusPending)
+    if !canCancel && len(v.Refunds) == 0 { return }
+    _, _ = io.WriteString(w, "<div id=\"cancel-panel\" class=\"mt-6 card bg-base-200/60 border border-white/10 rounded-box shadow ring-1 ring-white/10\"><div class=\"card-body\">")
+    _, _ = io.WriteString(w, "<h3 class=\"card-title\">Cancellation</h3>")
+    if canCancel {
+        _, _ = io.WriteString(w, "<form method=\"post\" action=\"/booking/cancel\" class=\"flex flex-col gap-2\"><input type=\"hidden\" name=\"code\" value=\""+esc(b.Code)+"\">")
+        if b.Status == booking.StatusPending {
+            _, _ = io.WriteString(w, "<p>Cancelling an unpaid booking releases all of its seats. Nothing has been charged.</p>")
+        } else {
+            policy := refundPolicyText(v.Policy)
+            if v.Disruption != nil { policy = "Because your train was " + disruptionText(v.Disruption.Kind, v.Disruption.DelayMinutes) + ", everything you paid is refunded." }
+            _, _ = io.WriteString(w, "<p class=\"opacity-80\">"+esc(policy)+" Choose the seats to cancel:</p>")
+            now := time.Now()
+            for _, it := range live {
+                q := v.Policy.ItemRefund(*b, it, now)
+                if v.Disruption != nil { q = b.FullRefund(it) }
+                who := "Coach " + strconv.Itoa(it.CoachNo) + " · " + esc(it.SeatNo)
+                if len(b.Legs) > 0 { who = esc(b.TripOf(it.TripID).TrainCode) + " · " + who }
+                if it.Passenger != nil { who += " · " + esc(it.Passenger.Name) }
+                _, _ = io.WriteString(w, "<label class=\"label cursor-pointer justify-start gap-2\"><input type=\"checkbox\" class=\"checkbox checkbox-sm\" name=\"item_id\" value=\""+esc(it.ID)+"\"><span>"+who+"</span><span class=\"opacity-70\" data-refund=\""+strconv.FormatInt(q.Amount, 10)+"\">refund "+fmtRupiah(q.Amount)+" ("+fmtInt(q.Percent)+"%)</span></label>")
+            }
+            _, _ = io.WriteString(w, "<p class=\"text-xs opacity-70\">Leave every seat unticked to cancel the whole booking.</p>")
+        }
+        _, _ = io.WriteString(w, "<input class=\"input input-bordered input-sm\" name=\"reason\" maxlength=\"255\" placeholder=\"Reason (optional)\">")
+        _, _ = io.WriteString(w, "<label class=\"label cursor-pointer justify-start gap-2\"><input type=\"checkbox\" class=\"checkbox checkbox-sm\" name=\"confirm\" value=\"1\" required><span>I understand cancelled seats cannot be restored.</span></label>")
+        _, _ = io.WriteString(w, "<div><button class=\"btn btn-error btn-sm\">Cancel seats</button></div></form>")
+    }
+    if len(v.Refunds) > 0 {
+        _, _ = io.WriteString(w, "<ul class=\"text-sm\">")
+        for _, r := range v.Refunds {
+            _, _ = io.WriteString(w, "<li data-refund-status=\""+esc(r.Status)+"\">Refund "+fmtRupiah(r.Amount)+" · "+esc(r.Status)+" · "+esc(r.Reason)+"</li>")
+        }
+        _, _ = io.WriteString(w, "</ul>")
+    }
+    _, _ = io.WriteString(w, "</div></div>")
+}
+
+// refundPolicyText spells out the refund schedule, e.g. "Refund 75% from 7 days before departure, …".
+func refundPolicyText(p booking.RefundPolicy) string {
+    if len(p) == 0 { return "" }
+    parts := make([]string, 0, len(p)+1)
+    for _, t := range p {
+        switch {
+        case t.Before == 0:
+            parts = append(parts, fmtInt(t.Percent)+"% until departure")
+        case t.Before%(24*time.Hour) == 0:
+            parts = append(parts, fmtInt(t.Percent)+"% from "+plural(int64(t.Before/(24*time.Hour)), "day")+" before departure")
+        default:
+            parts = append(parts, fmtInt(t.Percent)+"% from "+plural(int64(t.Before/time.Hour), "hour")+" before departure")
+        }
+    }
+    return "Refund " + strings.Join(parts, ", ") + ", nothing after departure."
+}
+
+func plural(n int64, unit string) string {
+    if n == 1 { return "1 " + unit }
+    return fmtInt(n) + " " + unit + "s"
+}
+
+// fareLines explains how a seat's price was computed, one line per fare rule.
+func fareLines(f *booking.Fare) string {
+    if f == nil || len(f.Lines) < 2 { return "" }
+    var sb strings.Builder
+    sb.WriteString("<details class=\"text-xs opacity-70\"><summary>Fare</summary><ul>")
+    for _, l := range f.Lines {
+        label := esc(l.Label)
+        if l.Percent != 0 { label += " (" + fmtInt(l.Percent) + "%)" }
+        sb.WriteString("<li data-fare=\""+esc(l.Kind)+"\">"+label+" "+fmtRupiah(l.Amount)+"</li>")
+    }
+    sb.WriteString("</ul></details>")
+    return sb.String()
+}
+
+// maskID hides all but the last four characters of an identity number.
+func maskID(s string) string {
+    if len(s) <= 4 { return s }
+    return strings.Repeat("•", len(s)-4) + s[len(s)-4:]
 }
@@ -3,18 +3,151 @@ package templates
 import (
     "context"
     "io"
+    "strconv"
+    "time"
+
     templ "github.com/a-h/templ"
+    "gothicforge3/internal/booking"
 )
 
-func PagePassengers() templ.Component {
+// PassengersView is the passenger step for the caller's held seats on one trip,
+// or on a connecting journey (Journey, with one TripInfo per leg in Legs and
+// the first leg's seats in Held). Passengers holds submitted values aligned
+// with Held by index; Errors maps field names ("passengers.0.name",
+// "contact.email", ...) to messages.
+type PassengersView struct {
+    TripID     string
+    Trip       booking.TripInfo
+    Journey    bool
+    Legs       []booking.TripInfo
+    Held       []booking.HeldSeat
+    HeldUntil  time.Time
+    Passengers []booking.Passenger
+    Contact    booking.Contact
+    PromoCode  string
+    Errors     map[string]string
+    Flash      string
+    Error      string
+}
+
+func PagePassengers(v PassengersView) templ.Component {
     body := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
         _, _ = io.WriteString(w, "<section class=\"mx-auto max-w-6xl p-4\">")
         _, _ = io.WriteString(w, "<div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow-xl ring-1 ring-white/10\">")
         _, _ = io.WriteString(w, "<div class=\"card-body\">")
         _, _ = io.WriteString(w, "<h2 class=\"card-title\">Passengers</h2>")
-        _, _ = io.WriteString(w, "<p class=\"opacity-80\">Scaffolded page. Edit at app/templates/page_passengers.go</p>")
-        _, _ = io.WriteString(w, "</div></div></section>")
+        if len(v.Legs) > 1 {
+            _, _ = io.WriteString(w, "<ol class=\"opacity-80 list-decimal list-inside\">")
+            for _, t := range v.Legs {
+                _, _ = io.WriteString(w, "<li>"+esc(t.TrainName)+" ("+esc(t.TrainCode)+") · "+esc(t.OriginName)+" "+esc(t.Depart)+" → "+esc(t.DestinationName)+" "+esc(t.Arrive)+" · "+esc(t.ServiceDate)+"</li>")
+            }
+            _, _ = io.WriteString(w, "</ol><p class=\"text-sm opacity-70\">Each passenger keeps the same place in the seat order on every train.</p>")
+        } else if t := v.Trip; t.TrainName != "" {
+            _, _ = io.WriteString(w, "<p class=\"opacity-80\">"+esc(t.TrainName)+" ("+esc(t.TrainCode)+") · "+esc(t.OriginName)+" "+esc(t.Depart)+" → "+esc(t.DestinationName)+" "+esc(t.Arrive)+" · "+esc(t.ServiceDate)+"</p>")
+        }
+        _, _ = io.WriteString(w, "</div></div>")
+        _, _ = io.WriteString(w, "<div class=\"mt-6\">")
+        if err := PassengerForm(v).Render(ctx, w); err != nil { return err }
+        _, _ = io.WriteString(w, "</div></section>")
         return nil
     })
-    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: "Passengers", Description: "Passengers page", Canonical: "/passengers"}).Render(templ.WithChildren(ctx, body), w) })
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: "Passengers", Description: "Passenger details", Canonical: "/passengers"}).Render(templ.WithChildren(ctx, body), w) })
+}
+
+// PassengerForm is the HTMX-swappable passenger and contact form; on validation
+// errors the server re-renders it with messages next to the offending inputs.
+func PassengerForm(v PassengersView) templ.Component {
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        if v.Error != "" {
+            _, _ = io.WriteString(w, "<div id=\"passenger-form\" role=\"alert\" class=\"alert alert-warning\">"+esc(v.Error)+" <a class=\"link\" href=\""+changeHref(v)+"\">Choose seats</a></div>")
+            return nil
+        }
+        _, _ = io.WriteString(w, "<form id=\"passenger-form\" method=\"post\" action=\"/passengers\" hx-post=\"/passengers\" hx-target=\"this\" hx-swap=\"outerHTML\" class=\"grid gap-4\" novalidate>")
+        _, _ = io.WriteString(w, "<input type=\"hidden\" name=\"trip_id\" value=\""+esc(v.TripID)+"\">")
+        if v.Journey { _, _ = io.WriteString(w, "<input type=\"hidden\" name=\"journey\" value=\"1\">") }
+        if v.Flash != "" {
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-warning\">"+esc(v.Flash)+"</div>")
+        }
+        if msg := v.Errors["passengers"]; msg != "" {
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-error\">"+esc(msg)+"</div>")
+        }
+        if !v.HeldUntil.IsZero() {
+            _, _ = io.WriteString(w, "<p class=\"opacity-80\">Seats held until <time datetime=\""+v.HeldUntil.UTC().Format("2006-01-02T15:04:05Z")+"\">"+v.HeldUntil.Local().Format("15:04")+"</time>.</p>")
+        }
+        for i, h := range v.Held {
+            var p booking.Passenger
+            if i < len(v.Passengers) { p = v.Passengers[i] }
+            writePassengerFields(w, i, h, p, v.Errors)
+        }
+        _, _ = io.WriteString(w, "<fieldset class=\"card bg-base-200/60 border border-white/10 rounded-box p-4 grid gap-3 md:grid-cols-3\"><legend class=\"px-2 font-semibold\">Contact</legend>")
+        writeTextField(w, "contact.name", "Full name", v.Contact.Name, "text", v.Errors)
+        writeTextField(w, "contact.email", "Email", v.Contact.Email, "email", v.Errors)
+        writeTextField(w, "contact.phone", "Phone", v.Contact.Phone, "tel", v.Errors)
+        _, _ = io.WriteString(w, "</fieldset>")
+        _, _ = io.WriteString(w, "<div class=\"md:w-1/3\">")
+        writeTextField(w, "promo_code", "Promo code (optional)", v.PromoCode, "text", v.Errors)
+        _, _ = io.WriteString(w, "</div>")
+        _, _ = io.WriteString(w, "<div class=\"flex justify-between\"><a class=\"btn btn-ghost\" href=\""+changeHref(v)+"\">Change seats</a><button class=\"btn btn-primary\" type=\"submit\">Continue to payment</button></div>")
+        _, _ = io.WriteString(w, "</form>")
+        return nil
+    })
+}
+
+func writePassengerFields(w io.Writer, i int, h booking.HeldSeat, p booking.Passenger, errs map[string]string) {
+    prefix := "passengers." + strconv.Itoa(i) + "."
+    _, _ = io.WriteString(w, "<fieldset class=\"card bg-base-200/60 border border-white/10 rounded-box p-4 grid gap-3 md:grid-cols-4\" data-seat=\""+esc(h.SeatID)+"\">")
+    _, _ = io.WriteString(w, "<legend class=\"px-2 font-semibold\">Passenger "+strconv.Itoa(i+1)+" · Coach "+strconv.Itoa(h.CoachNo)+" seat "+esc(h.SeatNo)+" <span class=\"capitalize opacity-70\">("+esc(h.Class)+")</span></legend>")
+    _, _ = io.WriteString(w, "<input type=\"hidden\" name=\""+prefix+"seat_id\" value=\""+esc(h.SeatID)+"\">")
+    if msg := errs[prefix+"seat_id"]; msg != "" {
+        _, _ = io.WriteString(w, "<p class=\"text-error md:col-span-4\">"+esc(msg)+"</p>")
+    }
+    writeTextField(w, prefix+"name", "Name as on ID", p.Name, "text", errs)
+    writeSelectField(w, prefix+"id_type", "ID type", p.IDType, [][2]string{{booking.IDTypeNIK, "NIK (KTP/KK)"}, {booking.IDTypePassport, "Passport"}}, errs)
+    writeTextField(w, prefix+"id_number", "ID number", p.IDNumber, "text", errs)
+    writeSelectField(w, prefix+"category", "Category", p.Category, [][2]string{{booking.CategoryAdult, "Adult"}, {booking.CategorySenior, "Senior (60+)"}, {booking.CategoryStudent, "Student"}, {booking.CategoryInfant, "Infant (under 3)"}}, errs)
+    _, _ = io.WriteString(w, "</fieldset>")
+}
+
+func writeTextField(w io.Writer, name, label, value, typ string, errs map[string]string) {
+    msg := errs[name]
+    cls, aria := "input input-bordered", ""
+    if msg != "" { cls += " input-error"; aria = " aria-invalid=\"true\"" }
+    _, _ = io.WriteString(w, "<label class=\"form-control\"><span class=\"label-text\">"+esc(label)+"</span><input class=\""+cls+"\" type=\""+typ+"\" name=\""+esc(name)+"\" value=\""+esc(value)+"\""+aria+">")
+    writeFieldError(w, msg)
+    _, _ = io.WriteString(w, "</label>")
+}
+
+func writeSelectField(w io.Writer, name, label, value string, opts [][2]string, errs map[string]string) {
+    msg := errs[name]
+    cls, aria := "select select-bordered", ""
+    if msg != "" { cls += " select-error"; aria = " aria-invalid=\"true\"" }
+    _, _ = io.WriteString(w, "<label class=\"form-control\"><span class=\"label-text\">"+esc(label)+"</span><select class=\""+cls+"\" name=\""+esc(name)+"\""+aria+">")
+    for _, o := range opts {
+        _, _ = io.WriteString(w, "<option value=\""+esc(o[0])+"\""+selectedIf(o[0] == value)+">"+esc(o[1])+"</option>")
+    }
+    _, _ = io.WriteString(w, "</select>")
+    writeFieldError(w, msg)
+    _, _ = io.WriteString(w, "</label>")
+}
+
+func writeFieldError(w io.Writer, msg string) {
+    if msg == "" { return }
+    _, _ = io.WriteString(w, "<span class=\"label-text-alt text-error mt-1\">"+esc(msg)+"</span>")
+}
+
+// changeHref leads back to where the held seats were picked: the seat map of
+// the trip, or the search for a journey.
+func changeHref(v PassengersView) string {
+    if v.Journey { return "/search?" + qs("from", v.Trip.Origin, "to", lastLeg(v).Destination, "date", v.Trip.ServiceDate) }
+    return seatmapHref(v.TripID, v.Trip.Origin, v.Trip.Destination)
+}
+
+func lastLeg(v PassengersView) booking.TripInfo {
+    if len(v.Legs) == 0 { return v.Trip }
+    return v.Legs[len(v.Legs)-1]
+}
+
+func seatmapHref(tripID, from, to string) string {
+    if tripID == "" { return "/search" }
+    return "/seatmap?" + qs("trip", tripID, "from", from, "to", to)
 }
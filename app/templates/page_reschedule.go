@@ -0,0 +1,88 @@
+package templates
+
+import (
+    "context"
+    "io"
+    "strconv"
+    "time"
+
+    templ "github.com/a-h/templ"
+    "gothicforge3/internal/booking"
+)
+
+// RescheduleOption is one departure a booking could move to, priced as a
+// change, or Error when it cannot take the booking's passengers.
+type RescheduleOption struct {
+    Trip  booking.TripResult
+    Quote *booking.Change
+    Error string
+}
+
+// RescheduleView lists the departures on Date that a booking could move to.
+type RescheduleView struct {
+    Booking    *booking.Booking
+    Disruption *booking.DisruptionOffer
+    Date       string
+    Options []RescheduleOption
+    Flash   string
+    Error   string
+}
+
+// PageReschedule lets the owner of a paid booking pick another departure on the same route.
+func PageReschedule(v RescheduleView) templ.Component {
+    body := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        _, _ = io.WriteString(w, "<section class=\"mx-auto max-w-6xl p-4\">")
+        _, _ = io.WriteString(w, "<div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow-xl ring-1 ring-white/10\"><div class=\"card-body\">")
+        b := v.Booking
+        if b == nil {
+            _, _ = io.WriteString(w, "<h2 class=\"card-title\">Change trip</h2>")
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-warning\">"+esc(v.Error)+"</div>")
+            _, _ = io.WriteString(w, "</div></div></section>")
+            return nil
+        }
+        t := b.Trip
+        _, _ = io.WriteString(w, "<h2 class=\"card-title\">Change trip for <a class=\"link font-mono\" href=\"/booking?"+qs("code", b.Code)+"\">"+esc(b.Code)+"</a></h2>")
+        _, _ = io.WriteString(w, "<p class=\"opacity-80\">Now: "+esc(t.TrainName)+" ("+esc(t.TrainCode)+") · "+esc(t.OriginName)+" "+esc(t.Depart)+" → "+esc(t.DestinationName)+" "+esc(t.Arrive)+" · "+esc(t.ServiceDate)+"</p>")
+        if v.Disruption != nil {
+            _, _ = io.WriteString(w, "<p class=\"text-sm opacity-70\" data-disruption>Your train was "+esc(disruptionText(v.Disruption.Kind, v.Disruption.DelayMinutes))+", so changing is free: there is no fee, you never pay more, and a cheaper fare is refunded.</p>")
+        } else {
+            _, _ = io.WriteString(w, "<p class=\"text-sm opacity-70\">Your booking code stays the same. Each seat moved costs a change fee of "+fmtRupiah(booking.ChangeFee())+"; a cheaper fare is refunded, a dearer one is paid before the new seats are confirmed.</p>")
+        }
+        if v.Flash != "" {
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-warning\">"+esc(v.Flash)+"</div>")
+        }
+        if v.Error != "" {
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-warning\">"+esc(v.Error)+"</div>")
+        }
+        if d, err := time.Parse("2006-01-02", v.Date); err == nil {
+            _, _ = io.WriteString(w, "<div class=\"join\">")
+            _, _ = io.WriteString(w, "<a class=\"btn btn-sm join-item\" href=\"/booking/reschedule?"+qs("code", b.Code, "date", d.AddDate(0, 0, -1).Format("2006-01-02"))+"\">‹ Previous day</a>")
+            _, _ = io.WriteString(w, "<span class=\"btn btn-sm join-item no-animation\">"+esc(v.Date)+"</span>")
+            _, _ = io.WriteString(w, "<a class=\"btn btn-sm join-item\" href=\"/booking/reschedule?"+qs("code", b.Code, "date", d.AddDate(0, 0, 1).Format("2006-01-02"))+"\">Next day ›</a>")
+            _, _ = io.WriteString(w, "</div>")
+        }
+        if len(v.Options) == 0 && v.Error == "" {
+            _, _ = io.WriteString(w, "<p>No other departures on this day.</p>")
+        }
+        if len(v.Options) > 0 {
+            _, _ = io.WriteString(w, "<div class=\"overflow-x-auto\"><table class=\"table\"><thead><tr><th>Train</th><th>Departs</th><th>Arrives</th><th class=\"text-right\">Fare difference</th><th class=\"text-right\">Fee</th><th class=\"text-right\">To pay</th><th></th></tr></thead><tbody>")
+            for _, o := range v.Options {
+                tr := o.Trip
+                _, _ = io.WriteString(w, "<tr data-trip=\""+esc(tr.TripID)+"\"><td>"+esc(tr.TrainName)+" ("+esc(tr.TrainCode)+")</td><td>"+esc(tr.Depart)+"</td><td>"+esc(tr.Arrive)+"</td>")
+                if o.Quote == nil {
+                    _, _ = io.WriteString(w, "<td colspan=\"4\" class=\"opacity-70\">"+esc(o.Error)+"</td></tr>")
+                    continue
+                }
+                c := o.Quote
+                pay := fmtRupiah(c.Balance)
+                if c.Balance < 0 { pay = "refund " + fmtRupiah(-c.Balance) }
+                _, _ = io.WriteString(w, "<td class=\"text-right\">"+fmtRupiah(c.FareDifference)+"</td><td class=\"text-right\">"+fmtRupiah(c.Fee)+"</td><td class=\"text-right\" data-balance=\""+strconv.FormatInt(c.Balance, 10)+"\">"+pay+"</td><td>")
+                _, _ = io.WriteString(w, "<form method=\"post\" action=\"/booking/reschedule\"><input type=\"hidden\" name=\"code\" value=\""+esc(b.Code)+"\"><input type=\"hidden\" name=\"date\" value=\""+esc(v.Date)+"\"><input type=\"hidden\" name=\"trip_id\" value=\""+esc(tr.TripID)+"\"><button class=\"btn btn-sm btn-primary\">Change to this train</button></form></td></tr>")
+            }
+            _, _ = io.WriteString(w, "</tbody></table></div>")
+        }
+        _, _ = io.WriteString(w, "</div></div></section>")
+        return nil
+    })
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: "Change trip", Description: "Move your booking to another train", Canonical: "/booking/reschedule"}).Render(templ.WithChildren(ctx, body), w) })
+}
@@ -3,18 +3,169 @@ package templates
 import (
     "context"
     "io"
+    "strconv"
+    "strings"
+
     templ "github.com/a-h/templ"
+    "gothicforge3/internal/booking"
 )
 
-func PageSearch() templ.Component {
+// SearchForm carries the submitted (or default) search values back into the form.
+type SearchForm struct {
+    From  string
+    To    string
+    Date  string
+    Pax   int
+    Class string
+}
+
+func PageSearch(form SearchForm, stations []booking.Station, results templ.Component) templ.Component {
     body := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
         _, _ = io.WriteString(w, "<section class=\"mx-auto max-w-6xl p-4\">")
         _, _ = io.WriteString(w, "<div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow-xl ring-1 ring-white/10\">")
         _, _ = io.WriteString(w, "<div class=\"card-body\">")
-        _, _ = io.WriteString(w, "<h2 class=\"card-title\">Search</h2>")
-        _, _ = io.WriteString(w, "<p class=\"opacity-80\">Scaffolded page. Edit at app/templates/page_search.go</p>")
-        _, _ = io.WriteString(w, "</div></div></section>")
+        _, _ = io.WriteString(w, "<h2 class=\"card-title\">Search trains</h2>")
+        _, _ = io.WriteString(w, "<form action=\"/search\" method=\"get\" hx-get=\"/search/results\" hx-target=\"#search-results\" hx-swap=\"innerHTML\" hx-push-url=\"false\" class=\"grid gap-3 md:grid-cols-6 items-end\">")
+        writeStationField(w, "from", "From", form.From, stations)
+        writeStationField(w, "to", "To", form.To, stations)
+        _, _ = io.WriteString(w, "<label class=\"form-control\"><span class=\"label-text\">Date</span><input class=\"input input-bordered\" type=\"date\" name=\"date\" value=\""+esc(form.Date)+"\" required></label>")
+        pax := form.Pax
+        if pax < 1 { pax = 1 }
+        _, _ = io.WriteString(w, "<label class=\"form-control\"><span class=\"label-text\">Passengers</span><input class=\"input input-bordered\" type=\"number\" name=\"pax\" min=\"1\" max=\""+strconv.Itoa(booking.MaxPassengers())+"\" value=\""+strconv.Itoa(pax)+"\"></label>")
+        _, _ = io.WriteString(w, "<label class=\"form-control\"><span class=\"label-text\">Class</span><select class=\"select select-bordered\" name=\"class\"><option value=\"\">All classes</option>")
+        for _, c := range booking.Classes {
+            sel := ""
+            if c == form.Class { sel = " selected" }
+            _, _ = io.WriteString(w, "<option value=\""+c+"\""+sel+">"+esc(c)+"</option>")
+        }
+        _, _ = io.WriteString(w, "</select></label>")
+        _, _ = io.WriteString(w, "<button class=\"btn btn-primary\" type=\"submit\">Search</button>")
+        _, _ = io.WriteString(w, "</form>")
+        _, _ = io.WriteString(w, "</div></div>")
+        _, _ = io.WriteString(w, "<div id=\"search-results\" class=\"mt-6\" aria-live=\"polite\">")
+        if results != nil {
+            if err := results.Render(ctx, w); err != nil { return err }
+        }
+        _, _ = io.WriteString(w, "</div></section>")
         return nil
     })
-    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: "Search", Description: "Search page", Canonical: "/search"}).Render(templ.WithChildren(ctx, body), w) })
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: "Search", Description: "Search KAI train trips", Canonical: "/search"}).Render(templ.WithChildren(ctx, body), w) })
+}
+
+// writeStationField renders a station select when the station list is available, or a code input otherwise.
+func writeStationField(w io.Writer, name, label, value string, stations []booking.Station) {
+    _, _ = io.WriteString(w, "<label class=\"form-control\"><span class=\"label-text\">"+label+"</span>")
+    if len(stations) == 0 {
+        _, _ = io.WriteString(w, "<input class=\"input input-bordered uppercase\" name=\""+name+"\" value=\""+esc(value)+"\" placeholder=\"GMR\" required></label>")
+        return
+    }
+    _, _ = io.WriteString(w, "<select class=\"select select-bordered\" name=\""+name+"\" required><option value=\"\" disabled"+selectedIf(value == "")+">Select station</option>")
+    for _, s := range stations {
+        _, _ = io.WriteString(w, "<option value=\""+esc(s.Code)+"\""+selectedIf(s.Code == value)+">"+esc(s.Name)+" ("+esc(s.Code)+")</option>")
+    }
+    _, _ = io.WriteString(w, "</select></label>")
+}
+
+func selectedIf(b bool) string {
+    if b { return " selected" }
+    return ""
+}
+
+// SearchResults is the HTMX-swappable fragment listing trips and seats left per
+// class, followed by connecting journeys that change trains on the way.
+func SearchResults(q booking.SearchQuery, trips []booking.TripResult, journeys []booking.Journey, errMsg string) templ.Component {
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        if errMsg != "" {
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-warning\">"+esc(errMsg)+"</div>")
+            return nil
+        }
+        if len(trips) == 0 && len(journeys) == 0 {
+            _, _ = io.WriteString(w, "<div class=\"alert\">No trips found for this date.</div>")
+            return nil
+        }
+        if len(trips) == 0 {
+            _, _ = io.WriteString(w, "<div class=\"alert\">No direct trains on this date; these journeys change trains on the way.</div>")
+        }
+        ids := make([]string, len(trips))
+        for i, t := range trips {
+            ids[i] = t.TripID
+        }
+        if len(trips) > 0 {
+            // Seats left refresh per card as other buyers hold, book and release seats.
+            _, _ = io.WriteString(w, sseScript+"<div class=\"grid gap-4\" hx-ext=\"sse\" sse-connect=\"/api/seats/stream?"+qs("trip", strings.Join(ids, ","))+"\">")
+        } else {
+            _, _ = io.WriteString(w, "<div class=\"grid gap-4\">")
+        }
+        for _, t := range trips {
+            writeTripCard(w, q, t)
+        }
+        _, _ = io.WriteString(w, "</div>")
+        writeJourneys(w, q, journeys)
+        return nil
+    })
+}
+
+// SearchTripCard is one trip of the search results, swapped in again when
+// its seats change.
+func SearchTripCard(q booking.SearchQuery, t booking.TripResult) templ.Component {
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        writeTripCard(w, q, t)
+        return nil
+    })
+}
+
+func writeTripCard(w io.Writer, q booking.SearchQuery, t booking.TripResult) {
+        _, _ = io.WriteString(w, "<div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow ring-1 ring-white/10\" data-trip=\""+esc(t.TripID)+"\" hx-get=\"/search/trip?"+qs("trip", t.TripID, "from", q.Origin, "to", q.Destination, "date", q.Date.Format("2006-01-02"), "pax", strconv.Itoa(q.Passengers), "class", q.Class)+"\" hx-trigger=\"sse:seats-"+esc(t.TripID)+" delay:500ms\" hx-swap=\"outerHTML\"><div class=\"card-body\">")
+        _, _ = io.WriteString(w, "<div class=\"flex flex-wrap justify-between gap-2\"><h3 class=\"card-title\">"+esc(t.TrainName)+" <span class=\"badge badge-outline\">"+esc(t.TrainCode)+"</span></h3>")
+        if t.Status != "scheduled" {
+            _, _ = io.WriteString(w, "<span class=\"badge badge-warning\">"+esc(t.Status)+"</span>")
+        }
+        _, _ = io.WriteString(w, "</div>")
+        _, _ = io.WriteString(w, "<p class=\"opacity-80\">"+esc(t.OriginName)+" ("+esc(t.Origin)+") "+esc(t.Depart)+" → "+esc(t.DestinationName)+" ("+esc(t.Destination)+") "+esc(t.Arrive)+" · "+esc(t.ServiceDate)+"</p>")
+        _, _ = io.WriteString(w, "<div class=\"flex flex-wrap gap-3 mt-2\">")
+        for _, c := range t.Classes {
+            _, _ = io.WriteString(w, "<div class=\"stat bg-base-100 rounded-box w-auto\" data-class=\""+esc(c.Class)+"\"><div class=\"stat-title capitalize\">"+esc(c.Class)+"</div><div class=\"stat-value text-lg\">"+fmtRupiah(c.Price)+"</div><div class=\"stat-desc\"><span data-seats-left>"+strconv.Itoa(c.SeatsLeft)+"</span> seats left</div>")
+            if c.Bookable {
+                _, _ = io.WriteString(w, "<a class=\"btn btn-sm btn-primary mt-2\" href=\"/seatmap?"+qs("trip", t.TripID, "from", t.Origin, "to", t.Destination, "class", c.Class, "pax", strconv.Itoa(q.Passengers))+"\">Select seats</a>")
+            } else {
+                _, _ = io.WriteString(w, "<a class=\"btn btn-sm mt-2\" href=\"/waitlist?"+qs("trip", t.TripID, "from", t.Origin, "to", t.Destination, "class", c.Class, "pax", strconv.Itoa(q.Passengers))+"\">Sold out · join waitlist</a>")
+            }
+            _, _ = io.WriteString(w, "</div>")
+        }
+        _, _ = io.WriteString(w, "</div></div></div>")
+}
+
+// writeJourneys lists connecting journeys. Holding one takes seats on every
+// leg at once and continues to the passenger step.
+func writeJourneys(w io.Writer, q booking.SearchQuery, journeys []booking.Journey) {
+    if len(journeys) == 0 { return }
+    _, _ = io.WriteString(w, "<h3 class=\"text-xl font-semibold mt-6 mb-2\">Connections</h3><div class=\"grid gap-4\">")
+    for _, j := range journeys {
+        _, _ = io.WriteString(w, "<div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow ring-1 ring-white/10\" data-journey><div class=\"card-body\">")
+        _, _ = io.WriteString(w, "<div class=\"flex flex-wrap justify-between gap-2\"><h3 class=\"card-title\">"+esc(j.Depart)+" → "+esc(j.Arrive))
+        if j.ArriveDate != j.DepartDate { _, _ = io.WriteString(w, " <span class=\"badge badge-outline\">"+esc(j.ArriveDate)+"</span>") }
+        _, _ = io.WriteString(w, "</h3><span class=\"opacity-80\">"+fmtDuration(j.Minutes)+" · "+strconv.Itoa(len(j.Transfers))+" change(s)</span></div>")
+        _, _ = io.WriteString(w, "<ol class=\"grid gap-1\">")
+        for i, l := range j.Legs {
+            if i > 0 {
+                t := j.Transfers[i-1]
+                _, _ = io.WriteString(w, "<li class=\"text-sm opacity-70\">Change at "+esc(t.StationName)+" · "+fmtDuration(t.Minutes)+"</li>")
+            }
+            _, _ = io.WriteString(w, "<li data-trip=\""+esc(l.TripID)+"\">"+esc(l.TrainName)+" <span class=\"badge badge-outline\">"+esc(l.TrainCode)+"</span> "+esc(l.OriginName)+" "+esc(l.Depart)+" → "+esc(l.DestinationName)+" "+esc(l.Arrive)+" · <span class=\"capitalize\">"+esc(l.Class)+"</span> "+fmtRupiah(l.Price)+"</li>")
+        }
+        _, _ = io.WriteString(w, "</ol>")
+        _, _ = io.WriteString(w, "<div class=\"flex flex-wrap items-center justify-between gap-2 mt-2\"><span class=\"text-lg font-semibold\">"+fmtRupiah(j.Price)+" <span class=\"text-sm font-normal opacity-70\">per passenger</span></span>")
+        if j.Bookable {
+            _, _ = io.WriteString(w, "<form method=\"post\" action=\"/journey\"><input type=\"hidden\" name=\"pax\" value=\""+strconv.Itoa(q.Passengers)+"\">")
+            for i, l := range j.Legs {
+                prefix := "legs." + strconv.Itoa(i) + "."
+                _, _ = io.WriteString(w, "<input type=\"hidden\" name=\""+prefix+"trip_id\" value=\""+esc(l.TripID)+"\"><input type=\"hidden\" name=\""+prefix+"from\" value=\""+esc(l.Origin)+"\"><input type=\"hidden\" name=\""+prefix+"to\" value=\""+esc(l.Destination)+"\"><input type=\"hidden\" name=\""+prefix+"class\" value=\""+esc(l.Class)+"\">")
+            }
+            _, _ = io.WriteString(w, "<button class=\"btn btn-sm btn-primary\" type=\"submit\">Hold seats</button></form>")
+        } else {
+            _, _ = io.WriteString(w, "<span class=\"btn btn-sm btn-disabled\">Sold out</span>")
+        }
+        _, _ = io.WriteString(w, "</div></div></div>")
+    }
+    _, _ = io.WriteString(w, "</div>")
 }
@@ -3,18 +3,157 @@ package templates
 import (
     "context"
     "io"
+    "strconv"
+
     templ "github.com/a-h/templ"
+    "gothicforge3/internal/booking"
 )
 
-func PageSeatmap() templ.Component {
+// SeatmapView is the seat map of one trip's leg plus the query it was opened with.
+// Flash is a one-off notice (e.g. a seat lost to another buyer) shown above the grid.
+type SeatmapView struct {
+    Map   booking.SeatMap
+    From  string
+    To    string
+    Class string
+    Pax   int
+    Flash string
+    Error string
+}
+
+// sseScript loads the htmx SSE extension that live seat maps and search
+// results use to refresh when seats are held, booked or released.
+const sseScript = "<script src=\"https://unpkg.com/htmx-ext-sse@2.2.2/sse.js\"></script>"
+
+func PageSeatmap(v SeatmapView) templ.Component {
     body := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
         _, _ = io.WriteString(w, "<section class=\"mx-auto max-w-6xl p-4\">")
         _, _ = io.WriteString(w, "<div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow-xl ring-1 ring-white/10\">")
         _, _ = io.WriteString(w, "<div class=\"card-body\">")
-        _, _ = io.WriteString(w, "<h2 class=\"card-title\">Seatmap</h2>")
-        _, _ = io.WriteString(w, "<p class=\"opacity-80\">Scaffolded page. Edit at app/templates/page_seatmap.go</p>")
-        _, _ = io.WriteString(w, "</div></div></section>")
+        t := v.Map.Trip
+        if t.TrainName != "" {
+            _, _ = io.WriteString(w, "<h2 class=\"card-title\">"+esc(t.TrainName)+" <span class=\"badge badge-outline\">"+esc(t.TrainCode)+"</span></h2>")
+            _, _ = io.WriteString(w, "<p class=\"opacity-80\">"+esc(t.OriginName)+" ("+esc(t.Origin)+") "+esc(t.Depart)+" → "+esc(t.DestinationName)+" ("+esc(t.Destination)+") "+esc(t.Arrive)+" · "+esc(t.ServiceDate)+"</p>")
+        } else {
+            _, _ = io.WriteString(w, "<h2 class=\"card-title\">Seat map</h2>")
+        }
+        _, _ = io.WriteString(w, "</div></div>")
+        if v.Error == "" {
+            _, _ = io.WriteString(w, sseScript+"<div class=\"mt-6\" hx-ext=\"sse\" sse-connect=\"/api/trips/"+esc(v.Map.TripID)+"/seats/stream\">")
+        } else {
+            _, _ = io.WriteString(w, "<div class=\"mt-6\">")
+        }
+        if err := SeatmapGrid(v).Render(ctx, w); err != nil { return err }
+        _, _ = io.WriteString(w, "</div></section>")
+        return nil
+    })
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: "Seatmap", Description: "Pick your seats", Canonical: "/seatmap"}).Render(templ.WithChildren(ctx, body), w) })
+}
+
+// SeatmapGrid is the HTMX-swappable seat map. It reloads itself when the seat
+// stream of PageSeatmap reports a change, so seats taken by other buyers show
+// up without a reload, and still polls slowly in case the stream drops. Each
+// seat is a submit button that toggles a hold through POST /seatmap/seat.
+func SeatmapGrid(v SeatmapView) templ.Component {
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        if v.Error != "" {
+            _, _ = io.WriteString(w, "<div id=\"seatmap\" role=\"alert\" class=\"alert alert-warning\">"+esc(v.Error)+" <a class=\"link\" href=\"/search\">Back to search</a></div>")
+            return nil
+        }
+        m := v.Map
+        pax := strconv.Itoa(v.Pax)
+        _, _ = io.WriteString(w, "<div id=\"seatmap\" hx-get=\"/seatmap/grid?"+qs("trip", m.TripID, "from", v.From, "to", v.To, "class", v.Class, "pax", pax)+"\" hx-trigger=\"sse:seats delay:300ms, every 60s\" hx-swap=\"outerHTML\" aria-live=\"polite\">")
+        if v.Flash != "" {
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-warning mb-4\">"+esc(v.Flash)+"</div>")
+        }
+        _, _ = io.WriteString(w, "<div class=\"flex flex-wrap gap-3 mb-4 text-sm\">")
+        for _, s := range []string{booking.SeatAvailable, booking.SeatAccessible, booking.SeatMine, booking.SeatHeld, booking.SeatBooked} {
+            _, _ = io.WriteString(w, "<span class=\"flex items-center gap-1\"><span class=\"seat seat-"+s+" seat-key\"></span>"+seatLabel(s)+"</span>")
+        }
+        _, _ = io.WriteString(w, "</div>")
+        if len(m.Coaches) == 0 {
+            _, _ = io.WriteString(w, "<div class=\"alert\">No seats are published for this trip yet.</div>")
+        }
+        _, _ = io.WriteString(w, "<form method=\"post\" action=\"/seatmap/seat\" hx-post=\"/seatmap/seat\" hx-target=\"#seatmap\" hx-swap=\"outerHTML\" class=\"grid gap-4 md:grid-cols-2\">")
+        _, _ = io.WriteString(w, "<input type=\"hidden\" name=\"trip_id\" value=\""+esc(m.TripID)+"\"><input type=\"hidden\" name=\"from\" value=\""+esc(v.From)+"\"><input type=\"hidden\" name=\"to\" value=\""+esc(v.To)+"\"><input type=\"hidden\" name=\"class\" value=\""+esc(v.Class)+"\"><input type=\"hidden\" name=\"pax\" value=\""+pax+"\">")
+        for _, c := range m.Coaches {
+            writeCoach(w, c)
+        }
+        _, _ = io.WriteString(w, "</form>")
+        writeHeldSummary(w, v)
+        _, _ = io.WriteString(w, "</div>")
         return nil
     })
-    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: "Seatmap", Description: "Seatmap page", Canonical: "/seatmap"}).Render(templ.WithChildren(ctx, body), w) })
+}
+
+func writeCoach(w io.Writer, c booking.Coach) {
+    aisles := map[int]bool{}
+    for _, a := range booking.AisleAfter(c.Layout) {
+        if a < c.Cols { aisles[a] = true }
+    }
+    _, _ = io.WriteString(w, "<fieldset class=\"card bg-base-200/60 border border-white/10 rounded-box p-4\" data-coach=\""+strconv.Itoa(c.No)+"\">")
+    _, _ = io.WriteString(w, "<legend class=\"px-2 font-semibold\">Coach "+strconv.Itoa(c.No)+" · <span class=\"capitalize\">"+esc(c.Class)+"</span> · "+strconv.Itoa(c.Free)+" free</legend>")
+    tracks := ""
+    for col := 1; col <= c.Cols; col++ {
+        tracks += " 2.5rem"
+        if aisles[col] { tracks += " 1.25rem" }
+    }
+    _, _ = io.WriteString(w, "<div class=\"grid gap-1 justify-center\" style=\"grid-template-columns:"+tracks+"\">")
+    byPos := make(map[[2]int]booking.SeatCell, len(c.Seats))
+    for _, s := range c.Seats {
+        byPos[[2]int{s.Row, s.Col}] = s
+    }
+    for row := 1; row <= c.Rows; row++ {
+        for col := 1; col <= c.Cols; col++ {
+            if s, ok := byPos[[2]int{row, col}]; ok {
+                writeSeat(w, s)
+            } else {
+                _, _ = io.WriteString(w, "<span></span>")
+            }
+            if aisles[col] { _, _ = io.WriteString(w, "<span aria-hidden=\"true\"></span>") }
+        }
+    }
+    _, _ = io.WriteString(w, "</div></fieldset>")
+}
+
+func writeSeat(w io.Writer, s booking.SeatCell) {
+    label := "Seat " + s.No + ", " + seatLabel(s.State)
+    disabled := ""
+    if s.State == booking.SeatHeld || s.State == booking.SeatBooked { disabled = " disabled" }
+    pressed := "false"
+    if s.State == booking.SeatMine { pressed = "true" }
+    _, _ = io.WriteString(w, "<button type=\"submit\" name=\"seat_id\" value=\""+esc(s.ID)+"\" class=\"seat seat-"+s.State+"\" title=\""+esc(label)+"\" aria-label=\""+esc(label)+"\" aria-pressed=\""+pressed+"\" data-seat=\""+esc(s.No)+"\""+disabled+">"+esc(s.No)+"</button>")
+}
+
+func writeHeldSummary(w io.Writer, v SeatmapView) {
+    m := v.Map
+    _, _ = io.WriteString(w, "<div class=\"card bg-base-200/60 border border-white/10 rounded-box mt-4\"><div class=\"card-body\">")
+    if len(m.Held) == 0 {
+        _, _ = io.WriteString(w, "<p class=\"opacity-80\">Select up to "+strconv.Itoa(max(v.Pax, 1))+" seat(s). Seats are held for you for a few minutes.</p></div></div>")
+        return
+    }
+    var total int64
+    _, _ = io.WriteString(w, "<ul class=\"flex flex-wrap gap-2\">")
+    for _, h := range m.Held {
+        total += h.Price
+        _, _ = io.WriteString(w, "<li class=\"badge badge-primary badge-lg\">Coach "+strconv.Itoa(h.CoachNo)+" · "+esc(h.SeatNo)+"</li>")
+    }
+    _, _ = io.WriteString(w, "</ul>")
+    _, _ = io.WriteString(w, "<p>Held until <time datetime=\""+m.HeldUntil.UTC().Format("2006-01-02T15:04:05Z")+"\">"+m.HeldUntil.Local().Format("15:04")+"</time> · "+fmtRupiah(total)+"</p>")
+    _, _ = io.WriteString(w, "<div class=\"card-actions justify-end\"><a class=\"btn btn-primary\" href=\"/passengers?"+qs("trip", m.TripID)+"\">Continue</a></div>")
+    _, _ = io.WriteString(w, "</div></div>")
+}
+
+func seatLabel(state string) string {
+    switch state {
+    case booking.SeatAccessible:
+        return "accessible"
+    case booking.SeatMine:
+        return "your seat"
+    case booking.SeatHeld:
+        return "held"
+    case booking.SeatBooked:
+        return "booked"
+    }
+    return "available"
 }
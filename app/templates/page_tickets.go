@@ -0,0 +1,48 @@
+package templates
+
+import (
+    "context"
+    "io"
+    "net/url"
+    "strconv"
+
+    templ "github.com/a-h/templ"
+    "gothicforge3/internal/booking"
+    "gothicforge3/internal/ticket"
+)
+
+// PageTickets shows the boarding passes of a paid booking, one card per passenger.
+func PageTickets(b *booking.Booking, tickets []ticket.Ticket, errMsg string) templ.Component {
+    body := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        _, _ = io.WriteString(w, "<section class=\"mx-auto max-w-6xl p-4\">")
+        if b == nil {
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-warning\">"+esc(errMsg)+"</div></section>")
+            return nil
+        }
+        _, _ = io.WriteString(w, "<div class=\"flex flex-wrap items-center justify-between gap-2 mb-4\"><h2 class=\"text-2xl font-semibold\">E-tickets <span class=\"font-mono\">"+esc(b.Code)+"</span></h2>")
+        _, _ = io.WriteString(w, "<a class=\"btn btn-primary\" href=\"/tickets/"+url.PathEscape(b.Code)+"/pdf\" download>Download PDF</a></div>")
+        if len(tickets) == 0 {
+            _, _ = io.WriteString(w, "<div class=\"alert\">Tickets are issued once payment is confirmed. <a class=\"link\" href=\"/booking?"+qs("code", b.Code)+"\">Back to booking</a></div></section>")
+            return nil
+        }
+        _, _ = io.WriteString(w, "<div class=\"grid gap-4 md:grid-cols-2\">")
+        for _, tk := range tickets {
+            svg, err := ticket.SVG(tk.Payload, 220)
+            if err != nil { return err }
+            t := b.TripOf(tk.TripID)
+            _, _ = io.WriteString(w, "<article class=\"card bg-base-200/60 border border-white/10 rounded-box shadow ring-1 ring-white/10\" data-item=\""+esc(tk.ItemID)+"\"><div class=\"card-body\">")
+            _, _ = io.WriteString(w, "<h3 class=\"card-title\">"+esc(tk.Passenger))
+            if tk.Category != "" && tk.Category != booking.CategoryAdult { _, _ = io.WriteString(w, " <span class=\"badge\">"+esc(tk.Category)+"</span>") }
+            _, _ = io.WriteString(w, "</h3>")
+            _, _ = io.WriteString(w, "<p>"+esc(t.TrainName)+" ("+esc(t.TrainCode)+") · "+esc(t.ServiceDate)+"</p>")
+            _, _ = io.WriteString(w, "<p class=\"opacity-80\">"+esc(t.OriginName)+" "+esc(t.Depart)+" → "+esc(t.DestinationName)+" "+esc(t.Arrive)+"</p>")
+            _, _ = io.WriteString(w, "<p class=\"text-lg font-semibold\">Coach "+strconv.Itoa(tk.Coach)+" · Seat "+esc(tk.Seat)+" <span class=\"capitalize badge badge-outline\">"+esc(tk.Class)+"</span></p>")
+            _, _ = io.WriteString(w, "<div class=\"bg-white p-2 rounded-box self-center\">"+svg+"</div>")
+            _, _ = io.WriteString(w, "<details class=\"text-xs opacity-70\"><summary>Ticket code</summary><code class=\"break-all\" data-payload>"+esc(tk.Payload)+"</code></details>")
+            _, _ = io.WriteString(w, "</div></article>")
+        }
+        _, _ = io.WriteString(w, "</div></section>")
+        return nil
+    })
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: "E-tickets", Description: "Your boarding passes", Canonical: "/tickets"}).Render(templ.WithChildren(ctx, body), w) })
+}
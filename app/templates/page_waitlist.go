@@ -0,0 +1,88 @@
+package templates
+
+import (
+    "context"
+    "io"
+    "strconv"
+    "time"
+
+    templ "github.com/a-h/templ"
+    "gothicforge3/internal/booking"
+)
+
+// WaitlistJoin is the sold-out class a customer came to queue for.
+type WaitlistJoin struct {
+    TripID   string
+    From, To string
+    Class    string
+    Pax      int
+    Trip     booking.TripInfo
+}
+
+// WaitlistView is the caller's waitlist entries, with the join form when
+// they arrived from a sold-out class in the search results.
+type WaitlistView struct {
+    Join    *WaitlistJoin
+    Entries []booking.WaitlistEntry
+    Flash   string
+    Error   string
+}
+
+// PageWaitlist lists the caller's places in waitlists and any seats held for them.
+func PageWaitlist(v WaitlistView) templ.Component {
+    body := templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+        _, _ = io.WriteString(w, "<section class=\"mx-auto max-w-6xl p-4\">")
+        _, _ = io.WriteString(w, "<div class=\"card bg-base-200/60 border border-white/10 rounded-box shadow-xl ring-1 ring-white/10\"><div class=\"card-body\">")
+        _, _ = io.WriteString(w, "<h2 class=\"card-title\">Waitlist</h2>")
+        if v.Flash != "" {
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-warning\">"+esc(v.Flash)+"</div>")
+        }
+        if v.Error != "" {
+            _, _ = io.WriteString(w, "<div role=\"alert\" class=\"alert alert-warning\">"+esc(v.Error)+"</div>")
+            _, _ = io.WriteString(w, "</div></div></section>")
+            return nil
+        }
+        if j := v.Join; j != nil {
+            t := j.Trip
+            _, _ = io.WriteString(w, "<form method=\"post\" action=\"/waitlist\" class=\"flex flex-col gap-2\">")
+            _, _ = io.WriteString(w, "<p>"+esc(t.TrainName)+" ("+esc(t.TrainCode)+") · "+esc(t.OriginName)+" "+esc(t.Depart)+" → "+esc(t.DestinationName)+" "+esc(t.Arrive)+" · "+esc(t.ServiceDate)+" · <span class=\"capitalize\">"+esc(j.Class)+"</span></p>")
+            _, _ = io.WriteString(w, "<p class=\"text-sm opacity-70\">When seats come free they are held for the first customer in line for "+plural(int64(booking.WaitlistOfferTTL()/time.Minute), "minute")+", and we email you. Then pick your seats and check out as usual.</p>")
+            _, _ = io.WriteString(w, "<input type=\"hidden\" name=\"trip_id\" value=\""+esc(j.TripID)+"\"><input type=\"hidden\" name=\"from\" value=\""+esc(j.From)+"\"><input type=\"hidden\" name=\"to\" value=\""+esc(j.To)+"\"><input type=\"hidden\" name=\"class\" value=\""+esc(j.Class)+"\">")
+            _, _ = io.WriteString(w, "<div class=\"flex flex-wrap gap-2 items-end\">")
+            _, _ = io.WriteString(w, "<label class=\"form-control\"><span class=\"label-text\">Passengers</span><input class=\"input input-bordered input-sm w-24\" type=\"number\" name=\"pax\" min=\"1\" max=\""+strconv.Itoa(booking.MaxPassengers())+"\" value=\""+strconv.Itoa(j.Pax)+"\" required></label>")
+            _, _ = io.WriteString(w, "<label class=\"form-control\"><span class=\"label-text\">Email</span><input class=\"input input-bordered input-sm\" type=\"email\" name=\"email\" required></label>")
+            _, _ = io.WriteString(w, "<button class=\"btn btn-sm btn-primary\">Join waitlist</button></div></form>")
+        }
+        if len(v.Entries) == 0 {
+            if v.Join == nil { _, _ = io.WriteString(w, "<p>You are not on any waitlist. Sold-out classes in the <a class=\"link\" href=\"/search\">search results</a> let you join one.</p>") }
+            _, _ = io.WriteString(w, "</div></div></section>")
+            return nil
+        }
+        _, _ = io.WriteString(w, "<div class=\"overflow-x-auto\"><table class=\"table\"><thead><tr><th>Train</th><th>Class</th><th>Passengers</th><th>Status</th><th></th></tr></thead><tbody>")
+        for _, e := range v.Entries {
+            t := e.Trip
+            _, _ = io.WriteString(w, "<tr data-status=\""+esc(e.Status)+"\"><td>"+esc(t.TrainName)+" ("+esc(t.TrainCode)+") · "+esc(e.From)+" "+esc(t.Depart)+" → "+esc(e.To)+" · "+esc(t.ServiceDate)+"</td><td class=\"capitalize\">"+esc(e.Class)+"</td><td>"+strconv.Itoa(e.Seats)+"</td><td>")
+            switch e.Status {
+            case booking.WaitWaiting:
+                _, _ = io.WriteString(w, "Waiting · <span data-position>#"+strconv.Itoa(e.Position)+"</span> in line")
+            case booking.WaitOffered:
+                _, _ = io.WriteString(w, "<span class=\"badge badge-success\">Seats held for you</span>")
+                if e.OfferUntil != nil { _, _ = io.WriteString(w, " until <time datetime=\""+e.OfferUntil.UTC().Format(time.RFC3339)+"\">"+e.OfferUntil.Local().Format("15:04")+"</time>") }
+            default:
+                _, _ = io.WriteString(w, "<span class=\"capitalize\">"+esc(e.Status)+"</span>")
+            }
+            _, _ = io.WriteString(w, "</td><td class=\"flex gap-2\">")
+            if e.Status == booking.WaitOffered {
+                _, _ = io.WriteString(w, "<a class=\"btn btn-sm btn-primary\" href=\"/seatmap?"+qs("trip", e.TripID, "from", e.From, "to", e.To, "class", e.Class, "pax", strconv.Itoa(e.Seats))+"\">Continue booking</a>")
+            }
+            if e.Status == booking.WaitWaiting || e.Status == booking.WaitOffered {
+                _, _ = io.WriteString(w, "<form method=\"post\" action=\"/waitlist/leave\"><input type=\"hidden\" name=\"id\" value=\""+esc(e.ID)+"\"><button class=\"btn btn-sm btn-ghost\">Leave</button></form>")
+            }
+            _, _ = io.WriteString(w, "</td></tr>")
+        }
+        _, _ = io.WriteString(w, "</tbody></table></div>")
+        _, _ = io.WriteString(w, "</div></div></section>")
+        return nil
+    })
+    return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error { return LayoutSEO(SEO{Title: "Waitlist", Description: "Your places on waitlists for sold-out trains", Canonical: "/waitlist"}).Render(templ.WithChildren(ctx, body), w) })
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+  "bufio"
+  "context"
+  "errors"
+  "fmt"
+  "os"
+  "strings"
+  "time"
+
+  "github.com/spf13/cobra"
+  "gothicforge3/internal/db"
+  "gothicforge3/internal/env"
+  "gothicforge3/internal/gtfs"
+  "gothicforge3/internal/schedule"
+)
+
+var (
+  gtfsDryRun       bool
+  gtfsYes          bool
+  gtfsPrune        bool
+  gtfsDefaultPrice int64
+  gtfsGenerate     bool
+  gtfsOut          string
+)
+
+var gtfsCmd = &cobra.Command{
+  Use:   "gtfs",
+  Short: "Import/export timetables as GTFS feeds",
+}
+
+var gtfsImportCmd = &cobra.Command{
+  Use:   "import <feed.zip>",
+  Short: "Validate a GTFS feed, show what changes, then apply it",
+  Long: "Maps stops.txt → stations, routes.txt → trains, trips.txt + stop_times.txt → routes and timetable templates,\n" +
+    "calendar.txt + calendar_dates.txt → service_calendars. Nothing is written until you confirm (or pass --yes).",
+  Args: cobra.ExactArgs(1),
+  RunE: func(cmd *cobra.Command, args []string) error {
+    banner()
+    _ = env.Load()
+    feed, err := gtfs.ReadFile(args[0])
+    if err != nil { return err }
+    problems := gtfs.Validate(feed)
+    for _, p := range problems { fmt.Println("  " + p.String()) }
+    if gtfs.HasErrors(problems) {
+      return errors.New("feed is invalid; nothing was imported")
+    }
+    fmt.Printf("✅ Feed valid: %d stops, %d routes, %d trips, %d calendars\n", len(feed.Stops), len(feed.Routes), len(feed.Trips), len(feed.Calendars)+len(feed.CalendarDates))
+    if os.Getenv("DATABASE_URL") == "" {
+      return errors.New("DATABASE_URL is not set; cannot compare with the database")
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+    defer cancel()
+    if err := db.Connect(ctx); err != nil { return err }
+    defer db.Close()
+    cur, err := gtfs.LoadSnapshot(ctx, db.Pool())
+    if err != nil { return err }
+    next := gtfs.FromFeed(feed, gtfsDefaultPrice)
+    diff := gtfs.Compare(cur, next, gtfsPrune)
+    fmt.Println("Changes")
+    for _, c := range diff.Changes { fmt.Println("  " + c.String()) }
+    fmt.Printf("  • %d added, %d updated, %d deactivated, %d unchanged, %d not in feed (kept)\n",
+      diff.Count("+"), diff.Count("~"), diff.Count("-"), diff.Unchanged, diff.Kept)
+    if len(diff.Changes) == 0 {
+      fmt.Println("Nothing to change.")
+      return nil
+    }
+    if gtfsDryRun { return nil }
+    if !gtfsYes {
+      fmt.Print("  • Apply these changes? [y/N]: ")
+      ans, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+      ans = strings.ToLower(strings.TrimSpace(ans))
+      if ans != "y" && ans != "yes" {
+        fmt.Println("    → aborted, nothing was written")
+        return nil
+      }
+    }
+    if err := gtfs.Apply(ctx, db.Pool(), next, gtfs.ApplyOptions{Prune: gtfsPrune}); err != nil { return err }
+    fmt.Println("✅ Feed imported")
+    if gtfsGenerate {
+      res, err := schedule.Generate(ctx, db.Pool(), schedule.Options{From: time.Now(), Days: schedule.WindowDays()})
+      if err != nil { return err }
+      fmt.Printf("  • generated %d trips (%d seats) for the next %d days\n", res.Created, res.Seats, schedule.WindowDays())
+    }
+    return nil
+  },
+}
+
+var gtfsExportCmd = &cobra.Command{
+  Use:   "export",
+  Short: "Write stations, trains, timetables and calendars as a GTFS zip",
+  RunE: func(cmd *cobra.Command, args []string) error {
+    banner()
+    _ = env.Load()
+    if os.Getenv("DATABASE_URL") == "" {
+      return errors.New("DATABASE_URL is not set; cannot export")
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+    defer cancel()
+    if err := db.Connect(ctx); err != nil { return err }
+    defer db.Close()
+    snap, err := gtfs.LoadSnapshot(ctx, db.Pool())
+    if err != nil { return err }
+    feed := gtfs.ToFeed(snap)
+    f, err := os.Create(gtfsOut)
+    if err != nil { return err }
+    if err := gtfs.Write(f, feed); err != nil {
+      f.Close()
+      return err
+    }
+    if err := f.Close(); err != nil { return err }
+    fmt.Printf("✅ Wrote %s: %d stops, %d routes, %d trips\n", gtfsOut, len(feed.Stops), len(feed.Routes), len(feed.Trips))
+    return nil
+  },
+}
+
+func init() {
+  gtfsImportCmd.Flags().BoolVar(&gtfsDryRun, "dry-run", false, "validate and show the changes without writing")
+  gtfsImportCmd.Flags().BoolVar(&gtfsYes, "yes", false, "apply without asking")
+  gtfsImportCmd.Flags().BoolVar(&gtfsPrune, "prune", false, "deactivate departures from an earlier feed that are missing from this one")
+  gtfsImportCmd.Flags().Int64Var(&gtfsDefaultPrice, "default-price", 150000, "base price (IDR) for trips without a fare rule")
+  gtfsImportCmd.Flags().BoolVar(&gtfsGenerate, "generate", true, "generate dated trips for SCHEDULE_WINDOW_DAYS after importing")
+  gtfsExportCmd.Flags().StringVar(&gtfsOut, "out", "gtfs.zip", "output file")
+  gtfsCmd.AddCommand(gtfsImportCmd)
+  gtfsCmd.AddCommand(gtfsExportCmd)
+  rootCmd.AddCommand(gtfsCmd)
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+  "text/tabwriter"
+  "time"
+
+  "github.com/spf13/cobra"
+  "gothicforge3/internal/db"
+  "gothicforge3/internal/env"
+  "gothicforge3/internal/jobs"
+)
+
+var (
+  jobsStatus string
+  jobsKind   string
+  jobsLimit  int
+  jobsFailed bool
+  jobsAge    time.Duration
+)
+
+var jobsCmd = &cobra.Command{
+  Use:   "jobs",
+  Short: "List, retry and purge background jobs",
+  Long: "The server runs deferred and scheduled work (hold sweeps, payment deadlines, trip generation, session cleanup)\n" +
+    "as jobs in Postgres, or in Valkey with JOBS_BACKEND=valkey. Failed jobs stay until retried or purged.",
+}
+
+// withJobs opens the backend selected by JOBS_BACKEND for a jobs subcommand.
+func withJobs(run func(ctx context.Context, b jobs.Backend) error) error {
+  banner()
+  _ = env.Load()
+  ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+  defer cancel()
+  var pool jobs.DB
+  if name := strings.ToLower(strings.TrimSpace(env.Get("JOBS_BACKEND", "postgres"))); name != "valkey" && name != "redis" {
+    if os.Getenv("DATABASE_URL") == "" {
+      return errors.New("DATABASE_URL is not set; cannot read the jobs table")
+    }
+    if err := db.Connect(ctx); err != nil { return err }
+    defer db.Close()
+    pool = db.Pool()
+  }
+  b, err := jobs.FromEnv(pool)
+  if err != nil { return err }
+  if v, ok := b.(*jobs.Valkey); ok { defer v.Close() }
+  return run(ctx, b)
+}
+
+var jobsListCmd = &cobra.Command{
+  Use:   "list",
+  Short: "List jobs, newest first (--status queued|running|done|failed, --kind)",
+  RunE: func(cmd *cobra.Command, args []string) error {
+    switch jobsStatus {
+    case "", jobs.StatusQueued, jobs.StatusRunning, jobs.StatusDone, jobs.StatusFailed:
+    default:
+      return fmt.Errorf("--status %q: want queued, running, done or failed", jobsStatus)
+    }
+    return withJobs(func(ctx context.Context, b jobs.Backend) error {
+      list, err := b.List(ctx, jobs.Filter{Status: jobsStatus, Kind: jobsKind, Limit: jobsLimit})
+      if err != nil { return err }
+      if len(list) == 0 {
+        fmt.Println("No jobs match.")
+        return nil
+      }
+      tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+      fmt.Fprintln(tw, "ID\tKIND\tSTATUS\tATTEMPTS\tRUN AT\tWORKER\tLAST ERROR")
+      for _, j := range list {
+        worker := j.LockedBy
+        if worker == "" { worker = "-" }
+        lastErr := j.LastError
+        if len(lastErr) > 60 { lastErr = lastErr[:57] + "..." }
+        if lastErr == "" { lastErr = "-" }
+        fmt.Fprintf(tw, "%d\t%s\t%s\t%d/%d\t%s\t%s\t%s\n", j.ID, j.Kind, j.Status, j.Attempts, j.MaxAttempts,
+          j.RunAt.Local().Format("2006-01-02 15:04:05"), worker, lastErr)
+      }
+      return tw.Flush()
+    })
+  },
+}
+
+var jobsRetryCmd = &cobra.Command{
+  Use:   "retry [ID...]",
+  Short: "Queue failed jobs again with fresh attempts (by id, or --failed for every failed job)",
+  RunE: func(cmd *cobra.Command, args []string) error {
+    var ids []int64
+    for _, a := range args {
+      id, err := strconv.ParseInt(a, 10, 64)
+      if err != nil { return fmt.Errorf("job id %q: want a number", a) }
+      ids = append(ids, id)
+    }
+    if len(ids) == 0 && !jobsFailed { return errors.New("pass job ids, or --failed to retry every failed job") }
+    if len(ids) > 0 && jobsFailed { return errors.New("use either job ids or --failed") }
+    return withJobs(func(ctx context.Context, b jobs.Backend) error {
+      n, err := b.Retry(ctx, jobsKind, ids...)
+      if err != nil { return err }
+      fmt.Printf("✅ %d jobs queued again; the server's workers run them shortly\n", n)
+      return nil
+    })
+  },
+}
+
+var jobsPurgeCmd = &cobra.Command{
+  Use:   "purge",
+  Short: "Delete done and failed jobs that finished longer than --older-than ago",
+  RunE: func(cmd *cobra.Command, args []string) error {
+    switch jobsStatus {
+    case "", jobs.StatusDone, jobs.StatusFailed:
+    default:
+      return fmt.Errorf("--status %q: want done or failed", jobsStatus)
+    }
+    if jobsAge < 0 { return errors.New("--older-than must not be negative") }
+    return withJobs(func(ctx context.Context, b jobs.Backend) error {
+      n, err := b.Purge(ctx, jobsStatus, jobsAge)
+      if err != nil { return err }
+      fmt.Printf("✅ %d jobs deleted\n", n)
+      return nil
+    })
+  },
+}
+
+func init() {
+  jobsListCmd.Flags().StringVar(&jobsStatus, "status", "", "only jobs in this status")
+  jobsListCmd.Flags().StringVar(&jobsKind, "kind", "", "only this kind, e.g. schedule.generate")
+  jobsListCmd.Flags().IntVar(&jobsLimit, "limit", 50, "at most this many jobs")
+  jobsRetryCmd.Flags().BoolVar(&jobsFailed, "failed", false, "retry every failed job")
+  jobsRetryCmd.Flags().StringVar(&jobsKind, "kind", "", "with --failed, only this kind")
+  jobsPurgeCmd.Flags().StringVar(&jobsStatus, "status", "", "only done or only failed jobs (default: both)")
+  jobsPurgeCmd.Flags().DurationVar(&jobsAge, "older-than", 24*time.Hour, "keep jobs that finished more recently than this")
+  jobsCmd.AddCommand(jobsListCmd)
+  jobsCmd.AddCommand(jobsRetryCmd)
+  jobsCmd.AddCommand(jobsPurgeCmd)
+  rootCmd.AddCommand(jobsCmd)
+}
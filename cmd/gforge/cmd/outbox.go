@@ -0,0 +1,155 @@
+package cmd
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "os"
+  "strconv"
+  "text/tabwriter"
+  "time"
+
+  "github.com/spf13/cobra"
+  "gothicforge3/internal/db"
+  "gothicforge3/internal/env"
+  "gothicforge3/internal/outbox"
+)
+
+var (
+  outboxStatus string
+  outboxTopic  string
+  outboxRef    string
+  outboxLimit  int
+  outboxDead   bool
+)
+
+var outboxCmd = &cobra.Command{
+  Use:   "outbox",
+  Short: "Inspect and replay side effects waiting in the transactional outbox",
+  Long: "Booking changes write their side effects (emails, webhooks) to the outbox table in the same transaction;\n" +
+    "the server's dispatcher delivers them with retries and marks them dead after OUTBOX_MAX_ATTEMPTS.",
+}
+
+// withOutboxDB connects to DATABASE_URL for an outbox subcommand.
+func withOutboxDB(run func(ctx context.Context) error) error {
+  banner()
+  _ = env.Load()
+  if os.Getenv("DATABASE_URL") == "" {
+    return errors.New("DATABASE_URL is not set; cannot read the outbox")
+  }
+  ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+  defer cancel()
+  if err := db.Connect(ctx); err != nil { return err }
+  defer db.Close()
+  return run(ctx)
+}
+
+var outboxStatsCmd = &cobra.Command{
+  Use:   "stats",
+  Short: "Count messages per topic and status",
+  RunE: func(cmd *cobra.Command, args []string) error {
+    return withOutboxDB(func(ctx context.Context) error {
+      stats, err := outbox.Stats(ctx, db.Pool())
+      if err != nil { return err }
+      if len(stats) == 0 {
+        fmt.Println("The outbox is empty.")
+        return nil
+      }
+      tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+      fmt.Fprintln(tw, "TOPIC\tSTATUS\tCOUNT\tOLDEST")
+      for _, s := range stats {
+        fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", s.Topic, s.Status, s.Count, s.Oldest.Local().Format("2006-01-02 15:04"))
+      }
+      return tw.Flush()
+    })
+  },
+}
+
+var outboxListCmd = &cobra.Command{
+  Use:   "list",
+  Short: "List messages not delivered yet (or --status delivered|pending|dead)",
+  RunE: func(cmd *cobra.Command, args []string) error {
+    switch outboxStatus {
+    case "", outbox.StatusPending, outbox.StatusDelivered, outbox.StatusDead:
+    default:
+      return fmt.Errorf("--status %q: want pending, delivered or dead", outboxStatus)
+    }
+    return withOutboxDB(func(ctx context.Context) error {
+      msgs, err := outbox.List(ctx, db.Pool(), outbox.Filter{Status: outboxStatus, Topic: outboxTopic, Ref: outboxRef, Limit: outboxLimit})
+      if err != nil { return err }
+      if len(msgs) == 0 && outboxStatus == "" {
+        fmt.Println("Nothing waiting: every message was delivered.")
+        return nil
+      }
+      if len(msgs) == 0 {
+        fmt.Println("No messages match.")
+        return nil
+      }
+      tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+      fmt.Fprintln(tw, "ID\tTOPIC\tREF\tSTATUS\tATTEMPTS\tNEXT\tLAST ERROR")
+      for _, m := range msgs {
+        next := "-"
+        if m.Status == outbox.StatusPending { next = m.AvailableAt.Local().Format("2006-01-02 15:04:05") }
+        lastErr := m.LastError
+        if len(lastErr) > 60 { lastErr = lastErr[:57] + "..." }
+        if lastErr == "" { lastErr = "-" }
+        fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%s\t%s\n", m.ID, m.Topic, m.Ref, m.Status, m.Attempts, next, lastErr)
+      }
+      return tw.Flush()
+    })
+  },
+}
+
+var outboxShowCmd = &cobra.Command{
+  Use:   "show <ID>",
+  Short: "Print one message with its payload and last error",
+  Args:  cobra.ExactArgs(1),
+  RunE: func(cmd *cobra.Command, args []string) error {
+    id, err := strconv.ParseInt(args[0], 10, 64)
+    if err != nil { return fmt.Errorf("message id %q: want a number", args[0]) }
+    return withOutboxDB(func(ctx context.Context) error {
+      m, err := outbox.Get(ctx, db.Pool(), id)
+      if err != nil { return err }
+      out, err := json.MarshalIndent(m, "", "  ")
+      if err != nil { return err }
+      fmt.Println(string(out))
+      return nil
+    })
+  },
+}
+
+var outboxReplayCmd = &cobra.Command{
+  Use:   "replay [ID...]",
+  Short: "Make messages due again with fresh attempts (by id, or --dead for every dead message)",
+  RunE: func(cmd *cobra.Command, args []string) error {
+    var ids []int64
+    for _, a := range args {
+      id, err := strconv.ParseInt(a, 10, 64)
+      if err != nil { return fmt.Errorf("message id %q: want a number", a) }
+      ids = append(ids, id)
+    }
+    if len(ids) == 0 && !outboxDead { return errors.New("pass message ids, or --dead to replay every dead message") }
+    if len(ids) > 0 && outboxDead { return errors.New("use either message ids or --dead") }
+    return withOutboxDB(func(ctx context.Context) error {
+      n, err := outbox.Replay(ctx, db.Pool(), outboxTopic, ids...)
+      if err != nil { return err }
+      fmt.Printf("✅ %d messages queued again; the server's dispatcher delivers them shortly\n", n)
+      return nil
+    })
+  },
+}
+
+func init() {
+  outboxListCmd.Flags().StringVar(&outboxStatus, "status", "", "only messages in this status (default: not delivered)")
+  outboxListCmd.Flags().StringVar(&outboxTopic, "topic", "", "only this topic, e.g. booking.paid")
+  outboxListCmd.Flags().StringVar(&outboxRef, "ref", "", "only messages about this id, e.g. a booking id")
+  outboxListCmd.Flags().IntVar(&outboxLimit, "limit", 50, "at most this many messages")
+  outboxReplayCmd.Flags().BoolVar(&outboxDead, "dead", false, "replay every dead message")
+  outboxReplayCmd.Flags().StringVar(&outboxTopic, "topic", "", "with --dead, only this topic")
+  outboxCmd.AddCommand(outboxStatsCmd)
+  outboxCmd.AddCommand(outboxListCmd)
+  outboxCmd.AddCommand(outboxShowCmd)
+  outboxCmd.AddCommand(outboxReplayCmd)
+  rootCmd.AddCommand(outboxCmd)
+}
@@ -0,0 +1,326 @@
+package cmd
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "net/http"
+  "os"
+  "os/signal"
+  "strconv"
+  "strings"
+  "text/tabwriter"
+  "time"
+
+  "github.com/spf13/cobra"
+  "gothicforge3/internal/db"
+  "gothicforge3/internal/env"
+  "gothicforge3/internal/partner"
+)
+
+var (
+  partnerFilter  string
+  webhookEvents  []string
+  webhookFilter  string
+  bookingFilter  string
+  deliveryStatus string
+  deliveryLimit  int
+  listenAddr     string
+  listenSecret   string
+  listenFail     bool
+)
+
+var partnersCmd = &cobra.Command{
+  Use:   "partners",
+  Short: "Manage travel-agent partners, their API keys and webhook subscriptions",
+  Long: "Partners book through /api/partner with an API key and receive HMAC-signed webhooks\n" +
+    "(" + strings.Join(partner.Events, ", ") + ") for bookings they made.\n" +
+    "The server sends deliveries with retries (WEBHOOK_MAX_ATTEMPTS); every attempt is kept in the delivery log.",
+}
+
+// withPartnersDB connects to DATABASE_URL for a partners subcommand.
+func withPartnersDB(run func(ctx context.Context) error) error {
+  banner()
+  _ = env.Load()
+  if os.Getenv("DATABASE_URL") == "" {
+    return errors.New("DATABASE_URL is not set; cannot manage partners")
+  }
+  ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+  defer cancel()
+  if err := db.Connect(ctx); err != nil { return err }
+  defer db.Close()
+  return run(ctx)
+}
+
+var partnersAddCmd = &cobra.Command{
+  Use:   "add <NAME>",
+  Short: "Add a partner and print its API key (shown only once)",
+  Args:  cobra.ExactArgs(1),
+  RunE: func(cmd *cobra.Command, args []string) error {
+    return withPartnersDB(func(ctx context.Context) error {
+      p, key, err := partner.Create(ctx, db.Pool(), args[0])
+      if err != nil { return err }
+      fmt.Printf("✅ Partner %q added: %s\n", p.Name, p.ID)
+      fmt.Printf("   API key (store it now, it cannot be shown again): %s\n", key)
+      fmt.Println("   Call the API with: Authorization: Bearer <API key>")
+      return nil
+    })
+  },
+}
+
+var partnersListCmd = &cobra.Command{
+  Use:   "list",
+  Short: "List partners",
+  RunE: func(cmd *cobra.Command, args []string) error {
+    return withPartnersDB(func(ctx context.Context) error {
+      list, err := partner.List(ctx, db.Pool())
+      if err != nil { return err }
+      if len(list) == 0 {
+        fmt.Println("No partners yet: add one with gforge partners add NAME.")
+        return nil
+      }
+      tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+      fmt.Fprintln(tw, "ID\tNAME\tACTIVE\tCREATED")
+      for _, p := range list {
+        fmt.Fprintf(tw, "%s\t%s\t%t\t%s\n", p.ID, p.Name, p.Active, p.CreatedAt.Local().Format("2006-01-02 15:04"))
+      }
+      return tw.Flush()
+    })
+  },
+}
+
+func setPartnerActive(active bool) func(cmd *cobra.Command, args []string) error {
+  return func(cmd *cobra.Command, args []string) error {
+    return withPartnersDB(func(ctx context.Context) error {
+      if err := partner.SetActive(ctx, db.Pool(), args[0], active); err != nil { return err }
+      if active {
+        fmt.Println("✅ Partner enabled: its API key works and webhooks are sent again")
+      } else {
+        fmt.Println("✅ Partner disabled: its API key is refused and no webhooks are sent")
+      }
+      return nil
+    })
+  }
+}
+
+var partnersDisableCmd = &cobra.Command{
+  Use:   "disable <PARTNER_ID>",
+  Short: "Refuse a partner's API key and stop its webhooks",
+  Args:  cobra.ExactArgs(1),
+  RunE:  setPartnerActive(false),
+}
+
+var partnersEnableCmd = &cobra.Command{
+  Use:   "enable <PARTNER_ID>",
+  Short: "Re-enable a disabled partner",
+  Args:  cobra.ExactArgs(1),
+  RunE:  setPartnerActive(true),
+}
+
+var partnersRotateKeyCmd = &cobra.Command{
+  Use:   "rotate-key <PARTNER_ID>",
+  Short: "Replace a partner's API key and print the new one (the old key stops working)",
+  Args:  cobra.ExactArgs(1),
+  RunE: func(cmd *cobra.Command, args []string) error {
+    return withPartnersDB(func(ctx context.Context) error {
+      key, err := partner.RotateKey(ctx, db.Pool(), args[0])
+      if err != nil { return err }
+      fmt.Printf("✅ New API key (store it now, it cannot be shown again): %s\n", key)
+      return nil
+    })
+  },
+}
+
+var partnersWebhooksCmd = &cobra.Command{
+  Use:   "webhooks",
+  Short: "Manage partner webhook subscriptions",
+}
+
+var partnersWebhooksAddCmd = &cobra.Command{
+  Use:   "add <PARTNER_ID> <URL>",
+  Short: "Subscribe a URL to a partner's booking events and print its signing secret",
+  Args:  cobra.ExactArgs(2),
+  RunE: func(cmd *cobra.Command, args []string) error {
+    return withPartnersDB(func(ctx context.Context) error {
+      w, err := partner.AddWebhook(ctx, db.Pool(), args[0], args[1], webhookEvents)
+      if err != nil { return err }
+      fmt.Printf("✅ Webhook %s added for %s\n", w.ID, strings.Join(w.Events, ", "))
+      fmt.Printf("   Signing secret (store it now, it cannot be shown again): %s\n", w.Secret)
+      fmt.Printf("   Try it locally with: gforge partners listen --secret %s\n", w.Secret)
+      return nil
+    })
+  },
+}
+
+var partnersWebhooksListCmd = &cobra.Command{
+  Use:   "list",
+  Short: "List active webhook subscriptions (of every partner, or --partner)",
+  RunE: func(cmd *cobra.Command, args []string) error {
+    return withPartnersDB(func(ctx context.Context) error {
+      list, err := partner.Webhooks(ctx, db.Pool(), partnerFilter)
+      if err != nil { return err }
+      if len(list) == 0 {
+        fmt.Println("No webhook subscriptions.")
+        return nil
+      }
+      tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+      fmt.Fprintln(tw, "ID\tPARTNER\tURL\tEVENTS")
+      for _, w := range list {
+        fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", w.ID, w.PartnerID, w.URL, strings.Join(w.Events, ","))
+      }
+      return tw.Flush()
+    })
+  },
+}
+
+var partnersWebhooksRemoveCmd = &cobra.Command{
+  Use:   "remove <WEBHOOK_ID>",
+  Short: "Remove a subscription; its pending deliveries fail, the log stays",
+  Args:  cobra.ExactArgs(1),
+  RunE: func(cmd *cobra.Command, args []string) error {
+    return withPartnersDB(func(ctx context.Context) error {
+      if err := partner.RemoveWebhook(ctx, db.Pool(), "", args[0]); err != nil { return err }
+      fmt.Println("✅ Webhook removed")
+      return nil
+    })
+  },
+}
+
+var partnersDeliveriesCmd = &cobra.Command{
+  Use:   "deliveries",
+  Short: "Show the webhook delivery log, newest first",
+  RunE: func(cmd *cobra.Command, args []string) error {
+    switch deliveryStatus {
+    case "", partner.StatusPending, partner.StatusDelivered, partner.StatusFailed:
+    default:
+      return fmt.Errorf("--status %q: want pending, delivered or failed", deliveryStatus)
+    }
+    return withPartnersDB(func(ctx context.Context) error {
+      list, err := partner.Deliveries(ctx, db.Pool(), partner.DeliveryFilter{
+        PartnerID: partnerFilter, WebhookID: webhookFilter, BookingID: bookingFilter, Status: deliveryStatus, Limit: deliveryLimit,
+      })
+      if err != nil { return err }
+      if len(list) == 0 {
+        fmt.Println("No deliveries match.")
+        return nil
+      }
+      tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+      fmt.Fprintln(tw, "ID\tEVENT\tBOOKING\tSTATUS\tATTEMPTS\tHTTP\tCREATED\tLAST ERROR")
+      for _, d := range list {
+        code := "-"
+        if d.ResponseStatus != 0 { code = strconv.Itoa(d.ResponseStatus) }
+        lastErr := d.LastError
+        if len(lastErr) > 60 { lastErr = lastErr[:57] + "..." }
+        if lastErr == "" { lastErr = "-" }
+        event := d.Event
+        if d.ResentFrom != nil { event += fmt.Sprintf(" (resend of %d)", *d.ResentFrom) }
+        fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", d.ID, event, d.BookingID, d.Status, d.Attempts, code, d.CreatedAt.Local().Format("2006-01-02 15:04:05"), lastErr)
+      }
+      return tw.Flush()
+    })
+  },
+}
+
+var partnersResendCmd = &cobra.Command{
+  Use:   "resend <DELIVERY_ID>",
+  Short: "Queue a delivery's event again as a new delivery with fresh attempts",
+  Args:  cobra.ExactArgs(1),
+  RunE: func(cmd *cobra.Command, args []string) error {
+    id, err := strconv.ParseInt(args[0], 10, 64)
+    if err != nil { return fmt.Errorf("delivery id %q: want a number", args[0]) }
+    return withPartnersDB(func(ctx context.Context) error {
+      d, err := partner.Resend(ctx, db.Pool(), "", id)
+      if err != nil { return err }
+      fmt.Printf("✅ Delivery %d queued (%s %s); the server sends it shortly\n", d.ID, d.Event, d.EventID)
+      return nil
+    })
+  },
+}
+
+var partnersListenCmd = &cobra.Command{
+  Use:   "listen",
+  Short: "Run a local webhook receiver that prints deliveries and checks their signatures",
+  Long: "Point a subscription at http://127.0.0.1:9000/ (plain http is accepted outside production)\n" +
+    "and every delivery is printed with its headers and whether the signature verifies with --secret.\n" +
+    "The receiver answers 200 for a valid signature and 401 otherwise; --fail answers 500 to watch retries.",
+  RunE: func(cmd *cobra.Command, args []string) error {
+    banner()
+    if listenSecret == "" {
+      fmt.Println("⚠️  No --secret: signatures are shown but not verified")
+    }
+    mux := http.NewServeMux()
+    mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+      body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+      if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+      }
+      fmt.Printf("\n%s %s %s\n", time.Now().Format("15:04:05"), r.Method, r.URL.Path)
+      for _, h := range []string{partner.EventHeader, partner.EventIDHeader, partner.DeliveryHeader, partner.SignatureHeader} {
+        fmt.Printf("  %s: %s\n", h, r.Header.Get(h))
+      }
+      var pretty any
+      if json.Unmarshal(body, &pretty) == nil {
+        out, _ := json.MarshalIndent(pretty, "  ", "  ")
+        fmt.Printf("  %s\n", out)
+      } else {
+        fmt.Printf("  %q\n", body)
+      }
+      status := http.StatusOK
+      switch {
+      case listenSecret == "":
+        fmt.Println("  signature: not checked")
+      default:
+        if err := partner.Verify(listenSecret, r.Header.Get(partner.SignatureHeader), body, time.Now()); err != nil {
+          fmt.Printf("  ❌ signature: %v\n", err)
+          status = http.StatusUnauthorized
+        } else {
+          fmt.Println("  ✅ signature: valid")
+        }
+      }
+      if listenFail && status == http.StatusOK {
+        status = http.StatusInternalServerError
+      }
+      fmt.Printf("  → %d\n", status)
+      w.WriteHeader(status)
+    })
+    srv := &http.Server{Addr: listenAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+    go func() {
+      <-ctx.Done()
+      _ = srv.Close()
+    }()
+    fmt.Printf("Listening for webhooks on http://%s/ (Ctrl+C to stop)\n", listenAddr)
+    if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) { return err }
+    return nil
+  },
+}
+
+func init() {
+  partnersWebhooksAddCmd.Flags().StringSliceVar(&webhookEvents, "events", nil, "events to subscribe to (default: all of "+strings.Join(partner.Events, ", ")+")")
+  partnersWebhooksListCmd.Flags().StringVar(&partnerFilter, "partner", "", "only this partner's subscriptions")
+  partnersDeliveriesCmd.Flags().StringVar(&partnerFilter, "partner", "", "only this partner's deliveries")
+  partnersDeliveriesCmd.Flags().StringVar(&webhookFilter, "webhook", "", "only deliveries to this subscription")
+  partnersDeliveriesCmd.Flags().StringVar(&bookingFilter, "booking", "", "only deliveries about this booking")
+  partnersDeliveriesCmd.Flags().StringVar(&deliveryStatus, "status", "", "only deliveries in this status (pending, delivered or failed)")
+  partnersDeliveriesCmd.Flags().IntVar(&deliveryLimit, "limit", 50, "at most this many deliveries")
+  partnersListenCmd.Flags().StringVar(&listenAddr, "addr", "127.0.0.1:9000", "address to listen on")
+  partnersListenCmd.Flags().StringVar(&listenSecret, "secret", "", "the subscription's signing secret (whsec_…)")
+  partnersListenCmd.Flags().BoolVar(&listenFail, "fail", false, "answer 500 to valid deliveries, to test retries")
+  partnersWebhooksCmd.AddCommand(partnersWebhooksAddCmd)
+  partnersWebhooksCmd.AddCommand(partnersWebhooksListCmd)
+  partnersWebhooksCmd.AddCommand(partnersWebhooksRemoveCmd)
+  partnersCmd.AddCommand(partnersAddCmd)
+  partnersCmd.AddCommand(partnersListCmd)
+  partnersCmd.AddCommand(partnersDisableCmd)
+  partnersCmd.AddCommand(partnersEnableCmd)
+  partnersCmd.AddCommand(partnersRotateKeyCmd)
+  partnersCmd.AddCommand(partnersWebhooksCmd)
+  partnersCmd.AddCommand(partnersDeliveriesCmd)
+  partnersCmd.AddCommand(partnersResendCmd)
+  partnersCmd.AddCommand(partnersListenCmd)
+  rootCmd.AddCommand(partnersCmd)
+}
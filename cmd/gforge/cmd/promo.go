@@ -0,0 +1,184 @@
+package cmd
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "os"
+  "strings"
+  "text/tabwriter"
+  "time"
+
+  "github.com/spf13/cobra"
+  "gothicforge3/internal/booking"
+  "gothicforge3/internal/db"
+  "gothicforge3/internal/env"
+)
+
+var (
+  promoPercent     int64
+  promoAmount      int64
+  promoMaxDiscount int64
+  promoMinTotal    int64
+  promoFrom        string
+  promoUntil       string
+  promoMaxUses     int
+  promoPerUser     int
+  promoRoutes      []string
+  promoTrains      []string
+  promoClasses     []string
+  promoDescription string
+)
+
+var promoCmd = &cobra.Command{
+  Use:   "promo",
+  Short: "Manage promo codes entered at checkout",
+}
+
+// withPromoDB connects to DATABASE_URL for a promo subcommand.
+func withPromoDB(run func(ctx context.Context) error) error {
+  banner()
+  _ = env.Load()
+  if os.Getenv("DATABASE_URL") == "" {
+    return errors.New("DATABASE_URL is not set; cannot manage promo codes")
+  }
+  ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+  defer cancel()
+  if err := db.Connect(ctx); err != nil { return err }
+  defer db.Close()
+  return run(ctx)
+}
+
+var promoAddCmd = &cobra.Command{
+  Use:   "add <CODE>",
+  Short: "Create a promo code (--percent or --amount)",
+  Long: "Creates an active promo code. --percent takes that share off the eligible seats (capped by --max-discount),\n" +
+    "--amount takes a fixed number of rupiah off. --routes, --trains and --classes limit which seats count.",
+  Args: cobra.ExactArgs(1),
+  RunE: func(cmd *cobra.Command, args []string) error {
+    p := booking.Promo{Code: args[0], Description: promoDescription, MaxDiscount: promoMaxDiscount, MinTotal: promoMinTotal,
+      MaxUses: promoMaxUses, MaxUsesPerUser: promoPerUser, Routes: promoRoutes, Trains: promoTrains, Classes: promoClasses}
+    switch {
+    case promoPercent > 0 && promoAmount > 0:
+      return errors.New("use either --percent or --amount")
+    case promoPercent > 0:
+      p.Kind, p.Value = booking.PromoPercent, promoPercent
+    case promoAmount > 0:
+      p.Kind, p.Value = booking.PromoFixed, promoAmount
+    default:
+      return errors.New("--percent or --amount is required")
+    }
+    var err error
+    if p.StartsAt, err = promoDate("--from", promoFrom); err != nil { return err }
+    if p.EndsAt, err = promoDate("--until", promoUntil); err != nil { return err }
+    return withPromoDB(func(ctx context.Context) error {
+      p, err := booking.CreatePromo(ctx, db.Pool(), p)
+      if err != nil { return err }
+      fmt.Printf("✅ Created %s (%s)\n", p.Code, promoValue(p))
+      return nil
+    })
+  },
+}
+
+// promoDate parses YYYY-MM-DD as midnight local time.
+func promoDate(flag, s string) (*time.Time, error) {
+  if s == "" { return nil, nil }
+  t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+  if err != nil { return nil, fmt.Errorf("%s %q: want YYYY-MM-DD", flag, s) }
+  return &t, nil
+}
+
+func promoValue(p booking.Promo) string {
+  if p.Kind == booking.PromoPercent {
+    s := fmt.Sprintf("%d%% off", p.Value)
+    if p.MaxDiscount > 0 { s += fmt.Sprintf(", up to Rp%d", p.MaxDiscount) }
+    return s
+  }
+  return fmt.Sprintf("Rp%d off", p.Value)
+}
+
+var promoListCmd = &cobra.Command{
+  Use:   "list",
+  Short: "List promo codes with their redemption counts",
+  RunE: func(cmd *cobra.Command, args []string) error {
+    return withPromoDB(func(ctx context.Context) error {
+      promos, err := booking.ListPromos(ctx, db.Pool())
+      if err != nil { return err }
+      if len(promos) == 0 {
+        fmt.Println("No promo codes yet. Create one with: gforge promo add CODE --percent 10")
+        return nil
+      }
+      tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+      fmt.Fprintln(tw, "CODE\tDISCOUNT\tVALID\tREDEEMED\tSAVED\tLIMITS\tSTATUS")
+      for _, p := range promos {
+        valid := "always"
+        if p.StartsAt != nil || p.EndsAt != nil {
+          from, until := "…", "…"
+          if p.StartsAt != nil { from = p.StartsAt.Local().Format("2006-01-02") }
+          if p.EndsAt != nil { until = p.EndsAt.Local().Format("2006-01-02") }
+          valid = from + " → " + until
+        }
+        redeemed := fmt.Sprint(p.Redemptions)
+        if p.MaxUses > 0 { redeemed += fmt.Sprintf("/%d", p.MaxUses) }
+        var limits []string
+        if p.MaxUsesPerUser > 0 { limits = append(limits, fmt.Sprintf("%d per user", p.MaxUsesPerUser)) }
+        if p.MinTotal > 0 { limits = append(limits, fmt.Sprintf("min Rp%d", p.MinTotal)) }
+        if len(p.Routes) > 0 { limits = append(limits, "routes "+strings.Join(p.Routes, ",")) }
+        if len(p.Trains) > 0 { limits = append(limits, "trains "+strings.Join(p.Trains, ",")) }
+        if len(p.Classes) > 0 { limits = append(limits, strings.Join(p.Classes, ",")) }
+        if len(limits) == 0 { limits = []string{"-"} }
+        status := "active"
+        if !p.Active { status = "disabled" }
+        fmt.Fprintf(tw, "%s\t%s\t%s\t%s\tRp%d\t%s\t%s\n", p.Code, promoValue(p), valid, redeemed, p.Discounted, strings.Join(limits, "; "), status)
+      }
+      return tw.Flush()
+    })
+  },
+}
+
+func promoSetActive(active bool) func(cmd *cobra.Command, args []string) error {
+  return func(cmd *cobra.Command, args []string) error {
+    return withPromoDB(func(ctx context.Context) error {
+      if err := booking.SetPromoActive(ctx, db.Pool(), args[0], active); err != nil { return err }
+      state := "disabled"
+      if active { state = "enabled" }
+      fmt.Printf("✅ %s %s\n", booking.NormalizePromoCode(args[0]), state)
+      return nil
+    })
+  }
+}
+
+var promoDisableCmd = &cobra.Command{
+  Use:   "disable <CODE>",
+  Short: "Stop accepting a promo code (bookings that used it keep their discount)",
+  Args:  cobra.ExactArgs(1),
+  RunE:  promoSetActive(false),
+}
+
+var promoEnableCmd = &cobra.Command{
+  Use:   "enable <CODE>",
+  Short: "Accept a disabled promo code again",
+  Args:  cobra.ExactArgs(1),
+  RunE:  promoSetActive(true),
+}
+
+func init() {
+  f := promoAddCmd.Flags()
+  f.Int64Var(&promoPercent, "percent", 0, "percent off the eligible seats (1-100)")
+  f.Int64Var(&promoAmount, "amount", 0, "rupiah off the eligible seats")
+  f.Int64Var(&promoMaxDiscount, "max-discount", 0, "cap in rupiah for --percent codes (0 = none)")
+  f.Int64Var(&promoMinTotal, "min-total", 0, "minimum eligible amount in rupiah")
+  f.StringVar(&promoFrom, "from", "", "first valid day, YYYY-MM-DD (default now)")
+  f.StringVar(&promoUntil, "until", "", "first day it is no longer valid, YYYY-MM-DD (default never)")
+  f.IntVar(&promoMaxUses, "max-uses", 0, "total redemptions allowed (0 = unlimited)")
+  f.IntVar(&promoPerUser, "per-user", 0, "redemptions allowed per account or contact email (0 = unlimited)")
+  f.StringSliceVar(&promoRoutes, "routes", nil, "only seats on these route codes, e.g. GMR-BD")
+  f.StringSliceVar(&promoTrains, "trains", nil, "only seats on these train codes, e.g. AP")
+  f.StringSliceVar(&promoClasses, "classes", nil, "only seats in these classes")
+  f.StringVar(&promoDescription, "description", "", "note shown in the list")
+  promoCmd.AddCommand(promoAddCmd)
+  promoCmd.AddCommand(promoListCmd)
+  promoCmd.AddCommand(promoDisableCmd)
+  promoCmd.AddCommand(promoEnableCmd)
+  rootCmd.AddCommand(promoCmd)
+}
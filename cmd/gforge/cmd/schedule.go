@@ -0,0 +1,72 @@
+package cmd
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "os"
+  "time"
+
+  "github.com/spf13/cobra"
+  "gothicforge3/internal/db"
+  "gothicforge3/internal/env"
+  "gothicforge3/internal/schedule"
+)
+
+var (
+  scheduleFrom   string
+  scheduleDays   int
+  scheduleDryRun bool
+)
+
+var scheduleCmd = &cobra.Command{
+  Use:   "schedule",
+  Short: "Timetable helpers (service calendar expansion)",
+}
+
+var scheduleGenerateCmd = &cobra.Command{
+  Use:   "generate",
+  Short: "Create trips, coaches and seats from service calendars for the next N days",
+  Long: "Expands service_calendars (weekday flags and holiday exceptions) with the active timetable_templates.\n" +
+    "Safe to re-run: existing departures are left alone. The server runs the same generator daily.",
+  RunE: func(cmd *cobra.Command, args []string) error {
+    banner()
+    _ = env.Load()
+    if os.Getenv("DATABASE_URL") == "" {
+      return errors.New("DATABASE_URL is not set; cannot generate trips")
+    }
+    from := time.Now()
+    if scheduleFrom != "" {
+      t, err := time.Parse(schedule.DateLayout, scheduleFrom)
+      if err != nil { return fmt.Errorf("--from %q: want YYYY-MM-DD", scheduleFrom) }
+      from = t
+    }
+    if scheduleDays == 0 { scheduleDays = schedule.WindowDays() }
+    if scheduleDays < 1 || scheduleDays > 366 { return fmt.Errorf("--days must be between 1 and 366") }
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+    defer cancel()
+    if err := db.Connect(ctx); err != nil { return err }
+    defer db.Close()
+    res, err := schedule.Generate(ctx, db.Pool(), schedule.Options{From: from, Days: scheduleDays, DryRun: scheduleDryRun})
+    if err != nil { return err }
+    verb := "Created"
+    if scheduleDryRun { verb = "Would create" }
+    fmt.Printf("Schedule %s … +%d days\n", from.Format(schedule.DateLayout), scheduleDays)
+    fmt.Printf("  • departures:  %d called for, %d already present\n", res.Planned, res.Existing)
+    fmt.Printf("  • %s:  %d trips, %d seats\n", verb, res.Created, res.Seats)
+    if len(res.Restored) > 0 { fmt.Printf("  • restored:    %d trips back in service\n", len(res.Restored)) }
+    if len(res.Cancelled) > 0 { fmt.Printf("  • cancelled:   %d unbooked trips no longer running\n", len(res.Cancelled)) }
+    for _, id := range res.Conflicts {
+      fmt.Printf("⚠️  trip %s has bookings but no longer runs per its calendar; handle it as a disruption\n", id)
+    }
+    return nil
+  },
+}
+
+func init() {
+  scheduleGenerateCmd.Flags().StringVar(&scheduleFrom, "from", "", "first service date, YYYY-MM-DD (default today)")
+  scheduleGenerateCmd.Flags().IntVar(&scheduleDays, "days", 0, "window length in days (default SCHEDULE_WINDOW_DAYS or 30)")
+  scheduleGenerateCmd.Flags().BoolVar(&scheduleDryRun, "dry-run", false, "report what would change without writing")
+  scheduleCmd.AddCommand(scheduleGenerateCmd)
+  rootCmd.AddCommand(scheduleCmd)
+}
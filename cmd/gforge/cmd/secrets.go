@@ -2,6 +2,9 @@ package cmd
 
 import (
   "bufio"
+  "crypto/ed25519"
+  "crypto/rand"
+  "encoding/base64"
   "fmt"
   "os"
   "path/filepath"
@@ -14,6 +17,7 @@ var (
   secretsSet string
   secretsGet string
   secretsGenJWT bool
+  secretsGenTicketKey bool
 )
 
 var secretsCmd = &cobra.Command{
@@ -22,8 +26,8 @@ var secretsCmd = &cobra.Command{
   RunE: func(cmd *cobra.Command, args []string) error {
     banner()
     envPath := filepath.Join(".env")
-    if secretsSet == "" && secretsGet == "" && !secretsGenJWT {
-      fmt.Println("Usage: gforge secrets --set KEY=VAL | --get KEY | --gen-jwt")
+    if secretsSet == "" && secretsGet == "" && !secretsGenJWT && !secretsGenTicketKey {
+      fmt.Println("Usage: gforge secrets --set KEY=VAL | --get KEY | --gen-jwt | --gen-ticket-key")
       return nil
     }
     // Ensure .env exists
@@ -70,6 +74,23 @@ var secretsCmd = &cobra.Command{
       }
       return nil
     }
+    if secretsGenTicketKey {
+      if strings.TrimSpace(kv["TICKET_SIGNING_KEY"]) != "" {
+        fmt.Println("✅ TICKET_SIGNING_KEY already set")
+        fmt.Println("   → No changes made (rotating it invalidates every issued ticket)")
+        return nil
+      }
+      pub, priv, err := ed25519.GenerateKey(rand.Reader)
+      if err != nil { return err }
+      kv["TICKET_SIGNING_KEY"] = base64.StdEncoding.EncodeToString(priv.Seed())
+      kv["TICKET_PUBLIC_KEY"] = base64.StdEncoding.EncodeToString(pub)
+      b := &strings.Builder{}
+      for k, val := range kv { fmt.Fprintf(b, "%s=%s\n", k, val) }
+      if err := os.WriteFile(envPath, []byte(b.String()), 0o600); err != nil { return err }
+      fmt.Println("✅ Generated ed25519 ticket signing key")
+      fmt.Printf("   → TICKET_PUBLIC_KEY=%s (share with gate devices and support tools)\n", kv["TICKET_PUBLIC_KEY"])
+      return nil
+    }
     if secretsSet != "" {
       parts := strings.SplitN(secretsSet, "=", 2)
       if len(parts) != 2 {
@@ -95,5 +116,6 @@ func init() {
   secretsCmd.Flags().StringVar(&secretsSet, "set", "", "set KEY=VAL")
   secretsCmd.Flags().StringVar(&secretsGet, "get", "", "get KEY")
   secretsCmd.Flags().BoolVar(&secretsGenJWT, "gen-jwt", false, "generate and set a strong JWT_SECRET in .env")
+  secretsCmd.Flags().BoolVar(&secretsGenTicketKey, "gen-ticket-key", false, "generate an ed25519 TICKET_SIGNING_KEY/TICKET_PUBLIC_KEY pair in .env")
   rootCmd.AddCommand(secretsCmd)
 }
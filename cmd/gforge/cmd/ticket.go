@@ -0,0 +1,83 @@
+package cmd
+
+import (
+  "crypto/ed25519"
+  "errors"
+  "fmt"
+  "strings"
+
+  "github.com/spf13/cobra"
+  "gothicforge3/internal/env"
+  "gothicforge3/internal/ticket"
+)
+
+var (
+  ticketPublicKey string
+  ticketTrip      string
+  ticketID        string
+)
+
+var ticketCmd = &cobra.Command{
+  Use:   "ticket",
+  Short: "E-ticket helpers",
+}
+
+var ticketVerifyCmd = &cobra.Command{
+  Use:   "verify <payload>",
+  Short: "Verify a ticket payload offline against the public key",
+  Long: "Checks the signature of a scanned ticket without touching the database and prints its claims.\n" +
+    "Use --trip and --id to check a disputed ticket against a trip or a passenger's document.",
+  Args: cobra.ExactArgs(1),
+  RunE: func(cmd *cobra.Command, args []string) error {
+    banner()
+    _ = env.Load()
+    var (
+      pub ed25519.PublicKey
+      err error
+    )
+    if strings.TrimSpace(ticketPublicKey) != "" {
+      pub, err = ticket.ParsePublicKey(ticketPublicKey)
+    } else {
+      pub, err = ticket.PublicKeyFromEnv()
+    }
+    if err != nil { return err }
+    c, err := ticket.Verify(pub, args[0])
+    if err != nil {
+      fmt.Println("❌ Ticket is NOT valid")
+      return err
+    }
+    fmt.Println("✅ Signature valid")
+    fmt.Printf("  • booking:  %s\n", c.Code)
+    fmt.Printf("  • train:    %s on %s\n", c.Train, c.Date)
+    fmt.Printf("  • seat:     coach %d, seat %s\n", c.Coach, c.Seat)
+    fmt.Printf("  • trip:     %s\n", c.TripID)
+    fmt.Printf("  • item:     %s\n", c.ItemID)
+    var problems []string
+    if t := strings.TrimSpace(ticketTrip); t != "" && t != c.TripID {
+      problems = append(problems, "ticket is for trip "+c.TripID+", not "+t)
+    }
+    if id := strings.TrimSpace(ticketID); id != "" {
+      typ, num, ok := strings.Cut(id, ":")
+      if !ok { return errors.New("--id expects TYPE:NUMBER, e.g. nik:3171014506900001") }
+      if ticket.HashPassengerID(c.Code, typ, num) == c.IDHash {
+        fmt.Println("  • passenger document matches")
+      } else {
+        problems = append(problems, "passenger document does not match the ticket")
+      }
+    }
+    if len(problems) > 0 {
+      for _, p := range problems { fmt.Println("❌ " + p) }
+      return errors.New("ticket does not match")
+    }
+    fmt.Println("Note: boarding status is only known to the server (POST /api/verify).")
+    return nil
+  },
+}
+
+func init() {
+  ticketVerifyCmd.Flags().StringVar(&ticketPublicKey, "public-key", "", "base64 ed25519 public key (default TICKET_PUBLIC_KEY, or derived from TICKET_SIGNING_KEY)")
+  ticketVerifyCmd.Flags().StringVar(&ticketTrip, "trip", "", "expected trip id")
+  ticketVerifyCmd.Flags().StringVar(&ticketID, "id", "", "passenger document as TYPE:NUMBER (nik or passport)")
+  ticketCmd.AddCommand(ticketVerifyCmd)
+  rootCmd.AddCommand(ticketCmd)
+}
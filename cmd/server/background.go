@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/db"
+	"gothicforge3/internal/env"
+	"gothicforge3/internal/jobs"
+	"gothicforge3/internal/notify"
+	"gothicforge3/internal/outbox"
+	"gothicforge3/internal/partner"
+)
+
+// startBackground launches the in-process workers that keep booking state
+// consistent. They run for the lifetime of the server and need DATABASE_URL.
+func startBackground() {
+	if strings.TrimSpace(env.Get("DATABASE_URL", "")) == "" {
+		return
+	}
+	ctx := context.Background()
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := db.Connect(cctx); err != nil {
+		log.Printf("background: database unavailable, workers not started: %v", err)
+		return
+	}
+	mail := notify.New(db.Pool())
+	// Periodic maintenance (hold sweeps, payment deadlines, trip generation,
+	// waitlist offers, payment reminders, refunds, session cleanup) and
+	// deferred work run as jobs; see registerJobs.
+	if b, err := jobs.FromEnv(db.Pool()); err != nil {
+		log.Printf("background: jobs not started: %v", err)
+	} else {
+		waitlist := registerJobs(db.Pool(), mail)
+		go jobs.NewRunner(b, 2*time.Second).Run(ctx)
+		// Freed seats are offered right away rather than at the next
+		// scheduled run; the shared unique key keeps it to one queued run.
+		go func() {
+			for range booking.Freed() {
+				if _, err := waitlist.Enqueue(ctx, b, jobs.NoArgs{}, jobs.EnqueueOptions{UniqueKey: "schedule:waitlist.process"}); err != nil {
+					log.Printf("background: waitlist not queued: %v", err)
+				}
+			}
+		}()
+	}
+	// Side effects of booking changes, such as emails and partner webhooks,
+	// are delivered from the outbox written in the same transaction as the change.
+	mail.HandleEvents()
+	partner.HandleEvents(db.Pool())
+	go outbox.Run(ctx, db.Pool(), 2*time.Second)
+}
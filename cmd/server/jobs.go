@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/jobs"
+	"gothicforge3/internal/notify"
+	"gothicforge3/internal/partner"
+	"gothicforge3/internal/payment"
+	"gothicforge3/internal/schedule"
+)
+
+// registerJobs binds the periodic maintenance work to job kinds and
+// schedules. Only the instance holding the scheduler lease enqueues them,
+// so several servers never sweep, offer waitlist seats or pay out refunds at
+// the same time. It returns the waitlist kind so freed seats can run it early.
+func registerJobs(pool booking.DB, mail *notify.Service) jobs.Kind[jobs.NoArgs] {
+	holds := jobs.Register("holds.sweep", jobs.Options{MaxAttempts: 1, Timeout: time.Minute}, func(ctx context.Context, _ jobs.NoArgs) error {
+		n, err := booking.SweepExpiredHolds(ctx, pool)
+		if n > 0 {
+			log.Printf("holds: released %d expired seat holds", n)
+		}
+		return err
+	})
+	payments := jobs.Register("payments.expire", jobs.Options{MaxAttempts: 1, Timeout: time.Minute}, func(ctx context.Context, _ jobs.NoArgs) error {
+		ids, err := booking.ExpireUnpaid(ctx, pool)
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			log.Printf("payments: expired %d unpaid bookings", len(ids))
+		}
+		if ids, err = booking.ExpireChanges(ctx, pool); len(ids) > 0 {
+			log.Printf("payments: expired %d unpaid trip changes", len(ids))
+		}
+		return err
+	})
+	generate := jobs.Register("schedule.generate", jobs.Options{MaxAttempts: 3, Timeout: 30 * time.Minute}, func(ctx context.Context, _ jobs.NoArgs) error {
+		res, err := schedule.Generate(ctx, pool, schedule.Options{From: time.Now(), Days: schedule.WindowDays()})
+		if err != nil {
+			return err
+		}
+		if res.Created > 0 || len(res.Cancelled) > 0 || len(res.Restored) > 0 {
+			log.Printf("schedule: %d trips created (%d seats), %d restored, %d cancelled", res.Created, res.Seats, len(res.Restored), len(res.Cancelled))
+		}
+		if len(res.Conflicts) > 0 {
+			log.Printf("schedule: %d booked trips no longer run per their calendar: %v", len(res.Conflicts), res.Conflicts)
+		}
+		return nil
+	})
+	sessions := jobs.Register("sessions.sweep", jobs.Options{}, func(ctx context.Context, _ jobs.NoArgs) error {
+		tag, err := pool.Exec(ctx, `DELETE FROM sessions WHERE expires_at <= now()`)
+		if n := tag.RowsAffected(); n > 0 {
+			log.Printf("sessions: deleted %d expired sessions", n)
+		}
+		return err
+	})
+	waitlist := jobs.Register("waitlist.process", jobs.Options{MaxAttempts: 1, Timeout: time.Minute}, func(ctx context.Context, _ jobs.NoArgs) error {
+		offers, err := booking.ProcessWaitlist(ctx, pool, mail)
+		if len(offers) > 0 {
+			log.Printf("waitlist: offered seats to %d waiting customers", len(offers))
+		}
+		return err
+	})
+	reminders := jobs.Register("payments.remind", jobs.Options{MaxAttempts: 1, Timeout: time.Minute}, func(ctx context.Context, _ jobs.NoArgs) error {
+		n, err := mail.SendReminders(ctx)
+		if n > 0 {
+			log.Printf("notify: sent %d payment reminders", n)
+		}
+		return err
+	})
+	webhooks := jobs.Register("webhooks.send", jobs.Options{MaxAttempts: 1, Timeout: time.Minute}, func(ctx context.Context, _ jobs.NoArgs) error {
+		_, _, err := partner.Send(ctx, pool, 100)
+		return err
+	})
+
+	for _, s := range []struct {
+		name, spec string
+		kind       jobs.Kind[jobs.NoArgs]
+	}{
+		// Expired seat holds go back to inventory even when nobody searches that trip.
+		{"holds.sweep", "@every 30s", holds},
+		// Bookings not paid by payment_due_at expire and give their seats back.
+		{"payments.expire", "@every 1m", payments},
+		// Keep SCHEDULE_WINDOW_DAYS of trips generated from the service calendars.
+		{"schedule.generate", "@every 24h", generate},
+		// Server-side sessions past expires_at are deleted nightly.
+		{"sessions.sweep", "15 3 * * *", sessions},
+		// Partner webhook deliveries that are due, first tries and retries alike.
+		{"webhooks.send", "@every 5s", webhooks},
+		// Seats that come free are offered to the waitlist, oldest entry first.
+		{"waitlist.process", "@every 15s", waitlist},
+		// Customers are reminded PAYMENT_REMINDER_MINUTES before an unpaid booking expires.
+		{"payments.remind", "@every 1m", reminders},
+	} {
+		if err := jobs.Schedule(s.name, s.spec, s.kind, jobs.NoArgs{}); err != nil {
+			log.Fatalf("jobs: %v", err)
+		}
+	}
+
+	// Refunds recorded by cancellations are paid out through the payment gateway.
+	r, err := payment.RefunderFromEnv()
+	if err != nil {
+		log.Printf("jobs: refunds not processed: %v", err)
+		return waitlist
+	}
+	refunds := jobs.Register("refunds.process", jobs.Options{MaxAttempts: 1, Timeout: 5 * time.Minute}, func(ctx context.Context, _ jobs.NoArgs) error {
+		done, failed, err := payment.ProcessRefunds(ctx, pool, r, 50)
+		if done+failed > 0 {
+			log.Printf("refunds: %d paid out, %d failed", done, failed)
+		}
+		return err
+	})
+	if err := jobs.Schedule("refunds.process", "@every 1m", refunds, jobs.NoArgs{}); err != nil {
+		log.Fatalf("jobs: %v", err)
+	}
+	return waitlist
+}
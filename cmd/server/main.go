@@ -18,6 +18,9 @@ func main() {
 	// Mount application routes
 	routes.Register(r)
 
+	// Background workers (hold sweeper, ...) when a database is configured
+	startBackground()
+
     // Prefer PORT from the platform (Railway/Heroku/etc.). Fallback to .env values.
     port := os.Getenv("PORT")
     if port == "" { port = env.Get("HTTP_PORT", "8080") }
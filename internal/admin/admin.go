@@ -0,0 +1,83 @@
+// Package admin backs the operations console at /admin: searching and editing
+// stations, trains, routes and trips, changing a trip's status, seat
+// occupancy, booking lookup, and the audit log every change is written to.
+package admin
+
+import (
+	"fmt"
+	"strings"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/env"
+)
+
+// RoleAdmin is the gf_jwt "role" claim that opens the console.
+const RoleAdmin = "admin"
+
+// IsAdmin reports whether verified JWT claims carry the admin role, either as
+// "role": "admin" or inside a "roles" list.
+func IsAdmin(claims map[string]any) bool {
+	if r, ok := claims["role"].(string); ok && r == RoleAdmin {
+		return true
+	}
+	if rs, ok := claims["roles"].([]any); ok {
+		for _, r := range rs {
+			if s, ok := r.(string); ok && s == RoleAdmin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Actor names the operator behind verified claims for the audit log:
+// "github:<login>" after GitHub sign-in, otherwise "user:<sub>".
+func Actor(claims map[string]any) string {
+	if login, ok := claims["login"].(string); ok && login != "" {
+		return "github:" + login
+	}
+	if sub := strings.TrimSpace(fmt.Sprint(claims["sub"])); sub != "" && sub != "<nil>" {
+		return "user:" + sub
+	}
+	return ""
+}
+
+// GitHubAdmin reports whether a GitHub login is listed in ADMIN_GITHUB_LOGINS
+// (comma separated, case-insensitive) and so signs in with the admin role.
+func GitHubAdmin(login string) bool {
+	login = strings.TrimSpace(login)
+	if login == "" {
+		return false
+	}
+	for _, l := range strings.Split(env.Get("ADMIN_GITHUB_LOGINS", ""), ",") {
+		if strings.EqualFold(strings.TrimSpace(l), login) {
+			return true
+		}
+	}
+	return false
+}
+
+// Confirmed reports whether the operator typed the expected text (a station
+// code, a trip's train code, ...) to confirm a destructive action.
+func Confirmed(expected, typed string) bool {
+	return expected != "" && strings.EqualFold(strings.TrimSpace(typed), expected)
+}
+
+// errConfirm is returned when a destructive action was not confirmed.
+func errConfirm(expected string) error {
+	return &booking.Error{Code: booking.CodeInvalid, Message: fmt.Sprintf("type %s to confirm", expected), Fields: map[string]string{"confirm": "type " + expected + " to confirm"}}
+}
+
+func invalidField(field, msg string) error {
+	return &booking.Error{Code: booking.CodeInvalid, Message: msg, Fields: map[string]string{field: msg}}
+}
+
+func notFound(what string) error {
+	return &booking.Error{Code: booking.CodeNotFound, Message: what + " not found"}
+}
+
+// likePattern turns a search box into an ILIKE pattern, escaping wildcards.
+func likePattern(q string) string {
+	q = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.TrimSpace(q))
+	return "%" + q + "%"
+}
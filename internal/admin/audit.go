@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gothicforge3/internal/booking"
+)
+
+// Audit actions.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionStatus = "status" // trip status changed
+	ActionCancel = "cancel" // trip cancelled
+)
+
+// AuditEntry is one change made from the console.
+type AuditEntry struct {
+	ID        int64          `json:"id"`
+	Actor     string         `json:"actor"`
+	Action    string         `json:"action"`
+	Entity    string         `json:"entity"`
+	EntityID  string         `json:"entity_id"`
+	Detail    map[string]any `json:"detail,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// audit appends an entry to admin_audit. It runs inside the transaction that
+// made the change, so a change is never left unaudited.
+func audit(ctx context.Context, db booking.Querier, actor, action, entity, entityID string, detail map[string]any) error {
+	if detail == nil {
+		detail = map[string]any{}
+	}
+	b, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx, `INSERT INTO admin_audit (actor, action, entity, entity_id, detail) VALUES ($1, $2, $3, $4, $5::JSONB)`, actor, action, entity, entityID, string(b))
+	return err
+}
+
+// AuditLog returns the newest entries, limited to one entity (and one row of
+// it) when entity (and entityID) are set.
+func AuditLog(ctx context.Context, db booking.Querier, entity, entityID string, limit int) ([]AuditEntry, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	rows, err := db.Query(ctx, `
+SELECT id, actor, action, entity, entity_id, detail::TEXT, created_at
+FROM admin_audit
+WHERE ($1 = '' OR entity = $1) AND ($2 = '' OR entity_id = $2)
+ORDER BY created_at DESC, id DESC
+LIMIT $3::INT8`, entity, entityID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []AuditEntry{}
+	for rows.Next() {
+		var (
+			e      AuditEntry
+			detail string
+		)
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Entity, &e.EntityID, &detail, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(detail), &e.Detail); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
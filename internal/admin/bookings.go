@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"context"
+	"strings"
+
+	"gothicforge3/internal/booking"
+)
+
+// FindBookings looks bookings up by code or by the ID number (NIK, passport
+// ...) of a passenger on them, newest first (at most 50). Carts still
+// collecting seats are left out.
+func FindBookings(ctx context.Context, db booking.Querier, q string) ([]booking.Booking, error) {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return nil, invalidField("q", "enter a booking code or passenger ID number")
+	}
+	rows, err := db.Query(ctx, `
+SELECT b.id FROM bookings b
+WHERE b.status <> 'hold'
+  AND (b.code = upper($1)
+       OR EXISTS (SELECT 1 FROM booking_items bi JOIN passengers p ON p.booking_item_id = bi.id
+                  WHERE bi.booking_id = b.id AND p.id_number IN ($1, upper($1))))
+ORDER BY b.created_at DESC
+LIMIT 50`, q)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]booking.Booking, 0, len(ids))
+	for _, id := range ids {
+		b, err := booking.GetBookingByID(ctx, db, id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
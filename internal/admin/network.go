@@ -0,0 +1,438 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"gothicforge3/internal/booking"
+)
+
+// Audited entities.
+const (
+	EntityStation = "station"
+	EntityTrain   = "train"
+	EntityRoute   = "route"
+	EntityTrip    = "trip"
+)
+
+// maxRows caps every list screen.
+const maxRows = 200
+
+var codePattern = regexp.MustCompile(`^[A-Z0-9]+(-[A-Z0-9]+)*$`)
+
+// validCode checks a station, train or route code: upper-case letters and
+// digits, optionally joined by dashes, at most max long.
+func validCode(code string, max int) bool {
+	return len(code) <= max && codePattern.MatchString(code)
+}
+
+// Station is an editable row of stations.
+type Station struct {
+	ID     string  `json:"id"`
+	Code   string  `json:"code"`
+	Name   string  `json:"name"`
+	City   string  `json:"city"`
+	Lat    float64 `json:"lat"`
+	Lon    float64 `json:"lon"`
+	Active bool    `json:"active"`
+}
+
+// Validate normalizes the station and checks every field.
+func (s *Station) Validate() error {
+	s.Code = strings.ToUpper(strings.TrimSpace(s.Code))
+	s.Name, s.City = strings.TrimSpace(s.Name), strings.TrimSpace(s.City)
+	switch {
+	case !validCode(s.Code, 10):
+		return invalidField("code", "code must be up to 10 letters or digits")
+	case s.Name == "" || len(s.Name) > 100:
+		return invalidField("name", "name is required (up to 100 characters)")
+	case len(s.City) > 100:
+		return invalidField("city", "city is up to 100 characters")
+	case s.Lat < -90 || s.Lat > 90:
+		return invalidField("lat", "latitude must be between -90 and 90")
+	case s.Lon < -180 || s.Lon > 180:
+		return invalidField("lon", "longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+const stationCols = `id::TEXT, code, name, COALESCE(city, ''), COALESCE(lat, 0)::FLOAT8, COALESCE(lon, 0)::FLOAT8, active`
+
+func scanStation(row pgx.Row, s *Station) error {
+	return row.Scan(&s.ID, &s.Code, &s.Name, &s.City, &s.Lat, &s.Lon, &s.Active)
+}
+
+// SearchStations lists stations whose code, name or city contains q.
+func SearchStations(ctx context.Context, db booking.Querier, q string) ([]Station, error) {
+	rows, err := db.Query(ctx, `SELECT `+stationCols+` FROM stations
+WHERE code ILIKE $1 OR name ILIKE $1 OR COALESCE(city, '') ILIKE $1
+ORDER BY name LIMIT $2::INT8`, likePattern(q), maxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Station{}
+	for rows.Next() {
+		var s Station
+		if err := scanStation(rows, &s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// GetStation loads one station.
+func GetStation(ctx context.Context, db booking.Querier, id string) (Station, error) {
+	var s Station
+	if !booking.ValidUUID(id) {
+		return s, notFound("station")
+	}
+	err := scanStation(db.QueryRow(ctx, `SELECT `+stationCols+` FROM stations WHERE id = $1`, id), &s)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s, notFound("station")
+	}
+	return s, err
+}
+
+// SaveStation creates the station (empty ID) or updates it, and audits the change.
+func SaveStation(ctx context.Context, db booking.DB, actor string, s Station) (Station, error) {
+	if err := s.Validate(); err != nil {
+		return s, err
+	}
+	err := inTx(ctx, db, func(tx pgx.Tx) error {
+		action := ActionUpdate
+		var err error
+		if s.ID == "" {
+			action = ActionCreate
+			err = tx.QueryRow(ctx, `INSERT INTO stations (code, name, city, lat, lon, active) VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6) RETURNING id::TEXT`,
+				s.Code, s.Name, s.City, s.Lat, s.Lon, s.Active).Scan(&s.ID)
+		} else {
+			err = tx.QueryRow(ctx, `UPDATE stations SET code = $2, name = $3, city = NULLIF($4, ''), lat = $5, lon = $6, active = $7 WHERE id = $1 RETURNING id::TEXT`,
+				s.ID, s.Code, s.Name, s.City, s.Lat, s.Lon, s.Active).Scan(&s.ID)
+		}
+		if err != nil {
+			return saveError(err, "station")
+		}
+		return audit(ctx, tx, actor, action, EntityStation, s.ID, map[string]any{"code": s.Code, "name": s.Name, "city": s.City, "lat": s.Lat, "lon": s.Lon, "active": s.Active})
+	})
+	return s, err
+}
+
+// DeleteStation removes a station no route or timetable uses; confirm must be
+// its code. Stations in use are deactivated instead.
+func DeleteStation(ctx context.Context, db booking.DB, actor, id, confirm string) error {
+	return inTx(ctx, db, func(tx pgx.Tx) error {
+		s, err := GetStation(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if !Confirmed(s.Code, confirm) {
+			return errConfirm(s.Code)
+		}
+		var used bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM routes WHERE origin_station_id = $1 OR dest_station_id = $1)
+    OR EXISTS (SELECT 1 FROM trip_stops WHERE station_id = $1)
+    OR EXISTS (SELECT 1 FROM template_stops WHERE station_id = $1)`, id).Scan(&used); err != nil {
+			return err
+		}
+		if used {
+			return invalidField("confirm", "the station is used by routes or timetables; deactivate it instead")
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM stations WHERE id = $1`, id); err != nil {
+			return err
+		}
+		return audit(ctx, tx, actor, ActionDelete, EntityStation, id, map[string]any{"code": s.Code, "name": s.Name})
+	})
+}
+
+// Train is an editable row of trains. Classes lists the seat classes it
+// carries (trains.class_support, comma separated).
+type Train struct {
+	ID       string   `json:"id"`
+	Code     string   `json:"code"`
+	Name     string   `json:"name"`
+	Operator string   `json:"operator"`
+	Classes  []string `json:"classes"`
+}
+
+// Validate normalizes the train and checks every field.
+func (t *Train) Validate() error {
+	t.Code = strings.ToUpper(strings.TrimSpace(t.Code))
+	t.Name, t.Operator = strings.TrimSpace(t.Name), strings.TrimSpace(t.Operator)
+	var classes []string
+	for _, c := range t.Classes {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if !booking.ValidClass(c) {
+			return invalidField("classes", "unknown class "+c)
+		}
+		classes = append(classes, c)
+	}
+	t.Classes = classes
+	switch {
+	case !validCode(t.Code, 20):
+		return invalidField("code", "code must be up to 20 letters or digits")
+	case t.Name == "" || len(t.Name) > 100:
+		return invalidField("name", "name is required (up to 100 characters)")
+	case len(t.Operator) > 100:
+		return invalidField("operator", "operator is up to 100 characters")
+	case len(t.Classes) == 0:
+		return invalidField("classes", "pick at least one class")
+	}
+	return nil
+}
+
+const trainCols = `id::TEXT, code, name, COALESCE(operator, ''), COALESCE(class_support, '')`
+
+func scanTrain(row pgx.Row, t *Train) error {
+	var classes string
+	if err := row.Scan(&t.ID, &t.Code, &t.Name, &t.Operator, &classes); err != nil {
+		return err
+	}
+	t.Classes = strings.FieldsFunc(classes, func(r rune) bool { return r == ',' || r == ' ' })
+	return nil
+}
+
+// SearchTrains lists trains whose code, name or operator contains q.
+func SearchTrains(ctx context.Context, db booking.Querier, q string) ([]Train, error) {
+	rows, err := db.Query(ctx, `SELECT `+trainCols+` FROM trains
+WHERE code ILIKE $1 OR name ILIKE $1 OR COALESCE(operator, '') ILIKE $1
+ORDER BY code LIMIT $2::INT8`, likePattern(q), maxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Train{}
+	for rows.Next() {
+		var t Train
+		if err := scanTrain(rows, &t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// GetTrain loads one train.
+func GetTrain(ctx context.Context, db booking.Querier, id string) (Train, error) {
+	var t Train
+	if !booking.ValidUUID(id) {
+		return t, notFound("train")
+	}
+	err := scanTrain(db.QueryRow(ctx, `SELECT `+trainCols+` FROM trains WHERE id = $1`, id), &t)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return t, notFound("train")
+	}
+	return t, err
+}
+
+// SaveTrain creates the train (empty ID) or updates it, and audits the change.
+func SaveTrain(ctx context.Context, db booking.DB, actor string, t Train) (Train, error) {
+	if err := t.Validate(); err != nil {
+		return t, err
+	}
+	classes := strings.Join(t.Classes, ",")
+	err := inTx(ctx, db, func(tx pgx.Tx) error {
+		action := ActionUpdate
+		var err error
+		if t.ID == "" {
+			action = ActionCreate
+			err = tx.QueryRow(ctx, `INSERT INTO trains (code, name, operator, class_support) VALUES ($1, $2, NULLIF($3, ''), $4) RETURNING id::TEXT`,
+				t.Code, t.Name, t.Operator, classes).Scan(&t.ID)
+		} else {
+			err = tx.QueryRow(ctx, `UPDATE trains SET code = $2, name = $3, operator = NULLIF($4, ''), class_support = $5 WHERE id = $1 RETURNING id::TEXT`,
+				t.ID, t.Code, t.Name, t.Operator, classes).Scan(&t.ID)
+		}
+		if err != nil {
+			return saveError(err, "train")
+		}
+		return audit(ctx, tx, actor, action, EntityTrain, t.ID, map[string]any{"code": t.Code, "name": t.Name, "operator": t.Operator, "classes": classes})
+	})
+	return t, err
+}
+
+// DeleteTrain removes a train that has never run a trip; confirm must be its code.
+func DeleteTrain(ctx context.Context, db booking.DB, actor, id, confirm string) error {
+	return inTx(ctx, db, func(tx pgx.Tx) error {
+		t, err := GetTrain(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if !Confirmed(t.Code, confirm) {
+			return errConfirm(t.Code)
+		}
+		var used bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM trips WHERE train_id = $1)`, id).Scan(&used); err != nil {
+			return err
+		}
+		if used {
+			return invalidField("confirm", "the train has trips; cancel them instead")
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM trains WHERE id = $1`, id); err != nil {
+			return err
+		}
+		return audit(ctx, tx, actor, ActionDelete, EntityTrain, id, map[string]any{"code": t.Code, "name": t.Name})
+	})
+}
+
+// Route is an editable row of routes, with its end stations by code.
+type Route struct {
+	ID          string  `json:"id"`
+	Code        string  `json:"code"`
+	Origin      string  `json:"origin"`
+	Destination string  `json:"destination"`
+	DistanceKM  float64 `json:"distance_km"`
+}
+
+// Validate normalizes the route and checks every field.
+func (r *Route) Validate() error {
+	r.Code = strings.ToUpper(strings.TrimSpace(r.Code))
+	r.Origin = strings.ToUpper(strings.TrimSpace(r.Origin))
+	r.Destination = strings.ToUpper(strings.TrimSpace(r.Destination))
+	switch {
+	case !validCode(r.Code, 40):
+		return invalidField("code", "code must be up to 40 letters, digits or dashes")
+	case r.Origin == "":
+		return invalidField("origin", "origin station is required")
+	case r.Destination == "" || r.Destination == r.Origin:
+		return invalidField("destination", "destination must be another station")
+	case r.DistanceKM < 0 || r.DistanceKM >= 100000:
+		return invalidField("distance_km", "distance must be between 0 and 99999 km")
+	}
+	return nil
+}
+
+const routeCols = `r.id::TEXT, r.route_code, o.code, d.code, COALESCE(r.distance_km, 0)::FLOAT8`
+
+const routeFrom = ` FROM routes r JOIN stations o ON o.id = r.origin_station_id JOIN stations d ON d.id = r.dest_station_id`
+
+func scanRoute(row pgx.Row, r *Route) error {
+	return row.Scan(&r.ID, &r.Code, &r.Origin, &r.Destination, &r.DistanceKM)
+}
+
+// SearchRoutes lists routes whose code or end station codes contain q.
+func SearchRoutes(ctx context.Context, db booking.Querier, q string) ([]Route, error) {
+	rows, err := db.Query(ctx, `SELECT `+routeCols+routeFrom+`
+WHERE r.route_code ILIKE $1 OR o.code ILIKE $1 OR d.code ILIKE $1
+ORDER BY r.route_code LIMIT $2::INT8`, likePattern(q), maxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Route{}
+	for rows.Next() {
+		var r Route
+		if err := scanRoute(rows, &r); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// GetRoute loads one route.
+func GetRoute(ctx context.Context, db booking.Querier, id string) (Route, error) {
+	var r Route
+	if !booking.ValidUUID(id) {
+		return r, notFound("route")
+	}
+	err := scanRoute(db.QueryRow(ctx, `SELECT `+routeCols+routeFrom+` WHERE r.id = $1`, id), &r)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return r, notFound("route")
+	}
+	return r, err
+}
+
+// SaveRoute creates the route (empty ID) or updates it, and audits the change.
+func SaveRoute(ctx context.Context, db booking.DB, actor string, r Route) (Route, error) {
+	if err := r.Validate(); err != nil {
+		return r, err
+	}
+	err := inTx(ctx, db, func(tx pgx.Tx) error {
+		var origin, dest string
+		if err := tx.QueryRow(ctx, `SELECT id::TEXT FROM stations WHERE code = $1`, r.Origin).Scan(&origin); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return invalidField("origin", "unknown station "+r.Origin)
+			}
+			return err
+		}
+		if err := tx.QueryRow(ctx, `SELECT id::TEXT FROM stations WHERE code = $1`, r.Destination).Scan(&dest); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return invalidField("destination", "unknown station "+r.Destination)
+			}
+			return err
+		}
+		action := ActionUpdate
+		var err error
+		if r.ID == "" {
+			action = ActionCreate
+			err = tx.QueryRow(ctx, `INSERT INTO routes (route_code, origin_station_id, dest_station_id, distance_km) VALUES ($1, $2, $3, $4) RETURNING id::TEXT`,
+				r.Code, origin, dest, r.DistanceKM).Scan(&r.ID)
+		} else {
+			err = tx.QueryRow(ctx, `UPDATE routes SET route_code = $2, origin_station_id = $3, dest_station_id = $4, distance_km = $5 WHERE id = $1 RETURNING id::TEXT`,
+				r.ID, r.Code, origin, dest, r.DistanceKM).Scan(&r.ID)
+		}
+		if err != nil {
+			return saveError(err, "route")
+		}
+		return audit(ctx, tx, actor, action, EntityRoute, r.ID, map[string]any{"code": r.Code, "origin": r.Origin, "destination": r.Destination, "distance_km": r.DistanceKM})
+	})
+	return r, err
+}
+
+// DeleteRoute removes a route no trip or timetable runs on; confirm must be its code.
+func DeleteRoute(ctx context.Context, db booking.DB, actor, id, confirm string) error {
+	return inTx(ctx, db, func(tx pgx.Tx) error {
+		r, err := GetRoute(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if !Confirmed(r.Code, confirm) {
+			return errConfirm(r.Code)
+		}
+		var used bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM trips WHERE route_id = $1) OR EXISTS (SELECT 1 FROM timetable_templates WHERE route_id = $1)`, id).Scan(&used); err != nil {
+			return err
+		}
+		if used {
+			return invalidField("confirm", "the route has trips or timetables; it cannot be deleted")
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM routes WHERE id = $1`, id); err != nil {
+			return err
+		}
+		return audit(ctx, tx, actor, ActionDelete, EntityRoute, id, map[string]any{"code": r.Code})
+	})
+}
+
+// saveError turns a duplicate code into a field error.
+func saveError(err error, what string) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return notFound(what)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return invalidField("code", "another "+what+" already uses this code")
+	}
+	return err
+}
+
+// inTx runs fn in a transaction and commits it when fn succeeds.
+func inTx(ctx context.Context, db booking.DB, fn func(pgx.Tx) error) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
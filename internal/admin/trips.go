@@ -0,0 +1,306 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/booking"
+)
+
+// Trip statuses. Search and holds skip cancelled trips; the others are shown
+// to customers as a badge next to the train.
+const (
+	TripScheduled = "scheduled"
+	TripDelayed   = "delayed"
+	TripDeparted  = "departed"
+	TripArrived   = "arrived"
+	TripCancelled = "cancelled"
+)
+
+// tripTransitions lists the statuses each status may move to. A cancelled
+// trip can be reinstated before it runs; an arrived trip is final.
+var tripTransitions = map[string][]string{
+	TripScheduled: {TripDelayed, TripDeparted, TripCancelled},
+	TripDelayed:   {TripScheduled, TripDeparted, TripCancelled},
+	TripDeparted:  {TripArrived},
+	TripArrived:   nil,
+	TripCancelled: {TripScheduled},
+}
+
+// TripStatuses returns every trip status in lifecycle order.
+func TripStatuses() []string {
+	return []string{TripScheduled, TripDelayed, TripDeparted, TripArrived, TripCancelled}
+}
+
+// NextStatuses returns the statuses a trip in status from may move to.
+func NextStatuses(from string) []string { return tripTransitions[from] }
+
+// CanChangeStatus checks a trip status change.
+func CanChangeStatus(from, to string) error {
+	if _, ok := tripTransitions[to]; !ok {
+		return invalidField("status", "unknown trip status "+to)
+	}
+	for _, s := range tripTransitions[from] {
+		if s == to {
+			return nil
+		}
+	}
+	return invalidField("status", "a "+from+" trip cannot become "+to)
+}
+
+// TripFilter narrows the trip list. Q matches the train code or name, the
+// route code or an end station code.
+type TripFilter struct {
+	Date   string
+	Q      string
+	Status string
+}
+
+// Trip is one row of the trip list.
+type Trip struct {
+	ID          string `json:"id"`
+	TrainCode   string `json:"train_code"`
+	TrainName   string `json:"train_name"`
+	RouteCode   string `json:"route_code"`
+	Origin      string `json:"origin"`
+	Destination string `json:"destination"`
+	ServiceDate string `json:"service_date"`
+	Depart      string `json:"depart"`
+	Arrive      string `json:"arrive"`
+	Status      string `json:"status"`
+	BasePrice   int64  `json:"base_price"`
+	Seats       int    `json:"seats"`
+	Sold        int    `json:"sold"`
+}
+
+const tripCols = `t.id::TEXT, tr.code, tr.name, r.route_code, o.code, d.code, t.service_date::TEXT,
+       to_char(t.depart_time, 'HH24:MI'), to_char(t.arrive_time, 'HH24:MI'), t.status, t.base_price::INT8,
+       (SELECT COUNT(*) FROM seats s WHERE s.trip_id = t.id)::INT8,
+       (SELECT COUNT(DISTINCT bi.seat_id) FROM booking_items bi JOIN seats s ON s.id = bi.seat_id WHERE s.trip_id = t.id AND bi.status = 'confirmed')::INT8`
+
+const tripFrom = ` FROM trips t
+JOIN trains tr ON tr.id = t.train_id
+JOIN routes r ON r.id = t.route_id
+JOIN stations o ON o.id = r.origin_station_id
+JOIN stations d ON d.id = r.dest_station_id`
+
+func scanTrip(row pgx.Row, t *Trip) error {
+	return row.Scan(&t.ID, &t.TrainCode, &t.TrainName, &t.RouteCode, &t.Origin, &t.Destination, &t.ServiceDate,
+		&t.Depart, &t.Arrive, &t.Status, &t.BasePrice, &t.Seats, &t.Sold)
+}
+
+// SearchTrips lists trips matching f, by departure.
+func SearchTrips(ctx context.Context, db booking.Querier, f TripFilter) ([]Trip, error) {
+	var date *time.Time
+	if f.Date != "" {
+		d, err := time.Parse("2006-01-02", f.Date)
+		if err != nil {
+			return nil, invalidField("date", "date must be YYYY-MM-DD")
+		}
+		date = &d
+	}
+	if f.Status != "" {
+		if _, ok := tripTransitions[f.Status]; !ok {
+			return nil, invalidField("status", "unknown trip status "+f.Status)
+		}
+	}
+	rows, err := db.Query(ctx, `SELECT `+tripCols+tripFrom+`
+WHERE ($1::DATE IS NULL OR t.service_date = $1::DATE)
+  AND ($2 = '' OR t.status = $2)
+  AND (tr.code ILIKE $3 OR tr.name ILIKE $3 OR r.route_code ILIKE $3 OR o.code ILIKE $3 OR d.code ILIKE $3)
+ORDER BY t.service_date, t.depart_time, tr.code
+LIMIT $4::INT8`, date, f.Status, likePattern(f.Q), maxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Trip{}
+	for rows.Next() {
+		var t Trip
+		if err := scanTrip(rows, &t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// GetTrip loads one trip.
+func GetTrip(ctx context.Context, db booking.Querier, id string) (Trip, error) {
+	var t Trip
+	if !booking.ValidUUID(id) {
+		return t, notFound("trip")
+	}
+	err := scanTrip(db.QueryRow(ctx, `SELECT `+tripCols+tripFrom+` WHERE t.id = $1`, id), &t)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return t, notFound("trip")
+	}
+	return t, err
+}
+
+// SetTripPrice changes a trip's base fare. Seats already sold keep their price.
+func SetTripPrice(ctx context.Context, db booking.DB, actor, id string, price int64) error {
+	if price < 0 || price > 100_000_000 {
+		return invalidField("base_price", "base price must be between 0 and 100.000.000")
+	}
+	return inTx(ctx, db, func(tx pgx.Tx) error {
+		t, err := GetTrip(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `UPDATE trips SET base_price = $2 WHERE id = $1`, id, price); err != nil {
+			return err
+		}
+		return audit(ctx, tx, actor, ActionUpdate, EntityTrip, id, map[string]any{"base_price": price, "was": t.BasePrice})
+	})
+}
+
+// StatusChange is an operator's request to move a trip to another status.
+// Cancelling is destructive: Confirm must be the trip's train code. A delay
+// says by how many minutes in DelayMinutes.
+type StatusChange struct {
+	Actor        string
+	TripID       string
+	Status       string
+	Reason       string
+	Confirm      string
+	DelayMinutes int
+}
+
+// SetTripStatus moves a trip to another status and audits it. Cancelling a
+// trip also releases the seats held in customers' carts; paid and pending
+// bookings are handled afterwards by booking.Disrupt.
+func SetTripStatus(ctx context.Context, db booking.DB, c StatusChange) (Trip, error) {
+	c.Status = strings.ToLower(strings.TrimSpace(c.Status))
+	c.Reason = strings.TrimSpace(c.Reason)
+	if len(c.Reason) > 500 {
+		return Trip{}, invalidField("reason", "reason is up to 500 characters")
+	}
+	if c.Status == TripDelayed && (c.DelayMinutes < 1 || c.DelayMinutes > 24*60) {
+		return Trip{}, invalidField("delay_minutes", "delay must be between 1 and 1440 minutes")
+	}
+	var t Trip
+	err := inTx(ctx, db, func(tx pgx.Tx) error {
+		var err error
+		if t, err = GetTrip(ctx, tx, c.TripID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `SELECT 1 FROM trips WHERE id = $1 FOR UPDATE`, t.ID); err != nil {
+			return err
+		}
+		if err := CanChangeStatus(t.Status, c.Status); err != nil {
+			return err
+		}
+		action := ActionStatus
+		detail := map[string]any{"from": t.Status, "to": c.Status, "reason": c.Reason}
+		if c.Status == TripDelayed {
+			detail["delay_minutes"] = c.DelayMinutes
+		}
+		if c.Status == TripCancelled {
+			if !Confirmed(t.TrainCode, c.Confirm) {
+				return errConfirm(t.TrainCode)
+			}
+			action = ActionCancel
+			tag, err := tx.Exec(ctx, `
+UPDATE booking_items SET status = 'released', held_until = NULL
+WHERE status = 'held' AND seat_id IN (SELECT id FROM seats WHERE trip_id = $1)`, t.ID)
+			if err != nil {
+				return err
+			}
+			detail["holds_released"] = tag.RowsAffected()
+		}
+		if _, err := tx.Exec(ctx, `UPDATE trips SET status = $2 WHERE id = $1`, t.ID, c.Status); err != nil {
+			return err
+		}
+		t.Status = c.Status
+		return audit(ctx, tx, c.Actor, action, EntityTrip, t.ID, detail)
+	})
+	return t, err
+}
+
+// CoachOccupancy counts the seats of one coach. A seat sold on any part of
+// the route counts as sold; Held counts seats only in live carts.
+type CoachOccupancy struct {
+	CoachNo int    `json:"coach_no"`
+	Class   string `json:"class"`
+	Seats   int    `json:"seats"`
+	Sold    int    `json:"sold"`
+	Held    int    `json:"held"`
+}
+
+// Free is the number of seats neither sold nor held.
+func (c CoachOccupancy) Free() int { return c.Seats - c.Sold - c.Held }
+
+// Occupancy is a trip's seat usage, per coach and in total.
+type Occupancy struct {
+	Coaches []CoachOccupancy `json:"coaches"`
+	Seats   int              `json:"seats"`
+	Sold    int              `json:"sold"`
+	Held    int              `json:"held"`
+}
+
+// NewOccupancy totals the coaches.
+func NewOccupancy(coaches []CoachOccupancy) Occupancy {
+	o := Occupancy{Coaches: coaches}
+	for _, c := range coaches {
+		o.Seats += c.Seats
+		o.Sold += c.Sold
+		o.Held += c.Held
+	}
+	return o
+}
+
+// Percent is the share of seats sold, rounded to the nearest percent.
+func (o Occupancy) Percent() int {
+	if o.Seats == 0 {
+		return 0
+	}
+	return (o.Sold*100 + o.Seats/2) / o.Seats
+}
+
+// TripOccupancy counts sold and held seats per coach of a trip.
+func TripOccupancy(ctx context.Context, db booking.Querier, tripID string) (Occupancy, error) {
+	rows, err := db.Query(ctx, `
+SELECT s.coach_no, s.class, COUNT(*)::INT8,
+       SUM(CASE WHEN x.sold THEN 1 ELSE 0 END)::INT8,
+       SUM(CASE WHEN x.held AND NOT x.sold THEN 1 ELSE 0 END)::INT8
+FROM seats s
+JOIN LATERAL (
+    SELECT COALESCE(bool_or(bi.status = 'confirmed'), FALSE) AS sold,
+           COALESCE(bool_or(bi.status = 'held' AND bi.held_until > now()), FALSE) AS held
+    FROM booking_items bi WHERE bi.seat_id = s.id
+) x ON TRUE
+WHERE s.trip_id = $1
+GROUP BY s.coach_no, s.class
+ORDER BY s.coach_no`, tripID)
+	if err != nil {
+		return Occupancy{}, err
+	}
+	defer rows.Close()
+	coaches := []CoachOccupancy{}
+	for rows.Next() {
+		var c CoachOccupancy
+		if err := rows.Scan(&c.CoachNo, &c.Class, &c.Seats, &c.Sold, &c.Held); err != nil {
+			return Occupancy{}, err
+		}
+		coaches = append(coaches, c)
+	}
+	return NewOccupancy(coaches), rows.Err()
+}
+
+// TripBookings counts the paid and unpaid bookings with seats on a trip, the
+// customers an operator has to look after when it is delayed or cancelled.
+func TripBookings(ctx context.Context, db booking.Querier, tripID string) (paid, pending int, err error) {
+	err = db.QueryRow(ctx, `
+SELECT COUNT(DISTINCT b.id) FILTER (WHERE b.status = 'paid')::INT8,
+       COUNT(DISTINCT b.id) FILTER (WHERE b.status = 'pending')::INT8
+FROM bookings b
+JOIN booking_items bi ON bi.booking_id = b.id AND bi.status = 'confirmed'
+JOIN seats s ON s.id = bi.seat_id
+WHERE s.trip_id = $1`, tripID).Scan(&paid, &pending)
+	return paid, pending, err
+}
@@ -0,0 +1,86 @@
+package booking
+
+import (
+	"context"
+	"crypto/subtle"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ListBookings returns the checked-out bookings of a holder, newest first
+// (at most 100). Carts still collecting seats are left out.
+func ListBookings(ctx context.Context, db Querier, holder string) ([]Booking, error) {
+	if strings.TrimSpace(holder) == "" {
+		return nil, invalid("holder is required")
+	}
+	rows, err := db.Query(ctx, `SELECT id FROM bookings WHERE user_ref = $1 AND status <> 'hold' ORDER BY created_at DESC LIMIT 100`, holder)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]Booking, 0, len(ids))
+	for _, id := range ids {
+		b, err := GetBookingByID(ctx, db, id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// LastDeparture is when the booking's last train leaves: its own trip, or
+// the final leg of a connecting journey.
+func (b Booking) LastDeparture() time.Time {
+	if n := len(b.Legs); n > 0 {
+		return b.Legs[n-1].Trip.Departure()
+	}
+	return b.Trip.Departure()
+}
+
+// SplitBookings separates bookings still to be travelled (pending or paid
+// with a train yet to leave at now), soonest first, from the rest, newest
+// first.
+func SplitBookings(bs []Booking, now time.Time) (upcoming, past []Booking) {
+	for _, b := range bs {
+		if (b.Status == StatusPaid || b.Status == StatusPending) && b.LastDeparture().After(now) {
+			upcoming = append(upcoming, b)
+		} else {
+			past = append(past, b)
+		}
+	}
+	sort.SliceStable(upcoming, func(i, j int) bool { return upcoming[i].Trip.Departure().Before(upcoming[j].Trip.Departure()) })
+	sort.SliceStable(past, func(i, j int) bool { return past[i].CreatedAt.After(past[j].CreatedAt) })
+	return upcoming, past
+}
+
+// FindGuestBooking looks a booking up by code and the contact email given at
+// checkout, for customers who booked without signing in. A wrong email is
+// reported exactly like an unknown code.
+func FindGuestBooking(ctx context.Context, db Querier, code, email string) (Booking, error) {
+	code, email = strings.TrimSpace(code), strings.ToLower(strings.TrimSpace(email))
+	if code == "" || email == "" {
+		return Booking{}, invalid("booking code and email are required")
+	}
+	b, err := GetBookingByCode(ctx, db, code)
+	if err != nil {
+		return Booking{}, err
+	}
+	if b.Status == StatusHold || subtle.ConstantTimeCompare([]byte(strings.ToLower(b.Contact.Email)), []byte(email)) != 1 {
+		return Booking{}, &Error{Code: CodeNotFound, Message: "booking not found"}
+	}
+	return b, nil
+}
@@ -0,0 +1,126 @@
+// Package booking implements the KAI clone domain on top of the trips,
+// seats and bookings schema: trip search, seat holds, passengers and checkout.
+//
+// Functions take a Querier so callers can pass either the global pool from
+// internal/db or a pgx.Tx when they need several steps to be atomic.
+package booking
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Querier is the subset of pgxpool.Pool / pgx.Tx used by this package.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// DB is a Querier that can also start transactions. *pgxpool.Pool satisfies it,
+// and so does pgx.Tx (nested Begin is a savepoint), which lets callers compose
+// several operations into one atomic unit.
+type DB interface {
+	Querier
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Seat classes sold on KAI trains, cheapest first.
+const (
+	ClassEconomy   = "economy"
+	ClassBusiness  = "business"
+	ClassExecutive = "executive"
+)
+
+// Classes lists the known seat classes in display order.
+var Classes = []string{ClassEconomy, ClassBusiness, ClassExecutive}
+
+// classMultiplier scales trips.base_price per seat class (percent).
+var classMultiplier = map[string]int64{
+	ClassEconomy:   100,
+	ClassBusiness:  140,
+	ClassExecutive: 180,
+}
+
+// ValidClass reports whether c is a known seat class.
+func ValidClass(c string) bool {
+	_, ok := classMultiplier[c]
+	return ok
+}
+
+// ClassPrice returns the per-seat fare in rupiah for a class given the trip base price,
+// using the built-in multipliers; FareRules.Quote applies the configured fare rules.
+// Unknown classes are priced at the base price.
+func ClassPrice(basePrice int64, class string) int64 {
+	m, ok := classMultiplier[strings.ToLower(class)]
+	if !ok {
+		m = 100
+	}
+	return basePrice * m / 100
+}
+
+// Error codes returned in Error.Code. Handlers map them to HTTP statuses.
+const (
+	CodeInvalid  = "invalid_request"
+	CodeNotFound = "not_found"
+)
+
+// Error is a domain error carrying a stable machine-readable code.
+// Fields optionally maps form field names to per-field messages so
+// forms can show validation problems next to the inputs they concern.
+type Error struct {
+	Code    string
+	Message string
+	Fields  map[string]string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func invalid(msg string) error { return &Error{Code: CodeInvalid, Message: msg} }
+
+func invalidField(field, msg string) error {
+	return &Error{Code: CodeInvalid, Message: msg, Fields: map[string]string{field: msg}}
+}
+
+// FieldErrors returns the per-field messages of err, if any.
+func FieldErrors(err error) map[string]string {
+	var be *Error
+	if errors.As(err, &be) {
+		return be.Fields
+	}
+	return nil
+}
+
+// ErrorCode returns the Error.Code of err, or "" when err is not a domain error.
+func ErrorCode(err error) string {
+	var be *Error
+	if errors.As(err, &be) {
+		return be.Code
+	}
+	return ""
+}
+
+// ValidUUID reports whether s looks like a canonical UUID, so malformed ids are
+// rejected as bad input instead of surfacing as database errors.
+func ValidUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,389 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// StatusCancelled is a booking whose every seat was cancelled by the customer.
+const StatusCancelled = "cancelled"
+
+// ItemCancelled is a seat the customer gave back; it no longer takes inventory.
+const ItemCancelled = "cancelled"
+
+// CodeNotCancellable is returned when a booking or seat can no longer be cancelled.
+const CodeNotCancellable = "not_cancellable"
+
+// Refund statuses.
+const (
+	RefundPending   = "pending"   // waiting for the refund worker
+	RefundSucceeded = "succeeded" // the gateway accepted the refund
+	RefundFailed    = "failed"    // gave up after the last attempt; needs manual follow-up
+)
+
+// RefundTier refunds Percent of what was paid for a seat cancelled at least
+// Before ahead of its departure.
+type RefundTier struct {
+	Before  time.Duration `json:"before"`
+	Percent int64         `json:"percent"`
+}
+
+// RefundPolicy is the cancellation schedule. The tier with the longest
+// Before that still applies wins; after departure nothing is refunded.
+type RefundPolicy []RefundTier
+
+// DefaultRefundPolicy refunds 75% up to H-7, 50% up to H-1 and 25% until
+// departure. Migration 00015 seeds refund_tiers with the same schedule.
+func DefaultRefundPolicy() RefundPolicy {
+	return RefundPolicy{{7 * 24 * time.Hour, 75}, {24 * time.Hour, 50}, {0, 25}}
+}
+
+// Percent returns the share refunded for a seat departing at departs when it
+// is cancelled at now.
+func (p RefundPolicy) Percent(departs, now time.Time) int64 {
+	left := departs.Sub(now)
+	if left <= 0 {
+		return 0
+	}
+	best := RefundTier{Before: -1}
+	for _, t := range p {
+		if left >= t.Before && t.Before > best.Before {
+			best = t
+		}
+	}
+	return max(best.Percent, 0)
+}
+
+// LoadRefundPolicy reads refund_tiers, falling back to DefaultRefundPolicy
+// when the table is empty.
+func LoadRefundPolicy(ctx context.Context, db Querier) (RefundPolicy, error) {
+	rows, err := db.Query(ctx, `SELECT min_hours, percent FROM refund_tiers ORDER BY min_hours DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var p RefundPolicy
+	for rows.Next() {
+		var (
+			hours int
+			t     RefundTier
+		)
+		if err := rows.Scan(&hours, &t.Percent); err != nil {
+			return nil, err
+		}
+		t.Before = time.Duration(hours) * time.Hour
+		p = append(p, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		p = DefaultRefundPolicy()
+	}
+	return p, nil
+}
+
+// Departure returns when the train of a booked trip leaves the boarding
+// station, in local time.
+func (t TripInfo) Departure() time.Time {
+	d, err := time.ParseInLocation("2006-01-02 15:04", t.ServiceDate+" "+t.Depart, time.Local)
+	if err != nil {
+		d, _ = time.ParseInLocation("2006-01-02", t.ServiceDate, time.Local)
+	}
+	return d
+}
+
+// ItemRefund is what cancelling one seat pays back.
+type ItemRefund struct {
+	ItemID  string `json:"item_id"`
+	Percent int64  `json:"percent"`
+	Amount  int64  `json:"amount"`
+}
+
+// paidFor is the seat's share of what the customer paid: its price less its
+// proportional share of the promo discount.
+func (b Booking) paidFor(it Item) int64 {
+	gross := b.Total + b.Discount
+	if gross <= 0 || b.Discount == 0 {
+		return it.Price
+	}
+	return it.Price * b.Total / gross
+}
+
+// ItemRefund quotes cancelling one seat of b at now. Unpaid bookings refund nothing.
+func (p RefundPolicy) ItemRefund(b Booking, it Item, now time.Time) ItemRefund {
+	r := ItemRefund{ItemID: it.ID}
+	if b.Status != StatusPaid {
+		return r
+	}
+	r.Percent = p.Percent(b.TripOf(it.TripID).Departure(), now)
+	r.Amount = b.paidFor(it) * r.Percent / 100
+	return r
+}
+
+// FullRefund quotes giving back everything paid for one seat of b.
+func (b Booking) FullRefund(it Item) ItemRefund {
+	if b.Status != StatusPaid {
+		return ItemRefund{ItemID: it.ID}
+	}
+	return ItemRefund{ItemID: it.ID, Percent: 100, Amount: b.paidFor(it)}
+}
+
+// CancelRequest cancels seats of a booking. Empty ItemIDs cancels every seat
+// left. On a connecting journey a passenger is cancelled on every train.
+// FullRefund pays back everything paid for the seats whatever the refund
+// policy says, as when the railway cancels or badly delays the train; it is
+// also implied while the booking has an open disruption offer.
+type CancelRequest struct {
+	BookingID  string   `json:"-"`
+	ItemIDs    []string `json:"item_ids,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+	FullRefund bool     `json:"-"`
+}
+
+// Cancellation is the outcome of CancelBooking.
+type Cancellation struct {
+	Booking  Booking      `json:"booking"`
+	Items    []ItemRefund `json:"items"`
+	Refund   int64        `json:"refund"`
+	RefundID string       `json:"refund_id,omitempty"`
+}
+
+// PlanCancellation works out which seats a cancellation covers and what each
+// refunds at now. Unpaid bookings can only be cancelled as a whole, and an
+// infant cannot be left on a train without an adult or senior.
+func PlanCancellation(b Booking, itemIDs []string, policy RefundPolicy, now time.Time) ([]ItemRefund, error) {
+	switch b.Status {
+	case StatusPaid, StatusPending:
+	default:
+		return nil, &Error{Code: CodeNotCancellable, Message: "booking is " + b.Status}
+	}
+	live := map[string]Item{}
+	for _, it := range b.Items {
+		if it.Status == ItemConfirmed {
+			live[it.ID] = it
+		}
+	}
+	itemIDs = dedupe(itemIDs)
+	if !allUUIDs(itemIDs) {
+		return nil, invalidField("item_ids", "item_ids must be UUIDs")
+	}
+	picked := map[string]bool{}
+	if len(itemIDs) == 0 {
+		for id := range live {
+			picked[id] = true
+		}
+	}
+	for _, id := range itemIDs {
+		it, ok := live[id]
+		if !ok {
+			return nil, &Error{Code: CodeNotCancellable, Message: "seat is not on this booking or already cancelled", Fields: map[string]string{"item_ids": "seat is not on this booking or already cancelled"}}
+		}
+		picked[id] = true
+		if p := it.Passenger; p != nil && len(b.Legs) > 0 {
+			for _, other := range live {
+				if q := other.Passenger; q != nil && q.IDType == p.IDType && strings.EqualFold(q.IDNumber, p.IDNumber) {
+					picked[other.ID] = true
+				}
+			}
+		}
+	}
+	if len(picked) == 0 {
+		return nil, &Error{Code: CodeNotCancellable, Message: "booking has no seats left to cancel"}
+	}
+	if b.Status == StatusPending && len(picked) != len(live) {
+		return nil, invalidField("item_ids", "an unpaid booking can only be cancelled as a whole")
+	}
+
+	// An infant shares a seat holder's trip: some adult or senior must remain on
+	// every train that still carries an infant.
+	escorted, infants := map[string]bool{}, map[string]bool{}
+	for id, it := range live {
+		if picked[id] || it.Passenger == nil {
+			continue
+		}
+		switch it.Passenger.Category {
+		case CategoryAdult, CategorySenior:
+			escorted[it.TripID] = true
+		case CategoryInfant:
+			infants[it.TripID] = true
+		}
+	}
+	for trip := range infants {
+		if !escorted[trip] {
+			return nil, invalidField("item_ids", "an infant cannot travel without an adult or senior; cancel the infant too")
+		}
+	}
+
+	out := make([]ItemRefund, 0, len(picked))
+	for _, it := range b.Items {
+		if picked[it.ID] {
+			out = append(out, policy.ItemRefund(b, it, now))
+		}
+	}
+	return out, nil
+}
+
+// CancelBooking cancels seats of a booking in one transaction: the seats go
+// back to inventory, a booking with no seats left becomes cancelled and frees
+// its promo code, and what the refund policy pays back is recorded as a
+// pending refund for the refund worker.
+func CancelBooking(ctx context.Context, db DB, req CancelRequest) (Cancellation, error) {
+	var c Cancellation
+	if !ValidUUID(req.BookingID) {
+		return c, invalid("booking id must be a UUID")
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len(reason) > 255 {
+		return c, invalidField("reason", "reason is too long")
+	}
+	var changes []SeatChange
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		c = Cancellation{}
+		var status string
+		err := tx.QueryRow(ctx, `SELECT status FROM bookings WHERE id = $1 FOR UPDATE`, req.BookingID).Scan(&status)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &Error{Code: CodeNotFound, Message: "booking not found"}
+		}
+		if err != nil {
+			return err
+		}
+		b, err := GetBookingByID(ctx, tx, req.BookingID)
+		if err != nil {
+			return err
+		}
+		policy, err := LoadRefundPolicy(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if c.Items, err = PlanCancellation(b, req.ItemIDs, policy, time.Now()); err != nil {
+			return err
+		}
+		offer, err := OpenDisruption(ctx, tx, b.ID)
+		if err != nil {
+			return err
+		}
+		if req.FullRefund || offer != nil {
+			byID := map[string]Item{}
+			for _, it := range b.Items {
+				byID[it.ID] = it
+			}
+			for i, r := range c.Items {
+				c.Items[i] = b.FullRefund(byID[r.ItemID])
+			}
+			if reason == "" && offer != nil {
+				reason = offer.refundReason()
+			}
+		}
+		if reason == "" {
+			reason = "cancelled by customer"
+		}
+
+		ids := make([]string, len(c.Items))
+		for i, r := range c.Items {
+			ids[i] = r.ItemID
+			c.Refund += r.Amount
+		}
+		if changes, err = updateSeats(ctx, tx, SeatReleased, `
+UPDATE booking_items SET status = 'cancelled', cancelled_at = now()
+WHERE booking_id = $1 AND id = ANY($2::UUID[]) AND status = 'confirmed'
+RETURNING seat_id`, b.ID, ids); err != nil {
+			return err
+		}
+		var left int
+		if err := tx.QueryRow(ctx, `SELECT count(*) FROM booking_items WHERE booking_id = $1 AND status = 'confirmed'`, b.ID).Scan(&left); err != nil {
+			return err
+		}
+		// A trip change waiting for its balance no longer fits the seats left.
+		voided, err := voidPendingChange(ctx, tx, b.ID)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, voided...)
+		event := EventSeatsCancelled
+		if left == 0 {
+			event = EventCancelled
+			if _, err := tx.Exec(ctx, `UPDATE bookings SET status = 'cancelled', cancelled_at = now() WHERE id = $1`, b.ID); err != nil {
+				return err
+			}
+			if err := releasePromos(ctx, tx, []string{b.ID}); err != nil {
+				return err
+			}
+			if offer != nil {
+				if err := closeDisruptionOffer(ctx, tx, offer.ID, OutcomeRefunded, "", nil, c.Refund); err != nil {
+					return err
+				}
+			}
+		}
+
+		if c.Refund > 0 {
+			if err := tx.QueryRow(ctx, `INSERT INTO refunds (booking_id, amount, reason) VALUES ($1, $2, $3) RETURNING id`,
+				b.ID, c.Refund, reason).Scan(&c.RefundID); err != nil {
+				return err
+			}
+			for _, r := range c.Items {
+				if _, err := tx.Exec(ctx, `INSERT INTO refund_items (refund_id, booking_item_id, percent, amount) VALUES ($1, $2, $3, $4)`,
+					c.RefundID, r.ItemID, r.Percent, r.Amount); err != nil {
+					return err
+				}
+			}
+		}
+		if err := recordHistory(ctx, tx, b.ID, event, map[string]any{"items": ids, "refund": c.Refund, "reason": reason, "full_refund": req.FullRefund}); err != nil {
+			return err
+		}
+		c.Booking, err = GetBookingByID(ctx, tx, b.ID)
+		return err
+	})
+	if err == nil {
+		seatsFreed()
+		announceSeats(changes)
+	}
+	return c, err
+}
+
+// Refund is money owed back on a booking, as recorded in the refunds table.
+type Refund struct {
+	ID          string     `json:"id"`
+	BookingID   string     `json:"booking_id"`
+	Amount      int64      `json:"amount"`
+	Reason      string     `json:"reason"`
+	Status      string     `json:"status"`
+	Provider    string     `json:"provider,omitempty"`
+	ExternalID  string     `json:"external_id,omitempty"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty"`
+}
+
+// RefundColumns selects a Refund from the refunds table aliased rf.
+const RefundColumns = `rf.id, rf.booking_id, rf.amount::INT8, rf.reason, rf.status, rf.provider, rf.external_id,
+       rf.attempts, rf.last_error, rf.created_at, rf.processed_at`
+
+// ScanRefund scans RefundColumns, followed by extra destinations.
+func ScanRefund(row pgx.Row, r *Refund, extra ...any) error {
+	return row.Scan(append([]any{&r.ID, &r.BookingID, &r.Amount, &r.Reason, &r.Status, &r.Provider, &r.ExternalID,
+		&r.Attempts, &r.LastError, &r.CreatedAt, &r.ProcessedAt}, extra...)...)
+}
+
+// ListRefunds returns the refunds of a booking, oldest first.
+func ListRefunds(ctx context.Context, db Querier, bookingID string) ([]Refund, error) {
+	rows, err := db.Query(ctx, `SELECT `+RefundColumns+` FROM refunds rf WHERE rf.booking_id = $1 ORDER BY rf.created_at`, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Refund
+	for rows.Next() {
+		var r Refund
+		if err := ScanRefund(rows, &r); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
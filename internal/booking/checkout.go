@@ -0,0 +1,467 @@
+package booking
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// codeAlphabet omits look-alike characters (0/O, 1/I/L) so codes survive being read aloud.
+const codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// CodeLength is the length of generated booking codes.
+const CodeLength = 7
+
+// NewBookingCode returns a random human-friendly booking code such as "K7QM2XA".
+func NewBookingCode() string {
+	b := make([]byte, CodeLength)
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = codeAlphabet[n.Int64()]
+	}
+	return string(b)
+}
+
+// Contact is the person the booking belongs to; tickets and notices go here.
+type Contact struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+}
+
+// Validate normalizes and checks contact details.
+func (c *Contact) Validate() error {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Email = strings.ToLower(strings.TrimSpace(c.Email))
+	c.Phone = strings.TrimSpace(c.Phone)
+	if c.Name == "" {
+		return invalidField("contact.name", "contact name is required")
+	}
+	if len(c.Name) > 200 {
+		return invalidField("contact.name", "contact name is too long")
+	}
+	if a, err := mail.ParseAddress(c.Email); err != nil || a.Address != c.Email {
+		return invalidField("contact.email", "a valid contact email is required")
+	}
+	if len(c.Phone) > 40 {
+		return invalidField("contact.phone", "contact phone is too long")
+	}
+	return nil
+}
+
+// CheckoutRequest converts the holder's cart on a trip into a booking.
+// When SeatIDs is set, exactly those seats must still be held, which lets a
+// client detect that part of its selection expired or was lost to a race.
+// When Passengers is set, every held seat must be assigned exactly one.
+type CheckoutRequest struct {
+	Holder     string      `json:"-"`
+	TripID     string      `json:"trip_id"`
+	SeatIDs    []string    `json:"seat_ids,omitempty"`
+	Contact    Contact     `json:"contact"`
+	Passengers []Passenger `json:"passengers,omitempty"`
+	PromoCode  string      `json:"promo_code,omitempty"`
+}
+
+// Item is one seat on a booking.
+type Item struct {
+	ID        string     `json:"id"`
+	SeatID    string     `json:"seat_id"`
+	TripID    string     `json:"trip_id"`
+	CoachNo   int        `json:"coach_no"`
+	SeatNo    string     `json:"seat_no"`
+	Class     string     `json:"class"`
+	Price     int64      `json:"price"`
+	Fare      *Fare      `json:"fare,omitempty"` // how Price was computed; nil for items priced before fare rules
+	Status    string     `json:"status"`
+	Refund    int64      `json:"refund,omitempty"` // paid back when the seat was cancelled
+	Passenger *Passenger `json:"passenger,omitempty"`
+}
+
+// TripInfo summarizes the trip a booking is for.
+type TripInfo struct {
+	TrainCode       string `json:"train_code"`
+	TrainName       string `json:"train_name"`
+	Origin          string `json:"origin"`
+	OriginName      string `json:"origin_name"`
+	Destination     string `json:"destination"`
+	DestinationName string `json:"destination_name"`
+	ServiceDate     string `json:"service_date"`
+	Depart          string `json:"depart"`
+	Arrive          string `json:"arrive"`
+	Status          string `json:"status"`
+}
+
+// BookedLeg is one train of a connecting journey booking.
+type BookedLeg struct {
+	TripID string   `json:"trip_id"`
+	Leg    Leg      `json:"leg"`
+	Trip   TripInfo `json:"trip"`
+}
+
+// Booking is a checked-out order. A connecting journey lists its trains in
+// Legs; its Trip then runs from the first leg's departure to the last leg's
+// arrival, and TripID and Leg are those of the first leg.
+type Booking struct {
+	ID           string      `json:"id"`
+	Code         string      `json:"code"`
+	UserRef      string      `json:"-"`
+	TripID       string      `json:"trip_id"`
+	Status       string      `json:"status"`
+	Total        int64       `json:"total_price"` // after Discount
+	PromoCode    string      `json:"promo_code,omitempty"`
+	Discount     int64       `json:"discount,omitempty"`
+	Refunded     int64       `json:"refunded,omitempty"` // owed back for cancelled seats, whether or not paid out yet
+	Contact      Contact     `json:"contact"`
+	CreatedAt    time.Time   `json:"created_at"`
+	PaymentDueAt *time.Time  `json:"payment_due_at,omitempty"`
+	PaidAt       *time.Time  `json:"paid_at,omitempty"`
+	Trip         TripInfo    `json:"trip"`
+	Leg          Leg         `json:"leg"`
+	Legs         []BookedLeg `json:"legs,omitempty"`
+	Items        []Item      `json:"items"`
+}
+
+// TripOf returns the summary of one booked trip: a leg of a journey, or the
+// booking's own trip.
+func (b Booking) TripOf(tripID string) TripInfo {
+	for _, l := range b.Legs {
+		if l.TripID == tripID {
+			return l.Trip
+		}
+	}
+	return b.Trip
+}
+
+// Checkout turns the holder's live holds on a trip into a pending booking in
+// one transaction: it assigns a unique booking code, prices every seat for its
+// class and passenger with the fare rules, storing the breakdown, and flips
+// the items from held to confirmed.
+// The booking must be paid within PaymentWindow or its seats are released.
+// Missing or lapsed holds return a hold_expired error.
+func Checkout(ctx context.Context, db DB, req CheckoutRequest) (Booking, error) {
+	var b Booking
+	if strings.TrimSpace(req.Holder) == "" {
+		return b, invalid("holder is required")
+	}
+	if !ValidUUID(req.TripID) {
+		return b, invalid("trip_id must be a UUID")
+	}
+	req.SeatIDs = dedupe(req.SeatIDs)
+	if !allUUIDs(req.SeatIDs) {
+		return b, invalid("seat_ids must be UUIDs")
+	}
+	if err := req.Contact.Validate(); err != nil {
+		return b, err
+	}
+	if len(req.Passengers) > 0 {
+		if err := ValidatePassengers(req.Passengers, time.Now()); err != nil {
+			return b, err
+		}
+	}
+	var id string
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		var err error
+		id, err = checkoutTx(ctx, tx, req)
+		return err
+	})
+	if err != nil {
+		return b, err
+	}
+	return bookedBooking(ctx, db, id)
+}
+
+// bookedBooking loads a booking just checked out and announces its seats as booked.
+func bookedBooking(ctx context.Context, db Querier, id string) (Booking, error) {
+	b, err := GetBookingByID(ctx, db, id)
+	if err == nil {
+		announceSeats(itemChanges(SeatBooked, b.Items))
+	}
+	return b, err
+}
+
+// checkoutTx confirms the holder's cart for a trip. The trip row is share
+// locked, so a trip cancelled while the customer was paying is either seen
+// here or waits for this booking to exist.
+func checkoutTx(ctx context.Context, tx pgx.Tx, req CheckoutRequest) (string, error) {
+	var (
+		cartID   string
+		base     int64
+		date     time.Time
+		leg      Leg
+		status   string
+		upcoming bool
+	)
+	err := tx.QueryRow(ctx, `
+SELECT b.id, t.base_price::INT8, t.service_date, b.from_seq, b.to_seq, t.status, t.service_date >= current_date
+FROM bookings b JOIN trips t ON t.id = b.trip_id
+WHERE b.user_ref = $1 AND b.trip_id = $2 AND b.status = 'hold' AND NOT b.journey
+FOR UPDATE OF b FOR SHARE OF t`, req.Holder, req.TripID).Scan(&cartID, &base, &date, &leg.From, &leg.To, &status, &upcoming)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", &Error{Code: CodeHoldExpired, Message: "no active seat holds for this trip"}
+	}
+	if err != nil {
+		return "", err
+	}
+	if status == "cancelled" || !upcoming {
+		return "", invalid("trip is not open for sale")
+	}
+	stops, err := TripStops(ctx, tx, req.TripID)
+	if err != nil {
+		return "", err
+	}
+	basis := legBasis(stops, leg, base, date)
+	rules, err := LoadFareRules(ctx, tx)
+	if err != nil {
+		return "", err
+	}
+
+	type heldRow struct {
+		id, seatID, class string
+		live              bool
+	}
+	rows, err := tx.Query(ctx, `
+SELECT bi.id, bi.seat_id, s.class, bi.held_until > now()
+FROM booking_items bi JOIN seats s ON s.id = bi.seat_id
+WHERE bi.booking_id = $1 AND bi.status = 'held'
+ORDER BY bi.id
+FOR UPDATE OF bi`, cartID)
+	if err != nil {
+		return "", err
+	}
+	held := make([]heldRow, 0, 4)
+	for rows.Next() {
+		var h heldRow
+		if err := rows.Scan(&h.id, &h.seatID, &h.class, &h.live); err != nil {
+			rows.Close()
+			return "", err
+		}
+		held = append(held, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(held) == 0 {
+		return "", &Error{Code: CodeHoldExpired, Message: "no active seat holds for this trip"}
+	}
+	heldSeats := make(map[string]bool, len(held))
+	for _, h := range held {
+		if !h.live {
+			return "", &Error{Code: CodeHoldExpired, Message: "seat hold expired, please select seats again"}
+		}
+		heldSeats[h.seatID] = true
+	}
+	if len(req.SeatIDs) > 0 {
+		if len(req.SeatIDs) != len(held) {
+			return "", &Error{Code: CodeHoldExpired, Message: "held seats changed, please review your selection"}
+		}
+		for _, s := range req.SeatIDs {
+			if !heldSeats[s] {
+				return "", &Error{Code: CodeHoldExpired, Message: "held seats changed, please review your selection"}
+			}
+		}
+	}
+
+	if len(req.Passengers) > 0 {
+		items := make(map[string]string, len(held))
+		for _, h := range held {
+			items[h.seatID] = h.id
+		}
+		if err := savePassengers(ctx, tx, items, req.Passengers); err != nil {
+			return "", err
+		}
+	}
+
+	var total int64
+	for _, h := range held {
+		price, err := confirmItem(ctx, tx, rules, basis, h.id, h.class)
+		if err != nil {
+			return "", err
+		}
+		total += price
+	}
+
+	return cartID, closeCart(ctx, tx, cartID, total, req.Holder, req.PromoCode, req.Contact)
+}
+
+// closeCart turns a cart whose items are confirmed into a pending booking:
+// it drops the seats released or lapsed while shopping, redeems the promo
+// code if one was entered, assigns a booking code and starts the payment
+// deadline.
+func closeCart(ctx context.Context, tx pgx.Tx, cartID string, total int64, holder, promo string, c Contact) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM booking_items WHERE booking_id = $1 AND status IN ('released','expired')`, cartID); err != nil {
+		return err
+	}
+	if strings.TrimSpace(promo) != "" {
+		discount, err := redeemPromo(ctx, tx, promo, cartID, holder, c.Email)
+		if err != nil {
+			return err
+		}
+		total -= discount
+	}
+
+	// Booking codes are short, so retry on the rare collision inside a savepoint.
+	for attempt := 0; ; attempt++ {
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = sp.Exec(ctx, `
+UPDATE bookings SET code = $2, status = 'pending', total_price = $3,
+       contact_name = $4, contact_email = $5, contact_phone = $6, checked_out_at = now(),
+       payment_due_at = now() + ($7::INT8 * INTERVAL '1 second')
+WHERE id = $1`, cartID, NewBookingCode(), total, c.Name, c.Email, c.Phone, int64(PaymentWindow()/time.Second))
+		if err == nil {
+			if err := sp.Commit(ctx); err != nil {
+				return err
+			}
+			return recordHistory(ctx, tx, cartID, EventCheckedOut, map[string]any{"total": total, "promo_code": NormalizePromoCode(promo)})
+		}
+		_ = sp.Rollback(ctx)
+		var pgErr *pgconn.PgError
+		if attempt < 5 && errors.As(err, &pgErr) && pgErr.Code == "23505" && strings.Contains(pgErr.ConstraintName, "code") {
+			continue
+		}
+		return err
+	}
+}
+
+// GetBookingByID loads a booking with its trip summary (for the booked leg) and items.
+func GetBookingByID(ctx context.Context, db Querier, id string) (Booking, error) {
+	return getBooking(ctx, db, `b.id = $1`, id)
+}
+
+// GetBookingByCode loads a booking by its public code (case-insensitive).
+func GetBookingByCode(ctx context.Context, db Querier, code string) (Booking, error) {
+	return getBooking(ctx, db, `b.code = $1`, strings.ToUpper(strings.TrimSpace(code)))
+}
+
+func getBooking(ctx context.Context, db Querier, where string, arg any) (Booking, error) {
+	var (
+		b              Booking
+		date           time.Time
+		depart, arrive string
+		journey        bool
+	)
+	err := db.QueryRow(ctx, `
+SELECT b.id, b.code, b.user_ref, b.trip_id, b.status, b.total_price::INT8, COALESCE(b.promo_code, ''), b.discount_total::INT8,
+       (SELECT COALESCE(SUM(rf.amount), 0)::INT8 FROM refunds rf WHERE rf.booking_id = b.id),
+       COALESCE(b.contact_name, ''), COALESCE(b.contact_email, ''), COALESCE(b.contact_phone, ''), b.created_at,
+       b.payment_due_at, b.paid_at,
+       tr.code, tr.name, so.code, so.name, sd.code, sd.name, t.service_date + fs.day_offset,
+       COALESCE(fs.depart_time::TEXT, ''), COALESCE(ts.arrive_time::TEXT, ''), t.status, b.from_seq, b.to_seq, b.journey
+FROM bookings b
+JOIN trips t ON t.id = b.trip_id
+JOIN trip_stops fs ON fs.trip_id = t.id AND fs.seq = b.from_seq
+JOIN stations so ON so.id = fs.station_id
+JOIN trip_stops ts ON ts.trip_id = t.id AND ts.seq = b.to_seq
+JOIN stations sd ON sd.id = ts.station_id
+JOIN trains tr ON tr.id = t.train_id
+WHERE `+where, arg).Scan(&b.ID, &b.Code, &b.UserRef, &b.TripID, &b.Status, &b.Total, &b.PromoCode, &b.Discount, &b.Refunded,
+		&b.Contact.Name, &b.Contact.Email, &b.Contact.Phone, &b.CreatedAt, &b.PaymentDueAt, &b.PaidAt,
+		&b.Trip.TrainCode, &b.Trip.TrainName, &b.Trip.Origin, &b.Trip.OriginName, &b.Trip.Destination, &b.Trip.DestinationName,
+		&date, &depart, &arrive, &b.Trip.Status, &b.Leg.From, &b.Leg.To, &journey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return b, &Error{Code: CodeNotFound, Message: "booking not found"}
+	}
+	if err != nil {
+		return b, err
+	}
+	b.Trip.ServiceDate = date.Format("2006-01-02")
+	b.Trip.Depart = hhmm(depart)
+	b.Trip.Arrive = hhmm(arrive)
+	if journey {
+		if b.Legs, err = bookedLegs(ctx, db, b.ID); err != nil {
+			return b, err
+		}
+		if n := len(b.Legs); n > 0 {
+			last := b.Legs[n-1].Trip
+			b.Trip.Destination, b.Trip.DestinationName, b.Trip.Arrive = last.Destination, last.DestinationName, last.Arrive
+		}
+	}
+
+	rows, err := db.Query(ctx, `
+SELECT bi.id, bi.seat_id, s.trip_id, s.coach_no, s.seat_no, s.class, bi.price::INT8, COALESCE(bi.fare_breakdown::TEXT, ''), bi.status,
+       (SELECT COALESCE(SUM(ri.amount), 0)::INT8 FROM refund_items ri WHERE ri.booking_item_id = bi.id),
+       COALESCE(p.full_name, ''), COALESCE(p.id_type, ''), COALESCE(p.id_number, ''), COALESCE(p.category, '')
+FROM booking_items bi JOIN seats s ON s.id = bi.seat_id
+LEFT JOIN passengers p ON p.booking_item_id = bi.id
+LEFT JOIN booking_legs bl ON bl.booking_id = bi.booking_id AND bl.trip_id = s.trip_id
+WHERE bi.booking_id = $1
+ORDER BY bl.leg_no, s.coach_no, s.seat_no`, b.ID)
+	if err != nil {
+		return b, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			it   Item
+			p    Passenger
+			fare string
+		)
+		if err := rows.Scan(&it.ID, &it.SeatID, &it.TripID, &it.CoachNo, &it.SeatNo, &it.Class, &it.Price, &fare, &it.Status, &it.Refund,
+			&p.Name, &p.IDType, &p.IDNumber, &p.Category); err != nil {
+			return b, err
+		}
+		if fare != "" {
+			it.Fare = &Fare{}
+			if err := json.Unmarshal([]byte(fare), it.Fare); err != nil {
+				return b, err
+			}
+		}
+		if p.Name != "" {
+			p.SeatID = it.SeatID
+			it.Passenger = &p
+		}
+		b.Items = append(b.Items, it)
+	}
+	return b, rows.Err()
+}
+
+// bookedLegs loads the trains of a connecting journey booking in travel order.
+func bookedLegs(ctx context.Context, db Querier, bookingID string) ([]BookedLeg, error) {
+	rows, err := db.Query(ctx, `
+SELECT bl.trip_id, bl.from_seq, bl.to_seq, tr.code, tr.name, so.code, so.name, sd.code, sd.name,
+       t.service_date + fs.day_offset, COALESCE(fs.depart_time::TEXT, ''), COALESCE(ts.arrive_time::TEXT, ''), t.status
+FROM booking_legs bl
+JOIN trips t ON t.id = bl.trip_id
+JOIN trip_stops fs ON fs.trip_id = t.id AND fs.seq = bl.from_seq
+JOIN stations so ON so.id = fs.station_id
+JOIN trip_stops ts ON ts.trip_id = t.id AND ts.seq = bl.to_seq
+JOIN stations sd ON sd.id = ts.station_id
+JOIN trains tr ON tr.id = t.train_id
+WHERE bl.booking_id = $1
+ORDER BY bl.leg_no`, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []BookedLeg
+	for rows.Next() {
+		var (
+			l              BookedLeg
+			date           time.Time
+			depart, arrive string
+		)
+		if err := rows.Scan(&l.TripID, &l.Leg.From, &l.Leg.To, &l.Trip.TrainCode, &l.Trip.TrainName,
+			&l.Trip.Origin, &l.Trip.OriginName, &l.Trip.Destination, &l.Trip.DestinationName,
+			&date, &depart, &arrive, &l.Trip.Status); err != nil {
+			return nil, err
+		}
+		l.Trip.ServiceDate, l.Trip.Depart, l.Trip.Arrive = date.Format("2006-01-02"), hhmm(depart), hhmm(arrive)
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,527 @@
+package booking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/env"
+	"gothicforge3/internal/textx"
+)
+
+// Disruption kinds: what operations did to the trip.
+const (
+	DisruptionDelay  = "delay"
+	DisruptionCancel = "cancel"
+)
+
+// What a disruption run did with a booking.
+const (
+	OutcomeMoved     = "moved"     // rebooked onto another departure at no extra cost
+	OutcomeRefunded  = "refunded"  // cancelled and everything paid refunded
+	OutcomeCancelled = "cancelled" // unpaid booking cancelled, nothing to refund
+	OutcomeNotified  = "notified"  // told about the delay, the booking stands
+	OutcomeFailed    = "failed"    // could not be handled; see Error
+)
+
+// EventDisrupted is the booking history event of a disruption run.
+const EventDisrupted = "disrupted"
+
+// DisruptionOfferDelay returns how late a train has to run before its
+// passengers are offered a free change or a full refund
+// (DISRUPTION_REFUND_DELAY_MINUTES, default 60).
+func DisruptionOfferDelay() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(env.Get("DISRUPTION_REFUND_DELAY_MINUTES", ""))); err == nil && n > 0 {
+		return n
+	}
+	return 60
+}
+
+// DisruptionRebookDays returns how many days after the cancelled train's
+// service date automatic rebooking looks for a departure
+// (DISRUPTION_REBOOK_DAYS, default 1).
+func DisruptionRebookDays() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(env.Get("DISRUPTION_REBOOK_DAYS", ""))); err == nil && n >= 0 {
+		return n
+	}
+	return 1
+}
+
+// DisruptionRequest starts the workflow for a trip operations delayed or
+// cancelled. Rebook moves passengers of a cancelled trip to the next
+// departure with room for them; without it, or when none has, they are
+// refunded in full.
+type DisruptionRequest struct {
+	TripID       string `json:"trip_id"`
+	Kind         string `json:"kind"`
+	DelayMinutes int    `json:"delay_minutes,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+	Actor        string `json:"-"`
+	Rebook       bool   `json:"rebook"`
+}
+
+// Validate normalizes and checks a request.
+func (r *DisruptionRequest) Validate() error {
+	r.Kind = strings.ToLower(strings.TrimSpace(r.Kind))
+	r.Reason = strings.TrimSpace(r.Reason)
+	if !ValidUUID(r.TripID) {
+		return invalidField("trip_id", "trip_id must be a UUID")
+	}
+	switch r.Kind {
+	case DisruptionDelay:
+		if r.DelayMinutes < 1 || r.DelayMinutes > 24*60 {
+			return invalidField("delay_minutes", "delay must be between 1 and 1440 minutes")
+		}
+	case DisruptionCancel:
+		r.DelayMinutes = 0
+	default:
+		return invalidField("kind", "kind must be delay or cancel")
+	}
+	if len(r.Reason) > 500 {
+		return invalidField("reason", "reason is up to 500 characters")
+	}
+	return nil
+}
+
+// disruptionReason is what refunds and history say about a disruption.
+func disruptionReason(kind string, delay int) string {
+	if kind == DisruptionDelay {
+		return fmt.Sprintf("train delayed %d minutes", delay)
+	}
+	return "train cancelled by the railway"
+}
+
+// DisruptedPassenger is who sat where on the disrupted train.
+type DisruptedPassenger struct {
+	Name    string `json:"name"`
+	Class   string `json:"class"`
+	CoachNo int    `json:"coach_no"`
+	SeatNo  string `json:"seat_no"`
+}
+
+// DisruptedBooking is one line of a disruption report. Refund is what was
+// paid back; OfferUntil is set while the customer can still take a free
+// change or a full refund instead.
+type DisruptedBooking struct {
+	BookingID    string               `json:"booking_id"`
+	Code         string               `json:"code"`
+	Contact      Contact              `json:"contact"`
+	Outcome      string               `json:"outcome"`
+	Passengers   []DisruptedPassenger `json:"passengers"`
+	NewTripID    string               `json:"new_trip_id,omitempty"`
+	NewTrain     string               `json:"new_train,omitempty"`
+	NewDeparture *time.Time           `json:"new_departure,omitempty"`
+	Refund       int64                `json:"refund"`
+	OfferUntil   *time.Time           `json:"offer_until,omitempty"`
+	Notified     bool                 `json:"notified"`
+	Error        string               `json:"error,omitempty"`
+}
+
+// Disruption is one run of the workflow and its report.
+type Disruption struct {
+	ID           string             `json:"id"`
+	TripID       string             `json:"trip_id"`
+	Trip         TripInfo           `json:"trip"`
+	Kind         string             `json:"kind"`
+	DelayMinutes int                `json:"delay_minutes,omitempty"`
+	Reason       string             `json:"reason,omitempty"`
+	Actor        string             `json:"actor,omitempty"`
+	CreatedAt    time.Time          `json:"created_at"`
+	FinishedAt   *time.Time         `json:"finished_at,omitempty"`
+	Bookings     []DisruptedBooking `json:"bookings,omitempty"`
+}
+
+// Summary counts the passengers per outcome.
+func (d Disruption) Summary() map[string]int {
+	out := map[string]int{}
+	for _, b := range d.Bookings {
+		out[b.Outcome] += len(b.Passengers)
+	}
+	return out
+}
+
+// DisruptionNotice tells a customer what a disruption did to their booking.
+type DisruptionNotice struct {
+	Disruption Disruption
+	Booking    DisruptedBooking
+}
+
+// PlanDisruption decides what the workflow does with booking b. Unpaid
+// bookings on a cancelled train are cancelled. Paid ones are moved when
+// req.Rebook allows it (a connecting journey is refunded whole instead).
+// Passengers of a train delayed by at least DisruptionOfferDelay may take a
+// free change or a full refund until it leaves; offerUntil says until when.
+func PlanDisruption(req DisruptionRequest, b Booking) (outcome string, offerUntil *time.Time) {
+	if req.Kind == DisruptionCancel {
+		switch {
+		case b.Status != StatusPaid:
+			return OutcomeCancelled, nil
+		case req.Rebook && len(b.Legs) == 0:
+			return OutcomeMoved, nil
+		default:
+			return OutcomeRefunded, nil
+		}
+	}
+	if b.Status != StatusPaid || req.DelayMinutes < DisruptionOfferDelay() {
+		return OutcomeNotified, nil
+	}
+	until := b.TripOf(req.TripID).Departure().Add(time.Duration(req.DelayMinutes) * time.Minute)
+	return OutcomeNotified, &until
+}
+
+// RebookCandidates picks the departures a booking needing seats per class
+// could move to, in departure order: not the disrupted trip itself, leaving
+// after after, with enough seats left in every class.
+func RebookCandidates(results []TripResult, need map[string]int, exclude string, after time.Time) []TripResult {
+	var out []TripResult
+	for _, r := range results {
+		if r.TripID == exclude || r.Status == "cancelled" || !(TripInfo{ServiceDate: r.ServiceDate, Depart: r.Depart}).Departure().After(after) {
+			continue
+		}
+		left := map[string]int{}
+		for _, c := range r.Classes {
+			left[c.Class] = c.SeatsLeft
+		}
+		fits := true
+		for class, n := range need {
+			fits = fits && left[class] >= n
+		}
+		if fits {
+			out = append(out, r)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return (TripInfo{ServiceDate: out[i].ServiceDate, Depart: out[i].Depart}).Departure().
+			Before((TripInfo{ServiceDate: out[j].ServiceDate, Depart: out[j].Depart}).Departure())
+	})
+	return out
+}
+
+// Disrupt runs the workflow for a trip operations delayed or cancelled. Every
+// paid or unpaid booking with seats on it is handled in its own transaction,
+// oldest first, so one that fails is reported and the rest carry on; then the
+// customers are notified. Running it again handles whoever is still on the
+// trip. It returns the report.
+func Disrupt(ctx context.Context, db DB, req DisruptionRequest, n Notifier) (Disruption, error) {
+	var d Disruption
+	if err := req.Validate(); err != nil {
+		return d, err
+	}
+	ti, _, _, err := GetTrip(ctx, db, req.TripID, "", "")
+	if err != nil {
+		return d, err
+	}
+	d = Disruption{TripID: req.TripID, Trip: ti, Kind: req.Kind, DelayMinutes: req.DelayMinutes, Reason: req.Reason, Actor: req.Actor}
+	if err := db.QueryRow(ctx, `
+INSERT INTO disruptions (trip_id, kind, delay_minutes, reason, actor) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		req.TripID, req.Kind, req.DelayMinutes, req.Reason, req.Actor).Scan(&d.ID, &d.CreatedAt); err != nil {
+		return d, err
+	}
+	ids, err := disruptedBookingIDs(ctx, db, req.TripID)
+	if err != nil {
+		return d, err
+	}
+	for _, id := range ids {
+		r, err := disruptBooking(ctx, db, d, req, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return d, ctx.Err()
+			}
+			log.Printf("disruption %s: booking %s: %v", d.ID, id, err)
+			r.Outcome, r.Error = OutcomeFailed, textx.Truncate(err.Error(), 500)
+			if _, err := db.Exec(ctx, `INSERT INTO disruption_bookings (disruption_id, booking_id, outcome, error) VALUES ($1, $2, $3, $4)`,
+				d.ID, id, r.Outcome, r.Error); err != nil {
+				return d, err
+			}
+		}
+		d.Bookings = append(d.Bookings, r)
+	}
+	for i := range d.Bookings {
+		r := &d.Bookings[i]
+		if r.Outcome == OutcomeFailed || n == nil {
+			continue
+		}
+		if err := n.NotifyDisruption(ctx, DisruptionNotice{Disruption: d, Booking: *r}); err != nil {
+			log.Printf("disruption %s: notify %s: %v", d.ID, r.Code, err)
+			continue
+		}
+		r.Notified = true
+		if _, err := db.Exec(ctx, `UPDATE disruption_bookings SET notified = TRUE, updated_at = now() WHERE disruption_id = $1 AND booking_id = $2`,
+			d.ID, r.BookingID); err != nil {
+			return d, err
+		}
+	}
+	err = db.QueryRow(ctx, `UPDATE disruptions SET finished_at = now() WHERE id = $1 RETURNING finished_at`, d.ID).Scan(&d.FinishedAt)
+	return d, err
+}
+
+// disruptedBookingIDs lists the paid and unpaid bookings with seats on a trip, oldest first.
+func disruptedBookingIDs(ctx context.Context, db Querier, tripID string) ([]string, error) {
+	rows, err := db.Query(ctx, `
+SELECT b.id FROM bookings b
+WHERE b.status IN ('paid', 'pending')
+  AND EXISTS (SELECT 1 FROM booking_items bi JOIN seats s ON s.id = bi.seat_id
+              WHERE bi.booking_id = b.id AND bi.status = 'confirmed' AND s.trip_id = $1)
+ORDER BY b.created_at, b.id`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// disruptBooking handles one booking of a run in its own transaction and
+// records the outcome in the report and the booking's history.
+func disruptBooking(ctx context.Context, db DB, d Disruption, req DisruptionRequest, bookingID string) (DisruptedBooking, error) {
+	var r DisruptedBooking
+	reason := disruptionReason(req.Kind, req.DelayMinutes)
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT 1 FROM bookings WHERE id = $1 FOR UPDATE`, bookingID); err != nil {
+			return err
+		}
+		b, err := GetBookingByID(ctx, tx, bookingID)
+		if err != nil {
+			return err
+		}
+		r = DisruptedBooking{BookingID: b.ID, Code: b.Code, Contact: b.Contact, Passengers: []DisruptedPassenger{}}
+		for _, it := range b.Items {
+			if it.Status != ItemConfirmed || it.TripID != req.TripID {
+				continue
+			}
+			p := DisruptedPassenger{Class: it.Class, CoachNo: it.CoachNo, SeatNo: it.SeatNo}
+			if it.Passenger != nil {
+				p.Name = it.Passenger.Name
+			}
+			r.Passengers = append(r.Passengers, p)
+		}
+		var until *time.Time
+		r.Outcome, until = PlanDisruption(req, b)
+		if r.Outcome == OutcomeMoved {
+			c, err := rebook(ctx, tx, b, req.TripID, reason)
+			switch {
+			case err == nil:
+				dep := c.Trip.Departure()
+				r.NewTripID, r.NewTrain, r.NewDeparture, r.Refund = c.ToTripID, c.Trip.TrainCode, &dep, -c.Balance
+				// Until the new train leaves, the customer may still prefer their money back.
+				until = &dep
+			case ErrorCode(err) != "":
+				r.Outcome = OutcomeRefunded
+			default:
+				return err
+			}
+		}
+		if r.Outcome == OutcomeRefunded || r.Outcome == OutcomeCancelled {
+			c, err := CancelBooking(ctx, tx, CancelRequest{BookingID: b.ID, Reason: reason, FullRefund: true})
+			if err != nil {
+				return err
+			}
+			r.Refund = c.Refund
+		}
+		r.OfferUntil = until
+		passengers, err := json.Marshal(r.Passengers)
+		if err != nil {
+			return err
+		}
+		var newTrip *string
+		if r.NewTripID != "" {
+			newTrip = &r.NewTripID
+		}
+		if _, err := tx.Exec(ctx, `
+INSERT INTO disruption_bookings (disruption_id, booking_id, outcome, passengers, new_trip_id, new_departure, refund, offer_until)
+VALUES ($1, $2, $3, $4::JSONB, $5, $6, $7, $8)`, d.ID, b.ID, r.Outcome, string(passengers), newTrip, r.NewDeparture, r.Refund, until); err != nil {
+			return err
+		}
+		return recordHistory(ctx, tx, b.ID, EventDisrupted, map[string]any{"disruption_id": d.ID, "kind": req.Kind,
+			"trip_id": req.TripID, "delay_minutes": req.DelayMinutes, "outcome": r.Outcome, "new_trip_id": r.NewTripID, "refund": r.Refund})
+	})
+	if err == nil {
+		seatsFreed()
+	}
+	return r, err
+}
+
+// rebook moves b off a cancelled trip to the first departure between the
+// same stations, from its service date up to DisruptionRebookDays later,
+// that still has seats in every class booked. Each attempt runs in a
+// savepoint, so a departure filling up in the meantime just moves on to the
+// next one. It returns a booking error when no departure has room.
+func rebook(ctx context.Context, tx pgx.Tx, b Booking, tripID, reason string) (Change, error) {
+	need := map[string]int{}
+	for _, it := range b.Items {
+		if it.Status == ItemConfirmed {
+			need[it.Class]++
+		}
+	}
+	day, err := time.ParseInLocation("2006-01-02", b.Trip.ServiceDate, time.Local)
+	if err != nil {
+		return Change{}, err
+	}
+	after := b.Trip.Departure()
+	if now := time.Now(); now.After(after) {
+		after = now
+	}
+	for i := 0; i <= DisruptionRebookDays(); i++ {
+		results, err := Search(ctx, tx, SearchQuery{Origin: b.Trip.Origin, Destination: b.Trip.Destination, Date: day.AddDate(0, 0, i), Passengers: 1})
+		if err != nil {
+			return Change{}, err
+		}
+		for _, cand := range RebookCandidates(results, need, tripID, after) {
+			c, err := Reschedule(ctx, tx, RescheduleRequest{BookingID: b.ID, TripID: cand.TripID, Reason: reason, Disrupted: true})
+			if err == nil {
+				return c, nil
+			}
+			if ErrorCode(err) == "" {
+				return Change{}, err
+			}
+		}
+	}
+	return Change{}, &Error{Code: CodeSeatUnavailable, Message: "no departure has seats for every passenger"}
+}
+
+// DisruptionOffer is an open offer of a free change or a full refund to a
+// customer whose train was delayed, or who was moved off a cancelled one.
+type DisruptionOffer struct {
+	ID           int64     `json:"-"`
+	DisruptionID string    `json:"disruption_id"`
+	Kind         string    `json:"kind"`
+	TripID       string    `json:"trip_id"`
+	DelayMinutes int       `json:"delay_minutes,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+	Outcome      string    `json:"outcome"`
+	Until        time.Time `json:"until"`
+}
+
+func (o DisruptionOffer) refundReason() string { return disruptionReason(o.Kind, o.DelayMinutes) }
+
+// OpenDisruption returns the booking's open disruption offer, or nil.
+func OpenDisruption(ctx context.Context, db Querier, bookingID string) (*DisruptionOffer, error) {
+	var o DisruptionOffer
+	err := db.QueryRow(ctx, `
+SELECT db.id, d.id::TEXT, d.kind, d.trip_id::TEXT, d.delay_minutes, d.reason, db.outcome, db.offer_until
+FROM disruption_bookings db JOIN disruptions d ON d.id = db.disruption_id
+WHERE db.booking_id = $1 AND db.offer_until > now()
+ORDER BY db.created_at DESC, db.id DESC
+LIMIT 1`, bookingID).Scan(&o.ID, &o.DisruptionID, &o.Kind, &o.TripID, &o.DelayMinutes, &o.Reason, &o.Outcome, &o.Until)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// closeDisruptionOffer records what the customer did with an offer and closes
+// it: the report then shows where they ended up.
+func closeDisruptionOffer(ctx context.Context, tx pgx.Tx, id int64, outcome, newTripID string, departs *time.Time, refund int64) error {
+	var newTrip *string
+	if newTripID != "" {
+		newTrip = &newTripID
+	}
+	_, err := tx.Exec(ctx, `
+UPDATE disruption_bookings
+SET outcome = $2, new_trip_id = COALESCE($3, new_trip_id), new_departure = COALESCE($4, new_departure),
+    refund = refund + $5, offer_until = NULL, updated_at = now()
+WHERE id = $1`, id, outcome, newTrip, departs, refund)
+	return err
+}
+
+// disruptionCols selects a DisruptedBooking from disruption_bookings db
+// joined to its booking b and the new trip's train nt.
+const disruptionCols = `db.booking_id::TEXT, b.code, COALESCE(b.contact_name, ''), COALESCE(b.contact_email, ''), COALESCE(b.contact_phone, ''),
+       db.outcome, db.passengers::TEXT, COALESCE(db.new_trip_id::TEXT, ''), COALESCE(nt.code, ''), db.new_departure,
+       db.refund::INT8, db.offer_until, db.notified, db.error`
+
+// GetDisruption loads a run and its report, bookings in the order handled.
+func GetDisruption(ctx context.Context, db Querier, id string) (Disruption, error) {
+	var d Disruption
+	if !ValidUUID(id) {
+		return d, &Error{Code: CodeNotFound, Message: "disruption not found"}
+	}
+	err := db.QueryRow(ctx, `
+SELECT id::TEXT, trip_id::TEXT, kind, delay_minutes, reason, actor, created_at, finished_at FROM disruptions WHERE id = $1`, id).
+		Scan(&d.ID, &d.TripID, &d.Kind, &d.DelayMinutes, &d.Reason, &d.Actor, &d.CreatedAt, &d.FinishedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return d, &Error{Code: CodeNotFound, Message: "disruption not found"}
+	}
+	if err != nil {
+		return d, err
+	}
+	if d.Trip, _, _, err = GetTrip(ctx, db, d.TripID, "", ""); err != nil {
+		return d, err
+	}
+	rows, err := db.Query(ctx, `SELECT `+disruptionCols+`
+FROM disruption_bookings db
+JOIN bookings b ON b.id = db.booking_id
+LEFT JOIN trips t ON t.id = db.new_trip_id
+LEFT JOIN trains nt ON nt.id = t.train_id
+WHERE db.disruption_id = $1
+ORDER BY db.id`, id)
+	if err != nil {
+		return d, err
+	}
+	defer rows.Close()
+	d.Bookings = []DisruptedBooking{}
+	for rows.Next() {
+		var (
+			r          DisruptedBooking
+			passengers string
+		)
+		if err := rows.Scan(&r.BookingID, &r.Code, &r.Contact.Name, &r.Contact.Email, &r.Contact.Phone, &r.Outcome, &passengers,
+			&r.NewTripID, &r.NewTrain, &r.NewDeparture, &r.Refund, &r.OfferUntil, &r.Notified, &r.Error); err != nil {
+			return d, err
+		}
+		if err := json.Unmarshal([]byte(passengers), &r.Passengers); err != nil {
+			return d, err
+		}
+		d.Bookings = append(d.Bookings, r)
+	}
+	return d, rows.Err()
+}
+
+// ListDisruptions returns the latest runs, newest first, optionally only
+// those for one trip. Bookings are left out; Summary needs GetDisruption.
+func ListDisruptions(ctx context.Context, db Querier, tripID string, limit int) ([]Disruption, error) {
+	if tripID != "" && !ValidUUID(tripID) {
+		return nil, invalidField("trip_id", "trip_id must be a UUID")
+	}
+	rows, err := db.Query(ctx, `
+SELECT d.id::TEXT, d.trip_id::TEXT, d.kind, d.delay_minutes, d.reason, d.actor, d.created_at, d.finished_at,
+       tr.code, tr.name, t.service_date::TEXT, to_char(t.depart_time, 'HH24:MI'), t.status
+FROM disruptions d
+JOIN trips t ON t.id = d.trip_id
+JOIN trains tr ON tr.id = t.train_id
+WHERE ($1::TEXT = '' OR d.trip_id = $1::TEXT::UUID)
+ORDER BY d.created_at DESC
+LIMIT $2::INT8`, tripID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Disruption{}
+	for rows.Next() {
+		var d Disruption
+		if err := rows.Scan(&d.ID, &d.TripID, &d.Kind, &d.DelayMinutes, &d.Reason, &d.Actor, &d.CreatedAt, &d.FinishedAt,
+			&d.Trip.TrainCode, &d.Trip.TrainName, &d.Trip.ServiceDate, &d.Trip.Depart, &d.Trip.Status); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
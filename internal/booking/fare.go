@@ -0,0 +1,276 @@
+package booking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Kinds of FareLine, in the order Quote applies them.
+const (
+	FareBase     = "base"
+	FareDistance = "distance"
+	FareClass    = "class"
+	FarePeak     = "peak"
+	FareDiscount = "discount"
+)
+
+// FareBasis is what the fares of one leg are computed from: the leg's share of
+// trips.base_price (0 when the trip has none), its distance and the day the
+// passenger boards.
+type FareBasis struct {
+	Base int64     `json:"base"`
+	KM   float64   `json:"km"`
+	Date time.Time `json:"date"`
+}
+
+// legBasis returns the fare basis of a leg of a trip running on serviceDate.
+func legBasis(stops []Stop, leg Leg, base int64, serviceDate time.Time) FareBasis {
+	a, b := stopAt(stops, leg.From), stopAt(stops, leg.To)
+	return FareBasis{
+		Base: LegFare(stops, leg, base),
+		KM:   math.Max(b.DistanceKM-a.DistanceKM, 0),
+		Date: serviceDate.AddDate(0, 0, a.DayOffset),
+	}
+}
+
+// DistanceBand charges PerKM rupiah for every kilometre from FromKM up to the
+// next band.
+type DistanceBand struct {
+	FromKM float64 `json:"from_km"`
+	PerKM  int64   `json:"per_km"`
+}
+
+// PeakRule adds Percent to fares for travel between Start and End inclusive,
+// e.g. the weeks around Lebaran.
+type PeakRule struct {
+	Name    string    `json:"name"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Percent int64     `json:"percent"`
+}
+
+// FareRules are the pricing rules from the fare_* tables.
+type FareRules struct {
+	Classes   map[string]int64 // percent of the base fare per seat class
+	Distance  []DistanceBand   // tariff for trips without a base price, by FromKM
+	Peaks     []PeakRule
+	Discounts map[string]int64 // percent off per passenger category
+}
+
+// FareLine is one step of a fare: the base fare, or what a rule added or took off.
+type FareLine struct {
+	Kind    string `json:"kind"`
+	Label   string `json:"label"`
+	Percent int64  `json:"percent,omitempty"`
+	Amount  int64  `json:"amount"`
+}
+
+// Fare is a seat's price with the lines that explain it; Total is their sum.
+type Fare struct {
+	Total int64      `json:"total"`
+	Lines []FareLine `json:"lines"`
+}
+
+// DefaultFareRules are the built-in class multipliers with no distance
+// tariff, peaks or discounts.
+func DefaultFareRules() FareRules {
+	r := FareRules{Classes: map[string]int64{}, Discounts: map[string]int64{}}
+	for c, m := range classMultiplier {
+		r.Classes[c] = m
+	}
+	return r
+}
+
+// Quote prices one seat of class on a leg for a passenger category ("" for an
+// adult). The base fare is the leg's share of the trip's base price, or the
+// distance tariff when the trip has none; the class multiplier, the highest
+// matching peak surcharge and the passenger discount then apply in turn.
+func (r FareRules) Quote(b FareBasis, class, category string) Fare {
+	var f Fare
+	add := func(l FareLine) {
+		f.Lines = append(f.Lines, l)
+		f.Total += l.Amount
+	}
+	if b.Base > 0 || len(r.Distance) == 0 {
+		add(FareLine{Kind: FareBase, Label: "Base fare", Amount: b.Base})
+	} else {
+		add(FareLine{Kind: FareDistance, Label: fmt.Sprintf("Distance fare, %.0f km", b.KM), Amount: r.distanceFare(b.KM)})
+	}
+
+	class = strings.ToLower(class)
+	if m, ok := r.Classes[class]; ok && m != 100 {
+		add(FareLine{Kind: FareClass, Label: title(class) + " class", Percent: m, Amount: f.Total*m/100 - f.Total})
+	}
+	if p, ok := r.peak(b.Date); ok {
+		add(FareLine{Kind: FarePeak, Label: p.Name, Percent: p.Percent, Amount: f.Total * p.Percent / 100})
+	}
+	if d := r.Discounts[category]; d > 0 {
+		add(FareLine{Kind: FareDiscount, Label: title(category) + " discount", Percent: d, Amount: -(f.Total * d / 100)})
+	}
+	return f
+}
+
+// distanceFare charges km through the bands, rounded up to whole thousands of rupiah.
+func (r FareRules) distanceFare(km float64) int64 {
+	var fare float64
+	for i, band := range r.Distance {
+		end := km
+		if i+1 < len(r.Distance) {
+			end = math.Min(km, r.Distance[i+1].FromKM)
+		}
+		if end > band.FromKM {
+			fare += (end - band.FromKM) * float64(band.PerKM)
+		}
+	}
+	return int64(math.Ceil(fare/1000)) * 1000
+}
+
+// peak returns the rule with the highest surcharge covering day.
+func (r FareRules) peak(day time.Time) (PeakRule, bool) {
+	var (
+		best PeakRule
+		ok   bool
+	)
+	d := day.Format("2006-01-02")
+	for _, p := range r.Peaks {
+		if d >= p.Start.Format("2006-01-02") && d <= p.End.Format("2006-01-02") && (!ok || p.Percent > best.Percent) {
+			best, ok = p, true
+		}
+	}
+	return best, ok
+}
+
+func title(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// LoadFareRules reads the fare rules. Classes without a fare_classes row keep
+// their built-in multiplier.
+func LoadFareRules(ctx context.Context, db Querier) (FareRules, error) {
+	r := DefaultFareRules()
+	rows, err := db.Query(ctx, `SELECT class, percent FROM fare_classes`)
+	if err != nil {
+		return r, err
+	}
+	for rows.Next() {
+		var (
+			class string
+			pct   int64
+		)
+		if err := rows.Scan(&class, &pct); err != nil {
+			rows.Close()
+			return r, err
+		}
+		r.Classes[class] = pct
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return r, err
+	}
+
+	rows, err = db.Query(ctx, `SELECT from_km::FLOAT8, per_km::INT8 FROM fare_distance_bands ORDER BY from_km`)
+	if err != nil {
+		return r, err
+	}
+	for rows.Next() {
+		var b DistanceBand
+		if err := rows.Scan(&b.FromKM, &b.PerKM); err != nil {
+			rows.Close()
+			return r, err
+		}
+		r.Distance = append(r.Distance, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return r, err
+	}
+
+	rows, err = db.Query(ctx, `SELECT name, start_date, end_date, percent FROM fare_peaks ORDER BY start_date, name`)
+	if err != nil {
+		return r, err
+	}
+	for rows.Next() {
+		var p PeakRule
+		if err := rows.Scan(&p.Name, &p.Start, &p.End, &p.Percent); err != nil {
+			rows.Close()
+			return r, err
+		}
+		r.Peaks = append(r.Peaks, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return r, err
+	}
+
+	rows, err = db.Query(ctx, `SELECT category, percent FROM fare_discounts`)
+	if err != nil {
+		return r, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			category string
+			pct      int64
+		)
+		if err := rows.Scan(&category, &pct); err != nil {
+			return r, err
+		}
+		r.Discounts[category] = pct
+	}
+	return r, rows.Err()
+}
+
+// QuoteFare prices one seat of class (economy when empty) on a trip's leg
+// between two station codes (empty for the whole trip) for a passenger category.
+func QuoteFare(ctx context.Context, db Querier, tripID, from, to, class, category string) (Fare, error) {
+	class, category = strings.ToLower(strings.TrimSpace(class)), strings.ToLower(strings.TrimSpace(category))
+	if class == "" {
+		class = ClassEconomy
+	}
+	if !ValidClass(class) {
+		return Fare{}, invalid("unknown class: " + class)
+	}
+	if category != "" && !ValidCategory(category) {
+		return Fare{}, invalid("unknown passenger category: " + category)
+	}
+	_, _, basis, err := GetTrip(ctx, db, tripID, from, to)
+	if err != nil {
+		return Fare{}, err
+	}
+	rules, err := LoadFareRules(ctx, db)
+	if err != nil {
+		return Fare{}, err
+	}
+	return rules.Quote(basis, class, category), nil
+}
+
+// confirmItem prices a held item for its passenger's category, storing the
+// breakdown with the price, and confirms it.
+func confirmItem(ctx context.Context, tx pgx.Tx, rules FareRules, b FareBasis, itemID, class string) (int64, error) {
+	var category string
+	err := tx.QueryRow(ctx, `SELECT category FROM passengers WHERE booking_item_id = $1`, itemID).Scan(&category)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+	f := rules.Quote(b, class, category)
+	_, err = tx.Exec(ctx, `
+UPDATE booking_items SET status = 'confirmed', price = $2, fare_breakdown = $3::JSONB, held_until = NULL
+WHERE id = $1`, itemID, f.Total, f.json())
+	return f.Total, err
+}
+
+// json encodes f for booking_items.fare_breakdown.
+func (f Fare) json() string {
+	b, _ := json.Marshal(f)
+	return string(b)
+}
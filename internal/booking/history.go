@@ -0,0 +1,80 @@
+package booking
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gothicforge3/internal/outbox"
+)
+
+// Booking history events.
+const (
+	EventCheckedOut      = "checked_out"      // cart became a pending booking
+	EventPaid            = "paid"             // payment settled
+	EventExpired         = "expired"          // not paid in time
+	EventSeatsCancelled  = "seats_cancelled"  // some seats cancelled, the rest still travel
+	EventCancelled       = "cancelled"        // every seat cancelled
+	EventChangeRequested = "change_requested" // new trip held until the balance is paid
+	EventRescheduled     = "rescheduled"      // moved to another trip
+	EventChangeExpired   = "change_expired"   // balance for a change not paid in time
+)
+
+// HistoryEntry is one change to a booking.
+type HistoryEntry struct {
+	Event     string         `json:"event"`
+	Detail    map[string]any `json:"detail,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// BookingEvent is the outbox message of a history event, published on the
+// topic EventTopic(Event) with the booking id as its ref.
+type BookingEvent struct {
+	BookingID string         `json:"booking_id"`
+	Event     string         `json:"event"`
+	Detail    map[string]any `json:"detail"`
+}
+
+// EventTopic is the outbox topic of a booking history event, e.g. booking.paid.
+func EventTopic(event string) string { return "booking." + event }
+
+// recordHistory appends an event to the booking's history and publishes it
+// to the outbox. It runs inside the transaction that made the change, so
+// neither ever disagrees with it.
+func recordHistory(ctx context.Context, db Querier, bookingID, event string, detail map[string]any) error {
+	if detail == nil {
+		detail = map[string]any{}
+	}
+	b, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(ctx, `INSERT INTO booking_history (booking_id, event, detail) VALUES ($1, $2, $3::JSONB)`, bookingID, event, string(b)); err != nil {
+		return err
+	}
+	return outbox.Enqueue(ctx, db, EventTopic(event), bookingID, BookingEvent{BookingID: bookingID, Event: event, Detail: detail})
+}
+
+// History returns every recorded change of a booking, oldest first.
+func History(ctx context.Context, db Querier, bookingID string) ([]HistoryEntry, error) {
+	rows, err := db.Query(ctx, `SELECT event, detail::TEXT, created_at FROM booking_history WHERE booking_id = $1 ORDER BY created_at, id`, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []HistoryEntry{}
+	for rows.Next() {
+		var (
+			e      HistoryEntry
+			detail string
+		)
+		if err := rows.Scan(&e.Event, &detail, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(detail), &e.Detail); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
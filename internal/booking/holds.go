@@ -0,0 +1,406 @@
+package booking
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/env"
+)
+
+// Hold-related error codes.
+const (
+	CodeSeatUnavailable = "seat_unavailable"
+	CodeHoldExpired     = "hold_expired"
+)
+
+// Booking statuses used by the hold/checkout flow.
+const (
+	StatusHold    = "hold"    // per-holder cart collecting held seats
+	StatusPending = "pending" // checked out, awaiting payment
+)
+
+// Booking item statuses.
+const (
+	ItemHeld      = "held"
+	ItemConfirmed = "confirmed"
+	ItemReleased  = "released"
+	ItemExpired   = "expired"
+)
+
+// liveItem is the booking_items predicate for a row that currently takes its seat out of inventory.
+// Held rows past held_until are treated as free even before the sweeper flips them.
+const liveItem = `(bi.status = 'confirmed' OR (bi.status = 'held' AND bi.held_until > now()))`
+
+// HoldTTL returns how long a seat stays held (HOLD_TTL_SECONDS, default 6 minutes).
+func HoldTTL() time.Duration {
+	if n, err := strconv.Atoi(strings.TrimSpace(env.Get("HOLD_TTL_SECONDS", ""))); err == nil && n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	return 6 * time.Minute
+}
+
+// HoldRequest asks to hold specific seats on a trip for a holder, on the leg
+// between station codes From and To (empty for the trip's first and last stop).
+// Holder is an opaque reference such as "user:42" or "session:ab12…".
+type HoldRequest struct {
+	Holder  string   `json:"-"`
+	TripID  string   `json:"trip_id"`
+	From    string   `json:"from,omitempty"`
+	To      string   `json:"to,omitempty"`
+	SeatIDs []string `json:"seat_ids"`
+}
+
+// HeldSeat is one live hold.
+type HeldSeat struct {
+	ItemID    string    `json:"item_id"`
+	SeatID    string    `json:"seat_id"`
+	TripID    string    `json:"trip_id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	CoachNo   int       `json:"coach_no"`
+	SeatNo    string    `json:"seat_no"`
+	Class     string    `json:"class"`
+	Price     int64     `json:"price"`
+	HeldUntil time.Time `json:"held_until"`
+}
+
+// HoldResult is the holder's cart on a trip after a hold succeeded.
+type HoldResult struct {
+	BookingID string     `json:"booking_id"`
+	HeldUntil time.Time  `json:"held_until"`
+	Seats     []HeldSeat `json:"seats"`
+}
+
+// PlaceHold holds the requested seats for ttl, all or nothing.
+//
+// Seat rows are locked FOR UPDATE so concurrent requests for the same seat
+// serialize, and a seat counts as taken only when someone holds or bought it
+// on a leg overlapping the requested one. Any such seat yields a
+// seat_unavailable error. A seat of a class with customers on the waitlist is
+// refused the same way (see JoinWaitlist). Holding again refreshes the expiry
+// of every seat in the holder's cart; a cart rides one leg, so holding seats
+// for another leg of the same trip gives back the seats held for the previous
+// one.
+func PlaceHold(ctx context.Context, db DB, req HoldRequest, ttl time.Duration) (HoldResult, error) {
+	var res HoldResult
+	req.SeatIDs = dedupe(req.SeatIDs)
+	if strings.TrimSpace(req.Holder) == "" {
+		return res, invalid("holder is required")
+	}
+	if strings.TrimSpace(req.TripID) == "" || len(req.SeatIDs) == 0 {
+		return res, invalid("trip_id and at least one seat_id are required")
+	}
+	if len(req.SeatIDs) > MaxPassengers() {
+		return res, invalid("too many seats in one hold")
+	}
+	if !allUUIDs(append([]string{req.TripID}, req.SeatIDs...)) {
+		return res, invalid("trip_id and seat_ids must be UUIDs")
+	}
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		var err error
+		res, err = placeHoldTx(ctx, tx, req, ttl)
+		return err
+	})
+	if err == nil {
+		announceSeats(heldChanges(res.Seats))
+	}
+	return res, err
+}
+
+func placeHoldTx(ctx context.Context, tx pgx.Tx, req HoldRequest, ttl time.Duration) (HoldResult, error) {
+	var res HoldResult
+	_, leg, basis, err := GetTrip(ctx, tx, req.TripID, req.From, req.To)
+	if err != nil {
+		return res, err
+	}
+	rules, err := LoadFareRules(ctx, tx)
+	if err != nil {
+		return res, err
+	}
+	seats, err := lockSeats(ctx, tx, req.TripID, req.SeatIDs)
+	if err != nil {
+		return res, err
+	}
+	cartID, err := holdCart(ctx, tx, req.Holder, req.TripID, leg)
+	if err != nil {
+		return res, err
+	}
+	if err := checkTaken(ctx, tx, req.SeatIDs, cartID, leg); err != nil {
+		return res, err
+	}
+	if err := checkWaitlist(ctx, tx, req.SeatIDs, cartID, leg); err != nil {
+		return res, err
+	}
+
+	var others int
+	if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM booking_items WHERE booking_id = $1 AND status = 'held' AND NOT (seat_id = ANY($2))`, cartID, req.SeatIDs).Scan(&others); err != nil {
+		return res, err
+	}
+	if others+len(seats) > MaxPassengers() {
+		return res, invalid("too many seats held for one booking")
+	}
+	if err := holdSeats(ctx, tx, cartID, seats, leg, rules, basis, ttl); err != nil {
+		return res, err
+	}
+	return cartResult(ctx, tx, cartID)
+}
+
+// lockedSeat is a seat row locked for a hold.
+type lockedSeat struct {
+	id, seatNo, class string
+	coachNo           int
+}
+
+// lockSeats locks the seats FOR UPDATE, checks that they belong to the trip
+// and that the trip is still on sale, and expires lapsed holds on them that
+// the sweeper has not reached yet.
+func lockSeats(ctx context.Context, tx pgx.Tx, tripID string, seatIDs []string) ([]lockedSeat, error) {
+	rows, err := tx.Query(ctx, `
+SELECT s.id, s.coach_no, s.seat_no, s.class, t.status, t.service_date >= current_date
+FROM seats s JOIN trips t ON t.id = s.trip_id
+WHERE s.trip_id = $1 AND s.id = ANY($2)
+ORDER BY s.id
+FOR UPDATE OF s`, tripID, seatIDs)
+	if err != nil {
+		return nil, err
+	}
+	seats := make([]lockedSeat, 0, len(seatIDs))
+	for rows.Next() {
+		var (
+			s        lockedSeat
+			status   string
+			upcoming bool
+		)
+		if err := rows.Scan(&s.id, &s.coachNo, &s.seatNo, &s.class, &status, &upcoming); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if status == "cancelled" || !upcoming {
+			rows.Close()
+			return nil, invalid("trip is not open for sale")
+		}
+		seats = append(seats, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(seats) != len(seatIDs) {
+		return nil, &Error{Code: CodeNotFound, Message: "seat not found on this trip"}
+	}
+	_, err = tx.Exec(ctx, `UPDATE booking_items SET status = 'expired' WHERE seat_id = ANY($1) AND status = 'held' AND held_until <= now()`, seatIDs)
+	return seats, err
+}
+
+// checkTaken fails with seat_unavailable, naming the seats, when anyone but
+// the cart holds or bought one of the locked seats on a leg overlapping leg.
+func checkTaken(ctx context.Context, tx pgx.Tx, seatIDs []string, cartID string, leg Leg) error {
+	taken := []string{}
+	rows, err := tx.Query(ctx, `
+SELECT DISTINCT s.coach_no, s.seat_no FROM booking_items bi JOIN seats s ON s.id = bi.seat_id
+WHERE bi.seat_id = ANY($1) AND bi.status IN ('held','confirmed') AND bi.booking_id <> $2 AND `+overlapsLeg("$3", "$4")+`
+ORDER BY s.coach_no, s.seat_no`, seatIDs, cartID, leg.From, leg.To)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var coach int
+		var no string
+		if err := rows.Scan(&coach, &no); err != nil {
+			return err
+		}
+		taken = append(taken, strconv.Itoa(coach)+"/"+no)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(taken) > 0 {
+		return &Error{Code: CodeSeatUnavailable, Message: "seats no longer available: " + strings.Join(taken, ", ")}
+	}
+	return nil
+}
+
+// holdSeats puts the seats in the cart for leg at the adult fare, which
+// checkout reprices per passenger, and restarts the expiry of everything the
+// cart holds.
+func holdSeats(ctx context.Context, tx pgx.Tx, cartID string, seats []lockedSeat, leg Leg, rules FareRules, basis FareBasis, ttl time.Duration) error {
+	secs := int64(ttl / time.Second)
+	for _, s := range seats {
+		f := rules.Quote(basis, s.class, "")
+		if _, err := tx.Exec(ctx, `
+INSERT INTO booking_items (booking_id, seat_id, price, fare_breakdown, status, held_until, from_seq, to_seq)
+VALUES ($1, $2, $3, $4::JSONB, 'held', now() + ($5::INT8 * INTERVAL '1 second'), $6, $7)
+ON CONFLICT (booking_id, seat_id) DO UPDATE SET status = 'held', price = excluded.price, fare_breakdown = excluded.fare_breakdown,
+    held_until = excluded.held_until, from_seq = excluded.from_seq, to_seq = excluded.to_seq`,
+			cartID, s.id, f.Total, f.json(), secs, leg.From, leg.To); err != nil {
+			return err
+		}
+	}
+	// One expiry per cart keeps checkout simple: every seat lapses together.
+	_, err := tx.Exec(ctx, `UPDATE booking_items SET held_until = now() + ($2::INT8 * INTERVAL '1 second') WHERE booking_id = $1 AND status = 'held'`, cartID, secs)
+	return err
+}
+
+// heldChanges groups held seats by trip into changes to SeatHeld.
+func heldChanges(held []HeldSeat) []SeatChange {
+	ts := make([][2]string, len(held))
+	for i, h := range held {
+		ts[i] = [2]string{h.TripID, h.SeatID}
+	}
+	return seatChanges(SeatHeld, ts)
+}
+
+// cartResult lists what a cart holds after a successful hold.
+func cartResult(ctx context.Context, tx pgx.Tx, cartID string) (HoldResult, error) {
+	held, err := listHeld(ctx, tx, `b.id = $1`, cartID)
+	if err != nil {
+		return HoldResult{}, err
+	}
+	res := HoldResult{BookingID: cartID, Seats: held}
+	if len(held) > 0 {
+		res.HeldUntil = held[0].HeldUntil
+	}
+	return res, nil
+}
+
+// holdCart returns the holder's open cart booking for a trip, creating it if
+// needed. When the cart was for another leg, its held seats are released and
+// it moves to leg.
+func holdCart(ctx context.Context, tx pgx.Tx, holder, tripID string, leg Leg) (string, error) {
+	if _, err := tx.Exec(ctx, `
+INSERT INTO bookings (code, user_ref, trip_id, status, from_seq, to_seq)
+VALUES ($1, $2, $3, 'hold', $4, $5)
+ON CONFLICT (user_ref, trip_id) WHERE status = 'hold' AND NOT journey DO NOTHING`, "HOLD-"+randomHex(8), holder, tripID, leg.From, leg.To); err != nil {
+		return "", err
+	}
+	var (
+		id  string
+		cur Leg
+	)
+	if err := tx.QueryRow(ctx, `SELECT id, from_seq, to_seq FROM bookings WHERE user_ref = $1 AND trip_id = $2 AND status = 'hold' AND NOT journey FOR UPDATE`,
+		holder, tripID).Scan(&id, &cur.From, &cur.To); err != nil {
+		return "", err
+	}
+	if cur == leg {
+		return id, nil
+	}
+	if _, err := tx.Exec(ctx, `UPDATE booking_items SET status = 'released', held_until = NULL WHERE booking_id = $1 AND status = 'held'`, id); err != nil {
+		return "", err
+	}
+	_, err := tx.Exec(ctx, `UPDATE bookings SET from_seq = $2, to_seq = $3 WHERE id = $1`, id, leg.From, leg.To)
+	return id, err
+}
+
+// ReleaseHold gives back the holder's held seats on a trip. With no seatIDs, all of them.
+// It returns the number of seats released.
+func ReleaseHold(ctx context.Context, db Querier, holder, tripID string, seatIDs []string) (int64, error) {
+	if strings.TrimSpace(holder) == "" || strings.TrimSpace(tripID) == "" {
+		return 0, invalid("holder and trip_id are required")
+	}
+	seatIDs = dedupe(seatIDs)
+	if !allUUIDs(append([]string{tripID}, seatIDs...)) {
+		return 0, invalid("trip_id and seat_ids must be UUIDs")
+	}
+	changes, err := updateSeats(ctx, db, SeatReleased, `
+UPDATE booking_items SET status = 'released', held_until = NULL
+WHERE status = 'held'
+  AND booking_id IN (SELECT id FROM bookings WHERE user_ref = $1 AND trip_id = $2 AND status = 'hold' AND NOT journey)
+  AND (cardinality($3::UUID[]) = 0 OR seat_id = ANY($3::UUID[]))
+RETURNING seat_id`, holder, tripID, seatIDs)
+	if err != nil {
+		return 0, err
+	}
+	n := countSeats(changes)
+	if n > 0 {
+		seatsFreed()
+		announceSeats(changes)
+	}
+	return n, nil
+}
+
+// ListHolds returns the holder's live holds, optionally limited to their cart
+// on one trip. Without a trip, seats held for a connecting journey are included.
+func ListHolds(ctx context.Context, db Querier, holder, tripID string) ([]HeldSeat, error) {
+	if tripID == "" {
+		return listHeld(ctx, db, `b.user_ref = $1 AND b.status = 'hold'`, holder)
+	}
+	return listHeld(ctx, db, `b.user_ref = $1 AND b.status = 'hold' AND NOT b.journey AND b.trip_id = $2`, holder, tripID)
+}
+
+func listHeld(ctx context.Context, db Querier, where string, args ...any) ([]HeldSeat, error) {
+	rows, err := db.Query(ctx, `
+SELECT bi.id, s.id, s.trip_id, so.code, sd.code, s.coach_no, s.seat_no, s.class, bi.price::INT8, bi.held_until
+FROM booking_items bi
+JOIN bookings b ON b.id = bi.booking_id
+JOIN seats s ON s.id = bi.seat_id
+JOIN trips t ON t.id = s.trip_id
+JOIN trip_stops fs ON fs.trip_id = s.trip_id AND fs.seq = bi.from_seq
+JOIN stations so ON so.id = fs.station_id
+JOIN trip_stops ts ON ts.trip_id = s.trip_id AND ts.seq = bi.to_seq
+JOIN stations sd ON sd.id = ts.station_id
+WHERE bi.status = 'held' AND bi.held_until > now() AND `+where+`
+ORDER BY t.service_date + fs.day_offset, fs.depart_time, s.trip_id, s.coach_no, s.seat_no`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]HeldSeat, 0, 4)
+	for rows.Next() {
+		var h HeldSeat
+		if err := rows.Scan(&h.ItemID, &h.SeatID, &h.TripID, &h.From, &h.To, &h.CoachNo, &h.SeatNo, &h.Class, &h.Price, &h.HeldUntil); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+// SweepExpiredHolds flips every lapsed hold to 'expired' and returns how many were released.
+func SweepExpiredHolds(ctx context.Context, db Querier) (int64, error) {
+	changes, err := updateSeats(ctx, db, SeatReleased, `UPDATE booking_items SET status = 'expired' WHERE status = 'held' AND held_until <= now() RETURNING seat_id`)
+	if err != nil {
+		return 0, err
+	}
+	n := countSeats(changes)
+	if n > 0 {
+		seatsFreed()
+		announceSeats(changes)
+	}
+	return n, nil
+}
+
+func dedupe(in []string) []string {
+	seen := make(map[string]bool, len(in))
+	out := make([]string, 0, len(in))
+	for _, s := range in {
+		s = strings.TrimSpace(s)
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	return out
+}
+
+func allUUIDs(ids []string) bool {
+	for _, id := range ids {
+		if !ValidUUID(id) {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
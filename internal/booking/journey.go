@@ -0,0 +1,834 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/env"
+)
+
+// maxTransferWait is the longest wait at a transfer station the planner
+// offers; anything longer is an overnight stay rather than a connection.
+const maxTransferWait = 12 * time.Hour
+
+// journeyLimit caps the number of itineraries returned by one search.
+const journeyLimit = 10
+
+// MaxJourneyLegs returns how many trains one journey may combine (JOURNEY_MAX_LEGS, default 3).
+func MaxJourneyLegs() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(env.Get("JOURNEY_MAX_LEGS", ""))); err == nil && n > 0 {
+		return n
+	}
+	return 3
+}
+
+// MinConnection returns the shortest change between two trains at a transfer
+// station (MIN_CONNECTION_MINUTES, default 15).
+func MinConnection() time.Duration {
+	if n, err := strconv.Atoi(strings.TrimSpace(env.Get("MIN_CONNECTION_MINUTES", ""))); err == nil && n >= 0 {
+		return time.Duration(n) * time.Minute
+	}
+	return 15 * time.Minute
+}
+
+// JourneyQuery is a SearchQuery that may change trains up to MaxLegs-1 times,
+// leaving at least MinConnection between arriving and departing again.
+// Fares prices the legs; the zero value uses DefaultFareRules.
+type JourneyQuery struct {
+	SearchQuery
+	MaxLegs       int
+	MinConnection time.Duration
+	Fares         FareRules
+}
+
+// ParseJourneyQuery reads the search parameters plus max_legs (1 to MaxJourneyLegs).
+func ParseJourneyQuery(v url.Values) (JourneyQuery, error) {
+	sq, err := ParseSearchQuery(v)
+	q := JourneyQuery{SearchQuery: sq, MaxLegs: MaxJourneyLegs(), MinConnection: MinConnection()}
+	if err != nil {
+		return q, err
+	}
+	if s := strings.TrimSpace(v.Get("max_legs")); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > MaxJourneyLegs() {
+			return q, invalid("max_legs must be between 1 and " + strconv.Itoa(MaxJourneyLegs()))
+		}
+		q.MaxLegs = n
+	}
+	return q, nil
+}
+
+// Ride is travel on one trip between two of its stops. Departs and Arrives
+// are wall-clock times in the timetable's zone, stored as UTC.
+type Ride struct {
+	TripID          string
+	TrainCode       string
+	TrainName       string
+	Status          string
+	Origin          string
+	OriginName      string
+	Destination     string
+	DestinationName string
+	Leg             Leg
+	Departs         time.Time
+	Arrives         time.Time
+	Fare            int64   // the leg's share of the trip's base price
+	KM              float64 // the leg's distance
+}
+
+// basis returns what the ride's fares are computed from.
+func (r Ride) basis() FareBasis {
+	y, m, d := r.Departs.Date()
+	return FareBasis{Base: r.Fare, KM: r.KM, Date: time.Date(y, m, d, 0, 0, 0, 0, time.UTC)}
+}
+
+// JourneyLeg is one train of a journey. Class is the one the journey is
+// priced in: the requested class, or else the cheapest with enough seats.
+type JourneyLeg struct {
+	TripResult
+	Class string `json:"class"`
+	Price int64  `json:"price"`
+
+	basis FareBasis
+}
+
+// Transfer is a change of trains between two legs.
+type Transfer struct {
+	Station     string `json:"station"`
+	StationName string `json:"station_name"`
+	Minutes     int    `json:"minutes"`
+}
+
+// Journey is an itinerary of one or more legs. Price is per passenger.
+type Journey struct {
+	Legs       []JourneyLeg `json:"legs"`
+	Transfers  []Transfer   `json:"transfers"`
+	DepartDate string       `json:"depart_date"`
+	Depart     string       `json:"depart"`
+	ArriveDate string       `json:"arrive_date"`
+	Arrive     string       `json:"arrive"`
+	Minutes    int          `json:"duration_minutes"`
+	Price      int64        `json:"price"`
+	Bookable   bool         `json:"bookable"`
+
+	departs, arrives time.Time
+}
+
+// PlanJourneys combines rides into itineraries from q.Origin, boarding on
+// q.Date, to q.Destination with at most q.MaxLegs trains. Each change allows
+// at least q.MinConnection and at most maxTransferWait, never reuses a trip
+// and never returns to a station already passed. Results are ranked by
+// arrival, then duration, then price, and capped at journeyLimit.
+// Availability is not considered; FindJourneys adds it.
+func PlanJourneys(rides []Ride, q JourneyQuery) []Journey {
+	from := map[string][]Ride{}
+	for _, r := range rides {
+		from[r.Origin] = append(from[r.Origin], r)
+	}
+	maxLegs := max(q.MaxLegs, 1)
+	if q.Fares.Classes == nil {
+		q.Fares = DefaultFareRules()
+	}
+	var out []Journey
+	seen := map[string]bool{}
+	var walk func(path []Ride)
+	walk = func(path []Ride) {
+		last := path[len(path)-1]
+		if last.Destination == q.Destination {
+			out = append(out, newJourney(path, q.Class, q.Fares))
+			return
+		}
+		if len(path) == maxLegs {
+			return
+		}
+		for _, next := range from[last.Destination] {
+			wait := next.Departs.Sub(last.Arrives)
+			if wait < q.MinConnection || wait > maxTransferWait || seen[next.Destination] || usesTrip(path, next.TripID) {
+				continue
+			}
+			seen[next.Destination] = true
+			walk(append(path[:len(path):len(path)], next))
+			delete(seen, next.Destination)
+		}
+	}
+	day := q.Date.Format("2006-01-02")
+	seen[q.Origin] = true
+	for _, r := range from[q.Origin] {
+		if r.Departs.Format("2006-01-02") != day {
+			continue
+		}
+		seen[r.Destination] = true
+		walk([]Ride{r})
+		delete(seen, r.Destination)
+	}
+	sortJourneys(out)
+	if len(out) > journeyLimit {
+		out = out[:journeyLimit]
+	}
+	return out
+}
+
+func usesTrip(path []Ride, tripID string) bool {
+	for _, r := range path {
+		if r.TripID == tripID {
+			return true
+		}
+	}
+	return false
+}
+
+func newJourney(path []Ride, class string, rules FareRules) Journey {
+	first, last := path[0], path[len(path)-1]
+	j := Journey{
+		DepartDate: first.Departs.Format("2006-01-02"),
+		Depart:     first.Departs.Format("15:04"),
+		ArriveDate: last.Arrives.Format("2006-01-02"),
+		Arrive:     last.Arrives.Format("15:04"),
+		Minutes:    int(last.Arrives.Sub(first.Departs) / time.Minute),
+		Transfers:  []Transfer{},
+		departs:    first.Departs,
+		arrives:    last.Arrives,
+	}
+	for i, r := range path {
+		if i > 0 {
+			j.Transfers = append(j.Transfers, Transfer{Station: r.Origin, StationName: r.OriginName, Minutes: int(r.Departs.Sub(path[i-1].Arrives) / time.Minute)})
+		}
+		leg := JourneyLeg{TripResult: r.result(), Class: class, basis: r.basis()}
+		if leg.Class == "" {
+			leg.Class = ClassEconomy
+		}
+		leg.Price = rules.Quote(r.basis(), leg.Class, "").Total
+		j.Price += leg.Price
+		j.Legs = append(j.Legs, leg)
+	}
+	return j
+}
+
+func (r Ride) result() TripResult {
+	return TripResult{
+		TripID: r.TripID, TrainCode: r.TrainCode, TrainName: r.TrainName,
+		Origin: r.Origin, OriginName: r.OriginName, Destination: r.Destination, DestinationName: r.DestinationName,
+		ServiceDate: r.Departs.Format("2006-01-02"), Depart: r.Departs.Format("15:04"), Arrive: r.Arrives.Format("15:04"),
+		Status: r.Status, BasePrice: r.Fare, Leg: r.Leg, Classes: []ClassAvailability{},
+	}
+}
+
+// sortJourneys ranks by arrival, then duration, then price.
+func sortJourneys(js []Journey) {
+	sort.SliceStable(js, func(a, b int) bool {
+		x, y := js[a], js[b]
+		if !x.arrives.Equal(y.arrives) {
+			return x.arrives.Before(y.arrives)
+		}
+		if x.Minutes != y.Minutes {
+			return x.Minutes < y.Minutes
+		}
+		return x.Price < y.Price
+	})
+}
+
+// CheckConnections reports why rides cannot be travelled one after the
+// other: a leg must start where the previous one ended, on another trip, and
+// leave at least minWait to change trains.
+func CheckConnections(rides []Ride, minWait time.Duration) error {
+	for i := 1; i < len(rides); i++ {
+		prev, r := rides[i-1], rides[i]
+		if r.Origin != prev.Destination {
+			return invalid(fmt.Sprintf("leg %d starts at %s but leg %d ends at %s", i+1, r.Origin, i, prev.Destination))
+		}
+		if usesTrip(rides[:i], r.TripID) {
+			return invalid(fmt.Sprintf("leg %d is on a train already used by an earlier leg", i+1))
+		}
+		if wait := r.Departs.Sub(prev.Arrives); wait < minWait {
+			return invalid(fmt.Sprintf("only %d minutes to change trains at %s; at least %d are needed", int(wait/time.Minute), r.Origin, int(minWait/time.Minute)))
+		}
+	}
+	return nil
+}
+
+// tripRow is the part of a trip a ride is built from.
+type tripRow struct {
+	id, trainCode, trainName, status string
+	date                             time.Time
+	base                             int64
+}
+
+// stopTimes returns when the train arrives at and departs from a stop.
+// DayOffset counts to the departure, so an arrival later in the day than the
+// departure happened before midnight.
+func stopTimes(date time.Time, s Stop) (arrive, depart time.Time) {
+	day := date.AddDate(0, 0, s.DayOffset)
+	arrive, depart = clockOn(day, s.Arrive), clockOn(day, s.Depart)
+	if s.Arrive != "" && s.Depart != "" && s.Arrive > s.Depart {
+		arrive = arrive.AddDate(0, 0, -1)
+	}
+	return arrive, depart
+}
+
+func clockOn(day time.Time, hm string) time.Time {
+	t, err := time.Parse("15:04", hm)
+	if err != nil {
+		return day
+	}
+	return day.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute)
+}
+
+func newRide(t tripRow, stops []Stop, leg Leg) Ride {
+	a, b := stopAt(stops, leg.From), stopAt(stops, leg.To)
+	_, departs := stopTimes(t.date, a)
+	arrives, _ := stopTimes(t.date, b)
+	return Ride{
+		TripID: t.id, TrainCode: t.trainCode, TrainName: t.trainName, Status: t.status,
+		Origin: a.Station, OriginName: a.StationName, Destination: b.Station, DestinationName: b.StationName,
+		Leg: leg, Departs: departs, Arrives: arrives, Fare: LegFare(stops, leg, t.base), KM: math.Max(b.DistanceKM-a.DistanceKM, 0),
+	}
+}
+
+// tripRides lists every ride a trip offers: one per ordered pair of its stops.
+func tripRides(t tripRow, stops []Stop) []Ride {
+	var out []Ride
+	for i := range stops {
+		for j := i + 1; j < len(stops); j++ {
+			out = append(out, newRide(t, stops, Leg{From: stops[i].Seq, To: stops[j].Seq}))
+		}
+	}
+	return out
+}
+
+// loadRides loads the rides of every trip that is not cancelled and may be
+// boarded on date or on the morning after, for transfers past midnight.
+func loadRides(ctx context.Context, db Querier, date time.Time) ([]Ride, error) {
+	rows, err := db.Query(ctx, `
+SELECT t.id, tr.code, tr.name, t.status, t.service_date, t.base_price::INT8,
+       ts.seq, s.code, s.name, COALESCE(ts.arrive_time::TEXT, ''), COALESCE(ts.depart_time::TEXT, ''),
+       ts.day_offset, ts.distance_km::FLOAT8
+FROM trips t
+JOIN trains tr ON tr.id = t.train_id
+JOIN trip_stops ts ON ts.trip_id = t.id
+JOIN stations s ON s.id = ts.station_id
+WHERE t.service_date BETWEEN $1::DATE - 2 AND $1::DATE + 1 AND t.status <> 'cancelled'
+ORDER BY t.id, ts.seq`, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var (
+		out   []Ride
+		cur   tripRow
+		stops []Stop
+	)
+	for rows.Next() {
+		var (
+			t tripRow
+			s Stop
+		)
+		if err := rows.Scan(&t.id, &t.trainCode, &t.trainName, &t.status, &t.date, &t.base,
+			&s.Seq, &s.Station, &s.StationName, &s.Arrive, &s.Depart, &s.DayOffset, &s.DistanceKM); err != nil {
+			return nil, err
+		}
+		if t.id != cur.id {
+			out = append(out, tripRides(cur, stops)...)
+			cur, stops = t, nil
+		}
+		s.Arrive, s.Depart = hhmm(s.Arrive), hhmm(s.Depart)
+		stops = append(stops, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return append(out, tripRides(cur, stops)...), nil
+}
+
+// loadRide loads one trip's ride between two station codes (empty for its
+// first and last stop).
+func loadRide(ctx context.Context, db Querier, tripID, from, to string) (Ride, error) {
+	if !ValidUUID(tripID) {
+		return Ride{}, invalid("trip_id must be a UUID")
+	}
+	t := tripRow{id: tripID}
+	err := db.QueryRow(ctx, `
+SELECT tr.code, tr.name, t.status, t.service_date, t.base_price::INT8
+FROM trips t JOIN trains tr ON tr.id = t.train_id
+WHERE t.id = $1`, tripID).Scan(&t.trainCode, &t.trainName, &t.status, &t.date, &t.base)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Ride{}, &Error{Code: CodeNotFound, Message: "trip not found"}
+	}
+	if err != nil {
+		return Ride{}, err
+	}
+	stops, err := TripStops(ctx, db, tripID)
+	if err != nil {
+		return Ride{}, err
+	}
+	leg, err := FindLeg(stops, from, to)
+	if err != nil {
+		return Ride{}, err
+	}
+	return newRide(t, stops, leg), nil
+}
+
+// FindJourneys plans itineraries for q and fills in seats left per class on
+// every leg. A journey is bookable when each leg has q.Passengers seats in
+// the requested class, or in some class when none was requested; legs are
+// then priced in the cheapest such class.
+func FindJourneys(ctx context.Context, db Querier, q JourneyQuery) ([]Journey, error) {
+	rides, err := loadRides(ctx, db, q.Date)
+	if err != nil {
+		return nil, err
+	}
+	if q.Fares, err = LoadFareRules(ctx, db); err != nil {
+		return nil, err
+	}
+	js := PlanJourneys(rides, q)
+	seats := map[string][]ClassAvailability{}
+	for i := range js {
+		j := &js[i]
+		j.Bookable, j.Price = true, 0
+		for k := range j.Legs {
+			l := &j.Legs[k]
+			key := l.TripID + ":" + strconv.Itoa(l.Leg.From) + "-" + strconv.Itoa(l.Leg.To)
+			classes, ok := seats[key]
+			if !ok {
+				if classes, err = legSeats(ctx, db, l.TripID, l.Leg, q.Fares, l.basis, q.Passengers); err != nil {
+					return nil, err
+				}
+				seats[key] = classes
+			}
+			l.Classes = classes
+			pickClass(l, q.Class)
+			j.Bookable = j.Bookable && l.bookable()
+			j.Price += l.Price
+		}
+	}
+	sortJourneys(js)
+	return js, nil
+}
+
+// pickClass prices a leg in the requested class, or else the cheapest class
+// with enough seats (the cheapest class at all when none has). A class the
+// train does not carry keeps the price the planner gave it.
+func pickClass(l *JourneyLeg, class string) {
+	if class == "" {
+		best := int64(-1)
+		for _, onlyBookable := range []bool{true, false} {
+			for _, c := range l.Classes {
+				if (c.Bookable || !onlyBookable) && (best < 0 || c.Price < best) {
+					class, best = c.Class, c.Price
+				}
+			}
+			if class != "" {
+				break
+			}
+		}
+	}
+	if class != "" {
+		l.Class = class
+	}
+	for _, c := range l.Classes {
+		if c.Class == l.Class {
+			l.Price = c.Price
+		}
+	}
+}
+
+func (l JourneyLeg) bookable() bool {
+	for _, c := range l.Classes {
+		if c.Class == l.Class {
+			return c.Bookable
+		}
+	}
+	return false
+}
+
+// legSeats counts the seats left per class on a leg of a trip.
+func legSeats(ctx context.Context, db Querier, tripID string, leg Leg, rules FareRules, basis FareBasis, pax int) ([]ClassAvailability, error) {
+	rows, err := db.Query(ctx, `
+SELECT s.class, COUNT(DISTINCT s.id) - COUNT(DISTINCT bi.seat_id)
+FROM seats s
+LEFT JOIN booking_items bi ON bi.seat_id = s.id AND `+liveItem+` AND `+overlapsLeg("$2", "$3")+`
+WHERE s.trip_id = $1
+GROUP BY s.class
+ORDER BY s.class`, tripID, leg.From, leg.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ClassAvailability{}
+	for rows.Next() {
+		var c ClassAvailability
+		if err := rows.Scan(&c.Class, &c.SeatsLeft); err != nil {
+			return nil, err
+		}
+		c.Price, c.Bookable = rules.Quote(basis, c.Class, "").Total, c.SeatsLeft >= pax
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// JourneyLegRequest is one train of a journey to hold: either exact seats, or
+// a class in which the first free seats are picked.
+type JourneyLegRequest struct {
+	TripID  string   `json:"trip_id"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Class   string   `json:"class,omitempty"`
+	SeatIDs []string `json:"seat_ids,omitempty"`
+}
+
+// JourneyHoldRequest holds seats for Pax passengers on every leg of a journey.
+type JourneyHoldRequest struct {
+	Holder string              `json:"-"`
+	Pax    int                 `json:"pax"`
+	Legs   []JourneyLegRequest `json:"legs"`
+}
+
+// HoldJourney holds seats on every leg of a journey in one transaction, so
+// either all legs are held or none is. The legs must connect (see
+// CheckConnections with MinConnection). The holder has one journey cart:
+// holding a journey gives back the seats of the previous one. Seats are
+// locked the same way PlaceHold locks them, so a seat taken on an
+// overlapping leg fails the whole hold with seat_unavailable.
+func HoldJourney(ctx context.Context, db DB, req JourneyHoldRequest, ttl time.Duration) (HoldResult, error) {
+	var res HoldResult
+	if strings.TrimSpace(req.Holder) == "" {
+		return res, invalid("holder is required")
+	}
+	if len(req.Legs) == 0 || len(req.Legs) > MaxJourneyLegs() {
+		return res, invalid("a journey has between 1 and " + strconv.Itoa(MaxJourneyLegs()) + " legs")
+	}
+	for i := range req.Legs {
+		l := &req.Legs[i]
+		l.SeatIDs = dedupe(l.SeatIDs)
+		l.Class = strings.ToLower(strings.TrimSpace(l.Class))
+		if req.Pax == 0 && len(l.SeatIDs) > 0 {
+			req.Pax = len(l.SeatIDs)
+		}
+	}
+	if req.Pax == 0 {
+		req.Pax = 1
+	}
+	if req.Pax < 0 || req.Pax > MaxPassengers() {
+		return res, invalid("pax must be between 1 and " + strconv.Itoa(MaxPassengers()))
+	}
+	for i, l := range req.Legs {
+		n := "leg " + strconv.Itoa(i+1) + ": "
+		switch {
+		case !ValidUUID(l.TripID):
+			return res, invalid(n + "trip_id must be a UUID")
+		case !allUUIDs(l.SeatIDs):
+			return res, invalid(n + "seat_ids must be UUIDs")
+		case len(l.SeatIDs) > 0 && len(l.SeatIDs) != req.Pax:
+			return res, invalid(n + "hold one seat per passenger")
+		case len(l.SeatIDs) == 0 && !ValidClass(l.Class):
+			return res, invalid(n + "a class or seat_ids are required")
+		}
+	}
+	var released []SeatChange
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		var err error
+		res, released, err = holdJourneyTx(ctx, tx, req, ttl)
+		return err
+	})
+	if err == nil {
+		announceSeats(append(released, heldChanges(res.Seats)...))
+	}
+	return res, err
+}
+
+// holdJourneyTx holds the journey and also returns the seats the holder's
+// previous journey gave back.
+func holdJourneyTx(ctx context.Context, tx pgx.Tx, req JourneyHoldRequest, ttl time.Duration) (HoldResult, []SeatChange, error) {
+	rides := make([]Ride, len(req.Legs))
+	for i, l := range req.Legs {
+		r, err := loadRide(ctx, tx, l.TripID, l.From, l.To)
+		if err != nil {
+			return HoldResult{}, nil, err
+		}
+		rides[i] = r
+	}
+	if err := CheckConnections(rides, MinConnection()); err != nil {
+		return HoldResult{}, nil, err
+	}
+	rules, err := LoadFareRules(ctx, tx)
+	if err != nil {
+		return HoldResult{}, nil, err
+	}
+	cartID, released, err := journeyCart(ctx, tx, req.Holder, rides[0])
+	if err != nil {
+		return HoldResult{}, nil, err
+	}
+	for i, l := range req.Legs {
+		r := rides[i]
+		ids := l.SeatIDs
+		if len(ids) == 0 {
+			if ids, err = freeSeats(ctx, tx, r, l.Class, req.Pax); err != nil {
+				return HoldResult{}, nil, err
+			}
+		}
+		seats, err := lockSeats(ctx, tx, r.TripID, ids)
+		if err != nil {
+			return HoldResult{}, nil, err
+		}
+		if err := checkTaken(ctx, tx, ids, cartID, r.Leg); err != nil {
+			return HoldResult{}, nil, err
+		}
+		if err := checkWaitlist(ctx, tx, ids, cartID, r.Leg); err != nil {
+			return HoldResult{}, nil, err
+		}
+		if err := holdSeats(ctx, tx, cartID, seats, r.Leg, rules, r.basis(), ttl); err != nil {
+			return HoldResult{}, nil, err
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO booking_legs (booking_id, leg_no, trip_id, from_seq, to_seq) VALUES ($1, $2, $3, $4, $5)`,
+			cartID, i, r.TripID, r.Leg.From, r.Leg.To); err != nil {
+			return HoldResult{}, nil, err
+		}
+	}
+	res, err := cartResult(ctx, tx, cartID)
+	return res, released, err
+}
+
+// journeyCart returns the holder's journey cart, emptied and moved to start
+// with the first ride, and the seats it held before.
+func journeyCart(ctx context.Context, tx pgx.Tx, holder string, first Ride) (string, []SeatChange, error) {
+	if _, err := tx.Exec(ctx, `
+INSERT INTO bookings (code, user_ref, trip_id, status, journey, from_seq, to_seq)
+VALUES ($1, $2, $3, 'hold', TRUE, $4, $5)
+ON CONFLICT (user_ref) WHERE status = 'hold' AND journey DO NOTHING`, "HOLD-"+randomHex(8), holder, first.TripID, first.Leg.From, first.Leg.To); err != nil {
+		return "", nil, err
+	}
+	var id string
+	if err := tx.QueryRow(ctx, `SELECT id FROM bookings WHERE user_ref = $1 AND status = 'hold' AND journey FOR UPDATE`, holder).Scan(&id); err != nil {
+		return "", nil, err
+	}
+	released, err := updateSeats(ctx, tx, SeatReleased, `UPDATE booking_items SET status = 'released', held_until = NULL WHERE booking_id = $1 AND status = 'held' RETURNING seat_id`, id)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM booking_legs WHERE booking_id = $1`, id); err != nil {
+		return "", nil, err
+	}
+	_, err = tx.Exec(ctx, `UPDATE bookings SET trip_id = $2, from_seq = $3, to_seq = $4 WHERE id = $1`, id, first.TripID, first.Leg.From, first.Leg.To)
+	return id, released, err
+}
+
+// freeSeats picks the first n seats of a class that are free on the ride's
+// leg. They are not locked yet; lockSeats and checkTaken catch a seat taken
+// in between.
+func freeSeats(ctx context.Context, tx Querier, r Ride, class string, n int) ([]string, error) {
+	rows, err := tx.Query(ctx, `
+SELECT s.id FROM seats s
+WHERE s.trip_id = $1 AND s.class = $2
+  AND NOT EXISTS (SELECT 1 FROM booking_items bi WHERE bi.seat_id = s.id AND `+liveItem+` AND `+overlapsLeg("$3", "$4")+`)
+ORDER BY s.coach_no, s.seat_no
+LIMIT $5`, r.TripID, class, r.Leg.From, r.Leg.To, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]string, 0, n)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) < n {
+		return nil, &Error{Code: CodeSeatUnavailable, Message: fmt.Sprintf("not enough %s seats left on %s %s→%s", class, r.TrainCode, r.Origin, r.Destination)}
+	}
+	return ids, nil
+}
+
+// ListJourneyHold returns the seats the holder holds for a connecting journey, in travel order.
+func ListJourneyHold(ctx context.Context, db Querier, holder string) ([]HeldSeat, error) {
+	return listHeld(ctx, db, `b.user_ref = $1 AND b.status = 'hold' AND b.journey`, holder)
+}
+
+// JourneyCheckoutRequest converts the holder's journey cart into one booking.
+// Passengers, when set, name the seats held on the first leg; each traveller
+// keeps the same place in the seat order (coach, then seat) on later legs.
+type JourneyCheckoutRequest struct {
+	Holder     string      `json:"-"`
+	Contact    Contact     `json:"contact"`
+	Passengers []Passenger `json:"passengers,omitempty"`
+	PromoCode  string      `json:"promo_code,omitempty"`
+}
+
+// CheckoutJourney turns the holder's journey cart into a pending booking in
+// one transaction, like Checkout does for one trip: every leg must still
+// hold the same number of live seats, each priced from its leg's fare.
+func CheckoutJourney(ctx context.Context, db DB, req JourneyCheckoutRequest) (Booking, error) {
+	var b Booking
+	if strings.TrimSpace(req.Holder) == "" {
+		return b, invalid("holder is required")
+	}
+	if err := req.Contact.Validate(); err != nil {
+		return b, err
+	}
+	if len(req.Passengers) > 0 {
+		if err := ValidatePassengers(req.Passengers, time.Now()); err != nil {
+			return b, err
+		}
+	}
+	var id string
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		var err error
+		id, err = checkoutJourneyTx(ctx, tx, req)
+		return err
+	})
+	if err != nil {
+		return b, err
+	}
+	return bookedBooking(ctx, db, id)
+}
+
+func checkoutJourneyTx(ctx context.Context, tx pgx.Tx, req JourneyCheckoutRequest) (string, error) {
+	noHold := &Error{Code: CodeHoldExpired, Message: "no journey is on hold, please choose it again"}
+	var cartID string
+	err := tx.QueryRow(ctx, `SELECT id FROM bookings WHERE user_ref = $1 AND status = 'hold' AND journey FOR UPDATE`, req.Holder).Scan(&cartID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", noHold
+	}
+	if err != nil {
+		return "", err
+	}
+
+	type legRow struct {
+		tripID string
+		leg    Leg
+		base   int64
+		date   time.Time
+		basis  FareBasis
+	}
+	var legs []legRow
+	// Share locking the trips keeps them from being cancelled until the booking exists.
+	rows, err := tx.Query(ctx, `
+SELECT bl.trip_id, bl.from_seq, bl.to_seq, t.base_price::INT8, t.service_date, t.status, t.service_date >= current_date
+FROM booking_legs bl JOIN trips t ON t.id = bl.trip_id
+WHERE bl.booking_id = $1
+ORDER BY bl.leg_no
+FOR SHARE OF t`, cartID)
+	if err != nil {
+		return "", err
+	}
+	for rows.Next() {
+		var (
+			l        legRow
+			status   string
+			upcoming bool
+		)
+		if err := rows.Scan(&l.tripID, &l.leg.From, &l.leg.To, &l.base, &l.date, &status, &upcoming); err != nil {
+			rows.Close()
+			return "", err
+		}
+		if status == "cancelled" || !upcoming {
+			rows.Close()
+			return "", invalid("a train in this journey is not open for sale")
+		}
+		legs = append(legs, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(legs) == 0 {
+		return "", noHold
+	}
+	for i := range legs {
+		stops, err := TripStops(ctx, tx, legs[i].tripID)
+		if err != nil {
+			return "", err
+		}
+		legs[i].basis = legBasis(stops, legs[i].leg, legs[i].base, legs[i].date)
+	}
+	rules, err := LoadFareRules(ctx, tx)
+	if err != nil {
+		return "", err
+	}
+
+	type heldRow struct {
+		id, seatID, tripID, class string
+		live                      bool
+	}
+	byTrip := map[string][]heldRow{}
+	rows, err = tx.Query(ctx, `
+SELECT bi.id, bi.seat_id, s.trip_id, s.class, bi.held_until > now()
+FROM booking_items bi JOIN seats s ON s.id = bi.seat_id
+WHERE bi.booking_id = $1 AND bi.status = 'held'
+ORDER BY s.coach_no, s.seat_no
+FOR UPDATE OF bi`, cartID)
+	if err != nil {
+		return "", err
+	}
+	for rows.Next() {
+		var h heldRow
+		if err := rows.Scan(&h.id, &h.seatID, &h.tripID, &h.class, &h.live); err != nil {
+			rows.Close()
+			return "", err
+		}
+		byTrip[h.tripID] = append(byTrip[h.tripID], h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	pax := len(byTrip[legs[0].tripID])
+	for _, l := range legs {
+		held := byTrip[l.tripID]
+		if len(held) == 0 || len(held) != pax {
+			return "", &Error{Code: CodeHoldExpired, Message: "held seats changed, please choose the journey again"}
+		}
+		for _, h := range held {
+			if !h.live {
+				return "", &Error{Code: CodeHoldExpired, Message: "seat hold expired, please choose the journey again"}
+			}
+		}
+	}
+
+	if len(req.Passengers) > 0 {
+		first := byTrip[legs[0].tripID]
+		items := make(map[string]string, pax)
+		for _, h := range first {
+			items[h.seatID] = h.id
+		}
+		if err := savePassengers(ctx, tx, items, req.Passengers); err != nil {
+			return "", err
+		}
+		for _, l := range legs[1:] {
+			for i, h := range byTrip[l.tripID] {
+				if _, err := tx.Exec(ctx, `
+INSERT INTO passengers (booking_item_id, full_name, id_type, id_number, category)
+SELECT $2, full_name, id_type, id_number, category FROM passengers WHERE booking_item_id = $1
+ON CONFLICT (booking_item_id) DO UPDATE
+SET full_name = excluded.full_name, id_type = excluded.id_type, id_number = excluded.id_number,
+    category = excluded.category, updated_at = now()`, first[i].id, h.id); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+
+	var total int64
+	for _, l := range legs {
+		for _, h := range byTrip[l.tripID] {
+			price, err := confirmItem(ctx, tx, rules, l.basis, h.id, h.class)
+			if err != nil {
+				return "", err
+			}
+			total += price
+		}
+	}
+	return cartID, closeCart(ctx, tx, cartID, total, req.Holder, req.PromoCode, req.Contact)
+}
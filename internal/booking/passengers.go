@@ -0,0 +1,228 @@
+package booking
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Identity document types accepted for passengers.
+const (
+	IDTypeNIK      = "nik"      // Nomor Induk Kependudukan (Indonesian national ID)
+	IDTypePassport = "passport" // foreign nationals and travellers without a KTP
+)
+
+// Passenger categories. Seniors and students travel on discounted fares (see fare_discounts).
+const (
+	CategoryAdult   = "adult"
+	CategoryInfant  = "infant"
+	CategorySenior  = "senior"
+	CategoryStudent = "student"
+)
+
+// Categories lists the passenger categories in display order.
+var Categories = []string{CategoryAdult, CategorySenior, CategoryStudent, CategoryInfant}
+
+// ValidCategory reports whether c is a known passenger category.
+func ValidCategory(c string) bool {
+	for _, k := range Categories {
+		if c == k {
+			return true
+		}
+	}
+	return false
+}
+
+// InfantMaxAge is the age (in whole years) from which a passenger no longer counts as an infant.
+const InfantMaxAge = 3
+
+// SeniorMinAge is the age (in whole years) from which a passenger may travel as a senior.
+const SeniorMinAge = 60
+
+// Passenger is the person travelling on one booked seat.
+type Passenger struct {
+	SeatID   string `json:"seat_id"`
+	Name     string `json:"name"`
+	IDType   string `json:"id_type"`
+	IDNumber string `json:"id_number"`
+	Category string `json:"category"`
+}
+
+// provinceCodes are the first two digits of valid NIKs (Dukcapil province codes).
+var provinceCodes = map[string]bool{
+	"11": true, "12": true, "13": true, "14": true, "15": true, "16": true, "17": true, "18": true, "19": true,
+	"21": true, "31": true, "32": true, "33": true, "34": true, "35": true, "36": true,
+	"51": true, "52": true, "53": true, "61": true, "62": true, "63": true, "64": true, "65": true,
+	"71": true, "72": true, "73": true, "74": true, "75": true, "76": true, "81": true, "82": true,
+	"91": true, "92": true, "93": true, "94": true, "95": true, "96": true,
+}
+
+// ValidateNIK checks the structure of a 16-digit NIK and returns the birth date
+// it encodes. Digits 7-12 are DDMMYY, with 40 added to the day for women; the
+// century is the latest one that does not put the birth date after now.
+func ValidateNIK(nik string, now time.Time) (time.Time, error) {
+	if len(nik) != 16 {
+		return time.Time{}, invalid("NIK must be 16 digits")
+	}
+	for _, c := range nik {
+		if c < '0' || c > '9' {
+			return time.Time{}, invalid("NIK must contain digits only")
+		}
+	}
+	if !provinceCodes[nik[:2]] {
+		return time.Time{}, invalid("NIK has an unknown province code")
+	}
+	day, _ := strconv.Atoi(nik[6:8])
+	month, _ := strconv.Atoi(nik[8:10])
+	yy, _ := strconv.Atoi(nik[10:12])
+	if day > 40 {
+		day -= 40
+	}
+	year := 2000 + yy
+	if year > now.Year() {
+		year -= 100
+	}
+	birth := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if month < 1 || month > 12 || day < 1 || birth.Day() != day || birth.After(now) {
+		return time.Time{}, invalid("NIK has an invalid birth date")
+	}
+	if nik[12:] == "0000" {
+		return time.Time{}, invalid("NIK has an invalid serial number")
+	}
+	return birth, nil
+}
+
+// ageOn returns the age in whole years on the given day.
+func ageOn(birth, day time.Time) int {
+	age := day.Year() - birth.Year()
+	if day.Month() < birth.Month() || (day.Month() == birth.Month() && day.Day() < birth.Day()) {
+		age--
+	}
+	return age
+}
+
+// ValidatePassengers normalizes ps in place and checks every field. Problems are
+// returned as one invalid_request Error whose Fields are keyed
+// "passengers.<index>.<field>" so forms can show them inline.
+func ValidatePassengers(ps []Passenger, now time.Time) error {
+	fields := map[string]string{}
+	key := func(i int, f string) string { return "passengers." + strconv.Itoa(i) + "." + f }
+	seats := map[string]bool{}
+	ids := map[string]bool{}
+	adults, infants := 0, 0 // adults counts everyone who may accompany an infant
+	for i := range ps {
+		p := &ps[i]
+		p.SeatID = strings.ToLower(strings.TrimSpace(p.SeatID))
+		p.Name = strings.Join(strings.Fields(p.Name), " ")
+		p.IDType = strings.ToLower(strings.TrimSpace(p.IDType))
+		p.IDNumber = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(p.IDNumber), " ", ""))
+		p.Category = strings.ToLower(strings.TrimSpace(p.Category))
+		if p.Category == "" {
+			p.Category = CategoryAdult
+		}
+
+		switch {
+		case !ValidUUID(p.SeatID):
+			fields[key(i, "seat_id")] = "choose a seat"
+		case seats[p.SeatID]:
+			fields[key(i, "seat_id")] = "each seat can only have one passenger"
+		}
+		seats[p.SeatID] = true
+
+		if p.Name == "" {
+			fields[key(i, "name")] = "name is required"
+		} else if len(p.Name) > 200 {
+			fields[key(i, "name")] = "name is too long"
+		}
+
+		if !ValidCategory(p.Category) {
+			fields[key(i, "category")] = "choose adult, senior, student or infant"
+		}
+
+		switch p.IDType {
+		case IDTypeNIK:
+			birth, err := ValidateNIK(p.IDNumber, now)
+			if err != nil {
+				fields[key(i, "id_number")] = err.Error()
+				break
+			}
+			age := ageOn(birth, now)
+			switch {
+			case p.Category == CategoryInfant && age >= InfantMaxAge:
+				fields[key(i, "category")] = fmt.Sprintf("infants must be under %d years old", InfantMaxAge)
+			case p.Category == CategorySenior && age < SeniorMinAge:
+				fields[key(i, "category")] = fmt.Sprintf("seniors must be at least %d years old", SeniorMinAge)
+			case p.Category != CategoryInfant && ValidCategory(p.Category) && age < InfantMaxAge:
+				fields[key(i, "category")] = fmt.Sprintf("passengers under %d travel as infants", InfantMaxAge)
+			}
+		case IDTypePassport:
+			if !validPassport(p.IDNumber) {
+				fields[key(i, "id_number")] = "passport number must be 6-20 letters or digits"
+			}
+		default:
+			fields[key(i, "id_type")] = "choose NIK or passport"
+		}
+		if p.IDNumber != "" && fields[key(i, "id_number")] == "" {
+			if ids[p.IDType+":"+p.IDNumber] {
+				fields[key(i, "id_number")] = "this ID is already used by another passenger"
+			}
+			ids[p.IDType+":"+p.IDNumber] = true
+		}
+
+		switch p.Category {
+		case CategoryAdult, CategorySenior:
+			adults++
+		case CategoryInfant:
+			infants++
+		}
+	}
+	if infants > adults {
+		fields["passengers"] = "each infant must travel with an adult"
+	}
+	if len(fields) > 0 {
+		return &Error{Code: CodeInvalid, Message: "please correct the passenger details", Fields: fields}
+	}
+	return nil
+}
+
+func validPassport(s string) bool {
+	if len(s) < 6 || len(s) > 20 {
+		return false
+	}
+	for _, c := range s {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// savePassengers attaches ps to the cart items they sit on. Every held seat
+// must get exactly one passenger; held maps seat id to booking_items.id.
+func savePassengers(ctx context.Context, tx pgx.Tx, held map[string]string, ps []Passenger) error {
+	got := make(map[string]bool, len(ps))
+	for _, p := range ps {
+		if _, ok := held[p.SeatID]; !ok {
+			return &Error{Code: CodeHoldExpired, Message: "held seats changed, please review your selection"}
+		}
+		got[p.SeatID] = true
+	}
+	if len(got) != len(held) {
+		return &Error{Code: CodeInvalid, Message: "every held seat needs a passenger", Fields: map[string]string{"passengers": "every held seat needs a passenger"}}
+	}
+	for _, p := range ps {
+		if _, err := tx.Exec(ctx, `
+INSERT INTO passengers (booking_item_id, full_name, id_type, id_number, category)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (booking_item_id) DO UPDATE
+SET full_name = excluded.full_name, id_type = excluded.id_type, id_number = excluded.id_number,
+    category = excluded.category, updated_at = now()`, held[p.SeatID], p.Name, p.IDType, p.IDNumber, p.Category); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/env"
+)
+
+// Booking statuses after checkout.
+const (
+	StatusPaid    = "paid"    // payment settled; seats are sold
+	StatusExpired = "expired" // not paid before payment_due_at; seats went back to inventory
+)
+
+// CodeNotPending is returned when a payment transition hits a booking that is no longer pending.
+const CodeNotPending = "not_pending"
+
+// PaymentWindow returns how long a checked-out booking may stay unpaid
+// (PAYMENT_DEADLINE_MINUTES, default 30 minutes).
+func PaymentWindow() time.Duration {
+	if n, err := strconv.Atoi(strings.TrimSpace(env.Get("PAYMENT_DEADLINE_MINUTES", ""))); err == nil && n > 0 {
+		return time.Duration(n) * time.Minute
+	}
+	return 30 * time.Minute
+}
+
+// MarkPaid moves a pending booking to paid. A booking that already expired (or
+// was paid before) returns a not_pending error so callers can flag the payment
+// for a refund instead of selling seats that were released.
+func MarkPaid(ctx context.Context, db Querier, bookingID string) error {
+	tag, err := db.Exec(ctx, `UPDATE bookings SET status = 'paid', paid_at = now() WHERE id = $1 AND status = 'pending'`, bookingID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return notPending(ctx, db, bookingID)
+	}
+	return recordHistory(ctx, db, bookingID, EventPaid, nil)
+}
+
+// ExpireBooking moves a pending booking to expired and releases its seats and
+// promo code.
+func ExpireBooking(ctx context.Context, db DB, bookingID string) error {
+	var changes []SeatChange
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		var err error
+		changes, err = ExpireBookingTx(ctx, tx, bookingID)
+		return err
+	})
+	if err == nil {
+		announceSeats(changes)
+	}
+	return err
+}
+
+// ExpireBookingTx is ExpireBooking inside the caller's transaction. It returns
+// the released seats for AnnounceSeats once that transaction has committed.
+func ExpireBookingTx(ctx context.Context, tx pgx.Tx, bookingID string) ([]SeatChange, error) {
+	tag, err := tx.Exec(ctx, `UPDATE bookings SET status = 'expired' WHERE id = $1 AND status = 'pending'`, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, notPending(ctx, tx, bookingID)
+	}
+	changes, err := updateSeats(ctx, tx, SeatReleased, `UPDATE booking_items SET status = 'expired' WHERE booking_id = $1 AND status = 'confirmed' RETURNING seat_id`, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	if err := releasePromos(ctx, tx, []string{bookingID}); err != nil {
+		return nil, err
+	}
+	return changes, recordHistory(ctx, tx, bookingID, EventExpired, nil)
+}
+
+func notPending(ctx context.Context, db Querier, bookingID string) error {
+	var status string
+	err := db.QueryRow(ctx, `SELECT status FROM bookings WHERE id = $1`, bookingID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &Error{Code: CodeNotFound, Message: "booking not found"}
+	}
+	if err != nil {
+		return err
+	}
+	return &Error{Code: CodeNotPending, Message: "booking is " + status}
+}
+
+// ExpireUnpaid expires every pending booking past its payment deadline and
+// releases the seats. It returns the ids of the bookings it expired.
+func ExpireUnpaid(ctx context.Context, db DB) ([]string, error) {
+	var (
+		ids     []string
+		changes []SeatChange
+	)
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		ids = ids[:0]
+		rows, err := tx.Query(ctx, `UPDATE bookings SET status = 'expired' WHERE status = 'pending' AND payment_due_at <= now() RETURNING id`)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil || len(ids) == 0 {
+			return err
+		}
+		if changes, err = updateSeats(ctx, tx, SeatReleased, `UPDATE booking_items SET status = 'expired' WHERE status = 'confirmed' AND booking_id = ANY($1::UUID[]) RETURNING seat_id`, ids); err != nil {
+			return err
+		}
+		if err := releasePromos(ctx, tx, ids); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := recordHistory(ctx, tx, id, EventExpired, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if len(ids) > 0 {
+		seatsFreed()
+	}
+	if err == nil {
+		announceSeats(changes)
+	}
+	return ids, err
+}
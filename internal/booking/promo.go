@@ -0,0 +1,301 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Promo discount kinds.
+const (
+	PromoPercent = "percent" // Value percent off the eligible seats, up to MaxDiscount
+	PromoFixed   = "fixed"   // Value rupiah off the eligible seats
+)
+
+// Promo is a campaign code entered at checkout. Empty Routes, Trains or
+// Classes mean any; zero MaxUses, MaxUsesPerUser or MaxDiscount mean no limit.
+type Promo struct {
+	ID             string     `json:"id"`
+	Code           string     `json:"code"`
+	Description    string     `json:"description"`
+	Kind           string     `json:"kind"`
+	Value          int64      `json:"value"`
+	MaxDiscount    int64      `json:"max_discount,omitempty"`
+	MinTotal       int64      `json:"min_total,omitempty"`
+	StartsAt       *time.Time `json:"starts_at,omitempty"`
+	EndsAt         *time.Time `json:"ends_at,omitempty"`
+	MaxUses        int        `json:"max_uses,omitempty"`
+	MaxUsesPerUser int        `json:"max_uses_per_user,omitempty"`
+	Routes         []string   `json:"routes,omitempty"` // route codes, e.g. GMR-BD
+	Trains         []string   `json:"trains,omitempty"` // train codes, e.g. AP
+	Classes        []string   `json:"classes,omitempty"`
+	Active         bool       `json:"active"`
+	CreatedAt      time.Time  `json:"created_at"`
+
+	// Filled by ListPromos.
+	Redemptions int   `json:"redemptions"`
+	Discounted  int64 `json:"discounted"`
+}
+
+// PromoItem is a booked seat a promo may discount.
+type PromoItem struct {
+	Price int64
+	Route string
+	Train string
+	Class string
+}
+
+// NormalizePromoCode upper-cases a code and strips spaces.
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+}
+
+func promoError(msg string) error { return invalidField("promo_code", msg) }
+
+// Validate checks a promo before it is stored and normalizes its code and lists.
+func (p *Promo) Validate() error {
+	p.Code = NormalizePromoCode(p.Code)
+	if len(p.Code) < 3 || len(p.Code) > 32 {
+		return invalid("code must be 3 to 32 characters")
+	}
+	for _, c := range p.Code {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+			return invalid("code may only contain letters, digits, - and _")
+		}
+	}
+	switch p.Kind {
+	case PromoPercent:
+		if p.Value < 1 || p.Value > 100 {
+			return invalid("a percent discount must be between 1 and 100")
+		}
+	case PromoFixed:
+		if p.Value < 1 {
+			return invalid("a fixed discount must be positive")
+		}
+	default:
+		return invalid("kind must be percent or fixed")
+	}
+	if p.MaxDiscount < 0 || p.MinTotal < 0 || p.MaxUses < 0 || p.MaxUsesPerUser < 0 {
+		return invalid("limits cannot be negative")
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return invalid("the promo must end after it starts")
+	}
+	for i := range p.Routes {
+		p.Routes[i] = strings.ToUpper(strings.TrimSpace(p.Routes[i]))
+	}
+	for i := range p.Trains {
+		p.Trains[i] = strings.ToUpper(strings.TrimSpace(p.Trains[i]))
+	}
+	for i := range p.Classes {
+		p.Classes[i] = strings.ToLower(strings.TrimSpace(p.Classes[i]))
+		if !ValidClass(p.Classes[i]) {
+			return invalid("unknown class: " + p.Classes[i])
+		}
+	}
+	return nil
+}
+
+// covers reports whether the promo may discount the seat.
+func (p Promo) covers(it PromoItem) bool {
+	return allowed(p.Routes, it.Route) && allowed(p.Trains, it.Train) && allowed(p.Classes, it.Class)
+}
+
+func allowed(list []string, v string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, x := range list {
+		if strings.EqualFold(x, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Discount returns what the promo takes off the items at now, or why it does
+// not apply. Only seats on matching routes, trains and classes count, both
+// towards MinTotal and as the amount discounted. Usage caps are checked when
+// redeeming.
+func (p Promo) Discount(items []PromoItem, now time.Time) (int64, error) {
+	if !p.Active {
+		return 0, promoError("promo code not found")
+	}
+	if p.StartsAt != nil && now.Before(*p.StartsAt) {
+		return 0, promoError("promo code is not valid yet")
+	}
+	if p.EndsAt != nil && !now.Before(*p.EndsAt) {
+		return 0, promoError("promo code has expired")
+	}
+	var eligible int64
+	for _, it := range items {
+		if p.covers(it) {
+			eligible += it.Price
+		}
+	}
+	if eligible == 0 {
+		return 0, promoError("promo code does not apply to these seats")
+	}
+	if eligible < p.MinTotal {
+		return 0, promoError(fmt.Sprintf("promo code needs at least Rp%d of eligible seats", p.MinTotal))
+	}
+	var d int64
+	switch p.Kind {
+	case PromoPercent:
+		d = eligible * p.Value / 100
+		if p.MaxDiscount > 0 {
+			d = min(d, p.MaxDiscount)
+		}
+	case PromoFixed:
+		d = p.Value
+	}
+	return min(d, eligible), nil
+}
+
+const promoColumns = `p.id, p.code, p.description, p.kind, p.value::INT8, COALESCE(p.max_discount, 0)::INT8, p.min_total::INT8,
+       p.starts_at, p.ends_at, COALESCE(p.max_uses, 0), COALESCE(p.max_uses_per_user, 0),
+       p.routes, p.trains, p.classes, p.active, p.created_at`
+
+func scanPromo(row pgx.Row, p *Promo, extra ...any) error {
+	return row.Scan(append([]any{&p.ID, &p.Code, &p.Description, &p.Kind, &p.Value, &p.MaxDiscount, &p.MinTotal,
+		&p.StartsAt, &p.EndsAt, &p.MaxUses, &p.MaxUsesPerUser, &p.Routes, &p.Trains, &p.Classes, &p.Active, &p.CreatedAt}, extra...)...)
+}
+
+// redeemPromo applies a promo code to a cart that is being checked out and
+// returns the discount. The promo row is locked FOR UPDATE, so concurrent
+// checkouts with the same code queue up and the usage caps hold: MaxUses
+// counts redemptions of live bookings, MaxUsesPerUser those by the same
+// holder or contact email.
+func redeemPromo(ctx context.Context, tx pgx.Tx, code, bookingID, holder, email string) (int64, error) {
+	var p Promo
+	err := scanPromo(tx.QueryRow(ctx, `SELECT `+promoColumns+` FROM promo_codes p WHERE p.code = $1 FOR UPDATE`, NormalizePromoCode(code)), &p)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, promoError("promo code not found")
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(ctx, `
+SELECT bi.price::INT8, r.route_code, tr.code, s.class
+FROM booking_items bi
+JOIN seats s ON s.id = bi.seat_id
+JOIN trips t ON t.id = s.trip_id
+JOIN routes r ON r.id = t.route_id
+JOIN trains tr ON tr.id = t.train_id
+WHERE bi.booking_id = $1 AND bi.status = 'confirmed'`, bookingID)
+	if err != nil {
+		return 0, err
+	}
+	var items []PromoItem
+	for rows.Next() {
+		var it PromoItem
+		if err := rows.Scan(&it.Price, &it.Route, &it.Train, &it.Class); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	discount, err := p.Discount(items, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	var total, mine int
+	if err := tx.QueryRow(ctx, `
+SELECT COUNT(*), COUNT(*) FILTER (WHERE user_ref = $2 OR (email <> '' AND lower(email) = lower($3)))
+FROM promo_redemptions WHERE promo_id = $1`, p.ID, holder, email).Scan(&total, &mine); err != nil {
+		return 0, err
+	}
+	if p.MaxUses > 0 && total >= p.MaxUses {
+		return 0, promoError("promo code has been fully redeemed")
+	}
+	if p.MaxUsesPerUser > 0 && mine >= p.MaxUsesPerUser {
+		return 0, promoError("you have already used this promo code")
+	}
+	if _, err := tx.Exec(ctx, `
+INSERT INTO promo_redemptions (promo_id, booking_id, user_ref, email, discount) VALUES ($1, $2, $3, $4, $5)`,
+		p.ID, bookingID, holder, email, discount); err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(ctx, `UPDATE bookings SET promo_code = $2, discount_total = $3 WHERE id = $1`, bookingID, p.Code, discount)
+	return discount, err
+}
+
+// releasePromos frees the promo redemptions of bookings that will not be
+// paid, so they no longer count against the caps.
+func releasePromos(ctx context.Context, tx pgx.Tx, bookingIDs []string) error {
+	_, err := tx.Exec(ctx, `DELETE FROM promo_redemptions WHERE booking_id = ANY($1::UUID[])`, bookingIDs)
+	return err
+}
+
+// CreatePromo validates and stores a new promo code.
+func CreatePromo(ctx context.Context, db Querier, p Promo) (Promo, error) {
+	if err := p.Validate(); err != nil {
+		return p, err
+	}
+	err := db.QueryRow(ctx, `
+INSERT INTO promo_codes (code, description, kind, value, max_discount, min_total, starts_at, ends_at,
+                         max_uses, max_uses_per_user, routes, trains, classes, active)
+VALUES ($1, $2, $3, $4, NULLIF($5::INT8, 0), $6, $7, $8, NULLIF($9::INT, 0), NULLIF($10::INT, 0), $11, $12, $13, TRUE)
+ON CONFLICT (code) DO NOTHING
+RETURNING id, active, created_at`,
+		p.Code, p.Description, p.Kind, p.Value, p.MaxDiscount, p.MinTotal, p.StartsAt, p.EndsAt,
+		p.MaxUses, p.MaxUsesPerUser, nonNil(p.Routes), nonNil(p.Trains), nonNil(p.Classes)).Scan(&p.ID, &p.Active, &p.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p, invalid("promo code " + p.Code + " already exists")
+	}
+	return p, err
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// SetPromoActive enables or disables a promo code. Disabled codes are refused
+// at checkout; bookings that already used them keep their discount.
+func SetPromoActive(ctx context.Context, db Querier, code string, active bool) error {
+	tag, err := db.Exec(ctx, `UPDATE promo_codes SET active = $2 WHERE code = $1`, NormalizePromoCode(code), active)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return &Error{Code: CodeNotFound, Message: "promo code not found"}
+	}
+	return nil
+}
+
+// ListPromos returns every promo code, newest first, with how many live
+// bookings redeemed it and the rupiah they saved.
+func ListPromos(ctx context.Context, db Querier) ([]Promo, error) {
+	rows, err := db.Query(ctx, `
+SELECT `+promoColumns+`, COUNT(pr.id), COALESCE(SUM(pr.discount), 0)::INT8
+FROM promo_codes p
+LEFT JOIN promo_redemptions pr ON pr.promo_id = p.id
+GROUP BY p.id
+ORDER BY p.created_at DESC, p.code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Promo{}
+	for rows.Next() {
+		var p Promo
+		if err := scanPromo(rows, &p, &p.Redemptions, &p.Discounted); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
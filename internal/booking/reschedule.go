@@ -0,0 +1,574 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/env"
+)
+
+// ItemRescheduled is a seat given up when its booking moved to another trip.
+const ItemRescheduled = "rescheduled"
+
+// CodeNotChangeable is returned when a booking cannot move to another trip.
+const CodeNotChangeable = "not_changeable"
+
+// Trip change statuses.
+const (
+	ChangePending = "pending" // new seats held until the balance is paid
+	ChangeApplied = "applied" // the booking moved to the new trip
+	ChangeExpired = "expired" // the balance was not paid in time
+	ChangeVoid    = "void"    // replaced by another change or dropped by a cancellation
+)
+
+// ChangeFee returns the fee per seat for moving a booking to another trip
+// (RESCHEDULE_FEE rupiah, default 25000).
+func ChangeFee() int64 {
+	if n, err := strconv.ParseInt(strings.TrimSpace(env.Get("RESCHEDULE_FEE", "")), 10, 64); err == nil && n >= 0 {
+		return n
+	}
+	return 25000
+}
+
+// RescheduleRequest moves every seat still on a booking to another departure
+// between the same stations. SeatIDs picks the new seats, one per booked seat
+// in booking order; without it free seats in the same classes are chosen.
+// Disrupted moves passengers off a train the railway delayed or cancelled:
+// see PriceDisruptedChange. It is also implied while the booking has an open
+// disruption offer.
+type RescheduleRequest struct {
+	BookingID string   `json:"-"`
+	TripID    string   `json:"trip_id"`
+	SeatIDs   []string `json:"seat_ids,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+	Disrupted bool     `json:"-"`
+}
+
+// ChangeItem moves one seat: what was paid for the old one and the fare of the new one.
+type ChangeItem struct {
+	OldItemID string `json:"old_item_id"`
+	NewItemID string `json:"new_item_id,omitempty"`
+	SeatID    string `json:"seat_id"`
+	CoachNo   int    `json:"coach_no"`
+	SeatNo    string `json:"seat_no"`
+	Class     string `json:"class"`
+	OldPaid   int64  `json:"old_paid"`
+	NewFare   int64  `json:"new_fare"`
+
+	fare Fare
+}
+
+// Change is a booking's move to another trip. Balance is the fare difference
+// plus the change fee: the customer pays a positive balance before the change
+// applies, and a negative one is refunded.
+type Change struct {
+	ID             string       `json:"id,omitempty"`
+	BookingID      string       `json:"booking_id"`
+	FromTripID     string       `json:"from_trip_id"`
+	ToTripID       string       `json:"to_trip_id"`
+	Leg            Leg          `json:"leg"`
+	Trip           TripInfo     `json:"trip"`
+	FareDifference int64        `json:"fare_difference"`
+	Fee            int64        `json:"fee"`
+	Balance        int64        `json:"balance"`
+	Status         string       `json:"status,omitempty"`
+	DueAt          *time.Time   `json:"due_at,omitempty"`
+	Waived         bool         `json:"waived,omitempty"` // free move off a disrupted train
+	Items          []ChangeItem `json:"items"`
+}
+
+// PriceChange fills in what was paid for each old seat (its share of the
+// booking total after any promo discount), the fare difference and a fee of
+// feePerSeat for every seat moved.
+func (b Booking) PriceChange(items []ChangeItem, feePerSeat int64) Change {
+	paid := map[string]int64{}
+	for _, it := range b.Items {
+		paid[it.ID] = b.paidFor(it)
+	}
+	c := Change{BookingID: b.ID, FromTripID: b.TripID, Items: items}
+	for i := range c.Items {
+		c.Items[i].OldPaid = paid[c.Items[i].OldItemID]
+		c.FareDifference += c.Items[i].NewFare - c.Items[i].OldPaid
+	}
+	c.Fee = feePerSeat * int64(len(items))
+	c.Balance = c.FareDifference + c.Fee
+	return c
+}
+
+// PriceDisruptedChange prices moving passengers off a disrupted train: there
+// is no fee and no new seat costs more than was paid for the one it
+// replaces, while a cheaper seat refunds the difference.
+func (b Booking) PriceDisruptedChange(items []ChangeItem) Change {
+	c := b.PriceChange(items, 0)
+	c.FareDifference = 0
+	for i := range c.Items {
+		it := &c.Items[i]
+		it.NewFare = min(it.NewFare, it.OldPaid)
+		c.FareDifference += it.NewFare - it.OldPaid
+	}
+	c.Balance, c.Waived = c.FareDifference, true
+	return c
+}
+
+// planChange checks that b may move to req.TripID at now and prices the move.
+// Seats are picked but not locked; Reschedule locks them.
+func planChange(ctx context.Context, db Querier, b Booking, req RescheduleRequest, now time.Time) (Change, error) {
+	if b.Status != StatusPaid {
+		return Change{}, &Error{Code: CodeNotChangeable, Message: "only paid bookings can change trains"}
+	}
+	if len(b.Legs) > 0 {
+		return Change{}, &Error{Code: CodeNotChangeable, Message: "a connecting journey cannot change trains; cancel it and book again"}
+	}
+	if !req.Disrupted && !b.Trip.Departure().After(now) {
+		return Change{}, &Error{Code: CodeNotChangeable, Message: "the train has already departed"}
+	}
+	if !ValidUUID(req.TripID) {
+		return Change{}, invalidField("trip_id", "trip_id must be a UUID")
+	}
+	if req.TripID == b.TripID {
+		return Change{}, invalidField("trip_id", "choose a different departure")
+	}
+	ti, leg, basis, err := GetTrip(ctx, db, req.TripID, b.Trip.Origin, b.Trip.Destination)
+	if err != nil {
+		if ErrorCode(err) == CodeInvalid {
+			return Change{}, invalidField("trip_id", err.Error())
+		}
+		return Change{}, err
+	}
+	if ti.Status == "cancelled" || !ti.Departure().After(now) {
+		return Change{}, invalidField("trip_id", "that departure is not open for sale")
+	}
+
+	var live []Item
+	for _, it := range b.Items {
+		if it.Status == ItemConfirmed {
+			live = append(live, it)
+		}
+	}
+	if len(live) == 0 {
+		return Change{}, &Error{Code: CodeNotChangeable, Message: "booking has no seats left"}
+	}
+	ids := dedupe(req.SeatIDs)
+	if len(ids) > 0 && len(ids) != len(live) {
+		return Change{}, invalidField("seat_ids", fmt.Sprintf("choose one seat per passenger (%d)", len(live)))
+	}
+	if !allUUIDs(ids) {
+		return Change{}, invalidField("seat_ids", "seat_ids must be UUIDs")
+	}
+	if len(ids) == 0 {
+		ride := Ride{TripID: req.TripID, TrainCode: ti.TrainCode, Origin: ti.Origin, Destination: ti.Destination, Leg: leg}
+		picked := map[string][]string{}
+		count := map[string]int{}
+		for _, it := range live {
+			count[it.Class]++
+		}
+		for class, n := range count {
+			if picked[class], err = freeSeats(ctx, db, ride, class, n); err != nil {
+				return Change{}, err
+			}
+		}
+		for _, it := range live {
+			ids = append(ids, picked[it.Class][0])
+			picked[it.Class] = picked[it.Class][1:]
+		}
+	}
+
+	type seatRow struct {
+		coach     int
+		no, class string
+	}
+	seats := map[string]seatRow{}
+	rows, err := db.Query(ctx, `SELECT id, coach_no, seat_no, class FROM seats WHERE trip_id = $1 AND id = ANY($2::UUID[])`, req.TripID, ids)
+	if err != nil {
+		return Change{}, err
+	}
+	for rows.Next() {
+		var (
+			id string
+			s  seatRow
+		)
+		if err := rows.Scan(&id, &s.coach, &s.no, &s.class); err != nil {
+			rows.Close()
+			return Change{}, err
+		}
+		seats[id] = s
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Change{}, err
+	}
+	rules, err := LoadFareRules(ctx, db)
+	if err != nil {
+		return Change{}, err
+	}
+	items := make([]ChangeItem, len(live))
+	for i, it := range live {
+		s, ok := seats[ids[i]]
+		if !ok {
+			return Change{}, &Error{Code: CodeNotFound, Message: "seat not found on this trip"}
+		}
+		category := ""
+		if it.Passenger != nil {
+			category = it.Passenger.Category
+		}
+		f := rules.Quote(basis, s.class, category)
+		items[i] = ChangeItem{OldItemID: it.ID, SeatID: ids[i], CoachNo: s.coach, SeatNo: s.no, Class: s.class, NewFare: f.Total, fare: f}
+	}
+	c := b.PriceChange(items, ChangeFee())
+	if req.Disrupted {
+		c = b.PriceDisruptedChange(items)
+	}
+	c.ToTripID, c.Leg, c.Trip = req.TripID, leg, ti
+	return c, nil
+}
+
+// QuoteReschedule prices moving a booking to another trip without changing anything.
+func QuoteReschedule(ctx context.Context, db Querier, req RescheduleRequest) (Change, error) {
+	b, err := GetBookingByID(ctx, db, req.BookingID)
+	if err != nil {
+		return Change{}, err
+	}
+	offer, err := OpenDisruption(ctx, db, b.ID)
+	if err != nil {
+		return Change{}, err
+	}
+	req.Disrupted = req.Disrupted || offer != nil
+	return planChange(ctx, db, b, req, time.Now())
+}
+
+// Reschedule moves a paid booking to another departure between the same
+// stations, keeping its code. The new seats are taken in the same
+// transaction. When the move costs nothing extra the old seats are released
+// at once and any surplus is refunded; otherwise the new seats are held
+// until the balance is paid within PaymentWindow (see ApplyChange). A change
+// still waiting for payment is replaced.
+func Reschedule(ctx context.Context, db DB, req RescheduleRequest) (Change, error) {
+	var c Change
+	if !ValidUUID(req.BookingID) {
+		return c, invalid("booking id must be a UUID")
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len(reason) > 255 {
+		return c, invalidField("reason", "reason is too long")
+	}
+	var changes []SeatChange
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		var status string
+		err := tx.QueryRow(ctx, `SELECT status FROM bookings WHERE id = $1 FOR UPDATE`, req.BookingID).Scan(&status)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &Error{Code: CodeNotFound, Message: "booking not found"}
+		}
+		if err != nil {
+			return err
+		}
+		if changes, err = voidPendingChange(ctx, tx, req.BookingID); err != nil {
+			return err
+		}
+		b, err := GetBookingByID(ctx, tx, req.BookingID)
+		if err != nil {
+			return err
+		}
+		offer, err := OpenDisruption(ctx, tx, b.ID)
+		if err != nil {
+			return err
+		}
+		req.Disrupted = req.Disrupted || offer != nil
+		if c, err = planChange(ctx, tx, b, req, time.Now()); err != nil {
+			return err
+		}
+		ids := make([]string, len(c.Items))
+		for i, it := range c.Items {
+			ids[i] = it.SeatID
+		}
+		if _, err := lockSeats(ctx, tx, c.ToTripID, ids); err != nil {
+			return err
+		}
+		if err := checkTaken(ctx, tx, ids, b.ID, c.Leg); err != nil {
+			return err
+		}
+		// Passengers the railway moved off their train go before the waitlist.
+		if !req.Disrupted {
+			if err := checkWaitlist(ctx, tx, ids, b.ID, c.Leg); err != nil {
+				return err
+			}
+		}
+
+		var due time.Time
+		if err := tx.QueryRow(ctx, `
+INSERT INTO booking_changes (booking_id, from_trip_id, to_trip_id, from_seq, to_seq, fare_difference, change_fee, balance, reason, due_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, now() + ($10::INT8 * INTERVAL '1 second'))
+RETURNING id, due_at`, b.ID, c.FromTripID, c.ToTripID, c.Leg.From, c.Leg.To, c.FareDifference, c.Fee, c.Balance, reason,
+			int64(PaymentWindow()/time.Second)).Scan(&c.ID, &due); err != nil {
+			return err
+		}
+		c.Status, c.DueAt = ChangePending, &due
+		for i := range c.Items {
+			it := &c.Items[i]
+			if err := tx.QueryRow(ctx, `
+INSERT INTO booking_items (booking_id, seat_id, price, fare_breakdown, status, held_until, from_seq, to_seq)
+VALUES ($1, $2, $3, $4::JSONB, 'held', $5, $6, $7)
+ON CONFLICT (booking_id, seat_id) DO UPDATE SET status = 'held', price = excluded.price, fare_breakdown = excluded.fare_breakdown,
+    held_until = excluded.held_until, from_seq = excluded.from_seq, to_seq = excluded.to_seq, cancelled_at = NULL
+RETURNING id`, b.ID, it.SeatID, it.NewFare, it.fare.json(), due, c.Leg.From, c.Leg.To).Scan(&it.NewItemID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `
+INSERT INTO passengers (booking_item_id, full_name, id_type, id_number, category)
+SELECT $2, full_name, id_type, id_number, category FROM passengers WHERE booking_item_id = $1
+ON CONFLICT (booking_item_id) DO UPDATE
+SET full_name = excluded.full_name, id_type = excluded.id_type, id_number = excluded.id_number,
+    category = excluded.category, updated_at = now()`, it.OldItemID, it.NewItemID); err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `
+INSERT INTO booking_change_items (change_id, old_item_id, new_item_id, old_paid, new_fare) VALUES ($1, $2, $3, $4, $5)`,
+				c.ID, it.OldItemID, it.NewItemID, it.OldPaid, it.NewFare); err != nil {
+				return err
+			}
+		}
+		if c.Balance > 0 {
+			changes = append(changes, SeatChange{TripID: c.ToTripID, SeatIDs: ids, Status: SeatHeld})
+			return recordHistory(ctx, tx, b.ID, EventChangeRequested, changeDetail(c))
+		}
+		applied, err := applyChange(ctx, tx, c.ID)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, applied...)
+		c.Status, c.DueAt = ChangeApplied, nil
+		if offer != nil {
+			dep := c.Trip.Departure()
+			return closeDisruptionOffer(ctx, tx, offer.ID, OutcomeMoved, c.ToTripID, &dep, -c.Balance)
+		}
+		return nil
+	})
+	if err == nil {
+		seatsFreed()
+		announceSeats(changes)
+	}
+	return c, err
+}
+
+func changeDetail(c Change) map[string]any {
+	return map[string]any{"change_id": c.ID, "from_trip_id": c.FromTripID, "to_trip_id": c.ToTripID,
+		"fare_difference": c.FareDifference, "fee": c.Fee, "balance": c.Balance}
+}
+
+// ApplyChange completes a trip change whose balance was paid: the held seats
+// on the new trip are confirmed, the old seats go back to inventory and the
+// booking moves to the new trip. A change that expired, was replaced or lost
+// its held seats returns not_pending or hold_expired so the payment can be
+// refunded instead.
+func ApplyChange(ctx context.Context, db DB, changeID string) error {
+	var changes []SeatChange
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		var err error
+		changes, err = applyChange(ctx, tx, changeID)
+		return err
+	})
+	if err == nil {
+		AnnounceSeats(changes)
+	}
+	return err
+}
+
+// ApplyChangeTx is ApplyChange inside the caller's transaction. It works in a
+// savepoint, so a change that can no longer apply leaves tx as it was, and
+// returns the booked and released seats for AnnounceSeats once tx has
+// committed.
+func ApplyChangeTx(ctx context.Context, tx pgx.Tx, changeID string) ([]SeatChange, error) {
+	var changes []SeatChange
+	err := pgx.BeginFunc(ctx, tx, func(sp pgx.Tx) error {
+		var err error
+		changes, err = applyChange(ctx, sp, changeID)
+		return err
+	})
+	return changes, err
+}
+
+// applyChange applies a paid change and returns the seats it booked and released.
+func applyChange(ctx context.Context, tx pgx.Tx, changeID string) ([]SeatChange, error) {
+	var (
+		c      Change
+		status string
+	)
+	err := tx.QueryRow(ctx, `
+SELECT booking_id, from_trip_id, to_trip_id, from_seq, to_seq, fare_difference::INT8, change_fee::INT8, balance::INT8, status
+FROM booking_changes WHERE id = $1 FOR UPDATE`, changeID).Scan(&c.BookingID, &c.FromTripID, &c.ToTripID, &c.Leg.From, &c.Leg.To,
+		&c.FareDifference, &c.Fee, &c.Balance, &c.Status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, &Error{Code: CodeNotFound, Message: "trip change not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.ID = changeID
+	if c.Status != ChangePending {
+		return nil, &Error{Code: CodeNotPending, Message: "trip change is " + c.Status}
+	}
+	if err := tx.QueryRow(ctx, `SELECT status FROM bookings WHERE id = $1 FOR UPDATE`, c.BookingID).Scan(&status); err != nil {
+		return nil, err
+	}
+	if status != StatusPaid {
+		return nil, &Error{Code: CodeNotPending, Message: "booking is " + status}
+	}
+
+	var olds, news []string
+	rows, err := tx.Query(ctx, `SELECT old_item_id, new_item_id FROM booking_change_items WHERE change_id = $1`, changeID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var o, n string
+		if err := rows.Scan(&o, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		olds, news = append(olds, o), append(news, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	booked, err := updateSeats(ctx, tx, SeatBooked, `
+UPDATE booking_items SET status = 'confirmed', held_until = NULL
+WHERE id = ANY($1::UUID[]) AND status = 'held' AND held_until > now()
+RETURNING seat_id`, news)
+	if err != nil {
+		return nil, err
+	}
+	if int(countSeats(booked)) != len(news) {
+		return nil, &Error{Code: CodeHoldExpired, Message: "the seats on the new train were released, please change again"}
+	}
+	released, err := updateSeats(ctx, tx, SeatReleased, `UPDATE booking_items SET status = 'rescheduled' WHERE id = ANY($1::UUID[]) AND status = 'confirmed' RETURNING seat_id`, olds)
+	if err != nil {
+		return nil, err
+	}
+	if int(countSeats(released)) != len(olds) {
+		return nil, &Error{Code: CodeNotPending, Message: "the booking's seats changed after the trip change was requested"}
+	}
+	// The new seats are paid in full, so no promo discount is left to share out.
+	if _, err := tx.Exec(ctx, `
+UPDATE bookings SET trip_id = $2, from_seq = $3, to_seq = $4, discount_total = 0,
+       total_price = total_price + GREATEST($5::INT8, 0)
+WHERE id = $1`, c.BookingID, c.ToTripID, c.Leg.From, c.Leg.To, c.Balance); err != nil {
+		return nil, err
+	}
+	if c.Balance < 0 {
+		if _, err := tx.Exec(ctx, `INSERT INTO refunds (booking_id, amount, reason) VALUES ($1, $2, 'fare difference after a trip change')`,
+			c.BookingID, -c.Balance); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(ctx, `UPDATE booking_changes SET status = 'applied', applied_at = now() WHERE id = $1`, changeID); err != nil {
+		return nil, err
+	}
+	return append(booked, released...), recordHistory(ctx, tx, c.BookingID, EventRescheduled, changeDetail(c))
+}
+
+// voidPendingChange drops a change of the booking still waiting for payment
+// and releases its held seats, which it returns.
+func voidPendingChange(ctx context.Context, tx pgx.Tx, bookingID string) ([]SeatChange, error) {
+	if _, err := tx.Exec(ctx, `UPDATE booking_changes SET status = 'void' WHERE booking_id = $1 AND status = 'pending'`, bookingID); err != nil {
+		return nil, err
+	}
+	return updateSeats(ctx, tx, SeatReleased, `
+UPDATE booking_items SET status = 'released', held_until = NULL
+WHERE status = 'held' AND id IN (
+    SELECT ci.new_item_id FROM booking_change_items ci JOIN booking_changes c ON c.id = ci.change_id
+    WHERE c.booking_id = $1 AND c.status = 'void')
+RETURNING seat_id`, bookingID)
+}
+
+// ExpireChanges expires trip changes whose balance was not paid by their
+// deadline and releases the seats they held. It returns their ids.
+func ExpireChanges(ctx context.Context, db DB) ([]string, error) {
+	var (
+		ids     []string
+		changes []SeatChange
+	)
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		ids = ids[:0]
+		var bookings []string
+		rows, err := tx.Query(ctx, `UPDATE booking_changes SET status = 'expired' WHERE status = 'pending' AND due_at <= now() RETURNING id, booking_id`)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id, b string
+			if err := rows.Scan(&id, &b); err != nil {
+				rows.Close()
+				return err
+			}
+			ids, bookings = append(ids, id), append(bookings, b)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil || len(ids) == 0 {
+			return err
+		}
+		if changes, err = updateSeats(ctx, tx, SeatReleased, `
+UPDATE booking_items SET status = 'expired'
+WHERE status = 'held' AND id IN (SELECT new_item_id FROM booking_change_items WHERE change_id = ANY($1::UUID[]))
+RETURNING seat_id`, ids); err != nil {
+			return err
+		}
+		for i, id := range ids {
+			if err := recordHistory(ctx, tx, bookings[i], EventChangeExpired, map[string]any{"change_id": id}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if len(ids) > 0 {
+		seatsFreed()
+	}
+	if err == nil {
+		announceSeats(changes)
+	}
+	return ids, err
+}
+
+// PendingChange returns the booking's trip change waiting for payment, or nil.
+func PendingChange(ctx context.Context, db Querier, b Booking) (*Change, error) {
+	c := Change{BookingID: b.ID}
+	var due time.Time
+	err := db.QueryRow(ctx, `
+SELECT id, from_trip_id, to_trip_id, fare_difference::INT8, change_fee::INT8, balance::INT8, status, due_at
+FROM booking_changes WHERE booking_id = $1 AND status = 'pending'`, b.ID).Scan(&c.ID, &c.FromTripID, &c.ToTripID,
+		&c.FareDifference, &c.Fee, &c.Balance, &c.Status, &due)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.DueAt = &due
+	if c.Trip, c.Leg, _, err = GetTrip(ctx, db, c.ToTripID, b.Trip.Origin, b.Trip.Destination); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(ctx, `
+SELECT ci.old_item_id, ci.new_item_id, bi.seat_id, s.coach_no, s.seat_no, s.class, ci.old_paid::INT8, ci.new_fare::INT8
+FROM booking_change_items ci
+JOIN booking_items bi ON bi.id = ci.new_item_id
+JOIN seats s ON s.id = bi.seat_id
+WHERE ci.change_id = $1
+ORDER BY s.coach_no, s.seat_no`, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var it ChangeItem
+		if err := rows.Scan(&it.OldItemID, &it.NewItemID, &it.SeatID, &it.CoachNo, &it.SeatNo, &it.Class, &it.OldPaid, &it.NewFare); err != nil {
+			return nil, err
+		}
+		c.Items = append(c.Items, it)
+	}
+	return &c, rows.Err()
+}
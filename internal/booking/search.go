@@ -0,0 +1,202 @@
+package booking
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gothicforge3/internal/env"
+)
+
+// SearchQuery describes a trip search between two stations on a service date.
+type SearchQuery struct {
+	Origin      string    // station code, e.g. GMR
+	Destination string    // station code, e.g. BD
+	Date        time.Time // service date (local date, time part ignored)
+	Passengers  int
+	Class       string // optional class filter; empty means all classes
+}
+
+// ClassAvailability is the remaining inventory and fare for one class on a trip.
+type ClassAvailability struct {
+	Class     string `json:"class"`
+	SeatsLeft int    `json:"seats_left"`
+	Price     int64  `json:"price"`
+	Bookable  bool   `json:"bookable"`
+}
+
+// TripResult is one trip matching a SearchQuery.
+type TripResult struct {
+	TripID          string              `json:"trip_id"`
+	TrainCode       string              `json:"train_code"`
+	TrainName       string              `json:"train_name"`
+	Origin          string              `json:"origin"`
+	OriginName      string              `json:"origin_name"`
+	Destination     string              `json:"destination"`
+	DestinationName string              `json:"destination_name"`
+	ServiceDate     string              `json:"service_date"`
+	Depart          string              `json:"depart"`
+	Arrive          string              `json:"arrive"`
+	Status          string              `json:"status"`
+	BasePrice       int64               `json:"base_price"`
+	Leg             Leg                 `json:"leg"`
+	Classes         []ClassAvailability `json:"classes"`
+}
+
+// MaxPassengers returns the per-booking passenger cap (MAX_PASSENGERS_PER_BOOKING, default 10).
+func MaxPassengers() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(env.Get("MAX_PASSENGERS_PER_BOOKING", ""))); err == nil && n > 0 {
+		return n
+	}
+	return 10
+}
+
+// ParseSearchQuery reads and validates from, to, date, pax and class parameters.
+func ParseSearchQuery(v url.Values) (SearchQuery, error) {
+	q := SearchQuery{
+		Origin:      strings.ToUpper(strings.TrimSpace(v.Get("from"))),
+		Destination: strings.ToUpper(strings.TrimSpace(v.Get("to"))),
+		Class:       strings.ToLower(strings.TrimSpace(v.Get("class"))),
+		Passengers:  1,
+	}
+	if q.Origin == "" || q.Destination == "" {
+		return q, invalid("from and to station codes are required")
+	}
+	if q.Origin == q.Destination {
+		return q, invalid("from and to must be different stations")
+	}
+	ds := strings.TrimSpace(v.Get("date"))
+	if ds == "" {
+		return q, invalid("date is required (YYYY-MM-DD)")
+	}
+	d, err := time.Parse("2006-01-02", ds)
+	if err != nil {
+		return q, invalid("date must be YYYY-MM-DD")
+	}
+	q.Date = d
+	if ps := strings.TrimSpace(v.Get("pax")); ps != "" {
+		n, err := strconv.Atoi(ps)
+		if err != nil || n < 1 {
+			return q, invalid("pax must be a positive number")
+		}
+		if n > MaxPassengers() {
+			return q, invalid("pax exceeds the maximum passengers per booking")
+		}
+		q.Passengers = n
+	}
+	if q.Class != "" && !ValidClass(q.Class) {
+		return q, invalid("unknown class: " + q.Class)
+	}
+	return q, nil
+}
+
+// Search returns trips that call at the origin on q.Date and later at the
+// destination, with seats left per class on that leg: a seat sold on another
+// leg that does not overlap still counts as free. Cancelled trips are
+// excluded. Results are ordered by departure time from the origin, and
+// classes are priced for an adult with the fare rules.
+func Search(ctx context.Context, db Querier, q SearchQuery) ([]TripResult, error) {
+	rules, err := LoadFareRules(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(ctx, `
+SELECT t.id, tr.code, tr.name, so.code, so.name, sd.code, sd.name,
+       t.service_date + a.day_offset, a.depart_time::TEXT, b.arrive_time::TEXT, t.status, t.base_price::INT8,
+       a.seq, b.seq, b.distance_km::FLOAT8 - a.distance_km::FLOAT8, km.total::FLOAT8,
+       s.class, COUNT(DISTINCT s.id) - COUNT(DISTINCT bi.seat_id) AS seats_left
+FROM trips t
+JOIN trip_stops a ON a.trip_id = t.id
+JOIN stations so ON so.id = a.station_id
+JOIN trip_stops b ON b.trip_id = t.id AND b.seq > a.seq
+JOIN stations sd ON sd.id = b.station_id
+JOIN (SELECT trip_id, MAX(distance_km) - MIN(distance_km) AS total FROM trip_stops GROUP BY trip_id) km ON km.trip_id = t.id
+JOIN trains tr ON tr.id = t.train_id
+JOIN seats s ON s.trip_id = t.id
+LEFT JOIN booking_items bi ON bi.seat_id = s.id AND `+liveItem+` AND `+overlapsLeg("a.seq", "b.seq")+`
+WHERE so.code = $1 AND sd.code = $2
+  AND t.service_date BETWEEN $3::DATE - 2 AND $3::DATE AND t.service_date + a.day_offset = $3::DATE
+  AND t.status <> 'cancelled'
+  AND ($4::TEXT = '' OR s.class = $4::TEXT)
+GROUP BY t.id, tr.code, tr.name, so.code, so.name, sd.code, sd.name, t.service_date, a.day_offset,
+         a.depart_time, b.arrive_time, t.status, t.base_price, a.seq, b.seq, a.distance_km, b.distance_km, km.total, s.class
+ORDER BY a.depart_time, t.id, s.class`, q.Origin, q.Destination, q.Date, q.Class)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]TripResult, 0, 8)
+	idx := map[string]int{}
+	bases := map[string]FareBasis{}
+	for rows.Next() {
+		var (
+			tr        TripResult
+			date      time.Time
+			class     string
+			left      int
+			depart    string
+			arrive    string
+			basePrice int64
+			km, total float64
+		)
+		if err := rows.Scan(&tr.TripID, &tr.TrainCode, &tr.TrainName, &tr.Origin, &tr.OriginName,
+			&tr.Destination, &tr.DestinationName, &date, &depart, &arrive, &tr.Status, &basePrice,
+			&tr.Leg.From, &tr.Leg.To, &km, &total, &class, &left); err != nil {
+			return nil, err
+		}
+		i, ok := idx[tr.TripID]
+		if !ok {
+			tr.ServiceDate = date.Format("2006-01-02")
+			tr.Depart = hhmm(depart)
+			tr.Arrive = hhmm(arrive)
+			tr.BasePrice = prorate(basePrice, km, total)
+			bases[tr.TripID] = FareBasis{Base: tr.BasePrice, KM: km, Date: date}
+			out = append(out, tr)
+			i = len(out) - 1
+			idx[tr.TripID] = i
+		}
+		out[i].Classes = append(out[i].Classes, ClassAvailability{
+			Class:     class,
+			SeatsLeft: left,
+			Price:     rules.Quote(bases[tr.TripID], class, "").Total,
+			Bookable:  left >= q.Passengers,
+		})
+	}
+	return out, rows.Err()
+}
+
+// hhmm trims a TIME text value ("07:00:00") to "07:00".
+func hhmm(s string) string {
+	if len(s) >= 5 {
+		return s[:5]
+	}
+	return s
+}
+
+// Station is an active station offered in search forms.
+type Station struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+	City string `json:"city"`
+}
+
+// ListStations returns active stations ordered by name.
+func ListStations(ctx context.Context, db Querier) ([]Station, error) {
+	rows, err := db.Query(ctx, `SELECT code, name, COALESCE(city, '') FROM stations WHERE active ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]Station, 0, 16)
+	for rows.Next() {
+		var s Station
+		if err := rows.Scan(&s.Code, &s.Name, &s.City); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
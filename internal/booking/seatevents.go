@@ -0,0 +1,115 @@
+package booking
+
+import (
+	"context"
+	"sync"
+)
+
+// SeatReleased is announced for seats back on sale. Seats taken are
+// announced as SeatHeld or SeatBooked.
+const SeatReleased = "released"
+
+// SeatChange tells live seat maps that seats of a trip changed status.
+// Availability is per leg, so listeners should reload the seats of the legs
+// they show rather than trust Status for every station pair.
+type SeatChange struct {
+	TripID  string   `json:"trip_id"`
+	SeatIDs []string `json:"seat_ids"`
+	Status  string   `json:"status"`
+}
+
+var seatListeners struct {
+	sync.RWMutex
+	fns []func(SeatChange)
+}
+
+// OnSeatChange registers f to be called after every committed seat status
+// change. f runs on the goroutine that made the change and should return
+// quickly.
+func OnSeatChange(f func(SeatChange)) {
+	seatListeners.Lock()
+	defer seatListeners.Unlock()
+	seatListeners.fns = append(seatListeners.fns, f)
+}
+
+// announceSeats tells the listeners about changes once they are committed.
+func announceSeats(changes []SeatChange) {
+	seatListeners.RLock()
+	fns := seatListeners.fns
+	seatListeners.RUnlock()
+	for _, c := range changes {
+		if len(c.SeatIDs) == 0 {
+			continue
+		}
+		for _, f := range fns {
+			f(c)
+		}
+	}
+}
+
+// AnnounceSeats reports changes made by a caller's own transaction, such as
+// ExpireBookingTx or ApplyChangeTx, after it committed. Released seats also
+// wake the waitlist.
+func AnnounceSeats(changes []SeatChange) {
+	for _, c := range changes {
+		if c.Status == SeatReleased && len(c.SeatIDs) > 0 {
+			seatsFreed()
+			break
+		}
+	}
+	announceSeats(changes)
+}
+
+// seatChanges groups seats by trip into changes to status.
+func seatChanges(status string, tripSeats [][2]string) []SeatChange {
+	idx := map[string]int{}
+	var out []SeatChange
+	for _, ts := range tripSeats {
+		i, ok := idx[ts[0]]
+		if !ok {
+			out = append(out, SeatChange{TripID: ts[0], Status: status})
+			i = len(out) - 1
+			idx[ts[0]] = i
+		}
+		out[i].SeatIDs = append(out[i].SeatIDs, ts[1])
+	}
+	return out
+}
+
+// itemChanges groups the items' seats by trip into changes to status.
+func itemChanges(status string, items []Item) []SeatChange {
+	var ts [][2]string
+	for _, it := range items {
+		ts = append(ts, [2]string{it.TripID, it.SeatID})
+	}
+	return seatChanges(status, ts)
+}
+
+// updateSeats runs update, an UPDATE of booking_items ending in RETURNING
+// seat_id, and returns the seats it touched as changes to status.
+func updateSeats(ctx context.Context, db Querier, status, update string, args ...any) ([]SeatChange, error) {
+	rows, err := db.Query(ctx, `WITH changed AS (`+update+`)
+SELECT s.trip_id::TEXT, s.id::TEXT FROM changed JOIN seats s ON s.id = changed.seat_id ORDER BY s.trip_id, s.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ts [][2]string
+	for rows.Next() {
+		var t, s string
+		if err := rows.Scan(&t, &s); err != nil {
+			return nil, err
+		}
+		ts = append(ts, [2]string{t, s})
+	}
+	return seatChanges(status, ts), rows.Err()
+}
+
+// countSeats is the number of seats in changes.
+func countSeats(changes []SeatChange) int64 {
+	var n int64
+	for _, c := range changes {
+		n += int64(len(c.SeatIDs))
+	}
+	return n
+}
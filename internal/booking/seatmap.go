@@ -0,0 +1,205 @@
+package booking
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Seat states shown on the seat map.
+const (
+	SeatAvailable  = "available"
+	SeatAccessible = "accessible" // available and flagged is_accessible
+	SeatHeld       = "held"       // held by someone else
+	SeatMine       = "mine"       // held by the viewer
+	SeatBooked     = "booked"
+)
+
+// SeatCell is one seat positioned on its coach grid (1-based row/col).
+type SeatCell struct {
+	ID         string `json:"id"`
+	No         string `json:"seat_no"`
+	Row        int    `json:"row"`
+	Col        int    `json:"col"`
+	Accessible bool   `json:"accessible"`
+	State      string `json:"state"`
+}
+
+// Coach is one carriage with its seats laid out on a rows x cols grid.
+type Coach struct {
+	No     int        `json:"coach_no"`
+	Class  string     `json:"class"`
+	Layout string     `json:"layout_code"`
+	Rows   int        `json:"rows"`
+	Cols   int        `json:"cols"`
+	Seats  []SeatCell `json:"seats"`
+	Free   int        `json:"free"`
+}
+
+// SeatMap is every coach of a trip with per-seat state for one leg, as seen
+// by one holder. A seat is free when nobody holds it on any segment of the leg.
+type SeatMap struct {
+	TripID    string     `json:"trip_id"`
+	Trip      TripInfo   `json:"trip"`
+	Leg       Leg        `json:"leg"`
+	BasePrice int64      `json:"base_price"`
+	Coaches   []Coach    `json:"coaches"`
+	Held      []HeldSeat `json:"held"`
+	HeldUntil time.Time  `json:"held_until"`
+}
+
+// LoadSeatMap builds the seat map of a trip's leg between two station codes
+// (empty for the whole trip) for holder, optionally limited to one class.
+// BasePrice is the leg's share of the trip's base price.
+func LoadSeatMap(ctx context.Context, db Querier, tripID, from, to, class, holder string) (SeatMap, error) {
+	sm := SeatMap{TripID: tripID}
+	trip, leg, base, err := GetTrip(ctx, db, tripID, from, to)
+	if err != nil {
+		return sm, err
+	}
+	sm.Trip, sm.Leg, sm.BasePrice = trip, leg, base.Base
+
+	rows, err := db.Query(ctx, `
+SELECT c.coach_no, c.class, c.layout_code, c.rows, c.cols,
+       s.id, s.seat_no, s.is_accessible,
+       COALESCE((
+           SELECT CASE WHEN bi.status = 'confirmed' THEN 'booked' WHEN b.user_ref = $3 AND NOT b.journey THEN 'mine' ELSE 'held' END
+           FROM booking_items bi JOIN bookings b ON b.id = bi.booking_id
+           WHERE bi.seat_id = s.id AND `+liveItem+` AND `+overlapsLeg("$4", "$5")+`
+           ORDER BY bi.status = 'confirmed' DESC, (b.user_ref = $3 AND NOT b.journey) DESC
+           LIMIT 1), '')
+FROM coaches c
+JOIN seats s ON s.trip_id = c.trip_id AND s.coach_no = c.coach_no
+WHERE c.trip_id = $1 AND ($2::TEXT = '' OR c.class = $2::TEXT)
+ORDER BY c.coach_no, s.seat_no`, tripID, class, holder, leg.From, leg.To)
+	if err != nil {
+		return sm, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			c     Coach
+			cell  SeatCell
+			taken string
+		)
+		if err := rows.Scan(&c.No, &c.Class, &c.Layout, &c.Rows, &c.Cols, &cell.ID, &cell.No, &cell.Accessible, &taken); err != nil {
+			return sm, err
+		}
+		if n := len(sm.Coaches); n == 0 || sm.Coaches[n-1].No != c.No {
+			sm.Coaches = append(sm.Coaches, c)
+		}
+		coach := &sm.Coaches[len(sm.Coaches)-1]
+		cell.State = seatState(taken, cell.Accessible)
+		if cell.State == SeatAvailable || cell.State == SeatAccessible {
+			coach.Free++
+		}
+		coach.Seats = append(coach.Seats, cell)
+	}
+	if err := rows.Err(); err != nil {
+		return sm, err
+	}
+	for i := range sm.Coaches {
+		PlaceSeats(&sm.Coaches[i])
+	}
+	if holder != "" {
+		held, err := ListHolds(ctx, db, holder, tripID)
+		if err != nil {
+			return sm, err
+		}
+		sm.Held = held
+		if len(held) > 0 {
+			sm.HeldUntil = held[0].HeldUntil
+		}
+	}
+	return sm, nil
+}
+
+func seatState(taken string, accessible bool) string {
+	switch taken {
+	case "booked":
+		return SeatBooked
+	case "mine":
+		return SeatMine
+	case "held":
+		return SeatHeld
+	}
+	if accessible {
+		return SeatAccessible
+	}
+	return SeatAvailable
+}
+
+// PlaceSeats assigns grid positions. Seat numbers of the form "RR-C" (as in the
+// seed data, e.g. "07-3") map directly to row and column; other seats fill the
+// remaining cells left to right, top to bottom.
+func PlaceSeats(c *Coach) {
+	if c.Cols <= 0 {
+		c.Cols = 4
+	}
+	used := map[[2]int]bool{}
+	var loose []int
+	for i := range c.Seats {
+		r, col, ok := parseSeatNo(c.Seats[i].No)
+		if !ok || col > c.Cols || used[[2]int{r, col}] {
+			loose = append(loose, i)
+			continue
+		}
+		c.Seats[i].Row, c.Seats[i].Col = r, col
+		used[[2]int{r, col}] = true
+		if r > c.Rows {
+			c.Rows = r
+		}
+	}
+	next := 0
+	for _, i := range loose {
+		for used[[2]int{next/c.Cols + 1, next%c.Cols + 1}] {
+			next++
+		}
+		c.Seats[i].Row, c.Seats[i].Col = next/c.Cols+1, next%c.Cols+1
+		used[[2]int{c.Seats[i].Row, c.Seats[i].Col}] = true
+		if c.Seats[i].Row > c.Rows {
+			c.Rows = c.Seats[i].Row
+		}
+	}
+	sort.Slice(c.Seats, func(i, j int) bool {
+		if c.Seats[i].Row != c.Seats[j].Row {
+			return c.Seats[i].Row < c.Seats[j].Row
+		}
+		return c.Seats[i].Col < c.Seats[j].Col
+	})
+}
+
+func parseSeatNo(no string) (row, col int, ok bool) {
+	a, b, found := strings.Cut(no, "-")
+	if !found {
+		return 0, 0, false
+	}
+	r, err1 := strconv.Atoi(a)
+	c, err2 := strconv.Atoi(b)
+	if err1 != nil || err2 != nil || r < 1 || c < 1 {
+		return 0, 0, false
+	}
+	return r, c, true
+}
+
+// AisleAfter returns the column numbers followed by an aisle for a layout code
+// such as "2-2" (aisle after column 2) or "2-1" / "3-2". Unknown layouts have no aisle.
+func AisleAfter(layout string) []int {
+	parts := strings.Split(layout, "-")
+	if len(parts) < 2 {
+		return nil
+	}
+	out := make([]int, 0, len(parts)-1)
+	col := 0
+	for _, p := range parts[:len(parts)-1] {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 1 {
+			return nil
+		}
+		col += n
+		out = append(out, col)
+	}
+	return out
+}
@@ -0,0 +1,168 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Stop is one call of a trip at a station, in travel order. Arrive is empty
+// at the first stop and Depart at the last. DayOffset counts the midnights
+// since the trip's service date; DistanceKM is measured from the first stop.
+type Stop struct {
+	Seq         int     `json:"seq"`
+	Station     string  `json:"station"`
+	StationName string  `json:"station_name"`
+	Arrive      string  `json:"arrive,omitempty"`
+	Depart      string  `json:"depart,omitempty"`
+	DayOffset   int     `json:"day_offset"`
+	DistanceKM  float64 `json:"distance_km"`
+}
+
+// Leg is the part of a trip a passenger rides, from stop From to stop To (by
+// seq). A seat sold for a leg is taken on the segments between those stops
+// only, so legs that do not overlap can be sold on the same seat.
+type Leg struct {
+	From int `json:"from_seq"`
+	To   int `json:"to_seq"`
+}
+
+// Overlaps reports whether two legs share at least one segment.
+func (l Leg) Overlaps(o Leg) bool { return l.From < o.To && o.From < l.To }
+
+// overlapsLeg is the booking_items predicate for an item sharing a segment
+// with the leg in parameters $from and $to.
+func overlapsLeg(from, to string) string {
+	return `(bi.from_seq < ` + to + ` AND bi.to_seq > ` + from + `)`
+}
+
+// TripStops loads the stops of a trip in order.
+func TripStops(ctx context.Context, db Querier, tripID string) ([]Stop, error) {
+	rows, err := db.Query(ctx, `
+SELECT ts.seq, s.code, s.name, COALESCE(ts.arrive_time::TEXT, ''), COALESCE(ts.depart_time::TEXT, ''),
+       ts.day_offset, ts.distance_km::FLOAT8
+FROM trip_stops ts JOIN stations s ON s.id = ts.station_id
+WHERE ts.trip_id = $1
+ORDER BY ts.seq`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]Stop, 0, 4)
+	for rows.Next() {
+		var s Stop
+		if err := rows.Scan(&s.Seq, &s.Station, &s.StationName, &s.Arrive, &s.Depart, &s.DayOffset, &s.DistanceKM); err != nil {
+			return nil, err
+		}
+		s.Arrive, s.Depart = hhmm(s.Arrive), hhmm(s.Depart)
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// FindLeg picks the leg between two station codes. Empty codes mean the
+// first and last stop. A station the trip does not call at, or one the train
+// reaches only after the other, is a bad request.
+func FindLeg(stops []Stop, from, to string) (Leg, error) {
+	if len(stops) < 2 {
+		return Leg{}, &Error{Code: CodeNotFound, Message: "trip has no stops"}
+	}
+	from, to = strings.ToUpper(strings.TrimSpace(from)), strings.ToUpper(strings.TrimSpace(to))
+	leg := Leg{From: -1, To: -1}
+	for _, s := range stops {
+		if leg.From < 0 && (from == "" || s.Station == from) {
+			leg.From = s.Seq
+		}
+		if leg.From >= 0 && s.Seq > leg.From && (s.Station == to || to == "") {
+			leg.To = s.Seq
+			if to != "" {
+				break
+			}
+		}
+	}
+	if leg.From < 0 || leg.To < 0 {
+		return Leg{}, invalid("this train does not run from " + orAny(from, "its first stop") + " to " + orAny(to, "its last stop"))
+	}
+	return leg, nil
+}
+
+func orAny(code, fallback string) string {
+	if code == "" {
+		return fallback
+	}
+	return code
+}
+
+// stopAt returns the stop with the given seq.
+func stopAt(stops []Stop, seq int) Stop {
+	for _, s := range stops {
+		if s.Seq == seq {
+			return s
+		}
+	}
+	return Stop{Seq: seq}
+}
+
+// LegFare prorates a trip's base price by the distance of a leg, rounded up
+// to whole thousands of rupiah. Without distances the whole price applies.
+func LegFare(stops []Stop, leg Leg, base int64) int64 {
+	if len(stops) == 0 {
+		return base
+	}
+	total := stops[len(stops)-1].DistanceKM - stops[0].DistanceKM
+	return prorate(base, stopAt(stops, leg.To).DistanceKM-stopAt(stops, leg.From).DistanceKM, total)
+}
+
+func prorate(base int64, km, total float64) int64 {
+	if total <= 0 || km <= 0 || km >= total {
+		return base
+	}
+	fare := int64(math.Ceil(float64(base)*km/total/1000)) * 1000
+	return min(fare, base)
+}
+
+// legInfo describes a leg of a trip for display: its end stations and times,
+// and the date the passenger boards.
+func legInfo(ti *TripInfo, stops []Stop, leg Leg, serviceDate time.Time) {
+	a, b := stopAt(stops, leg.From), stopAt(stops, leg.To)
+	ti.Origin, ti.OriginName, ti.Depart = a.Station, a.StationName, a.Depart
+	ti.Destination, ti.DestinationName, ti.Arrive = b.Station, b.StationName, b.Arrive
+	ti.ServiceDate = serviceDate.AddDate(0, 0, a.DayOffset).Format("2006-01-02")
+}
+
+// GetTrip loads a trip's summary for the leg between two station codes (empty
+// codes for the whole trip), the leg itself and what its fares are based on.
+func GetTrip(ctx context.Context, db Querier, tripID, from, to string) (TripInfo, Leg, FareBasis, error) {
+	var (
+		ti   TripInfo
+		base int64
+		date time.Time
+	)
+	if !ValidUUID(tripID) {
+		return ti, Leg{}, FareBasis{}, invalid("trip must be a UUID")
+	}
+	err := db.QueryRow(ctx, `
+SELECT tr.code, tr.name, t.service_date, t.status, t.base_price::INT8
+FROM trips t JOIN trains tr ON tr.id = t.train_id
+WHERE t.id = $1`, tripID).Scan(&ti.TrainCode, &ti.TrainName, &date, &ti.Status, &base)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ti, Leg{}, FareBasis{}, &Error{Code: CodeNotFound, Message: "trip not found"}
+	}
+	if err != nil {
+		return ti, Leg{}, FareBasis{}, err
+	}
+	stops, err := TripStops(ctx, db, tripID)
+	if err != nil {
+		return ti, Leg{}, FareBasis{}, err
+	}
+	leg, err := FindLeg(stops, from, to)
+	if err != nil {
+		return ti, Leg{}, FareBasis{}, err
+	}
+	legInfo(&ti, stops, leg, date)
+	return ti, leg, legBasis(stops, leg, base, date), nil
+}
@@ -0,0 +1,437 @@
+package booking
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/env"
+)
+
+// Waitlist entry statuses.
+const (
+	WaitWaiting   = "waiting"   // in the queue
+	WaitOffered   = "offered"   // seats held for the customer until offer_until
+	WaitFulfilled = "fulfilled" // the offered seats were checked out
+	WaitExpired   = "expired"   // the offer lapsed or the trip closed
+	WaitLeft      = "cancelled" // the customer left the queue
+)
+
+// WaitlistOfferTTL returns how long seats offered to a waitlisted customer
+// stay held for them (WAITLIST_OFFER_MINUTES, default 15).
+func WaitlistOfferTTL() time.Duration {
+	if n, err := strconv.Atoi(strings.TrimSpace(env.Get("WAITLIST_OFFER_MINUTES", ""))); err == nil && n > 0 {
+		return time.Duration(n) * time.Minute
+	}
+	return 15 * time.Minute
+}
+
+// WaitlistRequest joins the waitlist for Seats seats of a class on a trip's
+// leg between station codes From and To (empty for the whole trip).
+type WaitlistRequest struct {
+	Holder string `json:"-"`
+	TripID string `json:"trip_id"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Class  string `json:"class"`
+	Seats  int    `json:"pax"`
+	Email  string `json:"email"`
+}
+
+// WaitlistEntry is a customer's place in the queue for a class on a trip.
+// Position counts from 1 among the entries still waiting.
+type WaitlistEntry struct {
+	ID         string     `json:"id"`
+	TripID     string     `json:"trip_id"`
+	From       string     `json:"from"`
+	To         string     `json:"to"`
+	Trip       TripInfo   `json:"trip"`
+	Class      string     `json:"class"`
+	Seats      int        `json:"pax"`
+	Email      string     `json:"email"`
+	Status     string     `json:"status"`
+	Position   int        `json:"position,omitempty"`
+	OfferUntil *time.Time `json:"offer_until,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	userRef string
+}
+
+// WaitlistOffer tells a customer that seats were held for them.
+type WaitlistOffer struct {
+	UserRef string
+	Entry   WaitlistEntry
+	seatIDs []string
+}
+
+// Notifier reaches customers outside the site. The waitlist uses it to
+// announce offers and the disruption workflow to tell passengers what
+// happened to their train; a failed notification is logged and the offer or
+// outcome stands.
+type Notifier interface {
+	NotifyOffer(ctx context.Context, o WaitlistOffer) error
+	NotifyDisruption(ctx context.Context, n DisruptionNotice) error
+}
+
+// LogNotifier writes notifications to the server log.
+type LogNotifier struct{}
+
+// NotifyOffer implements Notifier.
+func (LogNotifier) NotifyOffer(_ context.Context, o WaitlistOffer) error {
+	e := o.Entry
+	log.Printf("waitlist: %d %s seats on %s %s→%s %s held for %s until %s", e.Seats, e.Class, e.Trip.TrainCode, e.From, e.To,
+		e.Trip.ServiceDate, e.Email, e.OfferUntil.Local().Format("15:04"))
+	return nil
+}
+
+// NotifyDisruption implements Notifier.
+func (LogNotifier) NotifyDisruption(_ context.Context, n DisruptionNotice) error {
+	d, b := n.Disruption, n.Booking
+	log.Printf("disruption: %s %s %s: booking %s (%s) %s, refund %d", d.Trip.TrainCode, d.Trip.ServiceDate, d.Kind, b.Code,
+		b.Contact.Email, b.Outcome, b.Refund)
+	return nil
+}
+
+// freed signals that seats went back to inventory in this process.
+var freed = make(chan struct{}, 1)
+
+// Freed receives after seats went back to inventory, so the server can run
+// ProcessWaitlist right away instead of at its next scheduled run.
+func Freed() <-chan struct{} { return freed }
+
+// seatsFreed wakes the receiver of Freed without blocking.
+func seatsFreed() {
+	select {
+	case freed <- struct{}{}:
+	default:
+	}
+}
+
+// waitlistCols selects a WaitlistEntry from waitlist w joined to its leg's
+// stops fs/ts and stations so/sd.
+const waitlistCols = `w.id, w.trip_id, so.code, sd.code, w.class, w.seats, w.email, w.status, w.offer_until, w.created_at, w.user_ref,
+       CASE WHEN w.status = 'waiting' THEN (SELECT COUNT(*) FROM waitlist o WHERE o.trip_id = w.trip_id AND o.class = w.class
+           AND o.status = 'waiting' AND (o.created_at, o.id) <= (w.created_at, w.id)) ELSE 0 END::INT8`
+
+const waitlistFrom = `waitlist w
+JOIN trip_stops fs ON fs.trip_id = w.trip_id AND fs.seq = w.from_seq
+JOIN stations so ON so.id = fs.station_id
+JOIN trip_stops ts ON ts.trip_id = w.trip_id AND ts.seq = w.to_seq
+JOIN stations sd ON sd.id = ts.station_id`
+
+func scanWaitlist(row pgx.Row) (WaitlistEntry, error) {
+	var (
+		e   WaitlistEntry
+		pos int64
+	)
+	err := row.Scan(&e.ID, &e.TripID, &e.From, &e.To, &e.Class, &e.Seats, &e.Email, &e.Status, &e.OfferUntil, &e.CreatedAt, &e.userRef, &pos)
+	e.Position = int(pos)
+	return e, err
+}
+
+// JoinWaitlist queues the holder for seats that are sold out. Seats still on
+// sale have to be booked instead. Joining again while already queued for the
+// same class of the trip returns the existing entry and keeps its place.
+func JoinWaitlist(ctx context.Context, db DB, req WaitlistRequest) (WaitlistEntry, error) {
+	var e WaitlistEntry
+	req.Class = strings.ToLower(strings.TrimSpace(req.Class))
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if strings.TrimSpace(req.Holder) == "" {
+		return e, invalid("holder is required")
+	}
+	if !ValidClass(req.Class) {
+		return e, invalidField("class", "unknown class: "+req.Class)
+	}
+	if req.Seats < 1 || req.Seats > MaxPassengers() {
+		return e, invalidField("pax", "pax must be between 1 and "+strconv.Itoa(MaxPassengers()))
+	}
+	if a, err := mail.ParseAddress(req.Email); err != nil || a.Address != req.Email {
+		return e, invalidField("email", "a valid email is required to tell you when seats free up")
+	}
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		ti, leg, _, err := GetTrip(ctx, tx, req.TripID, req.From, req.To)
+		if err != nil {
+			return err
+		}
+		if ti.Status == "cancelled" || !ti.Departure().After(time.Now()) {
+			return invalid("trip is not open for sale")
+		}
+		e, err = scanWaitlist(tx.QueryRow(ctx, `SELECT `+waitlistCols+` FROM `+waitlistFrom+`
+WHERE w.user_ref = $1 AND w.trip_id = $2 AND w.class = $3 AND w.status IN ('waiting', 'offered')`, req.Holder, req.TripID, req.Class))
+		if err == nil {
+			e.Trip = ti
+			return nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		var total, queued int
+		if err := tx.QueryRow(ctx, `
+SELECT (SELECT COUNT(*) FROM seats WHERE trip_id = $1 AND class = $2),
+       (SELECT COUNT(*) FROM waitlist w WHERE w.trip_id = $1 AND w.class = $2 AND w.status = 'waiting' AND w.from_seq < $4 AND w.to_seq > $3)`,
+			req.TripID, req.Class, leg.From, leg.To).Scan(&total, &queued); err != nil {
+			return err
+		}
+		if total < req.Seats {
+			return invalidField("class", "this train has no "+req.Class+" seats for "+strconv.Itoa(req.Seats))
+		}
+		if queued == 0 {
+			_, err := freeSeats(ctx, tx, Ride{TripID: req.TripID, TrainCode: ti.TrainCode, Origin: ti.Origin, Destination: ti.Destination, Leg: leg}, req.Class, req.Seats)
+			if err == nil {
+				return invalidField("class", "seats are still available, book them instead")
+			}
+			if ErrorCode(err) != CodeSeatUnavailable {
+				return err
+			}
+		}
+
+		var id string
+		if err := tx.QueryRow(ctx, `
+INSERT INTO waitlist (trip_id, from_seq, to_seq, class, seats, user_ref, email) VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id`, req.TripID, leg.From, leg.To, req.Class, req.Seats, req.Holder, req.Email).Scan(&id); err != nil {
+			return err
+		}
+		if e, err = scanWaitlist(tx.QueryRow(ctx, `SELECT `+waitlistCols+` FROM `+waitlistFrom+` WHERE w.id = $1`, id)); err != nil {
+			return err
+		}
+		e.Trip = ti
+		return nil
+	})
+	return e, err
+}
+
+// ListWaitlist returns the holder's waitlist entries, newest first.
+func ListWaitlist(ctx context.Context, db Querier, holder string) ([]WaitlistEntry, error) {
+	rows, err := db.Query(ctx, `SELECT `+waitlistCols+` FROM `+waitlistFrom+`
+WHERE w.user_ref = $1 ORDER BY w.created_at DESC LIMIT 50`, holder)
+	if err != nil {
+		return nil, err
+	}
+	out := []WaitlistEntry{}
+	for rows.Next() {
+		e, err := scanWaitlist(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		if out[i].Trip, _, _, err = GetTrip(ctx, db, out[i].TripID, out[i].From, out[i].To); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// LeaveWaitlist takes the holder off a waitlist entry. Seats already offered
+// to them are released for the next customer.
+func LeaveWaitlist(ctx context.Context, db DB, holder, id string) error {
+	if !ValidUUID(id) {
+		return invalid("id must be a UUID")
+	}
+	var changes []SeatChange
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		var (
+			status string
+			cartID *string
+		)
+		err := tx.QueryRow(ctx, `SELECT status, booking_id FROM waitlist WHERE id = $1 AND user_ref = $2 FOR UPDATE`, id, holder).Scan(&status, &cartID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &Error{Code: CodeNotFound, Message: "waitlist entry not found"}
+		}
+		if err != nil {
+			return err
+		}
+		if status != WaitWaiting && status != WaitOffered {
+			return &Error{Code: CodeNotPending, Message: "waitlist entry is " + status}
+		}
+		if _, err := tx.Exec(ctx, `UPDATE waitlist SET status = 'cancelled', updated_at = now() WHERE id = $1`, id); err != nil {
+			return err
+		}
+		if status != WaitOffered || cartID == nil {
+			return nil
+		}
+		changes, err = updateSeats(ctx, tx, SeatReleased, `
+UPDATE booking_items SET status = 'released', held_until = NULL
+WHERE status = 'held' AND booking_id IN (SELECT id FROM bookings WHERE id = $1 AND status = 'hold')
+RETURNING seat_id`, *cartID)
+		return err
+	})
+	if err == nil {
+		seatsFreed()
+		announceSeats(changes)
+	}
+	return err
+}
+
+// checkWaitlist fails with seat_unavailable when customers other than the
+// cart's holder are waiting for the class of one of the locked seats on an
+// overlapping leg: seats that come free go to the waitlist first.
+func checkWaitlist(ctx context.Context, tx pgx.Tx, seatIDs []string, cartID string, leg Leg) error {
+	var class string
+	err := tx.QueryRow(ctx, `
+SELECT s.class FROM seats s
+JOIN waitlist w ON w.trip_id = s.trip_id AND w.class = s.class AND w.status = 'waiting'
+WHERE s.id = ANY($1) AND w.from_seq < $4 AND w.to_seq > $3
+  AND w.user_ref <> (SELECT user_ref FROM bookings WHERE id = $2)
+LIMIT 1`, seatIDs, cartID, leg.From, leg.To).Scan(&class)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &Error{Code: CodeSeatUnavailable, Message: "freed " + class + " seats on this train go to customers on the waitlist first"}
+}
+
+// ProcessWaitlist closes offers that were checked out or lapsed, expires
+// entries for trips that left or were cancelled, and offers free seats to
+// waiting customers. Each trip and class is served in one transaction that
+// locks its whole queue, so entries are served strictly oldest first even
+// with several workers: when the oldest entry does not fit yet, nobody behind
+// it is offered seats, and checkWaitlist keeps the freed seats off sale until
+// enough have come back for it. It returns the offers made, after notifying
+// each customer through n.
+func ProcessWaitlist(ctx context.Context, db DB, n Notifier) ([]WaitlistOffer, error) {
+	if _, err := db.Exec(ctx, `
+UPDATE waitlist SET status = 'fulfilled', updated_at = now()
+WHERE status = 'offered' AND booking_id IN (SELECT id FROM bookings WHERE status <> 'hold')`); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(ctx, `
+UPDATE waitlist SET status = 'expired', updated_at = now()
+WHERE (status = 'offered' AND offer_until <= now())
+   OR (status = 'waiting' AND trip_id IN (SELECT id FROM trips WHERE status = 'cancelled' OR service_date < current_date))`); err != nil {
+		return nil, err
+	}
+
+	type queue struct{ trip, class string }
+	var queues []queue
+	rows, err := db.Query(ctx, `SELECT DISTINCT trip_id::TEXT, class FROM waitlist WHERE status = 'waiting'`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var q queue
+		if err := rows.Scan(&q.trip, &q.class); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		queues = append(queues, q)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var offers []WaitlistOffer
+	for _, q := range queues {
+		var made []WaitlistOffer
+		err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+			var err error
+			made, err = offerSeats(ctx, tx, q.trip, q.class)
+			return err
+		})
+		if err != nil {
+			return offers, err
+		}
+		for _, o := range made {
+			announceSeats([]SeatChange{{TripID: o.Entry.TripID, SeatIDs: o.seatIDs, Status: SeatHeld}})
+			if err := n.NotifyOffer(ctx, o); err != nil {
+				log.Printf("waitlist: notifying %s about entry %s failed: %v", o.Entry.Email, o.Entry.ID, err)
+			}
+		}
+		offers = append(offers, made...)
+	}
+	return offers, nil
+}
+
+// noCart stands in for a cart when checking seats before the customer's cart is picked.
+const noCart = "00000000-0000-0000-0000-000000000000"
+
+// offerSeats serves the queue for one class of a trip.
+func offerSeats(ctx context.Context, tx pgx.Tx, tripID, class string) ([]WaitlistOffer, error) {
+	rows, err := tx.Query(ctx, `SELECT `+waitlistCols+` FROM `+waitlistFrom+`
+WHERE w.trip_id = $1 AND w.class = $2 AND w.status = 'waiting'
+ORDER BY w.created_at, w.id
+FOR UPDATE OF w`, tripID, class)
+	if err != nil {
+		return nil, err
+	}
+	var queue []WaitlistEntry
+	for rows.Next() {
+		e, err := scanWaitlist(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		queue = append(queue, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(queue) == 0 {
+		return nil, nil
+	}
+	rules, err := LoadFareRules(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	ttl := WaitlistOfferTTL()
+
+	var offers []WaitlistOffer
+	for _, e := range queue {
+		ti, leg, basis, err := GetTrip(ctx, tx, e.TripID, e.From, e.To)
+		if err != nil {
+			return offers, err
+		}
+		ids, err := freeSeats(ctx, tx, Ride{TripID: e.TripID, TrainCode: ti.TrainCode, Origin: ti.Origin, Destination: ti.Destination, Leg: leg}, class, e.Seats)
+		if ErrorCode(err) == CodeSeatUnavailable {
+			// Newer, smaller parties wait behind this one instead of
+			// starving it.
+			break
+		}
+		if err != nil {
+			return offers, err
+		}
+		seats, err := lockSeats(ctx, tx, e.TripID, ids)
+		if ErrorCode(err) == CodeInvalid {
+			return offers, nil // the trip closed; the next pass expires its queue
+		}
+		if err != nil {
+			return offers, err
+		}
+		if err := checkTaken(ctx, tx, ids, noCart, leg); err != nil {
+			return offers, err
+		}
+		cartID, err := holdCart(ctx, tx, e.userRef, e.TripID, leg)
+		if err != nil {
+			return offers, err
+		}
+		if err := holdSeats(ctx, tx, cartID, seats, leg, rules, basis, ttl); err != nil {
+			return offers, err
+		}
+		var until time.Time
+		if err := tx.QueryRow(ctx, `
+UPDATE waitlist SET status = 'offered', booking_id = $2, offer_until = now() + ($3::INT8 * INTERVAL '1 second'), updated_at = now()
+WHERE id = $1 RETURNING offer_until`, e.ID, cartID, int64(ttl/time.Second)).Scan(&until); err != nil {
+			return offers, err
+		}
+		e.Trip, e.Status, e.Position, e.OfferUntil = ti, WaitOffered, 0, &until
+		offers = append(offers, WaitlistOffer{UserRef: e.userRef, Entry: e, seatIDs: ids})
+	}
+	return offers, nil
+}
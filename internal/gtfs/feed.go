@@ -0,0 +1,362 @@
+// Package gtfs reads and writes GTFS static feeds and maps them onto the
+// timetable tables: stops → stations, routes → trains, the first and last
+// stop of each trip → routes, trips → timetable_templates with every stop
+// time in template_stops, and calendar.txt plus calendar_dates.txt →
+// service_calendars. Dated trips are then created
+// by internal/schedule like for any other template.
+//
+// Import is three steps so callers can show the outcome before writing:
+// Read and Validate the feed, FromFeed + Compare against LoadSnapshot, Apply.
+package gtfs
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Agency is a row of agency.txt.
+type Agency struct {
+	ID, Name, URL, Timezone string
+}
+
+// Stop is a row of stops.txt.
+type Stop struct {
+	ID, Name, Desc, ZoneID string
+	Lat, Lon               float64
+}
+
+// Route is a row of routes.txt. In this schema a GTFS route is a train service
+// such as "Argo Parahyangan".
+type Route struct {
+	ID, AgencyID, ShortName, LongName string
+	Type                              int
+}
+
+// Trip is a row of trips.txt.
+type Trip struct {
+	ID, RouteID, ServiceID, Headsign string
+}
+
+// StopTime is a row of stop_times.txt. Times are GTFS "HH:MM:SS" and may
+// exceed 24:00:00 for arrivals after midnight.
+type StopTime struct {
+	TripID, StopID     string
+	Arrival, Departure string
+	Seq                int
+	DistTraveled       float64 // shape_dist_traveled, km in feeds we export
+}
+
+// Calendar is a row of calendar.txt; Days runs Monday to Sunday.
+type Calendar struct {
+	ServiceID  string
+	Days       [7]bool
+	Start, End string // YYYYMMDD
+}
+
+// Exception types of calendar_dates.txt.
+const (
+	ServiceAdded   = 1
+	ServiceRemoved = 2
+)
+
+// CalendarDate is a row of calendar_dates.txt.
+type CalendarDate struct {
+	ServiceID, Date string
+	Type            int
+}
+
+// FareAttribute is a row of fare_attributes.txt.
+type FareAttribute struct {
+	ID, Currency string
+	Price        float64
+}
+
+// FareRule is a row of fare_rules.txt; origin and destination are zone IDs.
+type FareRule struct {
+	FareID, RouteID, OriginID, DestinationID string
+}
+
+// Feed is a parsed GTFS feed. Files absent from the zip are nil.
+type Feed struct {
+	Agencies       []Agency
+	Stops          []Stop
+	Routes         []Route
+	Trips          []Trip
+	StopTimes      []StopTime
+	Calendars      []Calendar
+	CalendarDates  []CalendarDate
+	FareAttributes []FareAttribute
+	FareRules      []FareRule
+
+	files    map[string]bool
+	problems []Problem // found while parsing, reported by Validate
+}
+
+// Has reports whether the feed contained the named file.
+func (f *Feed) Has(name string) bool { return f.files[name] }
+
+// ReadFile reads a GTFS zip from disk.
+func ReadFile(path string) (*Feed, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Read(bytes.NewReader(b), int64(len(b)))
+}
+
+// Read parses a GTFS zip. Files may sit at the root or in one top-level
+// folder. Malformed values do not fail the read; they become problems that
+// Validate reports with their file and line.
+func Read(r io.ReaderAt, size int64) (*Feed, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("gtfs: not a zip archive: %w", err)
+	}
+	f := &Feed{files: map[string]bool{}}
+	for _, zf := range zr.File {
+		name := zf.Name
+		if i := strings.LastIndexByte(name, '/'); i >= 0 {
+			name = name[i+1:]
+		}
+		parse, ok := parsers[name]
+		if !ok || zf.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		t, err := readTable(name, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		f.files[name] = true
+		parse(f, t)
+	}
+	return f, nil
+}
+
+// table is one CSV file with its header resolved to column indexes.
+type table struct {
+	name string
+	cols map[string]int
+	rows [][]string
+}
+
+func readTable(name string, r io.Reader) (*table, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	recs, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("gtfs: %s: %w", name, err)
+	}
+	t := &table{name: name, cols: map[string]int{}}
+	if len(recs) == 0 {
+		return t, nil
+	}
+	for i, h := range recs[0] {
+		t.cols[strings.TrimSpace(strings.TrimPrefix(h, "\uFEFF"))] = i
+	}
+	t.rows = recs[1:]
+	return t, nil
+}
+
+// get returns a trimmed field of row i, or "" when the column is missing.
+func (t *table) get(row []string, col string) string {
+	i, ok := t.cols[col]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// line is the 1-based line number of data row i (the header is line 1).
+func line(i int) int { return i + 2 }
+
+func (f *Feed) problem(t *table, i int, format string, args ...any) {
+	f.problems = append(f.problems, Problem{File: t.name, Line: line(i), Message: fmt.Sprintf(format, args...)})
+}
+
+func (f *Feed) float(t *table, i int, row []string, col string) float64 {
+	s := t.get(row, col)
+	if s == "" {
+		return 0
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		f.problem(t, i, "%s %q is not a number", col, s)
+	}
+	return v
+}
+
+func (f *Feed) int(t *table, i int, row []string, col string) int {
+	s := t.get(row, col)
+	if s == "" {
+		return 0
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		f.problem(t, i, "%s %q is not an integer", col, s)
+	}
+	return v
+}
+
+var parsers = map[string]func(*Feed, *table){
+	"agency.txt": func(f *Feed, t *table) {
+		for _, r := range t.rows {
+			f.Agencies = append(f.Agencies, Agency{ID: t.get(r, "agency_id"), Name: t.get(r, "agency_name"), URL: t.get(r, "agency_url"), Timezone: t.get(r, "agency_timezone")})
+		}
+	},
+	"stops.txt": func(f *Feed, t *table) {
+		for i, r := range t.rows {
+			f.Stops = append(f.Stops, Stop{ID: t.get(r, "stop_id"), Name: t.get(r, "stop_name"), Desc: t.get(r, "stop_desc"), ZoneID: t.get(r, "zone_id"),
+				Lat: f.float(t, i, r, "stop_lat"), Lon: f.float(t, i, r, "stop_lon")})
+		}
+	},
+	"routes.txt": func(f *Feed, t *table) {
+		for i, r := range t.rows {
+			f.Routes = append(f.Routes, Route{ID: t.get(r, "route_id"), AgencyID: t.get(r, "agency_id"), ShortName: t.get(r, "route_short_name"),
+				LongName: t.get(r, "route_long_name"), Type: f.int(t, i, r, "route_type")})
+		}
+	},
+	"trips.txt": func(f *Feed, t *table) {
+		for _, r := range t.rows {
+			f.Trips = append(f.Trips, Trip{ID: t.get(r, "trip_id"), RouteID: t.get(r, "route_id"), ServiceID: t.get(r, "service_id"), Headsign: t.get(r, "trip_headsign")})
+		}
+	},
+	"stop_times.txt": func(f *Feed, t *table) {
+		for i, r := range t.rows {
+			f.StopTimes = append(f.StopTimes, StopTime{TripID: t.get(r, "trip_id"), StopID: t.get(r, "stop_id"), Arrival: t.get(r, "arrival_time"),
+				Departure: t.get(r, "departure_time"), Seq: f.int(t, i, r, "stop_sequence"), DistTraveled: f.float(t, i, r, "shape_dist_traveled")})
+		}
+	},
+	"calendar.txt": func(f *Feed, t *table) {
+		days := []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+		for i, r := range t.rows {
+			c := Calendar{ServiceID: t.get(r, "service_id"), Start: t.get(r, "start_date"), End: t.get(r, "end_date")}
+			for d, col := range days {
+				c.Days[d] = f.int(t, i, r, col) == 1
+			}
+			f.Calendars = append(f.Calendars, c)
+		}
+	},
+	"calendar_dates.txt": func(f *Feed, t *table) {
+		for i, r := range t.rows {
+			f.CalendarDates = append(f.CalendarDates, CalendarDate{ServiceID: t.get(r, "service_id"), Date: t.get(r, "date"), Type: f.int(t, i, r, "exception_type")})
+		}
+	},
+	"fare_attributes.txt": func(f *Feed, t *table) {
+		for i, r := range t.rows {
+			f.FareAttributes = append(f.FareAttributes, FareAttribute{ID: t.get(r, "fare_id"), Currency: t.get(r, "currency_type"), Price: f.float(t, i, r, "price")})
+		}
+	},
+	"fare_rules.txt": func(f *Feed, t *table) {
+		for _, r := range t.rows {
+			f.FareRules = append(f.FareRules, FareRule{FareID: t.get(r, "fare_id"), RouteID: t.get(r, "route_id"), OriginID: t.get(r, "origin_id"), DestinationID: t.get(r, "destination_id")})
+		}
+	},
+}
+
+// required lists the files every feed has, even when empty.
+var required = map[string]bool{"agency.txt": true, "stops.txt": true, "routes.txt": true, "trips.txt": true, "stop_times.txt": true}
+
+// Write encodes the feed as a GTFS zip. Optional files without rows are omitted.
+func Write(w io.Writer, f *Feed) error {
+	zw := zip.NewWriter(w)
+	file := func(name string, header []string, n int, row func(i int) []string) error {
+		if n == 0 && !required[name] {
+			return nil
+		}
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		cw := csv.NewWriter(fw)
+		_ = cw.Write(header)
+		for i := 0; i < n; i++ {
+			_ = cw.Write(row(i))
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	ftoa := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	b01 := func(b bool) string {
+		if b {
+			return "1"
+		}
+		return "0"
+	}
+	steps := []func() error{
+		func() error {
+			return file("agency.txt", []string{"agency_id", "agency_name", "agency_url", "agency_timezone"}, len(f.Agencies), func(i int) []string {
+				a := f.Agencies[i]
+				return []string{a.ID, a.Name, a.URL, a.Timezone}
+			})
+		},
+		func() error {
+			return file("stops.txt", []string{"stop_id", "stop_name", "stop_desc", "stop_lat", "stop_lon", "zone_id"}, len(f.Stops), func(i int) []string {
+				s := f.Stops[i]
+				return []string{s.ID, s.Name, s.Desc, ftoa(s.Lat), ftoa(s.Lon), s.ZoneID}
+			})
+		},
+		func() error {
+			return file("routes.txt", []string{"route_id", "agency_id", "route_short_name", "route_long_name", "route_type"}, len(f.Routes), func(i int) []string {
+				r := f.Routes[i]
+				return []string{r.ID, r.AgencyID, r.ShortName, r.LongName, strconv.Itoa(r.Type)}
+			})
+		},
+		func() error {
+			return file("trips.txt", []string{"route_id", "service_id", "trip_id", "trip_headsign"}, len(f.Trips), func(i int) []string {
+				t := f.Trips[i]
+				return []string{t.RouteID, t.ServiceID, t.ID, t.Headsign}
+			})
+		},
+		func() error {
+			return file("stop_times.txt", []string{"trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence", "shape_dist_traveled"}, len(f.StopTimes), func(i int) []string {
+				s := f.StopTimes[i]
+				return []string{s.TripID, s.Arrival, s.Departure, s.StopID, strconv.Itoa(s.Seq), ftoa(s.DistTraveled)}
+			})
+		},
+		func() error {
+			return file("calendar.txt", []string{"service_id", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday", "start_date", "end_date"}, len(f.Calendars), func(i int) []string {
+				c := f.Calendars[i]
+				row := []string{c.ServiceID}
+				for _, d := range c.Days {
+					row = append(row, b01(d))
+				}
+				return append(row, c.Start, c.End)
+			})
+		},
+		func() error {
+			return file("calendar_dates.txt", []string{"service_id", "date", "exception_type"}, len(f.CalendarDates), func(i int) []string {
+				c := f.CalendarDates[i]
+				return []string{c.ServiceID, c.Date, strconv.Itoa(c.Type)}
+			})
+		},
+		func() error {
+			return file("fare_attributes.txt", []string{"fare_id", "price", "currency_type", "payment_method", "transfers"}, len(f.FareAttributes), func(i int) []string {
+				a := f.FareAttributes[i]
+				return []string{a.ID, ftoa(a.Price), a.Currency, "1", "0"}
+			})
+		},
+		func() error {
+			return file("fare_rules.txt", []string{"fare_id", "route_id", "origin_id", "destination_id"}, len(f.FareRules), func(i int) []string {
+				r := f.FareRules[i]
+				return []string{r.FareID, r.RouteID, r.OriginID, r.DestinationID}
+			})
+		},
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
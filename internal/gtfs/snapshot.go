@@ -0,0 +1,593 @@
+package gtfs
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gothicforge3/internal/schedule"
+)
+
+// Snapshot is timetable data in the shape of our tables, keyed by the codes
+// both sides share. It is built from a feed (FromFeed) or from the database
+// (LoadSnapshot), so the two can be compared before anything is written.
+type Snapshot struct {
+	Stations   []Station
+	Trains     []Train
+	Routes     []Line
+	Services   []Service
+	Departures []Departure
+}
+
+// Station is a stations row.
+type Station struct {
+	Code, Name, City string
+	Lat, Lon         float64
+}
+
+// Train is a trains row.
+type Train struct {
+	Code, Name, Operator string
+}
+
+// Line is a routes row (named Line to keep it apart from GTFS routes).
+type Line struct {
+	Code, Origin, Dest string
+	DistanceKM         float64
+}
+
+// Service is a service_calendars row for one train. Dates are YYYY-MM-DD.
+type Service struct {
+	ServiceID, Train string
+	Weekdays         int
+	Start, End       string
+	Removed, Added   []string
+}
+
+// Departure is a timetable_templates row with its template_stops. Times are "HH:MM:SS".
+type Departure struct {
+	TripID, Train, Route, ServiceID string
+	Depart, Arrive                  string
+	BasePrice                       int64
+	Active                          bool
+	Stops                           []Call
+}
+
+// Call is one template_stops row. Arrive is empty at the first stop and
+// Depart at the last; DistanceKM is measured from the first stop.
+type Call struct {
+	Station        string
+	Arrive, Depart string
+	DayOffset      int
+	DistanceKM     float64
+}
+
+// calls returns the departure's stops, or its route's two ends when it has none.
+func (d Departure) calls(l Line) []Call {
+	if len(d.Stops) >= 2 {
+		return d.Stops
+	}
+	last := Call{Station: l.Dest, Arrive: d.Arrive, DistanceKM: l.DistanceKM}
+	if d.Arrive < d.Depart {
+		last.DayOffset = 1
+	}
+	return []Call{{Station: l.Origin, Depart: d.Depart}, last}
+}
+
+// Key is the departure's identity, matching the unique (train, route, depart_time).
+func (d Departure) Key() string { return d.Train + " " + d.Route + " " + d.Depart }
+
+func (s Service) key() string { return s.ServiceID + "@" + s.Train }
+
+// FromFeed maps a validated feed onto a snapshot. Departures without a
+// matching fare rule cost defaultPrice.
+func FromFeed(f *Feed, defaultPrice int64) Snapshot {
+	var s Snapshot
+	stops := map[string]Stop{}
+	for _, st := range f.Stops {
+		stops[st.ID] = st
+		s.Stations = append(s.Stations, Station{Code: st.ID, Name: st.Name, City: st.Desc, Lat: st.Lat, Lon: st.Lon})
+	}
+	agencies := map[string]string{}
+	for _, a := range f.Agencies {
+		agencies[a.ID] = a.Name
+	}
+	for _, r := range f.Routes {
+		name := r.LongName
+		if name == "" {
+			name = r.ShortName
+		}
+		op := agencies[r.AgencyID]
+		if op == "" && len(f.Agencies) == 1 {
+			op = f.Agencies[0].Name
+		}
+		s.Trains = append(s.Trains, Train{Code: r.ID, Name: name, Operator: op})
+	}
+
+	byTrip := map[string][]int{}
+	for i, st := range f.StopTimes {
+		byTrip[st.TripID] = append(byTrip[st.TripID], i)
+	}
+	calendars := map[string]Calendar{}
+	for _, c := range f.Calendars {
+		calendars[c.ServiceID] = c
+	}
+	dates := map[string][]CalendarDate{}
+	for _, d := range f.CalendarDates {
+		dates[d.ServiceID] = append(dates[d.ServiceID], d)
+	}
+	price := fareLookup(f, defaultPrice)
+
+	lines := map[string]bool{}
+	services := map[string]bool{}
+	for _, t := range f.Trips {
+		sts := ordered(f, byTrip[t.ID])
+		if len(sts) < 2 {
+			continue
+		}
+		first, last := sts[0], sts[len(sts)-1]
+		calls := buildCalls(sts, stops)
+		code := first.StopID + "-" + last.StopID
+		if !lines[code] {
+			lines[code] = true
+			s.Routes = append(s.Routes, Line{Code: code, Origin: first.StopID, Dest: last.StopID, DistanceKM: calls[len(calls)-1].DistanceKM})
+		}
+		svc := Service{ServiceID: t.ServiceID, Train: t.RouteID}
+		if !services[svc.key()] {
+			services[svc.key()] = true
+			s.Services = append(s.Services, buildService(svc, calendars[t.ServiceID], dates[t.ServiceID]))
+		}
+		s.Departures = append(s.Departures, Departure{
+			TripID: t.ID, Train: t.RouteID, Route: code, ServiceID: t.ServiceID,
+			Depart: NormalizeTime(first.Departure), Arrive: NormalizeTime(last.Arrival),
+			BasePrice: price(t.RouteID, zone(stops[first.StopID]), zone(stops[last.StopID])), Active: true,
+			Stops: calls,
+		})
+	}
+	s.sort()
+	return s
+}
+
+// buildCalls turns a trip's ordered stop times into calls. Distances come
+// from shape_dist_traveled when the feed has them, otherwise from the
+// straight line between consecutive stops.
+func buildCalls(sts []StopTime, stops map[string]Stop) []Call {
+	first, last := sts[0], sts[len(sts)-1]
+	useShape := last.DistTraveled > first.DistTraveled
+	start, _ := ParseTime(first.Departure)
+	calls := make([]Call, len(sts))
+	var km float64
+	for k, st := range sts {
+		c := Call{Station: st.StopID}
+		at := st.Departure
+		if k > 0 {
+			c.Arrive = NormalizeTime(st.Arrival)
+		}
+		if k < len(sts)-1 {
+			c.Depart = NormalizeTime(st.Departure)
+		} else {
+			at = st.Arrival
+		}
+		if secs, err := ParseTime(at); err == nil {
+			c.DayOffset = secs/86400 - start/86400
+		}
+		switch {
+		case useShape:
+			km = st.DistTraveled - first.DistTraveled
+		case k > 0:
+			a, b := stops[sts[k-1].StopID], stops[st.StopID]
+			km += haversineKM(a.Lat, a.Lon, b.Lat, b.Lon)
+		}
+		c.DistanceKM = math.Round(km*10) / 10
+		calls[k] = c
+	}
+	return calls
+}
+
+func buildService(svc Service, c Calendar, dates []CalendarDate) Service {
+	for d, on := range c.Days {
+		if on {
+			svc.Weekdays |= 1 << d // Days and weekday_flags both start on Monday
+		}
+	}
+	svc.Start, svc.End = isoDate(c.Start), isoDate(c.End)
+	for _, d := range dates {
+		day := isoDate(d.Date)
+		if d.Type == ServiceAdded {
+			svc.Added = append(svc.Added, day)
+		} else {
+			svc.Removed = append(svc.Removed, day)
+		}
+		// A service defined only by calendar_dates spans its dates.
+		if c.ServiceID == "" {
+			if svc.Start == "" || day < svc.Start {
+				svc.Start = day
+			}
+			if day > svc.End {
+				svc.End = day
+			}
+		}
+	}
+	sort.Strings(svc.Added)
+	sort.Strings(svc.Removed)
+	return svc
+}
+
+func zone(st Stop) string {
+	if st.ZoneID != "" {
+		return st.ZoneID
+	}
+	return st.ID
+}
+
+// fareLookup resolves fare_rules from most to least specific:
+// route and zones, zones only, route only.
+func fareLookup(f *Feed, def int64) func(route, origin, dest string) int64 {
+	prices := map[string]int64{}
+	for _, a := range f.FareAttributes {
+		prices[a.ID] = int64(math.Round(a.Price))
+	}
+	rules := map[string]int64{}
+	for _, r := range f.FareRules {
+		k := r.RouteID + "|" + r.OriginID + "|" + r.DestinationID
+		if _, dup := rules[k]; !dup {
+			rules[k] = prices[r.FareID]
+		}
+	}
+	return func(route, origin, dest string) int64 {
+		for _, k := range []string{route + "|" + origin + "|" + dest, "|" + origin + "|" + dest, route + "||"} {
+			if p, ok := rules[k]; ok && p > 0 {
+				return p
+			}
+		}
+		return def
+	}
+}
+
+func haversineKM(lat1, lon1, lat2, lon2 float64) float64 {
+	const r = 6371.0
+	rad := math.Pi / 180
+	dLat, dLon := (lat2-lat1)*rad, (lon2-lon1)*rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * r * math.Asin(math.Sqrt(a))
+}
+
+// isoDate turns YYYYMMDD into YYYY-MM-DD; gtfsDate does the reverse.
+func isoDate(s string) string {
+	if len(s) != 8 {
+		return ""
+	}
+	return s[:4] + "-" + s[4:6] + "-" + s[6:]
+}
+
+func gtfsDate(s string) string { return strings.ReplaceAll(s, "-", "") }
+
+func (s *Snapshot) sort() {
+	sort.Slice(s.Stations, func(i, j int) bool { return s.Stations[i].Code < s.Stations[j].Code })
+	sort.Slice(s.Trains, func(i, j int) bool { return s.Trains[i].Code < s.Trains[j].Code })
+	sort.Slice(s.Routes, func(i, j int) bool { return s.Routes[i].Code < s.Routes[j].Code })
+	sort.Slice(s.Services, func(i, j int) bool { return s.Services[i].key() < s.Services[j].key() })
+	sort.Slice(s.Departures, func(i, j int) bool { return s.Departures[i].Key() < s.Departures[j].Key() })
+}
+
+// ToFeed maps a snapshot onto a GTFS feed. Each departure becomes a trip
+// with one stop time per call; stations get their code as zone_id so fare
+// rules can price each train between its route's ends (the first
+// departure's price wins). Inactive departures are skipped.
+func ToFeed(s Snapshot) *Feed {
+	f := &Feed{files: map[string]bool{}}
+	operators := map[string]string{}
+	for _, t := range s.Trains {
+		op := t.Operator
+		if op == "" {
+			op = "KAI"
+		}
+		if _, ok := operators[op]; !ok {
+			id := strings.ToUpper(strings.ReplaceAll(op, " ", "_"))
+			operators[op] = id
+			f.Agencies = append(f.Agencies, Agency{ID: id, Name: op, URL: "https://www.kai.id", Timezone: "Asia/Jakarta"})
+		}
+		f.Routes = append(f.Routes, Route{ID: t.Code, AgencyID: operators[op], ShortName: t.Code, LongName: t.Name, Type: 2})
+	}
+	for _, st := range s.Stations {
+		f.Stops = append(f.Stops, Stop{ID: st.Code, Name: st.Name, Desc: st.City, ZoneID: st.Code, Lat: st.Lat, Lon: st.Lon})
+	}
+	lines := map[string]Line{}
+	for _, l := range s.Routes {
+		lines[l.Code] = l
+	}
+	written := map[string]bool{}
+	for _, svc := range s.Services {
+		if written[svc.ServiceID] {
+			continue // same calendar on several trains
+		}
+		written[svc.ServiceID] = true
+		c := Calendar{ServiceID: svc.ServiceID, Start: gtfsDate(svc.Start), End: gtfsDate(svc.End)}
+		for d := range c.Days {
+			c.Days[d] = svc.Weekdays&(1<<d) != 0
+		}
+		f.Calendars = append(f.Calendars, c)
+		for _, d := range svc.Added {
+			f.CalendarDates = append(f.CalendarDates, CalendarDate{ServiceID: svc.ServiceID, Date: gtfsDate(d), Type: ServiceAdded})
+		}
+		for _, d := range svc.Removed {
+			f.CalendarDates = append(f.CalendarDates, CalendarDate{ServiceID: svc.ServiceID, Date: gtfsDate(d), Type: ServiceRemoved})
+		}
+	}
+	fares := map[int64]bool{}
+	ruled := map[string]bool{}
+	for _, d := range s.Departures {
+		if !d.Active {
+			continue
+		}
+		l := lines[d.Route]
+		id := d.TripID
+		if id == "" {
+			id = d.Train + "-" + d.Route + "-" + strings.ReplaceAll(d.Depart[:5], ":", "")
+		}
+		f.Trips = append(f.Trips, Trip{ID: id, RouteID: d.Train, ServiceID: d.ServiceID})
+		prev := 0
+		for k, c := range d.calls(l) {
+			st := StopTime{TripID: id, StopID: c.Station, Seq: k + 1, DistTraveled: c.DistanceKM}
+			arrive, depart := c.Arrive, c.Depart
+			if arrive == "" {
+				arrive = depart
+			}
+			if depart == "" {
+				depart = arrive
+			}
+			st.Arrival, prev = serviceTime(prev, arrive)
+			st.Departure, prev = serviceTime(prev, depart)
+			f.StopTimes = append(f.StopTimes, st)
+		}
+		fareID := "IDR" + strconv.FormatInt(d.BasePrice, 10)
+		if !fares[d.BasePrice] {
+			fares[d.BasePrice] = true
+			f.FareAttributes = append(f.FareAttributes, FareAttribute{ID: fareID, Currency: "IDR", Price: float64(d.BasePrice)})
+		}
+		if rk := d.Train + "|" + l.Origin + "|" + l.Dest; !ruled[rk] {
+			ruled[rk] = true
+			f.FareRules = append(f.FareRules, FareRule{FareID: fareID, RouteID: d.Train, OriginID: l.Origin, DestinationID: l.Dest})
+		}
+	}
+	for _, name := range []string{"agency.txt", "stops.txt", "routes.txt", "trips.txt", "stop_times.txt", "calendar.txt"} {
+		f.files[name] = true
+	}
+	return f
+}
+
+// serviceTime writes a TIME as a GTFS time no earlier than prev (seconds
+// since the start of the service day), so times after midnight count on past
+// 24:00:00. It returns the time and its seconds.
+func serviceTime(prev int, t string) (string, int) {
+	secs, err := ParseTime(t)
+	if err != nil {
+		return t, prev
+	}
+	for secs < prev {
+		secs += 24 * 3600
+	}
+	return fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs/60%60, secs%60), secs
+}
+
+// Change is one difference between the database and a feed.
+type Change struct {
+	Op      string // "+" add, "~" update, "-" deactivate
+	Kind    string // station, train, route, calendar, departure
+	Key     string
+	Details []string
+}
+
+func (c Change) String() string {
+	s := c.Op + " " + c.Kind + " " + c.Key
+	if len(c.Details) > 0 {
+		s += "  (" + strings.Join(c.Details, "; ") + ")"
+	}
+	return s
+}
+
+// Diff is what an import would change.
+type Diff struct {
+	Changes   []Change
+	Unchanged int
+	Kept      int // rows in the database but not in the feed, left alone
+}
+
+// Count returns the number of changes with the given op.
+func (d Diff) Count(op string) int {
+	n := 0
+	for _, c := range d.Changes {
+		if c.Op == op {
+			n++
+		}
+	}
+	return n
+}
+
+// Compare lists what applying next over cur would change. Stations, trains,
+// routes and calendars missing from the feed are kept (bookings refer to
+// them); with prune, departures imported from an earlier feed and missing
+// from this one are deactivated.
+func Compare(cur, next Snapshot, prune bool) Diff {
+	var d Diff
+	add := func(op, kind, key string, details ...string) {
+		d.Changes = append(d.Changes, Change{Op: op, Kind: kind, Key: key, Details: details})
+	}
+	field := func(out *[]string, name string, a, b any) {
+		if fmt.Sprint(a) != fmt.Sprint(b) {
+			*out = append(*out, fmt.Sprintf("%s: %v → %v", name, a, b))
+		}
+	}
+
+	stations := map[string]Station{}
+	for _, x := range cur.Stations {
+		stations[x.Code] = x
+	}
+	for _, n := range next.Stations {
+		o, ok := stations[n.Code]
+		if !ok {
+			add("+", "station", n.Code, n.Name)
+			continue
+		}
+		var ch []string
+		field(&ch, "name", o.Name, n.Name)
+		field(&ch, "city", o.City, n.City)
+		if math.Abs(o.Lat-n.Lat) > 1e-6 || math.Abs(o.Lon-n.Lon) > 1e-6 {
+			ch = append(ch, fmt.Sprintf("position: %v,%v → %v,%v", o.Lat, o.Lon, n.Lat, n.Lon))
+		}
+		d.record("station", n.Code, ch)
+		delete(stations, n.Code)
+	}
+	d.Kept += len(stations)
+
+	trains := map[string]Train{}
+	for _, x := range cur.Trains {
+		trains[x.Code] = x
+	}
+	for _, n := range next.Trains {
+		o, ok := trains[n.Code]
+		if !ok {
+			add("+", "train", n.Code, n.Name)
+			continue
+		}
+		var ch []string
+		field(&ch, "name", o.Name, n.Name)
+		field(&ch, "operator", o.Operator, n.Operator)
+		d.record("train", n.Code, ch)
+		delete(trains, n.Code)
+	}
+	d.Kept += len(trains)
+
+	lines := map[string]Line{}
+	for _, x := range cur.Routes {
+		lines[x.Code] = x
+	}
+	for _, n := range next.Routes {
+		o, ok := lines[n.Code]
+		if !ok {
+			add("+", "route", n.Code, fmt.Sprintf("%.1f km", n.DistanceKM))
+			continue
+		}
+		var ch []string
+		field(&ch, "distance_km", o.DistanceKM, n.DistanceKM)
+		d.record("route", n.Code, ch)
+		delete(lines, n.Code)
+	}
+	d.Kept += len(lines)
+
+	services := map[string]Service{}
+	for _, x := range cur.Services {
+		services[x.key()] = x
+	}
+	for _, n := range next.Services {
+		o, ok := services[n.key()]
+		if !ok {
+			add("+", "calendar", n.key(), fmt.Sprintf("%s..%s", n.Start, n.End))
+			continue
+		}
+		var ch []string
+		field(&ch, "weekdays", weekdayString(o.Weekdays), weekdayString(n.Weekdays))
+		field(&ch, "start", o.Start, n.Start)
+		field(&ch, "end", o.End, n.End)
+		field(&ch, "removed", o.Removed, n.Removed)
+		field(&ch, "added", o.Added, n.Added)
+		d.record("calendar", n.key(), ch)
+		delete(services, n.key())
+	}
+	d.Kept += len(services)
+
+	deps := map[string]Departure{}
+	for _, x := range cur.Departures {
+		deps[x.Key()] = x
+	}
+	for _, n := range next.Departures {
+		o, ok := deps[n.Key()]
+		if !ok {
+			details := []string{"arrive " + n.Arrive, "calendar " + n.ServiceID, "Rp " + strconv.FormatInt(n.BasePrice, 10)}
+			if len(n.Stops) > 2 {
+				details = append(details, "stops "+callString(n.Stops))
+			}
+			add("+", "departure", n.Key(), details...)
+			continue
+		}
+		var ch []string
+		if !o.Active {
+			ch = append(ch, "reactivated")
+		}
+		field(&ch, "arrive", o.Arrive, n.Arrive)
+		field(&ch, "calendar", o.ServiceID, n.ServiceID)
+		field(&ch, "price", o.BasePrice, n.BasePrice)
+		field(&ch, "trip_id", o.TripID, n.TripID)
+		l := routeOf(next, n.Route)
+		field(&ch, "stops", callString(o.calls(routeOf(cur, o.Route))), callString(n.calls(l)))
+		d.record("departure", n.Key(), ch)
+		delete(deps, n.Key())
+	}
+	for _, o := range deps {
+		if prune && o.Active && o.TripID != "" {
+			add("-", "departure", o.Key(), "not in feed, deactivated")
+		} else if o.Active {
+			d.Kept++
+		}
+	}
+	sort.SliceStable(d.Changes, func(i, j int) bool {
+		if d.Changes[i].Kind != d.Changes[j].Kind {
+			return kindOrder[d.Changes[i].Kind] < kindOrder[d.Changes[j].Kind]
+		}
+		return d.Changes[i].Key < d.Changes[j].Key
+	})
+	return d
+}
+
+// callString summarizes a stop pattern, e.g. "GMR 08:00 › SMT 13:20/13:25 437km › SGU 16:45 725km".
+func callString(calls []Call) string {
+	parts := make([]string, len(calls))
+	for i, c := range calls {
+		var times []string
+		for _, t := range []string{c.Arrive, c.Depart} {
+			if len(t) >= 5 {
+				times = append(times, t[:5])
+			}
+		}
+		parts[i] = c.Station + " " + strings.Join(times, "/")
+		if i > 0 {
+			parts[i] += fmt.Sprintf(" %gkm", c.DistanceKM)
+		}
+	}
+	return strings.Join(parts, " › ")
+}
+
+func routeOf(s Snapshot, code string) Line {
+	for _, l := range s.Routes {
+		if l.Code == code {
+			return l
+		}
+	}
+	return Line{Code: code}
+}
+
+var kindOrder = map[string]int{"station": 0, "train": 1, "route": 2, "calendar": 3, "departure": 4}
+
+func (d *Diff) record(kind, key string, details []string) {
+	if len(details) == 0 {
+		d.Unchanged++
+		return
+	}
+	d.Changes = append(d.Changes, Change{Op: "~", Kind: kind, Key: key, Details: details})
+}
+
+func weekdayString(flags int) string {
+	const names = "MTWTFSS"
+	b := []byte("-------")
+	for i := range b {
+		if flags&(1<<i) != 0 {
+			b[i] = names[i]
+		}
+	}
+	return string(b)
+}
+
+// DefaultConsist is used for departures a feed adds; GTFS does not describe coaches.
+var DefaultConsist = []schedule.CoachSpec{{Class: "economy", Layout: "2-2", Rows: 15, Cols: 4, Count: 6}}
@@ -0,0 +1,294 @@
+package gtfs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/schedule"
+)
+
+// LoadSnapshot reads the timetable tables. Calendars without a service_id get
+// "cal-<id>" so they can be exported; departures without their own calendar
+// are attached to the first calendar of their train.
+func LoadSnapshot(ctx context.Context, db booking.Querier) (Snapshot, error) {
+	var s Snapshot
+	rows, err := db.Query(ctx, `SELECT code, name, COALESCE(city, ''), COALESCE(lat, 0)::FLOAT8, COALESCE(lon, 0)::FLOAT8 FROM stations`)
+	if err != nil {
+		return s, err
+	}
+	for rows.Next() {
+		var x Station
+		if err := rows.Scan(&x.Code, &x.Name, &x.City, &x.Lat, &x.Lon); err != nil {
+			rows.Close()
+			return s, err
+		}
+		s.Stations = append(s.Stations, x)
+	}
+	rows.Close()
+
+	rows, err = db.Query(ctx, `SELECT code, name, COALESCE(operator, '') FROM trains`)
+	if err != nil {
+		return s, err
+	}
+	for rows.Next() {
+		var x Train
+		if err := rows.Scan(&x.Code, &x.Name, &x.Operator); err != nil {
+			rows.Close()
+			return s, err
+		}
+		s.Trains = append(s.Trains, x)
+	}
+	rows.Close()
+
+	rows, err = db.Query(ctx, `
+SELECT r.route_code, so.code, sd.code, COALESCE(r.distance_km, 0)::FLOAT8
+FROM routes r
+JOIN stations so ON so.id = r.origin_station_id
+JOIN stations sd ON sd.id = r.dest_station_id`)
+	if err != nil {
+		return s, err
+	}
+	for rows.Next() {
+		var x Line
+		if err := rows.Scan(&x.Code, &x.Origin, &x.Dest, &x.DistanceKM); err != nil {
+			rows.Close()
+			return s, err
+		}
+		s.Routes = append(s.Routes, x)
+	}
+	rows.Close()
+
+	rows, err = db.Query(ctx, `
+SELECT c.id, COALESCE(c.service_id, ''), t.code, c.weekday_flags, c.start_date, c.end_date, COALESCE(c.exceptions::TEXT, '')
+FROM service_calendars c
+JOIN trains t ON t.id = c.train_id
+ORDER BY t.code, c.id`)
+	if err != nil {
+		return s, err
+	}
+	serviceOf := map[string]string{}    // calendar id → service id
+	firstOfTrain := map[string]string{} // train code → service id
+	for rows.Next() {
+		var (
+			x          Service
+			id, raw    string
+			start, end time.Time
+		)
+		if err := rows.Scan(&id, &x.ServiceID, &x.Train, &x.Weekdays, &start, &end, &raw); err != nil {
+			rows.Close()
+			return s, err
+		}
+		ex, err := schedule.ParseExceptions([]byte(raw))
+		if err != nil {
+			rows.Close()
+			return s, fmt.Errorf("service calendar %s: %w", id, err)
+		}
+		if x.ServiceID == "" {
+			x.ServiceID = "cal-" + id[:8]
+		}
+		x.Start, x.End = start.Format(schedule.DateLayout), end.Format(schedule.DateLayout)
+		x.Removed, x.Added = ex.Removed, ex.Added
+		serviceOf[id] = x.ServiceID
+		if _, ok := firstOfTrain[x.Train]; !ok {
+			firstOfTrain[x.Train] = x.ServiceID
+		}
+		s.Services = append(s.Services, x)
+	}
+	rows.Close()
+
+	calls := map[string][]Call{} // template id → stops
+	rows, err = db.Query(ctx, `
+SELECT ts.template_id, s.code, COALESCE(ts.arrive_time::TEXT, ''), COALESCE(ts.depart_time::TEXT, ''), ts.day_offset, ts.distance_km::FLOAT8
+FROM template_stops ts JOIN stations s ON s.id = ts.station_id
+ORDER BY ts.template_id, ts.seq`)
+	if err != nil {
+		return s, err
+	}
+	for rows.Next() {
+		var (
+			id string
+			c  Call
+		)
+		if err := rows.Scan(&id, &c.Station, &c.Arrive, &c.Depart, &c.DayOffset, &c.DistanceKM); err != nil {
+			rows.Close()
+			return s, err
+		}
+		calls[id] = append(calls[id], c)
+	}
+	rows.Close()
+
+	lines := map[string]Line{}
+	for _, l := range s.Routes {
+		lines[l.Code] = l
+	}
+	rows, err = db.Query(ctx, `
+SELECT tt.id, COALESCE(tt.gtfs_trip_id, ''), t.code, r.route_code, COALESCE(tt.calendar_id::TEXT, ''),
+       tt.depart_time::TEXT, tt.arrive_time::TEXT, tt.base_price::INT8, tt.active
+FROM timetable_templates tt
+JOIN trains t ON t.id = tt.train_id
+JOIN routes r ON r.id = tt.route_id`)
+	if err != nil {
+		return s, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			x         Departure
+			id, calID string
+		)
+		if err := rows.Scan(&id, &x.TripID, &x.Train, &x.Route, &calID, &x.Depart, &x.Arrive, &x.BasePrice, &x.Active); err != nil {
+			return s, err
+		}
+		if x.ServiceID = serviceOf[calID]; x.ServiceID == "" {
+			x.ServiceID = firstOfTrain[x.Train]
+		}
+		x.Stops = calls[id]
+		x.Stops = x.calls(lines[x.Route]) // templates without stops call at the route's ends
+		s.Departures = append(s.Departures, x)
+	}
+	if err := rows.Err(); err != nil {
+		return s, err
+	}
+	s.sort()
+	return s, nil
+}
+
+// ApplyOptions tune Apply.
+type ApplyOptions struct {
+	Prune   bool                 // deactivate previously imported departures missing from the feed
+	Consist []schedule.CoachSpec // coaches of new departures (DefaultConsist when empty)
+}
+
+// Apply writes a snapshot in one transaction: stations, trains and routes
+// are upserted by code, calendars by (train, service_id) and departures by
+// (train, route, depart_time). Consists of existing departures are kept;
+// their stops are replaced and apply to trips generated from then on.
+func Apply(ctx context.Context, db booking.DB, next Snapshot, opt ApplyOptions) error {
+	consist := opt.Consist
+	if len(consist) == 0 {
+		consist = DefaultConsist
+	}
+	consistJSON, err := json.Marshal(consist)
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, x := range next.Stations {
+		if _, err := tx.Exec(ctx, `
+INSERT INTO stations (code, name, city, lat, lon) VALUES ($1, $2, NULLIF($3, ''), $4, $5)
+ON CONFLICT (code) DO UPDATE SET name = EXCLUDED.name, city = EXCLUDED.city, lat = EXCLUDED.lat, lon = EXCLUDED.lon`,
+			x.Code, x.Name, x.City, x.Lat, x.Lon); err != nil {
+			return fmt.Errorf("station %s: %w", x.Code, err)
+		}
+	}
+	for _, x := range next.Trains {
+		if _, err := tx.Exec(ctx, `
+INSERT INTO trains (code, name, operator) VALUES ($1, $2, NULLIF($3, ''))
+ON CONFLICT (code) DO UPDATE SET name = EXCLUDED.name, operator = EXCLUDED.operator`,
+			x.Code, x.Name, x.Operator); err != nil {
+			return fmt.Errorf("train %s: %w", x.Code, err)
+		}
+	}
+	for _, x := range next.Routes {
+		if _, err := tx.Exec(ctx, `
+INSERT INTO routes (route_code, origin_station_id, dest_station_id, distance_km)
+SELECT $1, so.id, sd.id, $4 FROM stations so, stations sd WHERE so.code = $2 AND sd.code = $3
+ON CONFLICT (route_code) DO UPDATE SET distance_km = EXCLUDED.distance_km`,
+			x.Code, x.Origin, x.Dest, x.DistanceKM); err != nil {
+			return fmt.Errorf("route %s: %w", x.Code, err)
+		}
+	}
+	calendarID := map[string]string{} // service key → service_calendars.id
+	for _, x := range next.Services {
+		ex, err := json.Marshal(schedule.Exceptions{Removed: nonNil(x.Removed), Added: nonNil(x.Added)})
+		if err != nil {
+			return err
+		}
+		var id string
+		if err := tx.QueryRow(ctx, `
+INSERT INTO service_calendars (train_id, service_id, weekday_flags, start_date, end_date, exceptions)
+SELECT t.id, $2, $3, $4::DATE, $5::DATE, $6::JSONB FROM trains t WHERE t.code = $1
+ON CONFLICT (train_id, service_id) DO UPDATE SET weekday_flags = EXCLUDED.weekday_flags,
+    start_date = EXCLUDED.start_date, end_date = EXCLUDED.end_date, exceptions = EXCLUDED.exceptions
+RETURNING id`, x.Train, x.ServiceID, x.Weekdays, x.Start, x.End, string(ex)).Scan(&id); err != nil {
+			return fmt.Errorf("calendar %s: %w", x.key(), err)
+		}
+		calendarID[x.key()] = id
+	}
+	routes := map[string]Line{}
+	for _, l := range next.Routes {
+		routes[l.Code] = l
+	}
+	tripIDs := make([]string, 0, len(next.Departures))
+	for _, x := range next.Departures {
+		tripIDs = append(tripIDs, x.TripID)
+		var id string
+		if err := tx.QueryRow(ctx, `
+INSERT INTO timetable_templates (train_id, route_id, calendar_id, gtfs_trip_id, depart_time, arrive_time, base_price, consist, active)
+SELECT t.id, r.id, $3, NULLIF($4, ''), $5::TIME, $6::TIME, $7, $8::JSONB, TRUE
+FROM trains t, routes r WHERE t.code = $1 AND r.route_code = $2
+ON CONFLICT (train_id, route_id, depart_time) DO UPDATE SET calendar_id = EXCLUDED.calendar_id,
+    gtfs_trip_id = EXCLUDED.gtfs_trip_id, arrive_time = EXCLUDED.arrive_time, base_price = EXCLUDED.base_price, active = TRUE
+RETURNING id`,
+			x.Train, x.Route, calendarID[Service{ServiceID: x.ServiceID, Train: x.Train}.key()], x.TripID,
+			x.Depart, x.Arrive, x.BasePrice, string(consistJSON)).Scan(&id); err != nil {
+			return fmt.Errorf("departure %s: %w", x.Key(), err)
+		}
+		if err := writeStops(ctx, tx, id, x.calls(routes[x.Route])); err != nil {
+			return fmt.Errorf("departure %s stops: %w", x.Key(), err)
+		}
+	}
+	if opt.Prune {
+		if _, err := tx.Exec(ctx, `
+UPDATE timetable_templates SET active = FALSE
+WHERE gtfs_trip_id IS NOT NULL AND NOT (gtfs_trip_id = ANY($1::TEXT[]))`, tripIDs); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// writeStops replaces a template's stops.
+func writeStops(ctx context.Context, tx pgx.Tx, templateID string, calls []Call) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM template_stops WHERE template_id = $1`, templateID); err != nil {
+		return err
+	}
+	var (
+		seq, day     []int64
+		code, ar, dp []string
+		km           []float64
+	)
+	for i, c := range calls {
+		seq, day, km = append(seq, int64(i)), append(day, int64(c.DayOffset)), append(km, c.DistanceKM)
+		code, ar, dp = append(code, c.Station), append(ar, c.Arrive), append(dp, c.Depart)
+	}
+	tag, err := tx.Exec(ctx, `
+INSERT INTO template_stops (template_id, seq, station_id, arrive_time, depart_time, day_offset, distance_km)
+SELECT $1, v.seq, s.id, NULLIF(v.arr, '')::TIME, NULLIF(v.dep, '')::TIME, v.day, v.km
+FROM unnest($2::INT8[], $3::TEXT[], $4::TEXT[], $5::TEXT[], $6::INT8[], $7::FLOAT8[]) AS v(seq, code, arr, dep, day, km)
+JOIN stations s ON s.code = v.code`, templateID, seq, code, ar, dp, day, km)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != int64(len(calls)) {
+		return fmt.Errorf("%d of %d stations are unknown", int64(len(calls))-tag.RowsAffected(), len(calls))
+	}
+	return nil
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
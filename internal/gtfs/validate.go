@@ -0,0 +1,273 @@
+package gtfs
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Problem is a validation finding. Warnings are worth reading; errors stop an import.
+type Problem struct {
+	File    string
+	Line    int // 0 when the problem concerns the whole file
+	Warning bool
+	Message string
+}
+
+func (p Problem) String() string {
+	level := "error"
+	if p.Warning {
+		level = "warning"
+	}
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", p.File, p.Line, level, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.File, level, p.Message)
+}
+
+// HasErrors reports whether any problem is an error.
+func HasErrors(ps []Problem) bool {
+	for _, p := range ps {
+		if !p.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+// Column sizes of the tables the feed maps onto.
+const (
+	maxStationCode = 10
+	maxTrainCode   = 20
+	maxGTFSID      = 64
+)
+
+// Validate checks a feed against the GTFS rules this importer relies on:
+// required files, unique and referenced IDs, parseable dates and times, and
+// stop times in order. Problems are sorted by file and line.
+func Validate(f *Feed) []Problem {
+	ps := append([]Problem(nil), f.problems...)
+	add := func(file string, line int, warn bool, format string, args ...any) {
+		ps = append(ps, Problem{File: file, Line: line, Warning: warn, Message: fmt.Sprintf(format, args...)})
+	}
+	for _, name := range []string{"stops.txt", "routes.txt", "trips.txt", "stop_times.txt"} {
+		if !f.Has(name) {
+			add(name, 0, false, "required file is missing")
+		}
+	}
+	if !f.Has("calendar.txt") && !f.Has("calendar_dates.txt") {
+		add("calendar.txt", 0, false, "calendar.txt or calendar_dates.txt is required")
+	}
+
+	stops := map[string]bool{}
+	for i, s := range f.Stops {
+		switch {
+		case s.ID == "":
+			add("stops.txt", line(i), false, "stop_id is required")
+		case stops[s.ID]:
+			add("stops.txt", line(i), false, "duplicate stop_id %q", s.ID)
+		case len(s.ID) > maxStationCode:
+			add("stops.txt", line(i), false, "stop_id %q is longer than %d characters (it becomes the station code)", s.ID, maxStationCode)
+		}
+		stops[s.ID] = true
+		if s.Name == "" {
+			add("stops.txt", line(i), false, "stop_name is required")
+		}
+		if s.Lat < -90 || s.Lat > 90 || s.Lon < -180 || s.Lon > 180 {
+			add("stops.txt", line(i), false, "coordinates %v,%v are out of range", s.Lat, s.Lon)
+		}
+	}
+
+	routes := map[string]bool{}
+	for i, r := range f.Routes {
+		switch {
+		case r.ID == "":
+			add("routes.txt", line(i), false, "route_id is required")
+		case routes[r.ID]:
+			add("routes.txt", line(i), false, "duplicate route_id %q", r.ID)
+		case len(r.ID) > maxTrainCode:
+			add("routes.txt", line(i), false, "route_id %q is longer than %d characters (it becomes the train code)", r.ID, maxTrainCode)
+		}
+		routes[r.ID] = true
+		if r.LongName == "" && r.ShortName == "" {
+			add("routes.txt", line(i), false, "route_long_name or route_short_name is required")
+		}
+		if r.Type != 2 && (r.Type < 100 || r.Type > 117) {
+			add("routes.txt", line(i), true, "route_type %d is not rail", r.Type)
+		}
+	}
+
+	services := map[string]bool{}
+	for i, c := range f.Calendars {
+		if c.ServiceID == "" || len(c.ServiceID) > maxGTFSID {
+			add("calendar.txt", line(i), false, "service_id must be 1..%d characters", maxGTFSID)
+		} else if services[c.ServiceID] {
+			add("calendar.txt", line(i), false, "duplicate service_id %q", c.ServiceID)
+		}
+		services[c.ServiceID] = true
+		start, err1 := ParseDate(c.Start)
+		end, err2 := ParseDate(c.End)
+		if err1 != nil || err2 != nil {
+			add("calendar.txt", line(i), false, "start_date and end_date must be YYYYMMDD")
+		} else if end.Before(start) {
+			add("calendar.txt", line(i), false, "end_date %s is before start_date %s", c.End, c.Start)
+		}
+	}
+	for i, d := range f.CalendarDates {
+		if d.ServiceID == "" || len(d.ServiceID) > maxGTFSID {
+			add("calendar_dates.txt", line(i), false, "service_id must be 1..%d characters", maxGTFSID)
+		}
+		services[d.ServiceID] = true
+		if _, err := ParseDate(d.Date); err != nil {
+			add("calendar_dates.txt", line(i), false, "date %q must be YYYYMMDD", d.Date)
+		}
+		if d.Type != ServiceAdded && d.Type != ServiceRemoved {
+			add("calendar_dates.txt", line(i), false, "exception_type must be 1 (added) or 2 (removed)")
+		}
+	}
+
+	trips := map[string]bool{}
+	for i, t := range f.Trips {
+		switch {
+		case t.ID == "" || len(t.ID) > maxGTFSID:
+			add("trips.txt", line(i), false, "trip_id must be 1..%d characters", maxGTFSID)
+		case trips[t.ID]:
+			add("trips.txt", line(i), false, "duplicate trip_id %q", t.ID)
+		}
+		trips[t.ID] = true
+		if !routes[t.RouteID] {
+			add("trips.txt", line(i), false, "route_id %q is not in routes.txt", t.RouteID)
+		}
+		if !services[t.ServiceID] {
+			add("trips.txt", line(i), false, "service_id %q is not in calendar.txt or calendar_dates.txt", t.ServiceID)
+		}
+	}
+
+	byTrip := map[string][]int{}
+	for i, st := range f.StopTimes {
+		if !trips[st.TripID] {
+			add("stop_times.txt", line(i), false, "trip_id %q is not in trips.txt", st.TripID)
+			continue
+		}
+		if !stops[st.StopID] {
+			add("stop_times.txt", line(i), false, "stop_id %q is not in stops.txt", st.StopID)
+		}
+		for _, v := range []string{st.Arrival, st.Departure} {
+			if _, err := ParseTime(v); err != nil {
+				add("stop_times.txt", line(i), false, "%v", err)
+			}
+		}
+		byTrip[st.TripID] = append(byTrip[st.TripID], i)
+	}
+	for i, t := range f.Trips {
+		rows := byTrip[t.ID]
+		if len(rows) < 2 {
+			add("trips.txt", line(i), false, "trip %q needs at least two stop_times", t.ID)
+			continue
+		}
+		sort.Slice(rows, func(a, b int) bool { return f.StopTimes[rows[a]].Seq < f.StopTimes[rows[b]].Seq })
+		prev := -1
+		visited := map[string]bool{}
+		for k, r := range rows {
+			st := f.StopTimes[r]
+			if k > 0 && st.Seq == f.StopTimes[rows[k-1]].Seq {
+				add("stop_times.txt", line(r), false, "trip %q repeats stop_sequence %d", t.ID, st.Seq)
+			}
+			if visited[st.StopID] {
+				add("stop_times.txt", line(r), false, "trip %q calls at %q twice; tickets are sold between stations, so loops are not supported", t.ID, st.StopID)
+			}
+			visited[st.StopID] = true
+			for _, v := range []string{st.Arrival, st.Departure} {
+				if s, err := ParseTime(v); err == nil {
+					if s < prev {
+						add("stop_times.txt", line(r), false, "trip %q goes back in time at stop_sequence %d", t.ID, st.Seq)
+					}
+					prev = s
+				}
+			}
+		}
+	}
+
+	// Two trips of one route between the same stops at the same time would be
+	// the same departure (uq_trips_departure).
+	seen := map[string]string{}
+	for _, t := range f.Trips {
+		sts := ordered(f, byTrip[t.ID])
+		if len(sts) < 2 {
+			continue
+		}
+		first, last := sts[0], sts[len(sts)-1]
+		key := t.RouteID + "|" + first.StopID + "|" + last.StopID + "|" + NormalizeTime(first.Departure)
+		if other, dup := seen[key]; dup {
+			add("trips.txt", 0, false, "trips %q and %q are the same departure (route, stops and time)", other, t.ID)
+		}
+		seen[key] = t.ID
+	}
+
+	fares := map[string]bool{}
+	for _, a := range f.FareAttributes {
+		fares[a.ID] = true
+		if a.Currency != "" && !strings.EqualFold(a.Currency, "IDR") {
+			add("fare_attributes.txt", 0, true, "fare %q is in %s; prices are imported as rupiah", a.ID, a.Currency)
+		}
+	}
+	for i, r := range f.FareRules {
+		if !fares[r.FareID] {
+			add("fare_rules.txt", line(i), false, "fare_id %q is not in fare_attributes.txt", r.FareID)
+		}
+	}
+
+	sort.SliceStable(ps, func(a, b int) bool {
+		if ps[a].File != ps[b].File {
+			return ps[a].File < ps[b].File
+		}
+		return ps[a].Line < ps[b].Line
+	})
+	return ps
+}
+
+// ordered returns a trip's stop times sorted by stop_sequence.
+func ordered(f *Feed, rows []int) []StopTime {
+	out := make([]StopTime, len(rows))
+	for i, r := range rows {
+		out[i] = f.StopTimes[r]
+	}
+	sort.SliceStable(out, func(a, b int) bool { return out[a].Seq < out[b].Seq })
+	return out
+}
+
+// ParseDate parses a GTFS YYYYMMDD date.
+func ParseDate(s string) (time.Time, error) {
+	return time.Parse("20060102", s)
+}
+
+// ParseTime parses a GTFS "H:MM:SS" time into seconds after midnight of the
+// service day. Values past 24:00:00 are valid.
+func ParseTime(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("time %q must be HH:MM:SS", s)
+	}
+	var v [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || (i > 0 && n > 59) || (i == 0 && n > 47) {
+			return 0, fmt.Errorf("time %q must be HH:MM:SS", s)
+		}
+		v[i] = n
+	}
+	return v[0]*3600 + v[1]*60 + v[2], nil
+}
+
+// NormalizeTime turns a GTFS time into a TIME value ("HH:MM:SS"), wrapping
+// times after midnight (25:10:00 → 01:10:00).
+func NormalizeTime(s string) string {
+	secs, err := ParseTime(s)
+	if err != nil {
+		return s
+	}
+	secs %= 24 * 3600
+	return fmt.Sprintf("%02d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+}
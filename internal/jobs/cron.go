@@ -0,0 +1,154 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec is a parsed schedule: an interval or a five-field cron expression.
+type Spec struct {
+	src   string
+	every time.Duration
+	// bit n set: value n matches.
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+var specAliases = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// ParseSpec parses "@every <duration>" (at least a second), an alias
+// (@hourly, @daily, @midnight, @weekly, @monthly) or "minute hour
+// day-of-month month day-of-week" with numbers, *, ranges a-b, steps /n and
+// comma lists. Day of week runs 0-6 from Sunday (7 is Sunday too); when both
+// day fields are restricted either may match, as in cron.
+func ParseSpec(s string) (Spec, error) {
+	src := strings.TrimSpace(s)
+	if rest, ok := strings.CutPrefix(src, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Second {
+			return Spec{}, fmt.Errorf("jobs: schedule %q: @every wants a duration of at least 1s", s)
+		}
+		return Spec{src: src, every: d}, nil
+	}
+	expr := src
+	if alias, ok := specAliases[src]; ok {
+		expr = alias
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return Spec{}, fmt.Errorf("jobs: schedule %q: want 5 fields (minute hour day month weekday) or @every <duration>", s)
+	}
+	sp := Spec{src: src}
+	var err error
+	if sp.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return Spec{}, fmt.Errorf("jobs: schedule %q minute: %w", s, err)
+	}
+	if sp.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return Spec{}, fmt.Errorf("jobs: schedule %q hour: %w", s, err)
+	}
+	if sp.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return Spec{}, fmt.Errorf("jobs: schedule %q day of month: %w", s, err)
+	}
+	if sp.month, err = parseField(fields[3], 1, 12); err != nil {
+		return Spec{}, fmt.Errorf("jobs: schedule %q month: %w", s, err)
+	}
+	if sp.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return Spec{}, fmt.Errorf("jobs: schedule %q day of week: %w", s, err)
+	}
+	if sp.dow&(1<<7) != 0 {
+		sp.dow |= 1
+	}
+	sp.domAny = strings.HasPrefix(fields[2], "*")
+	sp.dowAny = strings.HasPrefix(fields[4], "*")
+	return sp, nil
+}
+
+// parseField turns one cron field into a bit set of the values in [lo, hi].
+func parseField(f string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(f, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step %q", part)
+			}
+			step = n
+		}
+		from, to := lo, hi
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err1, err2 error
+			from, err1 = strconv.Atoi(a)
+			to, err2 = strconv.Atoi(b)
+			if err1 != nil || err2 != nil || from > to {
+				return 0, fmt.Errorf("bad range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, fmt.Errorf("bad value %q", part)
+			}
+			from = n
+			if !hasStep {
+				to = n
+			}
+		}
+		if from < lo || to > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// String returns the spec as written.
+func (s Spec) String() string { return s.src }
+
+// Next returns the first time after t the spec comes due, in t's location,
+// or the zero time when a cron expression never matches (say 30 February).
+func (s Spec) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s Spec) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
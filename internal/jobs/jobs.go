@@ -0,0 +1,282 @@
+// Package jobs runs deferred and periodic work inside cmd/server. Jobs are
+// typed: Register binds a kind name to a handler taking its own argument
+// type, and the Kind it returns enqueues arguments of that type. A Runner
+// claims due jobs from a Backend, Postgres (FOR UPDATE SKIP LOCKED) or
+// Valkey, with at most Options.Concurrency at a time per kind and instance,
+// and retries failures with backoff until they have used MaxAttempts.
+//
+// Schedules enqueue a kind on a cron spec. Only the instance holding the
+// scheduler lease enqueues them, and a schedule's job is not enqueued again
+// while the previous one is still queued or running.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gothicforge3/internal/env"
+)
+
+// Job statuses.
+const (
+	StatusQueued  = "queued"  // waiting for run_at
+	StatusRunning = "running" // claimed by a worker until locked_until
+	StatusDone    = "done"    // the handler succeeded
+	StatusFailed  = "failed"  // gave up after max_attempts; retry to run again
+)
+
+// Job is one run of a kind with its arguments.
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Args        json.RawMessage `json:"args"`
+	Status      string          `json:"status"`
+	UniqueKey   string          `json:"unique_key,omitempty"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedBy    string          `json:"locked_by,omitempty"`
+	LockedUntil *time.Time      `json:"locked_until,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+}
+
+// EnqueueOptions tune one job. A job with a UniqueKey is not enqueued while
+// another job with the same key is queued or running.
+type EnqueueOptions struct {
+	Delay       time.Duration
+	UniqueKey   string
+	MaxAttempts int // default: the kind's Options.MaxAttempts
+}
+
+// Filter narrows List. Jobs are listed newest first.
+type Filter struct {
+	Status string
+	Kind   string
+	Limit  int
+}
+
+// Backend stores jobs and leases.
+type Backend interface {
+	Name() string
+	// Enqueue adds a job and returns its id, or 0 when opts.UniqueKey is
+	// taken by an unfinished job.
+	Enqueue(ctx context.Context, kind string, args []byte, opts EnqueueOptions) (int64, error)
+	// Claim marks the next due job of kind running for worker until lease
+	// from now, counting an attempt. Running jobs whose lease lapsed are due
+	// again. ok is false when nothing is due.
+	Claim(ctx context.Context, kind, worker string, lease time.Duration) (j Job, ok bool, err error)
+	// Finish records the outcome of a job worker claimed: j.Status is done,
+	// failed, or queued to run again after delay, with j.Attempts and
+	// j.LastError. It returns ErrLost when worker no longer holds the job.
+	Finish(ctx context.Context, j Job, worker string, delay time.Duration) error
+	// Lease takes or renews the lease called name for holder and reports
+	// whether holder has it.
+	Lease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	List(ctx context.Context, f Filter) ([]Job, error)
+	// Retry queues failed jobs again with fresh attempts: the given ids, or
+	// with none every failed job (of kind, when set). It returns how many.
+	Retry(ctx context.Context, kind string, ids ...int64) (int64, error)
+	// Purge deletes jobs in status (done or failed; both when empty) that
+	// finished longer than age ago and returns how many.
+	Purge(ctx context.Context, status string, age time.Duration) (int64, error)
+}
+
+// FromEnv returns the backend selected by JOBS_BACKEND: postgres (the
+// default) on db, or valkey on VALKEY_URL (or REDIS_URL).
+func FromEnv(db DB) (Backend, error) {
+	switch name := strings.ToLower(strings.TrimSpace(env.Get("JOBS_BACKEND", "postgres"))); name {
+	case "postgres", "postgresql", "pg":
+		if db == nil {
+			return nil, errors.New("jobs: the postgres backend needs DATABASE_URL")
+		}
+		return NewPostgres(db), nil
+	case "valkey", "redis":
+		ru := strings.TrimSpace(env.Get("VALKEY_URL", ""))
+		if ru == "" {
+			ru = strings.TrimSpace(env.Get("REDIS_URL", ""))
+		}
+		if ru == "" {
+			return nil, errors.New("jobs: JOBS_BACKEND=valkey needs VALKEY_URL")
+		}
+		return NewValkey(ru, strings.TrimSpace(env.Get("VALKEY_TLS_SKIP_VERIFY", "")) == "1"), nil
+	default:
+		return nil, fmt.Errorf("jobs: unknown JOBS_BACKEND %q (want postgres or valkey)", name)
+	}
+}
+
+// Options tune a kind.
+type Options struct {
+	Concurrency int           // jobs of this kind one instance runs at once (default 1)
+	MaxAttempts int           // tries before a job fails for good (default 5)
+	Timeout     time.Duration // how long one attempt may run (default 5 minutes)
+}
+
+func (o Options) withDefaults() Options {
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 5
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 5 * time.Minute
+	}
+	return o
+}
+
+// Backoff is the wait before retrying a job that failed attempts times.
+func Backoff(attempts int) time.Duration {
+	return min(10*time.Second<<min(max(attempts-1, 0), 10), time.Hour)
+}
+
+// NoArgs is the argument type of kinds that need none.
+type NoArgs struct{}
+
+// Kind enqueues jobs whose handler takes T.
+type Kind[T any] struct{ name string }
+
+// Name returns the kind's name.
+func (k Kind[T]) Name() string { return k.name }
+
+// Enqueue adds a job of this kind with args. It returns 0 when
+// opts.UniqueKey is taken by an unfinished job.
+func (k Kind[T]) Enqueue(ctx context.Context, b Backend, args T, opts EnqueueOptions) (int64, error) {
+	d, ok := lookup(k.name)
+	if !ok {
+		return 0, fmt.Errorf("jobs: kind %s is not registered", k.name)
+	}
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return 0, err
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = d.opts.MaxAttempts
+	}
+	id, err := b.Enqueue(ctx, k.name, raw, opts)
+	if err == nil && id != 0 && opts.Delay <= 0 {
+		d.wake()
+	}
+	return id, err
+}
+
+// definition is a registered kind.
+type definition struct {
+	name    string
+	opts    Options
+	run     func(ctx context.Context, args json.RawMessage) error
+	waiting chan struct{}
+}
+
+// wake tells an idle local worker of the kind to look for jobs now.
+func (d *definition) wake() {
+	select {
+	case d.waiting <- struct{}{}:
+	default:
+	}
+}
+
+// schedule enqueues a kind on a cron spec.
+type schedule struct {
+	name string
+	spec Spec
+	kind string
+	args []byte
+}
+
+var (
+	registryMu sync.RWMutex
+	kinds      = map[string]*definition{}
+	schedules  []schedule
+)
+
+// Register binds the kind name to h. Registering a name twice panics.
+func Register[T any](name string, opts Options, h func(ctx context.Context, args T) error) Kind[T] {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := kinds[name]; dup {
+		panic("jobs: kind " + name + " registered twice")
+	}
+	kinds[name] = &definition{
+		name: name,
+		opts: opts.withDefaults(),
+		run: func(ctx context.Context, raw json.RawMessage) error {
+			var args T
+			if len(raw) > 0 {
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return fmt.Errorf("jobs: %s arguments: %w", name, err)
+				}
+			}
+			return h(ctx, args)
+		},
+		waiting: make(chan struct{}, 1),
+	}
+	return Kind[T]{name: name}
+}
+
+// Schedule enqueues k with args whenever spec (see ParseSpec) comes due,
+// under the unique key "schedule:<name>".
+func Schedule[T any](name, spec string, k Kind[T], args T) error {
+	s, err := ParseSpec(spec)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, sc := range schedules {
+		if sc.name == name {
+			return fmt.Errorf("jobs: schedule %s registered twice", name)
+		}
+	}
+	schedules = append(schedules, schedule{name: name, spec: s, kind: k.name, args: raw})
+	return nil
+}
+
+// ScheduleInfo describes a registered schedule.
+type ScheduleInfo struct {
+	Name string
+	Spec string
+	Kind string
+}
+
+// Schedules lists the registered schedules by name.
+func Schedules() []ScheduleInfo {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	out := make([]ScheduleInfo, len(schedules))
+	for i, s := range schedules {
+		out[i] = ScheduleInfo{Name: s.name, Spec: s.spec.String(), Kind: s.kind}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func lookup(name string) (*definition, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	d, ok := kinds[name]
+	return d, ok
+}
+
+func registered() ([]*definition, []schedule) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	ds := make([]*definition, 0, len(kinds))
+	for _, d := range kinds {
+		ds = append(ds, d)
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i].name < ds[j].name })
+	return ds, append([]schedule(nil), schedules...)
+}
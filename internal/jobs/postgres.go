@@ -0,0 +1,165 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"gothicforge3/internal/textx"
+)
+
+// DB is the subset of pgxpool.Pool used by the Postgres backend.
+type DB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// ErrLost is returned by Finish when the worker no longer holds the job: its
+// lease lapsed and another worker may have claimed it.
+var ErrLost = errors.New("jobs: the job's lease lapsed before it finished")
+
+// Postgres keeps jobs in the jobs table and leases in job_leases.
+type Postgres struct{ db DB }
+
+// NewPostgres returns a backend on db.
+func NewPostgres(db DB) *Postgres { return &Postgres{db: db} }
+
+// Name implements Backend.
+func (p *Postgres) Name() string { return "postgres" }
+
+const jobCols = `id, kind, args::TEXT, status, unique_key, attempts, max_attempts, run_at, locked_by, locked_until, last_error, created_at, started_at, finished_at`
+
+func scanJob(row pgx.Row) (Job, error) {
+	var (
+		j    Job
+		args string
+	)
+	err := row.Scan(&j.ID, &j.Kind, &args, &j.Status, &j.UniqueKey, &j.Attempts, &j.MaxAttempts, &j.RunAt, &j.LockedBy, &j.LockedUntil, &j.LastError, &j.CreatedAt, &j.StartedAt, &j.FinishedAt)
+	j.Args = []byte(args)
+	return j, err
+}
+
+// Enqueue implements Backend.
+func (p *Postgres) Enqueue(ctx context.Context, kind string, args []byte, opts EnqueueOptions) (int64, error) {
+	if len(args) == 0 {
+		args = []byte("{}")
+	}
+	var id int64
+	err := p.db.QueryRow(ctx, `
+INSERT INTO jobs (kind, args, unique_key, max_attempts, run_at)
+VALUES ($1, $2::JSONB, $3, $4, now() + ($5::INT8 * INTERVAL '1 millisecond'))
+ON CONFLICT (unique_key) WHERE unique_key <> '' AND status IN ('queued', 'running') DO NOTHING
+RETURNING id`, kind, string(args), opts.UniqueKey, max(opts.MaxAttempts, 1), opts.Delay.Milliseconds()).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+// Claim implements Backend.
+func (p *Postgres) Claim(ctx context.Context, kind, worker string, lease time.Duration) (Job, bool, error) {
+	j, err := scanJob(p.db.QueryRow(ctx, `
+UPDATE jobs SET status = 'running', attempts = attempts + 1, locked_by = $2,
+    locked_until = now() + ($3::INT8 * INTERVAL '1 millisecond'), started_at = now()
+WHERE id = (
+    SELECT id FROM jobs
+    WHERE kind = $1 AND ((status = 'queued' AND run_at <= now()) OR (status = 'running' AND locked_until <= now()))
+    ORDER BY run_at, id
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED)
+RETURNING `+jobCols, kind, worker, lease.Milliseconds()))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Job{}, false, nil
+	}
+	return j, err == nil, err
+}
+
+// Finish implements Backend.
+func (p *Postgres) Finish(ctx context.Context, j Job, worker string, delay time.Duration) error {
+	tag, err := p.db.Exec(ctx, `
+UPDATE jobs SET status = $3, attempts = $6, last_error = $4, locked_by = '', locked_until = NULL,
+    run_at = CASE WHEN $3 = 'queued' THEN now() + ($5::INT8 * INTERVAL '1 millisecond') ELSE run_at END,
+    finished_at = CASE WHEN $3 = 'queued' THEN NULL ELSE now() END
+WHERE id = $1 AND status = 'running' AND locked_by = $2`, j.ID, worker, j.Status, textx.Truncate(j.LastError, 1000), delay.Milliseconds(), j.Attempts)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrLost
+	}
+	return err
+}
+
+// Lease implements Backend.
+func (p *Postgres) Lease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	var got string
+	err := p.db.QueryRow(ctx, `
+INSERT INTO job_leases (name, holder, expires_at) VALUES ($1, $2, now() + ($3::INT8 * INTERVAL '1 millisecond'))
+ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+WHERE job_leases.holder = EXCLUDED.holder OR job_leases.expires_at <= now()
+RETURNING holder`, name, holder, ttl.Milliseconds()).Scan(&got)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil && got == holder, err
+}
+
+// List implements Backend.
+func (p *Postgres) List(ctx context.Context, f Filter) ([]Job, error) {
+	where, args := []string{"TRUE"}, []any{}
+	if f.Status != "" {
+		args = append(args, f.Status)
+		where = append(where, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if f.Kind != "" {
+		args = append(args, f.Kind)
+		where = append(where, fmt.Sprintf("kind = $%d", len(args)))
+	}
+	if f.Limit <= 0 {
+		f.Limit = 50
+	}
+	args = append(args, f.Limit)
+	rows, err := p.db.Query(ctx, `SELECT `+jobCols+` FROM jobs WHERE `+strings.Join(where, " AND ")+
+		fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Job{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+// Retry implements Backend. Of several failed jobs sharing a unique key only
+// the newest is queued again, and none while the key is taken.
+func (p *Postgres) Retry(ctx context.Context, kind string, ids ...int64) (int64, error) {
+	tag, err := p.db.Exec(ctx, `
+UPDATE jobs SET status = 'queued', attempts = 0, last_error = '', run_at = now(), started_at = NULL, finished_at = NULL
+WHERE id IN (
+    SELECT DISTINCT ON (CASE WHEN j.unique_key = '' THEN j.id::TEXT ELSE j.unique_key END) j.id
+    FROM jobs j
+    WHERE j.status = 'failed'
+      AND (CASE WHEN cardinality($1::INT8[]) > 0 THEN j.id = ANY($1) ELSE ($2::TEXT = '' OR j.kind = $2::TEXT) END)
+      AND (j.unique_key = '' OR NOT EXISTS (
+          SELECT 1 FROM jobs o WHERE o.unique_key = j.unique_key AND o.status IN ('queued', 'running')))
+    ORDER BY CASE WHEN j.unique_key = '' THEN j.id::TEXT ELSE j.unique_key END, j.id DESC)`, ids, kind)
+	return tag.RowsAffected(), err
+}
+
+// Purge implements Backend.
+func (p *Postgres) Purge(ctx context.Context, status string, age time.Duration) (int64, error) {
+	tag, err := p.db.Exec(ctx, `
+DELETE FROM jobs
+WHERE (CASE WHEN $1::TEXT = '' THEN status IN ('done', 'failed') ELSE status = $1::TEXT END)
+  AND finished_at < now() - ($2::INT8 * INTERVAL '1 millisecond')`, status, age.Milliseconds())
+	return tag.RowsAffected(), err
+}
@@ -0,0 +1,218 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gothicforge3/internal/env"
+	"gothicforge3/internal/textx"
+)
+
+// SchedulerLease is the lease whose holder enqueues scheduled jobs.
+const SchedulerLease = "scheduler"
+
+// Retention returns how long done and failed jobs are kept
+// (JOBS_RETENTION_DAYS, default 7 days).
+func Retention() time.Duration {
+	if n, err := strconv.Atoi(strings.TrimSpace(env.Get("JOBS_RETENTION_DAYS", ""))); err == nil && n > 0 {
+		return time.Duration(n) * 24 * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// Runner works the registered kinds and, while it holds the scheduler lease,
+// enqueues the registered schedules.
+type Runner struct {
+	b    Backend
+	id   string
+	poll time.Duration
+	// leaseTTL is how long the scheduler lease lasts without renewal.
+	leaseTTL time.Duration
+}
+
+// NewRunner returns a runner on b whose idle workers look for due jobs every
+// poll interval. Jobs enqueued by this instance wake its workers at once.
+func NewRunner(b Backend, poll time.Duration) *Runner {
+	host, _ := os.Hostname()
+	var buf [4]byte
+	_, _ = rand.Read(buf[:])
+	return &Runner{
+		b:        b,
+		id:       fmt.Sprintf("%s:%d:%s", textx.Truncate(host, 60), os.Getpid(), hex.EncodeToString(buf[:])),
+		poll:     poll,
+		leaseTTL: 30 * time.Second,
+	}
+}
+
+// ID names this runner in locked_by and the scheduler lease.
+func (r *Runner) ID() string { return r.id }
+
+// Run works until ctx is done and returns when every worker has stopped.
+// Kinds and schedules registered after Run starts are not picked up.
+func (r *Runner) Run(ctx context.Context) {
+	defs, scheds := registered()
+	var wg sync.WaitGroup
+	for _, d := range defs {
+		for i := 0; i < d.opts.Concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.work(ctx, d)
+			}()
+		}
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.schedule(ctx, scheds)
+	}()
+	wg.Wait()
+}
+
+// work claims and runs jobs of one kind, one at a time.
+func (r *Runner) work(ctx context.Context, d *definition) {
+	lease := d.opts.Timeout + time.Minute
+	for ctx.Err() == nil {
+		j, ok, err := r.b.Claim(ctx, d.name, r.id, lease)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("jobs: claiming %s failed: %v", d.name, err)
+		}
+		if err != nil || !ok {
+			select {
+			case <-ctx.Done():
+			case <-d.waiting:
+			case <-time.After(r.poll):
+			}
+			continue
+		}
+		r.execute(ctx, d, j)
+	}
+}
+
+// execute runs one claimed job and records the outcome. A job claimed again
+// after its worker died may already have used its attempts; it fails
+// without running.
+func (r *Runner) execute(ctx context.Context, d *definition, j Job) {
+	var err error
+	if j.Attempts > j.MaxAttempts {
+		err = errors.New("worker lost while running the last attempt")
+	} else {
+		hctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+		err = call(hctx, d, j)
+		cancel()
+	}
+	var delay time.Duration
+	switch {
+	case err == nil:
+		j.Status, j.LastError = StatusDone, ""
+	case ctx.Err() != nil:
+		// Shutting down: give the attempt back so another instance runs it soon.
+		j.Status, j.LastError, j.Attempts = StatusQueued, "interrupted by shutdown", j.Attempts-1
+	case j.Attempts >= j.MaxAttempts:
+		j.Status, j.LastError = StatusFailed, err.Error()
+		log.Printf("jobs: giving up on %s job %d after %d attempts: %v", j.Kind, j.ID, j.Attempts, err)
+	default:
+		j.Status, j.LastError = StatusQueued, err.Error()
+		delay = Backoff(j.Attempts)
+	}
+	fctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if ferr := r.b.Finish(fctx, j, r.id, delay); ferr != nil {
+		log.Printf("jobs: recording %s job %d failed: %v", j.Kind, j.ID, ferr)
+	}
+}
+
+func call(ctx context.Context, d *definition, j Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("handler panicked: %v", p)
+		}
+	}()
+	return d.run(ctx, j.Args)
+}
+
+// schedule takes or renews the scheduler lease and, while holding it,
+// enqueues every schedule that comes due. "@every" schedules run as soon as
+// this instance becomes the scheduler, cron schedules at their next match.
+// The holder also purges jobs older than Retention once an hour.
+func (r *Runner) schedule(ctx context.Context, scheds []schedule) {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	var (
+		leader  bool
+		renewed time.Time
+		purged  time.Time
+		next    = map[string]time.Time{}
+	)
+	for {
+		now := time.Now()
+		if now.Sub(renewed) >= r.leaseTTL/3 {
+			ok, err := r.b.Lease(ctx, SchedulerLease, r.id, r.leaseTTL)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("jobs: scheduler lease failed: %v", err)
+			}
+			renewed = now
+			if ok != leader {
+				leader = ok
+				clear(next)
+				if leader && len(scheds) > 0 {
+					log.Printf("jobs: %s is running %d schedules", r.id, len(scheds))
+				}
+			}
+		}
+		if leader {
+			for _, s := range scheds {
+				at, seen := next[s.name]
+				if !seen {
+					at = now
+					if s.spec.every == 0 {
+						at = s.spec.Next(now)
+					}
+				}
+				if at.IsZero() || now.Before(at) {
+					next[s.name] = at
+					continue
+				}
+				r.enqueueScheduled(ctx, s)
+				next[s.name] = s.spec.Next(now)
+			}
+			if now.Sub(purged) >= time.Hour {
+				purged = now
+				if _, err := r.b.Purge(ctx, "", Retention()); err != nil && ctx.Err() == nil {
+					log.Printf("jobs: purge failed: %v", err)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (r *Runner) enqueueScheduled(ctx context.Context, s schedule) {
+	d, ok := lookup(s.kind)
+	if !ok {
+		return
+	}
+	id, err := r.b.Enqueue(ctx, s.kind, s.args, EnqueueOptions{UniqueKey: "schedule:" + s.name, MaxAttempts: d.opts.MaxAttempts})
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("jobs: enqueueing schedule %s failed: %v", s.name, err)
+		}
+		return
+	}
+	if id != 0 {
+		d.wake()
+	}
+}
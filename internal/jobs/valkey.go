@@ -0,0 +1,335 @@
+package jobs
+
+import (
+	"context"
+	"crypto/tls"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+
+	"gothicforge3/internal/textx"
+)
+
+// KeyPrefix starts every Valkey key of the job backend.
+const KeyPrefix = "gf:jobs:"
+
+// Valkey keeps each job in a hash (gf:jobs:job:<id>) indexed by sorted sets:
+// due:<kind> by run_at, running:<kind> by locked_until, done and failed by
+// finished_at, and all by id. Scripts make each step atomic, so instances
+// sharing one Valkey claim every job once, like the Postgres backend.
+type Valkey struct{ pool *redigo.Pool }
+
+// NewValkey returns a backend on the Valkey instance at rawURL. skipVerify
+// forces TLS without certificate checks.
+func NewValkey(rawURL string, skipVerify bool) *Valkey {
+	return &Valkey{pool: &redigo.Pool{
+		MaxIdle:     4,
+		IdleTimeout: 5 * time.Minute,
+		Dial:        func() (redigo.Conn, error) { return dialValkey(rawURL, skipVerify) },
+	}}
+}
+
+// Name implements Backend.
+func (v *Valkey) Name() string { return "valkey" }
+
+// Close releases the connection pool.
+func (v *Valkey) Close() error { return v.pool.Close() }
+
+// Times are stored as Unix milliseconds; 0 is unset.
+func millis(t time.Time) int64 { return t.UnixMilli() }
+
+var enqueueScript = redigo.NewScript(0, `
+local p, kind, args, uk, maxa, now, runat = ARGV[1], ARGV[2], ARGV[3], ARGV[4], ARGV[5], ARGV[6], ARGV[7]
+local id = redis.call('INCR', p .. 'seq')
+if uk ~= '' and not redis.call('SET', p .. 'unique:' .. uk, id, 'NX') then
+  return 0
+end
+redis.call('HSET', p .. 'job:' .. id, 'kind', kind, 'args', args, 'status', 'queued', 'unique_key', uk,
+  'attempts', 0, 'max_attempts', maxa, 'run_at', runat, 'locked_by', '', 'locked_until', 0,
+  'last_error', '', 'created_at', now, 'started_at', 0, 'finished_at', 0)
+redis.call('ZADD', p .. 'due:' .. kind, runat, id)
+redis.call('ZADD', p .. 'all', id, id)
+return id`)
+
+// Enqueue implements Backend.
+func (v *Valkey) Enqueue(ctx context.Context, kind string, args []byte, opts EnqueueOptions) (int64, error) {
+	if len(args) == 0 {
+		args = []byte("{}")
+	}
+	conn, err := v.pool.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	now := time.Now()
+	return redigo.Int64(enqueueScript.Do(conn, KeyPrefix, kind, args, opts.UniqueKey, max(opts.MaxAttempts, 1),
+		millis(now), millis(now.Add(opts.Delay))))
+}
+
+var claimScript = redigo.NewScript(0, `
+local p, kind, worker, now, lease = ARGV[1], ARGV[2], ARGV[3], tonumber(ARGV[4]), tonumber(ARGV[5])
+local running, due = p .. 'running:' .. kind, p .. 'due:' .. kind
+local id = redis.call('ZRANGEBYSCORE', running, '-inf', now, 'LIMIT', 0, 1)[1]
+if id then
+  redis.call('ZREM', running, id)
+else
+  id = redis.call('ZRANGEBYSCORE', due, '-inf', now, 'LIMIT', 0, 1)[1]
+  if not id then return false end
+  redis.call('ZREM', due, id)
+end
+local key = p .. 'job:' .. id
+if redis.call('EXISTS', key) == 0 then return false end
+redis.call('HSET', key, 'status', 'running', 'locked_by', worker, 'locked_until', now + lease, 'started_at', now)
+redis.call('HINCRBY', key, 'attempts', 1)
+redis.call('ZADD', running, now + lease, id)
+local out = redis.call('HGETALL', key)
+table.insert(out, 'id')
+table.insert(out, id)
+return out`)
+
+// Claim implements Backend.
+func (v *Valkey) Claim(ctx context.Context, kind, worker string, lease time.Duration) (Job, bool, error) {
+	conn, err := v.pool.GetContext(ctx)
+	if err != nil {
+		return Job{}, false, err
+	}
+	defer conn.Close()
+	fields, err := redigo.StringMap(claimScript.Do(conn, KeyPrefix, kind, worker, millis(time.Now()), lease.Milliseconds()))
+	if err == redigo.ErrNil || (err == nil && len(fields) == 0) {
+		return Job{}, false, nil
+	}
+	if err != nil {
+		return Job{}, false, err
+	}
+	return jobFromHash(fields), true, nil
+}
+
+var finishScript = redigo.NewScript(0, `
+local p, id, worker, status, lasterr, now, delay, attempts = ARGV[1], ARGV[2], ARGV[3], ARGV[4], ARGV[5], tonumber(ARGV[6]), tonumber(ARGV[7]), ARGV[8]
+local key = p .. 'job:' .. id
+local cur = redis.call('HMGET', key, 'status', 'locked_by', 'kind', 'unique_key')
+if cur[1] ~= 'running' or cur[2] ~= worker then return 0 end
+redis.call('ZREM', p .. 'running:' .. cur[3], id)
+if status == 'queued' then
+  redis.call('HSET', key, 'status', 'queued', 'attempts', attempts, 'last_error', lasterr, 'locked_by', '', 'locked_until', 0, 'run_at', now + delay)
+  redis.call('ZADD', p .. 'due:' .. cur[3], now + delay, id)
+  return 1
+end
+redis.call('HSET', key, 'status', status, 'attempts', attempts, 'last_error', lasterr, 'locked_by', '', 'locked_until', 0, 'finished_at', now)
+redis.call('ZADD', p .. status, now, id)
+if cur[4] ~= '' and redis.call('GET', p .. 'unique:' .. cur[4]) == id then
+  redis.call('DEL', p .. 'unique:' .. cur[4])
+end
+return 1`)
+
+// Finish implements Backend.
+func (v *Valkey) Finish(ctx context.Context, j Job, worker string, delay time.Duration) error {
+	conn, err := v.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	n, err := redigo.Int(finishScript.Do(conn, KeyPrefix, j.ID, worker, j.Status, textx.Truncate(j.LastError, 1000),
+		millis(time.Now()), delay.Milliseconds(), j.Attempts))
+	if err == nil && n == 0 {
+		return ErrLost
+	}
+	return err
+}
+
+var leaseScript = redigo.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  return 1
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then return 1 end
+return 0`)
+
+// Lease implements Backend.
+func (v *Valkey) Lease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	conn, err := v.pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	n, err := redigo.Int(leaseScript.Do(conn, KeyPrefix+"lease:"+name, holder, ttl.Milliseconds()))
+	return n == 1, err
+}
+
+// List implements Backend. It walks the jobs newest first until it has
+// f.Limit matches.
+func (v *Valkey) List(ctx context.Context, f Filter) ([]Job, error) {
+	if f.Limit <= 0 {
+		f.Limit = 50
+	}
+	conn, err := v.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	out := []Job{}
+	const page = 200
+	for start := 0; len(out) < f.Limit; start += page {
+		ids, err := redigo.Int64s(conn.Do("ZREVRANGE", KeyPrefix+"all", start, start+page-1))
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			fields, err := redigo.StringMap(conn.Do("HGETALL", KeyPrefix+"job:"+strconv.FormatInt(id, 10)))
+			if err != nil {
+				return nil, err
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			fields["id"] = strconv.FormatInt(id, 10)
+			j := jobFromHash(fields)
+			if (f.Status == "" || j.Status == f.Status) && (f.Kind == "" || j.Kind == f.Kind) {
+				out = append(out, j)
+				if len(out) == f.Limit {
+					break
+				}
+			}
+		}
+		if len(ids) < page {
+			break
+		}
+	}
+	return out, nil
+}
+
+var retryScript = redigo.NewScript(0, `
+local p, id, now = ARGV[1], ARGV[2], ARGV[3]
+local key = p .. 'job:' .. id
+local cur = redis.call('HMGET', key, 'status', 'kind', 'unique_key')
+if cur[1] ~= 'failed' then return 0 end
+if cur[3] ~= '' and not redis.call('SET', p .. 'unique:' .. cur[3], id, 'NX') then return 0 end
+redis.call('ZREM', p .. 'failed', id)
+redis.call('HSET', key, 'status', 'queued', 'attempts', 0, 'last_error', '', 'run_at', now, 'started_at', 0, 'finished_at', 0)
+redis.call('ZADD', p .. 'due:' .. cur[2], now, id)
+return 1`)
+
+// Retry implements Backend. Failed jobs are tried newest first, so of
+// several sharing a unique key the newest is queued again.
+func (v *Valkey) Retry(ctx context.Context, kind string, ids ...int64) (int64, error) {
+	conn, err := v.pool.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if len(ids) == 0 {
+		if ids, err = redigo.Int64s(conn.Do("ZREVRANGE", KeyPrefix+"failed", 0, -1)); err != nil {
+			return 0, err
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	var n int64
+	for _, id := range ids {
+		if kind != "" {
+			k, err := redigo.String(conn.Do("HGET", KeyPrefix+"job:"+strconv.FormatInt(id, 10), "kind"))
+			if err != nil && err != redigo.ErrNil {
+				return n, err
+			}
+			if k != kind {
+				continue
+			}
+		}
+		ok, err := redigo.Int64(retryScript.Do(conn, KeyPrefix, id, millis(time.Now())))
+		if err != nil {
+			return n, err
+		}
+		n += ok
+	}
+	return n, nil
+}
+
+// Purge implements Backend.
+func (v *Valkey) Purge(ctx context.Context, status string, age time.Duration) (int64, error) {
+	conn, err := v.pool.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	statuses := []string{StatusDone, StatusFailed}
+	if status != "" {
+		statuses = []string{status}
+	}
+	cutoff := millis(time.Now().Add(-age))
+	var n int64
+	for _, st := range statuses {
+		ids, err := redigo.Strings(conn.Do("ZRANGEBYSCORE", KeyPrefix+st, "-inf", "("+strconv.FormatInt(cutoff, 10)))
+		if err != nil {
+			return n, err
+		}
+		for _, id := range ids {
+			if _, err := conn.Do("DEL", KeyPrefix+"job:"+id); err != nil {
+				return n, err
+			}
+			if _, err := conn.Do("ZREM", KeyPrefix+"all", id); err != nil {
+				return n, err
+			}
+			if _, err := conn.Do("ZREM", KeyPrefix+st, id); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// jobFromHash decodes a job hash; the id is in the "id" field.
+func jobFromHash(h map[string]string) Job {
+	num := func(k string) int64 {
+		n, _ := strconv.ParseInt(h[k], 10, 64)
+		return n
+	}
+	at := func(k string) *time.Time {
+		if num(k) == 0 {
+			return nil
+		}
+		t := time.UnixMilli(num(k))
+		return &t
+	}
+	return Job{
+		ID:          num("id"),
+		Kind:        h["kind"],
+		Args:        []byte(h["args"]),
+		Status:      h["status"],
+		UniqueKey:   h["unique_key"],
+		Attempts:    int(num("attempts")),
+		MaxAttempts: int(num("max_attempts")),
+		RunAt:       time.UnixMilli(num("run_at")),
+		LockedBy:    h["locked_by"],
+		LockedUntil: at("locked_until"),
+		LastError:   h["last_error"],
+		CreatedAt:   time.UnixMilli(num("created_at")),
+		StartedAt:   at("started_at"),
+		FinishedAt:  at("finished_at"),
+	}
+}
+
+// dialValkey connects like the session store does: rediss:// URLs, or any
+// URL when skipVerify is set, are dialled over TLS.
+func dialValkey(rawURL string, skipVerify bool) (redigo.Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (!strings.EqualFold(u.Scheme, "rediss") && !skipVerify) {
+		return redigo.DialURL(rawURL)
+	}
+	opts := []redigo.DialOption{redigo.DialUseTLS(true)}
+	if u.User != nil {
+		if pw, ok := u.User.Password(); ok {
+			opts = append(opts, redigo.DialPassword(pw))
+		}
+	}
+	if n, err := strconv.Atoi(strings.TrimPrefix(u.Path, "/")); err == nil {
+		opts = append(opts, redigo.DialDatabase(n))
+	}
+	if skipVerify {
+		opts = append(opts, redigo.DialTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+	}
+	return redigo.Dial("tcp", u.Host, opts...)
+}
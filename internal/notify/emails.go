@@ -0,0 +1,401 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	templ "github.com/a-h/templ"
+
+	"gothicforge3/internal/booking"
+)
+
+// Kinds of message, also the kind column of the notifications table.
+const (
+	KindConfirmation = "booking_confirmed"
+	KindReminder     = "payment_reminder"
+	KindCancellation = "booking_cancelled"
+	KindDisruption   = "trip_disruption"
+	KindOffer        = "waitlist_offer"
+)
+
+// text is one phrase of an email in Indonesian and in English.
+type text struct{ ID, EN string }
+
+func (t text) in(lang string) string {
+	if lang == "id" {
+		return t.ID
+	}
+	return t.EN
+}
+
+// fact is one labelled line of the summary table.
+type fact struct {
+	Label text
+	Value string
+}
+
+// email is a message's content before it is rendered. Every email carries
+// both languages, Indonesian first: bookings do not record which one the
+// customer reads.
+type email struct {
+	To      string
+	Subject text
+	Name    string
+	Lead    []text
+	Facts   []fact
+	Seats   []text
+	Action  text
+	URL     string
+	Note    text
+}
+
+var langs = []struct{ code, name string }{{"id", "Bahasa Indonesia"}, {"en", "English"}}
+
+// Body is the HTML email.
+func (e email) Body() templ.Component {
+	return templ.ComponentFunc(func(ctx context.Context, w io.Writer) error {
+		esc := templ.EscapeString[string]
+		_, _ = io.WriteString(w, "<!DOCTYPE html><html><head><meta charset=\"utf-8\"><meta name=\"viewport\" content=\"width=device-width\"><title>"+esc(e.Subject.EN)+"</title></head>")
+		_, _ = io.WriteString(w, "<body style=\"margin:0;padding:24px;background:#f4f5f7;font-family:Arial,Helvetica,sans-serif;color:#1f2937\">")
+		_, _ = io.WriteString(w, "<div style=\"max-width:600px;margin:0 auto;background:#fff;border-radius:8px;padding:24px\">")
+		for i, l := range langs {
+			if i > 0 {
+				_, _ = io.WriteString(w, "<hr style=\"border:none;border-top:1px solid #e5e7eb;margin:32px 0\">")
+			}
+			_, _ = io.WriteString(w, "<section lang=\""+l.code+"\">")
+			_, _ = io.WriteString(w, "<p style=\"font-size:12px;color:#6b7280;margin:0 0 8px\">"+l.name+"</p>")
+			_, _ = io.WriteString(w, "<h1 style=\"font-size:20px;margin:0 0 16px\">"+esc(e.Subject.in(l.code))+"</h1>")
+			_, _ = io.WriteString(w, "<p>"+esc(e.greeting(l.code))+"</p>")
+			for _, p := range e.Lead {
+				_, _ = io.WriteString(w, "<p>"+esc(p.in(l.code))+"</p>")
+			}
+			if len(e.Facts) > 0 {
+				_, _ = io.WriteString(w, "<table style=\"border-collapse:collapse;width:100%;margin:16px 0\">")
+				for _, f := range e.Facts {
+					_, _ = io.WriteString(w, "<tr><th style=\"text-align:left;padding:4px 12px 4px 0;color:#6b7280;font-weight:normal;vertical-align:top\">"+esc(f.Label.in(l.code))+"</th><td style=\"padding:4px 0\">"+esc(f.Value)+"</td></tr>")
+				}
+				_, _ = io.WriteString(w, "</table>")
+			}
+			if len(e.Seats) > 0 {
+				_, _ = io.WriteString(w, "<ul style=\"padding-left:20px\">")
+				for _, s := range e.Seats {
+					_, _ = io.WriteString(w, "<li>"+esc(s.in(l.code))+"</li>")
+				}
+				_, _ = io.WriteString(w, "</ul>")
+			}
+			if e.URL != "" {
+				_, _ = io.WriteString(w, "<p style=\"margin:24px 0\"><a href=\""+esc(e.URL)+"\" style=\"background:#2563eb;color:#fff;padding:10px 18px;border-radius:6px;text-decoration:none\">"+esc(e.Action.in(l.code))+"</a></p>")
+			}
+			if n := e.Note.in(l.code); n != "" {
+				_, _ = io.WriteString(w, "<p style=\"font-size:13px;color:#6b7280\">"+esc(n)+"</p>")
+			}
+			_, _ = io.WriteString(w, "</section>")
+		}
+		_, _ = io.WriteString(w, "</div></body></html>")
+		return nil
+	})
+}
+
+// Text is the plain-text alternative.
+func (e email) Text() string {
+	var b strings.Builder
+	for i, l := range langs {
+		if i > 0 {
+			b.WriteString("\n----------------------------------------\n\n")
+		}
+		b.WriteString(e.Subject.in(l.code) + "\n\n" + e.greeting(l.code) + "\n\n")
+		for _, p := range e.Lead {
+			b.WriteString(p.in(l.code) + "\n\n")
+		}
+		for _, f := range e.Facts {
+			b.WriteString(f.Label.in(l.code) + ": " + f.Value + "\n")
+		}
+		if len(e.Facts) > 0 {
+			b.WriteString("\n")
+		}
+		for _, s := range e.Seats {
+			b.WriteString("- " + s.in(l.code) + "\n")
+		}
+		if len(e.Seats) > 0 {
+			b.WriteString("\n")
+		}
+		if e.URL != "" {
+			b.WriteString(e.Action.in(l.code) + ": " + e.URL + "\n\n")
+		}
+		if n := e.Note.in(l.code); n != "" {
+			b.WriteString(n + "\n")
+		}
+	}
+	return b.String()
+}
+
+func (e email) greeting(lang string) string {
+	if e.Name == "" {
+		return text{"Halo,", "Hello,"}.in(lang)
+	}
+	return text{"Halo " + e.Name + ",", "Hello " + e.Name + ","}.in(lang)
+}
+
+// message renders e.
+func (e email) message() Message {
+	var b bytes.Buffer
+	_ = e.Body().Render(context.Background(), &b)
+	return Message{To: e.To, Subject: e.Subject.ID + " · " + e.Subject.EN, HTML: b.String(), Text: e.Text()}
+}
+
+// Confirmation tells the customer their booking is paid and their e-tickets are ready.
+func Confirmation(b booking.Booking, baseURL string) Message {
+	e := email{
+		To:      b.Contact.Email,
+		Name:    b.Contact.Name,
+		Subject: text{"Pemesanan " + b.Code + " terkonfirmasi", "Booking " + b.Code + " confirmed"},
+		Lead: []text{{"Pembayaran Anda sudah kami terima. Tunjukkan e-tiket beserta kartu identitas saat naik kereta.",
+			"We received your payment. Show your e-ticket and ID when you board."}},
+		Facts:  append(append([]fact{{text{"Kode booking", "Booking code"}, b.Code}}, tripFacts(b)...), fact{text{"Total dibayar", "Total paid"}, rupiah(b.Total)}),
+		Seats:  seatLines(b, b.Items, booking.ItemConfirmed),
+		Action: text{"Lihat e-tiket", "View e-tickets"},
+		URL:    baseURL + "/tickets/" + b.Code,
+		Note:   lookupNote(baseURL),
+	}
+	return e.message()
+}
+
+// Reminder asks the customer to pay before their seats are released.
+func Reminder(b booking.Booking, baseURL string) Message {
+	due := ""
+	if b.PaymentDueAt != nil {
+		due = clock(*b.PaymentDueAt)
+	}
+	e := email{
+		To:      b.Contact.Email,
+		Name:    b.Contact.Name,
+		Subject: text{"Segera bayar pemesanan " + b.Code, "Pay for booking " + b.Code + " soon"},
+		Lead: []text{{"Pemesanan Anda belum dibayar. Kursi akan dilepas jika pembayaran belum kami terima sebelum " + due + ".",
+			"Your booking is not paid yet. Its seats are released unless we receive payment by " + due + "."}},
+		Facts: append(append([]fact{{text{"Kode booking", "Booking code"}, b.Code}}, tripFacts(b)...),
+			fact{text{"Jumlah tagihan", "Amount due"}, rupiah(b.Total)}, fact{text{"Batas pembayaran", "Pay by"}, due}),
+		Action: text{"Bayar sekarang", "Pay now"},
+		URL:    baseURL + "/booking?code=" + b.Code,
+		Note:   lookupNote(baseURL),
+	}
+	return e.message()
+}
+
+// Cancellation confirms cancelled seats and the refund they are owed.
+func Cancellation(c booking.Cancellation, baseURL string) Message {
+	b := c.Booking
+	subject := text{"Kursi pada pemesanan " + b.Code + " dibatalkan", "Seats on booking " + b.Code + " cancelled"}
+	lead := text{"Sebagian kursi pada pemesanan Anda telah dibatalkan. Kursi lainnya tetap berlaku.",
+		"Some seats of your booking were cancelled. The other seats are still valid."}
+	if b.Status == booking.StatusCancelled {
+		subject = text{"Pemesanan " + b.Code + " dibatalkan", "Booking " + b.Code + " cancelled"}
+		lead = text{"Pemesanan Anda telah dibatalkan.", "Your booking was cancelled."}
+	}
+	ids := make([]string, len(c.Items))
+	for i, r := range c.Items {
+		ids[i] = r.ItemID
+	}
+	refund := text{"Tidak ada pengembalian dana untuk kursi ini.", "These seats are not refunded."}
+	if c.Refund > 0 {
+		refund = text{"Dana sebesar " + rupiah(c.Refund) + " dikembalikan ke metode pembayaran semula dalam beberapa hari kerja.",
+			rupiah(c.Refund) + " goes back to the original payment method within a few working days."}
+	}
+	e := email{
+		To:      b.Contact.Email,
+		Name:    b.Contact.Name,
+		Subject: subject,
+		Lead:    []text{lead, refund},
+		Facts:   append(append([]fact{{text{"Kode booking", "Booking code"}, b.Code}}, tripFacts(b)...), fact{text{"Pengembalian dana", "Refund"}, rupiah(c.Refund)}),
+		Seats:   seatLines(b, itemsByID(b.Items, ids), ""),
+		Action:  text{"Lihat pemesanan", "View booking"},
+		URL:     baseURL + "/booking?code=" + b.Code,
+	}
+	return e.message()
+}
+
+// Disruption tells a passenger what a delay or cancellation of their train
+// did to their booking and what they may still do about it.
+func Disruption(n booking.DisruptionNotice, baseURL string) Message {
+	d, r := n.Disruption, n.Booking
+	t := d.Trip
+	train := t.TrainName + " (" + t.TrainCode + ")"
+	subject := text{"Kereta " + t.TrainCode + " tanggal " + t.ServiceDate + " dibatalkan", "Train " + t.TrainCode + " on " + t.ServiceDate + " cancelled"}
+	if d.Kind == booking.DisruptionDelay {
+		subject = text{"Kereta " + t.TrainCode + " tanggal " + t.ServiceDate + " terlambat", "Train " + t.TrainCode + " on " + t.ServiceDate + " delayed"}
+	}
+	var lead []text
+	switch r.Outcome {
+	case booking.OutcomeMoved:
+		dep := ""
+		if r.NewDeparture != nil {
+			dep = clock(*r.NewDeparture)
+		}
+		lead = []text{{"Kereta Anda dibatalkan. Kami memindahkan Anda tanpa biaya ke kereta " + r.NewTrain + " yang berangkat " + dep + ", dengan kode booking yang sama.",
+			"Your train was cancelled. We moved you at no cost to train " + r.NewTrain + " leaving " + dep + ", under the same booking code."}}
+		if r.Refund > 0 {
+			lead = append(lead, text{"Selisih harga " + rupiah(r.Refund) + " kami kembalikan.", "We refund the fare difference of " + rupiah(r.Refund) + "."})
+		}
+	case booking.OutcomeRefunded:
+		lead = []text{{"Kereta Anda dibatalkan dan pemesanan Anda dibatalkan dengan pengembalian dana penuh sebesar " + rupiah(r.Refund) + ".",
+			"Your train was cancelled, so your booking was cancelled with a full refund of " + rupiah(r.Refund) + "."}}
+	case booking.OutcomeCancelled:
+		lead = []text{{"Kereta Anda dibatalkan. Pemesanan Anda yang belum dibayar ikut dibatalkan; tidak ada yang perlu dibayar.",
+			"Your train was cancelled. Your unpaid booking was cancelled too; there is nothing to pay."}}
+	default:
+		delay := strconv.Itoa(d.DelayMinutes)
+		lead = []text{{"Kereta Anda terlambat sekitar " + delay + " menit.", "Your train is delayed by about " + delay + " minutes."}}
+	}
+	if d.Reason != "" {
+		lead = append(lead, text{"Keterangan: " + d.Reason, "Details: " + d.Reason})
+	}
+	if r.OfferUntil != nil {
+		until := clock(*r.OfferUntil)
+		if r.Outcome == booking.OutcomeMoved {
+			lead = append(lead, text{"Jika jadwal baru tidak sesuai, hingga " + until + " Anda dapat membatalkan dengan pengembalian dana penuh.",
+				"If the new train does not suit you, you may cancel for a full refund until " + until + "."})
+		} else {
+			lead = append(lead, text{"Hingga " + until + " Anda dapat pindah ke jadwal lain tanpa biaya atau membatalkan dengan pengembalian dana penuh.",
+				"Until " + until + " you may change to another departure free of charge or cancel for a full refund."})
+		}
+	}
+	seats := make([]text, len(r.Passengers))
+	for i, p := range r.Passengers {
+		seats[i] = seatLine(p.CoachNo, p.SeatNo, p.Class, p.Name)
+	}
+	e := email{
+		To:      r.Contact.Email,
+		Name:    r.Contact.Name,
+		Subject: subject,
+		Lead:    lead,
+		Facts: []fact{
+			{text{"Kode booking", "Booking code"}, r.Code},
+			{text{"Kereta", "Train"}, train},
+			{text{"Perjalanan", "Journey"}, t.OriginName + " (" + t.Origin + ") " + t.Depart + " → " + t.DestinationName + " (" + t.Destination + ") " + t.Arrive},
+			{text{"Tanggal", "Date"}, t.ServiceDate},
+		},
+		Seats:  seats,
+		Action: text{"Lihat pemesanan", "View booking"},
+		URL:    baseURL + "/booking?code=" + r.Code,
+		Note:   lookupNote(baseURL),
+	}
+	return e.message()
+}
+
+// Offer tells a waitlisted customer that seats are held for them.
+func Offer(o booking.WaitlistOffer, baseURL string) Message {
+	en := o.Entry
+	t := en.Trip
+	until := ""
+	if en.OfferUntil != nil {
+		until = clock(*en.OfferUntil)
+	}
+	seats := strconv.Itoa(en.Seats)
+	e := email{
+		To:      en.Email,
+		Subject: text{"Kursi " + t.TrainCode + " tersedia untuk Anda", "Seats on " + t.TrainCode + " are waiting for you"},
+		Lead: []text{{"Kami menahan " + seats + " kursi kelas " + en.Class + " untuk Anda hingga " + until + ". Selesaikan pemesanan sebelum waktu itu atau kursi ditawarkan ke pelanggan berikutnya.",
+			"We are holding " + seats + " " + en.Class + " seats for you until " + until + ". Complete the booking by then or they go to the next customer in line."}},
+		Facts: []fact{
+			{text{"Kereta", "Train"}, t.TrainName + " (" + t.TrainCode + ")"},
+			{text{"Perjalanan", "Journey"}, en.From + " → " + en.To},
+			{text{"Tanggal", "Date"}, t.ServiceDate},
+		},
+		Action: text{"Lanjutkan pemesanan", "Continue booking"},
+		URL:    baseURL + "/waitlist",
+	}
+	return e.message()
+}
+
+// tripFacts describes the booked trains.
+func tripFacts(b booking.Booking) []fact {
+	trips := []booking.TripInfo{b.Trip}
+	if len(b.Legs) > 0 {
+		trips = trips[:0]
+		for _, l := range b.Legs {
+			trips = append(trips, l.Trip)
+		}
+	}
+	var out []fact
+	for _, t := range trips {
+		out = append(out,
+			fact{text{"Kereta", "Train"}, t.TrainName + " (" + t.TrainCode + ")"},
+			fact{text{"Perjalanan", "Journey"}, t.OriginName + " (" + t.Origin + ") " + t.Depart + " → " + t.DestinationName + " (" + t.Destination + ") " + t.Arrive},
+			fact{text{"Tanggal", "Date"}, t.ServiceDate})
+	}
+	return out
+}
+
+// seatLines lists items with the given status (any when empty), with the
+// train for journeys.
+func seatLines(b booking.Booking, items []booking.Item, status string) []text {
+	var out []text
+	for _, it := range items {
+		if status != "" && it.Status != status {
+			continue
+		}
+		name := ""
+		if it.Passenger != nil {
+			name = it.Passenger.Name
+		}
+		l := seatLine(it.CoachNo, it.SeatNo, it.Class, name)
+		if len(b.Legs) > 1 {
+			code := b.TripOf(it.TripID).TrainCode
+			l = text{code + ": " + l.ID, code + ": " + l.EN}
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+func seatLine(coach int, seat, class, name string) text {
+	c := strconv.Itoa(coach)
+	l := text{"Gerbong " + c + " kursi " + seat + " · " + class, "Coach " + c + " seat " + seat + " · " + class}
+	if name != "" {
+		l.ID, l.EN = l.ID+" · "+name, l.EN+" · "+name
+	}
+	return l
+}
+
+func itemsByID(items []booking.Item, ids []string) []booking.Item {
+	want := map[string]bool{}
+	for _, id := range ids {
+		want[id] = true
+	}
+	var out []booking.Item
+	for _, it := range items {
+		if want[it.ID] {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+func lookupNote(baseURL string) text {
+	return text{"Belum masuk? Buka " + baseURL + "/account/bookings dan cari pemesanan dengan kodenya dan email ini.",
+		"Not signed in? Open " + baseURL + "/account/bookings and look the booking up with its code and this email."}
+}
+
+// clock formats a time for customers in the server's time zone.
+func clock(t time.Time) string { return t.Local().Format("2006-01-02 15:04") }
+
+// rupiah formats an amount like Rp150.000.
+func rupiah(v int64) string {
+	s := strconv.FormatInt(v, 10)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	var b strings.Builder
+	for i := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteByte(s[i])
+	}
+	if neg {
+		return "-Rp" + b.String()
+	}
+	return "Rp" + b.String()
+}
@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/outbox"
+)
+
+// HandleEvents registers s with the outbox: a paid booking gets its
+// confirmation and cancelled seats their cancellation email. Sends are
+// recorded once per message, so the outbox may deliver an event again.
+func (s *Service) HandleEvents() {
+	outbox.Handle(booking.EventTopic(booking.EventPaid), "notify.email", s.onPaid)
+	outbox.Handle(booking.EventTopic(booking.EventCancelled), "notify.email", s.onCancelled)
+	outbox.Handle(booking.EventTopic(booking.EventSeatsCancelled), "notify.email", s.onCancelled)
+}
+
+func (s *Service) onPaid(ctx context.Context, m outbox.Message) error {
+	var ev booking.BookingEvent
+	if err := json.Unmarshal(m.Payload, &ev); err != nil {
+		return err
+	}
+	b, err := booking.GetBookingByID(ctx, s.DB, ev.BookingID)
+	if err != nil || b.Status != booking.StatusPaid {
+		return err // cancelled or expired since: nothing to confirm
+	}
+	return s.BookingConfirmed(ctx, b)
+}
+
+// onCancelled rebuilds the cancellation from the event. Cancellations the
+// disruption workflow makes itself (full_refund) are covered by its own email.
+func (s *Service) onCancelled(ctx context.Context, m outbox.Message) error {
+	var ev struct {
+		BookingID string `json:"booking_id"`
+		Detail    struct {
+			Items      []string `json:"items"`
+			Refund     int64    `json:"refund"`
+			FullRefund bool     `json:"full_refund"`
+		} `json:"detail"`
+	}
+	if err := json.Unmarshal(m.Payload, &ev); err != nil {
+		return err
+	}
+	if ev.Detail.FullRefund || len(ev.Detail.Items) == 0 {
+		return nil
+	}
+	b, err := booking.GetBookingByID(ctx, s.DB, ev.BookingID)
+	if err != nil {
+		return err
+	}
+	c := booking.Cancellation{Booking: b, Refund: ev.Detail.Refund}
+	for _, id := range ev.Detail.Items {
+		c.Items = append(c.Items, booking.ItemRefund{ItemID: id})
+	}
+	return s.BookingCancelled(ctx, c)
+}
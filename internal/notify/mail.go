@@ -0,0 +1,196 @@
+// Package notify tells customers about their bookings by email: booking
+// confirmations, payment reminders, cancellations, trip disruptions and
+// waitlist offers. Messages are Templ components rendered in Indonesian and
+// English and sent through a Transport, SMTP (a local catcher such as
+// MailHog in development) or the server log when SMTP_HOST is unset.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"gothicforge3/internal/env"
+)
+
+// Message is one email, with an HTML body and its plain-text alternative.
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Transport delivers messages.
+type Transport interface {
+	Name() string
+	Send(ctx context.Context, m Message) error
+}
+
+// TransportFromEnv returns SMTP when SMTP_HOST is set and LogTransport otherwise.
+func TransportFromEnv() Transport {
+	host := strings.TrimSpace(env.Get("SMTP_HOST", ""))
+	if host == "" {
+		return LogTransport{}
+	}
+	return &SMTP{
+		Addr:     net.JoinHostPort(host, strings.TrimSpace(env.Get("SMTP_PORT", "1025"))),
+		Username: strings.TrimSpace(env.Get("SMTP_USERNAME", "")),
+		Password: env.Get("SMTP_PASSWORD", ""),
+		From:     From(),
+	}
+}
+
+// From returns the sender address (MAIL_FROM).
+func From() string {
+	return strings.TrimSpace(env.Get("MAIL_FROM", "Kereta <no-reply@localhost>"))
+}
+
+// LogTransport writes messages to the server log instead of sending them.
+type LogTransport struct{}
+
+// Name implements Transport.
+func (LogTransport) Name() string { return "log" }
+
+// Send implements Transport.
+func (LogTransport) Send(_ context.Context, m Message) error {
+	log.Printf("mail: to %s: %s", m.To, m.Subject)
+	return nil
+}
+
+// SMTP sends through a mail server. Servers that offer STARTTLS are talked
+// to over TLS; credentials are only sent when Username is set.
+type SMTP struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+// Name implements Transport.
+func (s *SMTP) Name() string { return "smtp" }
+
+// Send implements Transport.
+func (s *SMTP) Send(ctx context.Context, m Message) error {
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("notify: bad MAIL_FROM: %w", err)
+	}
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return fmt.Errorf("notify: bad recipient: %w", err)
+	}
+	body, err := Compose(from, to, m, time.Now())
+	if err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	host, _, _ := net.SplitHostPort(s.Addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Compose builds the MIME message: multipart/alternative with the text
+// part first, both quoted-printable.
+func Compose(from, to *mail.Address, m Message, now time.Time) ([]byte, error) {
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	hdr := func(k, v string) { fmt.Fprintf(&b, "%s: %s\r\n", k, v) }
+	hdr("From", from.String())
+	hdr("To", to.String())
+	hdr("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	hdr("Date", now.Format(time.RFC1123Z))
+	hdr("Message-ID", "<"+randomID()+"@"+domainOf(from.Address)+">")
+	hdr("MIME-Version", "1.0")
+	hdr("Content-Type", `multipart/alternative; boundary="`+mw.Boundary()+`"`)
+	b.WriteString("\r\n")
+	for _, part := range []struct{ ct, body string }{{"text/plain", m.Text}, {"text/html", m.HTML}} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.ct + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func domainOf(addr string) string {
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		return addr[i+1:]
+	}
+	return "localhost"
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
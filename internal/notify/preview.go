@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"time"
+
+	"gothicforge3/internal/booking"
+)
+
+// Preview is one template rendered with fixture data, for /dev/mail.
+type Preview struct {
+	Name    string
+	Title   string
+	Message Message
+}
+
+// Previews renders every template with made-up bookings.
+func Previews(baseURL string) []Preview {
+	now := time.Now().Truncate(time.Minute)
+	due := now.Add(8 * time.Minute)
+	until := now.Add(3 * time.Hour)
+	later := now.Add(26 * time.Hour)
+	trip := booking.TripInfo{
+		TrainCode: "KA 7", TrainName: "Argo Bromo Anggrek", Origin: "GMR", OriginName: "Gambir",
+		Destination: "SBI", DestinationName: "Surabaya Pasarturi", ServiceDate: now.Add(24 * time.Hour).Format("2006-01-02"),
+		Depart: "08:20", Arrive: "16:05", Status: "scheduled",
+	}
+	contact := booking.Contact{Name: "Siti Rahayu", Email: "siti@example.com", Phone: "+6281234567890"}
+	items := []booking.Item{
+		{ID: "item-1", CoachNo: 2, SeatNo: "4A", Class: "eksekutif", Price: 550000, Status: booking.ItemConfirmed,
+			Passenger: &booking.Passenger{Name: "Siti Rahayu"}},
+		{ID: "item-2", CoachNo: 2, SeatNo: "4B", Class: "eksekutif", Price: 550000, Status: booking.ItemConfirmed,
+			Passenger: &booking.Passenger{Name: "Budi Santoso"}},
+	}
+	paid := booking.Booking{
+		ID: "00000000-0000-4000-8000-000000000001", Code: "KAI7Q2", Status: booking.StatusPaid, Total: 1100000,
+		Contact: contact, CreatedAt: now, PaidAt: &now, Trip: trip, Items: items,
+	}
+	pending := paid
+	pending.Status, pending.PaidAt, pending.PaymentDueAt = booking.StatusPending, nil, &due
+
+	partial := paid
+	partial.Items = []booking.Item{items[0], items[1]}
+	partial.Items[1].Status, partial.Items[1].Refund = booking.ItemCancelled, 412500
+	partial.Refunded = 412500
+
+	passengers := []booking.DisruptedPassenger{{Name: "Siti Rahayu", Class: "eksekutif", CoachNo: 2, SeatNo: "4A"},
+		{Name: "Budi Santoso", Class: "eksekutif", CoachNo: 2, SeatNo: "4B"}}
+	cancelled := booking.Disruption{ID: "d-1", Trip: trip, Kind: booking.DisruptionCancel, Reason: "Banjir di lintas Semarang"}
+	delayed := booking.Disruption{ID: "d-2", Trip: trip, Kind: booking.DisruptionDelay, DelayMinutes: 95, Reason: "Gangguan persinyalan"}
+	affected := booking.DisruptedBooking{BookingID: paid.ID, Code: paid.Code, Contact: contact, Passengers: passengers}
+	moved, refunded, delay := affected, affected, affected
+	moved.Outcome, moved.NewTrain, moved.NewDeparture, moved.OfferUntil = booking.OutcomeMoved, "KA 9 Argo Bromo Anggrek", &later, &later
+	refunded.Outcome, refunded.Refund = booking.OutcomeRefunded, 1100000
+	delay.Outcome, delay.OfferUntil = booking.OutcomeNotified, &until
+
+	entry := booking.WaitlistEntry{ID: "w-1", From: "GMR", To: "SBI", Trip: trip, Class: "eksekutif", Seats: 2,
+		Email: "siti@example.com", Status: "offered", OfferUntil: &until}
+
+	return []Preview{
+		{"confirmation", "Booking confirmed", Confirmation(paid, baseURL)},
+		{"payment-reminder", "Payment reminder", Reminder(pending, baseURL)},
+		{"cancellation", "Booking cancelled", Cancellation(booking.Cancellation{
+			Booking: booking.Booking{ID: paid.ID, Code: paid.Code, Status: booking.StatusCancelled, Total: paid.Total, Contact: contact, Trip: trip, Items: items},
+			Items:   []booking.ItemRefund{{ItemID: "item-1", Percent: 75, Amount: 412500}, {ItemID: "item-2", Percent: 75, Amount: 412500}},
+			Refund:  825000,
+		}, baseURL)},
+		{"cancellation-partial", "Seats cancelled", Cancellation(booking.Cancellation{
+			Booking: partial, Items: []booking.ItemRefund{{ItemID: "item-2", Percent: 75, Amount: 412500}}, Refund: 412500,
+		}, baseURL)},
+		{"disruption-moved", "Train cancelled, passenger moved", Disruption(booking.DisruptionNotice{Disruption: cancelled, Booking: moved}, baseURL)},
+		{"disruption-refunded", "Train cancelled, booking refunded", Disruption(booking.DisruptionNotice{Disruption: cancelled, Booking: refunded}, baseURL)},
+		{"disruption-delay", "Train delayed", Disruption(booking.DisruptionNotice{Disruption: delayed, Booking: delay}, baseURL)},
+		{"waitlist-offer", "Waitlist offer", Offer(booking.WaitlistOffer{Entry: entry}, baseURL)},
+	}
+}
@@ -0,0 +1,150 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/env"
+	"gothicforge3/internal/textx"
+)
+
+// Service renders and sends customer emails. Each one is recorded in the
+// notifications table under its kind and ref, so a trigger that fires twice
+// sends it once; a message whose send failed is tried again the next time.
+// It implements booking.Notifier.
+type Service struct {
+	Transport Transport
+	DB        booking.Querier
+	BaseURL   string // absolute site URL links in emails point at
+}
+
+// New returns a Service with the transport from the environment (see
+// TransportFromEnv) recording sends in db.
+func New(db booking.Querier) *Service {
+	return &Service{Transport: TransportFromEnv(), DB: db, BaseURL: BaseURL()}
+}
+
+// BaseURL returns SITE_BASE_URL without a trailing slash.
+func BaseURL() string {
+	return strings.TrimRight(strings.TrimSpace(env.Get("SITE_BASE_URL", "http://127.0.0.1:8080")), "/")
+}
+
+// ReminderLead returns how long before a pending booking's payment deadline
+// its reminder goes out (PAYMENT_REMINDER_MINUTES, default 10 minutes).
+func ReminderLead() time.Duration {
+	if n, err := strconv.Atoi(strings.TrimSpace(env.Get("PAYMENT_REMINDER_MINUTES", ""))); err == nil && n > 0 {
+		return time.Duration(n) * time.Minute
+	}
+	return 10 * time.Minute
+}
+
+// BookingConfirmed sends the confirmation of a paid booking.
+func (s *Service) BookingConfirmed(ctx context.Context, b booking.Booking) error {
+	return s.send(ctx, KindConfirmation, b.ID, b.ID, Confirmation(b, s.BaseURL))
+}
+
+// PaymentReminder reminds the customer to pay a pending booking.
+func (s *Service) PaymentReminder(ctx context.Context, b booking.Booking) error {
+	return s.send(ctx, KindReminder, b.ID, b.ID, Reminder(b, s.BaseURL))
+}
+
+// BookingCancelled confirms a cancellation. Seats are cancelled once, so the
+// first cancelled item identifies it.
+func (s *Service) BookingCancelled(ctx context.Context, c booking.Cancellation) error {
+	if len(c.Items) == 0 {
+		return nil
+	}
+	return s.send(ctx, KindCancellation, c.Items[0].ItemID, c.Booking.ID, Cancellation(c, s.BaseURL))
+}
+
+// NotifyDisruption implements booking.Notifier.
+func (s *Service) NotifyDisruption(ctx context.Context, n booking.DisruptionNotice) error {
+	return s.send(ctx, KindDisruption, n.Disruption.ID+":"+n.Booking.BookingID, n.Booking.BookingID, Disruption(n, s.BaseURL))
+}
+
+// NotifyOffer implements booking.Notifier.
+func (s *Service) NotifyOffer(ctx context.Context, o booking.WaitlistOffer) error {
+	ref := o.Entry.ID
+	if o.Entry.OfferUntil != nil {
+		ref += ":" + strconv.FormatInt(o.Entry.OfferUntil.Unix(), 10)
+	}
+	return s.send(ctx, KindOffer, ref, "", Offer(o, s.BaseURL))
+}
+
+// send claims (kind, ref), sends m and records the result.
+func (s *Service) send(ctx context.Context, kind, ref, bookingID string, m Message) error {
+	if strings.TrimSpace(m.To) == "" {
+		return nil
+	}
+	var bid any
+	if bookingID != "" {
+		bid = bookingID
+	}
+	var id int64
+	err := s.DB.QueryRow(ctx, `
+INSERT INTO notifications (booking_id, kind, ref, recipient, subject) VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (kind, ref) DO UPDATE SET status = 'sending', error = '', recipient = EXCLUDED.recipient, subject = EXCLUDED.subject
+WHERE notifications.status = 'failed'
+RETURNING id`, bid, kind, ref, m.To, textx.Truncate(m.Subject, 255)).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil // already sent, or being sent
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.Transport.Send(ctx, m); err != nil {
+		if _, uerr := s.DB.Exec(context.WithoutCancel(ctx), `UPDATE notifications SET status = 'failed', error = $2 WHERE id = $1`, id, textx.Truncate(err.Error(), 500)); uerr != nil {
+			log.Printf("notify: recording failed %s %s: %v", kind, ref, uerr)
+		}
+		return err
+	}
+	_, err = s.DB.Exec(ctx, `UPDATE notifications SET status = 'sent', sent_at = now() WHERE id = $1`, id)
+	return err
+}
+
+// SendReminders emails every pending booking whose payment deadline is less
+// than ReminderLead away and that was not reminded yet. It returns how many
+// were sent.
+func (s *Service) SendReminders(ctx context.Context) (int, error) {
+	rows, err := s.DB.Query(ctx, `
+SELECT b.id::TEXT FROM bookings b
+WHERE b.status = 'pending' AND b.payment_due_at > now() AND b.payment_due_at <= now() + ($1::INT8 * INTERVAL '1 second')
+  AND NOT EXISTS (SELECT 1 FROM notifications n WHERE n.kind = $2 AND n.ref = b.id::TEXT AND n.status <> 'failed')
+ORDER BY b.payment_due_at`, int64(ReminderLead()/time.Second), KindReminder)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, id := range ids {
+		b, err := booking.GetBookingByID(ctx, s.DB, id)
+		if err != nil {
+			return sent, err
+		}
+		if err := s.PaymentReminder(ctx, b); err != nil {
+			log.Printf("notify: reminder for %s: %v", b.Code, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
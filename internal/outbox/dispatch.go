@@ -0,0 +1,122 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/env"
+	"gothicforge3/internal/textx"
+)
+
+// MaxAttempts returns how often a message is tried before it is marked dead
+// (OUTBOX_MAX_ATTEMPTS, default 10). Retries back off from 15 seconds,
+// doubling each time up to an hour, so the default gives up after about two hours.
+func MaxAttempts() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(env.Get("OUTBOX_MAX_ATTEMPTS", ""))); err == nil && n > 0 {
+		return n
+	}
+	return 10
+}
+
+// Retention returns how long delivered messages are kept
+// (OUTBOX_RETENTION_DAYS, default 7 days).
+func Retention() time.Duration {
+	if n, err := strconv.Atoi(strings.TrimSpace(env.Get("OUTBOX_RETENTION_DAYS", ""))); err == nil && n > 0 {
+		return time.Duration(n) * 24 * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// handlerTimeout bounds one delivery.
+const handlerTimeout = 30 * time.Second
+
+// Backoff is the wait before retrying a message that failed attempts times.
+func Backoff(attempts int) time.Duration {
+	return min(15*time.Second<<min(max(attempts-1, 0), 10), time.Hour)
+}
+
+// Dispatch delivers up to limit due messages, oldest first, one transaction
+// each. A message stays locked (FOR UPDATE SKIP LOCKED) while its handlers
+// run, so concurrent dispatchers never deliver it twice at once. Failures
+// are retried with Backoff, running only the handlers that failed; after
+// MaxAttempts the message is dead. It returns how many messages were
+// delivered and how many failed this pass.
+func Dispatch(ctx context.Context, db DB, limit int) (delivered, failed int, err error) {
+	maxAttempts := MaxAttempts()
+	for i := 0; i < limit; i++ {
+		var found bool
+		err = pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+			m, err := scanMessage(tx.QueryRow(ctx, `
+SELECT `+messageCols+` FROM outbox
+WHERE status = 'pending' AND available_at <= now()
+ORDER BY available_at, id
+LIMIT 1
+FOR UPDATE SKIP LOCKED`))
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			found = true
+
+			hctx, cancel := context.WithTimeout(ctx, handlerTimeout)
+			done, derr := Deliver(hctx, m)
+			cancel()
+			if derr == nil {
+				delivered++
+				_, err := tx.Exec(ctx, `UPDATE outbox SET status = 'delivered', attempts = attempts + 1, last_error = '', done = $2, delivered_at = now() WHERE id = $1`, m.ID, done)
+				return err
+			}
+
+			attempts := m.Attempts + 1
+			status := StatusPending
+			failed++
+			if attempts >= maxAttempts {
+				status = StatusDead
+				log.Printf("outbox: giving up on message %d (%s %s): %v", m.ID, m.Topic, m.Ref, derr)
+			}
+			_, err = tx.Exec(ctx, `
+UPDATE outbox SET status = $2, attempts = $3, last_error = $4, done = $6, available_at = now() + ($5::INT8 * INTERVAL '1 second')
+WHERE id = $1`, m.ID, status, attempts, textx.Truncate(derr.Error(), 1000), int64(Backoff(attempts)/time.Second), done)
+			return err
+		})
+		if err != nil || !found {
+			return delivered, failed, err
+		}
+	}
+	return delivered, failed, nil
+}
+
+// Run calls Dispatch every interval until ctx is done, and purges delivered
+// messages older than Retention once an hour.
+func Run(ctx context.Context, db DB, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	var purged time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			delivered, failed, err := Dispatch(ctx, db, 100)
+			if err != nil {
+				log.Printf("outbox: dispatch failed: %v", err)
+			} else if failed > 0 {
+				log.Printf("outbox: %d delivered, %d failed", delivered, failed)
+			}
+			if time.Since(purged) >= time.Hour {
+				purged = time.Now()
+				if _, err := Purge(ctx, db, Retention()); err != nil {
+					log.Printf("outbox: purge failed: %v", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Package outbox delivers the side effects of state changes reliably. A
+// change writes its messages with Enqueue in the same transaction, so they
+// exist exactly when the change committed; a dispatcher then hands each one
+// to the handlers registered for its topic, retrying with backoff and
+// setting it aside as dead after MaxAttempts.
+//
+// Every handler of a topic is tracked on its own: a retry runs only the
+// handlers that have not succeeded for the message yet. Delivery is still at
+// least once per handler, so handlers must be idempotent.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Querier is the subset of pgxpool.Pool / pgx.Tx used by this package.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// DB is a Querier that can also start transactions.
+type DB interface {
+	Querier
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Message statuses.
+const (
+	StatusPending   = "pending"   // waiting for its first or next attempt
+	StatusDelivered = "delivered" // every handler succeeded
+	StatusDead      = "dead"      // gave up after MaxAttempts; replay to try again
+)
+
+// Message is one side effect waiting for or done with delivery.
+type Message struct {
+	ID          int64           `json:"id"`
+	Topic       string          `json:"topic"`
+	Ref         string          `json:"ref,omitempty"` // what it is about, e.g. a booking id
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	Done        []string        `json:"done,omitempty"` // handlers that succeeded for it
+	AvailableAt time.Time       `json:"available_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	DeliveredAt *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// Handler delivers one message.
+type Handler func(ctx context.Context, m Message) error
+
+type namedHandler struct {
+	name string
+	h    Handler
+}
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = map[string][]namedHandler{}
+)
+
+// Handle registers h as name for messages on topic. A topic may have several
+// handlers; messages on a topic without any are delivered as they are. The
+// name records that h succeeded for a message, so it must be unique within
+// the topic and stay the same across deploys.
+func Handle(topic, name string, h Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[topic] = append(handlers[topic], namedHandler{name, h})
+}
+
+// Topics lists the topics with handlers.
+func Topics() []string {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	out := make([]string, 0, len(handlers))
+	for t := range handlers {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Deliver runs the handlers of m's topic not in m.Done, in registration
+// order. A failing or panicking handler does not stop the ones after it. It
+// returns m.Done with the handlers that succeeded now, and the first error.
+func Deliver(ctx context.Context, m Message) ([]string, error) {
+	handlersMu.RLock()
+	hs := handlers[m.Topic]
+	handlersMu.RUnlock()
+	done := slices.Clone(m.Done)
+	var first error
+	for _, h := range hs {
+		if slices.Contains(done, h.name) {
+			continue
+		}
+		if err := run(ctx, h.h, m); err != nil {
+			if first == nil {
+				first = fmt.Errorf("%s: %w", h.name, err)
+			}
+			continue
+		}
+		done = append(done, h.name)
+	}
+	return done, first
+}
+
+func run(ctx context.Context, h Handler, m Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return h(ctx, m)
+}
+
+// Enqueue writes a message for topic with payload marshalled as JSON. Pass
+// the transaction that makes the change the message is about.
+func Enqueue(ctx context.Context, db Querier, topic, ref string, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx, `INSERT INTO outbox (topic, ref, payload) VALUES ($1, $2, $3::JSONB)`, topic, ref, string(b))
+	return err
+}
+
+const messageCols = `id, topic, ref, payload::TEXT, status, attempts, last_error, done, available_at, created_at, delivered_at`
+
+func scanMessage(row pgx.Row) (Message, error) {
+	var (
+		m       Message
+		payload string
+	)
+	err := row.Scan(&m.ID, &m.Topic, &m.Ref, &payload, &m.Status, &m.Attempts, &m.LastError, &m.Done, &m.AvailableAt, &m.CreatedAt, &m.DeliveredAt)
+	m.Payload = json.RawMessage(payload)
+	return m, err
+}
+
+// ErrNotFound is returned by Get for an unknown id.
+var ErrNotFound = errors.New("outbox: message not found")
+
+// Get loads one message.
+func Get(ctx context.Context, db Querier, id int64) (Message, error) {
+	m, err := scanMessage(db.QueryRow(ctx, `SELECT `+messageCols+` FROM outbox WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return m, ErrNotFound
+	}
+	return m, err
+}
+
+// Filter narrows List. An empty Status lists the messages not delivered yet.
+type Filter struct {
+	Status string
+	Topic  string
+	Ref    string
+	Limit  int
+}
+
+// List returns messages matching f, oldest first.
+func List(ctx context.Context, db Querier, f Filter) ([]Message, error) {
+	where, args := []string{"status <> 'delivered'"}, []any{}
+	if f.Status != "" {
+		args = append(args, f.Status)
+		where[0] = fmt.Sprintf("status = $%d", len(args))
+	}
+	if f.Topic != "" {
+		args = append(args, f.Topic)
+		where = append(where, fmt.Sprintf("topic = $%d", len(args)))
+	}
+	if f.Ref != "" {
+		args = append(args, f.Ref)
+		where = append(where, fmt.Sprintf("ref = $%d", len(args)))
+	}
+	if f.Limit <= 0 {
+		f.Limit = 50
+	}
+	args = append(args, f.Limit)
+	rows, err := db.Query(ctx, `SELECT `+messageCols+` FROM outbox WHERE `+strings.Join(where, " AND ")+
+		fmt.Sprintf(` ORDER BY id LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Message{}
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// Stat counts the messages of one topic in one status.
+type Stat struct {
+	Topic  string
+	Status string
+	Count  int64
+	Oldest time.Time // created_at of the oldest
+}
+
+// Stats counts messages per topic and status.
+func Stats(ctx context.Context, db Querier) ([]Stat, error) {
+	rows, err := db.Query(ctx, `SELECT topic, status, count(*), min(created_at) FROM outbox GROUP BY topic, status ORDER BY topic, status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Stat
+	for rows.Next() {
+		var s Stat
+		if err := rows.Scan(&s.Topic, &s.Status, &s.Count, &s.Oldest); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// Replay makes messages due again with a fresh set of attempts: the given
+// ids, or with none every dead message (of topic, when set). A dead message
+// retries only the handlers that had not succeeded; delivered messages are
+// replayed only by id, and run every handler again. It returns how many were
+// reset.
+func Replay(ctx context.Context, db Querier, topic string, ids ...int64) (int64, error) {
+	const reset = `UPDATE outbox SET done = CASE WHEN status = 'delivered' THEN '{}' ELSE done END,
+    status = 'pending', attempts = 0, last_error = '', available_at = now(), delivered_at = NULL WHERE `
+	var (
+		tag pgconn.CommandTag
+		err error
+	)
+	if len(ids) > 0 {
+		tag, err = db.Exec(ctx, reset+`id = ANY($1)`, ids)
+	} else {
+		tag, err = db.Exec(ctx, reset+`status = 'dead' AND ($1::TEXT = '' OR topic = $1::TEXT)`, topic)
+	}
+	return tag.RowsAffected(), err
+}
+
+// Purge deletes messages delivered longer than age ago and returns how many.
+func Purge(ctx context.Context, db Querier, age time.Duration) (int64, error) {
+	tag, err := db.Exec(ctx, `DELETE FROM outbox WHERE status = 'delivered' AND delivered_at < now() - ($1::INT8 * INTERVAL '1 second')`, int64(age/time.Second))
+	return tag.RowsAffected(), err
+}
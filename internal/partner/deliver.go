@@ -0,0 +1,407 @@
+package partner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/env"
+	"gothicforge3/internal/outbox"
+	"gothicforge3/internal/textx"
+)
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"   // waiting for its first or next attempt
+	StatusDelivered = "delivered" // the receiver answered 2xx
+	StatusFailed    = "failed"    // gave up after MaxAttempts; resend to try again
+)
+
+// Delivery is one event sent, or to be sent, to one subscription.
+type Delivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	EventID        string          `json:"event_id"`
+	Event          string          `json:"event"`
+	BookingID      string          `json:"booking_id,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	ResentFrom     *int64          `json:"resent_from,omitempty"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// Event is the JSON body of a delivery. ID is the same for every delivery
+// and resend of one event, so receivers can drop duplicates.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      EventData `json:"data"`
+}
+
+// EventData is the booking the event is about and the details of its
+// history entry (cancelled items and refund, delay minutes, ...). The booking
+// is loaded when the outbox hands the event over, which can be after later
+// changes to it; Detail and the event's CreatedAt describe the event itself.
+type EventData struct {
+	Booking booking.Booking `json:"booking"`
+	Detail  map[string]any  `json:"detail,omitempty"`
+}
+
+// MaxAttempts returns how often a delivery is tried before it fails
+// (WEBHOOK_MAX_ATTEMPTS, default 10). Retries back off from 30 seconds,
+// doubling each time up to an hour, so the default gives up after about five
+// hours.
+func MaxAttempts() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(env.Get("WEBHOOK_MAX_ATTEMPTS", ""))); err == nil && n > 0 {
+		return n
+	}
+	return 10
+}
+
+// Backoff is the wait before retrying a delivery that failed attempts times.
+func Backoff(attempts int) time.Duration {
+	return min(30*time.Second<<min(max(attempts-1, 0), 10), time.Hour)
+}
+
+// webhookEvent maps a booking history event to the webhook event partners
+// see, or "" for history they are not told about.
+func webhookEvent(ev booking.BookingEvent) string {
+	switch ev.Event {
+	case booking.EventCheckedOut:
+		return EventBookingCreated
+	case booking.EventPaid:
+		return EventBookingPaid
+	case booking.EventCancelled, booking.EventSeatsCancelled:
+		return EventBookingCancelled
+	case booking.EventDisrupted:
+		if ev.Detail["kind"] == booking.DisruptionDelay {
+			return EventTripDelayed
+		}
+	}
+	return ""
+}
+
+// HandleEvents registers with the outbox: history events of partner bookings
+// become deliveries to the partner's subscriptions. Each is recorded once
+// per subscription, so the outbox may deliver an event again.
+func HandleEvents(db Querier) {
+	h := func(ctx context.Context, m outbox.Message) error { return record(ctx, db, m) }
+	for _, ev := range []string{booking.EventCheckedOut, booking.EventPaid, booking.EventCancelled, booking.EventSeatsCancelled, booking.EventDisrupted} {
+		outbox.Handle(booking.EventTopic(ev), "partner.webhooks", h)
+	}
+}
+
+func record(ctx context.Context, db Querier, m outbox.Message) error {
+	var ev booking.BookingEvent
+	if err := json.Unmarshal(m.Payload, &ev); err != nil {
+		return err
+	}
+	typ := webhookEvent(ev)
+	if typ == "" {
+		return nil
+	}
+	var owner string
+	err := db.QueryRow(ctx, `SELECT user_ref FROM bookings WHERE id = $1`, ev.BookingID).Scan(&owner)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	partnerID := FromRef(owner)
+	if err != nil || partnerID == "" {
+		return err
+	}
+	b, err := booking.GetBookingByID(ctx, db, ev.BookingID)
+	if err != nil {
+		return err
+	}
+	e := Event{ID: "evt_" + strconv.FormatInt(m.ID, 10), Type: typ, CreatedAt: m.CreatedAt, Data: EventData{Booking: b, Detail: ev.Detail}}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx, `
+INSERT INTO webhook_deliveries (webhook_id, event_id, event, booking_id, payload)
+SELECT w.id, $2::TEXT, $3::TEXT, $4::UUID, $5::JSONB
+FROM partner_webhooks w JOIN partners p ON p.id = w.partner_id
+WHERE w.partner_id = $1 AND w.active AND p.active AND $3::TEXT = ANY(w.events)
+ON CONFLICT (webhook_id, event_id) WHERE resent_from IS NULL DO NOTHING`, partnerID, e.ID, typ, b.ID, string(body))
+	return err
+}
+
+const deliveryCols = `d.id, d.webhook_id::TEXT, d.event_id, d.event, COALESCE(d.booking_id::TEXT, ''), d.payload::TEXT, d.status, d.attempts,
+    d.response_status, d.last_error, d.resent_from, d.next_attempt_at, d.created_at, d.delivered_at`
+
+func scanDelivery(row pgx.Row, extra ...any) (Delivery, error) {
+	var (
+		d       Delivery
+		payload string
+	)
+	dest := append([]any{&d.ID, &d.WebhookID, &d.EventID, &d.Event, &d.BookingID, &payload, &d.Status, &d.Attempts,
+		&d.ResponseStatus, &d.LastError, &d.ResentFrom, &d.NextAttemptAt, &d.CreatedAt, &d.DeliveredAt}, extra...)
+	err := row.Scan(dest...)
+	d.Payload = json.RawMessage(payload)
+	return d, err
+}
+
+// DeliveryFilter narrows Deliveries. An empty PartnerID lists every
+// partner's deliveries.
+type DeliveryFilter struct {
+	PartnerID string
+	WebhookID string
+	BookingID string
+	Status    string
+	Limit     int
+}
+
+// Deliveries returns the delivery log matching f, newest first.
+func Deliveries(ctx context.Context, db Querier, f DeliveryFilter) ([]Delivery, error) {
+	where, args := []string{"TRUE"}, []any{}
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.PartnerID != "" {
+		if !booking.ValidUUID(f.PartnerID) {
+			return nil, invalidField("partner_id", "partner id must be a UUID")
+		}
+		add("w.partner_id = $%d", f.PartnerID)
+	}
+	if f.WebhookID != "" {
+		if !booking.ValidUUID(f.WebhookID) {
+			return nil, invalidField("webhook_id", "webhook id must be a UUID")
+		}
+		add("d.webhook_id = $%d", f.WebhookID)
+	}
+	if f.BookingID != "" {
+		if !booking.ValidUUID(f.BookingID) {
+			return nil, invalidField("booking_id", "booking id must be a UUID")
+		}
+		add("d.booking_id = $%d", f.BookingID)
+	}
+	if f.Status != "" {
+		add("d.status = $%d", f.Status)
+	}
+	if f.Limit <= 0 || f.Limit > 500 {
+		f.Limit = 50
+	}
+	args = append(args, f.Limit)
+	rows, err := db.Query(ctx, `SELECT `+deliveryCols+`
+FROM webhook_deliveries d JOIN partner_webhooks w ON w.id = d.webhook_id
+WHERE `+strings.Join(where, " AND ")+fmt.Sprintf(` ORDER BY d.id DESC LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Delivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// GetDelivery loads one delivery of the partner (of anyone when partnerID is
+// empty).
+func GetDelivery(ctx context.Context, db Querier, partnerID string, id int64) (Delivery, error) {
+	d, err := scanDelivery(db.QueryRow(ctx, `SELECT `+deliveryCols+`
+FROM webhook_deliveries d JOIN partner_webhooks w ON w.id = d.webhook_id
+WHERE d.id = $1 AND ($2 = '' OR w.partner_id::TEXT = $2)`, id, partnerID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return d, notFound("delivery")
+	}
+	return d, err
+}
+
+// Resend queues the payload of delivery id again as a new delivery to the
+// same subscription, with the same event id and a fresh set of attempts.
+func Resend(ctx context.Context, db Querier, partnerID string, id int64) (Delivery, error) {
+	d, err := scanDelivery(db.QueryRow(ctx, `
+WITH src AS (
+    SELECT d.* FROM webhook_deliveries d JOIN partner_webhooks w ON w.id = d.webhook_id
+    WHERE d.id = $1 AND w.active AND ($2 = '' OR w.partner_id::TEXT = $2)
+)
+INSERT INTO webhook_deliveries AS d (webhook_id, event_id, event, booking_id, payload, resent_from)
+SELECT webhook_id, event_id, event, booking_id, payload, id FROM src
+RETURNING `+deliveryCols, id, partnerID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return d, notFound("delivery")
+	}
+	return d, err
+}
+
+// client sends deliveries; receivers get 10 seconds to answer. It never
+// follows redirects, uses no proxy, and in production connects only to
+// public addresses (see dialControl), whatever the host resolves to by then.
+var client = &http.Client{
+	Timeout:       10 * time.Second,
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: dialControl}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// dialControl refuses connections to addresses that are not public, after
+// DNS resolution, so a host that resolved to a public address when the
+// webhook was added cannot be pointed at the internal network later.
+func dialControl(_, address string, _ syscall.RawConn) error {
+	if !production() {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !publicAddr(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddr, host)
+	}
+	return nil
+}
+
+// sendLease is how long a claimed delivery is left alone before another
+// sender may try it, should this one die mid-send.
+const sendLease = 2 * time.Minute
+
+// NewRequest builds the signed POST of a delivery to url.
+func NewRequest(ctx context.Context, url, secret string, d Delivery, now time.Time) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(d.Payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "kereta-webhooks/1")
+	req.Header.Set(SignatureHeader, Sign(secret, now, d.Payload))
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(EventIDHeader, d.EventID)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(d.ID, 10))
+	return req, nil
+}
+
+// Send posts up to limit due deliveries, at most eight at once, and records
+// each attempt. A receiver that does not answer 2xx is retried with Backoff;
+// after MaxAttempts the delivery has failed. It returns how many were
+// delivered and how many attempts failed.
+func Send(ctx context.Context, db Querier, limit int) (delivered, failed int, err error) {
+	rows, err := db.Query(ctx, `
+UPDATE webhook_deliveries d SET next_attempt_at = now() + ($2::INT8 * INTERVAL '1 second')
+FROM partner_webhooks w
+WHERE w.id = d.webhook_id AND d.id IN (
+    SELECT d.id FROM webhook_deliveries d JOIN partner_webhooks w ON w.id = d.webhook_id
+    WHERE d.status = 'pending' AND d.next_attempt_at <= now() AND w.active
+    ORDER BY d.next_attempt_at, d.id
+    LIMIT $1
+    FOR UPDATE OF d SKIP LOCKED)
+RETURNING `+deliveryCols+`, w.url, w.secret`, limit, int64(sendLease/time.Second))
+	if err != nil {
+		return 0, 0, err
+	}
+	type claimed struct {
+		d           Delivery
+		url, secret string
+	}
+	var batch []claimed
+	for rows.Next() {
+		var c claimed
+		if c.d, err = scanDelivery(rows, &c.url, &c.secret); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		batch = append(batch, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	maxAttempts := MaxAttempts()
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, 8)
+		errs []error
+	)
+	for _, c := range batch {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			code, serr := Post(ctx, c.url, c.secret, c.d)
+			attempts := c.d.Attempts + 1
+			status := StatusDelivered
+			if serr != nil {
+				status = StatusPending
+				if attempts >= maxAttempts {
+					status = StatusFailed
+					log.Printf("webhooks: giving up on delivery %d (%s to %s): %v", c.d.ID, c.d.Event, c.url, serr)
+				}
+			}
+			lastErr := ""
+			if serr != nil {
+				lastErr = textx.Truncate(serr.Error(), 1000)
+			}
+			_, uerr := db.Exec(context.WithoutCancel(ctx), `
+UPDATE webhook_deliveries SET status = $2, attempts = $3, response_status = $4, last_error = $5,
+    next_attempt_at = now() + ($6::INT8 * INTERVAL '1 second'),
+    delivered_at = CASE WHEN $2 = 'delivered' THEN now() END
+WHERE id = $1`, c.d.ID, status, attempts, code, lastErr, int64(Backoff(attempts)/time.Second))
+			mu.Lock()
+			defer mu.Unlock()
+			if serr == nil {
+				delivered++
+			} else {
+				failed++
+			}
+			if uerr != nil {
+				errs = append(errs, uerr)
+			}
+		}()
+	}
+	wg.Wait()
+	return delivered, failed, errors.Join(errs...)
+}
+
+// Post sends one delivery to url as Send does and returns the receiver's
+// status code. Anything but a 2xx answer, redirects included, is an error;
+// the body of the answer is discarded.
+func Post(ctx context.Context, url, secret string, d Delivery) (int, error) {
+	req, err := NewRequest(ctx, url, secret, d, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("receiver answered %s", res.Status)
+	}
+	return res.StatusCode, nil
+}
@@ -0,0 +1,153 @@
+// Package partner lets travel-agent partners book through the API with an
+// API key and follow their bookings through signed webhooks. Bookings a
+// partner makes are owned by Ref(partner id); their history events are
+// turned into webhook deliveries by the outbox and sent with retries, and
+// every attempt is kept in a delivery log the partner can read and resend
+// from.
+package partner
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"gothicforge3/internal/booking"
+)
+
+// Querier is the subset of pgxpool.Pool / pgx.Tx used by this package.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Partner is a travel agent with API access.
+type Partner struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// refPrefix starts the user_ref of a partner's bookings.
+const refPrefix = "partner:"
+
+// Ref is the owner (bookings.user_ref, hold holder) of a partner's bookings.
+func Ref(partnerID string) string { return refPrefix + partnerID }
+
+// FromRef returns the partner id of a booking owner, or "" when a customer
+// owns it.
+func FromRef(ref string) string {
+	id, _ := strings.CutPrefix(ref, refPrefix)
+	if id == ref {
+		return ""
+	}
+	return id
+}
+
+// keyPrefix starts every API key, so a leaked one is easy to recognise.
+const keyPrefix = "pk_"
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func invalidField(field, msg string) error {
+	return &booking.Error{Code: booking.CodeInvalid, Message: msg, Fields: map[string]string{field: msg}}
+}
+
+func notFound(what string) error {
+	return &booking.Error{Code: booking.CodeNotFound, Message: what + " not found"}
+}
+
+// Create adds a partner and returns it with its API key. Only the key's hash
+// is stored, so the key cannot be shown again.
+func Create(ctx context.Context, db Querier, name string) (Partner, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 200 {
+		return Partner{}, "", invalidField("name", "name is required (at most 200 characters)")
+	}
+	key := keyPrefix + randomHex(24)
+	p := Partner{Name: name, Active: true}
+	err := db.QueryRow(ctx, `INSERT INTO partners (name, api_key_hash) VALUES ($1, $2) RETURNING id::TEXT, created_at`, name, hashKey(key)).
+		Scan(&p.ID, &p.CreatedAt)
+	return p, key, err
+}
+
+// ErrBadKey is returned by Authenticate for an unknown or disabled key.
+var ErrBadKey = errors.New("partner: unknown or disabled API key")
+
+// Authenticate returns the active partner with API key key.
+func Authenticate(ctx context.Context, db Querier, key string) (Partner, error) {
+	key = strings.TrimSpace(key)
+	if !strings.HasPrefix(key, keyPrefix) {
+		return Partner{}, ErrBadKey
+	}
+	var p Partner
+	err := db.QueryRow(ctx, `SELECT id::TEXT, name, active, created_at FROM partners WHERE api_key_hash = $1 AND active`, hashKey(key)).
+		Scan(&p.ID, &p.Name, &p.Active, &p.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p, ErrBadKey
+	}
+	return p, err
+}
+
+// List returns every partner by name.
+func List(ctx context.Context, db Querier) ([]Partner, error) {
+	rows, err := db.Query(ctx, `SELECT id::TEXT, name, active, created_at FROM partners ORDER BY name, created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Partner{}
+	for rows.Next() {
+		var p Partner
+		if err := rows.Scan(&p.ID, &p.Name, &p.Active, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// SetActive enables or disables a partner's API key and webhooks.
+func SetActive(ctx context.Context, db Querier, id string, active bool) error {
+	if !booking.ValidUUID(id) {
+		return invalidField("id", "partner id must be a UUID")
+	}
+	tag, err := db.Exec(ctx, `UPDATE partners SET active = $2 WHERE id = $1`, id, active)
+	if err == nil && tag.RowsAffected() == 0 {
+		return notFound("partner")
+	}
+	return err
+}
+
+// RotateKey replaces a partner's API key and returns the new one.
+func RotateKey(ctx context.Context, db Querier, id string) (string, error) {
+	if !booking.ValidUUID(id) {
+		return "", invalidField("id", "partner id must be a UUID")
+	}
+	key := keyPrefix + randomHex(24)
+	tag, err := db.Exec(ctx, `UPDATE partners SET api_key_hash = $2 WHERE id = $1`, id, hashKey(key))
+	if err == nil && tag.RowsAffected() == 0 {
+		err = notFound("partner")
+	}
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
@@ -0,0 +1,276 @@
+package partner
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/env"
+)
+
+// Webhook events partners can subscribe to.
+const (
+	EventBookingCreated   = "booking.created"   // checked out, waiting for payment
+	EventBookingPaid      = "booking.paid"      // payment settled
+	EventBookingCancelled = "booking.cancelled" // some or every seat cancelled
+	EventTripDelayed      = "trip.delayed"      // the booked train runs late
+)
+
+// Events lists every webhook event.
+var Events = []string{EventBookingCreated, EventBookingPaid, EventBookingCancelled, EventTripDelayed}
+
+// Webhook is a partner's subscription. Secret signs its deliveries and is
+// only shown when the subscription is created or its secret rotated.
+type Webhook struct {
+	ID        string    `json:"id"`
+	PartnerID string    `json:"partner_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// secretPrefix starts every signing secret.
+const secretPrefix = "whsec_"
+
+// production reports whether APP_ENV is production. Outside production
+// webhooks may use plain http and private addresses, for local receivers
+// such as gforge partners listen.
+func production() bool {
+	return strings.EqualFold(env.Get("APP_ENV", "development"), "production")
+}
+
+// ErrPrivateAddr is returned when a webhook URL resolves to an address
+// deliveries may not be sent to in production.
+var ErrPrivateAddr = errors.New("partner: webhook address is not public")
+
+// reserved are ranges that are not public but have no netip predicate.
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+}
+
+// publicAddr reports whether deliveries may be sent to ip: not loopback,
+// private, link-local (cloud metadata endpoints live there), multicast or
+// unspecified.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, p := range reserved {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHost resolves the host of a webhook URL and refuses it unless every
+// address is public. The sender checks again when it connects.
+func checkHost(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return invalidField("url", "url must be an absolute https URL")
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return invalidField("url", "url host "+u.Hostname()+" does not resolve")
+	}
+	for _, ip := range addrs {
+		if !publicAddr(ip) {
+			return invalidField("url", "url must point to a public address, not "+ip.String())
+		}
+	}
+	return nil
+}
+
+// validateWebhook normalizes and checks a subscription's URL and events.
+// Outside production plain http is allowed, for local receivers.
+func validateWebhook(rawURL string, events []string, production bool) (string, []string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && (production || u.Scheme != "http")) || len(rawURL) > 1000 {
+		if production {
+			return "", nil, invalidField("url", "url must be an absolute https URL")
+		}
+		return "", nil, invalidField("url", "url must be an absolute http(s) URL")
+	}
+	var out []string
+	for _, e := range events {
+		for _, e := range strings.Split(e, ",") {
+			e = strings.TrimSpace(e)
+			if e == "" || slices.Contains(out, e) {
+				continue
+			}
+			if !slices.Contains(Events, e) {
+				return "", nil, invalidField("events", fmt.Sprintf("unknown event %q (want %s)", e, strings.Join(Events, ", ")))
+			}
+			out = append(out, e)
+		}
+	}
+	if len(out) == 0 {
+		out = slices.Clone(Events)
+	}
+	return rawURL, out, nil
+}
+
+// AddWebhook subscribes url to events (every event when none) of the
+// partner's bookings and returns the subscription with its new secret. In
+// production the URL must use https and resolve to public addresses only.
+func AddWebhook(ctx context.Context, db Querier, partnerID, rawURL string, events []string) (Webhook, error) {
+	if !booking.ValidUUID(partnerID) {
+		return Webhook{}, invalidField("partner_id", "partner id must be a UUID")
+	}
+	prod := production()
+	u, evs, err := validateWebhook(rawURL, events, prod)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if prod {
+		if err := checkHost(ctx, u); err != nil {
+			return Webhook{}, err
+		}
+	}
+	w := Webhook{PartnerID: partnerID, URL: u, Secret: secretPrefix + randomHex(24), Events: evs, Active: true}
+	err = db.QueryRow(ctx, `
+INSERT INTO partner_webhooks (partner_id, url, secret, events) VALUES ($1, $2, $3, $4)
+RETURNING id::TEXT, created_at`, partnerID, w.URL, w.Secret, w.Events).Scan(&w.ID, &w.CreatedAt)
+	return w, err
+}
+
+// Webhooks lists a partner's active subscriptions, without secrets. An
+// empty partnerID lists every partner's.
+func Webhooks(ctx context.Context, db Querier, partnerID string) ([]Webhook, error) {
+	rows, err := db.Query(ctx, `
+SELECT id::TEXT, partner_id::TEXT, url, events, active, created_at FROM partner_webhooks
+WHERE active AND ($1 = '' OR partner_id::TEXT = $1)
+ORDER BY created_at`, partnerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Webhook{}
+	for rows.Next() {
+		var w Webhook
+		if err := rows.Scan(&w.ID, &w.PartnerID, &w.URL, &w.Events, &w.Active, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// RemoveWebhook deactivates one of the partner's subscriptions; its delivery
+// log stays and deliveries still pending fail. An empty partnerID removes
+// any partner's.
+func RemoveWebhook(ctx context.Context, db Querier, partnerID, id string) error {
+	if !booking.ValidUUID(id) {
+		return notFound("webhook")
+	}
+	tag, err := db.Exec(ctx, `UPDATE partner_webhooks SET active = FALSE WHERE id = $1 AND active AND ($2 = '' OR partner_id::TEXT = $2)`, id, partnerID)
+	if err == nil && tag.RowsAffected() == 0 {
+		return notFound("webhook")
+	}
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx, `UPDATE webhook_deliveries SET status = 'failed', last_error = 'webhook removed' WHERE webhook_id = $1 AND status = 'pending'`, id)
+	return err
+}
+
+// RotateSecret gives one of the partner's subscriptions a new secret and
+// returns it. Deliveries sent from then on are signed with it.
+func RotateSecret(ctx context.Context, db Querier, partnerID, id string) (string, error) {
+	if !booking.ValidUUID(id) {
+		return "", notFound("webhook")
+	}
+	secret := secretPrefix + randomHex(24)
+	tag, err := db.Exec(ctx, `UPDATE partner_webhooks SET secret = $3 WHERE id = $1 AND active AND ($2 = '' OR partner_id::TEXT = $2)`, id, partnerID, secret)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = notFound("webhook")
+	}
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Delivery headers. SignatureHeader is "t=<unix seconds>,v1=<hex>", the
+// HMAC-SHA256 with the subscription's secret of "<t>.<body>".
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	EventIDHeader   = "X-Webhook-Id"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// SignatureTolerance is how far a signature's timestamp may be from the
+// receiver's clock before Verify rejects it as a replay.
+const SignatureTolerance = 5 * time.Minute
+
+// Sign returns the SignatureHeader value for body sent at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(signature(secret, ts, body))
+}
+
+func signature(secret, ts string, body []byte) []byte {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(ts))
+	m.Write([]byte("."))
+	m.Write(body)
+	return m.Sum(nil)
+}
+
+// Signature verification failures.
+var (
+	ErrBadSignature = errors.New("partner: webhook signature does not match")
+	ErrStale        = errors.New("partner: webhook timestamp is outside the tolerance")
+)
+
+// Verify checks a SignatureHeader value against body as received at now.
+// Receivers should reject a delivery Verify returns an error for.
+func Verify(secret, header string, body []byte, now time.Time) error {
+	var (
+		ts   string
+		sigs [][]byte
+	)
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			if b, err := hex.DecodeString(v); err == nil {
+				sigs = append(sigs, b)
+			}
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrBadSignature
+	}
+	want := signature(secret, ts, body)
+	if !slices.ContainsFunc(sigs, func(s []byte) bool { return hmac.Equal(s, want) }) {
+		return ErrBadSignature
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > SignatureTolerance || d < -SignatureTolerance {
+		return ErrStale
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Package payment collects money for checked-out bookings through a pluggable
+// Provider: a Midtrans adapter for real virtual-account and QRIS charges, and
+// an in-process Simulator for development and tests. Providers confirm
+// payments asynchronously through signed webhook callbacks, which ApplyEvent
+// turns into booking state changes.
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gothicforge3/internal/env"
+)
+
+// Payment methods.
+const (
+	MethodVA   = "va"   // bank virtual account
+	MethodQRIS = "qris" // QRIS code payable from any Indonesian e-wallet or bank app
+)
+
+// Banks lists the virtual-account banks offered at checkout.
+var Banks = []string{"bca", "bni", "bri", "permata"}
+
+// Payment statuses.
+const (
+	StatusPending = "pending"
+	StatusPaid    = "paid"
+	StatusExpired = "expired"
+	StatusFailed  = "failed"
+)
+
+// ErrBadSignature is returned by Provider.ParseCallback when a callback is not authentic.
+var ErrBadSignature = errors.New("payment: invalid callback signature")
+
+// ChargeRequest asks a provider for payment instructions.
+type ChargeRequest struct {
+	OrderID       string
+	Amount        int64
+	Method        string
+	Bank          string
+	ExpiresAt     time.Time
+	CustomerName  string
+	CustomerEmail string
+}
+
+// Charge is what the customer needs to pay: a VA number or a QRIS string.
+type Charge struct {
+	ExternalID string
+	Method     string
+	Bank       string
+	VANumber   string
+	QRString   string
+	Amount     int64
+	ExpiresAt  time.Time
+}
+
+// Event is a verified provider callback about one charge.
+type Event struct {
+	ExternalID string
+	Status     string
+	Amount     int64
+	Raw        []byte
+}
+
+// Provider creates charges and authenticates their callbacks.
+type Provider interface {
+	Name() string
+	CreateCharge(ctx context.Context, req ChargeRequest) (Charge, error)
+	// ParseCallback verifies the callback signature and decodes it.
+	// Unauthentic callbacks return ErrBadSignature.
+	ParseCallback(h http.Header, body []byte) (Event, error)
+}
+
+// devSecret signs simulator callbacks when PAYMENT_WEBHOOK_SECRET is unset outside production.
+var devSecret = randomHex(32)
+
+// FromEnv returns the provider selected by PAYMENT_PROVIDER ("simulator" by default, or "midtrans").
+func FromEnv() (Provider, error) {
+	switch name := strings.ToLower(strings.TrimSpace(env.Get("PAYMENT_PROVIDER", "simulator"))); name {
+	case "", "simulator":
+		secret := strings.TrimSpace(env.Get("PAYMENT_WEBHOOK_SECRET", ""))
+		if secret == "" {
+			if strings.EqualFold(env.Get("APP_ENV", "development"), "production") {
+				return nil, errors.New("payment: PAYMENT_WEBHOOK_SECRET is required for the simulator in production")
+			}
+			secret = devSecret
+		}
+		return NewSimulator(secret), nil
+	case "midtrans":
+		key := strings.TrimSpace(env.Get("MIDTRANS_SERVER_KEY", ""))
+		if key == "" {
+			return nil, errors.New("payment: MIDTRANS_SERVER_KEY is not set")
+		}
+		return NewMidtrans(key, env.Get("MIDTRANS_BASE_URL", MidtransSandboxURL)), nil
+	default:
+		return nil, fmt.Errorf("payment: unknown PAYMENT_PROVIDER %q", name)
+	}
+}
+
+// ValidMethod reports whether method (and bank, for virtual accounts) can be charged.
+func ValidMethod(method, bank string) bool {
+	switch method {
+	case MethodQRIS:
+		return true
+	case MethodVA:
+		for _, b := range Banks {
+			if b == bank {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
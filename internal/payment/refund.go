@@ -0,0 +1,158 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/booking"
+)
+
+// RefundRequest asks a gateway to pay money back on a settled charge.
+type RefundRequest struct {
+	RefundID string // our refunds.id; gateways use it as an idempotency key
+	OrderID  string // the charge's external id
+	Amount   int64
+	Reason   string
+}
+
+// Refunder executes refunds. Cancellations only record refunds; the refund
+// worker hands them to a Refunder, so the gateway is pluggable the same way
+// charges are.
+type Refunder interface {
+	Name() string
+	// Refund pays req.Amount back and returns the gateway's reference for it.
+	Refund(ctx context.Context, req RefundRequest) (string, error)
+}
+
+// MaxRefundAttempts is how often a refund is tried before it is marked failed
+// for manual follow-up. Retries back off from one minute, doubling each time.
+const MaxRefundAttempts = 6
+
+// RefunderFromEnv returns the refunder for the gateway selected by PAYMENT_PROVIDER.
+func RefunderFromEnv() (Refunder, error) {
+	p, err := FromEnv()
+	if err != nil {
+		return nil, err
+	}
+	r, ok := p.(Refunder)
+	if !ok {
+		return nil, fmt.Errorf("payment: provider %s cannot refund", p.Name())
+	}
+	return r, nil
+}
+
+// Refund implements Refunder. Simulated refunds always succeed.
+func (s *Simulator) Refund(_ context.Context, req RefundRequest) (string, error) {
+	return "SIMREF-" + strings.ToUpper(randomHex(8)), nil
+}
+
+// MemoryRefunder is an in-memory Refunder for tests. It records every request
+// and fails with Err while Err is set.
+type MemoryRefunder struct {
+	mu       sync.Mutex
+	Err      error
+	Requests []RefundRequest
+}
+
+// Name implements Refunder.
+func (m *MemoryRefunder) Name() string { return "memory" }
+
+// Refund implements Refunder.
+func (m *MemoryRefunder) Refund(_ context.Context, req RefundRequest) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return "", m.Err
+	}
+	m.Requests = append(m.Requests, req)
+	return fmt.Sprintf("MEMREF-%d", len(m.Requests)), nil
+}
+
+// Refunded returns the total paid back so far.
+func (m *MemoryRefunder) Refunded() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, r := range m.Requests {
+		n += r.Amount
+	}
+	return n
+}
+
+// refundBackoff is the wait before retrying a refund that failed attempts times.
+func refundBackoff(attempts int) time.Duration {
+	return time.Minute << min(attempts-1, 10)
+}
+
+// ProcessRefunds pays out up to limit due refunds through r, one transaction
+// each. A refund row stays locked (FOR UPDATE SKIP LOCKED) while the gateway
+// is called, so concurrent workers never pay the same refund twice. Failures
+// are retried with backoff; after MaxRefundAttempts the refund is marked
+// failed. It returns how many refunds succeeded and failed in this pass.
+func ProcessRefunds(ctx context.Context, db booking.DB, r Refunder, limit int) (done, failed int, err error) {
+	for i := 0; i < limit; i++ {
+		var found bool
+		err = pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+			var (
+				rf      booking.Refund
+				orderID string
+			)
+			err := booking.ScanRefund(tx.QueryRow(ctx, `
+SELECT `+booking.RefundColumns+`, COALESCE(p.external_id, '')
+FROM refunds rf
+LEFT JOIN LATERAL (
+    SELECT external_id FROM payments
+    WHERE (rf.payment_id IS NOT NULL AND id = rf.payment_id) OR (rf.payment_id IS NULL AND booking_id = rf.booking_id AND status = 'paid')
+    ORDER BY paid_at DESC NULLS LAST LIMIT 1
+) p ON TRUE
+WHERE rf.status = 'pending' AND rf.next_attempt_at <= now()
+ORDER BY rf.next_attempt_at
+LIMIT 1
+FOR UPDATE OF rf SKIP LOCKED`), &rf, &orderID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			found = true
+
+			ref, rerr := "", errors.New("no settled payment to refund")
+			if orderID != "" {
+				ref, rerr = r.Refund(ctx, RefundRequest{RefundID: rf.ID, OrderID: orderID, Amount: rf.Amount, Reason: rf.Reason})
+			}
+			if rerr == nil {
+				done++
+				_, err := tx.Exec(ctx, `
+UPDATE refunds SET status = 'succeeded', provider = $2, external_id = $3, attempts = attempts + 1, last_error = '', processed_at = now()
+WHERE id = $1`, rf.ID, r.Name(), ref)
+				return err
+			}
+
+			attempts := rf.Attempts + 1
+			status := booking.RefundPending
+			if attempts >= MaxRefundAttempts || orderID == "" {
+				status = booking.RefundFailed
+				failed++
+				log.Printf("refunds: giving up on refund %s for booking %s: %v", rf.ID, rf.BookingID, rerr)
+			}
+			_, err = tx.Exec(ctx, `
+UPDATE refunds SET status = $2, provider = $3, attempts = $4, last_error = $5,
+       next_attempt_at = now() + ($6::INT8 * INTERVAL '1 second'),
+       processed_at = CASE WHEN $2 = 'failed' THEN now() ELSE processed_at END
+WHERE id = $1`, rf.ID, status, r.Name(), attempts, rerr.Error(), int64(refundBackoff(attempts)/time.Second))
+			return err
+		})
+		if err != nil || !found {
+			return done, failed, err
+		}
+	}
+	return done, failed, nil
+}
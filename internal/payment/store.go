@@ -0,0 +1,258 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/booking"
+)
+
+// Payment is one charge stored in the payments table.
+type Payment struct {
+	ID         string     `json:"id"`
+	BookingID  string     `json:"booking_id"`
+	Provider   string     `json:"provider"`
+	ExternalID string     `json:"external_id"`
+	Method     string     `json:"method"`
+	Bank       string     `json:"bank,omitempty"`
+	VANumber   string     `json:"va_number,omitempty"`
+	QRString   string     `json:"qr_string,omitempty"`
+	Amount     int64      `json:"amount"`
+	ChangeID   string     `json:"change_id,omitempty"` // set when the charge is for the balance of a trip change
+	Status     string     `json:"status"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	PaidAt     *time.Time `json:"paid_at,omitempty"`
+}
+
+const paymentCols = `id, booking_id, provider, external_id, method, bank, va_number, qr_string, amount::INT8,
+       COALESCE(change_id::TEXT, ''), status, expires_at, paid_at`
+
+func scanPayment(row pgx.Row) (Payment, error) {
+	var p Payment
+	err := row.Scan(&p.ID, &p.BookingID, &p.Provider, &p.ExternalID, &p.Method, &p.Bank, &p.VANumber, &p.QRString, &p.Amount, &p.ChangeID, &p.Status, &p.ExpiresAt, &p.PaidAt)
+	return p, err
+}
+
+// Start returns payment instructions for a pending booking. An unexpired
+// pending charge for the same provider, method and bank is reused, so
+// refreshing the page does not open a new virtual account every time.
+func Start(ctx context.Context, db booking.Querier, p Provider, b booking.Booking, method, bank string) (Payment, error) {
+	method = strings.ToLower(strings.TrimSpace(method))
+	bank = strings.ToLower(strings.TrimSpace(bank))
+	if method == MethodQRIS {
+		bank = ""
+	}
+	if !ValidMethod(method, bank) {
+		return Payment{}, &booking.Error{Code: booking.CodeInvalid, Message: "choose QRIS or a virtual-account bank"}
+	}
+	if b.Status != booking.StatusPending {
+		return Payment{}, &booking.Error{Code: booking.CodeNotPending, Message: "booking is " + b.Status}
+	}
+	if b.PaymentDueAt == nil || !b.PaymentDueAt.After(time.Now()) {
+		return Payment{}, &booking.Error{Code: booking.CodeNotPending, Message: "payment deadline has passed"}
+	}
+
+	existing, err := scanPayment(db.QueryRow(ctx, `
+SELECT `+paymentCols+` FROM payments
+WHERE booking_id = $1 AND change_id IS NULL AND provider = $2 AND method = $3 AND bank = $4 AND status = 'pending' AND expires_at > now()
+ORDER BY created_at DESC LIMIT 1`, b.ID, p.Name(), method, bank))
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return Payment{}, err
+	}
+
+	c, err := p.CreateCharge(ctx, ChargeRequest{
+		OrderID:       b.Code + "-" + strings.ToUpper(randomHex(3)),
+		Amount:        b.Total,
+		Method:        method,
+		Bank:          bank,
+		ExpiresAt:     *b.PaymentDueAt,
+		CustomerName:  b.Contact.Name,
+		CustomerEmail: b.Contact.Email,
+	})
+	if err != nil {
+		return Payment{}, err
+	}
+	return scanPayment(db.QueryRow(ctx, `
+INSERT INTO payments (booking_id, provider, external_id, method, bank, va_number, qr_string, amount, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING `+paymentCols, b.ID, p.Name(), c.ExternalID, c.Method, c.Bank, c.VANumber, c.QRString, c.Amount, c.ExpiresAt))
+}
+
+// StartChange returns payment instructions for the balance of a trip change
+// waiting for payment. Like Start, an open charge for the same method is reused.
+func StartChange(ctx context.Context, db booking.Querier, p Provider, b booking.Booking, c booking.Change, method, bank string) (Payment, error) {
+	method = strings.ToLower(strings.TrimSpace(method))
+	bank = strings.ToLower(strings.TrimSpace(bank))
+	if method == MethodQRIS {
+		bank = ""
+	}
+	if !ValidMethod(method, bank) {
+		return Payment{}, &booking.Error{Code: booking.CodeInvalid, Message: "choose QRIS or a virtual-account bank"}
+	}
+	if c.Status != booking.ChangePending || c.Balance <= 0 {
+		return Payment{}, &booking.Error{Code: booking.CodeNotPending, Message: "trip change is not waiting for payment"}
+	}
+	if c.DueAt == nil || !c.DueAt.After(time.Now()) {
+		return Payment{}, &booking.Error{Code: booking.CodeNotPending, Message: "payment deadline has passed"}
+	}
+
+	existing, err := scanPayment(db.QueryRow(ctx, `
+SELECT `+paymentCols+` FROM payments
+WHERE change_id = $1 AND provider = $2 AND method = $3 AND bank = $4 AND status = 'pending' AND expires_at > now()
+ORDER BY created_at DESC LIMIT 1`, c.ID, p.Name(), method, bank))
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return Payment{}, err
+	}
+
+	ch, err := p.CreateCharge(ctx, ChargeRequest{
+		OrderID:       b.Code + "-C" + strings.ToUpper(randomHex(3)),
+		Amount:        c.Balance,
+		Method:        method,
+		Bank:          bank,
+		ExpiresAt:     *c.DueAt,
+		CustomerName:  b.Contact.Name,
+		CustomerEmail: b.Contact.Email,
+	})
+	if err != nil {
+		return Payment{}, err
+	}
+	return scanPayment(db.QueryRow(ctx, `
+INSERT INTO payments (booking_id, change_id, provider, external_id, method, bank, va_number, qr_string, amount, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING `+paymentCols, b.ID, c.ID, p.Name(), ch.ExternalID, ch.Method, ch.Bank, ch.VANumber, ch.QRString, ch.Amount, ch.ExpiresAt))
+}
+
+// ForBooking lists the charges of a booking, newest first.
+func ForBooking(ctx context.Context, db booking.Querier, bookingID string) ([]Payment, error) {
+	rows, err := db.Query(ctx, `SELECT `+paymentCols+` FROM payments WHERE booking_id = $1 ORDER BY created_at DESC`, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Payment
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// Get loads a charge by provider and external id.
+func Get(ctx context.Context, db booking.Querier, provider, externalID string) (Payment, error) {
+	p, err := scanPayment(db.QueryRow(ctx, `SELECT `+paymentCols+` FROM payments WHERE provider = $1 AND external_id = $2`, provider, externalID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p, &booking.Error{Code: booking.CodeNotFound, Message: "payment not found"}
+	}
+	return p, err
+}
+
+// ApplyEvent records a verified callback and moves the booking along in one
+// transaction: paid settles the booking, and expired/failed expires it once
+// its payment deadline has passed and no other charge for it is still open.
+// Replayed callbacks are no-ops.
+//
+// A payment that lands after its booking already expired or was cancelled is
+// kept as paid and queued for a full refund; the released seats are not taken
+// back. A charge for a trip change applies the change instead; if the change
+// is no longer pending the payment is refunded the same way. An unpaid change
+// charge never expires the booking, which is already paid.
+//
+// A status other than pending, paid, expired or failed is rejected before
+// anything is written. Seat changes are announced after the commit.
+func ApplyEvent(ctx context.Context, db booking.DB, provider string, ev Event) (Payment, error) {
+	var out Payment
+	switch ev.Status {
+	case StatusPending, StatusPaid, StatusExpired, StatusFailed:
+	default:
+		return out, &booking.Error{Code: booking.CodeInvalid, Message: "unknown payment status: " + ev.Status}
+	}
+	var changes []booking.SeatChange
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		p, err := scanPayment(tx.QueryRow(ctx, `SELECT `+paymentCols+` FROM payments WHERE provider = $1 AND external_id = $2 FOR UPDATE`, provider, ev.ExternalID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &booking.Error{Code: booking.CodeNotFound, Message: "payment not found"}
+		}
+		if err != nil {
+			return err
+		}
+		out = p
+		if p.Status != StatusPending || ev.Status == StatusPending {
+			return nil
+		}
+		if ev.Status == StatusPaid && ev.Amount != p.Amount {
+			return &booking.Error{Code: booking.CodeInvalid, Message: "paid amount does not match the charge"}
+		}
+		out, err = scanPayment(tx.QueryRow(ctx, `
+UPDATE payments SET status = $2, paid_at = CASE WHEN $2 = 'paid' THEN now() ELSE paid_at END,
+       last_callback = $3, updated_at = now()
+WHERE id = $1
+RETURNING `+paymentCols, p.ID, ev.Status, string(ev.Raw)))
+		if err != nil {
+			return err
+		}
+
+		if p.ChangeID != "" {
+			if ev.Status != StatusPaid {
+				return nil
+			}
+			var err error
+			changes, err = booking.ApplyChangeTx(ctx, tx, p.ChangeID)
+			if c := booking.ErrorCode(err); c == booking.CodeNotPending || c == booking.CodeHoldExpired {
+				log.Printf("payments: %s %s paid for trip change %s that can no longer apply (%v); refunding it", provider, ev.ExternalID, p.ChangeID, err)
+				_, err := tx.Exec(ctx, `INSERT INTO refunds (booking_id, payment_id, amount, reason) VALUES ($1, $2, $3, $4)`,
+					p.BookingID, p.ID, p.Amount, "payment received after the trip change closed")
+				return err
+			}
+			return err
+		}
+
+		switch ev.Status {
+		case StatusPaid:
+			err := booking.MarkPaid(ctx, tx, p.BookingID)
+			if booking.ErrorCode(err) == booking.CodeNotPending {
+				log.Printf("payments: %s %s paid for booking %s that is no longer pending (%v); refunding it", provider, ev.ExternalID, p.BookingID, err)
+				_, err := tx.Exec(ctx, `INSERT INTO refunds (booking_id, payment_id, amount, reason) VALUES ($1, $2, $3, $4)`,
+					p.BookingID, p.ID, p.Amount, "payment received after the booking closed")
+				return err
+			}
+			return err
+		case StatusExpired, StatusFailed:
+			var open int
+			if err := tx.QueryRow(ctx, `SELECT count(*) FROM payments WHERE booking_id = $1 AND change_id IS NULL AND status = 'pending' AND expires_at > now()`, p.BookingID).Scan(&open); err != nil {
+				return err
+			}
+			// Charges expire with the booking's payment deadline. A charge that fails
+			// earlier leaves the customer free to try another method.
+			var overdue bool
+			if err := tx.QueryRow(ctx, `SELECT COALESCE(payment_due_at <= now(), false) FROM bookings WHERE id = $1`, p.BookingID).Scan(&overdue); err != nil {
+				return err
+			}
+			if open > 0 || !overdue {
+				return nil
+			}
+			changes, err = booking.ExpireBookingTx(ctx, tx, p.BookingID)
+			if err != nil && booking.ErrorCode(err) != booking.CodeNotPending {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		booking.AnnounceSeats(changes)
+	}
+	return out, err
+}
@@ -0,0 +1,285 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/env"
+)
+
+// Options select the window a run covers.
+type Options struct {
+	From   time.Time
+	Days   int
+	DryRun bool // report what would change without writing
+}
+
+// Result summarizes one run. Trip IDs are listed for the trips that changed
+// status so operators can follow up.
+type Result struct {
+	Planned   int      // departures the calendars call for in the window
+	Created   int      // new trips, each with its stops, coaches and seats
+	Seats     int      // seats created
+	Existing  int      // already present, left untouched
+	Restored  []string // generated trips cancelled earlier and called for again
+	Cancelled []string // generated trips no longer called for and without bookings
+	Conflicts []string // generated trips no longer called for that still have bookings
+}
+
+// WindowDays is the rolling window of the scheduled run, SCHEDULE_WINDOW_DAYS (default 30).
+func WindowDays() int {
+	if n, err := strconv.Atoi(env.Get("SCHEDULE_WINDOW_DAYS", "30")); err == nil && n > 0 && n <= 366 {
+		return n
+	}
+	return 30
+}
+
+// Load reads every service calendar and the active timetable templates.
+func Load(ctx context.Context, db booking.Querier) ([]Calendar, []Template, error) {
+	rows, err := db.Query(ctx, `
+SELECT id, train_id, weekday_flags, start_date, end_date, COALESCE(exceptions::TEXT, '')
+FROM service_calendars`)
+	if err != nil {
+		return nil, nil, err
+	}
+	var cals []Calendar
+	for rows.Next() {
+		var (
+			c   Calendar
+			raw string
+		)
+		if err := rows.Scan(&c.ID, &c.TrainID, &c.Weekdays, &c.Start, &c.End, &raw); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		if c.Exceptions, err = ParseExceptions([]byte(raw)); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("service calendar %s: %w", c.ID, err)
+		}
+		cals = append(cals, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = db.Query(ctx, `
+SELECT id, train_id, route_id, COALESCE(calendar_id::TEXT, ''), depart_time::TEXT, arrive_time::TEXT, base_price::INT8, consist::TEXT
+FROM timetable_templates
+WHERE active
+ORDER BY depart_time, id`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var tpls []Template
+	for rows.Next() {
+		var (
+			t   Template
+			raw string
+		)
+		if err := rows.Scan(&t.ID, &t.TrainID, &t.RouteID, &t.CalendarID, &t.Depart, &t.Arrive, &t.BasePrice, &raw); err != nil {
+			return nil, nil, err
+		}
+		if t.Consist, err = ParseConsist([]byte(raw)); err != nil {
+			return nil, nil, fmt.Errorf("timetable template %s: %w", t.ID, err)
+		}
+		tpls = append(tpls, t)
+	}
+	return cals, tpls, rows.Err()
+}
+
+type existingTrip struct {
+	id         string
+	generated  bool
+	status     string
+	hasBooking bool
+}
+
+// Generate expands the calendars over the window and creates the missing
+// trips. It is idempotent: existing departures are left alone, and the unique
+// departure index makes concurrent runs safe. Generated trips whose day no
+// longer runs (a holiday exception was added or a template deactivated) are
+// cancelled when nobody booked them and reported as conflicts otherwise.
+func Generate(ctx context.Context, db booking.DB, opt Options) (Result, error) {
+	var res Result
+	if opt.Days < 1 {
+		return res, errors.New("schedule: window must be at least one day")
+	}
+	cals, tpls, err := Load(ctx, db)
+	if err != nil {
+		return res, err
+	}
+	plan := Expand(cals, tpls, opt.From, opt.Days)
+	res.Planned = len(plan)
+	from := time.Date(opt.From.Year(), opt.From.Month(), opt.From.Day(), 0, 0, 0, 0, time.UTC)
+	existing, err := loadExisting(ctx, db, from, from.AddDate(0, 0, opt.Days-1))
+	if err != nil {
+		return res, err
+	}
+
+	wanted := make(map[string]bool, len(plan))
+	for _, d := range plan {
+		key := d.Key()
+		wanted[key] = true
+		if ex, ok := existing[key]; ok {
+			if ex.generated && ex.status == "cancelled" {
+				res.Restored = append(res.Restored, ex.id)
+				if !opt.DryRun {
+					if _, err := db.Exec(ctx, `UPDATE trips SET status = 'scheduled' WHERE id = $1 AND status = 'cancelled'`, ex.id); err != nil {
+						return res, err
+					}
+				}
+				continue
+			}
+			res.Existing++
+			continue
+		}
+		_, seats := Build(d.Template.Consist)
+		if opt.DryRun {
+			res.Created++
+			res.Seats += len(seats)
+			continue
+		}
+		created, err := createTrip(ctx, db, d)
+		if err != nil {
+			return res, fmt.Errorf("schedule: %s: %w", d.Key(), err)
+		}
+		if created {
+			res.Created++
+			res.Seats += len(seats)
+		} else {
+			res.Existing++ // another run got there first
+		}
+	}
+
+	for key, ex := range existing {
+		if !ex.generated || ex.status != "scheduled" || wanted[key] {
+			continue
+		}
+		if ex.hasBooking {
+			res.Conflicts = append(res.Conflicts, ex.id)
+			continue
+		}
+		res.Cancelled = append(res.Cancelled, ex.id)
+		if opt.DryRun {
+			continue
+		}
+		if _, err := db.Exec(ctx, `
+UPDATE trips SET status = 'cancelled'
+WHERE id = $1 AND status = 'scheduled'
+  AND NOT EXISTS (SELECT 1 FROM bookings b WHERE b.trip_id = trips.id AND b.status IN ('hold', 'pending', 'paid'))`, ex.id); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// loadExisting indexes the trips in [from, to] by departure key.
+func loadExisting(ctx context.Context, db booking.Querier, from, to time.Time) (map[string]existingTrip, error) {
+	rows, err := db.Query(ctx, `
+SELECT t.id, t.train_id, t.route_id, t.service_date, t.depart_time::TEXT, t.template_id IS NOT NULL, t.status,
+       EXISTS (SELECT 1 FROM bookings b WHERE b.trip_id = t.id AND b.status IN ('hold', 'pending', 'paid'))
+FROM trips t
+WHERE t.service_date BETWEEN $1 AND $2`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]existingTrip{}
+	for rows.Next() {
+		var (
+			ex                    existingTrip
+			trainID, routeID, dep string
+			date                  time.Time
+		)
+		if err := rows.Scan(&ex.id, &trainID, &routeID, &date, &dep, &ex.generated, &ex.status, &ex.hasBooking); err != nil {
+			return nil, err
+		}
+		out[departureKey(trainID, routeID, date, dep)] = ex
+	}
+	return out, rows.Err()
+}
+
+// createTrip inserts one departure with its stops, coaches and seats in a single
+// transaction. It reports false when the departure already exists.
+func createTrip(ctx context.Context, db booking.DB, d Departure) (bool, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+	t := d.Template
+	var tripID string
+	err = tx.QueryRow(ctx, `
+INSERT INTO trips (route_id, train_id, service_date, depart_time, arrive_time, status, base_price, template_id)
+VALUES ($1, $2, $3, $4::TIME, $5::TIME, 'scheduled', $6, $7)
+ON CONFLICT (train_id, route_id, service_date, depart_time) DO NOTHING
+RETURNING id`, t.RouteID, t.TrainID, d.Date, t.Depart, t.Arrive, t.BasePrice, t.ID).Scan(&tripID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := copyStops(ctx, tx, tripID, t.ID); err != nil {
+		return false, err
+	}
+
+	coaches, seats := Build(t.Consist)
+	var (
+		cNo, cRows, cCols []int64
+		cClass, cLayout   []string
+		sCoach            []int64
+		sNo, sClass       []string
+		sAccessible       []bool
+	)
+	for _, c := range coaches {
+		cNo, cClass, cLayout = append(cNo, int64(c.No)), append(cClass, c.Class), append(cLayout, c.Layout)
+		cRows, cCols = append(cRows, int64(c.Rows)), append(cCols, int64(c.Cols))
+	}
+	for _, s := range seats {
+		sCoach, sNo = append(sCoach, int64(s.CoachNo)), append(sNo, s.SeatNo)
+		sClass, sAccessible = append(sClass, s.Class), append(sAccessible, s.Accessible)
+	}
+	if _, err := tx.Exec(ctx, `
+INSERT INTO coaches (trip_id, coach_no, class, layout_code, rows, cols)
+SELECT $1, unnest($2::INT8[]), unnest($3::TEXT[]), unnest($4::TEXT[]), unnest($5::INT8[]), unnest($6::INT8[])`,
+		tripID, cNo, cClass, cLayout, cRows, cCols); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(ctx, `
+INSERT INTO seats (trip_id, coach_no, seat_no, class, is_accessible)
+SELECT $1, unnest($2::INT8[]), unnest($3::TEXT[]), unnest($4::TEXT[]), unnest($5::BOOL[])`,
+		tripID, sCoach, sNo, sClass, sAccessible); err != nil {
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
+// copyStops gives a new trip its template's stop pattern, or just the
+// route's two ends when the template has none.
+func copyStops(ctx context.Context, tx pgx.Tx, tripID, templateID string) error {
+	tag, err := tx.Exec(ctx, `
+INSERT INTO trip_stops (trip_id, seq, station_id, arrive_time, depart_time, day_offset, distance_km)
+SELECT $1, seq, station_id, arrive_time, depart_time, day_offset, distance_km
+FROM template_stops WHERE template_id = $2`, tripID, templateID)
+	if err != nil || tag.RowsAffected() > 0 {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+INSERT INTO trip_stops (trip_id, seq, station_id, arrive_time, depart_time, day_offset, distance_km)
+SELECT t.id, 0, r.origin_station_id, NULL, t.depart_time, 0, 0
+FROM trips t JOIN routes r ON r.id = t.route_id WHERE t.id = $1
+UNION ALL
+SELECT t.id, 1, r.dest_station_id, t.arrive_time, NULL, CASE WHEN t.arrive_time < t.depart_time THEN 1 ELSE 0 END, COALESCE(r.distance_km, 0)
+FROM trips t JOIN routes r ON r.id = t.route_id WHERE t.id = $1`, tripID)
+	return err
+}
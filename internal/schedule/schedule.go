@@ -0,0 +1,223 @@
+// Package schedule turns service calendars and timetable templates into
+// bookable inventory. For every day in a rolling window on which a train's
+// calendar runs, each active template of that train becomes a trip with its
+// coaches and seats. Expansion is pure (see Expand); Generate applies it.
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DateLayout is the format of dates in calendar exceptions and CLI flags.
+const DateLayout = "2006-01-02"
+
+// Weekday bits of service_calendars.weekday_flags.
+const (
+	Monday = 1 << iota
+	Tuesday
+	Wednesday
+	Thursday
+	Friday
+	Saturday
+	Sunday
+
+	Daily = Monday | Tuesday | Wednesday | Thursday | Friday | Saturday | Sunday
+)
+
+// WeekdayBit returns the weekday_flags bit for d.
+func WeekdayBit(d time.Weekday) int {
+	return 1 << ((int(d) + 6) % 7) // time.Sunday is 0, Monday is bit 0
+}
+
+// Exceptions are holiday changes to a calendar: dates with no service and
+// extra service dates outside the weekday pattern.
+type Exceptions struct {
+	Removed []string `json:"removed"`
+	Added   []string `json:"added"`
+}
+
+// ParseExceptions decodes service_calendars.exceptions. NULL, "{}" and a bare
+// array of removed dates are accepted; every date must be YYYY-MM-DD.
+func ParseExceptions(raw []byte) (Exceptions, error) {
+	var ex Exceptions
+	if len(raw) == 0 || string(raw) == "null" {
+		return ex, nil
+	}
+	if raw[0] == '[' {
+		if err := json.Unmarshal(raw, &ex.Removed); err != nil {
+			return ex, err
+		}
+	} else if err := json.Unmarshal(raw, &ex); err != nil {
+		return ex, err
+	}
+	for _, d := range append(append([]string{}, ex.Removed...), ex.Added...) {
+		if _, err := time.Parse(DateLayout, d); err != nil {
+			return ex, fmt.Errorf("exception date %q: want YYYY-MM-DD", d)
+		}
+	}
+	return ex, nil
+}
+
+// Calendar is one service_calendars row.
+type Calendar struct {
+	ID         string
+	TrainID    string
+	Weekdays   int
+	Start, End time.Time
+	Exceptions Exceptions
+}
+
+// Runs reports whether the calendar has service on day d. Removed dates win
+// over everything; added dates run even outside start_date..end_date.
+func (c Calendar) Runs(d time.Time) bool {
+	day := d.Format(DateLayout)
+	for _, r := range c.Exceptions.Removed {
+		if r == day {
+			return false
+		}
+	}
+	for _, a := range c.Exceptions.Added {
+		if a == day {
+			return true
+		}
+	}
+	if day < c.Start.Format(DateLayout) || day > c.End.Format(DateLayout) {
+		return false
+	}
+	return c.Weekdays&WeekdayBit(d.Weekday()) != 0
+}
+
+// CoachSpec is one entry of a template's consist: Count identical coaches.
+type CoachSpec struct {
+	Class          string `json:"class"`
+	Layout         string `json:"layout"`
+	Rows           int    `json:"rows"`
+	Cols           int    `json:"cols"`
+	Count          int    `json:"count"`
+	AccessibleRows []int  `json:"accessible_rows,omitempty"`
+}
+
+// Template is one timetable_templates row. A template with a CalendarID
+// follows only that calendar; otherwise it follows every calendar of its train.
+type Template struct {
+	ID         string
+	TrainID    string
+	RouteID    string
+	CalendarID string
+	Depart     string // HH:MM[:SS]
+	Arrive     string
+	BasePrice  int64
+	Consist    []CoachSpec
+}
+
+// ParseConsist decodes and checks timetable_templates.consist.
+func ParseConsist(raw []byte) ([]CoachSpec, error) {
+	var cs []CoachSpec
+	if err := json.Unmarshal(raw, &cs); err != nil {
+		return nil, err
+	}
+	if len(cs) == 0 {
+		return nil, errors.New("consist has no coaches")
+	}
+	for i, c := range cs {
+		if c.Class == "" || c.Layout == "" || c.Rows < 1 || c.Cols < 1 || c.Count < 1 {
+			return nil, fmt.Errorf("consist[%d]: class, layout, rows, cols and count are required", i)
+		}
+	}
+	return cs, nil
+}
+
+// Coach is a coach to create on a generated trip.
+type Coach struct {
+	No         int
+	Class      string
+	Layout     string
+	Rows, Cols int
+}
+
+// Seat is a seat to create on a generated trip. SeatNo uses the "RR-C"
+// convention understood by the seat map.
+type Seat struct {
+	CoachNo    int
+	SeatNo     string
+	Class      string
+	Accessible bool
+}
+
+// Build numbers the coaches of a consist from 1 and lays out their seats.
+func Build(consist []CoachSpec) ([]Coach, []Seat) {
+	var (
+		coaches []Coach
+		seats   []Seat
+	)
+	for _, spec := range consist {
+		accessible := map[int]bool{}
+		for _, r := range spec.AccessibleRows {
+			accessible[r] = true
+		}
+		for i := 0; i < spec.Count; i++ {
+			no := len(coaches) + 1
+			coaches = append(coaches, Coach{No: no, Class: spec.Class, Layout: spec.Layout, Rows: spec.Rows, Cols: spec.Cols})
+			for r := 1; r <= spec.Rows; r++ {
+				for c := 1; c <= spec.Cols; c++ {
+					seats = append(seats, Seat{CoachNo: no, SeatNo: fmt.Sprintf("%02d-%d", r, c), Class: spec.Class, Accessible: accessible[r]})
+				}
+			}
+		}
+	}
+	return coaches, seats
+}
+
+// Departure is one trip the calendars call for.
+type Departure struct {
+	Template Template
+	Date     time.Time
+}
+
+// Key identifies a departure the same way uq_trips_departure does.
+func (d Departure) Key() string {
+	return departureKey(d.Template.TrainID, d.Template.RouteID, d.Date, d.Template.Depart)
+}
+
+func departureKey(trainID, routeID string, date time.Time, depart string) string {
+	if len(depart) == 5 {
+		depart += ":00"
+	}
+	return trainID + "|" + routeID + "|" + date.Format(DateLayout) + "|" + depart
+}
+
+// Expand lists the departures for days days starting at from, in date order.
+// A template runs on a day when its calendar does or, without one, when any
+// calendar of its train does.
+func Expand(cals []Calendar, tpls []Template, from time.Time, days int) []Departure {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	byTrain := map[string][]Calendar{}
+	byID := map[string]Calendar{}
+	for _, c := range cals {
+		byTrain[c.TrainID] = append(byTrain[c.TrainID], c)
+		byID[c.ID] = c
+	}
+	var out []Departure
+	for i := 0; i < days; i++ {
+		d := from.AddDate(0, 0, i)
+		for _, t := range tpls {
+			follow := byTrain[t.TrainID]
+			if t.CalendarID != "" {
+				follow = nil
+				if c, ok := byID[t.CalendarID]; ok {
+					follow = []Calendar{c}
+				}
+			}
+			for _, c := range follow {
+				if c.Runs(d) {
+					out = append(out, Departure{Template: t, Date: d})
+					break
+				}
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,133 @@
+// Package seatfeed fans seat status changes out to the browsers watching a
+// trip's seat map or search results. Every instance publishes the changes it
+// commits through a Broker: Valkey pub/sub when VALKEY_URL is configured, so
+// a seat taken on one instance shows up on all of them, or an in-process
+// broker for a single instance.
+package seatfeed
+
+import (
+	"strings"
+	"sync"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/env"
+)
+
+// Broker delivers seat changes to subscribers of their trip.
+type Broker interface {
+	// Publish sends c to every subscriber of c.TripID. It never blocks.
+	Publish(c booking.SeatChange)
+	// Subscribe returns a channel of changes to the given trips and a func
+	// that unsubscribes and closes the channel. A subscriber that falls
+	// behind misses changes rather than holding up publishers.
+	Subscribe(tripIDs ...string) (<-chan booking.SeatChange, func())
+	// Close stops the broker and closes every subscription.
+	Close() error
+}
+
+// FromEnv returns a Valkey broker when VALKEY_URL (or REDIS_URL) is set and
+// an in-process one otherwise.
+func FromEnv() Broker {
+	ru := strings.TrimSpace(env.Get("VALKEY_URL", ""))
+	if ru == "" {
+		ru = strings.TrimSpace(env.Get("REDIS_URL", ""))
+	}
+	if ru == "" {
+		return NewLocal()
+	}
+	return NewValkey(ru, strings.TrimSpace(env.Get("VALKEY_TLS_SKIP_VERIFY", "")) == "1")
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultBroker Broker
+)
+
+// Default returns the process's broker, picked by FromEnv on first use.
+func Default() Broker {
+	defaultOnce.Do(func() { defaultBroker = FromEnv() })
+	return defaultBroker
+}
+
+// subBuffer is how many changes a subscriber may fall behind before it misses some.
+const subBuffer = 32
+
+type subscriber struct {
+	ch     chan booking.SeatChange
+	closed bool
+}
+
+// Local is an in-process Broker.
+type Local struct {
+	mu   sync.Mutex
+	subs map[string]map[*subscriber]struct{}
+}
+
+// NewLocal returns an in-process broker.
+func NewLocal() *Local {
+	return &Local{subs: map[string]map[*subscriber]struct{}{}}
+}
+
+// Publish implements Broker.
+func (l *Local) Publish(c booking.SeatChange) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for s := range l.subs[c.TripID] {
+		select {
+		case s.ch <- c:
+		default:
+		}
+	}
+}
+
+// Subscribe implements Broker.
+func (l *Local) Subscribe(tripIDs ...string) (<-chan booking.SeatChange, func()) {
+	s := &subscriber{ch: make(chan booking.SeatChange, subBuffer)}
+	l.mu.Lock()
+	for _, id := range tripIDs {
+		if l.subs[id] == nil {
+			l.subs[id] = map[*subscriber]struct{}{}
+		}
+		l.subs[id][s] = struct{}{}
+	}
+	l.mu.Unlock()
+	return s.ch, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, id := range tripIDs {
+			delete(l.subs[id], s)
+			if len(l.subs[id]) == 0 {
+				delete(l.subs, id)
+			}
+		}
+		l.close(s)
+	}
+}
+
+// Close implements Broker.
+func (l *Local) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for id, subs := range l.subs {
+		for s := range subs {
+			l.close(s)
+		}
+		delete(l.subs, id)
+	}
+	return nil
+}
+
+// close closes the subscriber's channel once; l.mu must be held.
+func (l *Local) close(s *subscriber) {
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+// Subscribers is the number of subscriptions to a trip.
+func (l *Local) Subscribers(tripID string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.subs[tripID])
+}
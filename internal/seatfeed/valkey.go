@@ -0,0 +1,157 @@
+package seatfeed
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+
+	"gothicforge3/internal/booking"
+)
+
+// ChannelPrefix starts the Valkey channel of a trip's seat changes; the trip id follows.
+const ChannelPrefix = "gf:seats:"
+
+// Valkey is a Broker that publishes through Valkey pub/sub and relays what
+// any instance published to local subscribers. When Valkey cannot be
+// reached, changes are still delivered to this instance's subscribers.
+type Valkey struct {
+	local  *Local
+	pool   *redigo.Pool
+	dial   func() (redigo.Conn, error)
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewValkey returns a broker on the Valkey instance at rawURL and starts
+// listening for changes. skipVerify forces TLS without certificate checks.
+func NewValkey(rawURL string, skipVerify bool) *Valkey {
+	ctx, cancel := context.WithCancel(context.Background())
+	v := &Valkey{local: NewLocal(), cancel: cancel, done: make(chan struct{})}
+	v.dial = func() (redigo.Conn, error) { return dialValkey(rawURL, skipVerify) }
+	v.pool = &redigo.Pool{MaxIdle: 4, IdleTimeout: 5 * time.Minute, Dial: v.dial}
+	go v.listen(ctx)
+	return v
+}
+
+// Publish implements Broker.
+func (v *Valkey) Publish(c booking.SeatChange) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	conn := v.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PUBLISH", ChannelPrefix+c.TripID, data); err != nil {
+		log.Printf("seatfeed: publish failed, delivering locally: %v", err)
+		v.local.Publish(c)
+	}
+}
+
+// Subscribe implements Broker.
+func (v *Valkey) Subscribe(tripIDs ...string) (<-chan booking.SeatChange, func()) {
+	return v.local.Subscribe(tripIDs...)
+}
+
+// Close implements Broker.
+func (v *Valkey) Close() error {
+	v.cancel()
+	<-v.done
+	_ = v.local.Close()
+	return v.pool.Close()
+}
+
+// listen relays every trip's changes to local subscribers, reconnecting with
+// backoff until ctx is done.
+func (v *Valkey) listen(ctx context.Context) {
+	defer close(v.done)
+	backoff := time.Second
+	for ctx.Err() == nil {
+		conn, err := v.dial()
+		if err == nil {
+			backoff = time.Second
+			err = v.relay(ctx, conn)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("seatfeed: valkey subscription lost, retrying in %s: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// relay receives on conn until it fails or ctx is done. A ping every 30
+// seconds notices a connection that went away silently.
+func (v *Valkey) relay(ctx context.Context, conn redigo.Conn) error {
+	psc := redigo.PubSubConn{Conn: conn}
+	defer psc.Close()
+	if err := psc.PSubscribe(ChannelPrefix + "*"); err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		t := time.NewTicker(30 * time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				_ = psc.Close()
+				return
+			case <-stop:
+				return
+			case <-t.C:
+				if err := psc.Ping(""); err != nil {
+					_ = psc.Close()
+					return
+				}
+			}
+		}
+	}()
+	for {
+		switch m := psc.ReceiveWithTimeout(time.Minute).(type) {
+		case redigo.Message:
+			var c booking.SeatChange
+			if err := json.Unmarshal(m.Data, &c); err == nil && c.TripID != "" {
+				v.local.Publish(c)
+			}
+		case error:
+			return m
+		}
+	}
+}
+
+// dialValkey connects like the session store does: rediss:// URLs, or any
+// URL when skipVerify is set, are dialled over TLS.
+func dialValkey(rawURL string, skipVerify bool) (redigo.Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (!strings.EqualFold(u.Scheme, "rediss") && !skipVerify) {
+		return redigo.DialURL(rawURL)
+	}
+	opts := []redigo.DialOption{redigo.DialUseTLS(true)}
+	if u.User != nil {
+		if pw, ok := u.User.Password(); ok {
+			opts = append(opts, redigo.DialPassword(pw))
+		}
+	}
+	if n, err := strconv.Atoi(strings.TrimPrefix(u.Path, "/")); err == nil {
+		opts = append(opts, redigo.DialDatabase(n))
+	}
+	if skipVerify {
+		opts = append(opts, redigo.DialTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+	}
+	return redigo.Dial("tcp", u.Host, opts...)
+}
@@ -4,14 +4,40 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 )
 
+var (
+	csrfMu     sync.RWMutex
+	csrfExempt []string
+)
+
+// ExemptFromCSRF skips the same-origin check for paths under the given prefixes.
+// Use it only for server-to-server callbacks that authenticate themselves
+// (e.g. signed payment webhooks), which never carry a browser Origin.
+func ExemptFromCSRF(prefixes ...string) {
+	csrfMu.Lock()
+	defer csrfMu.Unlock()
+	csrfExempt = append(csrfExempt, prefixes...)
+}
+
+func csrfExempted(path string) bool {
+	csrfMu.RLock()
+	defer csrfMu.RUnlock()
+	for _, p := range csrfExempt {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
 // CSRFMiddleware provides a simple same-origin check for state-changing requests in production.
 // Allowed without checks: GET, HEAD, OPTIONS. For others, require Origin or Referer to match Host.
 func CSRFMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		method := r.Method
-		if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+		if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions || csrfExempted(r.URL.Path) {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -0,0 +1,20 @@
+// Package textx holds small string helpers shared by the services.
+package textx
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Truncate cuts s to at most n bytes without splitting a rune and drops any
+// invalid UTF-8, which Postgres rejects in text columns. Error messages that
+// quote a receiver or a driver are not guaranteed to be valid UTF-8.
+func Truncate(s string, n int) string {
+	if len(s) > n {
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = s[:n]
+	}
+	return strings.ToValidUTF8(s, "")
+}
@@ -0,0 +1,100 @@
+package ticket
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"gothicforge3/internal/booking"
+)
+
+// Error codes returned by Board, in addition to booking.CodeInvalid.
+const (
+	CodeInvalidTicket  = "invalid_ticket"  // malformed payload or bad signature
+	CodeWrongTrip      = "wrong_trip"      // valid ticket for another trip
+	CodeTicketVoid     = "ticket_void"     // booking no longer paid or seat released
+	CodeAlreadyBoarded = "already_boarded" // ticket was used before
+)
+
+// Boarding is the outcome of scanning a ticket at a gate.
+type Boarding struct {
+	Claims    Claims    `json:"ticket"`
+	Passenger string    `json:"passenger"`
+	Category  string    `json:"category"`
+	IDType    string    `json:"id_type"`
+	IDLast4   string    `json:"id_last4"` // for checking the document shown at the gate
+	Gate      string    `json:"gate"`
+	BoardedAt time.Time `json:"boarded_at"`
+}
+
+// Board verifies a scanned payload for the trip being boarded and records a
+// boarding event. A ticket boards once: the unique booking_item_id in
+// boardings makes concurrent scans of the same ticket safe, and the loser gets
+// CodeAlreadyBoarded together with the first boarding's gate and time.
+func Board(ctx context.Context, db booking.Querier, pub ed25519.PublicKey, payload, tripID, gate string) (Boarding, error) {
+	var out Boarding
+	tripID, gate = strings.TrimSpace(tripID), strings.TrimSpace(gate)
+	if strings.TrimSpace(payload) == "" || tripID == "" {
+		return out, &booking.Error{Code: booking.CodeInvalid, Message: "payload and trip_id are required"}
+	}
+	if len(gate) > 64 {
+		return out, &booking.Error{Code: booking.CodeInvalid, Message: "gate is at most 64 characters", Fields: map[string]string{"gate": "gate is at most 64 characters"}}
+	}
+	c, err := Verify(pub, payload)
+	if err != nil {
+		return out, &booking.Error{Code: CodeInvalidTicket, Message: err.Error()}
+	}
+	out.Claims = c
+	if c.TripID != tripID {
+		return out, &booking.Error{Code: CodeWrongTrip, Message: "ticket is for " + c.Train + " on " + c.Date + ", not this trip"}
+	}
+
+	var code, bookingTrip, bStatus, iStatus, idNumber string
+	err = db.QueryRow(ctx, `
+SELECT b.code, s.trip_id, b.status, bi.status,
+       COALESCE(p.full_name, ''), COALESCE(p.category, ''), COALESCE(p.id_type, ''), COALESCE(p.id_number, '')
+FROM booking_items bi
+JOIN bookings b ON b.id = bi.booking_id
+JOIN seats s ON s.id = bi.seat_id
+LEFT JOIN passengers p ON p.booking_item_id = bi.id
+WHERE bi.id = $1`, c.ItemID).Scan(&code, &bookingTrip, &bStatus, &iStatus, &out.Passenger, &out.Category, &out.IDType, &idNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return out, &booking.Error{Code: CodeTicketVoid, Message: "ticket does not match any booking"}
+	}
+	if err != nil {
+		return out, err
+	}
+	if !strings.EqualFold(code, c.Code) || bookingTrip != c.TripID || (c.IDHash != "" && HashPassengerID(code, out.IDType, idNumber) != c.IDHash) {
+		return out, &booking.Error{Code: CodeTicketVoid, Message: "ticket no longer matches its booking"}
+	}
+	if bStatus != booking.StatusPaid || iStatus != booking.ItemConfirmed {
+		return out, &booking.Error{Code: CodeTicketVoid, Message: "booking " + code + " is " + bStatus + "; this ticket is not valid"}
+	}
+	if n := len(idNumber); n > 4 {
+		out.IDLast4 = idNumber[n-4:]
+	}
+
+	err = db.QueryRow(ctx, `
+INSERT INTO boardings (booking_item_id, trip_id, gate)
+VALUES ($1, $2, $3)
+ON CONFLICT (booking_item_id) DO NOTHING
+RETURNING gate, boarded_at`, c.ItemID, tripID, gate).Scan(&out.Gate, &out.BoardedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if err := db.QueryRow(ctx, `SELECT gate, boarded_at FROM boardings WHERE booking_item_id = $1`, c.ItemID).Scan(&out.Gate, &out.BoardedAt); err != nil {
+			return out, err
+		}
+		return out, &booking.Error{Code: CodeAlreadyBoarded, Message: "ticket already used at " + out.BoardedAt.Format("15:04") + gateSuffix(out.Gate)}
+	}
+	return out, err
+}
+
+func gateSuffix(gate string) string {
+	if gate == "" {
+		return ""
+	}
+	return " (gate " + gate + ")"
+}
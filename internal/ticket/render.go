@@ -0,0 +1,118 @@
+package ticket
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	qrcode "github.com/skip2/go-qrcode"
+
+	"gothicforge3/internal/booking"
+)
+
+// QRMatrix encodes a payload as a QR module matrix (true = dark), including the quiet zone.
+func QRMatrix(payload string) ([][]bool, error) {
+	q, err := qrcode.New(payload, qrcode.Medium)
+	if err != nil {
+		return nil, err
+	}
+	return q.Bitmap(), nil
+}
+
+// SVG renders a payload as an inline SVG QR code, size pixels square.
+func SVG(payload string, size int) (string, error) {
+	m, err := QRMatrix(payload)
+	if err != nil {
+		return "", err
+	}
+	n := len(m)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges" role="img" aria-label="Ticket QR code">`, n, n, size, size)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range m {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.String(), nil
+}
+
+// WritePDF renders one A6 boarding pass page per ticket.
+func WritePDF(w io.Writer, b booking.Booking, tickets []Ticket) error {
+	pdf := fpdf.New("P", "mm", "A6", "")
+	pdf.SetTitle("E-ticket "+b.Code, true)
+	pdf.SetCreator("gothicforge3", true)
+	pdf.SetAutoPageBreak(false, 0)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	for _, tk := range tickets {
+		t := b.TripOf(tk.TripID)
+		pdf.AddPage()
+		pdf.SetFillColor(79, 70, 229)
+		pdf.Rect(0, 0, 105, 18, "F")
+		pdf.SetTextColor(255, 255, 255)
+		pdf.SetFont("Helvetica", "B", 14)
+		pdf.SetXY(6, 4)
+		pdf.CellFormat(60, 10, "E-TICKET", "", 0, "L", false, 0, "")
+		pdf.SetFont("Courier", "B", 14)
+		pdf.CellFormat(33, 10, b.Code, "", 1, "R", false, 0, "")
+
+		pdf.SetTextColor(0, 0, 0)
+		pdf.SetXY(6, 22)
+		pdf.SetFont("Helvetica", "B", 12)
+		pdf.CellFormat(93, 6, tr(t.TrainName+" ("+t.TrainCode+")"), "", 1, "L", false, 0, "")
+		pdf.SetX(6)
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(93, 5, tr(t.OriginName+" "+t.Depart+"  -  "+t.DestinationName+" "+t.Arrive), "", 1, "L", false, 0, "")
+		pdf.SetX(6)
+		pdf.CellFormat(93, 5, t.ServiceDate, "", 1, "L", false, 0, "")
+
+		pdf.Ln(2)
+		row := func(label, value string) {
+			pdf.SetX(6)
+			pdf.SetFont("Helvetica", "", 8)
+			pdf.CellFormat(25, 5, label, "", 0, "L", false, 0, "")
+			pdf.SetFont("Helvetica", "B", 10)
+			pdf.CellFormat(68, 5, tr(value), "", 1, "L", false, 0, "")
+		}
+		name := tk.Passenger
+		if tk.Category != "" && tk.Category != booking.CategoryAdult {
+			name += " (" + tk.Category + ")"
+		}
+		row("Passenger", name)
+		row("Coach / seat", strconv.Itoa(tk.Coach)+" / "+tk.Seat)
+		if tk.Class != "" {
+			row("Class", strings.ToUpper(tk.Class[:1])+tk.Class[1:])
+		}
+
+		m, err := QRMatrix(tk.Payload)
+		if err != nil {
+			return err
+		}
+		const side = 60.0
+		x0, y0 := (105-side)/2, 72.0
+		cell := side / float64(len(m))
+		pdf.SetFillColor(0, 0, 0)
+		for y, r := range m {
+			for x, dark := range r {
+				if dark {
+					pdf.Rect(x0+float64(x)*cell, y0+float64(y)*cell, cell, cell, "F")
+				}
+			}
+		}
+		pdf.SetXY(6, y0+side+2)
+		pdf.SetFont("Helvetica", "", 7)
+		pdf.MultiCell(93, 3.5, "Show this code at the gate together with the ID used for booking. Signed ticket - alterations make it invalid.", "", "C", false)
+	}
+	if len(tickets) == 0 {
+		pdf.AddPage()
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.SetXY(6, 10)
+		pdf.MultiCell(93, 5, "Booking "+b.Code+" has no tickets yet. Tickets are issued once payment is confirmed.", "", "L", false)
+	}
+	return pdf.Output(w)
+}
@@ -0,0 +1,167 @@
+// Package ticket issues and verifies e-tickets. Every confirmed seat on a paid
+// booking gets a compact payload signed with ed25519, so gates and support
+// tools can check a ticket offline with nothing but the public key.
+//
+// Payload format: "KT1.<base64url(JSON claims)>.<base64url(signature)>".
+package ticket
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/env"
+)
+
+// Prefix tags the payload version.
+const Prefix = "KT1"
+
+// Verification errors.
+var (
+	ErrMalformed    = errors.New("ticket: malformed payload")
+	ErrBadSignature = errors.New("ticket: invalid signature")
+)
+
+// Claims is the signed content of a ticket. Field names are short to keep the QR code small.
+type Claims struct {
+	Code   string `json:"b"` // booking code
+	ItemID string `json:"i"` // booking_items.id
+	TripID string `json:"t"`
+	Date   string `json:"d"` // service date, YYYY-MM-DD
+	Train  string `json:"n"` // train code
+	Coach  int    `json:"c"`
+	Seat   string `json:"s"`
+	IDHash string `json:"h"` // HashPassengerID of the passenger's document
+}
+
+// Ticket is one passenger's boarding pass.
+type Ticket struct {
+	Claims
+	Payload   string
+	Passenger string
+	Category  string
+	Class     string
+}
+
+// devSeed derives the development signing key when TICKET_SIGNING_KEY is unset,
+// mirroring the JWT_SECRET fallback in internal/auth.
+var devSeed = sha256.Sum256([]byte("devsecret-change-me:tickets"))
+
+// PrivateKeyFromEnv returns the signing key from TICKET_SIGNING_KEY (base64 ed25519 seed).
+// Outside production a fixed development key is used when it is unset.
+func PrivateKeyFromEnv() (ed25519.PrivateKey, error) {
+	raw := strings.TrimSpace(env.Get("TICKET_SIGNING_KEY", ""))
+	if raw == "" {
+		if strings.EqualFold(env.Get("APP_ENV", "development"), "production") {
+			return nil, errors.New("ticket: TICKET_SIGNING_KEY is not set")
+		}
+		return ed25519.NewKeyFromSeed(devSeed[:]), nil
+	}
+	seed, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("ticket: TICKET_SIGNING_KEY must be a base64 32-byte ed25519 seed")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// PublicKeyFromEnv returns the verification key: TICKET_PUBLIC_KEY when set,
+// otherwise the public half of the signing key.
+func PublicKeyFromEnv() (ed25519.PublicKey, error) {
+	if raw := strings.TrimSpace(env.Get("TICKET_PUBLIC_KEY", "")); raw != "" {
+		return ParsePublicKey(raw)
+	}
+	priv, err := PrivateKeyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return priv.Public().(ed25519.PublicKey), nil
+}
+
+// ParsePublicKey decodes a base64 ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, errors.New("ticket: public key must be base64 of 32 bytes")
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// HashPassengerID binds a ticket to an identity document without putting the
+// number in the QR code. The booking code salts the hash so equal IDs on
+// different bookings do not produce equal hashes.
+func HashPassengerID(code, idType, idNumber string) string {
+	sum := sha256.Sum256([]byte(strings.ToUpper(code) + "|" + strings.ToLower(idType) + ":" + strings.ToUpper(idNumber)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Sign encodes and signs claims.
+func Sign(priv ed25519.PrivateKey, c Claims) (string, error) {
+	body, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	signed := Prefix + "." + base64.RawURLEncoding.EncodeToString(body)
+	sig := ed25519.Sign(priv, []byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// Verify checks the signature of a payload and returns its claims.
+func Verify(pub ed25519.PublicKey, payload string) (Claims, error) {
+	var c Claims
+	payload = strings.TrimSpace(payload)
+	i := strings.LastIndexByte(payload, '.')
+	if i < 0 || !strings.HasPrefix(payload, Prefix+".") {
+		return c, ErrMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(payload[i+1:])
+	if err != nil {
+		return c, ErrMalformed
+	}
+	if !ed25519.Verify(pub, []byte(payload[:i]), sig) {
+		return c, ErrBadSignature
+	}
+	body, err := base64.RawURLEncoding.DecodeString(payload[len(Prefix)+1 : i])
+	if err != nil {
+		return c, ErrMalformed
+	}
+	if err := json.Unmarshal(body, &c); err != nil {
+		return c, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return c, nil
+}
+
+// Issue returns a signed ticket for every confirmed seat of a paid booking,
+// each for the train its seat is on. Other bookings have no tickets yet and
+// return none.
+func Issue(priv ed25519.PrivateKey, b booking.Booking) ([]Ticket, error) {
+	if b.Status != booking.StatusPaid {
+		return nil, nil
+	}
+	out := make([]Ticket, 0, len(b.Items))
+	for _, it := range b.Items {
+		if it.Status != booking.ItemConfirmed {
+			continue
+		}
+		trip := b.TripOf(it.TripID)
+		t := Ticket{
+			Claims: Claims{Code: b.Code, ItemID: it.ID, TripID: it.TripID, Date: trip.ServiceDate, Train: trip.TrainCode, Coach: it.CoachNo, Seat: it.SeatNo},
+			Class:  it.Class,
+		}
+		if p := it.Passenger; p != nil {
+			t.IDHash = HashPassengerID(b.Code, p.IDType, p.IDNumber)
+			t.Passenger, t.Category = p.Name, p.Category
+		}
+		var err error
+		if t.Payload, err = Sign(priv, t.Claims); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
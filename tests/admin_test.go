@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/admin"
+	"gothicforge3/internal/auth"
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/server"
+)
+
+func Test_Admin_Roles(t *testing.T) {
+	if !admin.IsAdmin(map[string]any{"sub": "1", "role": "admin"}) || !admin.IsAdmin(map[string]any{"roles": []any{"ops", "admin"}}) {
+		t.Fatal("the admin role opens the console")
+	}
+	if admin.IsAdmin(map[string]any{"sub": "1", "role": "dev"}) || admin.IsAdmin(nil) {
+		t.Fatal("other roles do not")
+	}
+	if got := admin.Actor(map[string]any{"sub": float64(42), "login": "octo"}); got != "github:octo" {
+		t.Fatalf("actor of a GitHub session: %q", got)
+	}
+	if got := admin.Actor(map[string]any{"sub": "dev"}); got != "user:dev" {
+		t.Fatalf("actor of a dev session: %q", got)
+	}
+	t.Setenv("ADMIN_GITHUB_LOGINS", "octo, Hubot")
+	if !admin.GitHubAdmin("hubot") || admin.GitHubAdmin("someone") || admin.GitHubAdmin("") {
+		t.Fatal("ADMIN_GITHUB_LOGINS is a case-insensitive list")
+	}
+}
+
+func Test_Admin_Guard(t *testing.T) {
+	_ = os.Setenv("LOG_FORMAT", "off")
+	r := server.New()
+	routes.Register(r)
+	get := func(role string) int {
+		req := httptest.NewRequest(http.MethodGet, "/admin/stations", nil)
+		if role != "" {
+			tok, _, err := auth.Issue(time.Minute, map[string]any{"sub": "ops", "role": role})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.AddCookie(&http.Cookie{Name: "gf_jwt", Value: tok})
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := get(""); code != http.StatusUnauthorized {
+		t.Fatalf("no session: want 401, got %d", code)
+	}
+	if code := get("dev"); code != http.StatusForbidden {
+		t.Fatalf("not an admin: want 403, got %d", code)
+	}
+	if code := get("admin"); code == http.StatusUnauthorized || code == http.StatusForbidden {
+		t.Fatalf("an admin gets through, got %d", code)
+	}
+}
+
+func Test_Admin_TripStatus(t *testing.T) {
+	for _, c := range []struct {
+		from, to string
+		ok       bool
+	}{
+		{admin.TripScheduled, admin.TripDelayed, true},
+		{admin.TripDelayed, admin.TripScheduled, true},
+		{admin.TripScheduled, admin.TripCancelled, true},
+		{admin.TripCancelled, admin.TripScheduled, true},
+		{admin.TripDeparted, admin.TripArrived, true},
+		{admin.TripArrived, admin.TripScheduled, false},
+		{admin.TripDeparted, admin.TripCancelled, false},
+		{admin.TripScheduled, "boarding", false},
+	} {
+		err := admin.CanChangeStatus(c.from, c.to)
+		if (err == nil) != c.ok {
+			t.Fatalf("%s → %s: %v", c.from, c.to, err)
+		}
+		if err != nil && booking.FieldErrors(err)["status"] == "" {
+			t.Fatalf("%s → %s should blame the status field: %v", c.from, c.to, err)
+		}
+	}
+	if !admin.Confirmed("AP", " ap ") || admin.Confirmed("AP", "") || admin.Confirmed("", "") {
+		t.Fatal("confirmation is the expected code, case-insensitive")
+	}
+}
+
+func Test_Admin_Validate(t *testing.T) {
+	s := admin.Station{Code: " gmr ", Name: "Gambir", Lat: -6.17, Lon: 106.83}
+	if err := s.Validate(); err != nil || s.Code != "GMR" {
+		t.Fatalf("valid station: %+v, %v", s, err)
+	}
+	for field, bad := range map[string]admin.Station{
+		"code": {Code: "G M", Name: "x"},
+		"name": {Code: "GMR"},
+		"lat":  {Code: "GMR", Name: "x", Lat: 91},
+	} {
+		if err := bad.Validate(); booking.FieldErrors(err)[field] == "" {
+			t.Fatalf("bad %s: %v", field, err)
+		}
+	}
+
+	tr := admin.Train{Code: "ap", Name: "Argo Parahyangan", Classes: []string{"Economy", "", "executive"}}
+	if err := tr.Validate(); err != nil || tr.Code != "AP" || len(tr.Classes) != 2 {
+		t.Fatalf("valid train: %+v, %v", tr, err)
+	}
+	if err := (&admin.Train{Code: "AP", Name: "x", Classes: []string{"first"}}).Validate(); booking.FieldErrors(err)["classes"] == "" {
+		t.Fatalf("unknown class: %v", err)
+	}
+
+	rt := admin.Route{Code: "gmr-bd", Origin: "gmr", Destination: "bd", DistanceKM: 150}
+	if err := rt.Validate(); err != nil || rt.Code != "GMR-BD" || rt.Origin != "GMR" {
+		t.Fatalf("valid route: %+v, %v", rt, err)
+	}
+	if err := (&admin.Route{Code: "X", Origin: "BD", Destination: "bd"}).Validate(); booking.FieldErrors(err)["destination"] == "" {
+		t.Fatalf("a route needs two stations: %v", err)
+	}
+}
+
+func Test_Admin_Occupancy(t *testing.T) {
+	o := admin.NewOccupancy([]admin.CoachOccupancy{
+		{CoachNo: 1, Class: "executive", Seats: 50, Sold: 40, Held: 2},
+		{CoachNo: 2, Class: "economy", Seats: 80, Sold: 25, Held: 0},
+	})
+	if o.Seats != 130 || o.Sold != 65 || o.Held != 2 || o.Percent() != 50 {
+		t.Fatalf("totals: %+v, %d%%", o, o.Percent())
+	}
+	if o.Coaches[0].Free() != 8 {
+		t.Fatalf("free seats in coach 1: %d", o.Coaches[0].Free())
+	}
+	if (admin.Occupancy{}).Percent() != 0 {
+		t.Fatal("a trip without seats is empty")
+	}
+}
@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/server"
+)
+
+func Test_Booking_SplitBookings(t *testing.T) {
+	now := time.Date(2026, 5, 20, 12, 0, 0, 0, time.Local)
+	trip := func(date, depart string) booking.TripInfo { return booking.TripInfo{ServiceDate: date, Depart: depart} }
+	bs := []booking.Booking{
+		{Code: "LATER", Status: booking.StatusPaid, Trip: trip("2026-06-01", "08:00"), CreatedAt: now.Add(-time.Hour)},
+		{Code: "LEFT", Status: booking.StatusPaid, Trip: trip("2026-05-20", "08:00"), CreatedAt: now.Add(-2 * time.Hour)},
+		{Code: "SOON", Status: booking.StatusPending, Trip: trip("2026-05-21", "08:00"), CreatedAt: now.Add(-3 * time.Hour)},
+		{Code: "GONE", Status: booking.StatusCancelled, Trip: trip("2026-07-01", "08:00"), CreatedAt: now},
+		// A journey whose first train left but whose connection has not.
+		{Code: "CHANGE", Status: booking.StatusPaid, Trip: trip("2026-05-20", "09:00"), CreatedAt: now.Add(-4 * time.Hour),
+			Legs: []booking.BookedLeg{{Trip: trip("2026-05-20", "09:00")}, {Trip: trip("2026-05-20", "13:00")}}},
+	}
+	up, past := booking.SplitBookings(bs, now)
+	if codes(up) != "CHANGE SOON LATER" {
+		t.Fatalf("upcoming, soonest first: %s", codes(up))
+	}
+	if codes(past) != "GONE LEFT" {
+		t.Fatalf("past, newest first: %s", codes(past))
+	}
+}
+
+func codes(bs []booking.Booking) string {
+	s := ""
+	for i, b := range bs {
+		if i > 0 {
+			s += " "
+		}
+		s += b.Code
+	}
+	return s
+}
+
+func Test_Booking_FindGuestBooking_Validation(t *testing.T) {
+	if _, err := booking.FindGuestBooking(context.Background(), nil, "K7QM2XA", " "); booking.ErrorCode(err) != booking.CodeInvalid {
+		t.Fatalf("an email is required, got %v", err)
+	}
+}
+
+func Test_API_GuestLookup_RateLimited(t *testing.T) {
+	t.Setenv("GUEST_LOOKUP_LIMIT", "3")
+	r := server.New()
+	routes.Register(r)
+	lookup := func(path, contentType, body string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.RemoteAddr = "203.0.113.18:4321"
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	// The API and the account page draw on the same budget.
+	for i, path := range []string{"/api/bookings/lookup", "/account/bookings/lookup", "/api/bookings/lookup"} {
+		if code := lookup(path, "application/x-www-form-urlencoded", "code=K7QM2XA&email=a%40example.com"); code == http.StatusTooManyRequests {
+			t.Fatalf("lookup %d was limited", i+1)
+		}
+	}
+	if code := lookup("/api/bookings/lookup", "application/json", `{"code":"K7QM2XA","email":"a@example.com"}`); code != http.StatusTooManyRequests {
+		t.Fatalf("fourth lookup in a minute: %d", code)
+	}
+	if code := lookup("/account/bookings/lookup", "application/x-www-form-urlencoded", "code=K7QM2XA&email=a%40example.com"); code != http.StatusTooManyRequests {
+		t.Fatalf("fifth lookup in a minute, from the page: %d", code)
+	}
+}
+
+func Test_API_GuestLookup_GrantsMatchingBooking(t *testing.T) {
+	pool := testPool(t)
+	tripID, seats := testTrip(t, pool, 1)
+	b := bookPaid(t, pool, "session:guest-owner", "guest@example.com", tripID, seats)
+
+	r := server.New()
+	routes.Register(r)
+	cookies := map[string]*http.Cookie{}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = "203.0.113.19:4321"
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		for _, c := range rec.Result().Cookies() {
+			cookies[c.Name] = c
+		}
+		return rec
+	}
+	history := "/api/bookings/history?" + url.Values{"code": {b.Code}}.Encode()
+	lookup := func(code, email string) int {
+		return do(http.MethodPost, "/api/bookings/lookup", url.Values{"code": {code}, "email": {email}}.Encode()).Code
+	}
+
+	// Start a session, then prove nothing but the right pair opens the booking.
+	if rec := do(http.MethodGet, history, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("someone else's booking: %d", rec.Code)
+	}
+	for _, c := range []struct{ code, email string }{
+		{b.Code, "other@example.com"},
+		{"ZZZZZZZ", "guest@example.com"},
+	} {
+		if got := lookup(c.code, c.email); got != http.StatusNotFound {
+			t.Fatalf("lookup %s / %s: %d", c.code, c.email, got)
+		}
+		if rec := do(http.MethodGet, history, ""); rec.Code != http.StatusNotFound {
+			t.Fatalf("history after a failed lookup: %d", rec.Code)
+		}
+	}
+
+	before := map[string]string{}
+	for name, c := range cookies {
+		before[name] = c.Value
+	}
+	if got := lookup(b.Code, " GUEST@example.com "); got != http.StatusOK {
+		t.Fatalf("lookup with the right code and email: %d", got)
+	}
+	renewed := false
+	for name, c := range cookies {
+		if before[name] != "" && before[name] != c.Value {
+			renewed = true
+		}
+	}
+	if !renewed {
+		t.Fatal("the session token was not renewed after a successful lookup")
+	}
+	if rec := do(http.MethodGet, history, ""); rec.Code != http.StatusOK {
+		t.Fatalf("history after the lookup: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// The token from before the lookup does not carry the grant.
+	req := httptest.NewRequest(http.MethodGet, history, nil)
+	for name, v := range before {
+		req.AddCookie(&http.Cookie{Name: name, Value: v})
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("history with the old session token: %d", rec.Code)
+	}
+}
@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/payment"
+)
+
+const (
+	cancelItemA  = "7a1c2d3e-4a5b-4c6d-8e7f-00112233440a"
+	cancelItemB  = "7a1c2d3e-4a5b-4c6d-8e7f-00112233440b"
+	cancelItemC  = "7a1c2d3e-4a5b-4c6d-8e7f-00112233440c"
+	cancelTrip2  = "7a1c2d3e-4a5b-4c6d-8e7f-0011223344ff"
+	cancelItemA2 = "7a1c2d3e-4a5b-4c6d-8e7f-00112233441a"
+)
+
+// cancelBooking is a paid booking for an adult, a senior and an infant on a train
+// leaving 2026-05-20 08:00 local time.
+func cancelBooking() booking.Booking {
+	pax := func(name, cat, id string) *booking.Passenger {
+		return &booking.Passenger{Name: name, IDType: "nik", IDNumber: id, Category: cat}
+	}
+	return booking.Booking{
+		Status: booking.StatusPaid, Total: 500000, TripID: "trip",
+		Trip: booking.TripInfo{ServiceDate: "2026-05-20", Depart: "08:00"},
+		Items: []booking.Item{
+			{ID: cancelItemA, TripID: "trip", Price: 200000, Status: booking.ItemConfirmed, Passenger: pax("Budi", "adult", "1")},
+			{ID: cancelItemB, TripID: "trip", Price: 200000, Status: booking.ItemConfirmed, Passenger: pax("Oma", "senior", "2")},
+			{ID: cancelItemC, TripID: "trip", Price: 100000, Status: booking.ItemConfirmed, Passenger: pax("Siti", "infant", "3")},
+		},
+	}
+}
+
+func Test_Booking_RefundPolicy(t *testing.T) {
+	p := booking.DefaultRefundPolicy()
+	departs := time.Date(2026, 5, 20, 8, 0, 0, 0, time.Local)
+	for _, c := range []struct {
+		before time.Duration
+		want   int64
+	}{
+		{30 * 24 * time.Hour, 75},
+		{7 * 24 * time.Hour, 75},
+		{7*24*time.Hour - time.Minute, 50},
+		{24 * time.Hour, 50},
+		{2 * time.Hour, 25},
+		{time.Second, 25},
+		{0, 0},
+		{-time.Hour, 0},
+	} {
+		if got := p.Percent(departs, departs.Add(-c.before)); got != c.want {
+			t.Fatalf("%v before departure: got %d%%, want %d%%", c.before, got, c.want)
+		}
+	}
+	if got := (booking.RefundPolicy{}).Percent(departs, departs.Add(-time.Hour)); got != 0 {
+		t.Fatalf("an empty policy refunds nothing, got %d", got)
+	}
+}
+
+func Test_Booking_PlanCancellation(t *testing.T) {
+	p := booking.DefaultRefundPolicy()
+	b := cancelBooking()
+	early := time.Date(2026, 5, 1, 12, 0, 0, 0, time.Local)
+
+	got, err := booking.PlanCancellation(b, []string{cancelItemB}, p, early)
+	if err != nil || len(got) != 1 || got[0] != (booking.ItemRefund{ItemID: cancelItemB, Percent: 75, Amount: 150000}) {
+		t.Fatalf("one passenger at H-19: %+v, %v", got, err)
+	}
+	got, err = booking.PlanCancellation(b, nil, p, time.Date(2026, 5, 20, 7, 0, 0, 0, time.Local))
+	if err != nil || len(got) != 3 || got[2].Amount != 25000 {
+		t.Fatalf("the whole booking an hour before departure: %+v, %v", got, err)
+	}
+	if got, _ := booking.PlanCancellation(b, nil, p, time.Date(2026, 5, 20, 9, 0, 0, 0, time.Local)); got[0].Amount != 0 {
+		t.Fatalf("nothing is refunded after departure: %+v", got)
+	}
+
+	// The promo discount is shared by the seats: 500000 paid for 625000 of fares.
+	b.Total, b.Discount = 500000, 125000
+	b.Items[0].Price = 250000
+	if got, _ := booking.PlanCancellation(b, []string{cancelItemA}, p, early); got[0].Amount != 150000 {
+		t.Fatalf("refund of a discounted seat: %+v", got)
+	}
+
+	if _, err := booking.PlanCancellation(cancelBooking(), []string{cancelItemA, cancelItemB}, p, early); booking.FieldErrors(err)["item_ids"] == "" {
+		t.Fatalf("the infant would be left alone, got %v", err)
+	}
+	if _, err := booking.PlanCancellation(cancelBooking(), []string{cancelItemA, cancelItemB, cancelItemC}, p, early); err != nil {
+		t.Fatalf("cancelling everyone is fine: %v", err)
+	}
+
+	cancelled := cancelBooking()
+	cancelled.Items[1].Status = booking.ItemCancelled
+	if _, err := booking.PlanCancellation(cancelled, []string{cancelItemB}, p, early); booking.ErrorCode(err) != booking.CodeNotCancellable {
+		t.Fatalf("a cancelled seat cannot be cancelled again, got %v", err)
+	}
+	pending := cancelBooking()
+	pending.Status = booking.StatusPending
+	if _, err := booking.PlanCancellation(pending, []string{cancelItemB}, p, early); booking.ErrorCode(err) != booking.CodeInvalid {
+		t.Fatalf("an unpaid booking is cancelled as a whole, got %v", err)
+	}
+	if got, err := booking.PlanCancellation(pending, nil, p, early); err != nil || got[0].Amount != 0 {
+		t.Fatalf("an unpaid booking refunds nothing: %+v, %v", got, err)
+	}
+	pending.Status = booking.StatusExpired
+	if _, err := booking.PlanCancellation(pending, nil, p, early); booking.ErrorCode(err) != booking.CodeNotCancellable {
+		t.Fatalf("an expired booking cannot be cancelled, got %v", err)
+	}
+}
+
+func Test_Booking_PlanCancellation_Journey(t *testing.T) {
+	b := cancelBooking()
+	b.Items = b.Items[:2]
+	b.Legs = []booking.BookedLeg{
+		{TripID: "trip", Trip: b.Trip},
+		{TripID: cancelTrip2, Trip: booking.TripInfo{ServiceDate: "2026-05-20", Depart: "13:00"}},
+	}
+	b.Items = append(b.Items, booking.Item{ID: cancelItemA2, TripID: cancelTrip2, Price: 100000, Status: booking.ItemConfirmed, Passenger: b.Items[0].Passenger})
+	// Between the departures: the first train left, the second is an hour away.
+	got, err := booking.PlanCancellation(b, []string{cancelItemA}, booking.DefaultRefundPolicy(), time.Date(2026, 5, 20, 12, 0, 0, 0, time.Local))
+	if err != nil || len(got) != 2 || got[0].Amount != 0 || got[1] != (booking.ItemRefund{ItemID: cancelItemA2, Percent: 25, Amount: 25000}) {
+		t.Fatalf("a passenger is cancelled on every leg: %+v, %v", got, err)
+	}
+}
+
+func Test_Payment_MemoryRefunder(t *testing.T) {
+	r := &payment.MemoryRefunder{}
+	ctx := context.Background()
+	ref, err := r.Refund(ctx, payment.RefundRequest{RefundID: "r1", OrderID: "K7QM2XA-1", Amount: 150000})
+	if err != nil || ref == "" {
+		t.Fatalf("refund failed: %q, %v", ref, err)
+	}
+	r.Err = errors.New("gateway down")
+	if _, err := r.Refund(ctx, payment.RefundRequest{RefundID: "r2", Amount: 1}); err == nil {
+		t.Fatal("a failing refunder should fail")
+	}
+	if r.Refunded() != 150000 || len(r.Requests) != 1 {
+		t.Fatalf("only the successful refund counts: %+v", r.Requests)
+	}
+	var _ payment.Refunder = payment.NewSimulator("s3cret")
+}
+
+func Test_Payment_Midtrans_Refund(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/K7QM2XA-AB12/refund" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"status_code":"404","status_message":"not found"}`))
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"status_code":"200","status_message":"Success, refund request is approved","refund_chargeback_id":4242,"refund_key":"r1"}`))
+	}))
+	defer srv.Close()
+	m := payment.NewMidtrans("SB-Mid-server-key", srv.URL)
+	ref, err := m.Refund(context.Background(), payment.RefundRequest{RefundID: "r1", OrderID: "K7QM2XA-AB12", Amount: 150000, Reason: "cancelled"})
+	if err != nil || ref != "4242" || got["refund_key"] != "r1" || got["amount"] != float64(150000) {
+		t.Fatalf("refund: %q, %v, sent %v", ref, err, got)
+	}
+	if _, err := m.Refund(context.Background(), payment.RefundRequest{RefundID: "r2", OrderID: "UNKNOWN"}); err == nil {
+		t.Fatal("a rejected refund should fail")
+	}
+}
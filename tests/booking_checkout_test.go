@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gothicforge3/internal/booking"
+)
+
+func Test_Booking_NewBookingCode(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 500; i++ {
+		c := booking.NewBookingCode()
+		if len(c) != booking.CodeLength {
+			t.Fatalf("want length %d, got %q", booking.CodeLength, c)
+		}
+		if strings.ContainsAny(c, "01OIL") {
+			t.Fatalf("code contains ambiguous characters: %q", c)
+		}
+		if strings.ToUpper(c) != c {
+			t.Fatalf("code should be upper case: %q", c)
+		}
+		seen[c] = true
+	}
+	if len(seen) < 495 {
+		t.Fatalf("too many collisions: %d unique of 500", len(seen))
+	}
+}
+
+func Test_Booking_Contact_Validate(t *testing.T) {
+	c := booking.Contact{Name: "  Siti Rahma ", Email: " Siti@Example.COM "}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if c.Name != "Siti Rahma" || c.Email != "siti@example.com" {
+		t.Fatalf("not normalized: %+v", c)
+	}
+	for _, bad := range []booking.Contact{
+		{Email: "a@b.co"},
+		{Name: "A", Email: "not-an-email"},
+		{Name: "A", Email: "Budi <budi@example.com>"},
+	} {
+		if err := bad.Validate(); booking.ErrorCode(err) != booking.CodeInvalid {
+			t.Fatalf("want invalid_request for %+v, got %v", bad, err)
+		}
+	}
+}
+
+func Test_Booking_Checkout_RejectsBadInput(t *testing.T) {
+	ctx := context.Background()
+	trip := "6f1c2d3e-4a5b-4c6d-8e7f-001122334455"
+	contact := booking.Contact{Name: "Budi", Email: "budi@example.com"}
+	cases := []booking.CheckoutRequest{
+		{TripID: trip, Contact: contact},
+		{Holder: "session:x", TripID: "x", Contact: contact},
+		{Holder: "session:x", TripID: trip, SeatIDs: []string{"A1"}, Contact: contact},
+		{Holder: "session:x", TripID: trip},
+	}
+	for _, c := range cases {
+		if _, err := booking.Checkout(ctx, nil, c); booking.ErrorCode(err) != booking.CodeInvalid {
+			t.Fatalf("want invalid_request for %+v, got %v", c, err)
+		}
+	}
+}
+
+func Test_Booking_Checkout_CancelledTrip(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	tripID, seats := testTrip(t, pool, 1)
+	holder := "session:checkout-cancelled"
+	if _, err := booking.PlaceHold(ctx, pool, booking.HoldRequest{Holder: holder, TripID: tripID, SeatIDs: seats}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// The trip is cancelled while the customer fills in the checkout form.
+	if _, err := pool.Exec(ctx, `UPDATE trips SET status = 'cancelled' WHERE id = $1`, tripID); err != nil {
+		t.Fatal(err)
+	}
+	_, err := booking.Checkout(ctx, pool, booking.CheckoutRequest{
+		Holder: holder, TripID: tripID,
+		Contact: booking.Contact{Name: "Late Customer", Email: "late@example.com", Phone: "+628123456789"},
+	})
+	if booking.ErrorCode(err) != booking.CodeInvalid {
+		t.Fatalf("checkout on a cancelled trip: %v", err)
+	}
+	var pending int
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM bookings WHERE trip_id = $1 AND status = 'pending'`, tripID).Scan(&pending); err != nil {
+		t.Fatal(err)
+	}
+	if pending != 0 {
+		t.Fatalf("%d pending bookings on a cancelled trip", pending)
+	}
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"gothicforge3/internal/booking"
+)
+
+const disruptedTrip = "7a1c2d3e-4a5b-4c6d-8e7f-0011223344ff"
+
+func Test_Booking_DisruptionRequest(t *testing.T) {
+	r := booking.DisruptionRequest{TripID: disruptedTrip, Kind: " Delay ", DelayMinutes: 45}
+	if err := r.Validate(); err != nil || r.Kind != booking.DisruptionDelay {
+		t.Fatalf("valid delay: %+v, %v", r, err)
+	}
+	r = booking.DisruptionRequest{TripID: disruptedTrip, Kind: booking.DisruptionCancel, DelayMinutes: 30}
+	if err := r.Validate(); err != nil || r.DelayMinutes != 0 {
+		t.Fatalf("a cancellation has no delay: %+v, %v", r, err)
+	}
+	for field, bad := range map[string]booking.DisruptionRequest{
+		"trip_id":       {TripID: "x", Kind: booking.DisruptionCancel},
+		"kind":          {TripID: disruptedTrip, Kind: "strike"},
+		"delay_minutes": {TripID: disruptedTrip, Kind: booking.DisruptionDelay},
+	} {
+		if err := bad.Validate(); booking.FieldErrors(err)[field] == "" {
+			t.Fatalf("bad %s: %v", field, err)
+		}
+	}
+}
+
+func Test_Booking_PlanDisruption(t *testing.T) {
+	t.Setenv("DISRUPTION_REFUND_DELAY_MINUTES", "")
+	b := cancelBooking()
+	cancel := booking.DisruptionRequest{TripID: "trip", Kind: booking.DisruptionCancel, Rebook: true}
+
+	if o, until := booking.PlanDisruption(cancel, b); o != booking.OutcomeMoved || until != nil {
+		t.Fatalf("paid booking on a cancelled train is rebooked: %s %v", o, until)
+	}
+	cancel.Rebook = false
+	if o, _ := booking.PlanDisruption(cancel, b); o != booking.OutcomeRefunded {
+		t.Fatalf("without rebooking it is refunded: %s", o)
+	}
+	cancel.Rebook = true
+	journey := cancelBooking()
+	journey.Legs = []booking.BookedLeg{{TripID: "trip"}, {TripID: "other"}}
+	if o, _ := booking.PlanDisruption(cancel, journey); o != booking.OutcomeRefunded {
+		t.Fatalf("a connecting journey is refunded whole: %s", o)
+	}
+	pending := cancelBooking()
+	pending.Status = booking.StatusPending
+	if o, _ := booking.PlanDisruption(cancel, pending); o != booking.OutcomeCancelled {
+		t.Fatalf("an unpaid booking is cancelled: %s", o)
+	}
+
+	delay := booking.DisruptionRequest{TripID: "trip", Kind: booking.DisruptionDelay, DelayMinutes: 30}
+	if o, until := booking.PlanDisruption(delay, b); o != booking.OutcomeNotified || until != nil {
+		t.Fatalf("a short delay is only notified: %s %v", o, until)
+	}
+	delay.DelayMinutes = 90
+	o, until := booking.PlanDisruption(delay, b)
+	if want := time.Date(2026, 5, 20, 9, 30, 0, 0, time.Local); o != booking.OutcomeNotified || until == nil || !until.Equal(want) {
+		t.Fatalf("a long delay opens an offer until the train leaves: %s %v", o, until)
+	}
+	if _, until := booking.PlanDisruption(delay, pending); until != nil {
+		t.Fatal("unpaid bookings get no offer")
+	}
+	t.Setenv("DISRUPTION_REFUND_DELAY_MINUTES", "120")
+	if _, until := booking.PlanDisruption(delay, b); until != nil {
+		t.Fatal("the offer threshold is configurable")
+	}
+}
+
+func Test_Booking_RebookCandidates(t *testing.T) {
+	trip := func(id, depart, status string, economy, executive int) booking.TripResult {
+		return booking.TripResult{TripID: id, ServiceDate: "2026-05-20", Depart: depart, Status: status, Classes: []booking.ClassAvailability{
+			{Class: booking.ClassEconomy, SeatsLeft: economy}, {Class: booking.ClassExecutive, SeatsLeft: executive},
+		}}
+	}
+	results := []booking.TripResult{
+		trip("late", "18:00", "scheduled", 5, 5),
+		trip("cancelled", "08:00", "cancelled", 5, 5),
+		trip("early", "06:00", "scheduled", 5, 5),
+		trip("full", "10:00", "scheduled", 5, 1),
+		trip("next", "12:00", "delayed", 2, 2),
+		trip("same", "09:00", "scheduled", 5, 5),
+	}
+	need := map[string]int{booking.ClassEconomy: 1, booking.ClassExecutive: 2}
+	got := booking.RebookCandidates(results, need, "same", time.Date(2026, 5, 20, 8, 0, 0, 0, time.Local))
+	if len(got) != 2 || got[0].TripID != "next" || got[1].TripID != "late" {
+		t.Fatalf("candidates: %+v", got)
+	}
+}
+
+func Test_Booking_DisruptedPricing(t *testing.T) {
+	b := cancelBooking()
+	c := b.PriceDisruptedChange([]booking.ChangeItem{
+		{OldItemID: cancelItemA, NewFare: 260000},
+		{OldItemID: cancelItemB, NewFare: 150000},
+		{OldItemID: cancelItemC, NewFare: 100000},
+	})
+	if c.Fee != 0 || c.FareDifference != -50000 || c.Balance != -50000 || !c.Waived {
+		t.Fatalf("no fee, never dearer, cheaper refunded: %+v", c)
+	}
+	if c.Items[0].NewFare != 200000 {
+		t.Fatalf("a dearer seat costs what the old one did: %+v", c.Items[0])
+	}
+
+	if r := b.FullRefund(b.Items[1]); r.Percent != 100 || r.Amount != 200000 {
+		t.Fatalf("full refund of a paid seat: %+v", r)
+	}
+	b.Status = booking.StatusPending
+	if r := b.FullRefund(b.Items[1]); r.Amount != 0 {
+		t.Fatalf("nothing to refund on an unpaid booking: %+v", r)
+	}
+}
+
+func Test_Booking_DisruptionSummary(t *testing.T) {
+	d := booking.Disruption{Bookings: []booking.DisruptedBooking{
+		{Outcome: booking.OutcomeMoved, Passengers: make([]booking.DisruptedPassenger, 3)},
+		{Outcome: booking.OutcomeRefunded, Passengers: make([]booking.DisruptedPassenger, 1)},
+		{Outcome: booking.OutcomeMoved, Passengers: make([]booking.DisruptedPassenger, 2)},
+	}}
+	s := d.Summary()
+	if s[booking.OutcomeMoved] != 5 || s[booking.OutcomeRefunded] != 1 || s[booking.OutcomeFailed] != 0 {
+		t.Fatalf("passengers per outcome: %v", s)
+	}
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+
+	"gothicforge3/internal/booking"
+)
+
+func fareRules() booking.FareRules {
+	r := booking.DefaultFareRules()
+	r.Distance = []booking.DistanceBand{{FromKM: 0, PerKM: 450}, {FromKM: 100, PerKM: 350}, {FromKM: 300, PerKM: 250}}
+	r.Peaks = []booking.PeakRule{
+		{Name: "Lebaran", Start: day("2026-03-10"), End: day("2026-03-31"), Percent: 25},
+		{Name: "School holiday", Start: day("2026-03-28"), End: day("2026-04-05"), Percent: 10},
+	}
+	r.Discounts = map[string]int64{booking.CategoryInfant: 75, booking.CategorySenior: 20}
+	return r
+}
+
+func fareKinds(f booking.Fare) []string {
+	var out []string
+	for _, l := range f.Lines {
+		out = append(out, l.Kind)
+	}
+	return out
+}
+
+func Test_Booking_FareQuote(t *testing.T) {
+	r := fareRules()
+	f := r.Quote(booking.FareBasis{Base: 150000, KM: 150, Date: day("2026-02-02")}, "economy", "")
+	if f.Total != 150000 || !reflect.DeepEqual(fareKinds(f), []string{booking.FareBase}) {
+		t.Fatalf("plain economy: %+v", f)
+	}
+
+	// Executive in Lebaran for a senior: 150000 ×180% = 270000, +25% = 337500, -20% = 270000.
+	f = r.Quote(booking.FareBasis{Base: 150000, KM: 150, Date: day("2026-03-20")}, "executive", booking.CategorySenior)
+	want := []booking.FareLine{
+		{Kind: booking.FareBase, Label: "Base fare", Amount: 150000},
+		{Kind: booking.FareClass, Label: "Executive class", Percent: 180, Amount: 120000},
+		{Kind: booking.FarePeak, Label: "Lebaran", Percent: 25, Amount: 67500},
+		{Kind: booking.FareDiscount, Label: "Senior discount", Percent: 20, Amount: -67500},
+	}
+	if f.Total != 270000 || !reflect.DeepEqual(f.Lines, want) {
+		t.Fatalf("senior in Lebaran: %+v", f)
+	}
+
+	// Overlapping peaks: only the highest surcharge applies.
+	f = r.Quote(booking.FareBasis{Base: 100000, Date: day("2026-03-30")}, "economy", booking.CategoryStudent)
+	if f.Total != 125000 || f.Lines[1].Label != "Lebaran" || len(f.Lines) != 2 {
+		t.Fatalf("overlapping peaks, student without a discount: %+v", f)
+	}
+}
+
+func Test_Booking_FareDistance(t *testing.T) {
+	r := fareRules()
+	// 100 km at 450 + 200 km at 350 + 50 km at 250 = 127500, rounded up to 128000.
+	f := r.Quote(booking.FareBasis{KM: 350, Date: day("2026-02-02")}, "economy", "")
+	if f.Total != 128000 || f.Lines[0].Kind != booking.FareDistance || f.Lines[0].Label != "Distance fare, 350 km" {
+		t.Fatalf("distance fare: %+v", f)
+	}
+	if f := r.Quote(booking.FareBasis{Base: 90000, KM: 350}, "economy", ""); f.Total != 90000 {
+		t.Fatalf("a base price wins over the distance tariff: %+v", f)
+	}
+	if f := booking.DefaultFareRules().Quote(booking.FareBasis{KM: 350}, "business", ""); f.Total != 0 {
+		t.Fatalf("without a tariff a trip without a base price is free: %+v", f)
+	}
+}
+
+func Test_Booking_ValidatePassengers_Categories(t *testing.T) {
+	seats := []string{"6f1c2d3e-4a5b-4c6d-8e7f-00112233445a", "6f1c2d3e-4a5b-4c6d-8e7f-00112233445b"}
+	ok := []booking.Passenger{
+		{SeatID: seats[0], Name: "Oma", IDType: "nik", IDNumber: "3174015708500001", Category: "senior"},
+		{SeatID: seats[1], Name: "Siti", IDType: "nik", IDNumber: "3273015703230002", Category: "infant"},
+	}
+	if err := booking.ValidatePassengers(ok, nikNow); err != nil {
+		t.Fatalf("a senior may travel with an infant: %v (%v)", err, booking.FieldErrors(err))
+	}
+	young := []booking.Passenger{{SeatID: seats[0], Name: "Budi", IDType: "nik", IDNumber: "3174011708900001", Category: "senior"}}
+	if f := booking.FieldErrors(booking.ValidatePassengers(young, nikNow)); f["passengers.0.category"] == "" {
+		t.Fatalf("a 34 year old is not a senior, got %v", f)
+	}
+	withStudent := []booking.Passenger{
+		{SeatID: seats[0], Name: "Ani", IDType: "passport", IDNumber: "A1234567", Category: "student"},
+		{SeatID: seats[1], Name: "Siti", IDType: "nik", IDNumber: "3273015703230002", Category: "infant"},
+	}
+	if f := booking.FieldErrors(booking.ValidatePassengers(withStudent, nikNow)); f["passengers"] == "" {
+		t.Fatalf("an infant needs an adult or senior, got %v", f)
+	}
+}
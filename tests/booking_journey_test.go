@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gothicforge3/internal/booking"
+)
+
+func ride(trip, from, to, dep, arr string, fare int64) booking.Ride {
+	at := func(s string) time.Time {
+		t, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	return booking.Ride{TripID: trip, TrainCode: trip, Origin: from, Destination: to, Departs: at(dep), Arrives: at(arr), Fare: fare}
+}
+
+func journeyQuery(from, to string, maxLegs int) booking.JourneyQuery {
+	return booking.JourneyQuery{
+		SearchQuery:   booking.SearchQuery{Origin: from, Destination: to, Date: time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), Passengers: 1},
+		MaxLegs:       maxLegs,
+		MinConnection: 15 * time.Minute,
+	}
+}
+
+func journeyKeys(js []booking.Journey) []string {
+	out := []string{}
+	for _, j := range js {
+		parts := []string{}
+		for _, l := range j.Legs {
+			parts = append(parts, l.TrainCode)
+		}
+		out = append(out, strings.Join(parts, "+"))
+	}
+	return out
+}
+
+// Bandung → Yogyakarta directly, or via Cirebon.
+var bdykRides = []booking.Ride{
+	ride("FAST", "BD", "YK", "2026-03-02 07:20", "2026-03-02 12:58", 300000),
+	ride("SLOW", "BD", "YK", "2026-03-02 05:00", "2026-03-02 14:00", 120000),
+	ride("A", "BD", "CN", "2026-03-02 06:00", "2026-03-02 09:00", 100000),
+	ride("TIGHT", "CN", "YK", "2026-03-02 09:10", "2026-03-02 12:00", 100000),
+	ride("B", "CN", "YK", "2026-03-02 09:30", "2026-03-02 13:30", 90000),
+	ride("C", "CN", "YK", "2026-03-02 09:40", "2026-03-02 13:30", 150000),
+	ride("A", "CN", "YK", "2026-03-02 09:05", "2026-03-02 12:30", 100000),
+	ride("LATE", "CN", "YK", "2026-03-02 23:00", "2026-03-03 03:00", 50000),
+	ride("EVE", "BD", "YK", "2026-03-01 23:00", "2026-03-02 05:00", 100000),
+}
+
+func Test_Booking_PlanJourneys(t *testing.T) {
+	js := booking.PlanJourneys(bdykRides, journeyQuery("BD", "YK", 2))
+	// TIGHT leaves 10 minutes to change, LATE waits 14 hours, A+A rides one
+	// train twice and EVE boards the day before: none of them is offered.
+	// B and C arrive together after the same time on the way: B is cheaper.
+	want := []string{"FAST", "A+B", "A+C", "SLOW"}
+	if got := journeyKeys(js); !reflect.DeepEqual(got, want) {
+		t.Fatalf("journeys: got %v, want %v", got, want)
+	}
+	ab := js[1]
+	if len(ab.Transfers) != 1 || ab.Transfers[0].Station != "CN" || ab.Transfers[0].Minutes != 30 {
+		t.Fatalf("transfer: %+v", ab.Transfers)
+	}
+	if ab.Depart != "06:00" || ab.Arrive != "13:30" || ab.Minutes != 450 || ab.Price != 190000 {
+		t.Fatalf("A+B summary: %+v", ab)
+	}
+
+	if got := journeyKeys(booking.PlanJourneys(bdykRides, journeyQuery("BD", "YK", 1))); !reflect.DeepEqual(got, []string{"FAST", "SLOW"}) {
+		t.Fatalf("max one leg should only return direct trains, got %v", got)
+	}
+
+	// Same arrival: the shorter journey ranks first, even when it costs more.
+	tie := append([]booking.Ride{}, bdykRides[2], bdykRides[4])
+	tie = append(tie, ride("LUX", "BD", "YK", "2026-03-02 08:00", "2026-03-02 13:30", 500000))
+	if got := journeyKeys(booking.PlanJourneys(tie, journeyQuery("BD", "YK", 2))); !reflect.DeepEqual(got, []string{"LUX", "A+B"}) {
+		t.Fatalf("duration should break ties, got %v", got)
+	}
+}
+
+func Test_Booking_CheckConnections(t *testing.T) {
+	a, b := bdykRides[2], bdykRides[4]
+	if err := booking.CheckConnections([]booking.Ride{a, b}, 15*time.Minute); err != nil {
+		t.Fatalf("30 minutes at CN should connect: %v", err)
+	}
+	for _, c := range []struct {
+		rides []booking.Ride
+		want  string
+	}{
+		{[]booking.Ride{a, b}, "only 30 minutes to change trains at CN; at least 45 are needed"},
+		{[]booking.Ride{a, bdykRides[1]}, "leg 2 starts at BD but leg 1 ends at CN"},
+		{[]booking.Ride{a, bdykRides[6]}, "already used"},
+	} {
+		err := booking.CheckConnections(c.rides, 45*time.Minute)
+		if booking.ErrorCode(err) != booking.CodeInvalid || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("want %q, got %v", c.want, err)
+		}
+	}
+}
+
+func Test_Booking_ParseJourneyQuery(t *testing.T) {
+	t.Setenv("JOURNEY_MAX_LEGS", "2")
+	t.Setenv("MIN_CONNECTION_MINUTES", "25")
+	q, err := booking.ParseJourneyQuery(url.Values{"from": {"bd"}, "to": {"yk"}, "date": {"2026-03-02"}})
+	if err != nil || q.MaxLegs != 2 || q.MinConnection != 25*time.Minute || q.Origin != "BD" {
+		t.Fatalf("defaults: %+v %v", q, err)
+	}
+	if _, err := booking.ParseJourneyQuery(url.Values{"from": {"BD"}, "to": {"YK"}, "date": {"2026-03-02"}, "max_legs": {"3"}}); booking.ErrorCode(err) != booking.CodeInvalid {
+		t.Fatalf("max_legs above JOURNEY_MAX_LEGS should be rejected, got %v", err)
+	}
+}
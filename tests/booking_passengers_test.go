@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/server"
+)
+
+var nikNow = time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func Test_Booking_ValidateNIK(t *testing.T) {
+	birth, err := booking.ValidateNIK("3174011708900001", nikNow)
+	if err != nil || birth.Format("2006-01-02") != "1990-08-17" {
+		t.Fatalf("male NIK: got %v, %v", birth, err)
+	}
+	// Women have 40 added to the day of birth.
+	birth, err = booking.ValidateNIK("3273015703230002", nikNow)
+	if err != nil || birth.Format("2006-01-02") != "2023-03-17" {
+		t.Fatalf("female NIK: got %v, %v", birth, err)
+	}
+	bad := []string{
+		"317401170890001",  // 15 digits
+		"31740117089000A1", // non-digit
+		"9974011708900001", // unknown province
+		"3174013102900001", // 31 February
+		"3174011708900000", // zero serial
+	}
+	for _, nik := range bad {
+		if _, err := booking.ValidateNIK(nik, nikNow); booking.ErrorCode(err) != booking.CodeInvalid {
+			t.Fatalf("expected %s to be rejected, got %v", nik, err)
+		}
+	}
+}
+
+func Test_Booking_ValidatePassengers(t *testing.T) {
+	seatA := "6f1c2d3e-4a5b-4c6d-8e7f-00112233445a"
+	seatB := "6f1c2d3e-4a5b-4c6d-8e7f-00112233445b"
+	ok := []booking.Passenger{
+		{SeatID: seatA, Name: "  Budi   Santoso ", IDType: "NIK", IDNumber: "3174 0117 0890 0001"},
+		{SeatID: seatB, Name: "Siti", IDType: "nik", IDNumber: "3273015703230002", Category: "infant"},
+	}
+	if err := booking.ValidatePassengers(ok, nikNow); err != nil {
+		t.Fatalf("valid passengers rejected: %v (%v)", err, booking.FieldErrors(err))
+	}
+	if ok[0].Name != "Budi Santoso" || ok[0].IDNumber != "3174011708900001" || ok[0].Category != booking.CategoryAdult {
+		t.Fatalf("passenger not normalized: %+v", ok[0])
+	}
+
+	bad := []booking.Passenger{
+		{SeatID: seatA, Name: "", IDType: "nik", IDNumber: "3273015703230002"},                          // no name; toddler as adult
+		{SeatID: seatA, Name: "Ana", IDType: "passport", IDNumber: "X1"},                                // duplicate seat; short passport
+		{SeatID: seatB, Name: "Joko", IDType: "ktp", IDNumber: "1", Category: "child"},                  // unknown id type and category
+		{SeatID: "nope", Name: "Bayi", IDType: "nik", IDNumber: "3174011708900001", Category: "infant"}, // adult NIK as infant
+	}
+	fields := booking.FieldErrors(booking.ValidatePassengers(bad, nikNow))
+	for _, k := range []string{
+		"passengers.0.name", "passengers.0.category",
+		"passengers.1.seat_id", "passengers.1.id_number",
+		"passengers.2.id_type", "passengers.2.category",
+		"passengers.3.seat_id", "passengers.3.category",
+	} {
+		if fields[k] == "" {
+			t.Fatalf("expected an error for %s, got %v", k, fields)
+		}
+	}
+
+	lone := []booking.Passenger{{SeatID: seatB, Name: "Siti", IDType: "nik", IDNumber: "3273015703230002", Category: "infant"}}
+	if f := booking.FieldErrors(booking.ValidatePassengers(lone, nikNow)); f["passengers"] == "" {
+		t.Fatalf("an infant alone should be rejected, got %v", f)
+	}
+}
+
+func Test_Booking_Checkout_RejectsBadPassengers(t *testing.T) {
+	req := booking.CheckoutRequest{
+		Holder:     "session:x",
+		TripID:     "6f1c2d3e-4a5b-4c6d-8e7f-001122334455",
+		Contact:    booking.Contact{Name: "Budi", Email: "budi@example.com"},
+		Passengers: []booking.Passenger{{SeatID: "6f1c2d3e-4a5b-4c6d-8e7f-00112233445a", Name: "Budi", IDType: "nik", IDNumber: "123"}},
+	}
+	// Validation runs before any database access, so a nil pool is fine here.
+	_, err := booking.Checkout(context.Background(), nil, req)
+	if booking.FieldErrors(err)["passengers.0.id_number"] == "" {
+		t.Fatalf("expected a field error for the NIK, got %v", err)
+	}
+}
+
+func Test_Passengers_Post_InlineErrors(t *testing.T) {
+	_ = os.Setenv("LOG_FORMAT", "off")
+	r := server.New()
+	routes.Register(r)
+	form := url.Values{"trip_id": {"nope"}, "passengers.0.seat_id": {"x"}}
+	req := httptest.NewRequest(http.MethodPost, "/passengers", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("HX-Request", "true")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HTMX fragment should swap with 200, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `id="passenger-form"`) || strings.Contains(body, "<html") {
+		t.Fatalf("expected the form fragment only, got %q", body)
+	}
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gothicforge3/internal/booking"
+)
+
+var promoSeats = []booking.PromoItem{
+	{Price: 270000, Route: "GMR-BD", Train: "AP", Class: "executive"},
+	{Price: 150000, Route: "GMR-BD", Train: "AP", Class: "economy"},
+	{Price: 300000, Route: "GMR-YK", Train: "TAK", Class: "business"},
+}
+
+func Test_Booking_PromoDiscount(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		name  string
+		promo booking.Promo
+		want  int64
+	}{
+		{"percent of everything", booking.Promo{Kind: booking.PromoPercent, Value: 10}, 72000},
+		{"capped percent", booking.Promo{Kind: booking.PromoPercent, Value: 50, MaxDiscount: 100000}, 100000},
+		{"fixed", booking.Promo{Kind: booking.PromoFixed, Value: 25000}, 25000},
+		{"route only", booking.Promo{Kind: booking.PromoPercent, Value: 10, Routes: []string{"gmr-bd"}}, 42000},
+		{"train and class", booking.Promo{Kind: booking.PromoPercent, Value: 20, Trains: []string{"AP"}, Classes: []string{"economy"}}, 30000},
+		{"fixed above the eligible seats", booking.Promo{Kind: booking.PromoFixed, Value: 500000, Trains: []string{"AP"}, Classes: []string{"economy"}}, 150000},
+	} {
+		c.promo.Active = true
+		got, err := c.promo.Discount(promoSeats, now)
+		if err != nil || got != c.want {
+			t.Fatalf("%s: got %d, %v; want %d", c.name, got, err, c.want)
+		}
+	}
+
+	before, after := now.Add(time.Hour), now.Add(-time.Hour)
+	for _, c := range []struct {
+		promo booking.Promo
+		want  string
+	}{
+		{booking.Promo{Kind: booking.PromoFixed, Value: 1}, "not found"},
+		{booking.Promo{Kind: booking.PromoFixed, Value: 1, Active: true, StartsAt: &before}, "not valid yet"},
+		{booking.Promo{Kind: booking.PromoFixed, Value: 1, Active: true, EndsAt: &after}, "expired"},
+		{booking.Promo{Kind: booking.PromoFixed, Value: 1, Active: true, Trains: []string{"ARW"}}, "does not apply"},
+		{booking.Promo{Kind: booking.PromoFixed, Value: 1, Active: true, Routes: []string{"GMR-YK"}, MinTotal: 400000}, "at least Rp400000"},
+	} {
+		_, err := c.promo.Discount(promoSeats, now)
+		if booking.FieldErrors(err)["promo_code"] == "" || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("want a promo_code error containing %q, got %v", c.want, err)
+		}
+	}
+}
+
+func Test_Booking_PromoValidate(t *testing.T) {
+	p := booking.Promo{Code: " lebaran 26 ", Kind: booking.PromoPercent, Value: 15, Routes: []string{" gmr-yk"}, Classes: []string{"Executive"}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("valid promo rejected: %v", err)
+	}
+	if p.Code != "LEBARAN26" || p.Routes[0] != "GMR-YK" || p.Classes[0] != "executive" {
+		t.Fatalf("promo not normalized: %+v", p)
+	}
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, bad := range []booking.Promo{
+		{Code: "X", Kind: booking.PromoFixed, Value: 1},
+		{Code: "HALF!", Kind: booking.PromoFixed, Value: 1},
+		{Code: "TOOMUCH", Kind: booking.PromoPercent, Value: 120},
+		{Code: "FREE", Kind: "bogo", Value: 1},
+		{Code: "FIRSTCLASS", Kind: booking.PromoFixed, Value: 1, Classes: []string{"first"}},
+		{Code: "BACKWARDS", Kind: booking.PromoFixed, Value: 1, StartsAt: &start, EndsAt: &start},
+	} {
+		if err := bad.Validate(); booking.ErrorCode(err) != booking.CodeInvalid {
+			t.Fatalf("%+v should be rejected, got %v", bad, err)
+		}
+	}
+}
+
+func Test_Booking_PromoCheckout_Race(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	code := fmt.Sprintf("RACE%d", time.Now().UnixNano())
+	// Registered before the trip so it runs after the bookings, and with
+	// them the redemptions, are gone.
+	t.Cleanup(func() {
+		if _, err := pool.Exec(ctx, `DELETE FROM promo_codes WHERE code = $1`, code); err != nil {
+			t.Errorf("cleanup: %v", err)
+		}
+	})
+	tripID, seats := testTrip(t, pool, 2)
+	if _, err := booking.CreatePromo(ctx, pool, booking.Promo{Code: code, Kind: booking.PromoFixed, Value: 10000, MaxUses: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two customers hold a seat each, then check out with the same single-use code at once.
+	reqs := make([]booking.CheckoutRequest, len(seats))
+	for i, seat := range seats {
+		holder := fmt.Sprintf("session:promo-race-%d", i)
+		if _, err := booking.PlaceHold(ctx, pool, booking.HoldRequest{Holder: holder, TripID: tripID, SeatIDs: []string{seat}}, time.Minute); err != nil {
+			t.Fatalf("hold %d: %v", i, err)
+		}
+		reqs[i] = booking.CheckoutRequest{
+			Holder:    holder,
+			TripID:    tripID,
+			Contact:   booking.Contact{Name: "Race Tester", Email: fmt.Sprintf("race%d@example.com", i), Phone: "+628123456789"},
+			PromoCode: code,
+		}
+	}
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+		errs  = make([]error, len(reqs))
+	)
+	for i, req := range reqs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, errs[i] = booking.Checkout(ctx, pool, req)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	won := 0
+	for i, err := range errs {
+		var be *booking.Error
+		switch {
+		case err == nil:
+			won++
+		case !errors.As(err, &be) || be.Fields["promo_code"] == "":
+			t.Fatalf("checkout %d: %v", i, err)
+		}
+	}
+	if won != 1 {
+		t.Fatalf("%d checkouts redeemed a max_uses=1 code, want exactly 1", won)
+	}
+}
@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"gothicforge3/internal/booking"
+)
+
+func Test_Booking_ChangeFee(t *testing.T) {
+	t.Setenv("RESCHEDULE_FEE", "")
+	if got := booking.ChangeFee(); got != 25000 {
+		t.Fatalf("default fee: %d", got)
+	}
+	t.Setenv("RESCHEDULE_FEE", "0")
+	if got := booking.ChangeFee(); got != 0 {
+		t.Fatalf("free changes: %d", got)
+	}
+	t.Setenv("RESCHEDULE_FEE", "-5")
+	if got := booking.ChangeFee(); got != 25000 {
+		t.Fatalf("a negative fee falls back to the default: %d", got)
+	}
+}
+
+func Test_Booking_PriceChange(t *testing.T) {
+	b := cancelBooking()
+	items := []booking.ChangeItem{
+		{OldItemID: cancelItemA, NewFare: 260000},
+		{OldItemID: cancelItemB, NewFare: 180000},
+		{OldItemID: cancelItemC, NewFare: 100000},
+	}
+	c := b.PriceChange(items, 25000)
+	if c.FareDifference != 40000 || c.Fee != 75000 || c.Balance != 115000 {
+		t.Fatalf("dearer train: %+v", c)
+	}
+	if c.Items[0].OldPaid != 200000 || c.FromTripID != "trip" {
+		t.Fatalf("old seat prices: %+v", c.Items)
+	}
+
+	// The promo discount is shared by the seats: 500000 paid for 625000 of fares,
+	// so the first seat was worth 200000 and moving it to a 100000 fare refunds the rest.
+	b.Total, b.Discount = 500000, 125000
+	b.Items[0].Price = 250000
+	c = b.PriceChange([]booking.ChangeItem{{OldItemID: cancelItemA, NewFare: 100000}}, 25000)
+	if c.Items[0].OldPaid != 200000 || c.FareDifference != -100000 || c.Balance != -75000 {
+		t.Fatalf("cheaper train after a promo: %+v", c)
+	}
+}
+
+// bookPaid books seats on a trip for holder and marks the booking paid.
+func bookPaid(t *testing.T, pool *pgxpool.Pool, holder, email, tripID string, seats []string) booking.Booking {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := booking.PlaceHold(ctx, pool, booking.HoldRequest{Holder: holder, TripID: tripID, SeatIDs: seats}, time.Minute); err != nil {
+		t.Fatalf("hold: %v", err)
+	}
+	b, err := booking.Checkout(ctx, pool, booking.CheckoutRequest{
+		Holder: holder, TripID: tripID,
+		Contact: booking.Contact{Name: "Test Passenger", Email: email, Phone: "+628123456789"},
+	})
+	if err != nil {
+		t.Fatalf("checkout: %v", err)
+	}
+	if err := booking.MarkPaid(ctx, pool, b.ID); err != nil {
+		t.Fatalf("mark paid: %v", err)
+	}
+	b.Status = booking.StatusPaid
+	return b
+}
+
+// seatFree reports whether someone else can hold the seats.
+func seatFree(t *testing.T, pool *pgxpool.Pool, tripID string, seats []string) bool {
+	t.Helper()
+	_, err := booking.PlaceHold(context.Background(), pool, booking.HoldRequest{Holder: "session:probe-" + tripID, TripID: tripID, SeatIDs: seats}, time.Minute)
+	if err != nil && booking.ErrorCode(err) != booking.CodeSeatUnavailable {
+		t.Fatalf("probe hold: %v", err)
+	}
+	if err == nil {
+		if _, err := booking.ReleaseHold(context.Background(), pool, "session:probe-"+tripID, tripID, seats); err != nil {
+			t.Fatalf("release probe: %v", err)
+		}
+	}
+	return err == nil
+}
+
+func Test_Booking_Reschedule_FreeMoveReleasesOldSeats(t *testing.T) {
+	t.Setenv("RESCHEDULE_FEE", "0")
+	pool := testPool(t)
+	ctx := context.Background()
+	trips := testTrips(t, pool, 1, 2)
+	b := bookPaid(t, pool, "session:reschedule-free", "free@example.com", trips[0].id, trips[0].seats)
+
+	c, err := booking.Reschedule(ctx, pool, booking.RescheduleRequest{BookingID: b.ID, TripID: trips[1].id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Status != booking.ChangeApplied || c.Fee != 0 || c.Balance != 0 {
+		t.Fatalf("a same-fare move without a fee applies at once: %+v", c)
+	}
+	moved, err := booking.GetBookingByID(ctx, pool, b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.TripID != trips[1].id || moved.Code != b.Code {
+		t.Fatalf("booking %s still on trip %s", moved.Code, moved.TripID)
+	}
+	if !seatFree(t, pool, trips[0].id, trips[0].seats) {
+		t.Fatal("the old seat was not released")
+	}
+	if seatFree(t, pool, trips[1].id, trips[1].seats) {
+		t.Fatal("the new seat is not booked")
+	}
+}
+
+func Test_Booking_Reschedule_ChargesFee(t *testing.T) {
+	t.Setenv("RESCHEDULE_FEE", "25000")
+	pool := testPool(t)
+	ctx := context.Background()
+	trips := testTrips(t, pool, 1, 2)
+	b := bookPaid(t, pool, "session:reschedule-fee", "fee@example.com", trips[0].id, trips[0].seats)
+
+	c, err := booking.Reschedule(ctx, pool, booking.RescheduleRequest{BookingID: b.ID, TripID: trips[1].id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.FareDifference != 0 || c.Fee != 25000 || c.Balance != 25000 || c.Status != booking.ChangePending {
+		t.Fatalf("want the fee as the balance due: %+v", c)
+	}
+	// Until the balance is paid the customer keeps the old seat and holds the new one.
+	if seatFree(t, pool, trips[0].id, trips[0].seats) || seatFree(t, pool, trips[1].id, trips[1].seats) {
+		t.Fatal("seats changed hands before the fee was paid")
+	}
+	if err := booking.ApplyChange(ctx, pool, c.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !seatFree(t, pool, trips[0].id, trips[0].seats) {
+		t.Fatal("the old seat was not released once the change was paid")
+	}
+}
+
+func Test_Booking_Reschedule_SeatTaken(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	trips := testTrips(t, pool, 1, 2)
+	b := bookPaid(t, pool, "session:reschedule-taken", "taken@example.com", trips[0].id, trips[0].seats)
+	if _, err := booking.PlaceHold(ctx, pool, booking.HoldRequest{Holder: "session:reschedule-other", TripID: trips[1].id, SeatIDs: trips[1].seats}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := booking.Reschedule(ctx, pool, booking.RescheduleRequest{BookingID: b.ID, TripID: trips[1].id, SeatIDs: trips[1].seats})
+	if booking.ErrorCode(err) != booking.CodeSeatUnavailable {
+		t.Fatalf("moving onto a held seat: %v", err)
+	}
+	if seatFree(t, pool, trips[0].id, trips[0].seats) {
+		t.Fatal("a failed change released the old seat")
+	}
+}
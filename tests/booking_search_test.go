@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/server"
+)
+
+func Test_Booking_ParseSearchQuery(t *testing.T) {
+	q, err := booking.ParseSearchQuery(url.Values{"from": {"gmr"}, "to": {"BD"}, "date": {"2025-03-01"}, "pax": {"2"}, "class": {"Economy"}})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if q.Origin != "GMR" || q.Destination != "BD" || q.Passengers != 2 || q.Class != "economy" {
+		t.Fatalf("unexpected query: %+v", q)
+	}
+
+	bad := []url.Values{
+		{"to": {"BD"}, "date": {"2025-03-01"}},
+		{"from": {"GMR"}, "to": {"GMR"}, "date": {"2025-03-01"}},
+		{"from": {"GMR"}, "to": {"BD"}, "date": {"01/03/2025"}},
+		{"from": {"GMR"}, "to": {"BD"}, "date": {"2025-03-01"}, "pax": {"0"}},
+		{"from": {"GMR"}, "to": {"BD"}, "date": {"2025-03-01"}, "pax": {"999"}},
+		{"from": {"GMR"}, "to": {"BD"}, "date": {"2025-03-01"}, "class": {"sleeper"}},
+	}
+	for _, v := range bad {
+		if _, err := booking.ParseSearchQuery(v); booking.ErrorCode(err) != booking.CodeInvalid {
+			t.Fatalf("want invalid_request for %v, got %v", v, err)
+		}
+	}
+}
+
+func Test_Booking_ClassPrice(t *testing.T) {
+	if got := booking.ClassPrice(150000, "economy"); got != 150000 {
+		t.Fatalf("economy: got %d", got)
+	}
+	if got := booking.ClassPrice(150000, "executive"); got <= booking.ClassPrice(150000, "business") {
+		t.Fatalf("executive should cost more than business, got %d", got)
+	}
+}
+
+func Test_API_Availability_BadRequest(t *testing.T) {
+	_ = os.Setenv("LOG_FORMAT", "off")
+	r := server.New()
+	routes.Register(r)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/availability?from=GMR", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("want 400, got %d", rec.Code)
+	}
+	var body struct {
+		Success bool `json:"success"`
+		Error   struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Success || body.Error.Code != "invalid_request" {
+		t.Fatalf("unexpected body: %s", rec.Body.String())
+	}
+}
+
+func Test_Search_Results_Fragment_InlineError(t *testing.T) {
+	_ = os.Setenv("LOG_FORMAT", "off")
+	r := server.New()
+	routes.Register(r)
+	req := httptest.NewRequest(http.MethodGet, "/search/results?from=GMR&to=GMR&date=2025-03-01", nil)
+	req.Header.Set("HX-Request", "true")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("want 200, got %d", rec.Code)
+	}
+	b := rec.Body.String()
+	if strings.Contains(b, "<html") || !strings.Contains(b, "alert") {
+		t.Fatalf("expected an alert fragment without layout, got %q", b)
+	}
+}
@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/server"
+)
+
+func Test_Booking_AisleAfter(t *testing.T) {
+	cases := map[string][]int{"2-2": {2}, "2-1": {2}, "3-2": {3}, "1-2-1": {1, 3}, "4": nil, "x-2": nil}
+	for layout, want := range cases {
+		if got := booking.AisleAfter(layout); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: want %v, got %v", layout, want, got)
+		}
+	}
+}
+
+func Test_Booking_PlaceSeats(t *testing.T) {
+	c := booking.Coach{Rows: 2, Cols: 4, Seats: []booking.SeatCell{
+		{No: "02-1"}, {No: "01-4"}, {No: "01-1"}, {No: "WC"}, {No: "03-2"},
+	}}
+	booking.PlaceSeats(&c)
+	got := map[string][2]int{}
+	for _, s := range c.Seats {
+		got[s.No] = [2]int{s.Row, s.Col}
+	}
+	want := map[string][2]int{"01-1": {1, 1}, "01-4": {1, 4}, "02-1": {2, 1}, "03-2": {3, 2}, "WC": {1, 2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("positions: want %v, got %v", want, got)
+	}
+	if c.Rows != 3 {
+		t.Fatalf("rows should grow to fit seat 03-2, got %d", c.Rows)
+	}
+	if c.Seats[0].No != "01-1" || c.Seats[len(c.Seats)-1].No != "03-2" {
+		t.Fatalf("seats should be sorted by row then column: %+v", c.Seats)
+	}
+}
+
+func Test_Seatmap_Grid_InlineError(t *testing.T) {
+	_ = os.Setenv("LOG_FORMAT", "off")
+	r := server.New()
+	routes.Register(r)
+	req := httptest.NewRequest(http.MethodGet, "/seatmap/grid?trip=nope", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("fragment should always swap, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `id="seatmap"`) || !strings.Contains(body, "Trip not found") {
+		t.Fatalf("expected inline error in #seatmap, got %q", body)
+	}
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"testing"
+
+	"gothicforge3/internal/booking"
+)
+
+// abaStops is the Argo Bromo Anggrek seed: Gambir → Semarang Tawang → Surabaya Gubeng.
+var abaStops = []booking.Stop{
+	{Seq: 0, Station: "GMR", Depart: "08:00"},
+	{Seq: 1, Station: "SMT", Arrive: "13:20", Depart: "13:25", DistanceKM: 437},
+	{Seq: 2, Station: "SGU", Arrive: "16:45", DistanceKM: 725},
+}
+
+func Test_Booking_FindLeg(t *testing.T) {
+	cases := []struct {
+		from, to string
+		want     booking.Leg
+	}{
+		{"", "", booking.Leg{From: 0, To: 2}},
+		{"GMR", "SMT", booking.Leg{From: 0, To: 1}},
+		{"smt", "sgu", booking.Leg{From: 1, To: 2}},
+		{"", "SMT", booking.Leg{From: 0, To: 1}},
+		{"SMT", "", booking.Leg{From: 1, To: 2}},
+	}
+	for _, c := range cases {
+		got, err := booking.FindLeg(abaStops, c.from, c.to)
+		if err != nil || got != c.want {
+			t.Fatalf("%q→%q: want %+v, got %+v (%v)", c.from, c.to, c.want, got, err)
+		}
+	}
+	for _, bad := range [][2]string{{"SGU", "GMR"}, {"SMT", "SMT"}, {"BD", "SGU"}, {"SGU", ""}} {
+		if _, err := booking.FindLeg(abaStops, bad[0], bad[1]); booking.ErrorCode(err) != booking.CodeInvalid {
+			t.Fatalf("%v: want invalid_request, got %v", bad, err)
+		}
+	}
+	if _, err := booking.FindLeg(nil, "", ""); booking.ErrorCode(err) != booking.CodeNotFound {
+		t.Fatalf("a trip without stops should be not_found, got %v", err)
+	}
+}
+
+func Test_Booking_LegOverlaps(t *testing.T) {
+	gmrSmt, smtSgu, whole := booking.Leg{From: 0, To: 1}, booking.Leg{From: 1, To: 2}, booking.Leg{From: 0, To: 2}
+	if gmrSmt.Overlaps(smtSgu) || smtSgu.Overlaps(gmrSmt) {
+		t.Fatal("consecutive legs share no segment, so one seat can be sold on both")
+	}
+	if !whole.Overlaps(gmrSmt) || !smtSgu.Overlaps(whole) || !gmrSmt.Overlaps(gmrSmt) {
+		t.Fatal("legs sharing a segment must overlap")
+	}
+}
+
+func Test_Booking_LegFare(t *testing.T) {
+	if got := booking.LegFare(abaStops, booking.Leg{From: 0, To: 2}, 550000); got != 550000 {
+		t.Fatalf("whole trip should cost the base price, got %d", got)
+	}
+	// 437/725 of 550000 = 331517.2 → rounded up to 332000.
+	if got := booking.LegFare(abaStops, booking.Leg{From: 0, To: 1}, 550000); got != 332000 {
+		t.Fatalf("GMR→SMT: got %d", got)
+	}
+	if got := booking.LegFare(abaStops, booking.Leg{From: 1, To: 2}, 550000); got != 219000 {
+		t.Fatalf("SMT→SGU: got %d", got)
+	}
+	noKM := []booking.Stop{{Seq: 0, Station: "GMR"}, {Seq: 1, Station: "BD"}}
+	if got := booking.LegFare(noKM, booking.Leg{From: 0, To: 1}, 150000); got != 150000 {
+		t.Fatalf("without distances the base price applies, got %d", got)
+	}
+}
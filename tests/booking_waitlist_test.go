@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"gothicforge3/internal/booking"
+)
+
+func Test_Booking_WaitlistOfferTTL(t *testing.T) {
+	t.Setenv("WAITLIST_OFFER_MINUTES", "")
+	if got := booking.WaitlistOfferTTL(); got != 15*time.Minute {
+		t.Fatalf("default offer: %v", got)
+	}
+	t.Setenv("WAITLIST_OFFER_MINUTES", "5")
+	if got := booking.WaitlistOfferTTL(); got != 5*time.Minute {
+		t.Fatalf("configured offer: %v", got)
+	}
+	t.Setenv("WAITLIST_OFFER_MINUTES", "0")
+	if got := booking.WaitlistOfferTTL(); got != 15*time.Minute {
+		t.Fatalf("a zero offer falls back to the default: %v", got)
+	}
+}
+
+func Test_Booking_JoinWaitlist_Validation(t *testing.T) {
+	ctx := context.Background()
+	ok := booking.WaitlistRequest{Holder: "user:42", TripID: cancelTrip2, Class: "executive", Seats: 2, Email: "budi@example.com"}
+	for field, req := range map[string]booking.WaitlistRequest{
+		"class": func() booking.WaitlistRequest { r := ok; r.Class = "first"; return r }(),
+		"pax":   func() booking.WaitlistRequest { r := ok; r.Seats = 0; return r }(),
+		"email": func() booking.WaitlistRequest { r := ok; r.Email = "not an email"; return r }(),
+	} {
+		// Validation fails before the database is touched.
+		if _, err := booking.JoinWaitlist(ctx, nil, req); booking.FieldErrors(err)[field] == "" {
+			t.Fatalf("%s: expected a field error, got %v", field, err)
+		}
+	}
+}
+
+func Test_Booking_Waitlist_OldestFirst(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	tripID, seats := testTrip(t, pool, 2)
+	owner := "session:waitlist-owner"
+	if _, err := booking.PlaceHold(ctx, pool, booking.HoldRequest{Holder: owner, TripID: tripID, SeatIDs: seats}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// A party of two queues first, then a single traveller.
+	var entries []booking.WaitlistEntry
+	for i, pax := range []int{2, 1} {
+		e, err := booking.JoinWaitlist(ctx, pool, booking.WaitlistRequest{
+			Holder: fmt.Sprintf("session:waitlist-%d", i), TripID: tripID, Class: "economy", Seats: pax,
+			Email: fmt.Sprintf("waitlist%d@example.com", i),
+		})
+		if err != nil {
+			t.Fatalf("join %d: %v", i, err)
+		}
+		entries = append(entries, e)
+	}
+	offered := func() []booking.WaitlistOffer {
+		t.Helper()
+		all, err := booking.ProcessWaitlist(ctx, pool, booking.LogNotifier{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var mine []booking.WaitlistOffer
+		for _, o := range all {
+			if o.Entry.TripID == tripID {
+				mine = append(mine, o)
+			}
+		}
+		return mine
+	}
+
+	// One seat back is not enough for the party, and the single traveller
+	// behind it must not jump the queue.
+	if _, err := booking.ReleaseHold(ctx, pool, owner, tripID, seats[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if got := offered(); len(got) != 0 {
+		t.Fatalf("offered %s to entry %s ahead of the oldest", got[0].Entry.Email, got[0].Entry.ID)
+	}
+	if _, err := booking.ReleaseHold(ctx, pool, owner, tripID, seats[1:]); err != nil {
+		t.Fatal(err)
+	}
+	got := offered()
+	if len(got) != 1 || got[0].Entry.ID != entries[0].ID || got[0].Entry.Seats != 2 {
+		t.Fatalf("want both seats offered to the oldest entry, got %+v", got)
+	}
+}
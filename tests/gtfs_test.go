@@ -0,0 +1,229 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gothicforge3/internal/gtfs"
+)
+
+// gtfsZip builds a feed from file name → CSV content.
+func gtfsZip(t *testing.T, files map[string]string) *gtfs.Feed {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		w, _ := zw.Create("feed/" + name)
+		_, _ = w.Write([]byte(strings.TrimSpace(body) + "\n"))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := gtfs.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func sampleFeed() map[string]string {
+	return map[string]string{
+		"agency.txt": `agency_id,agency_name,agency_url,agency_timezone
+KAI,KAI,https://www.kai.id,Asia/Jakarta`,
+		"stops.txt": `stop_id,stop_name,stop_desc,stop_lat,stop_lon
+GMR,Gambir,Jakarta,-6.176655,106.830583
+BD,Bandung,Bandung,-6.914744,107.609810`,
+		"routes.txt": `route_id,agency_id,route_short_name,route_long_name,route_type
+AP,KAI,AP,Argo Parahyangan,2`,
+		"trips.txt": `route_id,service_id,trip_id
+AP,DAILY,AP-1
+AP,WKND,AP-2`,
+		"stop_times.txt": `trip_id,arrival_time,departure_time,stop_id,stop_sequence
+AP-1,07:00:00,07:00:00,GMR,1
+AP-1,10:00:00,10:00:00,BD,2
+AP-2,22:30:00,22:30:00,GMR,1
+AP-2,25:35:00,25:35:00,BD,2`,
+		"calendar.txt": `service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date
+DAILY,1,1,1,1,1,1,1,20260101,20261231
+WKND,0,0,0,0,0,1,1,20260101,20261231`,
+		"calendar_dates.txt": `service_id,date,exception_type
+DAILY,20260320,2
+WKND,20260319,1`,
+		"fare_attributes.txt": `fare_id,price,currency_type,payment_method,transfers
+F1,175000,IDR,1,0`,
+		"fare_rules.txt": `fare_id,route_id
+F1,AP`,
+	}
+}
+
+func Test_GTFS_ValidateAndMap(t *testing.T) {
+	f := gtfsZip(t, sampleFeed())
+	if ps := gtfs.Validate(f); gtfs.HasErrors(ps) {
+		t.Fatalf("valid feed reported errors: %v", ps)
+	}
+	s := gtfs.FromFeed(f, 150000)
+	if len(s.Stations) != 2 || s.Stations[1].Code != "GMR" || s.Stations[1].City != "Jakarta" {
+		t.Fatalf("stations: %+v", s.Stations)
+	}
+	if len(s.Trains) != 1 || s.Trains[0].Name != "Argo Parahyangan" || s.Trains[0].Operator != "KAI" {
+		t.Fatalf("trains: %+v", s.Trains)
+	}
+	if len(s.Routes) != 1 || s.Routes[0].Code != "GMR-BD" || s.Routes[0].DistanceKM < 100 || s.Routes[0].DistanceKM > 130 {
+		t.Fatalf("routes: %+v", s.Routes)
+	}
+	if len(s.Departures) != 2 {
+		t.Fatalf("departures: %+v", s.Departures)
+	}
+	late := s.Departures[1]
+	if late.Depart != "22:30:00" || late.Arrive != "01:35:00" || late.ServiceID != "WKND" || late.BasePrice != 175000 {
+		t.Fatalf("after-midnight departure: %+v", late)
+	}
+	var daily gtfs.Service
+	for _, svc := range s.Services {
+		if svc.ServiceID == "DAILY" {
+			daily = svc
+		}
+	}
+	if daily.Weekdays != 127 || daily.Start != "2026-01-01" || !reflect.DeepEqual(daily.Removed, []string{"2026-03-20"}) {
+		t.Fatalf("daily service: %+v", daily)
+	}
+}
+
+func Test_GTFS_ValidateReportsProblems(t *testing.T) {
+	files := sampleFeed()
+	files["trips.txt"] = `route_id,service_id,trip_id
+AP,DAILY,AP-1
+XX,NOPE,AP-1`
+	files["stop_times.txt"] = `trip_id,arrival_time,departure_time,stop_id,stop_sequence
+AP-1,07:00:00,07:00:00,GMR,1
+AP-1,06:00:00,06:00:00,BD,2`
+	delete(files, "calendar_dates.txt")
+	files["calendar.txt"] = `service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date
+DAILY,1,1,1,1,1,1,1,2026-01-01,20261231`
+	ps := gtfs.Validate(gtfsZip(t, files))
+	if !gtfs.HasErrors(ps) {
+		t.Fatal("expected errors")
+	}
+	all := ""
+	for _, p := range ps {
+		all += p.String() + "\n"
+	}
+	for _, want := range []string{
+		`trips.txt:3: error: duplicate trip_id "AP-1"`,
+		`route_id "XX" is not in routes.txt`,
+		`service_id "NOPE"`,
+		"goes back in time",
+		"calendar.txt:2: error: start_date and end_date must be YYYYMMDD",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("missing %q in:\n%s", want, all)
+		}
+	}
+	if ps := gtfs.Validate(gtfsZip(t, map[string]string{"stops.txt": "stop_id,stop_name\n"})); !strings.Contains(ps[0].String()+ps[1].String(), "required file is missing") {
+		t.Fatalf("missing files not reported: %v", ps)
+	}
+}
+
+func Test_GTFS_CompareAndRoundTrip(t *testing.T) {
+	next := gtfs.FromFeed(gtfsZip(t, sampleFeed()), 150000)
+
+	cur := gtfs.FromFeed(gtfsZip(t, sampleFeed()), 150000)
+	if d := gtfs.Compare(cur, next, false); len(d.Changes) != 0 || d.Unchanged == 0 {
+		t.Fatalf("identical snapshots should not differ: %+v", d)
+	}
+	cur.Stations[1].Name = "Gambir Lama"
+	cur.Departures = cur.Departures[:1]
+	cur.Departures = append(cur.Departures, gtfs.Departure{TripID: "OLD-9", Train: "AP", Route: "GMR-BD", ServiceID: "DAILY", Depart: "05:00:00", Arrive: "08:00:00", BasePrice: 1, Active: true})
+	d := gtfs.Compare(cur, next, true)
+	got := []string{}
+	for _, c := range d.Changes {
+		got = append(got, c.Op+" "+c.Kind+" "+c.Key)
+	}
+	want := []string{"~ station GMR", "- departure AP GMR-BD 05:00:00", "+ departure AP GMR-BD 22:30:00"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes:\n got %v\nwant %v", got, want)
+	}
+	if d2 := gtfs.Compare(cur, next, false); d2.Count("-") != 0 || d2.Kept != 1 {
+		t.Fatalf("without prune the old departure should be kept: %+v", d2)
+	}
+
+	// Export what was imported and read it back.
+	var buf bytes.Buffer
+	if err := gtfs.Write(&buf, gtfs.ToFeed(next)); err != nil {
+		t.Fatal(err)
+	}
+	back, err := gtfs.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps := gtfs.Validate(back); gtfs.HasErrors(ps) {
+		t.Fatalf("exported feed is invalid: %v", ps)
+	}
+	if d := gtfs.Compare(next, gtfs.FromFeed(back, 1), false); len(d.Changes) != 0 {
+		t.Fatalf("round trip changed data: %v", d.Changes)
+	}
+}
+
+func Test_GTFS_IntermediateStops(t *testing.T) {
+	files := sampleFeed()
+	files["stops.txt"] = `stop_id,stop_name,stop_lat,stop_lon
+GMR,Gambir,-6.176655,106.830583
+SMT,Semarang Tawang,-6.967222,110.427222
+SGU,Surabaya Gubeng,-7.265357,112.750000`
+	files["routes.txt"] = `route_id,agency_id,route_short_name,route_long_name,route_type
+ABA,KAI,ABA,Argo Bromo Anggrek,2`
+	files["trips.txt"] = `route_id,service_id,trip_id
+ABA,DAILY,ABA-1`
+	files["stop_times.txt"] = `trip_id,arrival_time,departure_time,stop_id,stop_sequence,shape_dist_traveled
+ABA-1,20:00:00,20:00:00,GMR,10,0
+ABA-1,23:58:00,24:03:00,SMT,20,437
+ABA-1,27:30:00,27:30:00,SGU,30,725`
+	delete(files, "fare_rules.txt")
+	f := gtfsZip(t, files)
+	if ps := gtfs.Validate(f); len(ps) != 0 {
+		t.Fatalf("multi-stop feed should be clean: %v", ps)
+	}
+	s := gtfs.FromFeed(f, 550000)
+	if len(s.Routes) != 1 || s.Routes[0].Code != "GMR-SGU" || s.Routes[0].DistanceKM != 725 {
+		t.Fatalf("route runs between the trip's ends: %+v", s.Routes)
+	}
+	want := []gtfs.Call{
+		{Station: "GMR", Depart: "20:00:00"},
+		{Station: "SMT", Arrive: "23:58:00", Depart: "00:03:00", DayOffset: 1, DistanceKM: 437},
+		{Station: "SGU", Arrive: "03:30:00", DayOffset: 1, DistanceKM: 725},
+	}
+	d := s.Departures[0]
+	if d.Depart != "20:00:00" || d.Arrive != "03:30:00" || !reflect.DeepEqual(d.Stops, want) {
+		t.Fatalf("stops:\n got %+v\nwant %+v", d, want)
+	}
+
+	var buf bytes.Buffer
+	if err := gtfs.Write(&buf, gtfs.ToFeed(s)); err != nil {
+		t.Fatal(err)
+	}
+	back, err := gtfs.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ps := gtfs.Validate(back); len(ps) != 0 {
+		t.Fatalf("exported feed should be clean: %v", ps)
+	}
+	if d := gtfs.Compare(s, gtfs.FromFeed(back, 1), false); len(d.Changes) != 0 {
+		t.Fatalf("round trip changed stops: %v", d.Changes)
+	}
+
+	// A new stop pattern shows up in the diff.
+	moved := gtfs.FromFeed(f, 550000)
+	moved.Departures[0].Stops[1].Depart = "00:10:00"
+	if d := gtfs.Compare(s, moved, false); len(d.Changes) != 1 || !strings.Contains(d.Changes[0].String(), "SMT 23:58/00:10") {
+		t.Fatalf("changed stop times should be reported: %v", d.Changes)
+	}
+
+	files["stop_times.txt"] += "\nABA-1,28:00:00,28:00:00,GMR,40,800"
+	if ps := gtfs.Validate(gtfsZip(t, files)); !gtfs.HasErrors(ps) || !strings.Contains(ps[0].String(), `calls at "GMR" twice`) {
+		t.Fatalf("loops should be rejected: %v", ps)
+	}
+}
@@ -0,0 +1,218 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gothicforge3/internal/jobs"
+)
+
+func Test_Jobs_Spec(t *testing.T) {
+	loc := time.FixedZone("WIB", 7*3600)
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	cases := []struct{ spec, from, want string }{
+		{"*/15 * * * *", "2026-10-16 10:07", "2026-10-16 10:15"},
+		{"15 3 * * *", "2026-10-16 03:15", "2026-10-17 03:15"},
+		{"@daily", "2026-10-16 10:07", "2026-10-17 00:00"},
+		{"0 9 * * 1-5", "2026-10-16 10:00", "2026-10-19 09:00"}, // Friday after nine: Monday
+		{"0 0 1 * 7", "2026-10-16 10:00", "2026-10-18 00:00"},   // either day field matches
+		{"30 6 29 2 *", "2026-10-16 10:00", "2028-02-29 06:30"},
+	}
+	for _, c := range cases {
+		s, err := jobs.ParseSpec(c.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", c.spec, err)
+		}
+		if got := s.Next(at(c.from)); !got.Equal(at(c.want)) {
+			t.Fatalf("%s after %s: %s, want %s", c.spec, c.from, got.Format("2006-01-02 15:04"), c.want)
+		}
+	}
+	s, err := jobs.ParseSpec("@every 90s")
+	if err != nil || !s.Next(at("2026-10-16 10:00")).Equal(at("2026-10-16 10:01").Add(30*time.Second)) {
+		t.Fatalf("@every: %v", err)
+	}
+	if s, _ := jobs.ParseSpec("0 0 30 2 *"); !s.Next(at("2026-10-16 10:00")).IsZero() {
+		t.Fatal("30 February never comes")
+	}
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "@every 10ms", "@yearly"} {
+		if _, err := jobs.ParseSpec(bad); err == nil {
+			t.Fatalf("%q should not parse", bad)
+		}
+	}
+}
+
+func Test_Jobs_Backoff(t *testing.T) {
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second}
+	for i, w := range want {
+		if got := jobs.Backoff(i + 1); got != w {
+			t.Fatalf("backoff after %d attempts: %v, want %v", i+1, got, w)
+		}
+	}
+	if got := jobs.Backoff(30); got != time.Hour {
+		t.Fatalf("backoff is capped at an hour: %v", got)
+	}
+	t.Setenv("JOBS_BACKEND", "valkey")
+	t.Setenv("VALKEY_URL", "")
+	t.Setenv("REDIS_URL", "")
+	if _, err := jobs.FromEnv(nil); err == nil {
+		t.Fatal("the valkey backend needs VALKEY_URL")
+	}
+	t.Setenv("JOBS_BACKEND", "postgres")
+	if _, err := jobs.FromEnv(nil); err == nil {
+		t.Fatal("the postgres backend needs a database")
+	}
+}
+
+// memJobs is an in-memory Backend for exercising the runner.
+type memJobs struct {
+	mu     sync.Mutex
+	jobs   []jobs.Job
+	leases map[string]string
+}
+
+func (m *memJobs) Name() string { return "memory" }
+
+func (m *memJobs) Enqueue(_ context.Context, kind string, args []byte, opts jobs.EnqueueOptions) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, j := range m.jobs {
+		if opts.UniqueKey != "" && j.UniqueKey == opts.UniqueKey && (j.Status == jobs.StatusQueued || j.Status == jobs.StatusRunning) {
+			return 0, nil
+		}
+	}
+	id := int64(len(m.jobs) + 1)
+	m.jobs = append(m.jobs, jobs.Job{ID: id, Kind: kind, Args: args, Status: jobs.StatusQueued, UniqueKey: opts.UniqueKey,
+		MaxAttempts: opts.MaxAttempts, RunAt: time.Now().Add(opts.Delay), CreatedAt: time.Now()})
+	return id, nil
+}
+
+func (m *memJobs) Claim(_ context.Context, kind, worker string, lease time.Duration) (jobs.Job, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, j := range m.jobs {
+		if j.Kind == kind && j.Status == jobs.StatusQueued && !j.RunAt.After(time.Now()) {
+			j.Status, j.LockedBy = jobs.StatusRunning, worker
+			j.Attempts++
+			m.jobs[i] = j
+			return j, true, nil
+		}
+	}
+	return jobs.Job{}, false, nil
+}
+
+func (m *memJobs) Finish(_ context.Context, j jobs.Job, worker string, delay time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur := &m.jobs[j.ID-1]
+	if cur.Status != jobs.StatusRunning || cur.LockedBy != worker {
+		return jobs.ErrLost
+	}
+	// Retries are made due at once so the test need not wait out the backoff.
+	cur.Status, cur.Attempts, cur.LastError, cur.LockedBy, cur.RunAt = j.Status, j.Attempts, j.LastError, "", time.Now()
+	return nil
+}
+
+func (m *memJobs) Lease(_ context.Context, name, holder string, _ time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.leases[name] == "" {
+		m.leases[name] = holder
+	}
+	return m.leases[name] == holder, nil
+}
+
+func (m *memJobs) List(_ context.Context, f jobs.Filter) ([]jobs.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []jobs.Job
+	for _, j := range m.jobs {
+		if (f.Status == "" || j.Status == f.Status) && (f.Kind == "" || j.Kind == f.Kind) {
+			out = append(out, j)
+		}
+	}
+	return out, nil
+}
+
+func (m *memJobs) Retry(context.Context, string, ...int64) (int64, error)      { return 0, nil }
+func (m *memJobs) Purge(context.Context, string, time.Duration) (int64, error) { return 0, nil }
+
+func Test_Jobs_Runner(t *testing.T) {
+	type greet struct {
+		Name string `json:"name"`
+	}
+	var (
+		mu    sync.Mutex
+		seen  []string
+		tries int
+	)
+	hello := jobs.Register("test.hello", jobs.Options{}, func(_ context.Context, a greet) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, a.Name)
+		return nil
+	})
+	flaky := jobs.Register("test.flaky", jobs.Options{MaxAttempts: 3}, func(context.Context, jobs.NoArgs) error {
+		mu.Lock()
+		defer mu.Unlock()
+		tries++
+		return errors.New("still down")
+	})
+	tick := jobs.Register("test.tick", jobs.Options{}, func(context.Context, jobs.NoArgs) error { return nil })
+	if err := jobs.Schedule("test.tick", "@every 1h", tick, jobs.NoArgs{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := jobs.Schedule("test.tick", "@every 1h", tick, jobs.NoArgs{}); err == nil {
+		t.Fatal("a schedule name is registered once")
+	}
+
+	b := &memJobs{leases: map[string]string{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := hello.Enqueue(ctx, b, greet{Name: "Ayu"}, jobs.EnqueueOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := flaky.Enqueue(ctx, b, jobs.NoArgs{}, jobs.EnqueueOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := hello.Enqueue(ctx, b, greet{Name: "Budi"}, jobs.EnqueueOptions{UniqueKey: "once"}); id == 0 {
+		t.Fatal("a free unique key enqueues")
+	}
+	if id, _ := hello.Enqueue(ctx, b, greet{Name: "Budi"}, jobs.EnqueueOptions{UniqueKey: "once"}); id != 0 {
+		t.Fatal("a taken unique key does not enqueue")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		jobs.NewRunner(b, 10*time.Millisecond).Run(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		failed, _ := b.List(ctx, jobs.Filter{Status: jobs.StatusFailed})
+		ticks, _ := b.List(ctx, jobs.Filter{Kind: "test.tick", Status: jobs.StatusDone})
+		greeted, _ := b.List(ctx, jobs.Filter{Kind: "test.hello", Status: jobs.StatusDone})
+		if len(failed) == 1 && len(ticks) == 1 && len(greeted) == 2 {
+			if failed[0].Attempts != 3 || failed[0].LastError != "still down" {
+				t.Fatalf("failed job: %+v", failed[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("jobs did not finish: %+v", b.jobs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if len(seen) != 2 || seen[0] != "Ayu" || seen[1] != "Budi" || tries != 3 {
+		t.Fatalf("handlers saw %v and %d tries", seen, tries)
+	}
+}
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/notify"
+	"gothicforge3/internal/server"
+)
+
+func Test_Notify_Templates(t *testing.T) {
+	previews := notify.Previews("https://kereta.example")
+	seen := map[string]bool{}
+	for _, p := range previews {
+		seen[p.Name] = true
+		m := p.Message
+		if m.To == "" || !strings.Contains(m.Subject, " · ") {
+			t.Fatalf("%s: recipient %q, subject %q", p.Name, m.To, m.Subject)
+		}
+		for _, body := range []string{m.HTML, m.Text} {
+			if !strings.Contains(body, "Halo") || !strings.Contains(body, "Hello") {
+				t.Fatalf("%s is not in both languages:\n%s", p.Name, body)
+			}
+			if !strings.Contains(body, "https://kereta.example/") {
+				t.Fatalf("%s has no absolute link:\n%s", p.Name, body)
+			}
+		}
+		if !strings.Contains(m.HTML, `<section lang="id">`) || !strings.Contains(m.HTML, `<section lang="en">`) {
+			t.Fatalf("%s: language sections missing", p.Name)
+		}
+	}
+	for _, name := range []string{"confirmation", "payment-reminder", "cancellation", "disruption-moved", "disruption-refunded", "disruption-delay", "waitlist-offer"} {
+		if !seen[name] {
+			t.Fatalf("no preview of %s", name)
+		}
+	}
+
+	b := booking.Booking{ID: "b1", Code: "K7QM2XA", Status: booking.StatusPaid, Total: 1250000,
+		Contact: booking.Contact{Name: "Tom <script>", Email: "tom@example.com"},
+		Trip:    booking.TripInfo{TrainCode: "KA 7", TrainName: "Argo", ServiceDate: "2026-01-02"}}
+	m := notify.Confirmation(b, "http://127.0.0.1:8080")
+	if m.To != "tom@example.com" || !strings.Contains(m.Subject, "K7QM2XA") {
+		t.Fatalf("confirmation: %+v", m)
+	}
+	if !strings.Contains(m.HTML, "/tickets/K7QM2XA") || !strings.Contains(m.Text, "Rp1.250.000") {
+		t.Fatalf("confirmation links the tickets and shows the total:\n%s", m.Text)
+	}
+	if strings.Contains(m.HTML, "<script>") {
+		t.Fatal("customer input is escaped in the HTML body")
+	}
+}
+
+func Test_Notify_SMTP(t *testing.T) {
+	got := make(chan string, 1)
+	addr := fakeSMTP(t, got)
+	s := &notify.SMTP{Addr: addr, From: "Kereta <no-reply@kereta.example>"}
+	m := notify.Previews("http://127.0.0.1:8080")[0].Message
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Send(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(<-got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subj, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject")); subj != m.Subject {
+		t.Fatalf("subject %q, want %q", subj, m.Subject)
+	}
+	mt, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mt != "multipart/alternative" {
+		t.Fatalf("content type %q: %v", mt, err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var types []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(p) // NextPart undoes quoted-printable
+		types = append(types, strings.SplitN(p.Header.Get("Content-Type"), ";", 2)[0])
+		if !strings.Contains(string(body), "Hello") {
+			t.Fatalf("part %s:\n%s", p.Header.Get("Content-Type"), body)
+		}
+	}
+	if strings.Join(types, ",") != "text/plain,text/html" {
+		t.Fatalf("parts: %v", types)
+	}
+}
+
+func Test_Notify_DevPreview(t *testing.T) {
+	_ = os.Setenv("LOG_FORMAT", "off")
+	r := server.New()
+	routes.Register(r)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	t.Setenv("APP_ENV", "development")
+	if rec := get("/dev/mail"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "/dev/mail/confirmation") {
+		t.Fatalf("index: %d", rec.Code)
+	}
+	if rec := get("/dev/mail/disruption-delay"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `lang="en"`) {
+		t.Fatalf("html preview: %d", rec.Code)
+	}
+	if rec := get("/dev/mail/waitlist-offer.txt"); rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("text preview: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec := get("/dev/mail/nope"); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown template: %d", rec.Code)
+	}
+	t.Setenv("APP_ENV", "production")
+	if rec := get("/dev/mail"); rec.Code != http.StatusNotFound {
+		t.Fatalf("production hides the previews: %d", rec.Code)
+	}
+}
+
+// fakeSMTP accepts one message, like MailHog, and passes its data to got.
+func fakeSMTP(t *testing.T, got chan<- string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		rw := bufio.NewReadWriter(bufio.NewReader(c), bufio.NewWriter(c))
+		reply := func(s string) { rw.WriteString(s + "\r\n"); rw.Flush() }
+		reply("220 fake ESMTP")
+		for {
+			line, err := rw.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 fake")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var b strings.Builder
+				for {
+					l, err := rw.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					b.WriteString(strings.TrimPrefix(l, "."))
+				}
+				got <- b.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return ln.Addr().String()
+}
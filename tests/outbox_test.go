@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/outbox"
+)
+
+func Test_Outbox_Deliver(t *testing.T) {
+	var calls []string
+	down := true
+	outbox.Handle("test.deliver", "first", func(_ context.Context, m outbox.Message) error {
+		calls = append(calls, "first:"+m.Ref)
+		return nil
+	})
+	outbox.Handle("test.deliver", "second", func(_ context.Context, m outbox.Message) error {
+		calls = append(calls, "second:"+m.Ref)
+		if m.Ref == "bad" && down {
+			return errors.New("receiver down")
+		}
+		return nil
+	})
+	outbox.Handle("test.deliver", "third", func(_ context.Context, m outbox.Message) error {
+		calls = append(calls, "third:"+m.Ref)
+		return nil
+	})
+	ctx := context.Background()
+	if done, err := outbox.Deliver(ctx, outbox.Message{Topic: "test.deliver", Ref: "ok"}); err != nil || strings.Join(done, ",") != "first,second,third" {
+		t.Fatalf("every handler succeeded: %v %v", done, err)
+	}
+	done, err := outbox.Deliver(ctx, outbox.Message{Topic: "test.deliver", Ref: "bad"})
+	if err == nil || !strings.Contains(err.Error(), "second") {
+		t.Fatalf("a failing handler fails the delivery: %v", err)
+	}
+	if strings.Join(done, ",") != "first,third" {
+		t.Fatalf("handlers after a failing one still run: %v", done)
+	}
+	// The retry runs only the handler that failed.
+	down = false
+	if done, err = outbox.Deliver(ctx, outbox.Message{Topic: "test.deliver", Ref: "bad", Done: done}); err != nil || len(done) != 3 {
+		t.Fatalf("retry: %v %v", done, err)
+	}
+	if got := strings.Join(calls, " "); got != "first:ok second:ok third:ok first:bad second:bad third:bad second:bad" {
+		t.Fatalf("handlers ran: %s", got)
+	}
+
+	outbox.Handle("test.panic", "boom", func(context.Context, outbox.Message) error { panic("boom") })
+	if _, err := outbox.Deliver(ctx, outbox.Message{Topic: "test.panic"}); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("a panicking handler: %v", err)
+	}
+	if _, err := outbox.Deliver(ctx, outbox.Message{Topic: "test.nobody"}); err != nil {
+		t.Fatalf("a topic without handlers: %v", err)
+	}
+}
+
+func Test_Outbox_Backoff(t *testing.T) {
+	want := []time.Duration{15 * time.Second, 30 * time.Second, time.Minute, 2 * time.Minute}
+	for i, w := range want {
+		if got := outbox.Backoff(i + 1); got != w {
+			t.Fatalf("backoff after %d attempts: %v, want %v", i+1, got, w)
+		}
+	}
+	if got := outbox.Backoff(40); got != time.Hour {
+		t.Fatalf("backoff is capped at an hour: %v", got)
+	}
+	t.Setenv("OUTBOX_MAX_ATTEMPTS", "3")
+	if outbox.MaxAttempts() != 3 {
+		t.Fatal("OUTBOX_MAX_ATTEMPTS")
+	}
+	if booking.EventTopic(booking.EventPaid) != "booking.paid" {
+		t.Fatal("history events are published as booking.<event>")
+	}
+}
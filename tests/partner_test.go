@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/partner"
+	"gothicforge3/internal/server"
+)
+
+func Test_Partner_SignVerify(t *testing.T) {
+	secret, body := "whsec_test", []byte(`{"id":"evt_1","type":"booking.paid"}`)
+	now := time.Unix(1_700_000_000, 0)
+	sig := partner.Sign(secret, now, body)
+	if !strings.HasPrefix(sig, "t=1700000000,v1=") {
+		t.Fatalf("signature header: %s", sig)
+	}
+	if err := partner.Verify(secret, sig, body, now.Add(time.Minute)); err != nil {
+		t.Fatalf("valid signature: %v", err)
+	}
+	// Receivers rotating secrets may see several v1 values.
+	if err := partner.Verify(secret, partner.Sign("whsec_old", now, body)+","+strings.Split(sig, ",")[1], body, now); err != nil {
+		t.Fatalf("any matching v1 verifies: %v", err)
+	}
+	for name, err := range map[string]error{
+		"tampered body":  partner.Verify(secret, sig, append(body, ' '), now),
+		"wrong secret":   partner.Verify("whsec_other", sig, body, now),
+		"no signature":   partner.Verify(secret, "", body, now),
+		"garbage header": partner.Verify(secret, "t=abc,v1=zz", body, now),
+	} {
+		if !errors.Is(err, partner.ErrBadSignature) {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if err := partner.Verify(secret, sig, body, now.Add(partner.SignatureTolerance+time.Second)); !errors.Is(err, partner.ErrStale) {
+		t.Fatalf("old signature: %v", err)
+	}
+}
+
+func Test_Partner_Refs(t *testing.T) {
+	id := "7d3c1a6e-0f0b-4a53-9d7e-3f4f1b2c9a10"
+	if partner.FromRef(partner.Ref(id)) != id {
+		t.Fatal("Ref / FromRef round trip")
+	}
+	if partner.FromRef("42") != "" || partner.FromRef("") != "" {
+		t.Fatal("customer bookings have no partner")
+	}
+}
+
+func Test_Partner_WebhookValidation(t *testing.T) {
+	ctx, id := context.Background(), "7d3c1a6e-0f0b-4a53-9d7e-3f4f1b2c9a10"
+	cases := []struct {
+		url        string
+		events     []string
+		production bool
+		field      string
+	}{
+		{"not a url", nil, false, "url"},
+		{"ftp://example.com/hook", nil, false, "url"},
+		{"http://example.com/hook", nil, true, "url"},
+		{"https://example.com/hook", []string{"booking.paid,booking.refunded"}, true, "events"},
+		// In production only public addresses are accepted.
+		{"https://127.0.0.1/hook", nil, true, "url"},
+		{"https://10.1.2.3:8443/hook", nil, true, "url"},
+		{"https://169.254.169.254/latest/meta-data", nil, true, "url"},
+		{"https://[::1]/hook", nil, true, "url"},
+		{"https://[::ffff:192.168.0.1]/hook", nil, true, "url"},
+	}
+	for _, c := range cases {
+		appEnv := "development"
+		if c.production {
+			appEnv = "production"
+		}
+		t.Setenv("APP_ENV", appEnv)
+		// A nil Querier proves these are refused before touching the database.
+		_, err := partner.AddWebhook(ctx, nil, id, c.url, c.events)
+		var be *booking.Error
+		if !errors.As(err, &be) || be.Fields[c.field] == "" {
+			t.Fatalf("%s %v: %v", c.url, c.events, err)
+		}
+	}
+	if _, err := partner.AddWebhook(ctx, nil, "nope", "https://example.com/hook", nil); err == nil {
+		t.Fatal("partner id must be a UUID")
+	}
+}
+
+func Test_Partner_PostDoesNotFollowRedirects(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	var internal atomic.Bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { internal.Store(true) }))
+	defer target.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusSeeOther)
+	}))
+	defer srv.Close()
+
+	d := partner.Delivery{ID: 1, EventID: "evt_1", Event: partner.EventBookingPaid, Payload: []byte(`{}`)}
+	code, err := partner.Post(context.Background(), srv.URL, "whsec_x", d)
+	if err == nil || code != http.StatusSeeOther || internal.Load() {
+		t.Fatalf("redirect: %d %v (followed: %t)", code, err, internal.Load())
+	}
+
+	// In production the sender will not connect to a private address, even
+	// for a URL that was accepted earlier.
+	t.Setenv("APP_ENV", "production")
+	if _, err := partner.Post(context.Background(), target.URL, "whsec_x", d); !errors.Is(err, partner.ErrPrivateAddr) || internal.Load() {
+		t.Fatalf("loopback receiver in production: %v", err)
+	}
+}
+
+func Test_Partner_NewRequest(t *testing.T) {
+	secret := "whsec_receiver"
+	d := partner.Delivery{ID: 12, EventID: "evt_34", Event: partner.EventBookingPaid, Payload: []byte(`{"id":"evt_34"}`)}
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = r.Header.Clone()
+		if err := partner.Verify(secret, r.Header.Get(partner.SignatureHeader), body, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	req, err := partner.NewRequest(context.Background(), srv.URL, secret, d, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("receiver answered %d", res.StatusCode)
+	}
+	if got.Get(partner.EventHeader) != "booking.paid" || got.Get(partner.EventIDHeader) != "evt_34" || got.Get(partner.DeliveryHeader) != "12" {
+		t.Fatalf("delivery headers: %v", got)
+	}
+}
+
+func Test_Partner_Backoff(t *testing.T) {
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute}
+	for i, w := range want {
+		if got := partner.Backoff(i + 1); got != w {
+			t.Fatalf("backoff after %d attempts: %v, want %v", i+1, got, w)
+		}
+	}
+	if got := partner.Backoff(40); got != time.Hour {
+		t.Fatalf("backoff is capped at an hour: %v", got)
+	}
+	if partner.MaxAttempts() != 10 {
+		t.Fatal("WEBHOOK_MAX_ATTEMPTS defaults to 10")
+	}
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "4")
+	if partner.MaxAttempts() != 4 {
+		t.Fatal("WEBHOOK_MAX_ATTEMPTS")
+	}
+}
+
+func Test_Partner_APIRequiresKey(t *testing.T) {
+	r := server.New()
+	routes.Register(r)
+	for _, path := range []string{"/api/partner/bookings", "/api/partner/webhooks/deliveries"} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s without a key: %d", path, rec.Code)
+		}
+	}
+	// Partners call from their servers: no same-origin check, the key is the credential.
+	req := httptest.NewRequest(http.MethodPost, "/api/partner/webhooks", strings.NewReader(`{}`))
+	req.Header.Set("Origin", "https://agent.example")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("cross-origin POST without a key: %d", rec.Code)
+	}
+}
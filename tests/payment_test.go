@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/payment"
+	"gothicforge3/internal/server"
+)
+
+func Test_Payment_Simulator_ChargeAndCallback(t *testing.T) {
+	sim := payment.NewSimulator("s3cret")
+	ctx := context.Background()
+	va, err := sim.CreateCharge(ctx, payment.ChargeRequest{OrderID: "K7QM2XA-1", Amount: 150000, Method: payment.MethodVA, Bank: "bca"})
+	if err != nil || len(va.VANumber) != 16 || !strings.HasPrefix(va.VANumber, "39010") {
+		t.Fatalf("unexpected VA charge: %+v, %v", va, err)
+	}
+	qr, _ := sim.CreateCharge(ctx, payment.ChargeRequest{OrderID: "K7QM2XA-2", Amount: 150000, Method: payment.MethodQRIS})
+	if qr.QRString == "" || qr.ExternalID == va.ExternalID {
+		t.Fatalf("unexpected QRIS charge: %+v", qr)
+	}
+
+	h, body := sim.Callback(va.ExternalID, payment.StatusPaid, 150000)
+	ev, err := sim.ParseCallback(h, body)
+	if err != nil || ev.ExternalID != va.ExternalID || ev.Status != payment.StatusPaid || ev.Amount != 150000 {
+		t.Fatalf("round trip failed: %+v, %v", ev, err)
+	}
+	tampered := []byte(strings.Replace(string(body), "150000", "1", 1))
+	if _, err := sim.ParseCallback(h, tampered); !errors.Is(err, payment.ErrBadSignature) {
+		t.Fatalf("tampered body should fail verification, got %v", err)
+	}
+	if _, err := payment.NewSimulator("other").ParseCallback(h, body); !errors.Is(err, payment.ErrBadSignature) {
+		t.Fatalf("wrong secret should fail verification, got %v", err)
+	}
+}
+
+func Test_Payment_Midtrans_Notification(t *testing.T) {
+	m := payment.NewMidtrans("SB-Mid-server-key", payment.MidtransSandboxURL)
+	notify := func(status, sig string) []byte {
+		b, _ := json.Marshal(map[string]string{
+			"order_id": "K7QM2XA-AB12", "status_code": "200", "gross_amount": "150000.00",
+			"transaction_status": status, "signature_key": sig,
+		})
+		return b
+	}
+	sig := m.Signature("K7QM2XA-AB12", "200", "150000.00")
+	ev, err := m.ParseCallback(nil, notify("settlement", sig))
+	if err != nil || ev.Status != payment.StatusPaid || ev.Amount != 150000 || ev.ExternalID != "K7QM2XA-AB12" {
+		t.Fatalf("settlement: %+v, %v", ev, err)
+	}
+	if ev, _ := m.ParseCallback(nil, notify("expire", sig)); ev.Status != payment.StatusExpired {
+		t.Fatalf("expire should map to expired, got %q", ev.Status)
+	}
+	if _, err := m.ParseCallback(nil, notify("settlement", strings.Repeat("0", 128))); !errors.Is(err, payment.ErrBadSignature) {
+		t.Fatalf("forged notification accepted: %v", err)
+	}
+}
+
+func Test_Payment_Midtrans_CreateCharge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, ok := r.BasicAuth()
+		if !ok || user != "SB-Mid-server-key" || r.URL.Path != "/v2/charge" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var in map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		if in["payment_type"] != "bank_transfer" {
+			t.Errorf("unexpected payment_type %v", in["payment_type"])
+		}
+		_, _ = w.Write([]byte(`{"status_code":"201","status_message":"Success","order_id":"K7QM2XA-1","va_numbers":[{"bank":"bni","va_number":"9881234567890123"}]}`))
+	}))
+	defer srv.Close()
+	m := payment.NewMidtrans("SB-Mid-server-key", srv.URL)
+	c, err := m.CreateCharge(context.Background(), payment.ChargeRequest{OrderID: "K7QM2XA-1", Amount: 150000, Method: payment.MethodVA, Bank: "bni", ExpiresAt: time.Now().Add(30 * time.Minute)})
+	if err != nil || c.VANumber != "9881234567890123" || c.ExternalID != "K7QM2XA-1" {
+		t.Fatalf("unexpected charge: %+v, %v", c, err)
+	}
+}
+
+func Test_Payment_ValidMethodAndWindow(t *testing.T) {
+	if !payment.ValidMethod(payment.MethodQRIS, "") || !payment.ValidMethod(payment.MethodVA, "bca") {
+		t.Fatal("expected QRIS and BCA VA to be valid")
+	}
+	if payment.ValidMethod(payment.MethodVA, "") || payment.ValidMethod("card", "") {
+		t.Fatal("expected VA without bank and unknown methods to be rejected")
+	}
+	_ = os.Setenv("PAYMENT_DEADLINE_MINUTES", "15")
+	defer os.Unsetenv("PAYMENT_DEADLINE_MINUTES")
+	if got := booking.PaymentWindow(); got != 15*time.Minute {
+		t.Fatalf("want 15m, got %s", got)
+	}
+}
+
+func Test_Payment_ApplyEvent_RejectsUnknownStatus(t *testing.T) {
+	// A nil DB proves the status is refused before anything is written.
+	for _, status := range []string{"", "settled", "PAID", "refunded"} {
+		_, err := payment.ApplyEvent(context.Background(), nil, "simulator", payment.Event{ExternalID: "SIM-1", Status: status})
+		if booking.ErrorCode(err) != booking.CodeInvalid {
+			t.Fatalf("status %q: %v", status, err)
+		}
+	}
+}
+
+func Test_API_PaymentWebhook_RejectsBadSignature(t *testing.T) {
+	_ = os.Setenv("LOG_FORMAT", "off")
+	r := server.New()
+	routes.Register(r)
+	req := httptest.NewRequest(http.MethodPost, "/api/payments/webhook", strings.NewReader(`{"external_id":"SIM-1","status":"paid","amount":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(payment.SignatureHeader, "00")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "invalid_signature") {
+		t.Fatalf("want 401 invalid_signature, got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"gothicforge3/internal/schedule"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse(schedule.DateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func Test_Schedule_WeekdayBitAndExceptions(t *testing.T) {
+	if schedule.WeekdayBit(time.Monday) != schedule.Monday || schedule.WeekdayBit(time.Sunday) != schedule.Sunday || schedule.Daily != 127 {
+		t.Fatal("weekday bits should run Monday = 1 to Sunday = 64")
+	}
+	ex, err := schedule.ParseExceptions([]byte(`{"removed":["2026-03-20"],"added":["2026-03-28"]}`))
+	if err != nil || len(ex.Removed) != 1 || len(ex.Added) != 1 {
+		t.Fatalf("object form: %+v, %v", ex, err)
+	}
+	if ex, err := schedule.ParseExceptions([]byte(`["2026-03-20","2026-03-21"]`)); err != nil || len(ex.Removed) != 2 {
+		t.Fatalf("array form: %+v, %v", ex, err)
+	}
+	if ex, err := schedule.ParseExceptions(nil); err != nil || len(ex.Removed)+len(ex.Added) != 0 {
+		t.Fatalf("NULL: %+v, %v", ex, err)
+	}
+	if _, err := schedule.ParseExceptions([]byte(`{"removed":["20/03/2026"]}`)); err == nil {
+		t.Fatal("bad date should be rejected")
+	}
+}
+
+func Test_Schedule_CalendarRuns(t *testing.T) {
+	c := schedule.Calendar{
+		Weekdays: schedule.Friday | schedule.Saturday | schedule.Sunday,
+		Start:    day("2026-03-01"), End: day("2026-03-31"),
+		Exceptions: schedule.Exceptions{Removed: []string{"2026-03-20"}, Added: []string{"2026-03-18", "2026-04-01"}},
+	}
+	cases := map[string]bool{
+		"2026-03-13": true,  // Friday
+		"2026-03-16": false, // Monday
+		"2026-03-20": false, // Friday, holiday removed
+		"2026-03-18": true,  // Wednesday, extra service
+		"2026-04-01": true,  // added outside the range
+		"2026-04-03": false, // Friday after end_date
+	}
+	for d, want := range cases {
+		if got := c.Runs(day(d)); got != want {
+			t.Errorf("%s: want %v, got %v", d, want, got)
+		}
+	}
+}
+
+func Test_Schedule_BuildConsist(t *testing.T) {
+	cs, err := schedule.ParseConsist([]byte(`[{"class":"executive","layout":"2-2","rows":13,"cols":4,"count":2,"accessible_rows":[1]},{"class":"economy","layout":"3-2","rows":16,"cols":5,"count":1}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	coaches, seats := schedule.Build(cs)
+	if len(coaches) != 3 || coaches[2].No != 3 || coaches[2].Class != "economy" {
+		t.Fatalf("coaches: %+v", coaches)
+	}
+	if len(seats) != 2*13*4+16*5 {
+		t.Fatalf("want %d seats, got %d", 2*13*4+16*5, len(seats))
+	}
+	if s := seats[0]; s.SeatNo != "01-1" || !s.Accessible || s.CoachNo != 1 {
+		t.Fatalf("first seat: %+v", s)
+	}
+	if s := seats[4]; s.SeatNo != "02-1" || s.Accessible {
+		t.Fatalf("row 2 should not be accessible: %+v", s)
+	}
+	if _, err := schedule.ParseConsist([]byte(`[{"class":"economy","rows":0}]`)); err == nil {
+		t.Fatal("incomplete consist should be rejected")
+	}
+}
+
+func Test_Schedule_Expand(t *testing.T) {
+	cals := []schedule.Calendar{
+		{TrainID: "ARW", Weekdays: schedule.Friday | schedule.Saturday | schedule.Sunday, Start: day("2026-01-01"), End: day("2026-12-31"),
+			Exceptions: schedule.Exceptions{Removed: []string{"2026-03-21"}}},
+		// A second calendar for the same train must not duplicate departures.
+		{ID: "sun", TrainID: "ARW", Weekdays: schedule.Sunday, Start: day("2026-01-01"), End: day("2026-12-31")},
+	}
+	tpls := []schedule.Template{
+		{ID: "t1", TrainID: "ARW", RouteID: "BD-SGU", Depart: "07:20:00"},
+		{ID: "t2", TrainID: "AP", RouteID: "GMR-BD", Depart: "07:00:00"}, // no calendar, never runs
+	}
+	// Monday 2026-03-16 .. Sunday 2026-03-22: Friday and Sunday run, Saturday is a holiday.
+	deps := schedule.Expand(cals, tpls, day("2026-03-16"), 7)
+	if len(deps) != 2 || deps[0].Date.Format(schedule.DateLayout) != "2026-03-20" || deps[1].Date.Format(schedule.DateLayout) != "2026-03-22" {
+		t.Fatalf("unexpected departures: %+v", deps)
+	}
+	if deps[0].Key() == deps[1].Key() {
+		t.Fatal("departure keys should differ by date")
+	}
+	again := schedule.Expand(cals, tpls, day("2026-03-16"), 7)
+	if len(again) != len(deps) || again[0].Key() != deps[0].Key() {
+		t.Fatal("expansion should be deterministic")
+	}
+
+	// A template bound to one calendar ignores the train's other calendars.
+	tpls = append(tpls, schedule.Template{ID: "t3", TrainID: "ARW", RouteID: "SGU-BD", CalendarID: "sun", Depart: "16:00:00"})
+	deps = schedule.Expand(cals, tpls, day("2026-03-16"), 7)
+	n := 0
+	for _, d := range deps {
+		if d.Template.ID == "t3" {
+			n++
+			if d.Date.Weekday() != time.Sunday {
+				t.Fatalf("t3 should only run on Sundays: %+v", d)
+			}
+		}
+	}
+	if n != 1 || len(deps) != 3 {
+		t.Fatalf("unexpected departures with a bound calendar: %+v", deps)
+	}
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/seatfeed"
+	"gothicforge3/internal/server"
+)
+
+const (
+	feedTripA = "5b1c2d3e-4a5b-4c6d-8e7f-00112233aa01"
+	feedTripB = "5b1c2d3e-4a5b-4c6d-8e7f-00112233aa02"
+)
+
+func Test_SeatFeed_Local(t *testing.T) {
+	l := seatfeed.NewLocal()
+	a, cancelA := l.Subscribe(feedTripA)
+	both, cancelBoth := l.Subscribe(feedTripA, feedTripB)
+	defer cancelBoth()
+
+	l.Publish(booking.SeatChange{TripID: feedTripB, SeatIDs: []string{"s1"}, Status: booking.SeatHeld})
+	if c := <-both; c.TripID != feedTripB || c.Status != booking.SeatHeld {
+		t.Fatalf("change on trip B: %+v", c)
+	}
+	select {
+	case c := <-a:
+		t.Fatalf("trip A subscriber got trip B's change: %+v", c)
+	default:
+	}
+
+	cancelA()
+	if _, ok := <-a; ok {
+		t.Fatal("unsubscribing closes the channel")
+	}
+	cancelA()
+	if n := l.Subscribers(feedTripA); n != 1 {
+		t.Fatalf("subscribers left on trip A: %d", n)
+	}
+
+	// A subscriber that stops reading misses changes instead of blocking publishers.
+	for i := 0; i < 100; i++ {
+		l.Publish(booking.SeatChange{TripID: feedTripA, SeatIDs: []string{"s2"}, Status: booking.SeatReleased})
+	}
+	_ = l.Close()
+	n := 0
+	for range both {
+		n++
+	}
+	if n == 0 || n >= 100 {
+		t.Fatalf("buffered changes: %d", n)
+	}
+}
+
+func Test_SeatFeed_Stream(t *testing.T) {
+	_ = os.Setenv("LOG_FORMAT", "off")
+	_ = os.Unsetenv("VALKEY_URL")
+	_ = os.Unsetenv("REDIS_URL")
+	r := server.New()
+	routes.Register(r)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	if res, err := http.Get(srv.URL + "/api/seats/stream?trip=nope"); err != nil || res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("bad trip ids: %v %v", res, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/trips/"+feedTripA+"/seats/stream", nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type: %q", ct)
+	}
+	lines := bufio.NewScanner(res.Body)
+	next := func() string {
+		if !lines.Scan() {
+			t.Fatalf("stream ended: %v", lines.Err())
+		}
+		return lines.Text()
+	}
+	for next() != ": connected" {
+	}
+	// The handler subscribes right after the greeting; give it a moment.
+	time.Sleep(50 * time.Millisecond)
+	seatfeed.Default().Publish(booking.SeatChange{TripID: feedTripB, SeatIDs: []string{"other"}, Status: booking.SeatBooked})
+	seatfeed.Default().Publish(booking.SeatChange{TripID: feedTripA, SeatIDs: []string{"seat-1"}, Status: booking.SeatBooked})
+	for l := next(); l != "event: seats"; l = next() {
+	}
+	if data := next(); !strings.HasPrefix(data, "data: ") || !strings.Contains(data, `"seat-1"`) || !strings.Contains(data, `"booked"`) {
+		t.Fatalf("event data: %q", data)
+	}
+}
@@ -0,0 +1,29 @@
+package tests
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"gothicforge3/internal/textx"
+)
+
+func Test_Textx_Truncate(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"abcdef", 3, "abc"},
+		{"café au lait", 4, "caf"}, // é is two bytes; cutting after its first byte backs up
+		{"日本語", 4, "日"},
+		{"日本語", 0, ""},
+		{"bad \xff byte", 100, "bad  byte"},
+	} {
+		got := textx.Truncate(c.in, c.n)
+		if got != c.want || !utf8.ValidString(got) {
+			t.Fatalf("Truncate(%q, %d) = %q, want %q", c.in, c.n, got, c.want)
+		}
+	}
+}
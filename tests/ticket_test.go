@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"gothicforge3/app/routes"
+	"gothicforge3/internal/booking"
+	"gothicforge3/internal/server"
+	"gothicforge3/internal/ticket"
+)
+
+func testTicketKey() ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+}
+
+func paidBooking() booking.Booking {
+	return booking.Booking{
+		Code: "K7QM2XA", Status: booking.StatusPaid, TripID: "trip-1",
+		Trip: booking.TripInfo{TrainCode: "KA 7", TrainName: "Argo Parahyangan", ServiceDate: "2026-11-02", OriginName: "Gambir", DestinationName: "Bandung", Depart: "07:00", Arrive: "10:05"},
+		Items: []booking.Item{
+			{ID: "item-1", CoachNo: 1, SeatNo: "01-A", Class: "executive", Status: booking.ItemConfirmed, Passenger: &booking.Passenger{Name: "Siti Aminah", IDType: booking.IDTypeNIK, IDNumber: "3171014506900001", Category: booking.CategoryAdult}},
+			{ID: "item-2", CoachNo: 1, SeatNo: "01-B", Class: "executive", Status: booking.ItemReleased},
+		},
+	}
+}
+
+func Test_Ticket_SignVerify(t *testing.T) {
+	priv := testTicketKey()
+	pub := priv.Public().(ed25519.PublicKey)
+	c := ticket.Claims{Code: "K7QM2XA", ItemID: "item-1", TripID: "trip-1", Date: "2026-11-02", Train: "KA 7", Coach: 1, Seat: "01-A"}
+	p, err := ticket.Sign(priv, c)
+	if err != nil || !strings.HasPrefix(p, ticket.Prefix+".") {
+		t.Fatalf("sign: %q, %v", p, err)
+	}
+	got, err := ticket.Verify(pub, p)
+	if err != nil || got != c {
+		t.Fatalf("round trip: %+v, %v", got, err)
+	}
+
+	forged, _ := ticket.Sign(priv, ticket.Claims{Code: "K7QM2XA", Seat: "09-D"})
+	tampered := forged[:strings.IndexByte(forged[4:], '.')+4] + p[strings.LastIndexByte(p, '.'):]
+	if _, err := ticket.Verify(pub, tampered); !errors.Is(err, ticket.ErrBadSignature) {
+		t.Fatalf("swapped claims should fail verification, got %v", err)
+	}
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{9}, ed25519.SeedSize)).Public().(ed25519.PublicKey)
+	if _, err := ticket.Verify(other, p); !errors.Is(err, ticket.ErrBadSignature) {
+		t.Fatalf("wrong key should fail verification, got %v", err)
+	}
+	for _, bad := range []string{"", "hello", "KT0.abc.def", "KT1.abc.!!"} {
+		if _, err := ticket.Verify(pub, bad); !errors.Is(err, ticket.ErrMalformed) {
+			t.Fatalf("%q: want ErrMalformed, got %v", bad, err)
+		}
+	}
+}
+
+func Test_Ticket_HashPassengerID(t *testing.T) {
+	a := ticket.HashPassengerID("k7qm2xa", "NIK", "3171014506900001")
+	if a != ticket.HashPassengerID("K7QM2XA", "nik", "3171014506900001") || len(a) != 32 {
+		t.Fatalf("hash should be case-insensitive and 32 hex chars, got %q", a)
+	}
+	if a == ticket.HashPassengerID("ABCDEFG", "nik", "3171014506900001") {
+		t.Fatal("hash should be salted with the booking code")
+	}
+}
+
+func Test_Ticket_IssueAndRender(t *testing.T) {
+	priv := testTicketKey()
+	b := paidBooking()
+	b.Status = booking.StatusPending
+	if ts, _ := ticket.Issue(priv, b); len(ts) != 0 {
+		t.Fatalf("unpaid booking should have no tickets, got %d", len(ts))
+	}
+	b = paidBooking()
+	ts, err := ticket.Issue(priv, b)
+	if err != nil || len(ts) != 1 {
+		t.Fatalf("want one ticket for the confirmed seat, got %d, %v", len(ts), err)
+	}
+	tk := ts[0]
+	if tk.Passenger != "Siti Aminah" || tk.Seat != "01-A" || tk.IDHash != ticket.HashPassengerID(b.Code, booking.IDTypeNIK, "3171014506900001") {
+		t.Fatalf("unexpected ticket: %+v", tk)
+	}
+	if c, err := ticket.Verify(priv.Public().(ed25519.PublicKey), tk.Payload); err != nil || c != tk.Claims {
+		t.Fatalf("issued payload does not verify: %+v, %v", c, err)
+	}
+
+	svg, err := ticket.SVG(tk.Payload, 200)
+	if err != nil || !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, "M") {
+		t.Fatalf("svg: %v", err)
+	}
+	var pdf bytes.Buffer
+	if err := ticket.WritePDF(&pdf, b, ts); err != nil || !bytes.HasPrefix(pdf.Bytes(), []byte("%PDF")) {
+		t.Fatalf("pdf: %v", err)
+	}
+}
+
+func Test_Ticket_Board_RejectsBeforeTouchingDB(t *testing.T) {
+	priv := testTicketKey()
+	pub := priv.Public().(ed25519.PublicKey)
+	ts, _ := ticket.Issue(priv, paidBooking())
+	ctx := context.Background()
+	cases := []struct{ payload, trip, code string }{
+		{ts[0].Payload, "", booking.CodeInvalid},
+		{"KT1.bm9wZQ.AAAA", "trip-1", ticket.CodeInvalidTicket},
+		{ts[0].Payload, "trip-2", ticket.CodeWrongTrip},
+	}
+	for _, c := range cases {
+		// A nil Querier proves these are decided from the payload alone.
+		if _, err := ticket.Board(ctx, nil, pub, c.payload, c.trip, "G1"); booking.ErrorCode(err) != c.code {
+			t.Fatalf("trip %q: want %s, got %v", c.trip, c.code, err)
+		}
+	}
+	if _, err := ticket.Board(ctx, nil, pub, ts[0].Payload, ts[0].TripID, strings.Repeat("G", 65)); booking.ErrorCode(err) != booking.CodeInvalid {
+		t.Fatalf("gate longer than boardings.gate: %v", err)
+	}
+}
+
+func Test_API_Verify_RequiresGateToken(t *testing.T) {
+	_ = os.Setenv("LOG_FORMAT", "off")
+	_ = os.Setenv("GATE_API_TOKEN", "gate-secret")
+	defer os.Unsetenv("GATE_API_TOKEN")
+	r := server.New()
+	routes.Register(r)
+	for _, auth := range []string{"", "Bearer wrong"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader(`{"payload":"KT1.a.b","trip_id":"t"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("auth %q: want 401, got %d %q", auth, rec.Code, rec.Body.String())
+		}
+	}
+}